@@ -0,0 +1,239 @@
+package ratchet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// BackfillShard is a portion of the range being backfilled. Date range
+// backfills set From and To, ID range backfills set FromID and ToID. Ranges
+// include the start and exclude the end.
+type BackfillShard struct {
+	Index  int
+	From   time.Time
+	To     time.Time
+	FromID int64
+	ToID   int64
+}
+
+func (s BackfillShard) String() string {
+	if !s.From.IsZero() || !s.To.IsZero() {
+		return fmt.Sprintf("%v - %v", s.From.Format(time.RFC3339), s.To.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%d - %d", s.FromID, s.ToID)
+}
+
+// Backfill runs a parameterized Pipeline once for each shard of a date or ID
+// range, running several shards concurrently. This is useful for historical
+// reloads that are too large (or too slow) to run as a single Pipeline.
+//
+// NewPipeline is called for every shard attempt, and should return a
+// Pipeline limited to that shard's range (for example by building the
+// query of a SQLReader from it). A failed shard is retried up to Retries
+// times. If CheckpointFile is set, completed shards are recorded in it and
+// skipped when the Backfill is run again, so a failed backfill can simply
+// be re-run.
+type Backfill struct {
+	NewPipeline    func(shard BackfillShard) (*Pipeline, error)
+	Concurrency    int // Number of shards run at the same time, defaults to 1.
+	Retries        int
+	CheckpointFile string
+	shards         []BackfillShard
+	completed      map[string]bool
+	mutex          sync.Mutex
+}
+
+// NewDateBackfill returns a Backfill splitting the time range from start to
+// end into shards of the given step (e.g. 24*time.Hour for daily shards).
+func NewDateBackfill(start, end time.Time, step time.Duration, newPipeline func(shard BackfillShard) (*Pipeline, error)) *Backfill {
+	b := &Backfill{NewPipeline: newPipeline, Concurrency: 1}
+	for from := start; from.Before(end) && step > 0; from = from.Add(step) {
+		to := from.Add(step)
+		if to.After(end) {
+			to = end
+		}
+		b.shards = append(b.shards, BackfillShard{Index: len(b.shards), From: from, To: to})
+	}
+	return b
+}
+
+// NewIDBackfill returns a Backfill splitting the ID range from start to end
+// into shards of step IDs each.
+func NewIDBackfill(start, end, step int64, newPipeline func(shard BackfillShard) (*Pipeline, error)) *Backfill {
+	b := &Backfill{NewPipeline: newPipeline, Concurrency: 1}
+	for from := start; from < end && step > 0; from += step {
+		to := from + step
+		if to > end {
+			to = end
+		}
+		b.shards = append(b.shards, BackfillShard{Index: len(b.shards), FromID: from, ToID: to})
+	}
+	return b
+}
+
+// Shards returns the shards the range has been split into.
+func (b *Backfill) Shards() []BackfillShard {
+	return b.shards
+}
+
+// BackfillShardResult holds the outcome of running a single shard.
+type BackfillShardResult struct {
+	Shard    BackfillShard
+	Skipped  bool // The shard had already completed according to the checkpoint file.
+	Attempts int
+	Duration time.Duration
+	Err      error
+	Stats    *PipelineStats
+}
+
+// BackfillReport is the combined result of all the shards in a Backfill.
+type BackfillReport struct {
+	Results   []BackfillShardResult
+	Succeeded int
+	Skipped   int
+	Failed    int
+	Duration  time.Duration
+}
+
+func (r *BackfillReport) String() string {
+	o := fmt.Sprintf("Backfill: %d shards in %v, %d succeeded, %d skipped, %d failed\r\n",
+		len(r.Results), r.Duration, r.Succeeded, r.Skipped, r.Failed)
+	for _, res := range r.Results {
+		status := "OK"
+		if res.Skipped {
+			status = "SKIPPED"
+		} else if res.Err != nil {
+			status = "FAILED: " + res.Err.Error()
+		}
+		o += fmt.Sprintf("  * Shard %d (%v) - %d attempt(s) in %v - %s\r\n",
+			res.Shard.Index+1, res.Shard, res.Attempts, res.Duration, status)
+	}
+	return o
+}
+
+// Run executes all the shards and returns the combined report. An error is
+// returned if any shard failed after all its retries, or if the checkpoint
+// file couldn't be read.
+func (b *Backfill) Run() (*BackfillReport, error) {
+	start := time.Now()
+	if err := b.loadCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	report := &BackfillReport{Results: make([]BackfillShardResult, len(b.shards))}
+	concurrency := b.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// Decide which shards to skip before any run, since running shards
+	// mark themselves completed.
+	skip := make([]bool, len(b.shards))
+	for i, shard := range b.shards {
+		skip[i] = b.completed[shard.String()]
+	}
+	throttle := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, shard := range b.shards {
+		if skip[i] {
+			report.Results[i] = BackfillShardResult{Shard: shard, Skipped: true}
+			continue
+		}
+		wg.Add(1)
+		throttle <- struct{}{}
+		go func(i int, shard BackfillShard) {
+			defer wg.Done()
+			report.Results[i] = b.runShard(shard)
+			<-throttle
+		}(i, shard)
+	}
+	wg.Wait()
+
+	for _, res := range report.Results {
+		switch {
+		case res.Skipped:
+			report.Skipped++
+		case res.Err != nil:
+			report.Failed++
+		default:
+			report.Succeeded++
+		}
+	}
+	report.Duration = time.Since(start)
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("Backfill: %d of %d shards failed", report.Failed, len(b.shards))
+	}
+	return report, nil
+}
+
+func (b *Backfill) runShard(shard BackfillShard) BackfillShardResult {
+	res := BackfillShardResult{Shard: shard}
+	start := time.Now()
+	for res.Attempts <= b.Retries {
+		res.Attempts++
+		logger.Status("Backfill: running shard", shard.Index+1, "(", shard, ") attempt", res.Attempts)
+		var p *Pipeline
+		p, res.Err = b.NewPipeline(shard)
+		if res.Err == nil {
+			res.Err = <-p.Run()
+			res.Stats = p.StatsReport()
+		}
+		if res.Err == nil {
+			break
+		}
+		logger.Error("Backfill: shard", shard.Index+1, "failed -", res.Err)
+	}
+	res.Duration = time.Since(start)
+
+	if res.Err == nil {
+		if err := b.markCompleted(shard); err != nil {
+			logger.Error("Backfill: unable to write checkpoint -", err)
+		}
+	}
+	return res
+}
+
+func (b *Backfill) loadCheckpoint() error {
+	b.completed = make(map[string]bool)
+	if b.CheckpointFile == "" {
+		return nil
+	}
+	d, err := ioutil.ReadFile(b.CheckpointFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var keys []string
+	if err := json.Unmarshal(d, &keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		b.completed[k] = true
+	}
+	return nil
+}
+
+func (b *Backfill) markCompleted(shard BackfillShard) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.completed[shard.String()] = true
+	if b.CheckpointFile == "" {
+		return nil
+	}
+	keys := []string{}
+	for k := range b.completed {
+		keys = append(keys, k)
+	}
+	d, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.CheckpointFile, d, 0644)
+}
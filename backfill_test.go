@@ -0,0 +1,109 @@
+package ratchet_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// failer fails the Pipeline with err, if it's set.
+type failer struct {
+	err error
+}
+
+func (f failer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if f.err != nil {
+		killChan <- f.err
+	}
+}
+
+func (f failer) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestBackfillShards(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var got []string
+	for _, s := range ratchet.NewDateBackfill(start, start.Add(60*time.Hour), day, nil).Shards() {
+		got = append(got, fmt.Sprint(s.Index, " ", s))
+	}
+	want := []string{
+		"0 2026-01-01T00:00:00Z - 2026-01-02T00:00:00Z",
+		"1 2026-01-02T00:00:00Z - 2026-01-03T00:00:00Z",
+		"2 2026-01-03T00:00:00Z - 2026-01-03T12:00:00Z",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got date shards %q, want %q", got, want)
+	}
+
+	got = nil
+	for _, s := range ratchet.NewIDBackfill(1, 251, 100, nil).Shards() {
+		got = append(got, s.String())
+	}
+	if want := []string{"1 - 101", "101 - 201", "201 - 251"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got ID shards %q, want %q", got, want)
+	}
+}
+
+func TestBackfillRun(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	checkpoint := filepath.Join(t.TempDir(), "backfill.json")
+	var mutex sync.Mutex
+	attempts := map[int64]int{}
+	// Shard 2 fails once, shard 4 every time.
+	newPipeline := func(shard ratchet.BackfillShard) (*ratchet.Pipeline, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[shard.FromID]++
+		var err error
+		if (shard.FromID == 10 && attempts[shard.FromID] == 1) || shard.FromID == 30 {
+			err = errors.New("connection refused")
+		}
+		return ratchet.NewPipeline(sender{`{}`}, failer{err}), nil
+	}
+	b := ratchet.NewIDBackfill(0, 50, 10, newPipeline)
+	b.Concurrency = 3
+	b.Retries = 1
+	b.CheckpointFile = checkpoint
+
+	report, err := b.Run()
+	if err == nil {
+		t.Error("got no error with a failed shard")
+	}
+	if report.Succeeded != 4 || report.Failed != 1 || report.Skipped != 0 {
+		t.Errorf("got %d succeeded, %d failed and %d skipped, want 4, 1 and 0", report.Succeeded, report.Failed, report.Skipped)
+	}
+	var gotAttempts []int
+	for _, res := range report.Results {
+		gotAttempts = append(gotAttempts, res.Attempts)
+	}
+	if want := []int{1, 2, 1, 2, 1}; !reflect.DeepEqual(gotAttempts, want) {
+		t.Errorf("got attempts %v, want %v", gotAttempts, want)
+	}
+	if res := report.Results[3]; res.Err == nil || res.Shard.FromID != 30 {
+		t.Errorf("got result %+v for shard 4, want its error", res)
+	}
+
+	// Re-running it only runs the shard that failed.
+	attempts = map[int64]int{}
+	b = ratchet.NewIDBackfill(0, 50, 10, newPipeline)
+	b.CheckpointFile = checkpoint
+	report, err = b.Run()
+	if err == nil {
+		t.Error("got no error with a failed shard")
+	}
+	if report.Succeeded != 0 || report.Failed != 1 || report.Skipped != 4 {
+		t.Errorf("got %d succeeded, %d failed and %d skipped, want 0, 1 and 4", report.Succeeded, report.Failed, report.Skipped)
+	}
+	if want := map[int64]int{30: 1}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("got attempts %v, want %v", attempts, want)
+	}
+}
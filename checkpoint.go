@@ -0,0 +1,129 @@
+package ratchet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// CheckpointStore persists small pieces of state between Pipeline runs,
+// such as the high-water mark of an incremental extract. Values are
+// stored as JSON under a key, which should be unique to the DataProcessor
+// using it.
+type CheckpointStore interface {
+	// Load decodes the value saved for key into v, and returns false if
+	// nothing has been saved for it.
+	Load(key string, v interface{}) (bool, error)
+	// Save saves v for key, replacing any previous value.
+	Save(key string, v interface{}) error
+}
+
+// CommittingDataProcessor can be implemented by DataProcessors that have
+// state to save (typically to a CheckpointStore) once all the data they
+// sent has been processed, e.g. a reader's position in its source. Commit
+// is called after every stage has finished, and only if the Pipeline
+// succeeded: it isn't called if any errors were sent, if the Pipeline was
+// cancelled, or in a dry run.
+type CommittingDataProcessor interface {
+	Commit() error
+}
+
+// FileCheckpointStore is a CheckpointStore holding every key in a single
+// JSON file. The file is rewritten (atomically, by renaming a temporary
+// file) on every Save.
+type FileCheckpointStore struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// NewFileCheckpointStore returns a new FileCheckpointStore using the file
+// at path, which is created by the first Save if it doesn't exist.
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{Path: path}
+}
+
+func (s *FileCheckpointStore) read() (map[string]json.RawMessage, error) {
+	values := make(map[string]json.RawMessage)
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Load - see CheckpointStore.
+func (s *FileCheckpointStore) Load(key string, v interface{}) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	b, ok := values[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(b, v)
+}
+
+// Save - see CheckpointStore.
+func (s *FileCheckpointStore) Save(key string, v interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values, err := s.read()
+	if err != nil {
+		return err
+	}
+	if values[key], err = json.Marshal(v); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// commit calls Commit on every CommittingDataProcessor, if the Pipeline
+// succeeded, returning the first error.
+func (p *Pipeline) commit() error {
+	if p.DryRun || atomic.LoadInt32(&p.failed) != 0 {
+		return nil
+	}
+	for n, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			c, ok := dp.DataProcessor.(CommittingDataProcessor)
+			if !ok {
+				continue
+			}
+			if err := c.Commit(); err != nil {
+				if p.LegacyErrors {
+					return err
+				}
+				return p.newPipelineError(n, dp, nil, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package ratchet_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoints.json")
+	store := ratchet.NewFileCheckpointStore(path)
+
+	// Nothing is saved until the first Save creates the file.
+	var watermark string
+	if ok, err := store.Load("orders", &watermark); ok || err != nil {
+		t.Fatalf("got %v, %v before any Save, want false and no error", ok, err)
+	}
+
+	if err := store.Save("orders", "2026-10-17 09:30:00"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("customers", 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("orders", "2026-10-17 10:00:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new store reads back the latest value of each key.
+	store = ratchet.NewFileCheckpointStore(path)
+	if ok, err := store.Load("orders", &watermark); !ok || err != nil || watermark != "2026-10-17 10:00:00" {
+		t.Errorf("got %q, %v, %v, want the last value saved for orders", watermark, ok, err)
+	}
+	var id int
+	if ok, err := store.Load("customers", &id); !ok || err != nil || id != 42 {
+		t.Errorf("got %d, %v, %v, want 42 for customers", id, ok, err)
+	}
+
+	// Every Save renames a complete file into place, leaving no
+	// temporary files behind.
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		t.Errorf("the file isn't valid JSON: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{path}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v, want only %v", files, want)
+	}
+}
+
+func TestFileCheckpointStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	if err := ioutil.WriteFile(path, []byte(`{"orders":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := ratchet.NewFileCheckpointStore(path)
+	var watermark string
+	if _, err := store.Load("orders", &watermark); err == nil {
+		t.Error("got no error loading from a corrupt file")
+	}
+	// Saving doesn't replace the corrupt file, and lose the other keys.
+	if err := store.Save("orders", "x"); err == nil {
+		t.Error("got no error saving to a corrupt file")
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != `{"orders":` {
+		t.Errorf("the corrupt file was replaced with %q", b)
+	}
+}
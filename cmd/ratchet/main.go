@@ -0,0 +1,407 @@
+// Command ratchet runs a Pipeline defined in a YAML or JSON file (see the
+// config package), so ratchet jobs can be run from cron or CI without
+// writing a main package:
+//
+//	ratchet [flags] pipeline.yml
+//
+// Overlays (see config.Load) are merged over the definition with -overlay,
+// or with -env, which merges the file for that environment next to the
+// definition, e.g. prod.yaml for base.yaml. The effective definition can be
+// reviewed, and checked without running anything, with:
+//
+//	ratchet config validate [-env name] [-overlay file] pipeline.yml
+//
+// Database connection strings can be given in the definition (where
+// environment variables are expanded), overridden with -db name=dsn, or
+// with a RATCHET_DB_<NAME> environment variable. The MySQL, PostgreSQL
+// and SQLite (driver name "sqlite") drivers are included.
+//
+// With -schedule, the pipeline is run on a cron schedule (see
+// ratchet.Schedule) until the command is interrupted, and the result of
+// each run is printed to stderr.
+//
+// Processors served by plugin binaries (see the plugin package) in the
+// directories given with -plugins, or in RATCHET_PLUGIN_PATH, can be used
+// as processor types.
+//
+// When the definition has a checkpoint_file, runs are recorded in it, and
+// a run that failed can be re-run with -rerun and the run ID printed when
+// it failed (see ratchet.Pipeline.Rerun).
+//
+// The stats for each stage are printed to stderr when the Pipeline
+// finishes, and the exit status is nonzero if it fails.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/config"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/plugin"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+	_ "modernc.org/sqlite"
+)
+
+// dbFlags collects repeated -db name=dsn flags.
+type dbFlags map[string]string
+
+func (f dbFlags) String() string {
+	return fmt.Sprint(map[string]string(f))
+}
+
+func (f dbFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected name=dsn, got %q", s)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// overlayFlags collects repeated -overlay flags.
+type overlayFlags []string
+
+func (f *overlayFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *overlayFlags) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// overlayFiles returns the overlays for the definition at path: the file
+// for env next to it, if env is set, then the -overlay files.
+func overlayFiles(path, env string, overlays overlayFlags) []string {
+	var files []string
+	if env != "" {
+		files = append(files, filepath.Join(filepath.Dir(path), env+filepath.Ext(path)))
+	}
+	return append(files, overlays...)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:]))
+	}
+	os.Exit(run())
+}
+
+// runConfig runs the config subcommands.
+func runConfig(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	var overlays overlayFlags
+	flags.Var(&overlays, "overlay", "merge this file over the definition (repeatable)")
+	env := flags.String("env", "", "merge the file for this environment next to the definition, e.g. prod.yaml")
+	pluginPath := flags.String("plugins", os.Getenv("RATCHET_PLUGIN_PATH"), "directories to load plugins from, separated by "+string(os.PathListSeparator))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s config validate [flags] pipeline.yml\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "validate" {
+		flags.Usage()
+		return 2
+	}
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if err := loadPlugins(*pluginPath); err != nil {
+		fmt.Fprintln(os.Stderr, "error loading plugins:", err)
+		return 1
+	}
+
+	def, err := config.Load(flags.Arg(0), overlayFiles(flags.Arg(0), *env, overlays)...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error loading pipeline:", err)
+		return 1
+	}
+	rendered, err := def.Render()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error rendering pipeline:", err)
+		return 1
+	}
+	os.Stdout.Write(rendered)
+	if err := def.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid pipeline:", err)
+		return 1
+	}
+	return 0
+}
+
+func run() int {
+	dbs := dbFlags{}
+	flag.Var(dbs, "db", "override a database connection string, as name=dsn (repeatable)")
+	var overlays overlayFlags
+	flag.Var(&overlays, "overlay", "merge this file over the definition (repeatable, see config.Load)")
+	env := flag.String("env", "", "merge the file for this environment next to the definition, e.g. prod.yaml")
+	dryRun := flag.Bool("dry-run", false, "run readers and transforms, but don't write anything (see ratchet.Pipeline.DryRun)")
+	timeout := flag.Duration("timeout", 0, "cancel the pipeline (or stop the schedule) if it runs longer than this")
+	maxConcurrency := flag.Int("max-concurrency", 0, "cap the concurrency of every processor (see ratchet.Pipeline.MaxConcurrency)")
+	stageTimeout := flag.Duration("stage-timeout", 0, "fail the pipeline if a processor makes no progress for this long (see ratchet.Pipeline.StageTimeout)")
+	progress := flag.Duration("progress", 0, "print progress to stderr at this interval")
+	stats := flag.Bool("stats", true, "print stage stats to stderr when finished")
+	logLevel := flag.String("log", "error", "log level: debug, info, error, status or silent")
+	listTypes := flag.Bool("types", false, "list the available processor types and exit")
+	schedule := flag.String("schedule", "", "run the pipeline on this cron schedule until interrupted, e.g. \"*/15 * * * *\" (see ratchet.Schedule)")
+	overlap := flag.String("overlap", "skip", "with -schedule, what to do when a run is due while the last is still going: skip, queue or concurrent")
+	jitter := flag.Duration("jitter", 0, "with -schedule, delay each run by up to this long")
+	rerun := flag.String("rerun", "", "re-run the failed run with this ID (see ratchet.Pipeline.Rerun)")
+	pluginPath := flag.String("plugins", os.Getenv("RATCHET_PLUGIN_PATH"), "directories to load plugins from, separated by "+string(os.PathListSeparator))
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] pipeline.yml\n       %s config validate [flags] pipeline.yml\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := setLogLevel(*logLevel); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := loadPlugins(*pluginPath); err != nil {
+		fmt.Fprintln(os.Stderr, "error loading plugins:", err)
+		return 1
+	}
+
+	if *listTypes {
+		for _, t := range config.Types() {
+			fmt.Println(t)
+		}
+		return 0
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return 2
+	}
+
+	build := func() (*ratchet.Pipeline, *config.PipelineDefinition, error) {
+		def, err := config.Load(flag.Arg(0), overlayFiles(flag.Arg(0), *env, overlays)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error loading pipeline: %v", err)
+		}
+		resolveDatabases(def, dbs)
+		p, err := def.Build()
+		if err != nil {
+			def.Close()
+			return nil, nil, fmt.Errorf("error building pipeline: %v", err)
+		}
+		if *dryRun {
+			p.DryRun = true
+		}
+		if *maxConcurrency > 0 {
+			p.MaxConcurrency = *maxConcurrency
+		}
+		if *stageTimeout > 0 {
+			p.StageTimeout = *stageTimeout
+		}
+		if *progress > 0 {
+			p.ProgressInterval = *progress
+			p.OnProgress(printProgress)
+		}
+		return p, def, nil
+	}
+
+	if *schedule != "" {
+		return runScheduled(*schedule, *overlap, *jitter, *timeout, *stats, build)
+	}
+
+	p, def, err := build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer def.Close()
+
+	if *rerun != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if *timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, *timeout)
+			defer cancel()
+		}
+		killChan, rerr := p.RerunContext(ctx, *rerun)
+		if rerr != nil {
+			fmt.Fprintln(os.Stderr, rerr)
+			return 1
+		}
+		err = <-killChan
+	} else if *timeout > 0 {
+		err = <-p.RunWithTimeout(*timeout)
+	} else {
+		err = <-p.Run()
+	}
+
+	if *stats {
+		fmt.Fprint(os.Stderr, p.Stats())
+	}
+	if p.DryRun {
+		printDryRun(p)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pipeline failed:", err)
+		if p.RunStore != nil {
+			fmt.Fprintln(os.Stderr, "re-run it with -rerun", p.RunID())
+		}
+		return 1
+	}
+	return 0
+}
+
+// resolveDatabases applies RATCHET_DB_<NAME> environment variables, then
+// -db flags, over the connection strings in the definition.
+func resolveDatabases(def *config.PipelineDefinition, dbs dbFlags) {
+	for name, dd := range def.Databases {
+		if dsn, ok := os.LookupEnv("RATCHET_DB_" + strings.ToUpper(name)); ok {
+			dd.DSN = dsn
+		}
+		if dsn, ok := dbs[name]; ok {
+			dd.DSN = dsn
+		}
+		def.Databases[name] = dd
+	}
+	for name := range dbs {
+		if _, ok := def.Databases[name]; !ok {
+			fmt.Fprintf(os.Stderr, "warning: -db %v isn't used by the pipeline\n", name)
+		}
+	}
+}
+
+// runScheduled runs the pipeline on a cron schedule until the process is
+// interrupted or terminated. The definition is loaded again for every
+// run, so changes to it are picked up without a restart.
+func runScheduled(spec, overlap string, jitter, timeout time.Duration, stats bool, build func() (*ratchet.Pipeline, *config.PipelineDefinition, error)) int {
+	// Check the definition before waiting for the first run.
+	_, def, err := build()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	def.Close()
+
+	scheduled, err := ratchet.Schedule(spec, func() (*ratchet.Pipeline, error) {
+		p, def, err := build()
+		if err != nil {
+			return nil, err
+		}
+		p.AddObserver(closeOnFinish{def: def})
+		return p, nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	policies := map[string]ratchet.OverlapPolicy{
+		"skip":       ratchet.OverlapSkip,
+		"queue":      ratchet.OverlapQueue,
+		"concurrent": ratchet.OverlapConcurrent,
+	}
+	policy, ok := policies[overlap]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown overlap policy %q\n", overlap)
+		return 2
+	}
+	scheduled.Overlap = policy
+	scheduled.Jitter = jitter
+	scheduled.OnRun = func(run ratchet.ScheduledRun) {
+		fmt.Fprintln(os.Stderr, run)
+		if stats && run.Stats != nil {
+			fmt.Fprint(os.Stderr, run.Stats)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	scheduled.Run(ctx)
+	return 0
+}
+
+// closeOnFinish closes a PipelineDefinition's resources when its Pipeline
+// finishes.
+type closeOnFinish struct {
+	ratchet.NopObserver
+	def *config.PipelineDefinition
+}
+
+func (o closeOnFinish) PipelineFinished(p *ratchet.Pipeline, err error) {
+	o.def.Close()
+}
+
+// loadPlugins registers the processors of the plugins in the directories
+// in path.
+func loadPlugins(path string) error {
+	if path == "" {
+		return nil
+	}
+	registry := plugin.NewRegistry()
+	for _, dir := range filepath.SplitList(path) {
+		if err := registry.Discover(dir); err != nil {
+			return err
+		}
+	}
+	config.RegisterPlugins(registry)
+	return nil
+}
+
+func setLogLevel(level string) error {
+	levels := map[string]int{
+		"debug":  logger.LevelDebug,
+		"info":   logger.LevelInfo,
+		"error":  logger.LevelError,
+		"status": logger.LevelStatus,
+		"silent": logger.LevelSilent,
+	}
+	l, ok := levels[level]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	logger.LogLevel = l
+	return nil
+}
+
+func printProgress(e ratchet.ProgressEvent) {
+	var stages []string
+	for _, s := range e.Stages {
+		stages = append(stages, fmt.Sprintf("%v: %d", s.Processor, s.Records))
+	}
+	status := e.Elapsed.Round(time.Second).String()
+	if e.Fraction >= 0 {
+		status += fmt.Sprintf(" %.0f%%", e.Fraction*100)
+		if e.EstimatedRemaining > 0 {
+			status += fmt.Sprintf(" (%v left)", e.EstimatedRemaining.Round(time.Second))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%v: %v [%v]\n", e.Pipeline, status, strings.Join(stages, ", "))
+}
+
+func printDryRun(p *ratchet.Pipeline) {
+	for _, r := range p.DryRunResults() {
+		fmt.Fprintf(os.Stderr, "dry run - stage %d %v: %d payloads, %d records\n", r.Stage, r.Processor, r.Payloads, r.Records)
+		for _, t := range r.Targets {
+			fmt.Fprintln(os.Stderr, "  target:", t)
+		}
+		for _, s := range r.Statements {
+			fmt.Fprintln(os.Stderr, "  statement:", s)
+		}
+		for _, d := range r.Samples {
+			fmt.Fprintln(os.Stderr, "  sample:", string(d))
+		}
+	}
+}
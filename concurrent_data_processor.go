@@ -13,9 +13,13 @@ import (
 // then the pipeline will allow the stage to execute up to 2 ProcessData()
 // calls concurrently.
 //
-// Note that the order of data processing is maintained, meaning that
-// when a DataProcessor receives ProcessData calls d1, d2, ..., the resulting data
-// payloads sent on the outputChan will be sent in the same order as received.
+// The output of concurrent calls is sent on in the order their data was
+// received: when DataProcessors receive ProcessData calls d1, d2, ..., the
+// resulting data payloads are sent on in the same order, even when the
+// calls finish out of order. Where the order doesn't matter, call
+// UnorderedOutput on the dataProcessor (see Do) to pass output on as soon
+// as it's sent instead. Alternatively, PartitionBy only keeps the order of
+// the records with the same key.
 type ConcurrentDataProcessor interface {
 	DataProcessor
 	Concurrency() int
@@ -30,96 +34,118 @@ func isConcurrent(p DataProcessor) bool {
 // dataProcessor embeds concurrentDataProcessor
 type concurrentDataProcessor struct {
 	concurrency  int
+	unordered    bool
+	partitionBy  string
+	partitions   []chan func() // The work for each worker, see PartitionBy
 	workThrottle chan workSignal
-	workList     *list.List
-	doneChan     chan bool
-	inputClosed  bool
+	workList     *list.List // Results of calls, in the order received
+	working      sync.WaitGroup
 	sync.Mutex
 }
 
 type workSignal struct{}
 
 type result struct {
-	done       bool
-	data       []data.JSON
-	outputChan chan data.JSON
-	open       bool
+	done bool
+	data []data.JSON
 }
 
-func (dp *dataProcessor) processData(d data.JSON, killChan chan error) {
+// UnorderedOutput makes a ConcurrentDataProcessor send the output of each
+// ProcessData call on as soon as it's sent, rather than in the order its
+// data was received. By default, the output of each call is held until
+// those of the calls before it have been sent, which delays it, and a slow
+// call holds up the others once the concurrency limit is reached. It has
+// no effect on other DataProcessors, whose calls are made one at a time.
+func (dp *dataProcessor) UnorderedOutput() *dataProcessor {
+	dp.unordered = true
+	return dp
+}
+
+// processData makes a ProcessData call with call, which is given the data,
+// outputChan and killChan to use. Up to dp.concurrency calls are made
+// concurrently, each in its own goroutine, in which case processData
+// returns once the call has started; see waitForWork.
+func (dp *dataProcessor) processData(d data.JSON, call func(d data.JSON, outputChan chan data.JSON, killChan chan error)) {
 	logger.Debug("dataProcessor: processData", dp, "with concurrency =", dp.concurrency)
 	// If no concurrency is needed, simply call stage.ProcessData and return...
 	if dp.concurrency <= 1 {
 		dp.recordExecution(func() {
-			dp.ProcessData(d, dp.outputChan, killChan)
+			call(d, dp.outputChan, dp.errors.killChan)
 		})
 		return
 	}
+	if dp.partitionBy != "" {
+		dp.partitionData(d, call)
+		return
+	}
 	// ... otherwise process the data in a concurrent queue/pool of goroutines
 	logger.Debug("dataProcessor: processData", dp, "waiting for work")
 	// wait for room in the queue
 	dp.workThrottle <- workSignal{}
 	logger.Debug("dataProcessor: processData", dp, "work obtained")
-	rc := make(chan data.JSON)
-	done := make(chan bool)
-	exit := make(chan bool)
-	// setup goroutine to handle result
-	go func() {
-		res := result{outputChan: dp.outputChan, data: []data.JSON{}, open: true}
+	res := &result{}
+	if !dp.unordered {
 		dp.Lock()
-		dp.workList.PushBack(&res)
+		dp.workList.PushBack(res)
 		dp.Unlock()
-		logger.Debug("dataProcessor: processData", dp, "waiting to receive data on result chan")
-		for {
-			select {
-			case d, open := <-rc:
-				logger.Debug("dataProcessor: processData", dp, "received data on result chan")
+	}
+	dp.working.Add(1)
+	go func() {
+		defer dp.working.Done()
+		killChan, flush := dp.errors.callKillChan(d)
+		defer flush()
+		if dp.unordered {
+			dp.recordExecution(func() {
+				call(d, dp.outputChan, killChan)
+			})
+			<-dp.workThrottle
+			return
+		}
+		// Collect the output on a result chan instead of the original
+		// outputChan, until it can be sent in order.
+		rc := make(chan data.JSON)
+		collected := make(chan struct{})
+		go func() {
+			for d := range rc {
 				res.data = append(res.data, d)
-				// outputChan will need to be closed if the rc chan was closed
-				res.open = open
-			case <-done:
-				res.done = true
-				logger.Debug("dataProcessor: processData", dp, "done, releasing work")
-				<-dp.workThrottle
-				dp.sendResults()
-				exit <- true
-				return
 			}
-		}
+			close(collected)
+		}()
+		dp.recordExecution(func() {
+			call(d, rc, killChan)
+		})
+		close(rc)
+		<-collected
+		dp.sendResults(res)
 	}()
-	// do normal data processing, passing in new result chan
-	// instead of the original outputChan
-	go dp.recordExecution(func() {
-		dp.ProcessData(d, rc, killChan)
-		done <- true
-	})
-
-	// wait on processing to complete
-	<-exit
 }
 
-// sendResults handles sending work that is completed, as well as
-// guaranteeing a FIFO order of the resulting data sent over the
-// original outputChan.
-func (dp *dataProcessor) sendResults() {
+// sendResults marks res as done, and sends the results at the front of
+// the workList that are done, guaranteeing a FIFO order of the data sent
+// over the original outputChan. Each call's place in the queue is only
+// released once its results are sent, so no more than dp.concurrency
+// calls' results are held.
+func (dp *dataProcessor) sendResults(res *result) {
 	dp.Lock()
-	logger.Debug("dataProcessor: sendResults checking for valid data to send")
+	defer dp.Unlock()
+	res.done = true
 	e := dp.workList.Front()
 	for e != nil && e.Value.(*result).done {
-		logger.Debug("dataHandler: sendResults sending data")
+		logger.Debug("dataProcessor: sendResults sending data")
 		res := dp.workList.Remove(e).(*result)
 		for _, d := range res.data {
-			res.outputChan <- d
-		}
-		if !res.open {
-			logger.Debug("dataProcessor: sendResults closing outputChan")
-			close(res.outputChan)
+			dp.outputChan <- d
 		}
+		<-dp.workThrottle
 		e = dp.workList.Front()
 	}
-	dp.Unlock()
+}
 
-	if dp.inputClosed && dp.workList.Len() == 0 {
-		dp.doneChan <- true
+// waitForWork waits for the ProcessData calls made concurrently to return,
+// and their results to be sent.
+func (dp *dataProcessor) waitForWork() {
+	if dp.partitions != nil {
+		dp.stopPartitions()
 	}
+	dp.working.Wait()
 }
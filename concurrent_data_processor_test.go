@@ -0,0 +1,203 @@
+package ratchet_test
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// slowFirst sends on the numbers it receives, taking longer for the lower
+// ones, so its concurrent calls finish in about the reverse order. It
+// records the most calls running at once.
+type slowFirst struct {
+	running, max int
+	sync.Mutex
+}
+
+func (s *slowFirst) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.Lock()
+	s.running++
+	if s.running > s.max {
+		s.max = s.running
+	}
+	s.Unlock()
+	n, _ := strconv.Atoi(string(d))
+	time.Sleep(time.Duration(10-n) * 10 * time.Millisecond)
+	outputChan <- d
+	s.Lock()
+	s.running--
+	s.Unlock()
+}
+
+func (s *slowFirst) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func (s *slowFirst) Concurrency() int {
+	return 4
+}
+
+// collector records the payloads it receives.
+type collector struct {
+	payloads []string
+}
+
+func (c *collector) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	c.payloads = append(c.payloads, string(d))
+}
+
+func (c *collector) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestConcurrentDataProcessorOutputOrder(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	in := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}
+	for _, unordered := range []bool{false, true} {
+		name := "ordered"
+		if unordered {
+			name = "unordered"
+		}
+		t.Run(name, func(t *testing.T) {
+			work, out := &slowFirst{}, &collector{}
+			p := ratchet.NewPipeline(sender(in), work, out)
+			if unordered {
+				if err := p.SetStageUnorderedOutput(2); err != nil {
+					t.Fatal(err)
+				}
+			}
+			select {
+			case err := <-p.Run():
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				// e.g. a call's place in the queue was never released.
+				t.Fatal("the Pipeline didn't finish")
+			}
+			if work.max != 4 {
+				t.Errorf("got up to %d concurrent calls, want 4", work.max)
+			}
+			if !unordered {
+				if !reflect.DeepEqual(out.payloads, in) {
+					t.Errorf("got %v, want %v", out.payloads, in)
+				}
+				return
+			}
+			if len(out.payloads) != len(in) {
+				t.Fatalf("got %v, want all of %v", out.payloads, in)
+			}
+			if out.payloads[0] == "1" {
+				t.Errorf("got %v, want the slowest call's output later", out.payloads)
+			}
+		})
+	}
+}
+
+// lateFailer fails to flush what it receives in the background, after its
+// ProcessData call has returned. Finish waits for the flushes.
+type lateFailer struct {
+	flushing sync.WaitGroup
+}
+
+func (f *lateFailer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	f.flushing.Add(1)
+	go func() {
+		defer f.flushing.Done()
+		time.Sleep(10 * time.Millisecond)
+		killChan <- errors.New("flush failed")
+	}()
+}
+
+func (f *lateFailer) Finish(outputChan chan data.JSON, killChan chan error) {
+	f.flushing.Wait()
+}
+
+func (f *lateFailer) Concurrency() int {
+	return 2
+}
+
+func (f *lateFailer) String() string {
+	return "lateFailer"
+}
+
+func TestConcurrentDataProcessorLateError(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	p := ratchet.NewPipeline(sender{"1", "2", "3"}, &lateFailer{})
+	select {
+	case err := <-p.Run():
+		var pe *ratchet.PipelineError
+		if !errors.As(err, &pe) || pe.Err.Error() != "flush failed" || pe.Stage != 2 {
+			t.Fatalf("got %v, want the flush error from stage 2", err)
+		}
+		if string(pe.Record) != "1" && string(pe.Record) != "2" && string(pe.Record) != "3" {
+			t.Errorf("got record %q, want the data of the call that failed", pe.Record)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish")
+	}
+}
+
+// serial is a slowFirst that isn't a ConcurrentDataProcessor.
+type serial struct {
+	s *slowFirst
+}
+
+func (s serial) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.s.ProcessData(d, outputChan, killChan)
+}
+
+func (s serial) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestConcurrencyOverrides(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name             string
+		serial           bool
+		stageConcurrency int // Not set if 0
+		maxConcurrency   int
+		want             int
+	}{
+		{"Concurrency", false, 0, 0, 4},
+		{"stage above Concurrency", false, 6, 0, 6},
+		{"stage below Concurrency", false, 2, 0, 2},
+		{"stage of 1", false, 1, 0, 1},
+		{"MaxConcurrency", false, 0, 3, 3},
+		{"stage above MaxConcurrency", false, 6, 3, 3},
+		{"stage below MaxConcurrency", false, 2, 3, 2},
+		{"not concurrent", true, 6, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			work := &slowFirst{}
+			var dp ratchet.DataProcessor = work
+			if test.serial {
+				dp = serial{work}
+			}
+			p := ratchet.NewPipeline(sender{"1", "2", "3", "4", "5", "6", "7", "8", "9"}, dp, &collector{})
+			p.MaxConcurrency = test.maxConcurrency
+			if test.stageConcurrency > 0 {
+				if err := p.SetStageConcurrency(2, test.stageConcurrency); err != nil {
+					t.Fatal(err)
+				}
+			}
+			select {
+			case err := <-p.Run():
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the Pipeline didn't finish")
+			}
+			if work.max != test.want {
+				t.Errorf("got up to %d concurrent calls, want %d", work.max, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/jmoiron/sqlx"
+)
+
+// PipelineDefinition describes a Pipeline. See the package documentation
+// for an example.
+type PipelineDefinition struct {
+	Name         string                        `json:"name"`
+	BufferLength int                           `json:"buffer_length"`
+	Unbuffered   bool                          `json:"unbuffered"`
+	DryRun       bool                          `json:"dry_run"`
+	Databases    map[string]DatabaseDefinition `json:"databases"`
+	Stages       [][]ProcessorDefinition       `json:"stages"`
+	// CheckpointFile is where processors save state between runs, such as
+	// the watermarks of incremental extracts. See CheckpointStore. Runs
+	// are recorded in it too, so that failed runs can be re-run, see
+	// ratchet.Pipeline.Rerun.
+	CheckpointFile string `json:"checkpoint_file"`
+	// StageTimeout stops the Pipeline when a processor makes no progress
+	// for this long, see ratchet.Pipeline.StageTimeout.
+	StageTimeout Duration `json:"stage_timeout"`
+	// MaxConcurrency caps the concurrency of every processor, see
+	// ratchet.Pipeline.MaxConcurrency.
+	MaxConcurrency int `json:"max_concurrency"`
+
+	dbs         map[string]*sqlx.DB
+	closers     []io.Closer
+	checkpoints *ratchet.FileCheckpointStore
+	document    interface{} // The parsed document, see Render
+	validating  bool        // Set by Validate
+}
+
+// DatabaseDefinition describes a database connection, opened with
+// sqlx.Open. Environment variables in the DSN are expanded, so credentials
+// don't need to be stored in the definition.
+type DatabaseDefinition struct {
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+}
+
+// ProcessorDefinition describes a single DataProcessor in a stage.
+type ProcessorDefinition struct {
+	// ID is used to refer to the processor in Outputs, and is only needed
+	// for branching layouts.
+	ID      string  `json:"id"`
+	Type    string  `json:"type"`
+	Options Options `json:"options"`
+	// Outputs lists the ids of processors in the next stage to send data
+	// to. If empty, data is sent to every processor in the next stage.
+	Outputs []string `json:"outputs"`
+	// Concurrency overrides the processor's ConcurrencyLevel option, for
+	// processors that have one.
+	Concurrency int `json:"concurrency"`
+	// UnorderedOutput makes a concurrent processor send its output on as
+	// soon as it's sent, rather than in the order its data was received,
+	// see ratchet.ConcurrentDataProcessor.
+	UnorderedOutput bool `json:"unordered_output"`
+	// PartitionBy makes a concurrent processor process the records with
+	// the same value for this field in order, see
+	// ratchet.ConcurrentDataProcessor.
+	PartitionBy string `json:"partition_by"`
+}
+
+// Parse parses a YAML or JSON document into a PipelineDefinition.
+// Variables in its strings, such as ${SOURCE_DSN}, are interpolated from
+// the environment or from secret files, see the package documentation.
+func Parse(b []byte) (*PipelineDefinition, error) {
+	doc, err := parseDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	return newDefinition(doc)
+}
+
+// Load reads and parses the YAML or JSON file at path, with the files at
+// overlays (if any) merged over it in order, e.g. the settings for the
+// environment the Pipeline runs in:
+//
+//	def, err := config.Load("base.yaml", "prod.yaml")
+//
+// See the package documentation for how overlays are merged.
+func Load(path string, overlays ...string) (*PipelineDefinition, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range overlays {
+		overlay, err := readDocument(o)
+		if err != nil {
+			return nil, err
+		}
+		if doc, err = applyOverlay(doc, overlay); err != nil {
+			return nil, fmt.Errorf("%v: %w", o, err)
+		}
+	}
+	return newDefinition(doc)
+}
+
+// NewPipeline parses the YAML or JSON document and builds the Pipeline.
+// Resources opened for the Pipeline (such as databases) aren't closed,
+// use Parse and PipelineDefinition.Build to manage them.
+func NewPipeline(b []byte) (*ratchet.Pipeline, error) {
+	def, err := Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	return def.Build()
+}
+
+// Build creates the DataProcessors and returns the Pipeline. Close should
+// be called once the Pipeline has finished.
+func (def *PipelineDefinition) Build() (*ratchet.Pipeline, error) {
+	if len(def.Stages) == 0 {
+		return nil, util.ConfigErrorf("pipeline %q has no stages", def.Name)
+	}
+
+	processors := make([][]ratchet.DataProcessor, len(def.Stages))
+	ids := make([]map[string]ratchet.DataProcessor, len(def.Stages))
+	for n, stage := range def.Stages {
+		if len(stage) == 0 {
+			return nil, util.ConfigErrorf("stage %d has no processors", n+1)
+		}
+		ids[n] = make(map[string]ratchet.DataProcessor)
+		for i, pd := range stage {
+			p, err := def.buildProcessor(pd)
+			if err != nil {
+				def.Close()
+				return nil, fmt.Errorf("stage %d processor %d (%v): %w", n+1, i+1, pd.Type, err)
+			}
+			processors[n] = append(processors[n], p)
+			if pd.ID != "" {
+				if _, ok := ids[n][pd.ID]; ok {
+					def.Close()
+					return nil, util.ConfigErrorf("stage %d: duplicate id %q", n+1, pd.ID)
+				}
+				ids[n][pd.ID] = p
+			}
+		}
+	}
+
+	stages := make([]*ratchet.PipelineStage, len(def.Stages))
+	for n, stage := range def.Stages {
+		stages[n] = ratchet.NewPipelineStage()
+		for i, pd := range stage {
+			dp := ratchet.Do(processors[n][i])
+			if pd.UnorderedOutput {
+				dp.UnorderedOutput()
+			}
+			if pd.PartitionBy != "" {
+				dp.PartitionBy(pd.PartitionBy)
+			}
+			if n < len(def.Stages)-1 {
+				outputs, err := outputProcessors(pd, processors[n+1], ids[n+1])
+				if err != nil {
+					def.Close()
+					return nil, fmt.Errorf("stage %d processor %d (%v): %w", n+1, i+1, pd.Type, err)
+				}
+				dp.Outputs(outputs...)
+			}
+			stages[n].Add(dp)
+		}
+	}
+
+	layout, err := ratchet.NewPipelineLayout(stages...)
+	if err != nil {
+		def.Close()
+		return nil, util.ConfigInvalidError(err)
+	}
+	p := ratchet.NewBranchingPipeline(layout)
+	if def.Name != "" {
+		p.Name = def.Name
+	}
+	p.BufferLength = def.BufferLength
+	p.Unbuffered = def.Unbuffered
+	p.DryRun = def.DryRun
+	p.StageTimeout = time.Duration(def.StageTimeout)
+	p.MaxConcurrency = def.MaxConcurrency
+	if def.CheckpointFile != "" {
+		store, _ := def.CheckpointStore()
+		p.RunStore = ratchet.NewCheckpointRunStore(store)
+	}
+	return p, nil
+}
+
+func (def *PipelineDefinition) buildProcessor(pd ProcessorDefinition) (ratchet.DataProcessor, error) {
+	f, err := factory(pd.Type)
+	if err != nil {
+		return nil, err
+	}
+	opts := pd.Options
+	if pd.Concurrency > 0 {
+		opts = Options{}
+		for k, v := range pd.Options {
+			opts[k] = v
+		}
+		opts["concurrency"] = pd.Concurrency
+	}
+	if opts == nil {
+		opts = Options{}
+	}
+	return f(def, opts)
+}
+
+func outputProcessors(pd ProcessorDefinition, next []ratchet.DataProcessor, ids map[string]ratchet.DataProcessor) ([]ratchet.DataProcessor, error) {
+	if len(pd.Outputs) == 0 {
+		return next, nil
+	}
+	outputs := make([]ratchet.DataProcessor, len(pd.Outputs))
+	for i, id := range pd.Outputs {
+		p, ok := ids[id]
+		if !ok {
+			return nil, util.ConfigErrorf("no processor with id %q in the next stage", id)
+		}
+		outputs[i] = p
+	}
+	return outputs, nil
+}
+
+// DB returns the database with the given name from Databases, opening it
+// the first time it's used.
+func (def *PipelineDefinition) DB(name string) (*sqlx.DB, error) {
+	if db, ok := def.dbs[name]; ok {
+		return db, nil
+	}
+	dd, ok := def.Databases[name]
+	if !ok {
+		return nil, util.ConfigErrorf("unknown database %q", name)
+	}
+	db, err := sqlx.Open(dd.Driver, os.ExpandEnv(dd.DSN))
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	if def.dbs == nil {
+		def.dbs = make(map[string]*sqlx.DB)
+	}
+	def.dbs[name] = db
+	def.AddCloser(db)
+	return db, nil
+}
+
+// CheckpointStore returns the store for CheckpointFile, shared by every
+// processor in the Pipeline.
+func (def *PipelineDefinition) CheckpointStore() (ratchet.CheckpointStore, error) {
+	if def.CheckpointFile == "" {
+		return nil, util.ConfigErrorf("checkpoint_file must be set")
+	}
+	if def.checkpoints == nil {
+		def.checkpoints = ratchet.NewFileCheckpointStore(os.ExpandEnv(def.CheckpointFile))
+	}
+	return def.checkpoints, nil
+}
+
+// AddCloser registers a resource opened by a Factory (such as a file) to
+// be closed by Close.
+func (def *PipelineDefinition) AddCloser(c io.Closer) {
+	def.closers = append(def.closers, c)
+}
+
+// Close closes the resources opened while building the Pipeline, returning
+// the first error.
+func (def *PipelineDefinition) Close() error {
+	var firstErr error
+	for _, c := range def.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	def.closers = nil
+	def.dbs = nil
+	return firstErr
+}
@@ -0,0 +1,118 @@
+package config_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fefelovgroup/ratchet/config"
+
+	_ "modernc.org/sqlite"
+)
+
+func ExampleParse() {
+	def, err := config.Parse([]byte(`
+name: errors
+stages:
+  - - type: file_reader
+      options: {path: app.log}
+  - - id: errors
+      type: regexp_matcher
+      options: {pattern: ERROR}
+      outputs: [stdout]
+    - id: warnings
+      type: regexp_matcher
+      options: {pattern: WARN}
+      outputs: [stdout]
+  - - id: stdout
+      type: io_writer
+      options: {add_newline: true}
+`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	p, err := def.Build()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer def.Close()
+	fmt.Print(p.Draw())
+
+	// Output:
+	// digraph "errors" {
+	// 	label="errors";
+	// 	rankdir=LR;
+	// 	node [shape=box];
+	// 	subgraph cluster_1 {
+	// 		label="stage 1";
+	// 		s1_0 [label="FileReader"];
+	// 	}
+	// 	subgraph cluster_2 {
+	// 		label="stage 2";
+	// 		s2_0 [label="RegexpMatcher"];
+	// 		s2_1 [label="RegexpMatcher"];
+	// 	}
+	// 	subgraph cluster_3 {
+	// 		label="stage 3";
+	// 		s3_0 [label="IoWriter"];
+	// 	}
+	// 	s1_0 -> s2_0;
+	// 	s1_0 -> s2_1;
+	// 	s2_0 -> s3_0;
+	// 	s2_1 -> s3_0;
+	// }
+}
+
+func ExampleLoad() {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "base.yaml"), []byte(`
+name: copy-users
+databases:
+  target: {driver: sqlite, dsn: "${TARGET_DSN:-users.db}"}
+stages:
+  - - type: io_reader
+  - - id: load
+      type: sqlite_writer
+      options: {database: target, table: users}
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "prod.yaml"), []byte(`
+databases:
+  target: {dsn: "${file:`+filepath.Join(dir, "target_dsn")+`}"}
+processors:
+  load: {options: {batch_size: 500}}
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "target_dsn"), []byte("/data/users.db\n"), 0600)
+
+	def, err := config.Load(filepath.Join(dir, "base.yaml"), filepath.Join(dir, "prod.yaml"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(def.Databases["target"].DSN)
+	fmt.Println(def.Stages[1][0].Options["batch_size"])
+	rendered, _ := def.Render()
+	fmt.Print(string(rendered))
+	fmt.Println(def.Validate())
+
+	// Output:
+	// /data/users.db
+	// 500
+	// databases:
+	//     target:
+	//         driver: sqlite
+	//         dsn: <redacted>
+	// name: copy-users
+	// stages:
+	//     - - type: io_reader
+	//     - - id: load
+	//         options:
+	//             batch_size: 500
+	//             database: target
+	//             table: users
+	//         type: sqlite_writer
+	// <nil>
+}
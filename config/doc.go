@@ -0,0 +1,42 @@
+// Package config builds ratchet Pipelines from YAML or JSON documents, so
+// simple ETL jobs can be defined without recompiling Go code.
+//
+// A definition lists the Pipeline's stages, each holding one or more
+// processors. A processor's type is looked up in a registry of Factories
+// (see Register), and its options are passed on to the Factory:
+//
+//	name: copy-users
+//	databases:
+//	  source: {driver: mysql, dsn: "${SOURCE_DSN}"}
+//	  target: {driver: sqlite, dsn: users.db}
+//	stages:
+//	  - - type: sql_reader
+//	      options: {database: source, query: "SELECT * FROM users"}
+//	  - - type: sqlite_writer
+//	      options: {database: target, table: users}
+//
+// Processors without outputs send their data to every processor in the
+// next stage. For branching layouts, give processors an id and list the
+// ids of their outputs instead. Database drivers are not imported by this
+// package, so the program loading the definition must import them.
+//
+// Variables in strings are interpolated when a definition is parsed:
+// ${NAME} is the environment variable NAME, ${NAME:-default} falls back to
+// default if it isn't set, ${NAME:?message} fails with message if it
+// isn't set, and ${file:path} is the contents of a file, such as a secret
+// mounted by Docker or Kubernetes.
+//
+// Load merges overlays over a base definition, so the settings that differ
+// between environments can be kept in files of their own (e.g. base.yaml
+// and prod.yaml). Mappings are merged key by key, other values (including
+// lists) are replaced, and null removes a key. Processors are overridden by
+// their id, in a processors mapping:
+//
+//	databases:
+//	  target: {driver: postgres, dsn: "${file:/run/secrets/target_dsn}"}
+//	processors:
+//	  load: {concurrency: 8, options: {batch_size: 5000}}
+//
+// PipelineDefinition.Render returns the effective definition for review,
+// and PipelineDefinition.Validate checks it without running anything.
+package config
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/util"
+	"gopkg.in/yaml.v3"
+)
+
+// parseDocument parses a YAML or JSON document. YAML is a superset of
+// JSON, so both are read with the YAML parser.
+func parseDocument(b []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return v, nil
+}
+
+// readDocument reads and parses the YAML or JSON file at path.
+func readDocument(path string) (interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseDocument(b)
+}
+
+// newDefinition interpolates the variables in doc, then converts it to a
+// PipelineDefinition, going through JSON so that only json tags are needed.
+func newDefinition(doc interface{}) (*PipelineDefinition, error) {
+	v, err := interpolate(doc, false)
+	if err != nil {
+		return nil, err
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	def := &PipelineDefinition{}
+	if err := json.Unmarshal(j, def); err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	def.document = doc
+	return def, nil
+}
+
+// applyOverlay merges an overlay document over base: mappings are merged
+// key by key, anything else in the overlay (including lists, such as
+// stages) replaces what's in base, and a null removes the key. The
+// overlay's "processors" mapping is merged over the processors in base's
+// stages with the same id instead, so an environment can change a
+// processor's options without repeating the stages:
+//
+//	processors:
+//	  load: {concurrency: 8, options: {batch_size: 5000}}
+func applyOverlay(base, overlay interface{}) (interface{}, error) {
+	o, ok := overlay.(map[string]interface{})
+	if !ok {
+		if overlay == nil {
+			return base, nil
+		}
+		return nil, util.ConfigErrorf("an overlay must be a mapping")
+	}
+	rest := make(map[string]interface{}, len(o))
+	for k, v := range o {
+		if k != "processors" {
+			rest[k] = v
+		}
+	}
+	merged := merge(base, rest)
+	processors, ok := o["processors"].(map[string]interface{})
+	if !ok && o["processors"] != nil {
+		return nil, util.ConfigErrorf("processors must be a mapping of processor ids")
+	}
+	for id, p := range processors {
+		if !overrideProcessor(merged, id, p) {
+			return nil, util.ConfigErrorf("no processor with id %q to override", id)
+		}
+	}
+	return merged, nil
+}
+
+func merge(base, overlay interface{}) interface{} {
+	b, ok := base.(map[string]interface{})
+	o, ok2 := overlay.(map[string]interface{})
+	if !ok || !ok2 {
+		return overlay
+	}
+	merged := make(map[string]interface{}, len(b)+len(o))
+	for k, v := range b {
+		merged[k] = v
+	}
+	for k, v := range o {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = merge(b[k], v)
+	}
+	return merged
+}
+
+// overrideProcessor merges p over the processors with the given id in
+// doc's stages, and returns false if there are none.
+func overrideProcessor(doc interface{}, id string, p interface{}) bool {
+	d, _ := doc.(map[string]interface{})
+	stages, _ := d["stages"].([]interface{})
+	found := false
+	for _, stage := range stages {
+		processors, _ := stage.([]interface{})
+		for i, pd := range processors {
+			if m, ok := pd.(map[string]interface{}); ok && m["id"] == id {
+				processors[i] = merge(m, p)
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+var variable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// interpolate returns a copy of v with the variables in its strings
+// replaced:
+//
+//	${NAME}          the environment variable NAME, empty if it isn't set
+//	${NAME:-default} NAME, or default if it isn't set or is empty
+//	${NAME:?message} NAME, which must be set, or the error message
+//	${file:path}     the contents of the file at path (without the final
+//	                 newline), e.g. a secret mounted by Docker or Kubernetes
+//
+// When redact is set, files aren't read, and are replaced with
+// "<redacted>" instead.
+func interpolate(v interface{}, redact bool) (interface{}, error) {
+	switch vv := v.(type) {
+	case string:
+		return expand(vv, redact)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, e := range vv {
+			i, err := interpolate(e, redact)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = i
+		}
+		return m, nil
+	case []interface{}:
+		l := make([]interface{}, len(vv))
+		for k, e := range vv {
+			i, err := interpolate(e, redact)
+			if err != nil {
+				return nil, err
+			}
+			l[k] = i
+		}
+		return l, nil
+	}
+	return v, nil
+}
+
+func expand(s string, redact bool) (string, error) {
+	var firstErr error
+	expanded := variable.ReplaceAllStringFunc(s, func(m string) string {
+		value, err := lookupVariable(m[2:len(m)-1], redact)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return value
+	})
+	return expanded, firstErr
+}
+
+func lookupVariable(name string, redact bool) (string, error) {
+	if strings.HasPrefix(name, "file:") {
+		if redact {
+			return "<redacted>", nil
+		}
+		b, err := ioutil.ReadFile(strings.TrimPrefix(name, "file:"))
+		if err != nil {
+			return "", util.ConfigErrorf("reading secret: %v", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	if i := strings.Index(name, ":-"); i >= 0 {
+		if value := os.Getenv(name[:i]); value != "" {
+			return value, nil
+		}
+		return name[i+2:], nil
+	}
+	if i := strings.Index(name, ":?"); i >= 0 {
+		if value := os.Getenv(name[:i]); value != "" {
+			return value, nil
+		}
+		message := name[i+2:]
+		if message == "" {
+			message = "must be set"
+		}
+		return "", util.ConfigErrorf("%v: %v", name[:i], message)
+	}
+	return os.Getenv(name), nil
+}
+
+// Render returns the effective definition as YAML, after merging overlays
+// and interpolating variables, for review. Secrets read from files are
+// redacted.
+func (def *PipelineDefinition) Render() ([]byte, error) {
+	if def.document == nil {
+		return nil, util.ConfigErrorf("only definitions from Parse or Load can be rendered")
+	}
+	v, err := interpolate(def.document, true)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(v)
+}
+
+// Validate checks the definition by building its Pipeline, so that unknown
+// processor types, invalid options and wiring errors are reported, then
+// closes the resources opened for it. Files aren't created or read (inputs
+// only have to exist), and databases aren't connected to.
+func (def *PipelineDefinition) Validate() error {
+	def.validating = true
+	defer func() { def.validating = false }()
+	_, err := def.Build()
+	def.Close()
+	return err
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/plugin"
+)
+
+func init() {
+	Register("plugin", newPlugin)
+}
+
+// RegisterPlugins registers a processor type for every processor in the
+// plugin Registry, named after the processor. The processor's options
+// are passed on to the plugin as they are.
+func RegisterPlugins(r *plugin.Registry) {
+	for _, name := range r.Names() {
+		name := name
+		Register(name, func(def *PipelineDefinition, opts Options) (ratchet.DataProcessor, error) {
+			p, err := r.Open(name, map[string]interface{}(opts))
+			if err != nil {
+				return nil, err
+			}
+			def.AddCloser(p)
+			return p, nil
+		})
+	}
+}
+
+// newPlugin loads a processor from a plugin binary given by path, for
+// plugins that aren't in a Registry.
+func newPlugin(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path      string                 `json:"path"`
+		Processor string                 `json:"processor"`
+		Options   map[string]interface{} `json:"options"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	p := plugin.NewProcessor(opts.Path, opts.Processor, opts.Options)
+	if err := p.Start(); err != nil {
+		return nil, err
+	}
+	def.AddCloser(p)
+	return p, nil
+}
@@ -0,0 +1,1804 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2/checkpoints"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// The built-in processor types. Paths of "-" (or no path) read from stdin
+// or write to stdout.
+func init() {
+	Register("file_reader", newFileReader)
+	Register("io_reader", newIoReader)
+	Register("json_lines_reader", newJSONLinesReader)
+	Register("io_writer", newIoWriter)
+	Register("csv_writer", newCSVWriter)
+	Register("json_lines_writer", newJSONLinesWriter)
+	Register("arrow_reader", newArrowReader)
+	Register("arrow_writer", newArrowWriter)
+	Register("passthrough", newPassthrough)
+	Register("regexp_matcher", newRegexpMatcher)
+	Register("filter", newFilter)
+	Register("field_mapper", newFieldMapper)
+	Register("type_caster", newTypeCaster)
+	Register("jq", newJQTransformer)
+	Register("script", newScriptProcessor)
+	Register("wasm", newWASMProcessor)
+	Register("template", newTemplateProcessor)
+	Register("anonymizer", newAnonymizer)
+	Register("flatten", newFlatten)
+	Register("unflatten", newUnflatten)
+	Register("debezium_decoder", newDebeziumDecoder)
+	Register("cloudevents_wrapper", newCloudEventsWrapper)
+	Register("cloudevents_unwrapper", newCloudEventsUnwrapper)
+	Register("cloudevents_http_writer", newCloudEventsHTTPWriter)
+	Register("lookup", newLookupEnricher)
+	Register("field_injector", newFieldInjector)
+	Register("defaults", newDefaults)
+	Register("key_generator", newKeyGenerator)
+	Register("exec", newExecProcessor)
+	Register("stdin_reader", newStdinReader)
+	Register("stdout_writer", newStdoutWriter)
+	Register("schema_validator", newSchemaValidator)
+	Register("sql_reader", newSQLReader)
+	Register("partitioned_sql_reader", newPartitionedSQLReader)
+	Register("sql_executor", newSQLExecutor)
+	Register("sql_exec", newSQLExecProcessor)
+	Register("sqlite_transformer", newSQLiteTransformer)
+	Register("mysql_binlog_reader", newMySQLBinlogReader)
+	Register("postgresql_replication_reader", newPostgreSQLReplicationReader)
+	Register("kinesis_reader", newKinesisReader)
+	Register("firehose_writer", newFirehoseWriter)
+	Register("eventhubs_reader", newEventHubsReader)
+	Register("eventhubs_writer", newEventHubsWriter)
+	Register("mqtt_reader", newMQTTReader)
+	Register("redis_stream_reader", newRedisStreamReader)
+	Register("mysql_writer", newMySQLWriter)
+	Register("postgresql_writer", newPostgreSQLWriter)
+	Register("sqlite_writer", newSQLiteWriter)
+	Register("mssql_writer", newMSSQLWriter)
+	Register("routing_sql_writer", newRoutingSQLWriter)
+	Register("sync_writer", newSyncWriter)
+	Register("scd2_writer", newSCD2Writer)
+}
+
+func (def *PipelineDefinition) openInput(path string) (io.Reader, error) {
+	if path == "" || path == "-" {
+		return os.Stdin, nil
+	}
+	if def.validating {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		return strings.NewReader(""), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	def.AddCloser(f)
+	return f, nil
+}
+
+func (def *PipelineDefinition) openOutput(path string) (io.Writer, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+	if def.validating {
+		return ioutil.Discard, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	def.AddCloser(f)
+	return f, nil
+}
+
+func newFileReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path string `json:"path"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Path == "" {
+		return nil, util.ConfigErrorf("path is required")
+	}
+	return processors.NewFileReader(opts.Path), nil
+}
+
+func newIoReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Path       string `json:"path"`
+		LineByLine bool   `json:"line_by_line"`
+		BufferSize int    `json:"buffer_size"`
+		Gzipped    bool   `json:"gzipped"`
+		Framing    string `json:"framing"`
+	}{LineByLine: true, BufferSize: 1024}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	r, err := def.openInput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewIoReader(r)
+	p.LineByLine = opts.LineByLine
+	p.BufferSize = opts.BufferSize
+	p.Gzipped = opts.Gzipped
+	if p.Codec, err = framingCodec(opts.Framing); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// framingCodec returns the FramingCodec for a framing option: lines,
+// json_stream or length_prefixed (or "" for none).
+func framingCodec(framing string) (processors.FramingCodec, error) {
+	switch framing {
+	case "":
+		return nil, nil
+	case "lines":
+		return processors.LinesCodec{}, nil
+	case "json_stream":
+		return processors.JSONStreamCodec{}, nil
+	case "length_prefixed":
+		return processors.LengthPrefixedCodec{}, nil
+	}
+	return nil, util.ConfigErrorf("unknown framing %q", framing)
+}
+
+func newJSONLinesReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Path      string `json:"path"`
+		BatchSize int    `json:"batch_size"`
+		Gzipped   bool   `json:"gzipped"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	r, err := def.openInput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewJSONLinesReader(r)
+	p.BatchSize = opts.BatchSize
+	p.Gzipped = opts.Gzipped
+	return p, nil
+}
+
+func newIoWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path       string `json:"path"`
+		AddNewline bool   `json:"add_newline"`
+		Framing    string `json:"framing"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	w, err := def.openOutput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewIoWriter(w)
+	p.AddNewline = opts.AddNewline
+	if p.Codec, err = framingCodec(opts.Framing); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func newCSVWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path string `json:"path"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	w, err := def.openOutput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	return processors.NewCSVWriter(w), nil
+}
+
+func newJSONLinesWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path string `json:"path"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	w, err := def.openOutput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	return processors.NewJSONLinesWriter(w), nil
+}
+
+func newArrowReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path          string `json:"path"`
+		ArrowPayloads bool   `json:"arrow_payloads"` // Sends record batches as Arrow rather than JSON
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	r, err := def.openInput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewArrowReader(r)
+	p.ArrowPayloads = opts.ArrowPayloads
+	return p, nil
+}
+
+func newArrowWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Path        string `json:"path"`
+		Stream      bool   `json:"stream"`
+		Compression string `json:"compression"` // lz4 or zstd
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	switch opts.Compression {
+	case "", "lz4", "zstd":
+	default:
+		return nil, util.ConfigErrorf("unknown compression %q", opts.Compression)
+	}
+	w, err := def.openOutput(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewArrowWriter(w)
+	p.Stream = opts.Stream
+	p.Compression = opts.Compression
+	return p, nil
+}
+
+func newPassthrough(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	if err := o.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return processors.NewPassthrough(), nil
+}
+
+func newRegexpMatcher(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Pattern string `json:"pattern"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	return processors.NewRegexpMatcher(opts.Pattern), nil
+}
+
+func newFilter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Condition string `json:"condition"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Condition == "" {
+		return nil, util.ConfigErrorf("condition is required")
+	}
+	f, err := processors.NewFilter(opts.Condition)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func newFieldMapper(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Keep   []string          `json:"keep"`
+		Rename map[string]string `json:"rename"`
+		Drop   []string          `json:"drop"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	m := processors.NewFieldMapper().Keep(opts.Keep...).Drop(opts.Drop...)
+	for from, to := range opts.Rename {
+		m.Rename(from, to)
+	}
+	return m, nil
+}
+
+func newTypeCaster(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Fields []struct {
+			Field        string `json:"field"`
+			Type         string `json:"type"`
+			Layout       string `json:"layout"`
+			OutputLayout string `json:"output_layout"`
+			OnError      string `json:"on_error"`
+		} `json:"fields"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	c := processors.NewTypeCaster()
+	for _, f := range opts.Fields {
+		if f.Field == "" || f.Type == "" {
+			return nil, util.ConfigErrorf("fields need a field and a type")
+		}
+		c.Casts = append(c.Casts, processors.FieldCast{
+			Field:        f.Field,
+			Type:         processors.CastType(f.Type),
+			Layout:       f.Layout,
+			OutputLayout: f.OutputLayout,
+			OnError:      processors.CastErrorPolicy(f.OnError),
+		})
+	}
+	return c, nil
+}
+
+func newJQTransformer(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Program     string                 `json:"program"`
+		ProgramFile string                 `json:"program_file"`
+		Variables   map[string]interface{} `json:"variables"`
+		Collect     bool                   `json:"collect"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.ProgramFile != "" {
+		b, err := ioutil.ReadFile(opts.ProgramFile)
+		if err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+		opts.Program = string(b)
+	}
+	if opts.Program == "" {
+		return nil, util.ConfigErrorf("program or program_file is required")
+	}
+	t, err := processors.NewJQTransformer(opts.Program, opts.Variables)
+	if err != nil {
+		return nil, err
+	}
+	t.Collect = opts.Collect
+	return t, nil
+}
+
+func newSQLiteTransformer(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Driver     string `json:"driver"`
+		Table      string `json:"table"`
+		Query      string `json:"query"`
+		QueryFile  string `json:"query_file"`
+		PerPayload bool   `json:"per_payload"`
+		BatchSize  int    `json:"batch_size"`
+	}{Driver: "sqlite"}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.QueryFile != "" {
+		b, err := ioutil.ReadFile(opts.QueryFile)
+		if err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+		opts.Query = string(b)
+	}
+	if opts.Table == "" || opts.Query == "" {
+		return nil, util.ConfigErrorf("table, and query or query_file, are required")
+	}
+	t, err := processors.NewSQLiteTransformer(opts.Driver, opts.Table, opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	def.AddCloser(t)
+	t.PerPayload = opts.PerPayload
+	t.BatchSize = opts.BatchSize
+	return t, nil
+}
+
+func newScriptProcessor(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Script   string `json:"script"`
+		File     string `json:"file"`
+		Function string `json:"function"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	var p *processors.ScriptProcessor
+	var err error
+	switch {
+	case opts.File != "":
+		p, err = processors.NewScriptProcessorFromFile(opts.File)
+	case opts.Script != "":
+		p, err = processors.NewScriptProcessor(opts.Script)
+	default:
+		return nil, util.ConfigErrorf("script or file is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.Function != "" {
+		if err := p.SetFunction(opts.Function); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func newWASMProcessor(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		File     string   `json:"file"`
+		Function string   `json:"function"`
+		Timeout  Duration `json:"timeout"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.File == "" {
+		return nil, util.ConfigErrorf("file is required")
+	}
+	p, err := processors.NewWASMProcessorFromFile(opts.File)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Function != "" {
+		p.FunctionName = opts.Function
+	}
+	p.Timeout = time.Duration(opts.Timeout)
+	return p, nil
+}
+
+func newTemplateProcessor(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Template string `json:"template"`
+		File     string `json:"file"`
+		Field    string `json:"field"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.File != "" {
+		b, err := ioutil.ReadFile(opts.File)
+		if err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+		opts.Template = string(b)
+	}
+	if opts.Template == "" {
+		return nil, util.ConfigErrorf("template or file is required")
+	}
+	p, err := processors.NewTemplateProcessor(opts.Template, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.Field = opts.Field
+	return p, nil
+}
+
+// newAnonymizer takes a list of fields with a strategy for each: hash
+// (with salt), hmac or fake (with key), partial (with keep_first,
+// keep_last and mask_char) or null. Salts and keys are expanded with
+// os.ExpandEnv, so they can be kept out of the config.
+func newAnonymizer(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Fields []struct {
+			Field     string `json:"field"`
+			Strategy  string `json:"strategy"`
+			Salt      string `json:"salt"`
+			Key       string `json:"key"`
+			KeepFirst int    `json:"keep_first"`
+			KeepLast  int    `json:"keep_last"`
+			MaskChar  string `json:"mask_char"`
+		} `json:"fields"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	a := processors.NewAnonymizer()
+	for _, f := range opts.Fields {
+		if f.Field == "" {
+			return nil, util.ConfigErrorf("fields need a field")
+		}
+		var rule processors.AnonymizeRule
+		switch f.Strategy {
+		case "hash":
+			rule = processors.MaskHash(f.Field, os.ExpandEnv(f.Salt))
+		case "hmac", "fake":
+			key := os.ExpandEnv(f.Key)
+			if key == "" {
+				return nil, util.ConfigErrorf("%v: key is required for %v", f.Field, f.Strategy)
+			}
+			if f.Strategy == "hmac" {
+				rule = processors.MaskHMAC(f.Field, []byte(key))
+			} else {
+				rule = processors.MaskFake(f.Field, []byte(key))
+			}
+		case "partial":
+			maskChar := '*'
+			if f.MaskChar != "" {
+				maskChar = []rune(f.MaskChar)[0]
+			}
+			rule = processors.MaskPartial(f.Field, f.KeepFirst, f.KeepLast, maskChar)
+		case "null":
+			rule = processors.MaskNull(f.Field)
+		default:
+			return nil, util.ConfigErrorf("%v: unknown strategy %q", f.Field, f.Strategy)
+		}
+		a.Rules = append(a.Rules, rule)
+	}
+	return a, nil
+}
+
+func newFlatten(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Separator string `json:"separator"`
+		Arrays    string `json:"arrays"` // index, explode or json
+		MaxDepth  int    `json:"max_depth"`
+	}{Separator: "_"}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	f := processors.NewFlatten()
+	f.Separator = opts.Separator
+	f.MaxDepth = opts.MaxDepth
+	switch opts.Arrays {
+	case "", "index":
+		f.Arrays = processors.FlattenArrayIndex
+	case "explode":
+		f.Arrays = processors.FlattenArrayExplode
+	case "json":
+		f.Arrays = processors.FlattenArrayJSON
+	default:
+		return nil, util.ConfigErrorf("unknown arrays strategy %q", opts.Arrays)
+	}
+	return f, nil
+}
+
+func newUnflatten(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Separator string   `json:"separator"`
+		Prefixes  []string `json:"prefixes"`
+		Arrays    bool     `json:"arrays"`
+	}{Separator: "_"}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	u := processors.NewUnflatten()
+	u.Separator = opts.Separator
+	u.Prefixes = opts.Prefixes
+	u.Arrays = opts.Arrays
+	return u, nil
+}
+
+func newDebeziumDecoder(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		OpField        string   `json:"op_field"`
+		TimestampField string   `json:"timestamp_field"`
+		TableField     string   `json:"table_field"`
+		PrimaryKeys    []string `json:"primary_keys"`
+	}{OpField: "op"}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	p := processors.NewDebeziumDecoder()
+	p.OpField = opts.OpField
+	p.TimestampField = opts.TimestampField
+	p.TableField = opts.TableField
+	p.PrimaryKeys = opts.PrimaryKeys
+	return p, nil
+}
+
+func newCloudEventsWrapper(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Source       string            `json:"source"`
+		Type         string            `json:"type"`
+		TypeField    string            `json:"type_field"`
+		IDField      string            `json:"id_field"`
+		TimeField    string            `json:"time_field"`
+		SubjectField string            `json:"subject_field"`
+		DataSchema   string            `json:"dataschema"`
+		Extensions   map[string]string `json:"extensions"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Source == "" || (opts.Type == "" && opts.TypeField == "") {
+		return nil, util.ConfigErrorf("source, and type or type_field, are required")
+	}
+	w := processors.NewCloudEventsWrapper(opts.Source, opts.Type)
+	w.TypeField = opts.TypeField
+	w.IDField = opts.IDField
+	w.TimeField = opts.TimeField
+	w.SubjectField = opts.SubjectField
+	w.DataSchema = opts.DataSchema
+	w.Extensions = opts.Extensions
+	return w, nil
+}
+
+func newCloudEventsUnwrapper(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		AttributesField string `json:"attributes_field"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	u := processors.NewCloudEventsUnwrapper()
+	u.AttributesField = opts.AttributesField
+	return u, nil
+}
+
+func newCloudEventsHTTPWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		URL         string            `json:"url"`
+		Mode        string            `json:"mode"` // structured, binary or batch
+		Headers     map[string]string `json:"headers"`
+		Timeout     Duration          `json:"timeout"`
+		MaxAttempts int               `json:"max_attempts"`
+		// BatchSize and AdaptiveBatchSize limit the events per request in
+		// the batch mode.
+		BatchSize         int                   `json:"batch_size"`
+		AdaptiveBatchSize *adaptiveBatchOptions `json:"adaptive_batch_size"`
+	}{Mode: processors.CloudEventsStructured, MaxAttempts: processors.DefaultRetryPolicy.MaxAttempts}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.URL == "" {
+		return nil, util.ConfigErrorf("url is required")
+	}
+	switch opts.Mode {
+	case processors.CloudEventsStructured, processors.CloudEventsBinary, processors.CloudEventsBatch:
+	default:
+		return nil, util.ConfigErrorf("unknown mode %q", opts.Mode)
+	}
+	w := processors.NewCloudEventsHTTPWriter(os.ExpandEnv(opts.URL))
+	w.Mode = opts.Mode
+	for k, v := range opts.Headers {
+		w.Header.Set(k, os.ExpandEnv(v))
+	}
+	w.Client.Timeout = time.Duration(opts.Timeout)
+	w.Retry.MaxAttempts = opts.MaxAttempts
+	w.BatchSize = opts.BatchSize
+	w.AdaptiveBatchSize = opts.AdaptiveBatchSize.adaptive(opts.BatchSize)
+	return w, nil
+}
+
+// newLookupEnricher looks keys up in a SQL table (with database and
+// table), an HTTP endpoint (with url) or Redis (with redis_addr).
+func newLookupEnricher(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		KeyField  string                 `json:"key_field"`
+		Prefix    string                 `json:"prefix"`
+		OnMiss    string                 `json:"on_miss"` // keep, drop or fail
+		Defaults  map[string]interface{} `json:"defaults"`
+		CacheSize int                    `json:"cache_size"`
+		BatchSize int                    `json:"batch_size"`
+
+		Database  string   `json:"database"`
+		Table     string   `json:"table"`
+		KeyColumn string   `json:"key_column"`
+		Columns   []string `json:"columns"`
+
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+
+		RedisAddr string `json:"redis_addr"`
+		KeyPrefix string `json:"key_prefix"`
+		JSON      bool   `json:"json"`
+	}{CacheSize: 10000, BatchSize: 500}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.KeyField == "" {
+		return nil, util.ConfigErrorf("key_field is required")
+	}
+
+	var source processors.LookupSource
+	switch {
+	case opts.Table != "":
+		db, err := def.DB(opts.Database)
+		if err != nil {
+			return nil, err
+		}
+		if opts.KeyColumn == "" {
+			opts.KeyColumn = opts.KeyField
+		}
+		source = processors.NewSQLLookup(db, opts.Table, opts.KeyColumn, opts.Columns...)
+	case opts.URL != "":
+		l := processors.NewHTTPLookup(opts.URL)
+		for k, v := range opts.Headers {
+			l.Header.Set(k, os.ExpandEnv(v))
+		}
+		source = l
+	case opts.RedisAddr != "":
+		client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{os.ExpandEnv(opts.RedisAddr)}})
+		def.AddCloser(client)
+		l := processors.NewRedisLookup(client, opts.KeyPrefix)
+		l.JSON = opts.JSON
+		source = l
+	default:
+		return nil, util.ConfigErrorf("table, url or redis_addr is required")
+	}
+
+	e := processors.NewLookupEnricher(source, opts.KeyField)
+	e.Prefix = opts.Prefix
+	e.Defaults = opts.Defaults
+	e.CacheSize = opts.CacheSize
+	e.BatchSize = opts.BatchSize
+	switch opts.OnMiss {
+	case "", "keep":
+		e.OnMiss = processors.LookupKeep
+	case "drop":
+		e.OnMiss = processors.LookupDrop
+	case "fail":
+		e.OnMiss = processors.LookupFail
+	default:
+		return nil, util.ConfigErrorf("unknown on_miss %q", opts.OnMiss)
+	}
+	return e, nil
+}
+
+// newFieldInjector adds static fields, whose string values are expanded
+// with os.ExpandEnv, and optionally run ID, timestamp and source fields.
+func newFieldInjector(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Fields       map[string]interface{} `json:"fields"`
+		RunID        string                 `json:"run_id"`
+		Timestamp    string                 `json:"timestamp"`
+		Source       string                 `json:"source"`
+		KeepExisting bool                   `json:"keep_existing"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	f := processors.NewFieldInjector()
+	names := make([]string, 0, len(opts.Fields))
+	for name := range opts.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := opts.Fields[name]
+		if s, ok := v.(string); ok {
+			v = os.ExpandEnv(s)
+		}
+		f.Set(name, v)
+	}
+	if opts.RunID != "" {
+		f.RunID(opts.RunID)
+	}
+	if opts.Timestamp != "" {
+		f.Timestamp(opts.Timestamp)
+	}
+	if opts.Source != "" {
+		f.Source(opts.Source)
+	}
+	f.KeepExisting = opts.KeepExisting
+	return f, nil
+}
+
+func newDefaults(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Defaults  map[string]interface{} `json:"defaults"`
+		IfMissing map[string]interface{} `json:"if_missing"`
+		IfNull    map[string]interface{} `json:"if_null"`
+		Required  []string               `json:"required"`
+		Drop      bool                   `json:"drop"` // Drop invalid records instead of halting
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	d := processors.NewDefaults().Require(opts.Required...)
+	for _, rules := range []struct {
+		values        map[string]interface{}
+		missing, null bool
+	}{{opts.Defaults, true, true}, {opts.IfMissing, true, false}, {opts.IfNull, false, true}} {
+		fields := make([]string, 0, len(rules.values))
+		for field := range rules.values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			d.Rules = append(d.Rules, processors.DefaultRule{
+				Field:     field,
+				Value:     rules.values[field],
+				IfMissing: rules.missing,
+				IfNull:    rules.null,
+			})
+		}
+	}
+	if opts.Drop {
+		d.Policy = processors.ValidationDrop
+	}
+	return d, nil
+}
+
+func newKeyGenerator(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Field       string   `json:"field"`
+		UUID        bool     `json:"uuid"`
+		Start       int64    `json:"start"`
+		PartitionBy []string `json:"partition_by"`
+	}{Start: 1}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Field == "" {
+		return nil, util.ConfigErrorf("field is required")
+	}
+	if opts.UUID {
+		return processors.NewUUIDGenerator(opts.Field), nil
+	}
+	g := processors.NewSequenceGenerator(opts.Field)
+	g.Start = opts.Start
+	g.PartitionBy = opts.PartitionBy
+	return g, nil
+}
+
+func newExecProcessor(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Command   string   `json:"command"`
+		Args      []string `json:"args"`
+		Env       []string `json:"env"`
+		Dir       string   `json:"dir"`
+		Format    string   `json:"format"` // json_lines, json or raw
+		Stream    bool     `json:"stream"`
+		Timeout   Duration `json:"timeout"`
+		ExitCodes []int    `json:"exit_codes"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Command == "" {
+		return nil, util.ConfigErrorf("command is required")
+	}
+	p := processors.NewExecProcessor(opts.Command, opts.Args...)
+	p.Env = opts.Env
+	p.Dir = opts.Dir
+	p.Stream = opts.Stream
+	p.Timeout = time.Duration(opts.Timeout)
+	p.ExitCodes = opts.ExitCodes
+	switch opts.Format {
+	case "", "json_lines":
+		p.Format = processors.ExecJSONLines
+	case "json":
+		p.Format = processors.ExecJSON
+	case "raw":
+		p.Format = processors.ExecRaw
+	default:
+		return nil, util.ConfigErrorf("unknown format %q", opts.Format)
+	}
+	return p, nil
+}
+
+func stdioFraming(framing string) (processors.StdioFraming, error) {
+	switch framing {
+	case "", "ndjson":
+		return processors.FrameNDJSON, nil
+	case "lines":
+		return processors.FrameLines, nil
+	case "whole":
+		return processors.FrameWhole, nil
+	}
+	return 0, util.ConfigErrorf("unknown framing %q", framing)
+}
+
+func newStdinReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Framing   string `json:"framing"` // ndjson, lines or whole
+		BatchSize int    `json:"batch_size"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	r := processors.NewStdinReader()
+	var err error
+	if r.Framing, err = stdioFraming(opts.Framing); err != nil {
+		return nil, err
+	}
+	r.BatchSize = opts.BatchSize
+	return r, nil
+}
+
+func newStdoutWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Framing string `json:"framing"` // ndjson, lines or whole
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	w := processors.NewStdoutWriter()
+	var err error
+	if w.Framing, err = stdioFraming(opts.Framing); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func newSchemaValidator(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Schema     json.RawMessage `json:"schema"`
+		SchemaFile string          `json:"schema_file"`
+		Drop       bool            `json:"drop"` // Drop invalid records instead of halting
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	schema := []byte(opts.Schema)
+	if opts.SchemaFile != "" {
+		var err error
+		if schema, err = ioutil.ReadFile(opts.SchemaFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(schema) == 0 {
+		return nil, util.ConfigErrorf("schema or schema_file is required")
+	}
+	p, err := processors.NewSchemaValidator(schema)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	if opts.Drop {
+		p.Policy = processors.ValidationDrop
+	}
+	return p, nil
+}
+
+func newSQLReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Database    string          `json:"database"`
+		Query       string          `json:"query"`
+		BatchSize   int             `json:"batch_size"`
+		FetchSize   int             `json:"fetch_size"`
+		CountRows   bool            `json:"count_rows"`
+		Concurrency int             `json:"concurrency"`
+		Timeout     Duration        `json:"timeout"`
+		Retry       sqlRetryOptions `json:"retry"`
+		// Named parameters, see SQLReader.Params.
+		Params   map[string]interface{} `json:"params"`
+		BindData bool                   `json:"bind_data"`
+		// Incremental extraction, see SQLReader.WatermarkColumn.
+		WatermarkColumn  string      `json:"watermark_column"`
+		WatermarkKey     string      `json:"watermark_key"`
+		InitialWatermark interface{} `json:"initial_watermark"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewSQLReader(db, opts.Query)
+	p.BatchSize = opts.BatchSize
+	p.FetchSize = opts.FetchSize
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	p.Params = opts.Params
+	p.BindData = opts.BindData
+	p.CountRows = opts.CountRows
+	p.ConcurrencyLevel = opts.Concurrency
+	if opts.WatermarkColumn != "" {
+		if p.Checkpoints, err = def.CheckpointStore(); err != nil {
+			return nil, err
+		}
+		p.WatermarkColumn = opts.WatermarkColumn
+		p.WatermarkKey = opts.WatermarkKey
+		p.InitialWatermark = opts.InitialWatermark
+	}
+	return p, nil
+}
+
+func newPartitionedSQLReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Database        string                 `json:"database"`
+		Query           string                 `json:"query"`
+		PartitionColumn string                 `json:"partition_column"`
+		Partitions      int                    `json:"partitions"`
+		Modulo          bool                   `json:"modulo"`
+		Lower           interface{}            `json:"lower"`
+		Upper           interface{}            `json:"upper"`
+		Parallelism     int                    `json:"parallelism"`
+		BatchSize       int                    `json:"batch_size"`
+		FetchSize       int                    `json:"fetch_size"`
+		CountRows       bool                   `json:"count_rows"`
+		Timeout         Duration               `json:"timeout"`
+		Retry           sqlRetryOptions        `json:"retry"`
+		Params          map[string]interface{} `json:"params"`
+		BindData        bool                   `json:"bind_data"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.PartitionColumn == "" {
+		return nil, util.ConfigErrorf("partition_column is required")
+	}
+	if opts.Partitions <= 0 {
+		return nil, util.ConfigErrorf("partitions must be positive")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewPartitionedSQLReader(db, opts.Query, opts.PartitionColumn, opts.Partitions)
+	p.Modulo = opts.Modulo
+	p.Lower = opts.Lower
+	p.Upper = opts.Upper
+	p.Parallelism = opts.Parallelism
+	p.BatchSize = opts.BatchSize
+	p.FetchSize = opts.FetchSize
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	p.Params = opts.Params
+	p.BindData = opts.BindData
+	p.CountRows = opts.CountRows
+	return p, nil
+}
+
+func newMySQLBinlogReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Addr          string   `json:"addr"`
+		User          string   `json:"user"`
+		Password      string   `json:"password"`
+		Flavor        string   `json:"flavor"`
+		ServerID      uint32   `json:"server_id"`
+		Tables        []string `json:"tables"`
+		ExcludeTables []string `json:"exclude_tables"`
+		BatchSize     int      `json:"batch_size"`
+		StopAtCurrent bool     `json:"stop_at_current"`
+		CheckpointKey string   `json:"checkpoint_key"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Addr == "" {
+		return nil, util.ConfigErrorf("addr is required")
+	}
+	p := processors.NewMySQLBinlogReader(os.ExpandEnv(opts.Addr), os.ExpandEnv(opts.User), os.ExpandEnv(opts.Password))
+	p.Flavor = opts.Flavor
+	p.ServerID = opts.ServerID
+	p.Tables = opts.Tables
+	p.ExcludeTables = opts.ExcludeTables
+	p.BatchSize = opts.BatchSize
+	p.StopAtCurrent = opts.StopAtCurrent
+	p.CheckpointKey = opts.CheckpointKey
+	if def.CheckpointFile != "" {
+		var err error
+		if p.Checkpoints, err = def.CheckpointStore(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func newPostgreSQLReplicationReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		DSN            string   `json:"dsn"`
+		Slot           string   `json:"slot"`
+		Plugin         string   `json:"plugin"`
+		Publication    string   `json:"publication"`
+		CreateSlot     bool     `json:"create_slot"`
+		BatchSize      int      `json:"batch_size"`
+		StopAtCurrent  bool     `json:"stop_at_current"`
+		CheckpointKey  string   `json:"checkpoint_key"`
+		StatusInterval Duration `json:"status_interval"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.DSN == "" || opts.Slot == "" {
+		return nil, util.ConfigErrorf("dsn and slot are required")
+	}
+	p := processors.NewPostgreSQLReplicationReader(os.ExpandEnv(opts.DSN), opts.Slot, opts.Publication)
+	p.Plugin = opts.Plugin
+	p.CreateSlot = opts.CreateSlot
+	p.BatchSize = opts.BatchSize
+	p.StopAtCurrent = opts.StopAtCurrent
+	p.CheckpointKey = opts.CheckpointKey
+	p.StatusInterval = time.Duration(opts.StatusInterval)
+	if def.CheckpointFile != "" {
+		var err error
+		if p.Checkpoints, err = def.CheckpointStore(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// awsOptions are the options of processors using AWS. Credentials are
+// found as usual, e.g. from the environment or the instance's role.
+type awsOptions struct {
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint"` // e.g. for a local emulator
+}
+
+func (o awsOptions) session() (*session.Session, error) {
+	conf := aws.NewConfig()
+	if o.Region != "" {
+		conf = conf.WithRegion(o.Region)
+	}
+	if o.Endpoint != "" {
+		conf = conf.WithEndpoint(os.ExpandEnv(o.Endpoint))
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *conf, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return sess, nil
+}
+
+func newKinesisReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		awsOptions
+		Stream            string   `json:"stream"`
+		BatchSize         int      `json:"batch_size"`
+		StartingPosition  string   `json:"starting_position"` // LATEST or TRIM_HORIZON
+		PollInterval      Duration `json:"poll_interval"`
+		DiscoveryInterval Duration `json:"discovery_interval"`
+		Metadata          bool     `json:"metadata"` // Sends records with their shard, sequence number, etc.
+		StopAtCurrent     bool     `json:"stop_at_current"`
+		CheckpointKey     string   `json:"checkpoint_key"`
+	}{BatchSize: 1000}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Stream == "" {
+		return nil, util.ConfigErrorf("stream is required")
+	}
+	switch opts.StartingPosition {
+	case "", kinesis.ShardIteratorTypeLatest, kinesis.ShardIteratorTypeTrimHorizon:
+	default:
+		return nil, util.ConfigErrorf("unknown starting_position %q", opts.StartingPosition)
+	}
+	sess, err := opts.session()
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewKinesisReader(kinesis.New(sess), opts.Stream)
+	p.BatchSize = opts.BatchSize
+	p.StartingPosition = opts.StartingPosition
+	p.PollInterval = time.Duration(opts.PollInterval)
+	p.DiscoveryInterval = time.Duration(opts.DiscoveryInterval)
+	p.Metadata = opts.Metadata
+	p.StopAtCurrent = opts.StopAtCurrent
+	p.CheckpointKey = opts.CheckpointKey
+	if def.CheckpointFile != "" {
+		if p.Checkpoints, err = def.CheckpointStore(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func newFirehoseWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		awsOptions
+		DeliveryStream string  `json:"delivery_stream"`
+		LineSeparator  *string `json:"line_separator"` // Defaults to a newline
+		MaxAttempts    int     `json:"max_attempts"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.DeliveryStream == "" {
+		return nil, util.ConfigErrorf("delivery_stream is required")
+	}
+	sess, err := opts.session()
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewFirehoseWriter(firehose.New(sess), opts.DeliveryStream)
+	if opts.LineSeparator != nil {
+		p.LineSeparator = *opts.LineSeparator
+	}
+	if opts.MaxAttempts > 0 {
+		p.Retry.MaxAttempts = opts.MaxAttempts
+	}
+	return p, nil
+}
+
+// eventHubsOptions are the options of processors using Azure Event Hubs.
+// Without a connection string, credentials are found as usual, e.g. from
+// the environment or a managed identity (see
+// azidentity.NewDefaultAzureCredential).
+type eventHubsOptions struct {
+	ConnectionString string `json:"connection_string"`
+	Namespace        string `json:"namespace"` // e.g. example.servicebus.windows.net
+	EventHub         string `json:"event_hub"`
+}
+
+func (o eventHubsOptions) validate() error {
+	if o.EventHub == "" || (o.ConnectionString == "") == (o.Namespace == "") {
+		return util.ConfigErrorf("event_hub, and connection_string or namespace, are required")
+	}
+	return nil
+}
+
+func azureCredential() (azcore.TokenCredential, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return cred, nil
+}
+
+func newEventHubsReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		eventHubsOptions
+		ConsumerGroup string `json:"consumer_group"`
+		// Where partition ownership and checkpoints are kept: a blob
+		// container's URL, or a storage account's connection string and
+		// the container's name.
+		CheckpointContainerURL     string   `json:"checkpoint_container_url"`
+		CheckpointConnectionString string   `json:"checkpoint_connection_string"`
+		CheckpointContainer        string   `json:"checkpoint_container"`
+		BatchSize                  int      `json:"batch_size"`
+		MaxWait                    Duration `json:"max_wait"`
+		StartAtEarliest            bool     `json:"start_at_earliest"`
+		IdleTimeout                Duration `json:"idle_timeout"`
+		Metadata                   bool     `json:"metadata"` // Sends events with their partition, sequence number, etc.
+	}{ConsumerGroup: azeventhubs.DefaultConsumerGroup, BatchSize: 100}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	var cred azcore.TokenCredential
+	var err error
+	if opts.Namespace != "" || opts.CheckpointContainerURL != "" {
+		if cred, err = azureCredential(); err != nil {
+			return nil, err
+		}
+	}
+
+	var containerClient *container.Client
+	switch {
+	case opts.CheckpointContainerURL != "":
+		containerClient, err = container.NewClient(os.ExpandEnv(opts.CheckpointContainerURL), cred, nil)
+	case opts.CheckpointConnectionString != "" && opts.CheckpointContainer != "":
+		containerClient, err = container.NewClientFromConnectionString(os.ExpandEnv(opts.CheckpointConnectionString), opts.CheckpointContainer, nil)
+	default:
+		return nil, util.ConfigErrorf("checkpoint_container_url, or checkpoint_connection_string and checkpoint_container, are required")
+	}
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	store, err := checkpoints.NewBlobStore(containerClient, nil)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+
+	var consumer *azeventhubs.ConsumerClient
+	if opts.ConnectionString != "" {
+		consumer, err = azeventhubs.NewConsumerClientFromConnectionString(os.ExpandEnv(opts.ConnectionString), opts.EventHub, opts.ConsumerGroup, nil)
+	} else {
+		consumer, err = azeventhubs.NewConsumerClient(opts.Namespace, opts.EventHub, opts.ConsumerGroup, cred, nil)
+	}
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	p := processors.NewEventHubsReader(consumer, store)
+	def.AddCloser(p)
+	p.BatchSize = opts.BatchSize
+	p.MaxWait = time.Duration(opts.MaxWait)
+	p.StartAtEarliest = opts.StartAtEarliest
+	p.IdleTimeout = time.Duration(opts.IdleTimeout)
+	p.Metadata = opts.Metadata
+	return p, nil
+}
+
+func newEventHubsWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		eventHubsOptions
+		PartitionKeyField string `json:"partition_key_field"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	var producer *azeventhubs.ProducerClient
+	var err error
+	if opts.ConnectionString != "" {
+		producer, err = azeventhubs.NewProducerClientFromConnectionString(os.ExpandEnv(opts.ConnectionString), opts.EventHub, nil)
+	} else {
+		var cred azcore.TokenCredential
+		if cred, err = azureCredential(); err != nil {
+			return nil, err
+		}
+		producer, err = azeventhubs.NewProducerClient(opts.Namespace, opts.EventHub, cred, nil)
+	}
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	p := processors.NewEventHubsWriter(producer)
+	def.AddCloser(p)
+	p.PartitionKeyField = opts.PartitionKeyField
+	return p, nil
+}
+
+func newMQTTReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Brokers  []string `json:"brokers"` // e.g. tcp://localhost:1883, ssl://example.com:8883
+		ClientID string   `json:"client_id"`
+		Username string   `json:"username"`
+		Password string   `json:"password"`
+		// Defaults to false with a client_id and a qos above 0, so the
+		// broker keeps the subscriptions, and the messages not yet
+		// acknowledged, while the reader isn't running.
+		CleanSession  *bool    `json:"clean_session"`
+		Topics        []string `json:"topics"`
+		QoS           byte     `json:"qos"`
+		BatchSize     int      `json:"batch_size"`
+		FlushInterval Duration `json:"flush_interval"`
+		IdleTimeout   Duration `json:"idle_timeout"`
+		Metadata      bool     `json:"metadata"` // Sends messages with their topic, QoS, etc.
+	}{BatchSize: 100}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if len(opts.Brokers) == 0 || len(opts.Topics) == 0 {
+		return nil, util.ConfigErrorf("brokers and topics are required")
+	}
+	if opts.QoS > 2 {
+		return nil, util.ConfigErrorf("qos must be 0, 1 or 2")
+	}
+	options := mqtt.NewClientOptions()
+	for _, b := range opts.Brokers {
+		options.AddBroker(os.ExpandEnv(b))
+	}
+	options.SetClientID(os.ExpandEnv(opts.ClientID))
+	options.SetUsername(os.ExpandEnv(opts.Username))
+	options.SetPassword(os.ExpandEnv(opts.Password))
+	if opts.CleanSession != nil {
+		options.SetCleanSession(*opts.CleanSession)
+	} else if opts.ClientID != "" && opts.QoS > 0 {
+		options.SetCleanSession(false)
+	}
+	p := processors.NewMQTTReader(options, opts.Topics...)
+	p.QoS = opts.QoS
+	p.BatchSize = opts.BatchSize
+	p.FlushInterval = time.Duration(opts.FlushInterval)
+	p.IdleTimeout = time.Duration(opts.IdleTimeout)
+	p.Metadata = opts.Metadata
+	return p, nil
+}
+
+func newRedisStreamReader(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		RedisAddr     string   `json:"redis_addr"`
+		Stream        string   `json:"stream"`
+		Group         string   `json:"group"`
+		Consumer      string   `json:"consumer"` // Defaults to the host name
+		PayloadField  string   `json:"payload_field"`
+		BatchSize     int      `json:"batch_size"`
+		Block         Duration `json:"block"`
+		ClaimMinIdle  Duration `json:"claim_min_idle"`
+		CreateGroup   bool     `json:"create_group"`
+		StartID       string   `json:"start_id"`
+		Metadata      bool     `json:"metadata"` // Sends entries with their stream and ID
+		StopAtCurrent bool     `json:"stop_at_current"`
+	}{BatchSize: 100}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.RedisAddr == "" || opts.Stream == "" || opts.Group == "" {
+		return nil, util.ConfigErrorf("redis_addr, stream and group are required")
+	}
+	consumer := os.ExpandEnv(opts.Consumer)
+	if consumer == "" {
+		var err error
+		if consumer, err = os.Hostname(); err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+	}
+	client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{os.ExpandEnv(opts.RedisAddr)}})
+	def.AddCloser(client)
+	p := processors.NewRedisStreamReader(client, opts.Stream, opts.Group, consumer)
+	p.PayloadField = opts.PayloadField
+	p.BatchSize = opts.BatchSize
+	p.Block = time.Duration(opts.Block)
+	p.ClaimMinIdle = time.Duration(opts.ClaimMinIdle)
+	p.CreateGroup = opts.CreateGroup
+	p.StartID = opts.StartID
+	p.Metadata = opts.Metadata
+	p.StopAtCurrent = opts.StopAtCurrent
+	return p, nil
+}
+
+func newSQLExecutor(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Database string          `json:"database"`
+		Query    string          `json:"query"`
+		Timeout  Duration        `json:"timeout"`
+		Retry    sqlRetryOptions `json:"retry"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewSQLExecutor(db, opts.Query)
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+func newSQLExecProcessor(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		Database   string                 `json:"database"`
+		Statements []string               `json:"statements"`
+		Params     map[string]interface{} `json:"params"`
+		BindData   bool                   `json:"bind_data"`
+		PerRecord  bool                   `json:"per_record"`
+		OnFinish   bool                   `json:"on_finish"`
+		Discard    bool                   `json:"discard"`
+		Timeout    Duration               `json:"timeout"`
+		Retry      sqlRetryOptions        `json:"retry"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if len(opts.Statements) == 0 {
+		return nil, util.ConfigErrorf("statements are required")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p, err := processors.NewSQLExecProcessor(db, opts.Statements...)
+	if err != nil {
+		return nil, err
+	}
+	p.Params = opts.Params
+	p.BindData = opts.BindData
+	p.PerRecord = opts.PerRecord
+	p.OnFinish = opts.OnFinish
+	p.Discard = opts.Discard
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+// sqlWriterOptions are shared by the SQL writers.
+type sqlWriterOptions struct {
+	Database       string          `json:"database"`
+	Table          string          `json:"table"`
+	OnDupKeyUpdate *bool           `json:"on_dup_key_update"` // Defaults to true
+	OnDupKeyFields []string        `json:"on_dup_key_fields"`
+	BatchSize      int             `json:"batch_size"`
+	Concurrency    int             `json:"concurrency"`
+	Timeout        Duration        `json:"timeout"` // Limits each INSERT
+	Retry          sqlRetryOptions `json:"retry"`
+}
+
+func (o sqlWriterOptions) onDupKeyUpdate() bool {
+	return o.OnDupKeyUpdate == nil || *o.OnDupKeyUpdate
+}
+
+// sqlRetryOptions configure retrying SQL statements, see util.SQLRetry.
+type sqlRetryOptions struct {
+	MaxAttempts int      `json:"max_attempts"`
+	Backoff     Duration `json:"backoff"`
+	MaxBackoff  Duration `json:"max_backoff"`
+}
+
+func (o sqlRetryOptions) retry() util.SQLRetry {
+	return util.SQLRetry{MaxAttempts: o.MaxAttempts, Backoff: time.Duration(o.Backoff), MaxBackoff: time.Duration(o.MaxBackoff)}
+}
+
+// adaptiveBatchOptions configure adjusting a writer's batch size, see
+// util.AdaptiveBatchSize.
+type adaptiveBatchOptions struct {
+	Min           int      `json:"min"`
+	Max           int      `json:"max"`
+	TargetLatency Duration `json:"target_latency"`
+}
+
+// adaptive returns the AdaptiveBatchSize starting at initial, or nil if
+// the options weren't set.
+func (o *adaptiveBatchOptions) adaptive(initial int) *util.AdaptiveBatchSize {
+	if o == nil {
+		return nil
+	}
+	return util.NewAdaptiveBatchSize(initial, o.Min, o.Max, time.Duration(o.TargetLatency))
+}
+
+func newMySQLWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		sqlWriterOptions
+		LoadData     bool   `json:"load_data"`
+		IDField      string `json:"id_field"`      // Sends records on with their generated IDs
+		LoadStrategy string `json:"load_strategy"` // append, truncate or swap
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.LoadData && len(opts.OnDupKeyFields) > 0 {
+		return nil, util.ConfigErrorf("on_dup_key_fields isn't supported with load_data")
+	}
+	if opts.LoadData && opts.IDField != "" {
+		return nil, util.ConfigErrorf("id_field isn't supported with load_data")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewMySQLWriter(db, opts.Table)
+	p.OnDupKeyUpdate = opts.onDupKeyUpdate()
+	p.OnDupKeyFields = opts.OnDupKeyFields
+	p.LoadData = opts.LoadData
+	p.IDField = opts.IDField
+	p.LoadStrategy = opts.LoadStrategy
+	p.BatchSize = opts.BatchSize
+	p.ConcurrencyLevel = opts.Concurrency
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+func newPostgreSQLWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		sqlWriterOptions
+		OnDupKeyIndex string `json:"on_dup_key_index"`
+		IDField       string `json:"id_field"`      // Sends records on with their generated IDs
+		LoadStrategy  string `json:"load_strategy"` // append, truncate or swap
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewPostgreSQLWriter(db, opts.Table)
+	p.OnDupKeyUpdate = opts.onDupKeyUpdate()
+	p.OnDupKeyIndex = opts.OnDupKeyIndex
+	p.OnDupKeyFields = opts.OnDupKeyFields
+	p.IDField = opts.IDField
+	p.LoadStrategy = opts.LoadStrategy
+	p.BatchSize = opts.BatchSize
+	p.ConcurrencyLevel = opts.Concurrency
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+func newSQLiteWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		sqlWriterOptions
+		PrimaryKeys     []string          `json:"primary_keys"`
+		PreservedFields []string          `json:"preserved_fields"`
+		Mode            string            `json:"mode"` // insert, update or delete
+		OpField         string            `json:"op_field"`
+		IDField         string            `json:"id_field"`      // Sends records on with their generated IDs
+		LoadStrategy    string            `json:"load_strategy"` // append, truncate or swap
+		AddColumns      bool              `json:"add_columns"`   // Adds columns for new fields
+		AllowedColumns  []string          `json:"allowed_columns"`
+		IncludeColumns  []string          `json:"include_columns"`
+		ExcludeColumns  []string          `json:"exclude_columns"`
+		AfterLoad       []string          `json:"after_load"` // Statements run when finished
+		Reindex         bool              `json:"reindex"`
+		Analyze         bool              `json:"analyze"`
+		Vacuum          bool              `json:"vacuum"`
+		Attach          map[string]string `json:"attach"` // Database files by schema name
+		// AdaptiveBatchSize adjusts batch_size as the writer goes.
+		AdaptiveBatchSize *adaptiveBatchOptions `json:"adaptive_batch_size"`
+	}
+	opts.BatchSize = 100
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if len(opts.OnDupKeyFields) > 0 {
+		return nil, util.ConfigErrorf("on_dup_key_fields isn't supported by sqlite_writer")
+	}
+	if opts.IDField != "" && opts.OpField != "" {
+		return nil, util.ConfigErrorf("id_field isn't supported with op_field")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewSQLiteWriter(db, opts.Table)
+	p.OnDupKeyUpdate = opts.onDupKeyUpdate()
+	p.PrimaryKeys = opts.PrimaryKeys
+	p.PreservedFields = opts.PreservedFields
+	p.Mode = opts.Mode
+	p.OpField = opts.OpField
+	p.IDField = opts.IDField
+	p.LoadStrategy = opts.LoadStrategy
+	p.AddColumns = opts.AddColumns
+	p.AllowedColumns = opts.AllowedColumns
+	p.IncludeColumns = opts.IncludeColumns
+	p.ExcludeColumns = opts.ExcludeColumns
+	p.Attach = opts.Attach
+	p.Maintenance = util.SQLiteMaintenance{
+		Statements: opts.AfterLoad,
+		Reindex:    opts.Reindex,
+		Analyze:    opts.Analyze,
+		Vacuum:     opts.Vacuum,
+	}
+	p.BatchSize = opts.BatchSize
+	p.AdaptiveBatchSize = opts.AdaptiveBatchSize.adaptive(opts.BatchSize)
+	p.ConcurrencyLevel = opts.Concurrency
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+func newMSSQLWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		sqlWriterOptions
+		IdentityInsert   bool `json:"identity_insert"`
+		TableLock        bool `json:"table_lock"`
+		CheckConstraints bool `json:"check_constraints"`
+		FireTriggers     bool `json:"fire_triggers"`
+		KeepNulls        bool `json:"keep_nulls"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if (opts.OnDupKeyUpdate != nil && *opts.OnDupKeyUpdate) || len(opts.OnDupKeyFields) > 0 {
+		return nil, util.ConfigErrorf("on_dup_key_update isn't supported by mssql_writer")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewMSSQLWriter(db, opts.Table)
+	p.BatchSize = opts.BatchSize
+	p.ConcurrencyLevel = opts.Concurrency
+	p.IdentityInsert = opts.IdentityInsert
+	p.TableLock = opts.TableLock
+	p.CheckConstraints = opts.CheckConstraints
+	p.FireTriggers = opts.FireTriggers
+	p.KeepNulls = opts.KeepNulls
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+func newRoutingSQLWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	var opts struct {
+		// Writer is the SQL writer to write each table's records with,
+		// e.g. {"type": "postgresql_writer", "options": {"database": "dw"}}.
+		Writer         ProcessorDefinition `json:"writer"`
+		Table          string              `json:"table"` // A template, e.g. "events_{{.event_type}}"
+		TableField     string              `json:"table_field"`
+		DropTableField bool                `json:"drop_table_field"`
+		CreateTables   bool                `json:"create_tables"`
+		PrimaryKeys    []string            `json:"primary_keys"` // Of the tables created
+		Database       *string             `json:"database"`     // Defaults to the writer's database
+		Concurrency    int                 `json:"concurrency"`
+	}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Writer.Type == "" {
+		return nil, util.ConfigErrorf("writer is required")
+	}
+	if opts.Table == "" && opts.TableField == "" {
+		return nil, util.ConfigErrorf("table or table_field is required")
+	}
+	if opts.Concurrency > 0 {
+		opts.Writer.Concurrency = opts.Concurrency
+	}
+	writer, err := def.buildProcessor(opts.Writer)
+	if err != nil {
+		return nil, fmt.Errorf("writer (%v): %w", opts.Writer.Type, err)
+	}
+
+	var db *sqlx.DB
+	if opts.CreateTables {
+		name, _ := opts.Writer.Options["database"].(string)
+		if opts.Database != nil {
+			name = *opts.Database
+		}
+		if db, err = def.DB(name); err != nil {
+			return nil, err
+		}
+	}
+	p, err := processors.NewRoutingSQLWriter(db, writer, opts.Table)
+	if err != nil {
+		return nil, err
+	}
+	p.TableField = opts.TableField
+	p.DropTableField = opts.DropTableField
+	p.CreateTables = opts.CreateTables
+	p.PrimaryKeys = opts.PrimaryKeys
+	return p, nil
+}
+
+func newSyncWriter(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Database         string          `json:"database"`
+		Table            string          `json:"table"`
+		PrimaryKeys      []string        `json:"primary_keys"`
+		BatchSize        int             `json:"batch_size"`
+		AllowEmptySource bool            `json:"allow_empty_source"`
+		Timeout          Duration        `json:"timeout"`
+		Retry            sqlRetryOptions `json:"retry"`
+	}{BatchSize: 100}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Table == "" || len(opts.PrimaryKeys) == 0 {
+		return nil, util.ConfigErrorf("table and primary_keys are required")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewSyncWriter(db, opts.Table, opts.PrimaryKeys...)
+	p.BatchSize = opts.BatchSize
+	p.AllowEmptySource = opts.AllowEmptySource
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
+
+func newSCD2Writer(def *PipelineDefinition, o Options) (ratchet.DataProcessor, error) {
+	opts := struct {
+		Database        string          `json:"database"`
+		Table           string          `json:"table"`
+		BusinessKeys    []string        `json:"business_keys"`
+		CompareColumns  []string        `json:"compare_columns"`
+		ValidFromColumn string          `json:"valid_from_column"`
+		ValidToColumn   string          `json:"valid_to_column"`
+		CurrentColumn   *string         `json:"current_column"` // "" to not use one
+		EffectiveField  string          `json:"effective_field"`
+		BatchSize       int             `json:"batch_size"`
+		Timeout         Duration        `json:"timeout"`
+		Retry           sqlRetryOptions `json:"retry"`
+	}{ValidFromColumn: "valid_from", ValidToColumn: "valid_to", BatchSize: 100}
+	if err := o.Decode(&opts); err != nil {
+		return nil, err
+	}
+	if opts.Table == "" || len(opts.BusinessKeys) == 0 {
+		return nil, util.ConfigErrorf("table and business_keys are required")
+	}
+	db, err := def.DB(opts.Database)
+	if err != nil {
+		return nil, err
+	}
+	p := processors.NewSCD2Writer(db, opts.Table, opts.BusinessKeys...)
+	p.CompareColumns = opts.CompareColumns
+	p.ValidFromColumn = opts.ValidFromColumn
+	p.ValidToColumn = opts.ValidToColumn
+	if opts.CurrentColumn != nil {
+		p.CurrentColumn = *opts.CurrentColumn
+	}
+	p.EffectiveField = opts.EffectiveField
+	p.BatchSize = opts.BatchSize
+	p.Timeout = time.Duration(opts.Timeout)
+	p.Retry = opts.Retry.retry()
+	return p, nil
+}
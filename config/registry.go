@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Factory creates a DataProcessor from its options. The PipelineDefinition
+// being built is passed in to give access to shared resources such as
+// databases (see PipelineDefinition.DB).
+type Factory func(def *PipelineDefinition, opts Options) (ratchet.DataProcessor, error)
+
+var (
+	factories     = make(map[string]Factory)
+	factoriesLock sync.RWMutex
+)
+
+// Register makes a Factory available for the given processor type. It
+// replaces any Factory previously registered for the type, so the built-in
+// types can be overridden.
+func Register(processorType string, f Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[processorType] = f
+}
+
+// Types returns the registered processor types, sorted.
+func Types() []string {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func factory(processorType string) (Factory, error) {
+	factoriesLock.RLock()
+	defer factoriesLock.RUnlock()
+	f, ok := factories[processorType]
+	if !ok {
+		return nil, util.ConfigErrorf("unknown processor type %q", processorType)
+	}
+	return f, nil
+}
+
+// Options holds the options given to a processor in a definition.
+type Options map[string]interface{}
+
+// Decode decodes the options into v, which should be a pointer to a struct
+// with json tags. Options that don't match a field in v are an error, so
+// typos are caught when the Pipeline is built.
+func (o Options) Decode(v interface{}) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return util.ConfigInvalidError(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return util.ConfigErrorf("invalid options: %v", err)
+	}
+	return nil
+}
+
+// Duration is a time.Duration option, given as a string such as "1m30s"
+// (see time.ParseDuration) or a number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON - see json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch vv := v.(type) {
+	case float64:
+		*d = Duration(vv * float64(time.Second))
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(vv)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+	return fmt.Errorf("invalid duration %v", string(b))
+}
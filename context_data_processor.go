@@ -0,0 +1,33 @@
+package ratchet
+
+import (
+	"context"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// ContextDataProcessor is a DataProcessor that can be cancelled. When a
+// DataProcessor implements ContextDataProcessor, the Pipeline calls
+// ProcessDataCtx instead of ProcessData, passing a context.Context that is
+// cancelled when a Pipeline started with Run is interrupted (SIGINT), or
+// when the context given to Pipeline.RunContext is cancelled or reaches its
+// deadline.
+// Long-running work (SQL queries, HTTP requests, S3 transfers, etc.)
+// should use ctx so it stops promptly.
+//
+// Note that ProcessData is still required, and is typically implemented as
+// ProcessDataCtx(context.Background(), ...).
+type ContextDataProcessor interface {
+	DataProcessor
+	ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error)
+}
+
+// callProcessData calls ProcessDataCtx if the DataProcessor supports it,
+// otherwise ProcessData.
+func (dp *dataProcessor) callProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if cp, ok := dp.DataProcessor.(ContextDataProcessor); ok && dp.ctx != nil {
+		cp.ProcessDataCtx(dp.ctx, d, outputChan, killChan)
+		return
+	}
+	dp.ProcessData(d, outputChan, killChan)
+}
@@ -0,0 +1,62 @@
+package ratchet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// ctxFailer fails each ProcessDataCtx call with a transient error, after
+// sending on attempts. It must not be called with ProcessData.
+type ctxFailer struct {
+	attempts chan struct{}
+}
+
+func (f ctxFailer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	killChan <- errors.New("ProcessData was called instead of ProcessDataCtx")
+}
+
+func (f ctxFailer) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	f.attempts <- struct{}{}
+	killChan <- util.TransientError(errors.New("connection reset"))
+}
+
+func (f ctxFailer) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestRunContextRetrier(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	f := ctxFailer{attempts: make(chan struct{}, 10)}
+	retrier := processors.WithRetry(f, processors.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	killChan := ratchet.NewPipeline(sender{`{}`}, retrier).RunContext(ctx)
+
+	select {
+	case <-f.attempts:
+	case err := <-killChan:
+		t.Fatalf("the Pipeline finished with %v before the first attempt", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no attempt was made")
+	}
+	// Cancelling stops the Retrier's backoff.
+	cancel()
+	select {
+	case err := <-killChan:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish once cancelled")
+	}
+	if n := len(f.attempts); n != 0 {
+		t.Errorf("got %d more attempts after cancelling, want 0", n)
+	}
+}
@@ -2,6 +2,7 @@ package data_test
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/fefelovgroup/ratchet/data"
 )
@@ -60,3 +61,18 @@ func ExampleJSONFromHeaderAndRows() {
 	fmt.Println(fmt.Sprintf("%+v", string(d)))
 	// Output: [{"A":1,"B":2,"C":3},{"A":4,"B":5,"C":6}]
 }
+
+func ExampleNewDecoder() {
+	r := strings.NewReader(`{"A":1,"B":2}
+[{"A":3,"B":4}, null, {"A":5,"B":6}]
+{"A":7,"B":8}`)
+
+	data.ForEachBatch(data.NewDecoder(r), 2, func(batch []map[string]interface{}) error {
+		d, err := data.NewJSON(batch)
+		fmt.Println(string(d))
+		return err
+	})
+	// Output:
+	// [{"A":1,"B":2},{"A":3,"B":4}]
+	// [{"A":5,"B":6},{"A":7,"B":8}]
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Iterator returns objects one at a time, so that large inputs can be
+// processed without holding all of their records in memory. Next returns
+// io.EOF once there are no more objects.
+type Iterator interface {
+	Next() (map[string]interface{}, error)
+}
+
+// Decoder is an Iterator over the JSON objects read from an io.Reader,
+// which may hold a single object, an array of objects (however large), or
+// a stream of objects and arrays separated by whitespace, such as
+// newline-delimited JSON. Only the object being decoded is held in memory.
+// Nulls are skipped, like ObjectsFromJSON does for a null payload, and
+// other values are an error.
+type Decoder struct {
+	dec     *json.Decoder
+	inArray bool
+}
+
+// NewDecoder returns a new Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// UseNumber makes the Decoder decode numbers as json.Number instead of
+// float64, so that they're written back unchanged (see NewJSON).
+func (d *Decoder) UseNumber() {
+	d.dec.UseNumber()
+}
+
+// Next returns the next object, or io.EOF at the end of the input.
+func (d *Decoder) Next() (map[string]interface{}, error) {
+	for {
+		if d.inArray {
+			if !d.dec.More() {
+				// The closing bracket.
+				if _, err := d.dec.Token(); err != nil {
+					return nil, err
+				}
+				d.inArray = false
+				continue
+			}
+			var v interface{}
+			if err := d.dec.Decode(&v); err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue
+			}
+			o, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Decoder: unsupported data type in array: %T", v)
+			}
+			return o, nil
+		}
+
+		t, err := d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case json.Delim('['):
+			d.inArray = true
+		case json.Delim('{'):
+			return d.object()
+		case nil:
+		default:
+			return nil, fmt.Errorf("Decoder: unsupported data type: %T", t)
+		}
+	}
+}
+
+// object decodes the rest of an object whose opening brace has been read.
+func (d *Decoder) object() (map[string]interface{}, error) {
+	o := map[string]interface{}{}
+	for d.dec.More() {
+		t, err := d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := t.(string)
+		var v interface{}
+		if err := d.dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		o[key] = v
+	}
+	// The closing brace.
+	if _, err := d.dec.Token(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// sliceIterator is an Iterator over objects already in memory.
+type sliceIterator struct {
+	objects []map[string]interface{}
+}
+
+// IteratorFromObjects returns an Iterator over already decoded objects,
+// e.g. to pass them to code that consumes an Iterator.
+func IteratorFromObjects(objects []map[string]interface{}) Iterator {
+	return &sliceIterator{objects: objects}
+}
+
+func (it *sliceIterator) Next() (map[string]interface{}, error) {
+	if len(it.objects) == 0 {
+		return nil, io.EOF
+	}
+	o := it.objects[0]
+	it.objects = it.objects[1:]
+	return o, nil
+}
+
+// ForEachBatch calls fn with batches of up to size objects (all of them if
+// size <= 0) from it, until it returns io.EOF, or it or fn returns another
+// error, which is returned. Readers can use it to send records on in
+// batches (see NewJSON), and writers to write them.
+func ForEachBatch(it Iterator, size int, fn func(batch []map[string]interface{}) error) error {
+	var batch []map[string]interface{}
+	for {
+		o, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, o)
+		if size > 0 && len(batch) == size {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return fn(batch)
+}
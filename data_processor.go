@@ -2,8 +2,10 @@ package ratchet
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/fefelovgroup/ratchet/data"
 )
@@ -39,21 +41,42 @@ type dataProcessor struct {
 	outputs    []DataProcessor
 	inputChan  chan data.JSON
 	outputChan chan data.JSON
+	errors     *errorWrapper
+	ctx        context.Context
+	activity   activity
 }
 
 type chanBrancher struct {
-	branchOutChans []chan data.JSON
+	branchOutChans []chan queuedData
+}
+
+// queuedData is sent between stages, recording when it was sent so the
+// time spent waiting to be processed can be measured.
+type queuedData struct {
+	d      data.JSON
+	queued time.Time
 }
 
 func (dp *dataProcessor) branchOut() {
 	go func() {
+		router, isRouter := dp.DataProcessor.(RoutingDataProcessor)
 		for d := range dp.outputChan {
-			for _, out := range dp.branchOutChans {
+			dp.activity.progressed()
+			var routes []DataProcessor
+			if isRouter {
+				routes = router.Route(d)
+			}
+			for i, out := range dp.branchOutChans {
+				if isRouter && !containsProcessor(routes, dp.outputs[i]) {
+					continue
+				}
 				// Make a copy to ensure concurrent stages
 				// can alter data as needed.
 				dc := make(data.JSON, len(d))
 				copy(dc, d)
-				out <- dc
+				unblock := dp.activity.block()
+				out <- queuedData{dc, time.Now()}
+				unblock()
 			}
 			dp.recordDataSent(d)
 		}
@@ -65,21 +88,33 @@ func (dp *dataProcessor) branchOut() {
 }
 
 type chanMerger struct {
-	mergeInChans []chan data.JSON
-	mergeWait    sync.WaitGroup
+	mergeInChans   []chan queuedData
+	mergeInSources []DataProcessor // The DataProcessor sending to each mergeInChan
+	mergeWait      sync.WaitGroup
 }
 
 func (dp *dataProcessor) mergeIn() {
 	// Start a merge goroutine for each input channel.
-	mergeData := func(c chan data.JSON) {
-		for d := range c {
-			dp.inputChan <- d
+	tagger, isTagger := dp.DataProcessor.(SourceTaggingDataProcessor)
+	closer, isCloser := dp.DataProcessor.(SourceClosingDataProcessor)
+	mergeData := func(c chan queuedData, source DataProcessor) {
+		for qd := range c {
+			if isTagger {
+				qd.d = tagger.TagSource(qd.d, source)
+			}
+			dp.inputChan <- qd.d
+			dp.recordQueueWait(time.Since(qd.queued))
+		}
+		if isCloser {
+			if d := closer.SourceClosed(source); d != nil {
+				dp.inputChan <- d
+			}
 		}
 		dp.mergeWait.Done()
 	}
 	dp.mergeWait.Add(len(dp.mergeInChans))
-	for _, in := range dp.mergeInChans {
-		go mergeData(in)
+	for i, in := range dp.mergeInChans {
+		go mergeData(in, dp.mergeInSources[i])
 	}
 
 	go func() {
@@ -101,16 +136,20 @@ func Do(processor DataProcessor) *dataProcessor {
 	dp.inputChan = make(chan data.JSON)
 
 	if isConcurrent(processor) {
-		dp.concurrency = processor.(ConcurrentDataProcessor).Concurrency()
-		dp.workThrottle = make(chan workSignal, dp.concurrency)
-		dp.workList = list.New()
-		dp.doneChan = make(chan bool)
-		dp.inputClosed = false
+		dp.setConcurrency(processor.(ConcurrentDataProcessor).Concurrency())
 	}
 
 	return &dp
 }
 
+// setConcurrency sets up the dataProcessor to make up to concurrency
+// ProcessData calls at once.
+func (dp *dataProcessor) setConcurrency(concurrency int) {
+	dp.concurrency = concurrency
+	dp.workThrottle = make(chan workSignal, concurrency)
+	dp.workList = list.New()
+}
+
 // Outputs should be called to specify which DataProcessor instances the current
 // processor should send it's output to. See the ratchet package
 // documentation for code examples and diagrams.
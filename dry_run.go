@@ -0,0 +1,130 @@
+package ratchet
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// DryRunner can be implemented by DataProcessors that write data somewhere,
+// to describe the writes they would make for the given data without making
+// them. See Pipeline.DryRun.
+type DryRunner interface {
+	DryRun(d data.JSON) ([]DryRunWrite, error)
+}
+
+// DryRunWrite describes a write a DataProcessor would have made.
+type DryRunWrite struct {
+	Target     string   // e.g. the table name
+	Statements []string // e.g. the generated SQL
+}
+
+// DryRunResult records what a DataProcessor in the final PipelineStage
+// received during a dry run. See Pipeline.DryRun.
+type DryRunResult struct {
+	ProcessorInfo
+	Payloads int
+	Records  int
+	// Samples holds the first payloads received, up to DryRunSampleSize.
+	Samples []data.JSON
+	// Targets lists each distinct DryRunWrite.Target, in the order they
+	// were first seen.
+	Targets []string
+	// Statements holds the first statements generated, up to
+	// DryRunSampleSize.
+	Statements []string
+}
+
+// dryRunRecorder stands in for a DataProcessor in the final PipelineStage
+// during a dry run.
+type dryRunRecorder struct {
+	target     DataProcessor
+	sampleSize int
+	result     DryRunResult
+	mutex      sync.Mutex
+}
+
+func (r *dryRunRecorder) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	var writes []DryRunWrite
+	if dr, ok := r.target.(DryRunner); ok {
+		var err error
+		writes, err = dr.DryRun(d)
+		if err != nil {
+			killChan <- err
+			return
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.result.Payloads++
+	r.result.Records += countRecords(d)
+	if len(r.result.Samples) < r.sampleSize {
+		r.result.Samples = append(r.result.Samples, d)
+	}
+	for _, w := range writes {
+		if !containsString(r.result.Targets, w.Target) {
+			r.result.Targets = append(r.result.Targets, w.Target)
+		}
+		for _, s := range w.Statements {
+			if len(r.result.Statements) < r.sampleSize {
+				r.result.Statements = append(r.result.Statements, s)
+			}
+		}
+	}
+}
+
+// Finish doesn't finish the target DataProcessor, since that could
+// flush data somewhere.
+func (r *dryRunRecorder) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *dryRunRecorder) String() string {
+	return fmt.Sprintf("DryRun(%v)", r.target)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// startDryRun replaces the DataProcessors in the final PipelineStage with
+// dryRunRecorders. NamedOutputs are left alone, since they don't write
+// anything and must be closed for the Pipeline's caller.
+func (p *Pipeline) startDryRun() {
+	sampleSize := p.DryRunSampleSize
+	if sampleSize <= 0 {
+		sampleSize = 10
+	}
+	n := len(p.layout.stages) - 1
+	for i, dp := range p.layout.stages[n].processors {
+		if _, ok := dp.DataProcessor.(*NamedOutput); ok {
+			continue
+		}
+		r := &dryRunRecorder{target: dp.DataProcessor, sampleSize: sampleSize}
+		dp.DataProcessor = r
+		r.result.ProcessorInfo = processorInfo(n, i, dp)
+		p.dryRuns = append(p.dryRuns, r)
+	}
+}
+
+// DryRunResults returns what each DataProcessor in the final PipelineStage
+// received during a dry run. It can be called while the Pipeline is running
+// to get the results so far.
+func (p *Pipeline) DryRunResults() []DryRunResult {
+	results := make([]DryRunResult, len(p.dryRuns))
+	for i, r := range p.dryRuns {
+		r.mutex.Lock()
+		results[i] = r.result
+		results[i].Samples = append([]data.JSON(nil), r.result.Samples...)
+		results[i].Targets = append([]string(nil), r.result.Targets...)
+		results[i].Statements = append([]string(nil), r.result.Statements...)
+		r.mutex.Unlock()
+	}
+	return results
+}
@@ -1,6 +1,8 @@
 package ratchet
 
 import (
+	"math"
+	"sync"
 	"time"
 
 	"github.com/fefelovgroup/ratchet/data"
@@ -10,39 +12,112 @@ type executionStat struct {
 	dataSentCounter     int
 	dataReceivedCounter int
 	executionsCounter   int
-	totalExecutionTime  float64
-	avgExecutionTime    float64
+	errorsCounter       int
+	inFlight            int
 	totalBytesReceived  int
-	avgBytesReceived    int
 	totalBytesSent      int
-	avgBytesSent        int
+	executionTimes      durationHistogram
+	queueWaits          durationHistogram
+	statMutex           sync.Mutex
 }
 
 func (s *executionStat) recordExecution(foo func()) {
-	s.executionsCounter++
+	s.statMutex.Lock()
+	s.inFlight++
+	s.statMutex.Unlock()
 	st := time.Now()
 	foo()
-	s.totalExecutionTime += time.Now().Sub(st).Seconds()
+	d := time.Now().Sub(st)
+	s.statMutex.Lock()
+	s.inFlight--
+	s.executionsCounter++
+	s.executionTimes.add(d)
+	s.statMutex.Unlock()
 }
 
 func (s *executionStat) recordDataSent(d data.JSON) {
+	s.statMutex.Lock()
 	s.dataSentCounter++
 	s.totalBytesSent += len(d)
+	s.statMutex.Unlock()
 }
 
 func (s *executionStat) recordDataReceived(d data.JSON) {
+	s.statMutex.Lock()
 	s.dataReceivedCounter++
 	s.totalBytesReceived += len(d)
+	s.statMutex.Unlock()
+}
+
+func (s *executionStat) recordError() {
+	s.statMutex.Lock()
+	s.errorsCounter++
+	s.statMutex.Unlock()
+}
+
+func (s *executionStat) recordQueueWait(d time.Duration) {
+	s.statMutex.Lock()
+	s.queueWaits.add(d)
+	s.statMutex.Unlock()
+}
+
+const (
+	histogramBucketsPerDoubling = 8
+	// From 1µs, doubling 32 times reaches over an hour.
+	histogramBuckets = 32*histogramBucketsPerDoubling + 2
+)
+
+// durationHistogram summarizes durations in a fixed amount of memory, so
+// stats don't grow with the number of payloads a long-running Pipeline
+// processes. Durations are counted in buckets growing by 2^(1/8) (about
+// 9%) from 1µs, which is how precise the percentiles are. The count,
+// total and max are exact.
+type durationHistogram struct {
+	count   int
+	total   time.Duration
+	max     time.Duration
+	buckets [histogramBuckets]int
+}
+
+func (h *durationHistogram) add(d time.Duration) {
+	h.count++
+	h.total += d
+	if d > h.max {
+		h.max = d
+	}
+	h.buckets[histogramBucket(d)]++
 }
 
-func (s *executionStat) calculate() {
-	if s.executionsCounter > 0 {
-		s.avgExecutionTime = (s.totalExecutionTime / float64(s.executionsCounter))
+// histogramBucket returns the bucket counting d: bucket 0 holds durations
+// under 1µs, and bucket i those under 1µs * 2^(i/8).
+func histogramBucket(d time.Duration) int {
+	if d < time.Microsecond {
+		return 0
+	}
+	i := int(math.Log2(float64(d)/float64(time.Microsecond))*histogramBucketsPerDoubling) + 1
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
 	}
-	if s.dataReceivedCounter > 0 {
-		s.avgBytesReceived = (s.totalBytesReceived / s.dataReceivedCounter)
+	return i
+}
+
+// percentile estimates the duration below which the fraction p of the
+// durations fall, as the upper bound of its bucket (or the max, if lower).
+func (h *durationHistogram) percentile(p float64) time.Duration {
+	rank := int(p*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
 	}
-	if s.dataSentCounter > 0 {
-		s.avgBytesSent = (s.totalBytesSent / s.dataSentCounter)
+	seen := 0
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			upper := time.Duration(float64(time.Microsecond) * math.Exp2(float64(i)/histogramBucketsPerDoubling))
+			if upper > h.max || i == histogramBuckets-1 {
+				return h.max
+			}
+			return upper
+		}
 	}
+	return h.max
 }
@@ -0,0 +1,4 @@
+// Package metrics exports the stats gathered by ratchet Pipelines (see
+// ratchet.Pipeline.StatsReport) to monitoring systems, so long-running
+// ratchet services can be observed with standard tooling.
+package metrics
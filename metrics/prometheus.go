@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var stageLabels = []string{"pipeline", "stage", "processor"}
+
+var (
+	pipelineRunningDesc = prometheus.NewDesc("ratchet_pipeline_running",
+		"Whether the pipeline is currently running (1) or finished (0).",
+		[]string{"pipeline"}, nil)
+	pipelineDurationDesc = prometheus.NewDesc("ratchet_pipeline_duration_seconds",
+		"How long the pipeline has been running, or ran for.",
+		[]string{"pipeline"}, nil)
+	payloadsReceivedDesc = prometheus.NewDesc("ratchet_stage_payloads_received_total",
+		"Number of data payloads received by the processor.", stageLabels, nil)
+	payloadsSentDesc = prometheus.NewDesc("ratchet_stage_payloads_sent_total",
+		"Number of data payloads sent by the processor.", stageLabels, nil)
+	bytesReceivedDesc = prometheus.NewDesc("ratchet_stage_bytes_received_total",
+		"Number of bytes received by the processor.", stageLabels, nil)
+	bytesSentDesc = prometheus.NewDesc("ratchet_stage_bytes_sent_total",
+		"Number of bytes sent by the processor.", stageLabels, nil)
+	errorsDesc = prometheus.NewDesc("ratchet_stage_errors_total",
+		"Number of errors sent by the processor.", stageLabels, nil)
+	inFlightDesc = prometheus.NewDesc("ratchet_stage_inflight",
+		"Number of ProcessData calls currently running.", stageLabels, nil)
+	executionDesc = prometheus.NewDesc("ratchet_stage_execution_seconds",
+		"Time spent in each ProcessData call (i.e. per batch).", stageLabels, nil)
+	queueWaitDesc = prometheus.NewDesc("ratchet_stage_queue_wait_seconds",
+		"Time payloads spent waiting to be received by the processor.", stageLabels, nil)
+	processorCounterDesc = prometheus.NewDesc("ratchet_stage_counter_total",
+		"Counters reported by the processor (see ratchet.CounterSource).",
+		[]string{"pipeline", "stage", "processor", "counter"}, nil)
+)
+
+// PrometheusCollector is a prometheus.Collector that reports the stats of
+// one or more Pipelines. Stats are read from each Pipeline when scraped,
+// so a Pipeline can be added before or while it runs.
+//
+// Since Pipelines are labelled by Name, give each Pipeline a unique Name.
+// Adding a Pipeline with the same Name as an earlier one replaces it, which
+// suits services that run the same Pipeline repeatedly.
+type PrometheusCollector struct {
+	pipelines []*ratchet.Pipeline
+	mutex     sync.Mutex
+}
+
+// NewPrometheusCollector returns a new PrometheusCollector reporting
+// on the given Pipelines.
+func NewPrometheusCollector(pipelines ...*ratchet.Pipeline) *PrometheusCollector {
+	c := &PrometheusCollector{}
+	for _, p := range pipelines {
+		c.Add(p)
+	}
+	return c
+}
+
+// Add starts reporting on the given Pipeline.
+func (c *PrometheusCollector) Add(p *ratchet.Pipeline) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, existing := range c.pipelines {
+		if existing.Name == p.Name {
+			c.pipelines[i] = p
+			return
+		}
+	}
+	c.pipelines = append(c.pipelines, p)
+}
+
+// Describe implements prometheus.Collector.
+func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		pipelineRunningDesc, pipelineDurationDesc,
+		payloadsReceivedDesc, payloadsSentDesc, bytesReceivedDesc, bytesSentDesc,
+		errorsDesc, inFlightDesc, executionDesc, queueWaitDesc, processorCounterDesc,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	pipelines := make([]*ratchet.Pipeline, len(c.pipelines))
+	copy(pipelines, c.pipelines)
+	c.mutex.Unlock()
+
+	for _, p := range pipelines {
+		stats := p.StatsReport()
+		running := 0.0
+		if stats.Running {
+			running = 1
+		}
+		ch <- prometheus.MustNewConstMetric(pipelineRunningDesc, prometheus.GaugeValue, running, stats.Name)
+		ch <- prometheus.MustNewConstMetric(pipelineDurationDesc, prometheus.GaugeValue, stats.Duration.Seconds(), stats.Name)
+
+		for _, stage := range stats.Stages {
+			for _, ps := range stage.Processors {
+				labels := []string{stats.Name, strconv.Itoa(stage.Stage), ps.Processor}
+				counter := func(desc *prometheus.Desc, v int) {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v), labels...)
+				}
+				counter(payloadsReceivedDesc, ps.PayloadsReceived)
+				counter(payloadsSentDesc, ps.PayloadsSent)
+				counter(bytesReceivedDesc, ps.BytesReceived)
+				counter(bytesSentDesc, ps.BytesSent)
+				counter(errorsDesc, ps.Errors)
+				ch <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(ps.InFlight), labels...)
+				ch <- durationSummary(executionDesc, ps.ExecutionTime, ps.TotalExecutionTime.Seconds(), labels)
+				ch <- durationSummary(queueWaitDesc, ps.QueueWait, ps.TotalQueueWait.Seconds(), labels)
+				for name, v := range ps.Counters {
+					ch <- prometheus.MustNewConstMetric(processorCounterDesc, prometheus.CounterValue, float64(v), append(labels, name)...)
+				}
+			}
+		}
+	}
+}
+
+func durationSummary(desc *prometheus.Desc, s ratchet.DurationSummary, sum float64, labels []string) prometheus.Metric {
+	quantiles := map[float64]float64{}
+	if s.Count > 0 {
+		quantiles[0.5] = s.P50.Seconds()
+		quantiles[0.9] = s.P90.Seconds()
+		quantiles[0.99] = s.P99.Seconds()
+	}
+	return prometheus.MustNewConstSummary(desc, uint64(s.Count), sum, quantiles, labels...)
+}
+
+// PrometheusHandler returns an http.Handler serving the metrics for the
+// given PrometheusCollector in the Prometheus exposition format, e.g.
+//
+//	collector := metrics.NewPrometheusCollector(pipeline)
+//	http.Handle("/metrics", metrics.PrometheusHandler(collector))
+//	go http.ListenAndServe(":9090", nil)
+//
+// Only the collector's metrics are served. To include them alongside other
+// metrics, register the collector with your own prometheus.Registerer
+// instead.
+func PrometheusHandler(c *PrometheusCollector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// StatsEmitter is a minimal interface for pushing metrics to a stats
+// backend. See StatsDEmitter and NewStatsObserver.
+type StatsEmitter interface {
+	Count(name string, value int64, tags map[string]string)
+	Gauge(name string, value float64, tags map[string]string)
+	Timing(name string, value time.Duration, tags map[string]string)
+}
+
+// StatsDTagFormat controls how tags are added to StatsD metrics, since
+// plain StatsD doesn't support tags.
+type StatsDTagFormat int
+
+const (
+	// TagsDatadog appends tags in the DogStatsD format: name:1|c|#k:v,k2:v2
+	TagsDatadog StatsDTagFormat = iota
+	// TagsTelegraf adds tags to the name in the Telegraf (InfluxDB) format:
+	// name,k=v,k2=v2:1|c
+	TagsTelegraf
+	// TagsNone drops tags.
+	TagsNone
+)
+
+// StatsDEmitter is a StatsEmitter that sends metrics over UDP to a StatsD
+// server, such as the Datadog agent or Telegraf. Each metric is sent as
+// soon as it's emitted, and send errors are logged rather than returned,
+// so a missing stats server never affects a Pipeline.
+type StatsDEmitter struct {
+	Prefix    string // Added to the start of every metric name, e.g. "etl."
+	TagFormat StatsDTagFormat
+	Tags      map[string]string // Added to every metric
+	conn      net.Conn
+	mutex     sync.Mutex
+}
+
+// NewStatsDEmitter returns a new StatsDEmitter sending to the given address,
+// e.g. "localhost:8125".
+func NewStatsDEmitter(addr string) (*StatsDEmitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsDEmitter{conn: conn, TagFormat: TagsDatadog}, nil
+}
+
+// Count sends a counter.
+func (s *StatsDEmitter) Count(name string, value int64, tags map[string]string) {
+	s.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Gauge sends a gauge.
+func (s *StatsDEmitter) Gauge(name string, value float64, tags map[string]string) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Timing sends a timer, in milliseconds.
+func (s *StatsDEmitter) Timing(name string, value time.Duration, tags map[string]string) {
+	ms := float64(value) / float64(time.Millisecond)
+	s.send(name, strconv.FormatFloat(ms, 'f', -1, 64), "ms", tags)
+}
+
+// Close closes the connection to the StatsD server.
+func (s *StatsDEmitter) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsDEmitter) send(name, value, metricType string, tags map[string]string) {
+	line := s.format(name, value, metricType, tags)
+	s.mutex.Lock()
+	_, err := s.conn.Write([]byte(line))
+	s.mutex.Unlock()
+	if err != nil {
+		logger.Debug("StatsDEmitter: unable to send metric -", err)
+	}
+}
+
+func (s *StatsDEmitter) format(name, value, metricType string, tags map[string]string) string {
+	name = s.Prefix + name
+	var pairs []string
+	if s.TagFormat != TagsNone {
+		all := make(map[string]string, len(s.Tags)+len(tags))
+		for k, v := range s.Tags {
+			all[k] = v
+		}
+		for k, v := range tags {
+			all[k] = v
+		}
+		sep := ":"
+		if s.TagFormat == TagsTelegraf {
+			sep = "="
+		}
+		for k, v := range all {
+			pairs = append(pairs, sanitizeStatsD(k)+sep+sanitizeStatsD(v))
+		}
+		sort.Strings(pairs)
+	}
+	switch {
+	case len(pairs) == 0:
+		return fmt.Sprintf("%s:%s|%s", name, value, metricType)
+	case s.TagFormat == TagsTelegraf:
+		return fmt.Sprintf("%s,%s:%s|%s", name, strings.Join(pairs, ","), value, metricType)
+	default:
+		return fmt.Sprintf("%s:%s|%s|#%s", name, value, metricType, strings.Join(pairs, ","))
+	}
+}
+
+// sanitizeStatsD replaces characters that have a meaning in the StatsD
+// line formats.
+var statsDReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "=", "_", "#", "_", " ", "_", "\n", "_")
+
+func sanitizeStatsD(s string) string {
+	return statsDReplacer.Replace(s)
+}
+
+// StatsObserver is a ratchet.Observer that pushes Pipeline metrics to a
+// StatsEmitter. Metrics are tagged with "pipeline", and where relevant
+// "stage" and "processor":
+//
+//	ratchet.records            count of records processed
+//	ratchet.bytes              count of bytes processed
+//	ratchet.batches            count of ProcessData calls
+//	ratchet.batch.duration     timing of each ProcessData call
+//	ratchet.errors             count of errors sent by DataProcessors
+//	ratchet.stage.duration     timing of each DataProcessor, from start to Finish
+//	ratchet.pipeline.runs      count of finished runs, tagged with "status" (ok or error)
+//	ratchet.pipeline.duration  timing of each Pipeline run
+type StatsObserver struct {
+	Emitter StatsEmitter
+	started map[interface{}]time.Time
+	mutex   sync.Mutex
+}
+
+// NewStatsObserver returns a new StatsObserver sending to the given
+// StatsEmitter.
+func NewStatsObserver(e StatsEmitter) *StatsObserver {
+	return &StatsObserver{Emitter: e, started: make(map[interface{}]time.Time)}
+}
+
+type stageKey struct {
+	p    *ratchet.Pipeline
+	info ratchet.ProcessorInfo
+}
+
+// PipelineStarted - see ratchet.Observer.
+func (o *StatsObserver) PipelineStarted(ctx context.Context, p *ratchet.Pipeline) {
+	o.start(p)
+}
+
+// PipelineFinished - see ratchet.Observer.
+func (o *StatsObserver) PipelineFinished(p *ratchet.Pipeline, err error) {
+	tags := map[string]string{"pipeline": p.Name, "status": "ok"}
+	if err != nil {
+		tags["status"] = "error"
+	}
+	o.Emitter.Count("ratchet.pipeline.runs", 1, tags)
+	if d, ok := o.finish(p); ok {
+		o.Emitter.Timing("ratchet.pipeline.duration", d, tags)
+	}
+}
+
+// StageStarted - see ratchet.Observer.
+func (o *StatsObserver) StageStarted(p *ratchet.Pipeline, info ratchet.ProcessorInfo) {
+	o.start(stageKey{p, info})
+}
+
+// StageFinished - see ratchet.Observer.
+func (o *StatsObserver) StageFinished(p *ratchet.Pipeline, info ratchet.ProcessorInfo) {
+	if d, ok := o.finish(stageKey{p, info}); ok {
+		o.Emitter.Timing("ratchet.stage.duration", d, stageTags(p, info))
+	}
+}
+
+// BatchProcessed - see ratchet.Observer.
+func (o *StatsObserver) BatchProcessed(p *ratchet.Pipeline, batch ratchet.BatchInfo) {
+	tags := stageTags(p, batch.ProcessorInfo)
+	o.Emitter.Count("ratchet.records", int64(batch.Records), tags)
+	o.Emitter.Count("ratchet.bytes", int64(batch.Bytes), tags)
+	o.Emitter.Count("ratchet.batches", 1, tags)
+	o.Emitter.Timing("ratchet.batch.duration", batch.Duration, tags)
+}
+
+// ErrorSent - see ratchet.Observer.
+func (o *StatsObserver) ErrorSent(p *ratchet.Pipeline, info ratchet.ProcessorInfo, err error) {
+	o.Emitter.Count("ratchet.errors", 1, stageTags(p, info))
+}
+
+func (o *StatsObserver) start(key interface{}) {
+	o.mutex.Lock()
+	o.started[key] = time.Now()
+	o.mutex.Unlock()
+}
+
+func (o *StatsObserver) finish(key interface{}) (time.Duration, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	start, ok := o.started[key]
+	delete(o.started, key)
+	return time.Since(start), ok
+}
+
+func stageTags(p *ratchet.Pipeline, info ratchet.ProcessorInfo) map[string]string {
+	return map[string]string{
+		"pipeline":  p.Name,
+		"stage":     strconv.Itoa(info.Stage),
+		"processor": info.Processor,
+	}
+}
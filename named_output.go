@@ -0,0 +1,69 @@
+package ratchet
+
+import (
+	"sync"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// NamedOutput is a DataProcessor that makes the data it receives available
+// to the code running the Pipeline, rather than writing it somewhere.
+// A Pipeline can have several NamedOutputs (e.g. "facts", "rejects" and
+// "summary"), typically in its final PipelineStage, and each one can be
+// consumed as a separate channel after calling Run. See Pipeline.Output.
+//
+// Every NamedOutput channel must be read until it is closed (or the
+// Pipeline will block once the channel's buffer is full). The channel is
+// closed when the NamedOutput's input is finished.
+type NamedOutput struct {
+	Name      string
+	c         chan data.JSON
+	closeOnce sync.Once
+}
+
+// NewNamedOutput returns a new NamedOutput with the given name, whose
+// channel holds up to bufferLength payloads.
+func NewNamedOutput(name string, bufferLength int) *NamedOutput {
+	return &NamedOutput{Name: name, c: make(chan data.JSON, bufferLength)}
+}
+
+// ProcessData sends the data to the output channel
+func (o *NamedOutput) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	o.c <- d
+}
+
+// Finish closes the output channel
+func (o *NamedOutput) Finish(outputChan chan data.JSON, killChan chan error) {
+	o.closeOnce.Do(func() {
+		close(o.c)
+	})
+}
+
+// Chan returns the output channel.
+func (o *NamedOutput) Chan() <-chan data.JSON {
+	return o.c
+}
+
+func (o *NamedOutput) String() string {
+	return "NamedOutput(" + o.Name + ")"
+}
+
+// Output returns the channel of the NamedOutput with the given name, or nil
+// if the Pipeline has no such output.
+func (p *Pipeline) Output(name string) <-chan data.JSON {
+	return p.Outputs()[name]
+}
+
+// Outputs returns the channels of all the NamedOutputs in the Pipeline,
+// keyed by name.
+func (p *Pipeline) Outputs() map[string]<-chan data.JSON {
+	outputs := make(map[string]<-chan data.JSON)
+	for _, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			if o, ok := dp.DataProcessor.(*NamedOutput); ok {
+				outputs[o.Name] = o.Chan()
+			}
+		}
+	}
+	return outputs
+}
@@ -0,0 +1,169 @@
+package ratchet
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// Observer receives events as a Pipeline runs, for instrumentation such as
+// tracing, metrics or progress reporting. Add Observers with
+// Pipeline.AddObserver before calling Run.
+//
+// Observer methods are called synchronously from the goroutines running
+// the Pipeline, so they should return quickly. Embed NopObserver to only
+// implement the events you're interested in.
+type Observer interface {
+	// PipelineStarted is called when Run is called, with the context given
+	// to RunContext.
+	PipelineStarted(ctx context.Context, p *Pipeline)
+	// PipelineFinished is called once per run, either with nil when all
+	// stages have finished, or with the first error sent to the killChan.
+	PipelineFinished(p *Pipeline, err error)
+	// StageStarted is called when a DataProcessor's goroutine starts,
+	// before it has received any data.
+	StageStarted(p *Pipeline, info ProcessorInfo)
+	// StageFinished is called after a DataProcessor's Finish returns.
+	StageFinished(p *Pipeline, info ProcessorInfo)
+	// BatchProcessed is called after each ProcessData call.
+	BatchProcessed(p *Pipeline, batch BatchInfo)
+	// ErrorSent is called for each error a DataProcessor sends.
+	ErrorSent(p *Pipeline, info ProcessorInfo, err error)
+}
+
+// ProcessorInfo identifies a DataProcessor within a Pipeline.
+type ProcessorInfo struct {
+	Stage     int    // Starting at 1
+	Index     int    // Position within the stage, starting at 0
+	Processor string // String() of the DataProcessor
+}
+
+// BatchInfo describes a single ProcessData call.
+type BatchInfo struct {
+	ProcessorInfo
+	Start    time.Time
+	Duration time.Duration
+	Bytes    int
+	// Records is the number of elements if the data received was a JSON
+	// array, otherwise 1.
+	Records int
+}
+
+// NopObserver implements Observer by doing nothing. It can be embedded in
+// Observer implementations that only need some of the events.
+type NopObserver struct{}
+
+// PipelineStarted - see Observer.
+func (NopObserver) PipelineStarted(ctx context.Context, p *Pipeline) {}
+
+// PipelineFinished - see Observer.
+func (NopObserver) PipelineFinished(p *Pipeline, err error) {}
+
+// StageStarted - see Observer.
+func (NopObserver) StageStarted(p *Pipeline, info ProcessorInfo) {}
+
+// StageFinished - see Observer.
+func (NopObserver) StageFinished(p *Pipeline, info ProcessorInfo) {}
+
+// BatchProcessed - see Observer.
+func (NopObserver) BatchProcessed(p *Pipeline, batch BatchInfo) {}
+
+// ErrorSent - see Observer.
+func (NopObserver) ErrorSent(p *Pipeline, info ProcessorInfo, err error) {}
+
+// AddObserver registers an Observer to receive events from the Pipeline.
+func (p *Pipeline) AddObserver(o Observer) {
+	p.observers = append(p.observers, o)
+}
+
+// observed runs a ProcessData call, notifying Observers about it.
+func (p *Pipeline) observed(info ProcessorInfo, d data.JSON, process func()) {
+	if len(p.observers) == 0 {
+		process()
+		return
+	}
+	start := time.Now()
+	process()
+	batch := BatchInfo{
+		ProcessorInfo: info,
+		Start:         start,
+		Duration:      time.Since(start),
+		Bytes:         len(d),
+		Records:       countRecords(d),
+	}
+	for _, o := range p.observers {
+		o.BatchProcessed(p, batch)
+	}
+}
+
+func (p *Pipeline) notifyStageStarted(info ProcessorInfo) {
+	for _, o := range p.observers {
+		o.StageStarted(p, info)
+	}
+}
+
+func (p *Pipeline) notifyStageFinished(info ProcessorInfo) {
+	for _, o := range p.observers {
+		o.StageFinished(p, info)
+	}
+}
+
+func (p *Pipeline) notifyErrorSent(info ProcessorInfo, err error) {
+	for _, o := range p.observers {
+		o.ErrorSent(p, info, err)
+	}
+}
+
+// notifyFinished calls PipelineFinished on the Observers. It's called
+// once for each run, see runResult.
+func (p *Pipeline) notifyFinished(err error) {
+	p.finishRun(err)
+	for _, o := range p.observers {
+		o.PipelineFinished(p, err)
+	}
+}
+
+// countRecords returns the number of elements if d is a JSON array,
+// otherwise 1. Since it's called for every payload, the array isn't
+// decoded: only the commas between its elements are counted.
+func countRecords(d data.JSON) int {
+	trimmed := bytes.TrimSpace(d)
+	if len(trimmed) < 2 || trimmed[0] != '[' || trimmed[len(trimmed)-1] != ']' {
+		return 1
+	}
+	elements := bytes.TrimSpace(trimmed[1 : len(trimmed)-1])
+	if len(elements) == 0 {
+		return 0
+	}
+	n, depth := 1, 0
+	inString, escaped := false, false
+	for _, c := range elements {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			n++
+		}
+	}
+	return n
+}
+
+// processorInfo returns the ProcessorInfo for the dataProcessor at the
+// given position.
+func processorInfo(stage, index int, dp *dataProcessor) ProcessorInfo {
+	return ProcessorInfo{Stage: stage + 1, Index: index, Processor: dp.String()}
+}
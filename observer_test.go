@@ -0,0 +1,83 @@
+package ratchet_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// sender sends its payloads.
+type sender []string
+
+func (s sender) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	for _, p := range s {
+		outputChan <- data.JSON(p)
+	}
+}
+
+func (s sender) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// discard drops its data.
+type discard struct{}
+
+func (discard) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {}
+
+func (discard) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// batchRecorder records the records counted in stage 2, and how many
+// times PipelineFinished is called.
+type batchRecorder struct {
+	ratchet.NopObserver
+	records  []int
+	finished int
+	sync.Mutex
+}
+
+func (r *batchRecorder) BatchProcessed(p *ratchet.Pipeline, batch ratchet.BatchInfo) {
+	r.Lock()
+	defer r.Unlock()
+	if batch.Stage == 2 {
+		r.records = append(r.records, batch.Records)
+	}
+}
+
+func (r *batchRecorder) PipelineFinished(p *ratchet.Pipeline, err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.finished++
+}
+
+func TestBatchInfoRecords(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		payload string
+		records int
+	}{
+		{`{"a":1}`, 1},
+		{`"GO"`, 1},
+		{`[]`, 0},
+		{` [ ] `, 0},
+		{`[{"a":1}]`, 1},
+		{`[{"a":"x,y"},{"b":[1,2,{"c":3}]}]`, 2},
+		{`[1, "a\",]", null]`, 3},
+		{`[{"a":1},`, 1}, // Invalid
+	}
+	for _, test := range tests {
+		r := &batchRecorder{}
+		p := ratchet.NewPipeline(sender{test.payload}, discard{})
+		p.AddObserver(r)
+		if err := <-p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.records) != 1 || r.records[0] != test.records {
+			t.Errorf("%s: got records %v, want %d", test.payload, r.records, test.records)
+		}
+		if r.finished != 1 {
+			t.Errorf("%s: PipelineFinished called %d times, want 1", test.payload, r.finished)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package ratchet
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// PartitionBy makes a ConcurrentDataProcessor process records with the same
+// value for field (a dotted path, see util.LookupField) one at a time and in
+// the order received, while records with different values are still
+// processed concurrently. Each value is hashed to one of Concurrency()
+// workers, and a payload with records for several workers (a JSON array) is
+// split between them, each getting an array of its records, in order.
+//
+// This is what applying changes (e.g. from a DebeziumDecoder) or enriching
+// records with state per key needs: changes to the same row can't be
+// applied out of order. Records without the field, and payloads that
+// aren't JSON objects, all go to the same worker. Output is sent as each
+// worker produces it, as with UnorderedOutput. It has no effect on other
+// DataProcessors, whose calls are made one at a time.
+func (dp *dataProcessor) PartitionBy(field string) *dataProcessor {
+	dp.partitionBy = field
+	return dp
+}
+
+// partitionData hands d to the workers of the records it holds, for call to
+// process. Each worker runs its ProcessData calls one at a time.
+func (dp *dataProcessor) partitionData(d data.JSON, call func(d data.JSON, outputChan chan data.JSON, killChan chan error)) {
+	if dp.partitions == nil {
+		dp.startPartitions()
+	}
+	for i, pd := range dp.partition(d) {
+		if pd == nil {
+			continue
+		}
+		pd := pd
+		dp.partitions[i] <- func() {
+			killChan, flush := dp.errors.callKillChan(pd)
+			dp.recordExecution(func() {
+				call(pd, dp.outputChan, killChan)
+			})
+			flush()
+		}
+	}
+}
+
+// startPartitions starts a worker for each partition.
+func (dp *dataProcessor) startPartitions() {
+	dp.partitions = make([]chan func(), dp.concurrency)
+	for i := range dp.partitions {
+		work := make(chan func())
+		dp.partitions[i] = work
+		dp.working.Add(1)
+		go func() {
+			defer dp.working.Done()
+			for process := range work {
+				process()
+			}
+		}()
+	}
+}
+
+// stopPartitions stops the workers once they've processed the data handed
+// to them.
+func (dp *dataProcessor) stopPartitions() {
+	for _, work := range dp.partitions {
+		close(work)
+	}
+	dp.partitions = nil
+}
+
+// partition splits d into the payloads for each worker, which are nil for
+// workers with no records. d is kept as it is if it all goes to one worker.
+func (dp *dataProcessor) partition(d data.JSON) []data.JSON {
+	payloads := make([]data.JSON, dp.concurrency)
+	trimmed := bytes.TrimSpace(d)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		payloads[dp.partitionOf(d)] = d
+		return payloads
+	}
+	var records []json.RawMessage
+	if err := json.Unmarshal(d, &records); err != nil {
+		logger.Debug("dataProcessor: partition", dp, "received invalid JSON:", err)
+		payloads[dp.partitionOf(d)] = d
+		return payloads
+	}
+	workers := make([][]json.RawMessage, dp.concurrency)
+	used := 0
+	for _, r := range records {
+		i := dp.partitionOf(r)
+		if workers[i] == nil {
+			used++
+		}
+		workers[i] = append(workers[i], r)
+	}
+	if used == 0 {
+		// An empty array, which goes to a worker like any other payload
+		// without the field.
+		payloads[dp.partitionOf(d)] = d
+		return payloads
+	}
+	if used == 1 {
+		for i := range workers {
+			if workers[i] != nil {
+				payloads[i] = d
+			}
+		}
+		return payloads
+	}
+	for i, w := range workers {
+		if w == nil {
+			continue
+		}
+		pd, err := data.NewJSON(w)
+		if err != nil {
+			// Can't happen, since the records are valid JSON.
+			pd = d
+		}
+		payloads[i] = pd
+	}
+	return payloads
+}
+
+// partitionOf returns the worker for a record.
+func (dp *dataProcessor) partitionOf(record []byte) int {
+	var object map[string]interface{}
+	var key interface{}
+	if data.ParseJSONSilent(record, &object) == nil && object != nil {
+		key, _ = util.LookupField(object, dp.partitionBy)
+	}
+	b, _ := json.Marshal(key)
+	h := fnv.New32a()
+	h.Write(b)
+	return int(h.Sum32() % uint32(dp.concurrency))
+}
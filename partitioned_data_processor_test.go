@@ -0,0 +1,151 @@
+package ratchet_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// keyRecorder records the payloads it receives, and the n of the records
+// with each key in the order they're processed. It fails if records with
+// the same key are processed at once.
+type keyRecorder struct {
+	payloads []string
+	ns       map[string][]int
+	running  map[string]int
+	overlap  bool
+	sync.Mutex
+}
+
+type keyed struct {
+	Key string `json:"key"`
+	N   int    `json:"n"`
+}
+
+func (r *keyRecorder) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	var records []keyed
+	if json.Unmarshal(d, &records) != nil {
+		var record keyed
+		if json.Unmarshal(d, &record) == nil {
+			records = []keyed{record}
+		}
+	}
+	r.Lock()
+	r.payloads = append(r.payloads, string(d))
+	for _, record := range records {
+		if r.running[record.Key] > 0 {
+			r.overlap = true
+		}
+		r.running[record.Key]++
+	}
+	r.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	r.Lock()
+	for _, record := range records {
+		r.running[record.Key]--
+		r.ns[record.Key] = append(r.ns[record.Key], record.N)
+	}
+	r.Unlock()
+}
+
+func (r *keyRecorder) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func (r *keyRecorder) Concurrency() int {
+	return 4
+}
+
+func runPartitioned(t *testing.T, payloads ...string) *keyRecorder {
+	t.Helper()
+	r := &keyRecorder{ns: map[string][]int{}, running: map[string]int{}}
+	p := ratchet.NewPipeline(sender(payloads), r)
+	if err := p.SetStagePartitionBy(2, "key"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-p.Run():
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish")
+	}
+	return r
+}
+
+func TestPartitionBySameKey(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	var payloads []string
+	want := map[string][]int{}
+	for n := 1; n <= 30; n++ {
+		key := fmt.Sprint("k", n%5)
+		payloads = append(payloads, fmt.Sprintf(`{"key":%q,"n":%d}`, key, n))
+		want[key] = append(want[key], n)
+	}
+	r := runPartitioned(t, payloads...)
+	if r.overlap {
+		t.Error("records with the same key were processed at once")
+	}
+	if !reflect.DeepEqual(r.ns, want) {
+		t.Errorf("got %v, want %v", r.ns, want)
+	}
+}
+
+func TestPartitionByPayloads(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name    string
+		payload string
+		want    []string
+	}{
+		// k1 and k2 go to different workers.
+		{"split", `[{"key":"k1","n":1},{"key":"k2","n":2},{"key":"k1","n":3}]`,
+			[]string{`[{"key":"k1","n":1},{"key":"k1","n":3}]`, `[{"key":"k2","n":2}]`}},
+		{"one worker", `[{"key":"k1","n":1},{"key":"k1","n":2}]`,
+			[]string{`[{"key":"k1","n":1},{"key":"k1","n":2}]`}},
+		{"empty array", `[]`, []string{`[]`}},
+		{"object", `{"key":"k1","n":1}`, []string{`{"key":"k1","n":1}`}},
+		{"not an object", `"k1"`, []string{`"k1"`}},
+		{"invalid JSON", `[{"key":"k1",`, []string{`[{"key":"k1",`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := runPartitioned(t, test.payload)
+			sort.Strings(r.payloads)
+			if !reflect.DeepEqual(r.payloads, test.want) {
+				t.Errorf("got %v, want %v", r.payloads, test.want)
+			}
+		})
+	}
+}
+
+func TestPartitionByLateError(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	p := ratchet.NewPipeline(sender{`{"key":"k1"}`, `{"key":"k2"}`}, &lateFailer{})
+	if err := p.SetStagePartitionBy(2, "key"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-p.Run():
+		var pe *ratchet.PipelineError
+		if !errors.As(err, &pe) || pe.Err.Error() != "flush failed" || pe.Stage != 2 {
+			t.Fatalf("got %v, want the flush error from stage 2", err)
+		}
+		if string(pe.Record) != `{"key":"k1"}` && string(pe.Record) != `{"key":"k2"}` {
+			t.Errorf("got record %q, want the data of the call that failed", pe.Record)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish")
+	}
+}
@@ -1,11 +1,13 @@
 package ratchet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"sync"
+	"time"
 
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
@@ -20,10 +22,54 @@ var StartSignal = "GO"
 type Pipeline struct {
 	layout       *PipelineLayout
 	Name         string // Name is simply for display purpsoses in log output.
-	BufferLength int    // Set to control channel buffering, default is 8.
+	BufferLength int    // Set to control channel buffering between stages, default is 0. See PipelineStage.WithBufferLength.
 	PrintData    bool   // Set to true to log full data payloads (only in Debug logging mode).
-	timer        *util.Timer
-	wg           sync.WaitGroup
+	// MaxErrorRecordLength truncates the Record in a PipelineError to this
+	// many bytes. Zero means records are never truncated.
+	MaxErrorRecordLength int
+	// LegacyErrors disables wrapping errors in a PipelineError, so that
+	// errors are sent on the killChan exactly as DataProcessors sent them.
+	LegacyErrors bool
+	// Unbuffered forces every channel between stages to be unbuffered,
+	// ignoring BufferLength and any PipelineStage buffer lengths. Each
+	// stage can then only get about one payload ahead of the next, so a
+	// fast reader can't build up memory ahead of a slow writer.
+	Unbuffered bool
+	// ProgressInterval is how often OnProgress callbacks are called,
+	// default is 1 second.
+	ProgressInterval time.Duration
+	// DryRun replaces the DataProcessors in the final PipelineStage (except
+	// NamedOutputs) with recorders, so readers and transforms run as normal
+	// but nothing is written. Writers that implement DryRunner report the
+	// writes they would have made, e.g. the generated SQL. See
+	// DryRunResults.
+	DryRun bool
+	// DryRunSampleSize limits how many payloads and statements are kept
+	// by each recorder, default is 10.
+	DryRunSampleSize int
+	// StageTimeout stops the Pipeline, with a StallError, when a
+	// DataProcessor makes no progress for this long: a ProcessData or
+	// Finish call neither returns nor sends data on in time (waiting for
+	// the next stage to take data doesn't count). Zero means no timeout.
+	// It can be overridden for each stage, see PipelineStage.WithTimeout,
+	// e.g. for readers that wait for new data indefinitely.
+	StageTimeout time.Duration
+	timeout      time.Duration // Set by RunWithTimeout
+	// RunStore, if set, keeps a record of every run, so that failed runs
+	// can be re-run with Rerun.
+	RunStore RunStore
+	// MaxConcurrency caps the number of concurrent ProcessData calls of
+	// every ConcurrentDataProcessor, e.g. to fit a smaller machine or a
+	// database's connection limit. Zero means no cap. See also
+	// PipelineStage.WithConcurrency.
+	MaxConcurrency int
+	run            Run
+	rerun          *Run // Set by Rerun
+	dryRuns        []*dryRunRecorder
+	timer          *util.Timer
+	wg             sync.WaitGroup
+	observers      []Observer
+	failed         int32 // Set when any error is sent, see commit
 }
 
 // NewPipeline creates a new pipeline ready to run the given DataProcessors.
@@ -79,17 +125,19 @@ func (p *Pipeline) connectStages() {
 	logger.Debug(p.Name, ": connecting stages")
 	// First, setup the bridgeing channels & brancher/merger's to aid in
 	// managing channel communication between processors.
-	for _, stage := range p.layout.stages {
+	for n, stage := range p.layout.stages {
 		for _, from := range stage.processors {
 			if from.outputs != nil {
-				from.branchOutChans = []chan data.JSON{}
+				from.branchOutChans = []chan queuedData{}
 				for _, to := range p.dataProcessorOutputs(from) {
 					if to.mergeInChans == nil {
-						to.mergeInChans = []chan data.JSON{}
+						to.mergeInChans = []chan queuedData{}
 					}
-					c := p.initDataChan()
+					// Outputs always point to the next stage.
+					c := make(chan queuedData, p.stageBufferLength(n+1))
 					from.branchOutChans = append(from.branchOutChans, c)
 					to.mergeInChans = append(to.mergeInChans, c)
+					to.mergeInSources = append(to.mergeInSources, from.DataProcessor)
 				}
 			}
 		}
@@ -108,25 +156,47 @@ func (p *Pipeline) connectStages() {
 	}
 }
 
-func (p *Pipeline) runStages(killChan chan error) {
+func (p *Pipeline) runStages(ctx context.Context, result *runResult) {
 	for n, stage := range p.layout.stages {
-		for _, dp := range stage.processors {
+		for i, dp := range stage.processors {
+			info := processorInfo(n, i, dp)
+			dp.errors = p.wrapErrors(info, dp, result)
+			dp.ctx = ctx
 			p.wg.Add(1)
 			// Each DataProcessor runs in a separate gorountine.
 			go func(n int, dp *dataProcessor) {
 				// This is where the main DataProcessor interface
 				// functions are called.
+				p.notifyStageStarted(info)
 				logger.Info(p.Name, "- stage", n+1, dp, "waiting to receive data")
 				for d := range dp.inputChan {
+					if ctx.Err() != nil {
+						// Once cancelled, keep draining the input so
+						// earlier stages can finish, but skip processing.
+						continue
+					}
 					logger.Info(p.Name, "- stage", n+1, dp, "received data")
 					if p.PrintData {
 						logger.Debug(p.Name, "- stage", n+1, dp, "data =", string(d))
 					}
 					dp.recordDataReceived(d)
-					dp.processData(d, killChan)
+					dp.errors.setRecord(d)
+					dp.processData(d, func(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+						dp.activity.start("ProcessData")
+						p.observed(info, d, func() {
+							dp.callProcessData(d, outputChan, killChan)
+						})
+						dp.activity.end()
+					})
 				}
+				dp.waitForWork()
 				logger.Info(p.Name, "- stage", n+1, dp, "input closed, calling Finish")
-				dp.Finish(dp.outputChan, killChan)
+				dp.errors.setRecord(nil)
+				dp.activity.start("Finish")
+				dp.Finish(dp.outputChan, dp.errors.killChan)
+				dp.activity.end()
+				dp.activity.finish()
+				p.notifyStageFinished(info)
 				if dp.outputChan != nil {
 					logger.Info(p.Name, "- stage", n+1, dp, "closing output")
 					close(dp.outputChan)
@@ -143,17 +213,49 @@ func (p *Pipeline) runStages(killChan chan error) {
 // return prematurely. Any stage of the pipeline can send to the killChan to halt
 // execution. Your calling function should check if the sent value is an error or nil to know if
 // execution was a failure or a success (nil being the success value).
+// Errors sent by DataProcessors are received as a *PipelineError (unless
+// LegacyErrors is set). Exactly one value is sent: the first error, or nil.
+// Until the Pipeline finishes, an interrupt signal (SIGINT) cancels it, as
+// if the context given to RunContext was cancelled.
 func (p *Pipeline) Run() (killChan chan error) {
+	return p.runContext(context.Background(), true)
+}
+
+// RunContext is the same as Run, but the Pipeline is cancelled when ctx is
+// done: ctx.Err() is sent to the killChan, ContextDataProcessors see their
+// context cancelled, and no further data is processed. Interrupt signals
+// aren't handled, so that programs running many Pipelines (such as a
+// ScheduledPipeline) can decide how to handle them, e.g. with
+// signal.NotifyContext.
+func (p *Pipeline) RunContext(ctx context.Context) (killChan chan error) {
+	return p.runContext(ctx, false)
+}
+
+// runContext runs the Pipeline with ctx, handling interrupt signals if
+// interruptible is set.
+func (p *Pipeline) runContext(ctx context.Context, interruptible bool) (killChan chan error) {
 	p.timer = util.StartTimer()
-	killChan = make(chan error)
+	killChan = make(chan error, 1)
+	result := &runResult{p: p, killChan: killChan}
+	p.startRun()
+	runCtx, cancel := context.WithCancel(context.WithValue(ctx, runIDKey{}, p.run.ID))
+	finished := make(chan struct{})
 
+	for _, o := range p.observers {
+		o.PipelineStarted(ctx, p)
+	}
+	p.setConcurrency()
 	p.connectStages()
-	p.runStages(killChan)
+	if p.DryRun {
+		p.startDryRun()
+	}
+	p.runStages(runCtx, result)
+	stopWatching := p.watchStalls(cancel)
 
 	for _, dp := range p.layout.stages[0].processors {
 		logger.Debug(p.Name, ": sending", StartSignal, "to", dp)
 		dp.inputChan <- data.JSON(StartSignal)
-		dp.Finish(dp.outputChan, killChan)
+		dp.Finish(dp.outputChan, dp.errors.killChan)
 		close(dp.inputChan)
 	}
 
@@ -164,14 +266,146 @@ func (p *Pipeline) Run() (killChan chan error) {
 	go func() {
 		p.wg.Wait()
 		p.timer.Stop()
-		killChan <- nil
+		// Every error sent by the finished stages has been received, and
+		// is handled before stop returns, so commit sees whether any
+		// were sent.
+		for _, stage := range p.layout.stages {
+			for _, dp := range stage.processors {
+				dp.errors.stop()
+			}
+		}
+		var err error
+		if ctx.Err() == nil {
+			err = p.commit()
+		}
+		close(finished)
+		cancel()
+		stopWatching()
+		result.send(err)
 	}()
 
-	handleInterrupt(killChan)
+	go func() {
+		select {
+		case <-ctx.Done():
+			err := ctx.Err()
+			if err == context.DeadlineExceeded && p.timeout > 0 {
+				err = p.deadlineError()
+			}
+			result.send(err)
+		case <-finished:
+		}
+	}()
+
+	if interruptible {
+		p.handleInterrupt(cancel, result, finished)
+	}
 
 	return killChan
 }
 
+// runResult sends the result of a run on its killChan. Only the first
+// result is sent: an error sent by a DataProcessor, the run being
+// cancelled or interrupted, or the run finishing. killChan is buffered, so
+// sending never blocks, even once the caller has stopped receiving.
+type runResult struct {
+	p        *Pipeline
+	killChan chan error
+	once     sync.Once
+}
+
+func (r *runResult) send(err error) {
+	r.once.Do(func() {
+		r.p.notifyFinished(err)
+		r.killChan <- err
+	})
+}
+
+// SetStageBufferLength overrides BufferLength for the given stage (starting
+// at 1), see PipelineStage.WithBufferLength. This is mostly useful for
+// Pipelines created with NewPipeline.
+func (p *Pipeline) SetStageBufferLength(stageNum int, length int) error {
+	if stageNum < 1 || stageNum > len(p.layout.stages) {
+		return fmt.Errorf("%v has no stage %d", p.Name, stageNum)
+	}
+	p.layout.stages[stageNum-1].WithBufferLength(length)
+	return nil
+}
+
+// SetStageTimeout overrides StageTimeout for the given stage (starting at
+// 1), see PipelineStage.WithTimeout. This is mostly useful for Pipelines
+// created with NewPipeline.
+func (p *Pipeline) SetStageTimeout(stageNum int, timeout time.Duration) error {
+	if stageNum < 1 || stageNum > len(p.layout.stages) {
+		return fmt.Errorf("%v has no stage %d", p.Name, stageNum)
+	}
+	p.layout.stages[stageNum-1].WithTimeout(timeout)
+	return nil
+}
+
+// SetStageConcurrency overrides the concurrency of the
+// ConcurrentDataProcessors in the given stage (starting at 1), see
+// PipelineStage.WithConcurrency. This is mostly useful for Pipelines
+// created with NewPipeline.
+func (p *Pipeline) SetStageConcurrency(stageNum int, concurrency int) error {
+	if stageNum < 1 || stageNum > len(p.layout.stages) {
+		return fmt.Errorf("%v has no stage %d", p.Name, stageNum)
+	}
+	p.layout.stages[stageNum-1].WithConcurrency(concurrency)
+	return nil
+}
+
+// SetStageUnorderedOutput makes the ConcurrentDataProcessors in the given
+// stage (starting at 1) send their output on as soon as it's sent rather
+// than in the order their data was received, see UnorderedOutput. This is
+// mostly useful for Pipelines created with NewPipeline.
+func (p *Pipeline) SetStageUnorderedOutput(stageNum int) error {
+	if stageNum < 1 || stageNum > len(p.layout.stages) {
+		return fmt.Errorf("%v has no stage %d", p.Name, stageNum)
+	}
+	for _, dp := range p.layout.stages[stageNum-1].processors {
+		dp.UnorderedOutput()
+	}
+	return nil
+}
+
+// SetStagePartitionBy makes the ConcurrentDataProcessors in the given
+// stage (starting at 1) process the records with the same value for field
+// in order, see PartitionBy. This is mostly useful for Pipelines created
+// with NewPipeline.
+func (p *Pipeline) SetStagePartitionBy(stageNum int, field string) error {
+	if stageNum < 1 || stageNum > len(p.layout.stages) {
+		return fmt.Errorf("%v has no stage %d", p.Name, stageNum)
+	}
+	for _, dp := range p.layout.stages[stageNum-1].processors {
+		dp.PartitionBy(field)
+	}
+	return nil
+}
+
+// setConcurrency applies the stages' concurrency overrides and
+// MaxConcurrency to their DataProcessors.
+func (p *Pipeline) setConcurrency() {
+	for _, stage := range p.layout.stages {
+		for _, dp := range stage.processors {
+			if c, ok := stage.concurrencyOf(dp, p.MaxConcurrency); ok && c != dp.concurrency {
+				dp.setConcurrency(c)
+			}
+		}
+	}
+}
+
+// stageBufferLength returns the buffer length for the channels feeding
+// the stage at the given index.
+func (p *Pipeline) stageBufferLength(n int) int {
+	if p.Unbuffered {
+		return 0
+	}
+	if stage := p.layout.stages[n]; stage.hasBufferLength {
+		return stage.bufferLength
+	}
+	return p.BufferLength
+}
+
 func (p *Pipeline) initDataChans(length int) []chan data.JSON {
 	cs := make([]chan data.JSON, length)
 	for i := range cs {
@@ -192,30 +426,19 @@ func (p *Pipeline) initDataChan() chan data.JSON {
 // 	return p.Name + ": " + strings.Join(stageNames, " -> "))
 // }
 
-func handleInterrupt(killChan chan error) {
+// handleInterrupt cancels the run when the process is interrupted, until
+// the run finishes. The signal handler is then removed, so that the
+// Pipeline doesn't keep receiving signals after it's done.
+func (p *Pipeline) handleInterrupt(cancel context.CancelFunc, result *runResult, finished chan struct{}) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	go func() {
-		for range c {
-			killChan <- errors.New("Exiting due to interrupt signal.")
+		defer signal.Stop(c)
+		select {
+		case <-c:
+			cancel()
+			result.send(errors.New("Exiting due to interrupt signal."))
+		case <-finished:
 		}
 	}()
 }
-
-// Stats returns a string (formatted for output display) listing the stats
-// gathered for each stage executed.
-func (p *Pipeline) Stats() string {
-	o := fmt.Sprintf("%s: %s\r\n", p.Name, p.timer)
-	for n, stage := range p.layout.stages {
-		o += fmt.Sprintf("Stage %d)\r\n", n+1)
-		for _, dp := range stage.processors {
-			o += fmt.Sprintf("  * %v\r\n", dp)
-			dp.executionStat.calculate()
-			o += fmt.Sprintf("     - Total/Avg Execution Time = %f/%fs\r\n", dp.totalExecutionTime, dp.avgExecutionTime)
-			o += fmt.Sprintf("     - Payloads Sent/Received = %d/%d\r\n", dp.dataSentCounter, dp.dataReceivedCounter)
-			o += fmt.Sprintf("     - Total/Avg Bytes Sent = %d/%d\r\n", dp.totalBytesSent, dp.avgBytesSent)
-			o += fmt.Sprintf("     - Total/Avg Bytes Received = %d/%d\r\n", dp.totalBytesReceived, dp.avgBytesReceived)
-		}
-	}
-	return o
-}
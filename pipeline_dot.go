@@ -0,0 +1,70 @@
+package ratchet
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// DOT returns a Graphviz (https://graphviz.org) representation of the
+// PipelineLayout, with each PipelineStage drawn as a cluster of its
+// DataProcessors and an edge for each of their Outputs. The result can be
+// rendered with e.g. `dot -Tsvg`, which is useful for reviewing and
+// documenting complex branching layouts.
+func (l *PipelineLayout) DOT() string {
+	return l.dot("Pipeline", 0)
+}
+
+// Draw returns a Graphviz representation of the Pipeline's layout, labelled
+// with the Pipeline's Name. See PipelineLayout.DOT.
+func (p *Pipeline) Draw() string {
+	return p.layout.dot(p.Name, p.MaxConcurrency)
+}
+
+// dot returns the graph, with the DataProcessors' concurrency capped at
+// maxConcurrency if it's above 0.
+func (l *PipelineLayout) dot(name string, maxConcurrency int) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(name))
+	fmt.Fprintf(&b, "\tlabel=%s;\n", strconv.Quote(name))
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+
+	for n, stage := range l.stages {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n", n+1)
+		fmt.Fprintf(&b, "\t\tlabel=\"stage %d\";\n", n+1)
+		for i, dp := range stage.processors {
+			label := dp.String()
+			if c, _ := stage.concurrencyOf(dp, maxConcurrency); c > 0 {
+				label += fmt.Sprintf("\nconcurrency %d", c)
+				if c > 1 && dp.partitionBy != "" {
+					label += ", by " + dp.partitionBy
+				} else if c > 1 && dp.unordered {
+					label += ", unordered"
+				}
+			}
+			fmt.Fprintf(&b, "\t\t%s [label=%s];\n", dotID(n, i), strconv.Quote(label))
+		}
+		b.WriteString("\t}\n")
+	}
+
+	// Outputs always point to the next stage, see NewPipelineLayout.
+	for n := 0; n < len(l.stages)-1; n++ {
+		next := l.stages[n+1]
+		for i, dp := range l.stages[n].processors {
+			for _, out := range dp.outputs {
+				for j := range next.processors {
+					if next.processors[j].DataProcessor == out {
+						fmt.Fprintf(&b, "\t%s -> %s;\n", dotID(n, i), dotID(n+1, j))
+					}
+				}
+			}
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotID(stage, index int) string {
+	return fmt.Sprintf("s%d_%d", stage+1, index)
+}
@@ -0,0 +1,180 @@
+package ratchet
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// PipelineError is the error sent on a Pipeline's killChan when a
+// DataProcessor fails. It records where the failure happened, the data
+// being processed at the time, and the underlying error.
+//
+// DataProcessors don't need to do anything to produce a PipelineError:
+// errors sent on the killChan passed to ProcessData or Finish are
+// wrapped by the Pipeline. A DataProcessor can also send a *PipelineError
+// itself to report a more specific Record (e.g. a single row out of a
+// batch); the Pipeline fills in the remaining fields.
+type PipelineError struct {
+	Pipeline  string    // Name of the Pipeline
+	Stage     int       // Stage number, starting at 1
+	Processor string    // String() of the DataProcessor
+	Record    data.JSON // Data being processed, or nil if sent from Finish
+	Truncated bool      // True if Record was truncated, see Pipeline.MaxErrorRecordLength
+	Err       error     // The underlying error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("%v - stage %d %v: %v", e.Pipeline, e.Stage, e.Processor, e.Err)
+}
+
+// Unwrap returns the underlying error, so errors.Is and errors.As can be
+// used to check for errors sent by a DataProcessor.
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCategory returns the category of the underlying error.
+// See util.ErrorCategoryOf.
+func (e *PipelineError) ErrorCategory() util.ErrorCategory {
+	return util.ErrorCategoryOf(e.Err)
+}
+
+// ErrorCause returns the error originally sent by a DataProcessor,
+// unwrapping it if it's a *PipelineError. It's intended for code written
+// before PipelineError existed that compares errors from the killChan
+// directly. Alternatively, set Pipeline.LegacyErrors.
+func ErrorCause(err error) error {
+	if pe, ok := err.(*PipelineError); ok {
+		return pe.Err
+	}
+	return err
+}
+
+// errorWrapper sits between a dataProcessor and the Pipeline's killChan,
+// wrapping every error the processor sends in a PipelineError.
+// Its killChan is never closed, since goroutines started by the processor
+// may still send errors after Finish; stop ends the wrapper instead.
+type errorWrapper struct {
+	killChan chan error
+	record   data.JSON
+	done     chan struct{}
+	stopped  chan struct{}
+	sync.Mutex
+}
+
+func (p *Pipeline) wrapErrors(info ProcessorInfo, dp *dataProcessor, result *runResult) *errorWrapper {
+	w := &errorWrapper{killChan: make(chan error), done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(w.stopped)
+		for {
+			var err error
+			select {
+			case err = <-w.killChan:
+			case <-w.done:
+				return
+			}
+			atomic.StoreInt32(&p.failed, 1)
+			dp.recordError()
+			w.Lock()
+			record := w.record
+			w.Unlock()
+			if re, ok := err.(*recordedError); ok {
+				err, record = re.err, re.record
+			}
+			if !p.LegacyErrors {
+				err = p.newPipelineError(info.Stage-1, dp, record, err)
+			}
+			p.notifyErrorSent(info, err)
+			result.send(err)
+		}
+	}()
+	return w
+}
+
+// stop ends the wrapper once it has handled any error it has received.
+// Errors sent after that are no longer received.
+func (w *errorWrapper) stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// setRecord records the data currently being processed, so it can be
+// included in any error. ProcessData calls made concurrently get a
+// killChan of their own instead, see callKillChan.
+func (w *errorWrapper) setRecord(d data.JSON) {
+	w.Lock()
+	w.record = d
+	w.Unlock()
+}
+
+// recordedError is an error sent by a ProcessData call made concurrently
+// with others, with the data the call received.
+type recordedError struct {
+	err    error
+	record data.JSON
+}
+
+func (e *recordedError) Error() string {
+	return e.err.Error()
+}
+
+// callKillChan returns the killChan for a ProcessData call on d made
+// concurrently with others, whose errors are reported with d rather than
+// the record set by setRecord. Like the wrapper's own killChan, it's never
+// closed, since goroutines started by the call may send errors after it
+// returns; its errors are forwarded until the wrapper is stopped. flush
+// must be called once the call returns, and returns once the errors sent
+// during the call have been forwarded.
+func (w *errorWrapper) callKillChan(d data.JSON) (killChan chan error, flush func()) {
+	killChan = make(chan error)
+	flushes := make(chan chan struct{})
+	go func() {
+		for {
+			select {
+			case err := <-killChan:
+				select {
+				case w.killChan <- &recordedError{err: err, record: d}:
+				case <-w.done:
+					return
+				}
+			case flushed := <-flushes:
+				close(flushed)
+			case <-w.done:
+				return
+			}
+		}
+	}()
+	return killChan, func() {
+		flushed := make(chan struct{})
+		select {
+		case flushes <- flushed:
+			<-flushed
+		case <-w.done:
+		}
+	}
+}
+
+func (p *Pipeline) newPipelineError(stage int, dp *dataProcessor, record data.JSON, err error) error {
+	pe, ok := err.(*PipelineError)
+	if !ok {
+		pe = &PipelineError{Err: err, Record: record}
+	}
+	if pe.Pipeline == "" {
+		pe.Pipeline = p.Name
+	}
+	if pe.Stage == 0 {
+		pe.Stage = stage + 1
+	}
+	if pe.Processor == "" {
+		pe.Processor = dp.String()
+	}
+	if p.MaxErrorRecordLength > 0 && len(pe.Record) > p.MaxErrorRecordLength {
+		pe.Record = pe.Record[:p.MaxErrorRecordLength]
+		pe.Truncated = true
+	}
+	return pe
+}
@@ -0,0 +1,116 @@
+package ratchet_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// errorSender sends err from ProcessData, or from Finish if inFinish is
+// set.
+type errorSender struct {
+	err      error
+	inFinish bool
+}
+
+func (s errorSender) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if !s.inFinish {
+		killChan <- s.err
+	}
+}
+
+func (s errorSender) Finish(outputChan chan data.JSON, killChan chan error) {
+	if s.inFinish {
+		killChan <- s.err
+	}
+}
+
+func (s errorSender) String() string {
+	return "errorSender"
+}
+
+// runErr runs p, and returns the error it finishes with.
+func runErr(t *testing.T, p *ratchet.Pipeline) error {
+	t.Helper()
+	select {
+	case err := <-p.Run():
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish")
+	}
+	return nil
+}
+
+func TestPipelineError(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	boom := errors.New("boom")
+	tests := []struct {
+		name       string
+		sender     errorSender
+		maxLength  int
+		wantRecord string
+		truncated  bool
+	}{
+		{"ProcessData", errorSender{err: boom}, 0, `{"id":12345}`, false},
+		{"Finish", errorSender{err: boom, inFinish: true}, 0, "", false},
+		{"specific record", errorSender{err: &ratchet.PipelineError{Record: data.JSON(`{"row":2}`), Err: boom}}, 0, `{"row":2}`, false},
+		{"truncated", errorSender{err: boom}, 5, `{"id"`, true},
+		{"not truncated", errorSender{err: boom}, 12, `{"id":12345}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := ratchet.NewPipeline(sender{`{"id":12345}`}, test.sender)
+			p.Name = "orders"
+			p.MaxErrorRecordLength = test.maxLength
+			err := runErr(t, p)
+
+			var pe *ratchet.PipelineError
+			if !errors.As(err, &pe) {
+				t.Fatalf("got %T %v, want a *PipelineError", err, err)
+			}
+			if pe.Pipeline != "orders" || pe.Stage != 2 || pe.Processor != "errorSender" {
+				t.Errorf("got pipeline %q, stage %d and processor %q, want orders, 2 and errorSender", pe.Pipeline, pe.Stage, pe.Processor)
+			}
+			if string(pe.Record) != test.wantRecord || pe.Truncated != test.truncated {
+				t.Errorf("got record %q (truncated: %v), want %q (truncated: %v)", pe.Record, pe.Truncated, test.wantRecord, test.truncated)
+			}
+			if pe.Unwrap() != boom || !errors.Is(err, boom) || ratchet.ErrorCause(err) != boom {
+				t.Errorf("got %v, want it to wrap %v", err, boom)
+			}
+			if want := "orders - stage 2 errorSender: boom"; err.Error() != want {
+				t.Errorf("got message %q, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestPipelineErrorCategory(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	p := ratchet.NewPipeline(sender{`{}`}, errorSender{err: util.DataErrorf("bad record")})
+	err := runErr(t, p)
+	if util.ErrorCategoryOf(err) != util.CategoryDataInvalid {
+		t.Errorf("got category %v, want %v", util.ErrorCategoryOf(err), util.CategoryDataInvalid)
+	}
+}
+
+func TestLegacyErrors(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	boom := errors.New("boom")
+	p := ratchet.NewPipeline(sender{`{}`}, errorSender{err: boom})
+	p.LegacyErrors = true
+	if err := runErr(t, p); err != boom {
+		t.Errorf("got %v, want the error exactly as it was sent", err)
+	}
+	// ErrorCause leaves errors that aren't PipelineErrors alone.
+	if ratchet.ErrorCause(boom) != boom || ratchet.ErrorCause(nil) != nil {
+		t.Error("ErrorCause changed an error that isn't a PipelineError")
+	}
+}
@@ -1,8 +1,16 @@
 package ratchet
 
+import "time"
+
 // PipelineStage holds one or more DataProcessor instances.
 type PipelineStage struct {
-	processors []*dataProcessor
+	processors      []*dataProcessor
+	bufferLength    int
+	hasBufferLength bool
+	timeout         time.Duration
+	hasTimeout      bool
+	concurrency     int
+	hasConcurrency  bool
 }
 
 // NewPipelineStage creates a PipelineStage instance given a series
@@ -26,7 +34,65 @@ type PipelineStage struct {
 //
 // See the ratchet package documentation for more code examples.
 func NewPipelineStage(processors ...*dataProcessor) *PipelineStage {
-	return &PipelineStage{processors}
+	return &PipelineStage{processors: processors}
+}
+
+// WithBufferLength sets the number of payloads that can be queued up
+// waiting to be received by each DataProcessor in this stage, overriding
+// Pipeline.BufferLength. A length of 0 makes the stage's input unbuffered,
+// so the previous stage blocks until this stage is ready for more data.
+// It has no effect on the first stage.
+func (s *PipelineStage) WithBufferLength(length int) *PipelineStage {
+	s.bufferLength = length
+	s.hasBufferLength = true
+	return s
+}
+
+// WithTimeout sets how long the DataProcessors in this stage can go without
+// making progress before the Pipeline is stopped, overriding
+// Pipeline.StageTimeout. A timeout of 0 disables it for the stage.
+func (s *PipelineStage) WithTimeout(timeout time.Duration) *PipelineStage {
+	s.timeout = timeout
+	s.hasTimeout = true
+	return s
+}
+
+// WithConcurrency overrides the Concurrency() of the
+// ConcurrentDataProcessors in this stage, so the same processor can be
+// tuned for each Pipeline it's used in. A concurrency of 1 makes them
+// process one payload at a time. DataProcessors that don't implement
+// ConcurrentDataProcessor aren't affected, since they may not be safe to
+// call concurrently. See also Pipeline.MaxConcurrency.
+func (s *PipelineStage) WithConcurrency(concurrency int) *PipelineStage {
+	s.concurrency = concurrency
+	s.hasConcurrency = true
+	return s
+}
+
+// concurrencyOf returns the concurrency of one of the stage's
+// DataProcessors, capped at max if it's above 0, and false if it isn't a
+// ConcurrentDataProcessor.
+func (s *PipelineStage) concurrencyOf(dp *dataProcessor, max int) (int, bool) {
+	cp, ok := dp.DataProcessor.(ConcurrentDataProcessor)
+	if !ok {
+		return 0, false
+	}
+	c := cp.Concurrency()
+	if s.hasConcurrency {
+		c = s.concurrency
+	}
+	if max > 0 && c > max {
+		c = max
+	}
+	return c, true
+}
+
+// Add appends a dataProcessor (see Do) to the stage. It's useful for
+// building stages dynamically, e.g. from configuration, where the
+// processors aren't known up front.
+func (s *PipelineStage) Add(dp *dataProcessor) *PipelineStage {
+	s.processors = append(s.processors, dp)
+	return s
 }
 
 func (s *PipelineStage) hasProcessor(p DataProcessor) bool {
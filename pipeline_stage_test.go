@@ -0,0 +1,89 @@
+package ratchet_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// countingReader sends n payloads, counting those that have been sent.
+type countingReader struct {
+	n    int
+	sent int32
+}
+
+func (r *countingReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	for i := 0; i < r.n; i++ {
+		outputChan <- data.JSON(`{}`)
+		atomic.AddInt32(&r.sent, 1)
+	}
+}
+
+func (r *countingReader) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// blockedWriter doesn't return from its first ProcessData call until
+// release is closed.
+type blockedWriter struct {
+	release chan struct{}
+}
+
+func (w blockedWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	<-w.release
+}
+
+func (w blockedWriter) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestStageBufferLength(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name         string
+		bufferLength int
+		stageLength  int // Set on the writer's stage, unless it's -1
+		unbuffered   bool
+		want         int32
+	}{
+		{"default", 10, -1, false, 10},
+		{"stage length", 10, 2, false, 2},
+		{"unbuffered stage", 10, 0, false, 0},
+		{"unbuffered", 10, 5, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := &countingReader{n: 50}
+			writer := blockedWriter{release: make(chan struct{})}
+			writerStage := ratchet.NewPipelineStage(ratchet.Do(writer))
+			if test.stageLength >= 0 {
+				writerStage.WithBufferLength(test.stageLength)
+			}
+			layout, err := ratchet.NewPipelineLayout(ratchet.NewPipelineStage(ratchet.Do(reader).Outputs(writer)), writerStage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := ratchet.NewBranchingPipeline(layout)
+			p.BufferLength = test.bufferLength
+			p.Unbuffered = test.unbuffered
+			killChan := p.Run()
+
+			// Besides the buffer, the writer holds a payload, and the
+			// goroutines passing data between the stages one each.
+			time.Sleep(100 * time.Millisecond)
+			if sent := atomic.LoadInt32(&reader.sent); sent != test.want+3 {
+				t.Errorf("the reader sent %d payloads ahead of the blocked writer, want %d", sent, test.want+3)
+			}
+			close(writer.release)
+			select {
+			case err := <-killChan:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the Pipeline didn't finish")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package ratchet
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PipelineStats is a machine-readable report of the stats gathered while
+// running a Pipeline. See Pipeline.StatsReport.
+type PipelineStats struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Running  bool          `json:"running"`
+	Stages   []StageStats  `json:"stages"`
+}
+
+// StageStats holds the stats for each DataProcessor in a PipelineStage.
+type StageStats struct {
+	Stage      int              `json:"stage"` // Starting at 1
+	Processors []ProcessorStats `json:"processors"`
+}
+
+// CounterSource can be implemented by DataProcessors that count what
+// they do in their own terms, such as the rows a writer inserted and
+// updated, to report the counts in ProcessorStats.Counters.
+type CounterSource interface {
+	Counters() map[string]int64
+}
+
+// ProcessorStats holds the stats for a single DataProcessor.
+//
+// Errors counts the errors the DataProcessor sent to the killChan, and
+// InFlight is the number of ProcessData calls currently running.
+// ExecutionTime is the time spent in each ProcessData call. QueueWait is
+// the time each payload spent between being sent by the previous stage and
+// being received by this DataProcessor, which grows when this stage can't
+// keep up with its input. Counters are reported by DataProcessors that
+// implement CounterSource.
+type ProcessorStats struct {
+	Processor          string           `json:"processor"`
+	PayloadsReceived   int              `json:"payloads_received"`
+	PayloadsSent       int              `json:"payloads_sent"`
+	BytesReceived      int              `json:"bytes_received"`
+	BytesSent          int              `json:"bytes_sent"`
+	Executions         int              `json:"executions"`
+	InFlight           int              `json:"in_flight"`
+	Errors             int              `json:"errors"`
+	TotalExecutionTime time.Duration    `json:"total_execution_time"`
+	ExecutionTime      DurationSummary  `json:"execution_time"`
+	TotalQueueWait     time.Duration    `json:"total_queue_wait"`
+	QueueWait          DurationSummary  `json:"queue_wait"`
+	Counters           map[string]int64 `json:"counters,omitempty"`
+}
+
+// DurationSummary summarizes a set of durations with percentiles, which
+// are estimates, within about 9% (the durations themselves aren't kept).
+type DurationSummary struct {
+	Count int           `json:"count"`
+	Avg   time.Duration `json:"avg"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// summary summarizes the durations, with percentiles estimated by the
+// histogram.
+func (h *durationHistogram) summary() (summary DurationSummary, total time.Duration) {
+	if h.count == 0 {
+		return
+	}
+	summary = DurationSummary{
+		Count: h.count,
+		Avg:   h.total / time.Duration(h.count),
+		P50:   h.percentile(0.50),
+		P90:   h.percentile(0.90),
+		P99:   h.percentile(0.99),
+		Max:   h.max,
+	}
+	return summary, h.total
+}
+
+func (dp *dataProcessor) stats() ProcessorStats {
+	dp.statMutex.Lock()
+	defer dp.statMutex.Unlock()
+	s := ProcessorStats{
+		Processor:        dp.String(),
+		PayloadsReceived: dp.dataReceivedCounter,
+		PayloadsSent:     dp.dataSentCounter,
+		BytesReceived:    dp.totalBytesReceived,
+		BytesSent:        dp.totalBytesSent,
+		Executions:       dp.executionsCounter,
+		InFlight:         dp.inFlight,
+		Errors:           dp.errorsCounter,
+	}
+	s.ExecutionTime, s.TotalExecutionTime = dp.executionTimes.summary()
+	s.QueueWait, s.TotalQueueWait = dp.queueWaits.summary()
+	if src, ok := dp.DataProcessor.(CounterSource); ok {
+		s.Counters = src.Counters()
+	}
+	return s
+}
+
+// Stats returns a string (formatted for output display) listing the stats
+// gathered for each stage executed. See StatsReport.
+func (p *Pipeline) Stats() string {
+	return p.StatsReport().String()
+}
+
+// StatsReport returns the stats gathered for each stage executed. It can
+// be called while the Pipeline is running to get the stats so far.
+func (p *Pipeline) StatsReport() *PipelineStats {
+	s := &PipelineStats{Name: p.Name}
+	if p.timer != nil {
+		s.Duration = p.timer.Duration()
+		s.Running = !p.timer.Stopped()
+	}
+	for n, stage := range p.layout.stages {
+		ss := StageStats{Stage: n + 1}
+		for _, dp := range stage.processors {
+			ss.Processors = append(ss.Processors, dp.stats())
+		}
+		s.Stages = append(s.Stages, ss)
+	}
+	return s
+}
+
+// String returns the stats formatted for output display.
+func (s *PipelineStats) String() string {
+	state := "Ran in"
+	if s.Running {
+		state = "Running for"
+	}
+	o := fmt.Sprintf("%s: %s %v secs\r\n", s.Name, state, s.Duration.Seconds())
+	for _, stage := range s.Stages {
+		o += fmt.Sprintf("Stage %d)\r\n", stage.Stage)
+		for _, ps := range stage.Processors {
+			avgBytesSent, avgBytesReceived := 0, 0
+			if ps.PayloadsSent > 0 {
+				avgBytesSent = ps.BytesSent / ps.PayloadsSent
+			}
+			if ps.PayloadsReceived > 0 {
+				avgBytesReceived = ps.BytesReceived / ps.PayloadsReceived
+			}
+			o += fmt.Sprintf("  * %v\r\n", ps.Processor)
+			o += fmt.Sprintf("     - Total/Avg Execution Time = %f/%fs\r\n", ps.TotalExecutionTime.Seconds(), ps.ExecutionTime.Avg.Seconds())
+			o += fmt.Sprintf("     - p50/p90/p99/Max Execution Time = %v/%v/%v/%v\r\n", ps.ExecutionTime.P50, ps.ExecutionTime.P90, ps.ExecutionTime.P99, ps.ExecutionTime.Max)
+			o += fmt.Sprintf("     - Total/Avg Queue Wait = %f/%fs\r\n", ps.TotalQueueWait.Seconds(), ps.QueueWait.Avg.Seconds())
+			o += fmt.Sprintf("     - Payloads Sent/Received = %d/%d\r\n", ps.PayloadsSent, ps.PayloadsReceived)
+			if ps.Errors > 0 {
+				o += fmt.Sprintf("     - Errors = %d\r\n", ps.Errors)
+			}
+			o += fmt.Sprintf("     - Total/Avg Bytes Sent = %d/%d\r\n", ps.BytesSent, avgBytesSent)
+			o += fmt.Sprintf("     - Total/Avg Bytes Received = %d/%d\r\n", ps.BytesReceived, avgBytesReceived)
+			names := make([]string, 0, len(ps.Counters))
+			for name := range ps.Counters {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				o += fmt.Sprintf("     - Counter %v = %d\r\n", name, ps.Counters[name])
+			}
+		}
+	}
+	return o
+}
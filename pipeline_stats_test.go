@@ -0,0 +1,65 @@
+package ratchet_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// sleeper takes its data's length in milliseconds to process it.
+type sleeper struct{}
+
+func (sleeper) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	time.Sleep(time.Duration(len(d)) * time.Millisecond)
+}
+
+func (sleeper) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// sizes sends payloads of the given lengths.
+type sizes []int
+
+func (s sizes) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	for _, n := range s {
+		outputChan <- data.JSON(strings.Repeat("1", n))
+	}
+}
+
+func (s sizes) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestStatsReport(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	var lengths sizes
+	for i := 0; i < 90; i++ {
+		lengths = append(lengths, 1)
+	}
+	for i := 0; i < 10; i++ {
+		lengths = append(lengths, 20)
+	}
+	p := ratchet.NewPipeline(lengths, sleeper{})
+	if err := <-p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := p.StatsReport().Stages[1].Processors[0]
+	if stats.Executions != 100 || stats.ExecutionTime.Count != 100 {
+		t.Errorf("got %d executions, %d timed, want 100", stats.Executions, stats.ExecutionTime.Count)
+	}
+	et := stats.ExecutionTime
+	if et.P50 < time.Millisecond || et.P50 > 5*time.Millisecond {
+		t.Errorf("got p50 %v, want about 1ms", et.P50)
+	}
+	if et.P99 < 20*time.Millisecond || et.P99 > et.Max {
+		t.Errorf("got p99 %v, want at least 20ms and at most max %v", et.P99, et.Max)
+	}
+	if et.Avg != stats.TotalExecutionTime/100 {
+		t.Errorf("got avg %v, total %v", et.Avg, stats.TotalExecutionTime)
+	}
+	if s := p.Stats(); !strings.Contains(s, "Stage 2)") {
+		t.Errorf("got Stats %q, want the stats for stage 2", s)
+	}
+}
@@ -1,9 +1,14 @@
 package ratchet_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strings"
+	"testing"
+	"time"
 
 	"github.com/fefelovgroup/ratchet"
 	"github.com/fefelovgroup/ratchet/data"
@@ -85,3 +90,146 @@ func ExampleNewBranchingPipeline() {
 	// Output:
 	// HELLO WORLD
 }
+
+func ExamplePipeline_Output() {
+	logger.LogLevel = logger.LevelSilent
+
+	hello := processors.NewIoReader(strings.NewReader("Hello world"))
+	upperCaser := processors.NewFuncTransformer(func(d data.JSON) data.JSON {
+		return data.JSON(strings.ToUpper(string(d)))
+	})
+	lowerCaser := processors.NewFuncTransformer(func(d data.JSON) data.JSON {
+		return data.JSON(strings.ToLower(string(d)))
+	})
+	upper := ratchet.NewNamedOutput("upper", 8)
+	lower := ratchet.NewNamedOutput("lower", 8)
+
+	layout, err := ratchet.NewPipelineLayout(
+		ratchet.NewPipelineStage(
+			ratchet.Do(hello).Outputs(upperCaser, lowerCaser),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(upperCaser).Outputs(upper),
+			ratchet.Do(lowerCaser).Outputs(lower),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(upper),
+			ratchet.Do(lower),
+		),
+	)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	pipeline := ratchet.NewBranchingPipeline(layout)
+	killChan := pipeline.Run()
+
+	for d := range pipeline.Output("upper") {
+		fmt.Println("upper:", string(d))
+	}
+	for d := range pipeline.Output("lower") {
+		fmt.Println("lower:", string(d))
+	}
+
+	if err := <-killChan; err != nil {
+		fmt.Println("An error occurred in the ratchet pipeline:", err.Error())
+	}
+
+	// Output:
+	// upper: HELLO WORLD
+	// lower: hello world
+}
+
+func ExamplePipelineLayout_DOT() {
+	hello := processors.NewIoReader(strings.NewReader("Hello world"))
+	hola := processors.NewIoReader(strings.NewReader("Hola mundo"))
+	matcher := processors.NewRegexpMatcher("o")
+	stdout := processors.NewIoWriter(os.Stdout)
+
+	layout, _ := ratchet.NewPipelineLayout(
+		ratchet.NewPipelineStage(
+			ratchet.Do(hello).Outputs(matcher),
+			ratchet.Do(hola).Outputs(matcher),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(matcher).Outputs(stdout),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(stdout),
+		),
+	)
+
+	fmt.Print(layout.DOT())
+
+	// Output:
+	// digraph "Pipeline" {
+	// 	label="Pipeline";
+	// 	rankdir=LR;
+	// 	node [shape=box];
+	// 	subgraph cluster_1 {
+	// 		label="stage 1";
+	// 		s1_0 [label="IoReader"];
+	// 		s1_1 [label="IoReader"];
+	// 	}
+	// 	subgraph cluster_2 {
+	// 		label="stage 2";
+	// 		s2_0 [label="RegexpMatcher"];
+	// 	}
+	// 	subgraph cluster_3 {
+	// 		label="stage 3";
+	// 		s3_0 [label="IoWriter"];
+	// 	}
+	// 	s1_0 -> s2_0;
+	// 	s1_1 -> s2_0;
+	// 	s2_0 -> s3_0;
+	// }
+}
+
+// waitForCancel sends its data on until its context is cancelled.
+type waitForCancel struct{}
+
+func (waitForCancel) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+}
+
+func (waitForCancel) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	for ctx.Err() == nil {
+		outputChan <- d
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (waitForCancel) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func TestRunContextSendsOneResult(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	finished := make(chan struct{})
+	p := ratchet.NewPipeline(waitForCancel{}, processors.NewIoWriter(ioutil.Discard))
+	p.AddObserver(finishObserver{finished: finished})
+	ctx, cancel := context.WithCancel(context.Background())
+	killChan := p.RunContext(ctx)
+	cancel()
+
+	if err := <-killChan; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	// Once the stages have all finished, nothing else is sent.
+	<-finished
+	select {
+	case err := <-killChan:
+		t.Fatalf("got a second result: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// finishObserver closes finished when the last stage finishes.
+type finishObserver struct {
+	ratchet.NopObserver
+	finished chan struct{}
+}
+
+func (o finishObserver) StageFinished(p *ratchet.Pipeline, info ratchet.ProcessorInfo) {
+	if info.Stage == 2 {
+		close(o.finished)
+	}
+}
@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// client calls the processor service of a plugin process.
+type client struct {
+	conn *grpc.ClientConn
+}
+
+func (c *client) names(ctx context.Context) ([]string, error) {
+	out := new(wrapperspb.BytesValue)
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/Names", new(emptypb.Empty), out); err != nil {
+		return nil, fromStatus(err)
+	}
+	var names []string
+	if err := json.Unmarshal(out.Value, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (c *client) open(ctx context.Context, processor string, options interface{}) error {
+	opts, err := json.Marshal(options)
+	if err != nil {
+		return util.ConfigInvalidError(err)
+	}
+	b, err := json.Marshal(openRequest{Processor: processor, Options: opts})
+	if err != nil {
+		return err
+	}
+	if err := c.conn.Invoke(ctx, "/"+serviceName+"/Open", wrapperspb.Bytes(b), new(emptypb.Empty)); err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+func (c *client) run(ctx context.Context) (grpc.ClientStream, error) {
+	return c.conn.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/Run")
+}
+
+// startPlugin starts the plugin binary at path and connects to it. The
+// returned goplugin.Client must be killed when it's no longer needed.
+func startPlugin(path string) (*goplugin.Client, *client, error) {
+	pc := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig:  Handshake,
+		Plugins:          goplugin.PluginSet{pluginName: &processorPlugin{}},
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		Logger:           hcLogger(),
+	})
+	rpc, err := pc.Client()
+	if err != nil {
+		pc.Kill()
+		return nil, nil, util.ConfigInvalidError(err)
+	}
+	raw, err := rpc.Dispense(pluginName)
+	if err != nil {
+		pc.Kill()
+		return nil, nil, util.ConfigInvalidError(err)
+	}
+	return pc, raw.(*client), nil
+}
+
+// Processor is a DataProcessor served by a plugin binary. The plugin is
+// started (and the processor created with Options) when the Processor is
+// first used, or by Start, and stopped when it's finished or closed.
+//
+// Data sent to the Processor is streamed to the plugin, and everything
+// the plugin's DataProcessor outputs is sent on, so the Processor can be
+// used in any stage, including as a reader in the first one.
+type Processor struct {
+	Path      string      // Path to the plugin binary
+	Processor string      // Name of the processor served by the plugin
+	Options   interface{} // Passed to the plugin's Factory as JSON
+
+	plugin *goplugin.Client
+	client *client
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	done   chan struct{}
+	mutex  sync.Mutex
+}
+
+// NewProcessor returns a new Processor for the named processor served by
+// the plugin binary at path.
+func NewProcessor(path, processor string, options interface{}) *Processor {
+	return &Processor{Path: path, Processor: processor, Options: options}
+}
+
+// Start starts the plugin and creates the processor, so that an invalid
+// plugin or invalid Options can be reported before the pipeline is run.
+func (p *Processor) Start() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.start()
+}
+
+func (p *Processor) start() error {
+	if p.plugin != nil {
+		return nil
+	}
+	pc, c, err := startPlugin(p.Path)
+	if err != nil {
+		return err
+	}
+	if err := c.open(context.Background(), p.Processor, p.Options); err != nil {
+		pc.Kill()
+		return err
+	}
+	p.plugin, p.client = pc, c
+	return nil
+}
+
+// run starts streaming to the plugin if it hasn't been already, sending
+// its output to outputChan.
+func (p *Processor) run(outputChan chan data.JSON, killChan chan error) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err := p.start(); err != nil {
+		return err
+	}
+	if p.stream != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := p.client.run(ctx)
+	if err != nil {
+		cancel()
+		return fromStatus(err)
+	}
+	p.stream, p.cancel = stream, cancel
+	p.done = make(chan struct{})
+	go func() {
+		defer close(p.done)
+		for {
+			out := new(wrapperspb.BytesValue)
+			err := stream.RecvMsg(out)
+			if err == io.EOF || ctx.Err() != nil {
+				// Finished, or stopped by Close.
+				return
+			}
+			if err != nil {
+				util.KillPipelineIfErr(fromStatus(err), killChan)
+				return
+			}
+			outputChan <- data.JSON(out.Value)
+		}
+	}()
+	return nil
+}
+
+// ProcessData sends the data to the plugin.
+func (p *Processor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if err := p.run(outputChan, killChan); err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	// io.EOF means the plugin has ended the stream, and the reason is
+	// reported by the goroutine receiving from it.
+	if err := p.stream.SendMsg(wrapperspb.Bytes(d)); err != nil && err != io.EOF {
+		util.KillPipelineIfErr(fromStatus(err), killChan)
+	}
+}
+
+// Finish finishes the plugin's DataProcessor, waits for the rest of its
+// output, and stops the plugin.
+func (p *Processor) Finish(outputChan chan data.JSON, killChan chan error) {
+	defer p.Close()
+	if err := p.run(outputChan, killChan); err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if err := p.stream.CloseSend(); err != nil {
+		util.KillPipelineIfErr(fromStatus(err), killChan)
+		return
+	}
+	<-p.done
+}
+
+// Close stops the plugin. It's safe to call more than once.
+func (p *Processor) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+	if p.plugin != nil {
+		p.plugin.Kill()
+	}
+	p.plugin, p.client, p.stream, p.cancel = nil, nil, nil, nil
+	return nil
+}
+
+func (p *Processor) String() string {
+	return "Plugin(" + p.Processor + ")"
+}
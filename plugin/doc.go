@@ -0,0 +1,29 @@
+// Package plugin loads DataProcessors from separate plugin binaries, so
+// proprietary connectors can be built and shipped apart from ratchet and
+// the programs that run pipelines. Plugins are served with
+// hashicorp/go-plugin over gRPC: each Processor runs in its own plugin
+// process, and data is streamed to and from it as JSON.
+//
+// A plugin binary serves one or more processors by name. Each Factory
+// creates a DataProcessor from the JSON options given in the pipeline:
+//
+//	func main() {
+//		plugin.Serve(map[string]plugin.Factory{
+//			"salesforce_reader": newSalesforceReader,
+//		})
+//	}
+//
+// Programs find plugins with a Registry, which maps processor names to
+// the binaries that serve them. Registry.Discover looks for binaries
+// named ratchet-plugin-* in a directory and asks each one which
+// processors it serves. The config package's RegisterPlugins makes every
+// processor in a Registry available as a processor type, and the ratchet
+// command does so for the directories in its -plugins flag:
+//
+//	stages:
+//	  - - type: salesforce_reader
+//	      options: {object: Account}
+//
+// Errors sent by a plugin's DataProcessor keep their util.ErrorCategory
+// when they are passed back to the pipeline.
+package plugin
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Handshake is checked by ratchet and the plugin binary before a plugin
+// is used, so that binaries which aren't ratchet plugins (or are built
+// for an incompatible version of this package) are rejected.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "RATCHET_PLUGIN",
+	MagicCookieValue: "3f1b9c2e-processor",
+}
+
+// Factory creates a DataProcessor served by a plugin from the options it
+// was given in the pipeline, as JSON (null if there are none).
+type Factory func(options json.RawMessage) (ratchet.DataProcessor, error)
+
+// pluginName is the name the processor service is dispensed by.
+const pluginName = "processor"
+
+// processorPlugin is the go-plugin Plugin for the processor service. The
+// plugin binary sets factories, ratchet uses it to create clients.
+type processorPlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	factories map[string]Factory
+}
+
+func (p *processorPlugin) GRPCServer(broker *goplugin.GRPCBroker, s *grpc.Server) error {
+	s.RegisterService(&serviceDesc, &server{factories: p.factories})
+	return nil
+}
+
+func (p *processorPlugin) GRPCClient(ctx context.Context, broker *goplugin.GRPCBroker, conn *grpc.ClientConn) (interface{}, error) {
+	return &client{conn: conn}, nil
+}
+
+// Serve serves the DataProcessors created by factories, keyed by
+// processor name. It's called from a plugin binary's main function, and
+// doesn't return.
+func Serve(factories map[string]Factory) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{pluginName: &processorPlugin{factories: factories}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+		Logger:          hcLogger(),
+	})
+}
+
+// hcLogger returns a go-plugin logger at the level of the ratchet logger.
+func hcLogger() hclog.Logger {
+	level := hclog.Error
+	switch logger.LogLevel {
+	case logger.LevelDebug:
+		level = hclog.Debug
+	case logger.LevelInfo:
+		level = hclog.Info
+	case logger.LevelSilent:
+		level = hclog.Off
+	}
+	return hclog.New(&hclog.LoggerOptions{Name: "ratchet-plugin", Level: level, Output: os.Stderr})
+}
+
+// The gRPC service is defined by hand rather than generated from a
+// .proto file, since every message is either raw JSON or empty.
+const serviceName = "ratchet.plugin.Processor"
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Names", Handler: namesHandler},
+		{MethodName: "Open", Handler: openHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Run", Handler: runHandler, ServerStreams: true, ClientStreams: true},
+	},
+}
+
+// openRequest is the JSON sent with Open.
+type openRequest struct {
+	Processor string          `json:"processor"`
+	Options   json.RawMessage `json:"options"`
+}
+
+// errorCodes maps util.ErrorCategory to gRPC status codes and back, so
+// errors keep their category across the plugin boundary.
+var errorCodes = map[util.ErrorCategory]codes.Code{
+	util.CategoryFatal:         codes.Internal,
+	util.CategoryTransient:     codes.Unavailable,
+	util.CategoryDataInvalid:   codes.InvalidArgument,
+	util.CategoryConfigInvalid: codes.FailedPrecondition,
+}
+
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	return status.Error(errorCodes[util.ErrorCategoryOf(err)], err.Error())
+}
+
+func fromStatus(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for category, code := range errorCodes {
+		if s.Code() == code {
+			return util.NewCategorizedError(category, errors.New(s.Message()))
+		}
+	}
+	if s.Code() == codes.DeadlineExceeded {
+		return util.TransientError(errors.New(s.Message()))
+	}
+	return errors.New(s.Message())
+}
@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// BinaryPrefix is the prefix of the file names Registry.Discover looks
+// for, e.g. ratchet-plugin-salesforce.
+const BinaryPrefix = "ratchet-plugin-"
+
+// Registry maps processor names to the plugin binaries that serve them.
+type Registry struct {
+	paths map[string]string
+	mutex sync.RWMutex
+}
+
+// NewRegistry returns a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{paths: make(map[string]string)}
+}
+
+// Register registers the plugin binary at path as serving the named
+// processor, replacing any binary previously registered for it.
+func (r *Registry) Register(processor, path string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.paths[processor] = path
+}
+
+// Discover registers every processor served by the plugin binaries in
+// dir, which are the executable files whose names start with
+// BinaryPrefix. Each binary is started briefly to ask which processors
+// it serves. If two binaries serve the same processor, the last one (by
+// file name) wins.
+func (r *Registry) Discover(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), BinaryPrefix) || f.IsDir() || f.Mode()&0111 == 0 {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		names, err := pluginNames(path)
+		if err != nil {
+			return util.ConfigErrorf("plugin %v: %v", path, err)
+		}
+		for _, name := range names {
+			logger.Debug("plugin: found processor", name, "in", path)
+			r.Register(name, path)
+		}
+	}
+	return nil
+}
+
+func pluginNames(path string) ([]string, error) {
+	pc, c, err := startPlugin(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Kill()
+	return c.names(context.Background())
+}
+
+// Names returns the names of the registered processors, sorted.
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	names := make([]string, 0, len(r.paths))
+	for name := range r.paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Path returns the plugin binary registered for the named processor.
+func (r *Registry) Path(processor string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	path, ok := r.paths[processor]
+	return path, ok
+}
+
+// Open returns a started Processor for the named processor, created with
+// the given options. The Processor must be finished or closed to stop
+// the plugin.
+func (r *Registry) Open(processor string, options interface{}) (*Processor, error) {
+	path, ok := r.Path(processor)
+	if !ok {
+		return nil, util.ConfigErrorf("no plugin serves processor %q", processor)
+	}
+	p := NewProcessor(path, processor, options)
+	if err := p.Start(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// server runs in the plugin binary. Each plugin process serves a single
+// DataProcessor, created by Open and run by Run.
+type server struct {
+	factories map[string]Factory
+	processor ratchet.DataProcessor
+	mutex     sync.Mutex
+}
+
+// names returns the processor names the plugin serves, sorted.
+func (s *server) names() []string {
+	names := make([]string, 0, len(s.factories))
+	for name := range s.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *server) open(req *openRequest) error {
+	f, ok := s.factories[req.Processor]
+	if !ok {
+		return status.Errorf(codes.NotFound, "plugin doesn't serve processor %q", req.Processor)
+	}
+	p, err := f(req.Options)
+	if err != nil {
+		return toStatus(err)
+	}
+	s.mutex.Lock()
+	s.processor = p
+	s.mutex.Unlock()
+	return nil
+}
+
+// run passes the data received on the stream to the DataProcessor, and
+// sends everything it outputs back. The DataProcessor is finished when
+// ratchet closes its side of the stream, and the first error it sends to
+// its killChan ends the stream.
+func (s *server) run(stream grpc.ServerStream) error {
+	s.mutex.Lock()
+	p := s.processor
+	s.mutex.Unlock()
+	if p == nil {
+		return status.Error(codes.FailedPrecondition, "no processor has been opened")
+	}
+
+	outputChan := make(chan data.JSON)
+	killChan := make(chan error, 1)
+	sent := make(chan error, 1)
+	go func() {
+		var err error
+		for d := range outputChan {
+			// Keep draining after an error so the DataProcessor
+			// doesn't block.
+			if err == nil {
+				err = stream.SendMsg(wrapperspb.Bytes(d))
+			}
+		}
+		sent <- err
+	}()
+	killed := func() error {
+		select {
+		case err := <-killChan:
+			return toStatus(err)
+		default:
+			return nil
+		}
+	}
+
+	err := func() error {
+		for {
+			in := new(wrapperspb.BytesValue)
+			err := stream.RecvMsg(in)
+			if err == io.EOF {
+				p.Finish(outputChan, killChan)
+				return killed()
+			}
+			if err != nil {
+				return err
+			}
+			p.ProcessData(data.JSON(in.Value), outputChan, killChan)
+			if err := killed(); err != nil {
+				return err
+			}
+		}
+	}()
+	close(outputChan)
+	if sendErr := <-sent; err == nil {
+		err = sendErr
+	}
+	return err
+}
+
+func namesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	if err := dec(new(emptypb.Empty)); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(srv.(*server).names())
+	if err != nil {
+		return nil, err
+	}
+	return wrapperspb.Bytes(b), nil
+}
+
+func openHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.BytesValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	var req openRequest
+	if err := json.Unmarshal(in.Value, &req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := srv.(*server).open(&req); err != nil {
+		return nil, err
+	}
+	return new(emptypb.Empty), nil
+}
+
+func runHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(*server).run(stream)
+}
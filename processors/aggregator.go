@@ -0,0 +1,275 @@
+package processors
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Aggregator groups the records it receives by the GroupBy fields and
+// computes Aggregations for each group, like a SQL GROUP BY, so rollups
+// don't need to land the data in a database first. Incoming data can be a
+// single JSON object or an array of objects.
+//
+// The aggregated rows are sent as a single array when the Aggregator is
+// finished, with one object per group holding the GroupBy fields and the
+// result of each Aggregation. Groups are sent in the order they were first
+// seen. With no GroupBy fields, all records form a single group.
+//
+//	processors.NewAggregator([]string{"region"},
+//		processors.Count("orders"),
+//		processors.Sum("amount", "total"),
+//		processors.Max("amount", "largest"),
+//	)
+type Aggregator struct {
+	GroupBy      []string // Dotted paths, which are also the output field names
+	Aggregations []Aggregation
+	groups       map[string]*aggregateGroup
+	order        []string
+}
+
+type aggregateGroup struct {
+	keys         []interface{}
+	accumulators []Accumulator
+}
+
+// Aggregation computes a value from a field of each record in a group,
+// and stores the result in the As field of the aggregated row.
+type Aggregation struct {
+	Field string // Dotted path to the field to aggregate
+	As    string
+	// NewAccumulator returns the Accumulator for a new group.
+	NewAccumulator func() Accumulator
+}
+
+// Accumulator aggregates the values of a field for a single group.
+// Add is called for each record with the field's value, and whether the
+// record had the field.
+type Accumulator interface {
+	Add(v interface{}, present bool)
+	Result() interface{}
+}
+
+// NewAggregator returns a new Aggregator.
+func NewAggregator(groupBy []string, aggregations ...Aggregation) *Aggregator {
+	return &Aggregator{GroupBy: groupBy, Aggregations: aggregations}
+}
+
+// ProcessData adds the records to their groups.
+func (a *Aggregator) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	for _, o := range objects {
+		if err := a.Add(o); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+}
+
+// Add adds a single record to its group.
+func (a *Aggregator) Add(record map[string]interface{}) error {
+	keys := make([]interface{}, len(a.GroupBy))
+	for i, field := range a.GroupBy {
+		keys[i], _ = util.LookupField(record, field)
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	groupKey := string(b)
+
+	g, ok := a.groups[groupKey]
+	if !ok {
+		g = &aggregateGroup{keys: keys, accumulators: make([]Accumulator, len(a.Aggregations))}
+		for i, agg := range a.Aggregations {
+			g.accumulators[i] = agg.NewAccumulator()
+		}
+		if a.groups == nil {
+			a.groups = make(map[string]*aggregateGroup)
+		}
+		a.groups[groupKey] = g
+		a.order = append(a.order, groupKey)
+	}
+	for i, agg := range a.Aggregations {
+		var v interface{}
+		present := true
+		if agg.Field != "" {
+			v, present = util.LookupField(record, agg.Field)
+		}
+		g.accumulators[i].Add(v, present)
+	}
+	return nil
+}
+
+// Rows returns the aggregated rows for the records added so far.
+func (a *Aggregator) Rows() []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(a.order))
+	for _, groupKey := range a.order {
+		g := a.groups[groupKey]
+		row := make(map[string]interface{}, len(a.GroupBy)+len(a.Aggregations))
+		for i, field := range a.GroupBy {
+			row[field] = g.keys[i]
+		}
+		for i, agg := range a.Aggregations {
+			row[agg.As] = g.accumulators[i].Result()
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Flush sends the aggregated rows to outputChan (if there are any) and
+// starts again with no groups. It's called by Finish, and can be used to
+// emit rows per window.
+func (a *Aggregator) Flush(outputChan chan data.JSON) error {
+	rows := a.Rows()
+	a.groups = nil
+	a.order = nil
+	if len(rows) == 0 {
+		return nil
+	}
+	d, err := data.NewJSON(rows)
+	if err != nil {
+		return err
+	}
+	outputChan <- d
+	return nil
+}
+
+// Finish sends the aggregated rows.
+func (a *Aggregator) Finish(outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(a.Flush(outputChan), killChan)
+}
+
+func (a *Aggregator) String() string {
+	return "Aggregator(" + strings.Join(a.GroupBy, ",") + ")"
+}
+
+// Count counts the records in each group.
+func Count(as string) Aggregation {
+	return Aggregation{As: as, NewAccumulator: func() Accumulator { return &countAccumulator{} }}
+}
+
+// Sum adds up the numeric values of the field.
+func Sum(field, as string) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator { return &sumAccumulator{} }}
+}
+
+// Avg averages the numeric values of the field, or is null if there are
+// none.
+func Avg(field, as string) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator { return &sumAccumulator{avg: true} }}
+}
+
+// Min finds the smallest value of the field. Numbers and strings can be
+// compared (see util.CompareValues), other values are ignored.
+func Min(field, as string) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator { return &extremeAccumulator{want: -1} }}
+}
+
+// Max finds the largest value of the field. See Min.
+func Max(field, as string) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator { return &extremeAccumulator{want: 1} }}
+}
+
+// First takes the value of the field from the first record that has it.
+func First(field, as string) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator { return &firstLastAccumulator{} }}
+}
+
+// Last takes the value of the field from the last record that has it.
+func Last(field, as string) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator { return &firstLastAccumulator{last: true} }}
+}
+
+// Reduce aggregates the values of the field with a custom function, which
+// is called with the result so far (starting with initial) and each value
+// the field has.
+func Reduce(field, as string, initial interface{}, fn func(acc, v interface{}) interface{}) Aggregation {
+	return Aggregation{Field: field, As: as, NewAccumulator: func() Accumulator {
+		return &reduceAccumulator{acc: initial, fn: fn}
+	}}
+}
+
+type countAccumulator struct {
+	n int
+}
+
+func (c *countAccumulator) Add(v interface{}, present bool) { c.n++ }
+func (c *countAccumulator) Result() interface{}             { return c.n }
+
+type sumAccumulator struct {
+	avg   bool
+	sum   float64
+	count int
+}
+
+func (s *sumAccumulator) Add(v interface{}, present bool) {
+	if f, ok := v.(float64); ok {
+		s.sum += f
+		s.count++
+	}
+}
+
+func (s *sumAccumulator) Result() interface{} {
+	if !s.avg {
+		return s.sum
+	}
+	if s.count == 0 {
+		return nil
+	}
+	return s.sum / float64(s.count)
+}
+
+type extremeAccumulator struct {
+	want  int
+	value interface{}
+}
+
+func (e *extremeAccumulator) Add(v interface{}, present bool) {
+	if e.value == nil {
+		if _, ok := util.CompareValues(v, v); ok {
+			e.value = v
+		}
+		return
+	}
+	if c, ok := util.CompareValues(v, e.value); ok && c == e.want {
+		e.value = v
+	}
+}
+
+func (e *extremeAccumulator) Result() interface{} { return e.value }
+
+type firstLastAccumulator struct {
+	last  bool
+	seen  bool
+	value interface{}
+}
+
+func (f *firstLastAccumulator) Add(v interface{}, present bool) {
+	if present && (f.last || !f.seen) {
+		f.value = v
+		f.seen = true
+	}
+}
+
+func (f *firstLastAccumulator) Result() interface{} { return f.value }
+
+type reduceAccumulator struct {
+	acc interface{}
+	fn  func(acc, v interface{}) interface{}
+}
+
+func (r *reduceAccumulator) Add(v interface{}, present bool) {
+	if present {
+		r.acc = r.fn(r.acc, v)
+	}
+}
+
+func (r *reduceAccumulator) Result() interface{} { return r.acc }
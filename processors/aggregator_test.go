@@ -0,0 +1,35 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleAggregator() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"region":"eu","amount":10}
+{"region":"us","amount":5}
+{"region":"eu","amount":30}
+`))
+	aggregator := processors.NewAggregator([]string{"region"},
+		processors.Count("orders"),
+		processors.Sum("amount", "total"),
+		processors.Max("amount", "largest"),
+	)
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, aggregator, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"largest":30,"orders":2,"region":"eu","total":40}
+	// {"largest":5,"orders":1,"region":"us","total":5}
+}
@@ -0,0 +1,160 @@
+package processors
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"strconv"
+	"unicode"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Anonymizer masks personal data in the records it receives, e.g. before
+// copying production data to an analytics store, with a strategy for each
+// field:
+//
+//	processors.NewAnonymizer(
+//		processors.MaskHMAC("email", key),
+//		processors.MaskPartial("card", 0, 4, '*'),
+//		processors.MaskNull("notes"),
+//	)
+//
+// Incoming data can be a single JSON object or an array of objects, and the
+// records keep the same shape. Missing and null fields are left as they are.
+type Anonymizer struct {
+	Rules []AnonymizeRule
+}
+
+// AnonymizeRule masks the value of a single field.
+type AnonymizeRule struct {
+	Field string // Dotted path to the field
+	Mask  func(v interface{}) interface{}
+}
+
+// NewAnonymizer returns a new Anonymizer applying the given rules.
+func NewAnonymizer(rules ...AnonymizeRule) *Anonymizer {
+	return &Anonymizer{Rules: rules}
+}
+
+// ProcessData masks the fields of each record.
+func (a *Anonymizer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+	for _, o := range objects {
+		a.Anonymize(o)
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Anonymize masks the fields of a single record in place.
+func (a *Anonymizer) Anonymize(record map[string]interface{}) {
+	for _, rule := range a.Rules {
+		if v, ok := util.LookupField(record, rule.Field); ok && v != nil {
+			util.SetField(record, rule.Field, rule.Mask(v))
+		}
+	}
+}
+
+// Finish - see interface for documentation.
+func (a *Anonymizer) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (a *Anonymizer) String() string {
+	return "Anonymizer"
+}
+
+// MaskHash replaces the field with the hex SHA-256 hash of the salt and
+// its value. The same values always have the same hash, so they can still
+// be joined and counted.
+func MaskHash(field, salt string) AnonymizeRule {
+	return AnonymizeRule{Field: field, Mask: func(v interface{}) interface{} {
+		sum := sha256.Sum256([]byte(salt + valueString(v)))
+		return hex.EncodeToString(sum[:])
+	}}
+}
+
+// MaskHMAC replaces the field with the hex HMAC-SHA-256 of its value. Unlike
+// MaskHash, values can't be recovered by hashing guesses without the key.
+func MaskHMAC(field string, key []byte) AnonymizeRule {
+	return AnonymizeRule{Field: field, Mask: func(v interface{}) interface{} {
+		return hex.EncodeToString(maskHMAC(key, v))
+	}}
+}
+
+// MaskPartial replaces all but the first keepFirst and last keepLast
+// characters of the field with maskChar, e.g. MaskPartial("card", 0, 4, '*')
+// masks "4111111111111111" as "************1111". Values that are too short
+// are masked completely.
+func MaskPartial(field string, keepFirst, keepLast int, maskChar rune) AnonymizeRule {
+	return AnonymizeRule{Field: field, Mask: func(v interface{}) interface{} {
+		runes := []rune(valueString(v))
+		first, last := keepFirst, keepLast
+		if first+last >= len(runes) {
+			first, last = 0, 0
+		}
+		for i := first; i < len(runes)-last; i++ {
+			runes[i] = maskChar
+		}
+		return string(runes)
+	}}
+}
+
+// MaskNull replaces the field with null.
+func MaskNull(field string) AnonymizeRule {
+	return AnonymizeRule{Field: field, Mask: func(v interface{}) interface{} {
+		return nil
+	}}
+}
+
+// MaskFake replaces the field with a fake value in the same format: each
+// digit is replaced with a digit and each letter with a letter of the same
+// case, and anything else (such as punctuation) is kept. So a phone number
+// still looks like a phone number, and an email address like an email
+// address. The fake value is derived from an HMAC of the value with the
+// key, so the same values are always replaced with the same fake values.
+// Numbers are replaced with numbers.
+func MaskFake(field string, key []byte) AnonymizeRule {
+	return AnonymizeRule{Field: field, Mask: func(v interface{}) interface{} {
+		seed := int64(binary.BigEndian.Uint64(maskHMAC(key, v)))
+		r := rand.New(rand.NewSource(seed))
+		runes := []rune(valueString(v))
+		for i, c := range runes {
+			switch {
+			case unicode.IsDigit(c):
+				runes[i] = rune('0' + r.Intn(10))
+			case unicode.IsUpper(c):
+				runes[i] = rune('A' + r.Intn(26))
+			case unicode.IsLower(c):
+				runes[i] = rune('a' + r.Intn(26))
+			}
+		}
+		fake := string(runes)
+		if _, ok := v.(float64); ok {
+			if f, err := strconv.ParseFloat(fake, 64); err == nil {
+				return f
+			}
+		}
+		return fake
+	}}
+}
+
+func maskHMAC(key []byte, v interface{}) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(valueString(v)))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,32 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewAnonymizer() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"email":"ann@example.com","card":"4111111111111111","notes":"VIP"}
+`))
+	anonymizer := processors.NewAnonymizer(
+		processors.MaskHash("email", "salt"),
+		processors.MaskPartial("card", 0, 4, '*'),
+		processors.MaskNull("notes"),
+	)
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, anonymizer, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"card":"************1111","email":"5c989201f82fe09817eba2618ee752050e9e036fe0ce684cd99bc3c032f697b5","id":1,"notes":null}
+}
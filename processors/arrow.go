@@ -0,0 +1,212 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// arrowContinuation is how the messages of an Arrow IPC stream start,
+// which JSON can't.
+var arrowContinuation = []byte{0xff, 0xff, 0xff, 0xff}
+
+// IsArrowPayload returns true if d is an Arrow payload rather than JSON.
+//
+// An Arrow payload is a data.JSON holding a single Arrow record batch, in
+// the IPC streaming format. Columnar data can be passed
+// between stages that understand Arrow payloads, such as ArrowReader and
+// ArrowWriter, without converting each record to JSON and back.
+//
+// Other processors expect JSON, so Arrow payloads should only be sent to
+// stages that handle them, e.g. with ArrowRecordFromPayload or
+// ObjectsFromArrow.
+func IsArrowPayload(d data.JSON) bool {
+	return bytes.HasPrefix(d, arrowContinuation)
+}
+
+// NewArrowPayload returns rec as an Arrow payload.
+func NewArrowPayload(rec arrow.RecordBatch) (data.JSON, error) {
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()))
+	if err := w.Write(rec); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return data.JSON(buf.Bytes()), nil
+}
+
+// ArrowRecordFromPayload returns the record batch of an Arrow payload,
+// which must be released once it's been used.
+func ArrowRecordFromPayload(d data.JSON) (arrow.RecordBatch, error) {
+	r, err := ipc.NewReader(bytes.NewReader(d))
+	if err != nil {
+		return nil, util.DataInvalidError(err)
+	}
+	defer r.Release()
+	if !r.Next() {
+		if r.Err() != nil {
+			return nil, util.DataInvalidError(r.Err())
+		}
+		return nil, util.DataErrorf("Arrow payload without a record batch")
+	}
+	rec := r.RecordBatch()
+	rec.Retain()
+	return rec, nil
+}
+
+// ObjectsFromArrow returns the rows of rec as objects, with the values
+// they'd have in JSON (see arrow.Array's GetOneForMarshal).
+func ObjectsFromArrow(rec arrow.RecordBatch) []map[string]interface{} {
+	objects := make([]map[string]interface{}, rec.NumRows())
+	for i := range objects {
+		objects[i] = make(map[string]interface{}, rec.NumCols())
+	}
+	for j, col := range rec.Columns() {
+		name := rec.ColumnName(j)
+		for i := range objects {
+			objects[i][name] = col.GetOneForMarshal(i)
+		}
+	}
+	return objects
+}
+
+// payloadObjects returns the objects of d, which may be JSON or an Arrow
+// payload.
+func payloadObjects(d data.JSON) ([]map[string]interface{}, error) {
+	if !IsArrowPayload(d) {
+		objects, err := data.ObjectsFromJSON(d)
+		if err != nil {
+			return nil, util.DataInvalidError(err)
+		}
+		return objects, nil
+	}
+	rec, err := ArrowRecordFromPayload(d)
+	if err != nil {
+		return nil, err
+	}
+	defer rec.Release()
+	return ObjectsFromArrow(rec), nil
+}
+
+// ArrowSchemaFor returns a schema for objects, with a nullable field for
+// each of their fields, in sorted order. Each field's type is inferred
+// from its values:
+//
+//   - booleans are Boolean,
+//   - numbers are Int64 if they're all whole, otherwise Float64,
+//   - strings are String,
+//   - objects and arrays are String, holding their JSON,
+//   - fields with values of several kinds, or only nulls, are String.
+func ArrowSchemaFor(objects []map[string]interface{}) *arrow.Schema {
+	types := map[string]arrow.DataType{}
+	for _, o := range objects {
+		for name, v := range o {
+			types[name] = mergeArrowTypes(types[name], arrowTypeOf(v))
+		}
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]arrow.Field, len(names))
+	for i, name := range names {
+		t := types[name]
+		if t == nil {
+			t = arrow.BinaryTypes.String
+		}
+		fields[i] = arrow.Field{Name: name, Type: t, Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// arrowTypeOf returns the type of field v belongs in, or nil for null.
+func arrowTypeOf(v interface{}) arrow.DataType {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case bool:
+		return arrow.FixedWidthTypes.Boolean
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return arrow.PrimitiveTypes.Int64
+	case float32:
+		return arrowTypeOf(float64(vv))
+	case float64:
+		if vv == math.Trunc(vv) && math.Abs(vv) < 1<<63 {
+			return arrow.PrimitiveTypes.Int64
+		}
+		return arrow.PrimitiveTypes.Float64
+	}
+	return arrow.BinaryTypes.String
+}
+
+func mergeArrowTypes(a, b arrow.DataType) arrow.DataType {
+	switch {
+	case a == nil:
+		return b
+	case b == nil || arrow.TypeEqual(a, b):
+		return a
+	case arrow.IsInteger(a.ID()) && arrow.IsFloating(b.ID()),
+		arrow.IsFloating(a.ID()) && arrow.IsInteger(b.ID()):
+		return arrow.PrimitiveTypes.Float64
+	}
+	return arrow.BinaryTypes.String
+}
+
+// ArrowRecordFromObjects returns objects as a record batch with schema,
+// or if it's nil, the schema inferred by ArrowSchemaFor. Values are
+// converted as they would be from JSON, except that String fields take
+// any value, holding the JSON of those that aren't strings. Fields that
+// aren't in schema, and fractions in integer fields, are an error. The record batch must be released once
+// it's been used.
+func ArrowRecordFromObjects(objects []map[string]interface{}, schema *arrow.Schema) (arrow.RecordBatch, error) {
+	if schema == nil {
+		schema = ArrowSchemaFor(objects)
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for _, o := range objects {
+		row := make(map[string]interface{}, len(o))
+		for name, v := range o {
+			i := schema.FieldIndices(name)
+			if len(i) == 0 {
+				return nil, util.DataErrorf("field %q isn't in the Arrow schema", name)
+			}
+			switch t := schema.Field(i[0]).Type.ID(); {
+			case t == arrow.STRING:
+				if _, ok := v.(string); !ok && v != nil {
+					s, err := json.Marshal(v)
+					if err != nil {
+						return nil, util.DataInvalidError(err)
+					}
+					v = string(s)
+				}
+			case arrow.IsInteger(t):
+				// Otherwise the fraction would be dropped.
+				if f, ok := v.(float64); ok && f != math.Trunc(f) {
+					return nil, util.DataErrorf("field %q is an integer in the Arrow schema, not %v", name, f)
+				}
+			}
+			row[name] = v
+		}
+		j, err := json.Marshal(row)
+		if err != nil {
+			return nil, util.DataInvalidError(err)
+		}
+		if err := b.UnmarshalJSON(j); err != nil {
+			return nil, util.DataErrorf("unable to convert record to Arrow: %v", err)
+		}
+	}
+	return b.NewRecordBatch(), nil
+}
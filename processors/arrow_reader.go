@@ -0,0 +1,122 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// ArrowReader reads Arrow IPC data from the given io.Reader, in either the
+// file format (.arrow, also known as Feather) or the streaming format, and
+// sends each record batch on as a JSON array of objects (see
+// ObjectsFromArrow). If ArrowPayloads is set, batches are sent as Arrow
+// payloads instead (see IsArrowPayload), for stages such as ArrowWriter
+// that can take them without going through JSON.
+//
+// Reading the file format needs random access, so if the reader isn't an
+// io.ReaderAt and io.Seeker (as an *os.File is), the file is read into
+// memory first.
+type ArrowReader struct {
+	Reader        io.Reader
+	ArrowPayloads bool
+}
+
+// NewArrowReader returns a new ArrowReader wrapping the given io.Reader object.
+func NewArrowReader(reader io.Reader) *ArrowReader {
+	return &ArrowReader{Reader: reader}
+}
+
+// ProcessData reads the record batches and sends them to outputChan
+func (r *ArrowReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	err := r.ForEachBatch(func(d data.JSON) {
+		outputChan <- d
+	})
+	util.KillPipelineIfErr(err, killChan)
+}
+
+// Finish - see interface for documentation.
+func (r *ArrowReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+// ForEachBatch reads the record batches, passing each one, as JSON or an
+// Arrow payload, to the given func.
+func (r *ArrowReader) ForEachBatch(forEach func(d data.JSON)) error {
+	br := bufio.NewReader(r.Reader)
+	magic, _ := br.Peek(len(arrowFileMagic))
+	if !bytes.Equal(magic, arrowFileMagic) {
+		s, err := ipc.NewReader(br)
+		if err != nil {
+			return util.DataInvalidError(err)
+		}
+		defer s.Release()
+		for s.Next() {
+			if err := r.send(s.RecordBatch(), forEach); err != nil {
+				return err
+			}
+		}
+		if s.Err() != nil {
+			return util.DataInvalidError(s.Err())
+		}
+		return nil
+	}
+
+	// The file reader reads at offsets, so what's been buffered doesn't
+	// matter.
+	ras, ok := r.Reader.(ipc.ReadAtSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		ras = bytes.NewReader(b)
+	}
+	f, err := ipc.NewFileReader(ras)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	defer f.Close()
+	for i := 0; i < f.NumRecords(); i++ {
+		rec, err := f.RecordBatch(i)
+		if err != nil {
+			return util.DataInvalidError(err)
+		}
+		if err := r.send(rec, forEach); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// arrowFileMagic is how Arrow IPC files start.
+var arrowFileMagic = []byte("ARROW1")
+
+func (r *ArrowReader) send(rec arrow.RecordBatch, forEach func(d data.JSON)) error {
+	if rec.NumRows() == 0 {
+		return nil
+	}
+	var d data.JSON
+	var err error
+	if r.ArrowPayloads {
+		d, err = NewArrowPayload(rec)
+	} else {
+		d, err = data.NewJSON(ObjectsFromArrow(rec))
+	}
+	if err != nil {
+		return err
+	}
+	logger.Debug("ArrowReader:", rec.NumRows(), "rows read")
+	forEach(d)
+	return nil
+}
+
+func (r *ArrowReader) String() string {
+	return "ArrowReader"
+}
@@ -0,0 +1,38 @@
+package processors_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewArrowWriter() {
+	logger.LogLevel = logger.LevelSilent
+
+	lines := `{"id":1,"name":"a","tags":["x"]}
+{"id":2,"name":"b","score":1.5}
+`
+	var file bytes.Buffer
+	pipeline := ratchet.NewPipeline(
+		processors.NewJSONLinesReader(strings.NewReader(lines)),
+		processors.NewArrowWriter(&file))
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println("An error occurred in the ratchet pipeline:", err.Error())
+	}
+
+	pipeline = ratchet.NewPipeline(
+		processors.NewArrowReader(bytes.NewReader(file.Bytes())),
+		processors.NewJSONLinesWriter(os.Stdout))
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println("An error occurred in the ratchet pipeline:", err.Error())
+	}
+
+	// Output:
+	// {"id":1,"name":"a","score":null,"tags":"[\"x\"]"}
+	// {"id":2,"name":"b","score":1.5,"tags":null}
+}
@@ -0,0 +1,130 @@
+package processors
+
+import (
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// ArrowWriter writes the records it receives, as JSON or Arrow payloads
+// (see IsArrowPayload), to the given io.Writer as Arrow IPC data, one
+// record batch per payload. It's written in the file format, which is
+// completed in Finish, or if Stream is set, in the streaming format, which
+// can be read as it's written.
+//
+// Every batch has the same schema: Schema if it's set, otherwise the
+// first payload's (inferred for JSON, see ArrowSchemaFor). Payloads with
+// other schemas are converted to it, as by ArrowRecordFromObjects, so
+// they can't have fields it doesn't.
+//
+// Compression may be "lz4" or "zstd" to compress the batches.
+type ArrowWriter struct {
+	Writer      io.Writer
+	Schema      *arrow.Schema
+	Stream      bool
+	Compression string
+
+	schema *arrow.Schema
+	w      interface {
+		Write(rec arrow.RecordBatch) error
+		Close() error
+	}
+}
+
+// NewArrowWriter returns a new ArrowWriter wrapping the given io.Writer object
+func NewArrowWriter(writer io.Writer) *ArrowWriter {
+	return &ArrowWriter{Writer: writer}
+}
+
+// ProcessData writes the payload as a record batch
+func (w *ArrowWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	rec, err := w.record(d)
+	util.KillPipelineIfErr(err, killChan)
+	if rec == nil {
+		return
+	}
+	defer rec.Release()
+	if w.w == nil {
+		err = w.start(rec.Schema())
+		util.KillPipelineIfErr(err, killChan)
+	}
+	err = w.w.Write(rec)
+	util.KillPipelineIfErr(err, killChan)
+	logger.Debug("ArrowWriter:", rec.NumRows(), "rows written")
+}
+
+// record returns d as a record batch with the schema written, or nil if
+// it has no records.
+func (w *ArrowWriter) record(d data.JSON) (arrow.RecordBatch, error) {
+	schema := w.schema
+	if schema == nil {
+		schema = w.Schema
+	}
+	if IsArrowPayload(d) {
+		rec, err := ArrowRecordFromPayload(d)
+		if err != nil {
+			return nil, err
+		}
+		if rec.NumRows() == 0 {
+			rec.Release()
+			return nil, nil
+		}
+		if schema == nil || schema.Equal(rec.Schema()) {
+			return rec, nil
+		}
+		rec.Release()
+	}
+	objects, err := payloadObjects(d)
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	return ArrowRecordFromObjects(objects, schema)
+}
+
+func (w *ArrowWriter) start(schema *arrow.Schema) error {
+	w.schema = schema
+	opts := []ipc.Option{ipc.WithSchema(schema)}
+	switch w.Compression {
+	case "":
+	case "lz4":
+		opts = append(opts, ipc.WithLZ4())
+	case "zstd":
+		opts = append(opts, ipc.WithZstd())
+	default:
+		return util.ConfigErrorf("ArrowWriter: unknown compression %q", w.Compression)
+	}
+	if w.Stream {
+		w.w = ipc.NewWriter(w.Writer, opts...)
+		return nil
+	}
+	fw, err := ipc.NewFileWriter(w.Writer, opts...)
+	if err != nil {
+		return err
+	}
+	w.w = fw
+	return nil
+}
+
+// Finish completes the data written. If nothing was, but Schema is set,
+// it's written with no record batches.
+func (w *ArrowWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	if w.w == nil {
+		if w.Schema == nil {
+			return
+		}
+		err := w.start(w.Schema)
+		util.KillPipelineIfErr(err, killChan)
+	}
+	err := w.w.Close()
+	util.KillPipelineIfErr(err, killChan)
+	w.w, w.schema = nil, nil
+}
+
+func (w *ArrowWriter) String() string {
+	return "ArrowWriter"
+}
@@ -0,0 +1,118 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Batcher merges the payloads it receives into JSON arrays before sending
+// them on, so writers get efficiently sized batches however granular the
+// source is. Incoming data can be a single JSON value or an array, whose
+// elements are batched individually.
+//
+// A batch is sent once it has Size elements, once adding another element
+// would take it over MaxBytes, or once MaxLatency has passed since its
+// first element was received, whichever comes first. Any remaining
+// elements are sent when the Batcher is finished. Elements are passed on
+// as they were received, without being re-encoded.
+type Batcher struct {
+	Size       int           // Defaults to 0, which doesn't limit the number of elements
+	MaxBytes   int           // Defaults to 0, which doesn't limit the size of a batch
+	MaxLatency time.Duration // Defaults to 0, which doesn't limit how long elements are held
+
+	batch      []json.RawMessage
+	bytes      int
+	generation int
+	timer      *time.Timer
+	mutex      sync.Mutex
+}
+
+// NewBatcher returns a new Batcher sending arrays of size elements.
+func NewBatcher(size int) *Batcher {
+	return &Batcher{Size: size}
+}
+
+// ProcessData adds the data to the current batch, sending it when it's full.
+func (b *Batcher) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	elements := []json.RawMessage{json.RawMessage(d)}
+	if trimmed := bytes.TrimSpace(d); len(trimmed) > 0 && trimmed[0] == '[' {
+		elements = nil
+		if err := data.ParseJSONSilent(d, &elements); err != nil {
+			util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+			return
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, e := range elements {
+		// Each element takes its own length, plus a comma or bracket.
+		size := len(e) + 1
+		if b.MaxBytes > 0 && len(b.batch) > 0 && b.bytes+size+1 > b.MaxBytes {
+			b.flush(outputChan)
+		}
+		if len(b.batch) == 0 && b.MaxLatency > 0 {
+			b.startTimer(outputChan)
+		}
+		b.batch = append(b.batch, e)
+		b.bytes += size
+		if b.Size > 0 && len(b.batch) >= b.Size {
+			b.flush(outputChan)
+		}
+	}
+}
+
+// startTimer sends the new batch after MaxLatency, unless it has already
+// been sent by then.
+func (b *Batcher) startTimer(outputChan chan data.JSON) {
+	generation := b.generation
+	b.timer = time.AfterFunc(b.MaxLatency, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if b.generation == generation {
+			b.flush(outputChan)
+		}
+	})
+}
+
+// flush sends the current batch, if there is one, and starts a new one.
+func (b *Batcher) flush(outputChan chan data.JSON) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.generation++
+	if len(b.batch) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	buf.Grow(b.bytes + 1)
+	buf.WriteByte('[')
+	for i, e := range b.batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(e)
+	}
+	buf.WriteByte(']')
+	b.batch = nil
+	b.bytes = 0
+	outputChan <- data.JSON(buf.Bytes())
+}
+
+// Finish sends any remaining elements.
+func (b *Batcher) Finish(outputChan chan data.JSON, killChan chan error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flush(outputChan)
+}
+
+func (b *Batcher) String() string {
+	return fmt.Sprintf("Batcher(%d)", b.Size)
+}
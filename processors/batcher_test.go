@@ -0,0 +1,33 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewBatcher() {
+	logger.LogLevel = logger.LevelSilent
+
+	// Send each line as its own payload.
+	reader := processors.NewIoReader(strings.NewReader(`{"id":1}
+{"id":2}
+{"id":3}
+`))
+	batcher := processors.NewBatcher(2)
+	stdout := processors.NewIoWriter(os.Stdout)
+	stdout.AddNewline = true
+	pipeline := ratchet.NewPipeline(reader, batcher, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// [{"id":1},{"id":2}]
+	// [{"id":3}]
+}
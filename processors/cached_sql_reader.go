@@ -0,0 +1,99 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// CachedSQLReader is a SQLReader that caches query results on disk, so
+// repeated pipeline runs during development, or several branches needing
+// the same reference data, don't have to hit the source database every
+// time. Results are cached per query (see util.QueryCache for how TTL and
+// size limits are applied).
+//
+// CachedSQLReader is composed of a SQLReader, so it supports all of the
+// same properties and usage options (such as static versus dynamic SQL
+// querying).
+type CachedSQLReader struct {
+	SQLReader
+	Cache *util.QueryCache
+}
+
+// NewCachedSQLReader returns a new CachedSQLReader operating in static mode,
+// caching results in cacheDir for up to ttl.
+func NewCachedSQLReader(dbConn *sqlx.DB, sql string, cacheDir string, ttl time.Duration) *CachedSQLReader {
+	return &CachedSQLReader{
+		SQLReader: *NewSQLReader(dbConn, sql),
+		Cache:     &util.QueryCache{Dir: cacheDir, TTL: ttl},
+	}
+}
+
+// NewDynamicCachedSQLReader returns a new CachedSQLReader operating in dynamic mode.
+func NewDynamicCachedSQLReader(dbConn *sqlx.DB, sqlGenerator func(data.JSON) (string, error), cacheDir string, ttl time.Duration) *CachedSQLReader {
+	r := NewCachedSQLReader(dbConn, "", cacheDir, ttl)
+	r.sqlGenerator = sqlGenerator
+	return r
+}
+
+// ProcessData sends cached results if available, otherwise it runs the
+// query, sending and caching the results.
+func (s *CachedSQLReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the query is cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (s *CachedSQLReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	sql, args, err := s.querySQL(d)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	key := util.QueryCacheKey(sql, fmt.Sprint(args), fmt.Sprintf("%d", s.BatchSize), fmt.Sprintf("%T", s.StructDestination))
+
+	found, err := s.Cache.ForEach(key, func(d data.JSON) {
+		outputChan <- d
+	})
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if found {
+		logger.Debug("CachedSQLReader: sent cached results for", sql)
+		return
+	}
+
+	entry, err := s.Cache.NewEntry(key)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	failed := false
+	s.forEachSQLData(ctx, sql, args, func(err error) {
+		failed = true
+		util.KillPipelineIfErr(err, killChan)
+	}, func(d data.JSON) {
+		if err := entry.Write(d); err != nil {
+			logger.Error("CachedSQLReader: unable to write cache -", err)
+		}
+		outputChan <- d
+	})
+	if failed {
+		entry.Abort()
+		return
+	}
+	if err := entry.Commit(); err != nil {
+		logger.Error("CachedSQLReader: unable to write cache -", err)
+	}
+}
+
+func (s *CachedSQLReader) String() string {
+	return "CachedSQLReader"
+}
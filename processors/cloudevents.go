@@ -0,0 +1,302 @@
+package processors
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// CloudEventsSpecVersion is the version of the CloudEvents specification
+// (https://github.com/cloudevents/spec) that events are wrapped in, and
+// that events unwrapped must have.
+const CloudEventsSpecVersion = "1.0"
+
+// cloudEventsAttributes are the context attributes defined by the
+// specification, besides extensions, and the data.
+var cloudEventsAttributes = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true,
+	"datacontenttype": true, "dataschema": true, "subject": true, "time": true,
+	"data": true, "data_base64": true,
+}
+
+// cloudEventsExtensionName matches the names allowed for extension
+// attributes.
+var cloudEventsExtensionName = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
+// CloudEventsWrapper wraps each record it receives in a CloudEvents v1.0
+// envelope, in the structured JSON format
+// ({"specversion": "1.0", "id": ..., "source": ..., "type": ..., "data":
+// <record>}), e.g. for a CloudEventsHTTPWriter, or a writer to a broker.
+//
+// Each event's type is Type, or the record's value for TypeField if it
+// has one. Its id is the record's value for IDField, or a random UUID, and
+// its time the value (in RFC 3339 format) for TimeField, or the time it
+// was wrapped. SubjectField optionally sets its subject. Fields are dotted
+// paths, and are left in the data. Extensions are set on every event.
+//
+// Incoming data can be a single JSON object or an array of objects, and the
+// events keep the same shape.
+type CloudEventsWrapper struct {
+	Source       string
+	Type         string
+	TypeField    string
+	IDField      string
+	TimeField    string
+	SubjectField string
+	DataSchema   string
+	Extensions   map[string]string
+}
+
+// NewCloudEventsWrapper returns a new CloudEventsWrapper wrapping records in
+// events of the given source and type.
+func NewCloudEventsWrapper(source, eventType string) *CloudEventsWrapper {
+	return &CloudEventsWrapper{Source: source, Type: eventType}
+}
+
+// ProcessData wraps each record in an event.
+func (w *CloudEventsWrapper) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if err := w.validate(); err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	for i, o := range objects {
+		if objects[i], err = w.Wrap(o, now); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+func (w *CloudEventsWrapper) validate() error {
+	if w.Source == "" {
+		return util.ConfigErrorf("CloudEventsWrapper: a source is required")
+	}
+	if w.Type == "" && w.TypeField == "" {
+		return util.ConfigErrorf("CloudEventsWrapper: a type or type field is required")
+	}
+	for name := range w.Extensions {
+		if cloudEventsAttributes[name] || !cloudEventsExtensionName.MatchString(name) {
+			return util.ConfigErrorf("CloudEventsWrapper: invalid extension name %q", name)
+		}
+	}
+	return nil
+}
+
+// Wrap returns the event wrapping record, which was received at now.
+func (w *CloudEventsWrapper) Wrap(record map[string]interface{}, now time.Time) (map[string]interface{}, error) {
+	event := map[string]interface{}{
+		"specversion":     CloudEventsSpecVersion,
+		"source":          w.Source,
+		"type":            w.Type,
+		"datacontenttype": "application/json",
+		"data":            record,
+	}
+	for name, v := range w.Extensions {
+		event[name] = v
+	}
+	if w.DataSchema != "" {
+		event["dataschema"] = w.DataSchema
+	}
+	if w.TypeField != "" {
+		if v, ok := util.LookupField(record, w.TypeField); ok && v != nil {
+			event["type"] = valueString(v)
+		} else if w.Type == "" {
+			return nil, util.DataErrorf("CloudEventsWrapper: record without %v", w.TypeField)
+		}
+	}
+	event["id"] = newUUID()
+	if w.IDField != "" {
+		v, ok := util.LookupField(record, w.IDField)
+		if !ok || v == nil {
+			return nil, util.DataErrorf("CloudEventsWrapper: record without %v", w.IDField)
+		}
+		event["id"] = valueString(v)
+	}
+	event["time"] = now.Format(time.RFC3339Nano)
+	if w.TimeField != "" {
+		if v, ok := util.LookupField(record, w.TimeField); ok && v != nil {
+			s, _ := v.(string)
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return nil, util.DataErrorf("CloudEventsWrapper: %v isn't an RFC 3339 time: %v", w.TimeField, v)
+			}
+			event["time"] = s
+		}
+	}
+	if w.SubjectField != "" {
+		if v, ok := util.LookupField(record, w.SubjectField); ok && v != nil {
+			event["subject"] = valueString(v)
+		}
+	}
+	return event, nil
+}
+
+// Finish - see interface for documentation.
+func (w *CloudEventsWrapper) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (w *CloudEventsWrapper) String() string {
+	return "CloudEventsWrapper"
+}
+
+// CloudEventsUnwrapper sends the data of the CloudEvents it receives, in
+// the structured JSON format, singly or in batches (arrays). Data in
+// data_base64 is decoded, and used as JSON if it is, like data holding a
+// JSON string with a JSON datacontenttype. Data that isn't an object is
+// sent as {"data": <data>}, and events without data are dropped.
+//
+// Set AttributesField to keep each event's context attributes (id, source,
+// type, time, extensions, etc.) in that field of its record. Events that
+// aren't CloudEvents v1.0, or miss a required attribute, are an error.
+type CloudEventsUnwrapper struct {
+	AttributesField string
+}
+
+// NewCloudEventsUnwrapper returns a new CloudEventsUnwrapper.
+func NewCloudEventsUnwrapper() *CloudEventsUnwrapper {
+	return &CloudEventsUnwrapper{}
+}
+
+// ProcessData sends the data of each event.
+func (u *CloudEventsUnwrapper) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	records := make([]map[string]interface{}, 0, len(objects))
+	for _, o := range objects {
+		record, err := u.Unwrap(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+	var dd data.JSON
+	if len(records) == len(objects) {
+		dd, err = objectsJSON(d, records)
+	} else {
+		dd, err = data.NewJSON(records)
+	}
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Unwrap returns the record in an event, or nil if it has no data.
+func (u *CloudEventsUnwrapper) Unwrap(event map[string]interface{}) (map[string]interface{}, error) {
+	if err := validateCloudEvent(event); err != nil {
+		return nil, util.DataErrorf("CloudEventsUnwrapper: %v", err)
+	}
+	value, ok, err := cloudEventData(event)
+	if err != nil || !ok {
+		return nil, err
+	}
+	record, isObject := value.(map[string]interface{})
+	if !isObject {
+		record = map[string]interface{}{"data": value}
+	}
+	if u.AttributesField != "" {
+		attributes := make(map[string]interface{}, len(event))
+		for name, v := range event {
+			if name != "data" && name != "data_base64" {
+				attributes[name] = v
+			}
+		}
+		util.SetField(record, u.AttributesField, attributes)
+	}
+	return record, nil
+}
+
+// validateCloudEvent returns an error if event isn't a CloudEvents v1.0
+// event with the required attributes.
+func validateCloudEvent(event map[string]interface{}) error {
+	if v := event["specversion"]; v != CloudEventsSpecVersion {
+		return fmt.Errorf("unsupported specversion %v", v)
+	}
+	for _, name := range []string{"id", "source", "type"} {
+		if s, _ := event[name].(string); s == "" {
+			return fmt.Errorf("event without %v", name)
+		}
+	}
+	return nil
+}
+
+// cloudEventData returns the data of an event, and false if it has none.
+func cloudEventData(event map[string]interface{}) (interface{}, bool, error) {
+	contentType, _ := event["datacontenttype"].(string)
+	if encoded, ok := event["data_base64"]; ok && encoded != nil {
+		s, _ := encoded.(string)
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, false, util.DataErrorf("CloudEventsUnwrapper: invalid data_base64: %v", err)
+		}
+		return cloudEventsBody(b), true, nil
+	}
+	v, ok := event["data"]
+	if !ok || v == nil {
+		return nil, false, nil
+	}
+	// JSON data may be sent as a string holding it.
+	if s, isString := v.(string); isString && isJSONContentType(contentType) {
+		return cloudEventsBody([]byte(s)), true, nil
+	}
+	return v, true, nil
+}
+
+// cloudEventsBody returns data as the JSON value it holds, or as a
+// string if it isn't JSON.
+func cloudEventsBody(b []byte) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err == nil {
+		return v
+	}
+	return string(b)
+}
+
+// isJSONContentType returns true for JSON media types, such as
+// application/json and application/vnd.example+json.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Finish - see interface for documentation.
+func (u *CloudEventsUnwrapper) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (u *CloudEventsUnwrapper) String() string {
+	return "CloudEventsUnwrapper"
+}
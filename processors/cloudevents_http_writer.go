@@ -0,0 +1,274 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// The modes in which a CloudEventsHTTPWriter sends events.
+const (
+	CloudEventsStructured = "structured"
+	CloudEventsBinary     = "binary"
+	CloudEventsBatch      = "batch"
+)
+
+// CloudEventsHTTPWriter POSTs the CloudEvents it receives (such as those
+// wrapped by a CloudEventsWrapper, in the structured JSON format) to URL,
+// e.g. a Knative broker or an event bus's HTTP endpoint, following the
+// CloudEvents HTTP protocol binding. Mode is one of:
+//
+//   - CloudEventsStructured (the default): one request per event, with
+//     the event as its body (application/cloudevents+json),
+//   - CloudEventsBinary: one request per event, with the event's data as
+//     its body, and its other attributes in ce- headers,
+//   - CloudEventsBatch: one request per payload, or per BatchSize events,
+//     with the events as an array (application/cloudevents-batch+json).
+//
+// In the batch mode, AdaptiveBatchSize can choose the number of events per
+// request instead, adjusting it to how long requests take and whether they
+// fail (see util.AdaptiveBatchSize). A request rejected as too large (413)
+// is then split up and sent again, rather than failing the Pipeline, unless
+// it can't be made smaller.
+//
+// Header is added to every request. Requests that fail with a network
+// error, or a 408, 429 or 5xx status, are retried as configured by Retry.
+// Other failures stop the Pipeline, as invalid data for a 400, 413 or 422
+// status, or an invalid config for a 401, 403 or 404.
+type CloudEventsHTTPWriter struct {
+	URL    string
+	Mode   string
+	Header http.Header
+	Client *http.Client
+	Retry  RetryPolicy
+	// BatchSize limits the events per request in the batch mode.
+	BatchSize         int
+	AdaptiveBatchSize *util.AdaptiveBatchSize
+}
+
+// NewCloudEventsHTTPWriter returns a new CloudEventsHTTPWriter sending
+// events to url in the structured mode.
+func NewCloudEventsHTTPWriter(url string) *CloudEventsHTTPWriter {
+	return &CloudEventsHTTPWriter{URL: url, Mode: CloudEventsStructured, Header: http.Header{}, Client: &http.Client{}, Retry: DefaultRetryPolicy}
+}
+
+// ProcessData - see interface for documentation.
+func (w *CloudEventsHTTPWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	w.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx sends the payload's events. Requests are cancelled when
+// ctx is done. See ratchet.ContextDataProcessor.
+func (w *CloudEventsHTTPWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(w.send(ctx, d), killChan)
+}
+
+func (w *CloudEventsHTTPWriter) send(ctx context.Context, d data.JSON) error {
+	events, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	for _, e := range events {
+		if err := validateCloudEvent(e); err != nil {
+			return util.DataErrorf("CloudEventsHTTPWriter: %v", err)
+		}
+	}
+	switch w.Mode {
+	case "", CloudEventsStructured:
+		for _, e := range events {
+			body, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if _, err := w.post(ctx, body, http.Header{"Content-Type": {"application/cloudevents+json; charset=UTF-8"}}, 0); err != nil {
+				return err
+			}
+		}
+	case CloudEventsBinary:
+		for _, e := range events {
+			body, header, err := cloudEventBinary(e)
+			if err != nil {
+				return err
+			}
+			if _, err := w.post(ctx, body, header, 0); err != nil {
+				return err
+			}
+		}
+	case CloudEventsBatch:
+		return w.sendBatches(ctx, events)
+	default:
+		return util.ConfigErrorf("CloudEventsHTTPWriter: unknown mode %q", w.Mode)
+	}
+	return nil
+}
+
+// cloudEventBinary returns the body and headers of an event in the binary
+// mode.
+func cloudEventBinary(event map[string]interface{}) ([]byte, http.Header, error) {
+	header := http.Header{}
+	names := make([]string, 0, len(event))
+	for name := range event {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch v := event[name]; name {
+		case "data", "data_base64":
+		case "datacontenttype":
+			header.Set("Content-Type", valueString(v))
+		default:
+			if v != nil {
+				header.Set("ce-"+name, cloudEventsHeaderValue(valueString(v)))
+			}
+		}
+	}
+
+	if encoded, ok := event["data_base64"].(string); ok {
+		body, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, nil, util.DataErrorf("CloudEventsHTTPWriter: invalid data_base64: %v", err)
+		}
+		return body, header, nil
+	}
+	v, ok := event["data"]
+	if !ok {
+		return nil, header, nil
+	}
+	contentType := header.Get("Content-Type")
+	if s, isString := v.(string); isString && contentType != "" && !isJSONContentType(contentType) {
+		return []byte(s), header, nil
+	}
+	if contentType == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	body, err := json.Marshal(v)
+	return body, header, err
+}
+
+// cloudEventsHeaderValue percent-encodes the characters that can't be in
+// an attribute's header value as they are.
+func cloudEventsHeaderValue(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// sendBatches sends events in the batch mode.
+func (w *CloudEventsHTTPWriter) sendBatches(ctx context.Context, events []map[string]interface{}) error {
+	header := http.Header{"Content-Type": {"application/cloudevents-batch+json; charset=UTF-8"}}
+	for len(events) > 0 {
+		n := w.BatchSize
+		if w.AdaptiveBatchSize != nil {
+			n = w.AdaptiveBatchSize.Size()
+		}
+		if n <= 0 || n > len(events) {
+			n = len(events)
+		}
+		body, err := json.Marshal(events[:n])
+		if err != nil {
+			return err
+		}
+		status, err := w.post(ctx, body, header, n)
+		if err != nil && status == http.StatusRequestEntityTooLarge && w.AdaptiveBatchSize != nil && w.AdaptiveBatchSize.Size() < n {
+			logger.Info("CloudEventsHTTPWriter: batch of", n, "events too large, splitting it")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+// post sends a request, retrying it if it fails with a transient error,
+// and returns the status of the last attempt. Each attempt of a request
+// with a batch of events is observed by AdaptiveBatchSize.
+func (w *CloudEventsHTTPWriter) post(ctx context.Context, body []byte, header http.Header, batch int) (int, error) {
+	retryable := w.Retry.Retryable
+	if retryable == nil {
+		retryable = util.IsTransient
+	}
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		status, err := w.postOnce(ctx, body, header)
+		if batch > 0 && w.AdaptiveBatchSize != nil && ctx.Err() == nil {
+			w.AdaptiveBatchSize.Observe(batch, time.Since(start), err)
+		}
+		if err == nil {
+			return status, nil
+		}
+		if !retryable(err) || attempt >= w.Retry.MaxAttempts || ctx.Err() != nil {
+			return status, err
+		}
+		logger.Info("CloudEventsHTTPWriter: attempt", attempt, "failed, retrying:", err)
+		if err := sleepContext(ctx, w.Retry.Backoff(attempt)); err != nil {
+			return status, err
+		}
+	}
+}
+
+// postOnce sends a request, and returns its status (0 if it couldn't be
+// sent) and an error if it failed.
+func (w *CloudEventsHTTPWriter) postOnce(ctx context.Context, body []byte, header http.Header) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, util.ConfigInvalidError(err)
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, util.TransientError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("CloudEventsHTTPWriter: %v from %v: %s", resp.Status, w.URL, bytes.TrimSpace(msg))
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return resp.StatusCode, util.TransientError(err)
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusRequestEntityTooLarge, resp.StatusCode == http.StatusUnprocessableEntity:
+		return resp.StatusCode, util.DataInvalidError(err)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusNotFound:
+		return resp.StatusCode, util.ConfigInvalidError(err)
+	}
+	return resp.StatusCode, err
+}
+
+// Finish - see interface for documentation.
+func (w *CloudEventsHTTPWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (w *CloudEventsHTTPWriter) String() string {
+	return "CloudEventsHTTPWriter"
+}
@@ -0,0 +1,89 @@
+package processors_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// eventBatches is a CloudEvents endpoint recording the number of events in
+// each batch it receives, which rejects batches of more than limit events
+// as too large, if limit is set.
+type eventBatches struct {
+	limit   int
+	batches []int
+	mutex   sync.Mutex
+}
+
+func (b *eventBatches) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var events []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.mutex.Lock()
+	b.batches = append(b.batches, len(events))
+	b.mutex.Unlock()
+	if b.limit > 0 && len(events) > b.limit {
+		http.Error(w, "too many events", http.StatusRequestEntityTooLarge)
+	}
+}
+
+func cloudEvents(n int) data.JSON {
+	events := make([]string, n)
+	for i := range events {
+		events[i] = fmt.Sprintf(`{"specversion":"1.0","id":"%d","source":"test","type":"test.event"}`, i+1)
+	}
+	return data.JSON("[" + strings.Join(events, ",") + "]")
+}
+
+func TestCloudEventsHTTPWriterAdaptiveBatchSize(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name     string
+		adaptive *util.AdaptiveBatchSize
+		limit    int
+		events   int
+		want     []int
+		failed   bool
+	}{
+		// Fast requests grow the batches, up to Max.
+		{"grows", util.NewAdaptiveBatchSize(2, 1, 4, time.Second), 0, 12, []int{2, 3, 4, 3}, false},
+		// Rejected batches are halved and sent again.
+		{"splits", util.NewAdaptiveBatchSize(4, 1, 8, time.Second), 2, 6, []int{4, 2, 3, 1, 2, 1}, false},
+		{"can't split", util.NewAdaptiveBatchSize(2, 2, 8, time.Second), 1, 6, []int{2}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := &eventBatches{limit: test.limit}
+			server := httptest.NewServer(endpoint)
+			defer server.Close()
+
+			w := processors.NewCloudEventsHTTPWriter(server.URL)
+			w.Mode = processors.CloudEventsBatch
+			w.BatchSize = 100
+			w.AdaptiveBatchSize = test.adaptive
+			killChan := make(chan error, 1)
+			w.ProcessData(cloudEvents(test.events), nil, killChan)
+			close(killChan)
+			if err := <-killChan; (err != nil) != test.failed {
+				t.Errorf("got error %v, want failed = %v", err, test.failed)
+			}
+			if !reflect.DeepEqual(endpoint.batches, test.want) {
+				t.Errorf("got batches of %v, want %v", endpoint.batches, test.want)
+			}
+		})
+	}
+}
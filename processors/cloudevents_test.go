@@ -0,0 +1,50 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewCloudEventsWrapper() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"order_id":"A1","total":42,"placed_at":"2026-10-17T09:30:00Z"}
+`))
+	wrapper := processors.NewCloudEventsWrapper("/shop/orders", "com.example.order.placed")
+	wrapper.IDField = "order_id"
+	wrapper.TimeField = "placed_at"
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, wrapper, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"data":{"order_id":"A1","placed_at":"2026-10-17T09:30:00Z","total":42},"datacontenttype":"application/json","id":"A1","source":"/shop/orders","specversion":"1.0","time":"2026-10-17T09:30:00Z","type":"com.example.order.placed"}
+}
+
+func ExampleNewCloudEventsUnwrapper() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"specversion":"1.0","id":"A1","source":"/shop/orders","type":"com.example.order.placed","datacontenttype":"application/json","data":{"order_id":"A1","total":42}}
+{"specversion":"1.0","id":"A2","source":"/shop/orders","type":"com.example.order.placed","datacontenttype":"application/json","data_base64":"eyJvcmRlcl9pZCI6IkEyIiwidG90YWwiOjd9"}
+`))
+	unwrapper := processors.NewCloudEventsUnwrapper()
+	unwrapper.AttributesField = "event"
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, unwrapper, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"event":{"datacontenttype":"application/json","id":"A1","source":"/shop/orders","specversion":"1.0","type":"com.example.order.placed"},"order_id":"A1","total":42}
+	// {"event":{"datacontenttype":"application/json","id":"A2","source":"/shop/orders","specversion":"1.0","type":"com.example.order.placed"},"order_id":"A2","total":7}
+}
@@ -0,0 +1,147 @@
+package processors
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// CSVReader streams CSV data from the given io.Reader and sends it on to the
+// next stage as JSON arrays of objects, BatchSize rows at a time, so large
+// files never need to be held in memory all at once. The keys of each object
+// are the column names, either read from the header row or set explicitly
+// with Header.
+//
+// The dialect can be configured for TSV, pipe delimited or other formats by
+// setting Comma, and quoting is handled by encoding/csv (see
+// https://golang.org/pkg/encoding/csv). To read files that escape quotes with
+// something other than a second quote (such as the `\"` written by CSVWriter
+// by default), set QuoteEscape.
+//
+// All values are sent as strings unless a Coerce func is provided, which is
+// called for every value and can convert it to any type. See
+// util.InferCSVValue for a basic implementation.
+type CSVReader struct {
+	Reader           io.Reader
+	Comma            rune     // Field delimiter, defaults to ','. Use '\t' for TSV.
+	Comment          rune     // Lines beginning with this character are ignored.
+	QuoteEscape      string   // Character used to escape quotes within quoted fields, defaults to `"`.
+	LazyQuotes       bool     // See csv.Reader
+	TrimLeadingSpace bool     // See csv.Reader
+	FieldsPerRecord  int      // See csv.Reader
+	HasHeader        bool     // Set to false if the first row is data. Defaults to true.
+	Header           []string // Column names to use instead of the header row.
+	BatchSize        int      // Set to 0 to send all rows in a single payload. Defaults to 1000.
+	Gzipped          bool
+	Coerce           func(column, value string) (interface{}, error)
+}
+
+// NewCSVReader returns a new CSVReader wrapping the given io.Reader object.
+func NewCSVReader(reader io.Reader) *CSVReader {
+	return &CSVReader{Reader: reader, Comma: ',', QuoteEscape: `"`, HasHeader: true, BatchSize: 1000}
+}
+
+// ProcessData reads the CSV rows and sends them in batches to outputChan
+func (r *CSVReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if r.Gzipped {
+		gzReader, err := gzip.NewReader(r.Reader)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		r.Reader = gzReader
+	}
+	r.ForEachBatch(killChan, func(d data.JSON) {
+		outputChan <- d
+	})
+}
+
+// Finish - see interface for documentation.
+func (r *CSVReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+// ForEachBatch reads the CSV rows, passing each batch of objects as a JSON
+// array to the given func.
+func (r *CSVReader) ForEachBatch(killChan chan error, forEach func(d data.JSON)) {
+	reader := csv.NewReader(util.NewCSVEscapeReader(r.Reader, r.QuoteEscape))
+	if r.Comma != 0 {
+		reader.Comma = r.Comma
+	}
+	reader.Comment = r.Comment
+	reader.LazyQuotes = r.LazyQuotes
+	reader.TrimLeadingSpace = r.TrimLeadingSpace
+	reader.FieldsPerRecord = r.FieldsPerRecord
+	reader.ReuseRecord = true
+
+	header := r.Header
+	if r.HasHeader {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if header == nil {
+			header = append([]string{}, record...)
+		}
+	}
+
+	rows := [][]interface{}{}
+	flush := func() bool {
+		if len(rows) == 0 {
+			return true
+		}
+		d, err := data.JSONFromHeaderAndRows(header, rows)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return false
+		}
+		rows = [][]interface{}{}
+		forEach(d)
+		return true
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+			return
+		}
+		for len(header) < len(record) {
+			header = append(header, fmt.Sprintf("column_%d", len(header)+1))
+		}
+		row := make([]interface{}, len(record))
+		for i, v := range record {
+			if r.Coerce == nil {
+				row[i] = v
+				continue
+			}
+			cv, err := r.Coerce(header[i], v)
+			if err != nil {
+				util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+				return
+			}
+			row[i] = cv
+		}
+		rows = append(rows, row)
+		if r.BatchSize > 0 && len(rows) >= r.BatchSize {
+			if !flush() {
+				return
+			}
+		}
+	}
+	flush()
+	logger.Debug("CSVReader: finished reading")
+}
+
+func (r *CSVReader) String() string {
+	return "CSVReader"
+}
@@ -0,0 +1,47 @@
+package processors_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func TestCSVReaderInference(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name   string
+		csv    string
+		coerce func(column, value string) (interface{}, error)
+		want   []string
+	}{
+		{"strings", "id,amount,active\n1,9.5,true\n", nil,
+			[]string{`[{"id":"1","amount":"9.5","active":"true"}]`}},
+		{"inferred", "id,amount,active,note\n1,9.5,true,\n2,NaN,1,Inf\n3,-2,f,x\n", util.InferCSVValue,
+			[]string{`[{"id":1,"amount":9.5,"active":true,"note":null},{"id":2,"amount":"NaN","active":1,"note":"Inf"}]`,
+				`[{"id":3,"amount":-2,"active":"f","note":"x"}]`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := processors.NewCSVReader(strings.NewReader(test.csv))
+			r.BatchSize = 2
+			r.Coerce = test.coerce
+			killChan := make(chan error, 1)
+			var got []string
+			r.ForEachBatch(killChan, func(d data.JSON) {
+				got = append(got, string(d))
+			})
+			if err := firstErr(killChan); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -12,6 +12,9 @@ import (
 // must be a valid JSON object or a slice of valid JSON objects.
 // If you already have Data formatted as a CSV string you can
 // use an IoWriter instead.
+//
+// The header, column order, delimiter, quoting and the representation
+// of null values can all be configured through Parameters.
 type CSVWriter struct {
 	Parameters util.CSVParameters
 }
@@ -0,0 +1,81 @@
+package processors_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func ExampleNewCSVWriter() {
+	logger.LogLevel = logger.LevelSilent
+
+	rows := processors.NewFuncTransformer(func(d data.JSON) data.JSON {
+		return data.JSON(`[{"id":1,"name":"a, b","note":null},{"id":2,"name":"c"}]`)
+	})
+	write := processors.NewCSVWriter(os.Stdout)
+	write.Parameters.Header = []string{"name", "id", "note"}
+	write.Parameters.Comma = '|'
+	write.Parameters.Quoting = util.CSVQuoteMinimal
+	write.Parameters.NullValue = `\N`
+	pipeline := ratchet.NewPipeline(rows, write)
+
+	err := <-pipeline.Run()
+
+	if err != nil {
+		fmt.Println("An error occurred in the ratchet pipeline:", err.Error())
+	}
+
+	// Output:
+	// name|id|note
+	// a, b|1|\N
+	// c|2|\N
+}
+
+func TestCSVWriterPayloads(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+		wantErr bool
+	}{
+		{"array", `[{"b":"x","a":1},{"a":2,"c":true}]`, "\"a\",\"b\"\n\"1\",\"x\"\n\"2\",\"\"\n", false},
+		{"object", `{"a":1}`, "\"a\"\n\"1\"\n", false},
+		{"objects", "{\"a\":1}\n{\"a\":2}", "\"a\"\n\"1\"\n\"2\"\n", false},
+		{"null", `null`, "", false},
+		{"empty array", `[]`, "", false},
+		{"invalid JSON", `[{"a":1},{"a":`, "\"a\"\n\"1\"\n", true},
+		{"not an object", `[{"a":1},"b"]`, "\"a\"\n\"1\"\n", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := processors.NewCSVWriter(&b)
+			killChan := make(chan error, 1)
+			w.ProcessData(data.JSON(test.payload), nil, killChan)
+			w.Parameters.Writer.Flush()
+			if got := b.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			var err error
+			select {
+			case err = <-killChan:
+			default:
+			}
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want an error: %v", err, test.wantErr)
+			}
+			if err != nil && util.ErrorCategoryOf(err) != util.CategoryDataInvalid {
+				t.Errorf("got error %v, want invalid data", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package processors
+
+import (
+	"context"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// deadLetterJSON builds the payload sent to a dead-letter DataProcessor
+// for a rejected record: {"record": <record>, "error": "<error>"}.
+func deadLetterJSON(record interface{}, err error) (data.JSON, error) {
+	return data.NewJSON(map[string]interface{}{
+		"record": record,
+		"error":  err.Error(),
+	})
+}
+
+// processDataErr calls p.ProcessData, returning the first error it sends
+// rather than letting it reach the pipeline's killChan.
+func processDataErr(p ratchet.DataProcessor, d data.JSON, outputChan chan data.JSON) error {
+	return firstKillErr(func(killChan chan error) {
+		p.ProcessData(d, outputChan, killChan)
+	})
+}
+
+// processDataCtxErr is the same as processDataErr, but calls
+// p.ProcessDataCtx if p is a ratchet.ContextDataProcessor.
+func processDataCtxErr(ctx context.Context, p ratchet.DataProcessor, d data.JSON, outputChan chan data.JSON) error {
+	return firstKillErr(func(killChan chan error) {
+		if cp, ok := p.(ratchet.ContextDataProcessor); ok {
+			cp.ProcessDataCtx(ctx, d, outputChan, killChan)
+		} else {
+			p.ProcessData(d, outputChan, killChan)
+		}
+	})
+}
+
+// firstKillErr calls fn with a killChan, and returns the first error sent
+// on it.
+func firstKillErr(fn func(killChan chan error)) error {
+	errs := make(chan error)
+	done := make(chan error)
+	go func() {
+		var first error
+		for err := range errs {
+			if first == nil {
+				first = err
+			}
+		}
+		done <- first
+	}()
+	fn(errs)
+	close(errs)
+	return <-done
+}
@@ -0,0 +1,222 @@
+package processors
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// DebeziumDecoder converts Debezium change events
+// (https://debezium.io/documentation/reference/stable/connectors/), as read
+// from Kafka, Kinesis or a file, into flat records that SQL writers can
+// apply: the row after the change for creates, snapshot reads and updates,
+// and the row before it (or at least its key) for deletes, with the
+// operation ("insert", "update" or "delete", see util.SQLOp) in OpField,
+// e.g. for a SQLiteWriter's OpField. Events may be bare envelopes
+// ({"before": ..., "after": ..., "op": "u", "ts_ms": ...}) or wrapped with
+// their schema by Kafka Connect's JSON converter ({"schema": ...,
+// "payload": <envelope>}). The ChangeEvents sent by MySQLBinlogReader and
+// PostgreSQLReplicationReader are understood too.
+//
+// Tombstones (null events), truncates and messages have no row to apply,
+// so they're dropped.
+//
+// Set TimestampField to keep the time of each change (ts_ms), and
+// TableField to keep its table ("schema.table", or the source's "db.table"
+// for databases without schemas), e.g. for a RoutingSQLWriter's
+// TableField. If PrimaryKeys is set, an update changing them is sent as a
+// delete of the old row followed by an insert of the new one, since it
+// can't be applied as an update of the row with the new keys.
+//
+// Incoming data can be a single JSON object or an array of objects.
+type DebeziumDecoder struct {
+	OpField        string // Defaults to "op"
+	TimestampField string
+	TableField     string
+	PrimaryKeys    []string
+}
+
+// NewDebeziumDecoder returns a new DebeziumDecoder setting each record's
+// operation in "op".
+func NewDebeziumDecoder() *DebeziumDecoder {
+	return &DebeziumDecoder{OpField: "op"}
+}
+
+// ProcessData sends the records changed by the events received.
+func (p *DebeziumDecoder) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	// Not data.ObjectsFromJSON, since arrays of events may have tombstones.
+	var v interface{}
+	if err := data.ParseJSON(d, &v); err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	events, ok := v.([]interface{})
+	if !ok {
+		events = []interface{}{v}
+	}
+	var records []map[string]interface{}
+	for _, e := range events {
+		if e == nil {
+			continue
+		}
+		event, ok := e.(map[string]interface{})
+		if !ok {
+			util.KillPipelineIfErr(util.DataErrorf("DebeziumDecoder: event isn't an object"), killChan)
+			return
+		}
+		decoded, err := p.Decode(event)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		records = append(records, decoded...)
+	}
+	if len(records) == 0 {
+		return
+	}
+	var dd data.JSON
+	var err error
+	if len(records) == 1 {
+		dd, err = objectsJSON(d, records)
+	} else {
+		dd, err = data.NewJSON(records)
+	}
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Decode returns the records changed by a change event: one, two for an
+// update changing PrimaryKeys, or none for events with no row to apply.
+func (p *DebeziumDecoder) Decode(event map[string]interface{}) ([]map[string]interface{}, error) {
+	if payload, ok := event["payload"]; ok {
+		if _, hasSchema := event["schema"]; hasSchema {
+			if payload == nil {
+				return nil, nil
+			}
+			envelope, ok := payload.(map[string]interface{})
+			if !ok {
+				return nil, util.DataErrorf("DebeziumDecoder: payload isn't an object")
+			}
+			event = envelope
+		}
+	}
+	code, _ := event["op"].(string)
+	var op string
+	switch code {
+	case "t", "truncate", "m":
+		logger.Debug("DebeziumDecoder: dropping", code, "event")
+		return nil, nil
+	default:
+		var err error
+		if op, err = util.SQLOp(event, "op", ""); err != nil || code == "" {
+			return nil, util.DataErrorf("DebeziumDecoder: unknown operation %q", code)
+		}
+	}
+
+	before, err := debeziumRow(event, "before")
+	if err != nil {
+		return nil, err
+	}
+	after, err := debeziumRow(event, "after")
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]interface{}
+	switch {
+	case op == util.SQLOpDelete:
+		if before == nil {
+			return nil, util.DataErrorf("DebeziumDecoder: delete without a before row")
+		}
+		records = append(records, p.record(event, before, util.SQLOpDelete))
+	case after == nil:
+		return nil, util.DataErrorf("DebeziumDecoder: %v without an after row", op)
+	case op == util.SQLOpUpdate && before != nil && p.keysChanged(before, after):
+		records = append(records, p.record(event, before, util.SQLOpDelete), p.record(event, after, util.SQLOpInsert))
+	default:
+		records = append(records, p.record(event, after, op))
+	}
+	return records, nil
+}
+
+// debeziumRow returns the row in an event's field, or nil if it's null or
+// missing.
+func debeziumRow(event map[string]interface{}, field string) (map[string]interface{}, error) {
+	switch row := event[field].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return row, nil
+	default:
+		return nil, util.DataErrorf("DebeziumDecoder: %v isn't an object", field)
+	}
+}
+
+// keysChanged returns true if an update changes PrimaryKeys.
+func (p *DebeziumDecoder) keysChanged(before, after map[string]interface{}) bool {
+	for _, k := range p.PrimaryKeys {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			return true
+		}
+	}
+	return false
+}
+
+// record returns a copy of row with the fields set from the event.
+func (p *DebeziumDecoder) record(event, row map[string]interface{}, op string) map[string]interface{} {
+	record := make(map[string]interface{}, len(row)+3)
+	for k, v := range row {
+		record[k] = v
+	}
+	opField := p.OpField
+	if opField == "" {
+		opField = "op"
+	}
+	record[opField] = op
+	if p.TimestampField != "" {
+		ts, ok := event["ts_ms"]
+		if !ok {
+			// ChangeEvents have their time in seconds.
+			if s, isNumber := event["ts"].(float64); isNumber {
+				ts = s * 1000
+			}
+		}
+		record[p.TimestampField] = ts
+	}
+	if p.TableField != "" {
+		record[p.TableField] = debeziumTable(event)
+	}
+	return record
+}
+
+// debeziumTable returns the table an event is from.
+func debeziumTable(event map[string]interface{}) interface{} {
+	source, _ := event["source"].(map[string]interface{})
+	if source == nil {
+		// A ChangeEvent.
+		source = event
+	}
+	table, ok := source["table"]
+	if !ok || table == nil {
+		return nil
+	}
+	for _, field := range []string{"schema", "db"} {
+		if schema, _ := source[field].(string); schema != "" {
+			return fmt.Sprintf("%v.%v", schema, table)
+		}
+	}
+	return table
+}
+
+// Finish - see interface for documentation.
+func (p *DebeziumDecoder) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (p *DebeziumDecoder) String() string {
+	return "DebeziumDecoder"
+}
@@ -0,0 +1,36 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewDebeziumDecoder() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"before":null,"after":{"id":1,"name":"Ann"},"source":{"db":"shop","table":"users"},"op":"c","ts_ms":1792216979000}
+{"schema":{},"payload":{"before":{"id":1,"name":"Ann"},"after":{"id":2,"name":"Ann"},"source":{"db":"shop","table":"users"},"op":"u","ts_ms":1792216980000}}
+null
+{"before":{"id":2},"after":null,"source":{"db":"shop","table":"users"},"op":"d","ts_ms":1792216981000}
+`))
+	decoder := processors.NewDebeziumDecoder()
+	decoder.TableField = "table"
+	decoder.PrimaryKeys = []string{"id"}
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, decoder, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"id":1,"name":"Ann","op":"insert","table":"shop.users"}
+	// {"id":1,"name":"Ann","op":"delete","table":"shop.users"}
+	// {"id":2,"name":"Ann","op":"insert","table":"shop.users"}
+	// {"id":2,"op":"delete","table":"shop.users"}
+}
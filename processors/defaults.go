@@ -0,0 +1,129 @@
+package processors
+
+import (
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Defaults fills in missing and null fields of the records it receives with
+// default values, and rejects records without required fields, so writers
+// (which insert NULL for missing columns) don't silently load incomplete
+// rows:
+//
+//	processors.NewDefaults().
+//		Default("currency", "EUR").
+//		IfNull("discount", 0).
+//		Require("id", "amount")
+//
+// JSON null and missing keys are told apart: Default fills in both,
+// IfMissing only fills in fields the record doesn't have, and IfNull only
+// replaces fields that are null. Defaults are applied before the required
+// fields are checked, and a required field must be present and not null.
+//
+// Records without a required field are handled according to Policy, as by
+// SchemaValidator. Incoming data can be a single JSON object or an array of
+// objects, and the records keep the same shape.
+type Defaults struct {
+	Rules       []DefaultRule
+	Required    []string // Dotted paths
+	Policy      ValidationPolicy
+	ErrorOutput ratchet.DataProcessor
+}
+
+// DefaultRule sets a default value for a field.
+type DefaultRule struct {
+	Field     string // Dotted path to the field
+	Value     interface{}
+	IfMissing bool
+	IfNull    bool
+}
+
+// NewDefaults returns a new Defaults with no rules, using the
+// ValidationKill policy.
+func NewDefaults() *Defaults {
+	return &Defaults{Policy: ValidationKill}
+}
+
+// Default sets a default for the field if it's missing or null.
+func (d *Defaults) Default(field string, value interface{}) *Defaults {
+	d.Rules = append(d.Rules, DefaultRule{Field: field, Value: value, IfMissing: true, IfNull: true})
+	return d
+}
+
+// IfMissing sets a default for the field if the record doesn't have it.
+func (d *Defaults) IfMissing(field string, value interface{}) *Defaults {
+	d.Rules = append(d.Rules, DefaultRule{Field: field, Value: value, IfMissing: true})
+	return d
+}
+
+// IfNull sets a default for the field if it's null.
+func (d *Defaults) IfNull(field string, value interface{}) *Defaults {
+	d.Rules = append(d.Rules, DefaultRule{Field: field, Value: value, IfNull: true})
+	return d
+}
+
+// Require adds required fields.
+func (d *Defaults) Require(fields ...string) *Defaults {
+	d.Required = append(d.Required, fields...)
+	return d
+}
+
+// ProcessData applies the defaults to each record, and checks the required
+// fields.
+func (d *Defaults) ProcessData(dd data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(dd)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	valid := objects[:0]
+	for _, o := range objects {
+		if err := d.Apply(o); err != nil {
+			if !handleInvalidRecord(d, d.Policy, d.ErrorOutput, o, err, outputChan, killChan) {
+				return
+			}
+			continue
+		}
+		valid = append(valid, o)
+	}
+	if len(valid) == 0 {
+		return
+	}
+	out, err := objectsJSON(dd, valid)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- out
+}
+
+// Apply applies the defaults to a single record in place, returning an
+// error if it's missing a required field.
+func (d *Defaults) Apply(record map[string]interface{}) error {
+	for _, rule := range d.Rules {
+		v, ok := util.LookupField(record, rule.Field)
+		if (!ok && rule.IfMissing) || (ok && v == nil && rule.IfNull) {
+			util.SetField(record, rule.Field, rule.Value)
+		}
+	}
+	for _, field := range d.Required {
+		if v, ok := util.LookupField(record, field); !ok {
+			return util.DataErrorf("Defaults: record is missing required field %v", field)
+		} else if v == nil {
+			return util.DataErrorf("Defaults: required field %v is null", field)
+		}
+	}
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (d *Defaults) Finish(outputChan chan data.JSON, killChan chan error) {
+	if d.ErrorOutput != nil {
+		d.ErrorOutput.Finish(outputChan, killChan)
+	}
+}
+
+func (d *Defaults) String() string {
+	return "Defaults"
+}
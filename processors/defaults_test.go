@@ -0,0 +1,37 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewDefaults() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"amount":10}
+{"id":2,"amount":20,"currency":null,"discount":null}
+{"id":3,"discount":5}
+`))
+	defaults := processors.NewDefaults().
+		Default("currency", "EUR").
+		IfMissing("discount", 0).
+		Require("id", "amount")
+	defaults.Policy = processors.ValidationRoute
+	defaults.ErrorOutput = processors.NewJSONLinesWriter(os.Stdout)
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, defaults, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"error":"Defaults: record is missing required field amount","record":{"currency":"EUR","discount":5,"id":3}}
+	// {"amount":10,"currency":"EUR","discount":0,"id":1}
+	// {"amount":20,"currency":"EUR","discount":null,"id":2}
+}
@@ -0,0 +1,136 @@
+package processors
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// DurableBuffer wraps a terminal DataProcessor (usually a writer) so that an
+// outage of its destination doesn't bring down the whole pipeline. When the
+// wrapped processor fails with an error that ShouldDivert accepts (by default,
+// errors categorized as transient - see util.IsTransient), the payload is
+// appended to a durable on-disk queue instead of killing the pipeline. Other
+// branches of a fan-out keep running as normal.
+//
+// Buffered payloads are replayed, in order, once RetryInterval has passed
+// since the last failure, and again when the pipeline finishes. While the
+// queue is non-empty new payloads are queued behind it, so the destination
+// still receives data in the order it was produced. Anything that can't be
+// replayed by the end of the run stays on disk and is replayed first on the
+// next run using the same Path.
+type DurableBuffer struct {
+	Processor     ratchet.DataProcessor
+	Path          string
+	RetryInterval time.Duration
+	ShouldDivert  func(err error) bool
+
+	queue       *util.DiskQueue
+	lastFailure time.Time
+	finishOnce  sync.Once
+	mutex       sync.Mutex
+}
+
+// NewDurableBuffer returns a DurableBuffer wrapping p, queueing failed
+// payloads in the file at path.
+func NewDurableBuffer(p ratchet.DataProcessor, path string) (*DurableBuffer, error) {
+	q, err := util.NewDiskQueue(path)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return &DurableBuffer{
+		Processor:     p,
+		Path:          path,
+		RetryInterval: 30 * time.Second,
+		ShouldDivert:  util.IsTransient,
+		queue:         q,
+	}, nil
+}
+
+// ProcessData passes the data to the wrapped processor, or queues it if the
+// destination is unavailable.
+func (b *DurableBuffer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.queue.Len() > 0 && time.Since(b.lastFailure) >= b.RetryInterval {
+		b.replay(outputChan, killChan)
+	}
+	if b.queue.Len() > 0 {
+		b.enqueue(d, killChan)
+		return
+	}
+	if err := processDataErr(b.Processor, d, outputChan); err != nil {
+		if !b.divert(err) {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		logger.Error("DurableBuffer: destination unavailable, buffering data -", err)
+		b.lastFailure = time.Now()
+		b.enqueue(d, killChan)
+	}
+}
+
+// Finish makes a final attempt to replay buffered data, then finishes the
+// wrapped processor. Data that still can't be delivered is left on disk.
+func (b *DurableBuffer) Finish(outputChan chan data.JSON, killChan chan error) {
+	b.finishOnce.Do(func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if b.queue.Len() > 0 {
+			b.replay(outputChan, killChan)
+		}
+		if n := b.queue.Len(); n > 0 {
+			logger.Error("DurableBuffer:", n, "payloads remain buffered in", b.Path)
+		}
+		b.Processor.Finish(outputChan, killChan)
+	})
+}
+
+func (b *DurableBuffer) String() string {
+	return fmt.Sprintf("DurableBuffer(%v)", b.Processor)
+}
+
+// Buffered returns the number of payloads currently waiting to be replayed.
+func (b *DurableBuffer) Buffered() int {
+	return b.queue.Len()
+}
+
+func (b *DurableBuffer) replay(outputChan chan data.JSON, killChan chan error) {
+	logger.Info("DurableBuffer: replaying", b.queue.Len(), "buffered payloads")
+	var fatal error
+	err := b.queue.Replay(func(d data.JSON) error {
+		err := processDataErr(b.Processor, d, outputChan)
+		if err != nil && !b.divert(err) {
+			fatal = err
+		}
+		return err
+	})
+	if fatal != nil {
+		util.KillPipelineIfErr(fatal, killChan)
+		return
+	}
+	if err != nil {
+		logger.Error("DurableBuffer: destination still unavailable -", err)
+		b.lastFailure = time.Now()
+	}
+}
+
+func (b *DurableBuffer) enqueue(d data.JSON, killChan chan error) {
+	if err := b.queue.Push(d); err != nil {
+		util.KillPipelineIfErr(util.FatalError(err), killChan)
+	}
+}
+
+func (b *DurableBuffer) divert(err error) bool {
+	if b.ShouldDivert == nil {
+		return util.IsTransient(err)
+	}
+	return b.ShouldDivert(err)
+}
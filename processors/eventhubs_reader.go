@@ -0,0 +1,294 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// EventHubsEvent is an event read from an Azure Event Hub, as sent by an
+// EventHubsReader with Metadata set. Body holds the event's body if it's
+// JSON, and otherwise the body as a string.
+type EventHubsEvent struct {
+	PartitionID    string                 `json:"partition_id"`
+	SequenceNumber int64                  `json:"sequence_number"`
+	Offset         string                 `json:"offset"`
+	PartitionKey   string                 `json:"partition_key,omitempty"`
+	EnqueuedTime   time.Time              `json:"enqueued_time"`
+	Properties     map[string]interface{} `json:"properties,omitempty"`
+	Body           json.RawMessage        `json:"body"`
+}
+
+// EventHubsReader reads the events of an Azure Event Hub, from every
+// partition it owns in parallel. Each batch of events received from a
+// partition (of up to BatchSize, waiting at most MaxWait for them) is sent
+// as an array of their bodies, so hubs of JSON objects can go straight to
+// SQL or file writers. Bodies that aren't JSON are sent as strings. With
+// Metadata, each event is sent as an EventHubsEvent instead.
+//
+// Partitions are shared out between the EventHubsReaders reading the hub
+// with the same consumer group, wherever they run, through the ownership
+// kept in Checkpoints (usually in Azure Blob Storage, see
+// checkpoints.NewBlobStore), so a pipeline can be scaled out by running
+// more of it. Reading a partition starts after its checkpoint if there is
+// one, and otherwise at the latest event, or the earliest the hub retains
+// with StartAtEarliest. The last event read from each partition is
+// checkpointed when the Pipeline succeeds (see
+// ratchet.CommittingDataProcessor).
+//
+// If IdleTimeout is set, the reader stops once no events have been
+// received for that long, so it can be run on a schedule (see
+// ratchet.Schedule); otherwise it runs until the Pipeline is cancelled.
+type EventHubsReader struct {
+	BatchSize       int           // Defaults to 100
+	MaxWait         time.Duration // Defaults to 1 second
+	StartAtEarliest bool
+	IdleTimeout     time.Duration
+	Metadata        bool
+
+	consumer    *azeventhubs.ConsumerClient
+	checkpoints azeventhubs.CheckpointStore
+	positions   map[string]eventHubsPosition
+	mutex       sync.Mutex
+}
+
+// eventHubsPosition is the last event read from a partition, and the
+// client it was read with, which checkpoints it.
+type eventHubsPosition struct {
+	client *azeventhubs.ProcessorPartitionClient
+	event  *azeventhubs.ReceivedEventData
+}
+
+// NewEventHubsReader returns a new EventHubsReader reading with consumer,
+// and keeping partition ownership and checkpoints in checkpoints.
+func NewEventHubsReader(consumer *azeventhubs.ConsumerClient, checkpoints azeventhubs.CheckpointStore) *EventHubsReader {
+	return &EventHubsReader{BatchSize: 100, consumer: consumer, checkpoints: checkpoints}
+}
+
+// ProcessData - see interface for documentation.
+func (r *EventHubsReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx reads the hub until the Pipeline is cancelled, or it has
+// been idle for IdleTimeout. See ratchet.ContextDataProcessor.
+func (r *EventHubsReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(r.read(ctx, outputChan), killChan)
+}
+
+func (r *EventHubsReader) read(ctx context.Context, outputChan chan data.JSON) error {
+	opts := &azeventhubs.ProcessorOptions{}
+	if r.StartAtEarliest {
+		earliest := true
+		opts.StartPositions.Default.Earliest = &earliest
+	} else {
+		latest := true
+		opts.StartPositions.Default.Latest = &latest
+	}
+	processor, err := azeventhubs.NewProcessor(r.consumer, r.checkpoints, opts)
+	if err != nil {
+		return util.ConfigInvalidError(err)
+	}
+	r.mutex.Lock()
+	r.positions = map[string]eventHubsPosition{}
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- processor.Run(ctx)
+	}()
+
+	var firstErr error
+	var errMutex sync.Mutex
+	fail := func(err error) {
+		errMutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMutex.Unlock()
+		cancel()
+	}
+	activity := make(chan struct{}, 1)
+	if r.IdleTimeout > 0 {
+		go r.stopWhenIdle(ctx, activity, cancel)
+	}
+
+	var wg sync.WaitGroup
+	for {
+		pc := processor.NextPartitionClient(ctx)
+		if pc == nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.readPartition(ctx, pc, outputChan, activity); err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := <-runErr; err != nil && ctx.Err() == nil {
+		return err
+	}
+	// Cancellation by the Pipeline is reported by it.
+	return firstErr
+}
+
+// stopWhenIdle cancels reading once nothing has been sent on activity for
+// IdleTimeout.
+func (r *EventHubsReader) stopWhenIdle(ctx context.Context, activity chan struct{}, cancel context.CancelFunc) {
+	t := time.NewTimer(r.IdleTimeout)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-activity:
+			if !t.Stop() {
+				<-t.C
+			}
+			t.Reset(r.IdleTimeout)
+		case <-t.C:
+			logger.Info("EventHubsReader: no events for", r.IdleTimeout, "stopping")
+			cancel()
+			return
+		}
+	}
+}
+
+// readPartition reads a partition until ctx is done, or its ownership has
+// been lost to another reader.
+func (r *EventHubsReader) readPartition(ctx context.Context, pc *azeventhubs.ProcessorPartitionClient, outputChan chan data.JSON, activity chan struct{}) error {
+	defer pc.Close(context.Background())
+	partitionID := pc.PartitionID()
+	logger.Info("EventHubsReader: reading partition", partitionID)
+	maxWait := r.MaxWait
+	if maxWait <= 0 {
+		maxWait = time.Second
+	}
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	for {
+		receiveCtx, cancel := context.WithTimeout(ctx, maxWait)
+		events, err := pc.ReceiveEvents(receiveCtx, batchSize, nil)
+		cancel()
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ehErr *azeventhubs.Error
+			if errors.As(err, &ehErr) && ehErr.Code == azeventhubs.ErrorCodeOwnershipLost {
+				logger.Info("EventHubsReader: partition", partitionID, "is now read by another reader")
+				return nil
+			}
+			return err
+		}
+		if len(events) == 0 {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+
+		d, err := r.eventsJSON(partitionID, events)
+		if err != nil {
+			return err
+		}
+		select {
+		case outputChan <- d:
+		case <-ctx.Done():
+			return nil
+		}
+		r.mutex.Lock()
+		r.positions[partitionID] = eventHubsPosition{client: pc, event: events[len(events)-1]}
+		r.mutex.Unlock()
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// eventsJSON returns events as the JSON array sent on.
+func (r *EventHubsReader) eventsJSON(partitionID string, events []*azeventhubs.ReceivedEventData) (data.JSON, error) {
+	values := make([]json.RawMessage, len(events))
+	for i, e := range events {
+		v := json.RawMessage(e.Body)
+		if !json.Valid(e.Body) {
+			b, err := json.Marshal(string(e.Body))
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+		if r.Metadata {
+			event := EventHubsEvent{
+				PartitionID:    partitionID,
+				SequenceNumber: e.SequenceNumber,
+				Offset:         e.Offset,
+				Properties:     e.Properties,
+				Body:           v,
+			}
+			if e.PartitionKey != nil {
+				event.PartitionKey = *e.PartitionKey
+			}
+			if e.EnqueuedTime != nil {
+				event.EnqueuedTime = *e.EnqueuedTime
+			}
+			b, err := json.Marshal(event)
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+		values[i] = v
+	}
+	return data.NewJSON(values)
+}
+
+// Commit checkpoints the last event read from each partition. See
+// ratchet.CommittingDataProcessor.
+func (r *EventHubsReader) Commit() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	partitions := make([]string, 0, len(r.positions))
+	for id := range r.positions {
+		partitions = append(partitions, id)
+	}
+	sort.Strings(partitions)
+	for _, id := range partitions {
+		pos := r.positions[id]
+		logger.Info("EventHubsReader: checkpointing partition", id, "at", pos.event.SequenceNumber)
+		if err := pos.client.UpdateCheckpoint(context.Background(), pos.event, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (r *EventHubsReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+// Close closes the consumer client.
+func (r *EventHubsReader) Close() error {
+	return r.consumer.Close(context.Background())
+}
+
+func (r *EventHubsReader) String() string {
+	return "EventHubsReader"
+}
@@ -0,0 +1,162 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// EventHubsWriter sends the records it receives to an Azure Event Hub,
+// each as an event with its compacted JSON as the body. The records of
+// each payload are packed into as few batches as the hub's size limit
+// allows, which are sent before the next payload is processed.
+//
+// If PartitionKeyField is set, each record's value for it is used as its
+// event's partition key, so the events with the same value go to the same
+// partition, in order. Records without it are an error.
+type EventHubsWriter struct {
+	PartitionKeyField string
+
+	producer *azeventhubs.ProducerClient
+}
+
+// NewEventHubsWriter returns a new EventHubsWriter sending with producer.
+func NewEventHubsWriter(producer *azeventhubs.ProducerClient) *EventHubsWriter {
+	return &EventHubsWriter{producer: producer}
+}
+
+// ProcessData - see interface for documentation.
+func (w *EventHubsWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	w.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx sends the payload's records. Sending is cancelled when
+// ctx is done. See ratchet.ContextDataProcessor.
+func (w *EventHubsWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(w.send(ctx, d), killChan)
+}
+
+func (w *EventHubsWriter) send(ctx context.Context, d data.JSON) error {
+	var objects []json.RawMessage
+	trimmed := bytes.TrimSpace(d)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := data.ParseJSON(trimmed, &objects); err != nil {
+			return util.DataInvalidError(err)
+		}
+	} else {
+		objects = []json.RawMessage{json.RawMessage(trimmed)}
+	}
+
+	// Events are batched by partition key, since it's set per batch.
+	var keys []string
+	bodies := map[string][][]byte{}
+	for _, o := range objects {
+		var body bytes.Buffer
+		if err := json.Compact(&body, o); err != nil {
+			return util.DataInvalidError(err)
+		}
+		key, err := w.partitionKey(o)
+		if err != nil {
+			return err
+		}
+		if _, ok := bodies[key]; !ok {
+			keys = append(keys, key)
+		}
+		bodies[key] = append(bodies[key], body.Bytes())
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := w.sendBatches(ctx, key, bodies[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitionKey returns the partition key of a record, or "" without a
+// PartitionKeyField.
+func (w *EventHubsWriter) partitionKey(o json.RawMessage) (string, error) {
+	if w.PartitionKeyField == "" {
+		return "", nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(o, &fields); err != nil {
+		return "", util.DataErrorf("EventHubsWriter: partition keys need objects: %v", err)
+	}
+	switch v := fields[w.PartitionKeyField].(type) {
+	case nil:
+		return "", util.DataErrorf("EventHubsWriter: record without %v", w.PartitionKeyField)
+	case string:
+		return v, nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// sendBatches sends bodies with the given partition key, in as few
+// batches as they fit in.
+func (w *EventHubsWriter) sendBatches(ctx context.Context, key string, bodies [][]byte) error {
+	opts := &azeventhubs.EventDataBatchOptions{}
+	if key != "" {
+		opts.PartitionKey = &key
+	}
+	contentType := "application/json"
+	var batch *azeventhubs.EventDataBatch
+	for i := 0; i < len(bodies); {
+		if batch == nil {
+			var err error
+			if batch, err = w.producer.NewEventDataBatch(ctx, opts); err != nil {
+				return err
+			}
+		}
+		err := batch.AddEventData(&azeventhubs.EventData{Body: bodies[i], ContentType: &contentType}, nil)
+		if errors.Is(err, azeventhubs.ErrEventDataTooLarge) {
+			if batch.NumEvents() == 0 {
+				return util.DataErrorf("EventHubsWriter: record of %d bytes is too large for an event", len(bodies[i]))
+			}
+			if err := w.sendBatch(ctx, batch); err != nil {
+				return err
+			}
+			batch = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		i++
+	}
+	if batch != nil && batch.NumEvents() > 0 {
+		return w.sendBatch(ctx, batch)
+	}
+	return nil
+}
+
+func (w *EventHubsWriter) sendBatch(ctx context.Context, batch *azeventhubs.EventDataBatch) error {
+	if err := w.producer.SendEventDataBatch(ctx, batch, nil); err != nil {
+		return err
+	}
+	logger.Debug("EventHubsWriter:", batch.NumEvents(), "events sent")
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (w *EventHubsWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+// Close closes the producer client.
+func (w *EventHubsWriter) Close() error {
+	return w.producer.Close(context.Background())
+}
+
+func (w *EventHubsWriter) String() string {
+	return "EventHubsWriter"
+}
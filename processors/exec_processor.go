@@ -0,0 +1,326 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// ExecFormat controls how an ExecProcessor passes data to and from its
+// command.
+type ExecFormat int
+
+const (
+	// ExecJSONLines writes each record to stdin as a line of JSON, and
+	// reads each line of stdout as a JSON record. Incoming data can be a
+	// single JSON object or an array of objects, and the records output
+	// for each payload are sent on as an array.
+	ExecJSONLines ExecFormat = iota
+	// ExecJSON writes each payload to stdin as it is, and sends stdout on
+	// as a single payload, which must be JSON.
+	ExecJSON
+	// ExecRaw is like ExecJSON, but stdout doesn't have to be JSON.
+	ExecRaw
+)
+
+// ExecProcessor pipes data through an external command's stdin and stdout,
+// so existing scripts can take part in pipelines:
+//
+//	p := processors.NewExecProcessor("python3", "enrich.py")
+//
+// By default the command is run for each payload, and is killed if it runs
+// for longer than Timeout. Set Stream to instead start the command once,
+// write every payload to its stdin, and send on each line it writes to
+// stdout as a payload as soon as it's written (with ExecJSON and ExecRaw,
+// payloads are written to stdin one per line). The command's stdin is
+// closed when the ExecProcessor is finished, and the pipeline waits for it
+// to exit; Timeout then applies to the whole run.
+//
+// The pipeline is killed if the command exits with a code not in
+// ExitCodes, with what the command wrote to stderr in the error.
+type ExecProcessor struct {
+	Command   string
+	Args      []string
+	Env       []string // Added to the environment, in "key=value" form
+	Dir       string
+	Format    ExecFormat
+	Stream    bool
+	Timeout   time.Duration // Defaults to 0, which never times out
+	ExitCodes []int         // Successful exit codes, defaults to 0
+
+	stream *execStream
+}
+
+type execStream struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stdin  io.WriteCloser
+	stderr *execStderr
+	done   chan error
+}
+
+// NewExecProcessor returns a new ExecProcessor running the command with the
+// given args for each payload, with ExecJSONLines.
+func NewExecProcessor(command string, args ...string) *ExecProcessor {
+	return &ExecProcessor{Command: command, Args: args}
+}
+
+// ProcessData passes the data through the command.
+func (p *ExecProcessor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	p.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the command is killed
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (p *ExecProcessor) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	input, err := p.input(d)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if p.Stream {
+		util.KillPipelineIfErr(p.write(input, outputChan, killChan), killChan)
+		return
+	}
+
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	cmd, stderr := p.command(ctx)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	logger.Debug("ExecProcessor: running", p.Command, "with", len(input), "bytes")
+	if err := p.checkExit(ctx, cmd.Run(), stderr); err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	output, err := p.output(stdout.Bytes())
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if output != nil {
+		outputChan <- output
+	}
+}
+
+func (p *ExecProcessor) command(ctx context.Context) (*exec.Cmd, *execStderr) {
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Dir = p.Dir
+	if len(p.Env) > 0 {
+		cmd.Env = append(cmd.Environ(), p.Env...)
+	}
+	stderr := &execStderr{}
+	cmd.Stderr = stderr
+	return cmd, stderr
+}
+
+// input returns the data to write to stdin.
+func (p *ExecProcessor) input(d data.JSON) ([]byte, error) {
+	if p.Format != ExecJSONLines {
+		if p.Stream {
+			return append(bytes.TrimRight(d, "\r\n"), '\n'), nil
+		}
+		return d, nil
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return nil, util.DataInvalidError(err)
+	}
+	var buf bytes.Buffer
+	for _, o := range objects {
+		b, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// output returns the payload to send for the command's output, or nil if
+// there's nothing to send.
+func (p *ExecProcessor) output(stdout []byte) (data.JSON, error) {
+	switch p.Format {
+	case ExecRaw:
+		if len(stdout) == 0 {
+			return nil, nil
+		}
+		return data.JSON(stdout), nil
+	case ExecJSON:
+		trimmed := bytes.TrimSpace(stdout)
+		if len(trimmed) == 0 {
+			return nil, nil
+		}
+		if !json.Valid(trimmed) {
+			return nil, util.DataErrorf("ExecProcessor: %v didn't output JSON: %v", p.Command, string(trimmed))
+		}
+		return data.JSON(trimmed), nil
+	}
+	var records []json.RawMessage
+	for _, line := range bytes.Split(stdout, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, util.DataErrorf("ExecProcessor: %v output a line that isn't JSON: %v", p.Command, string(line))
+		}
+		records = append(records, json.RawMessage(line))
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return data.NewJSON(records)
+}
+
+// checkExit returns an error if the command failed.
+func (p *ExecProcessor) checkExit(ctx context.Context, err error, stderr *execStderr) error {
+	if err == nil {
+		return p.checkCode(0, stderr)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return util.TransientError(fmt.Errorf("ExecProcessor: %v timed out after %v", p.Command, p.Timeout))
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 0 {
+		return p.checkCode(exitErr.ExitCode(), stderr)
+	}
+	return util.ConfigInvalidError(fmt.Errorf("ExecProcessor: %v: %v", p.Command, err))
+}
+
+func (p *ExecProcessor) checkCode(code int, stderr *execStderr) error {
+	codes := p.ExitCodes
+	if len(codes) == 0 {
+		codes = []int{0}
+	}
+	for _, c := range codes {
+		if code == c {
+			return nil
+		}
+	}
+	return util.DataErrorf("ExecProcessor: %v exited with code %v: %v", p.Command, code, stderr)
+}
+
+// write writes to the streaming command, starting it if needed.
+func (p *ExecProcessor) write(input []byte, outputChan chan data.JSON, killChan chan error) error {
+	if p.stream == nil {
+		if err := p.start(outputChan, killChan); err != nil {
+			return err
+		}
+	}
+	if _, err := p.stream.stdin.Write(input); err != nil {
+		return fmt.Errorf("ExecProcessor: writing to %v: %v (%v)", p.Command, err, p.stream.stderr)
+	}
+	return nil
+}
+
+func (p *ExecProcessor) start(outputChan chan data.JSON, killChan chan error) error {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if p.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+	}
+	cmd, stderr := p.command(ctx)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return util.ConfigInvalidError(fmt.Errorf("ExecProcessor: %v: %v", p.Command, err))
+	}
+	logger.Debug("ExecProcessor: started", p.Command)
+	s := &execStream{cmd: cmd, cancel: cancel, stdin: stdin, stderr: stderr, done: make(chan error, 1)}
+	p.stream = s
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		var err error
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if p.Format != ExecRaw && !json.Valid(line) {
+				err = util.DataErrorf("ExecProcessor: %v output a line that isn't JSON: %v", p.Command, string(line))
+				break
+			}
+			outputChan <- data.JSON(append([]byte(nil), line...))
+		}
+		if err == nil {
+			err = scanner.Err()
+		}
+		if err != nil {
+			// Stop the command, rather than blocking it on a full pipe.
+			cancel()
+			io.Copy(io.Discard, stdout)
+		}
+		s.done <- p.checkExit(ctx, cmd.Wait(), stderr)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+		}
+	}()
+	return nil
+}
+
+// Finish closes the streaming command's stdin, and waits for it to exit.
+func (p *ExecProcessor) Finish(outputChan chan data.JSON, killChan chan error) {
+	s := p.stream
+	if s == nil {
+		return
+	}
+	p.stream = nil
+	s.stdin.Close()
+	err := <-s.done
+	s.cancel()
+	util.KillPipelineIfErr(err, killChan)
+}
+
+func (p *ExecProcessor) String() string {
+	return "ExecProcessor(" + strings.Join(append([]string{p.Command}, p.Args...), " ") + ")"
+}
+
+// execStderr keeps the end of what a command writes to stderr, for errors.
+type execStderr struct {
+	buf   []byte
+	mutex sync.Mutex
+}
+
+const execStderrMax = 4096
+
+func (e *execStderr) Write(b []byte) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.buf = append(e.buf, b...)
+	if len(e.buf) > execStderrMax {
+		e.buf = e.buf[len(e.buf)-execStderrMax:]
+	}
+	return len(b), nil
+}
+
+func (e *execStderr) String() string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return strings.TrimSpace(string(e.buf))
+}
@@ -0,0 +1,29 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewExecProcessor() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewIoReader(strings.NewReader(`[{"name":"ann"},{"name":"bob"}]`))
+	// Any program reading and writing JSON lines will do.
+	upper := processors.NewExecProcessor("tr", "a-z", "A-Z")
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, upper, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"NAME":"ANN"}
+	// {"NAME":"BOB"}
+}
@@ -0,0 +1,156 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// FieldInjector adds fields to every record it receives, as most warehouse
+// loads need:
+//
+//	processors.NewFieldInjector().
+//		Set("environment", "production").
+//		RunID("run_id").
+//		Timestamp("ingested_at").
+//		Source("source")
+//
+// Fields can be static values, or computed for each record. Field names are
+// dotted paths, and the fields replace any the record already has unless
+// KeepExisting is set. Incoming data can be a single JSON object or an
+// array of objects, and the records keep the same shape.
+type FieldInjector struct {
+	Fields       []InjectedField
+	KeepExisting bool
+
+	sourceField string
+	runIDField  string
+	runID       string
+}
+
+// InjectedField is a field added by a FieldInjector. Value is called with
+// each record, and its result is the field's value.
+type InjectedField struct {
+	Field string
+	Value func(record map[string]interface{}) interface{}
+}
+
+// NewFieldInjector returns a new FieldInjector with no fields.
+func NewFieldInjector() *FieldInjector {
+	return &FieldInjector{}
+}
+
+// Set adds a field with a static value.
+func (f *FieldInjector) Set(field string, value interface{}) *FieldInjector {
+	return f.SetFunc(field, func(map[string]interface{}) interface{} { return value })
+}
+
+// SetFunc adds a field computed from each record.
+func (f *FieldInjector) SetFunc(field string, value func(record map[string]interface{}) interface{}) *FieldInjector {
+	f.Fields = append(f.Fields, InjectedField{Field: field, Value: value})
+	return f
+}
+
+// RunID adds a field with the ID of the pipeline run that loaded the
+// records (see ratchet.RunIDFromContext), which is kept when a failed run is
+// re-run with ratchet.Pipeline.Rerun, so records from an earlier attempt can
+// be replaced. Outside of a Pipeline, a random ID is used, the same for
+// every record the FieldInjector receives.
+func (f *FieldInjector) RunID(field string) *FieldInjector {
+	f.runIDField = field
+	f.runID = newUUID()
+	return f
+}
+
+// Timestamp adds a field with the time each record was received, formatted
+// as RFC 3339 in UTC.
+func (f *FieldInjector) Timestamp(field string) *FieldInjector {
+	return f.SetFunc(field, func(map[string]interface{}) interface{} {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	})
+}
+
+// Source adds a field with the name (String) of the DataProcessor that
+// sent each record, for a FieldInjector in a stage after the first. This is
+// useful when several sources fan in to a FieldInjector.
+func (f *FieldInjector) Source(field string) *FieldInjector {
+	f.sourceField = field
+	return f
+}
+
+// TagSource adds the Source field. See ratchet.SourceTaggingDataProcessor.
+func (f *FieldInjector) TagSource(d data.JSON, source ratchet.DataProcessor) data.JSON {
+	if f.sourceField == "" {
+		return d
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil || len(objects) == 0 {
+		// Leave the data as it is, ProcessData will report it as invalid.
+		return d
+	}
+	name := fmt.Sprint(source)
+	for _, o := range objects {
+		f.set(o, f.sourceField, name)
+	}
+	if tagged, err := objectsJSON(d, objects); err == nil {
+		return tagged
+	}
+	return d
+}
+
+// ProcessData adds the fields to each record.
+func (f *FieldInjector) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	f.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the RunID field is the ID
+// of the run in ctx.
+func (f *FieldInjector) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+	runID := ratchet.RunIDFromContext(ctx)
+	if runID == "" {
+		runID = f.runID
+	}
+	for _, o := range objects {
+		for _, field := range f.Fields {
+			f.set(o, field.Field, field.Value(o))
+		}
+		if f.runIDField != "" {
+			f.set(o, f.runIDField, runID)
+		}
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+func (f *FieldInjector) set(record map[string]interface{}, field string, v interface{}) {
+	if f.KeepExisting {
+		if _, ok := util.LookupField(record, field); ok {
+			return
+		}
+	}
+	util.SetField(record, field, v)
+}
+
+// Finish - see interface for documentation.
+func (f *FieldInjector) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (f *FieldInjector) String() string {
+	return "FieldInjector"
+}
@@ -0,0 +1,36 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewFieldInjector() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"amount":2.5}
+{"id":2,"amount":4,"environment":"staging"}
+`))
+	injector := processors.NewFieldInjector().
+		Set("environment", "production").
+		SetFunc("amount_cents", func(record map[string]interface{}) interface{} {
+			return record["amount"].(float64) * 100
+		}).
+		Source("source")
+	injector.KeepExisting = true
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, injector, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"amount":2.5,"amount_cents":250,"environment":"production","id":1,"source":"JSONLinesReader"}
+	// {"amount":4,"amount_cents":400,"environment":"staging","id":2,"source":"JSONLinesReader"}
+}
@@ -0,0 +1,120 @@
+package processors
+
+import (
+	"sort"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// FieldMapper adapts the fields of the records it receives to a target
+// schema, with rules to keep, rename and drop fields:
+//
+//	mapper := processors.NewFieldMapper().
+//		Keep("id", "customer").
+//		Rename("customer.address.country", "country").
+//		Drop("customer.address")
+//
+// All field names are dotted paths, so nested fields can be flattened
+// (a.b.c -> c) or nested (c -> a.b.c). The rules are applied in that order:
+// if KeepFields is set, every other field is removed (apart from the fields
+// to be renamed); then the RenameFields are moved; then the DropFields are
+// removed. Renames all read the original record, so fields can be swapped.
+//
+// Incoming data can be a single JSON object or an array of objects, and
+// the mapped records keep the same shape.
+type FieldMapper struct {
+	KeepFields   []string
+	RenameFields map[string]string // From path -> to path
+	DropFields   []string
+}
+
+// NewFieldMapper returns a new FieldMapper with no rules.
+func NewFieldMapper() *FieldMapper {
+	return &FieldMapper{RenameFields: make(map[string]string)}
+}
+
+// Keep adds fields to keep.
+func (m *FieldMapper) Keep(fields ...string) *FieldMapper {
+	m.KeepFields = append(m.KeepFields, fields...)
+	return m
+}
+
+// Rename adds a rule to move the field at the path from to the path to.
+func (m *FieldMapper) Rename(from, to string) *FieldMapper {
+	if m.RenameFields == nil {
+		m.RenameFields = make(map[string]string)
+	}
+	m.RenameFields[from] = to
+	return m
+}
+
+// Drop adds fields to remove.
+func (m *FieldMapper) Drop(fields ...string) *FieldMapper {
+	m.DropFields = append(m.DropFields, fields...)
+	return m
+}
+
+// ProcessData maps the fields of each record.
+func (m *FieldMapper) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	for i, o := range objects {
+		objects[i] = m.Map(o)
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Map applies the rules to a single record. The record may be modified.
+func (m *FieldMapper) Map(record map[string]interface{}) map[string]interface{} {
+	// Sort the renames, so nested targets are created in the same order
+	// every time.
+	from := make([]string, 0, len(m.RenameFields))
+	for f := range m.RenameFields {
+		from = append(from, f)
+	}
+	sort.Strings(from)
+	values := make([]interface{}, len(from))
+	found := make([]bool, len(from))
+	for i, f := range from {
+		values[i], found[i] = util.LookupField(record, f)
+	}
+
+	if len(m.KeepFields) > 0 {
+		kept := make(map[string]interface{}, len(m.KeepFields))
+		for _, f := range m.KeepFields {
+			if v, ok := util.LookupField(record, f); ok {
+				util.SetField(kept, f, v)
+			}
+		}
+		record = kept
+	}
+	for _, f := range from {
+		util.DeleteField(record, f)
+	}
+	for i, f := range from {
+		if found[i] {
+			util.SetField(record, m.RenameFields[f], values[i])
+		}
+	}
+	for _, f := range m.DropFields {
+		util.DeleteField(record, f)
+	}
+	return record
+}
+
+// Finish - see interface for documentation.
+func (m *FieldMapper) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (m *FieldMapper) String() string {
+	return "FieldMapper"
+}
@@ -0,0 +1,32 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewFieldMapper() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"secret":"x","customer":{"name":"Ann","address":{"country":"DE","zip":"10115"}}}
+`))
+	mapper := processors.NewFieldMapper().
+		Keep("id", "customer").
+		Rename("customer.address.country", "country").
+		Rename("customer.name", "name").
+		Drop("customer")
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, mapper, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"country":"DE","id":1,"name":"Ann"}
+}
@@ -0,0 +1,73 @@
+package processors
+
+import (
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Filter only sends on the records that match a condition, e.g.
+//
+//	filter, err := processors.NewFilter("status == 'active' && amount > 0")
+//
+// See util.Condition for the expression syntax. Incoming data can be a
+// single JSON object or an array of objects, and the matching records keep
+// the same shape. Payloads with no matching records aren't sent on.
+type Filter struct {
+	Match func(record map[string]interface{}) bool
+
+	name string
+}
+
+// NewFilter returns a new Filter of records matching the condition, or an
+// error if the condition is invalid.
+func NewFilter(condition string) (*Filter, error) {
+	c, err := util.ParseCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Match: c.Match, name: c.String()}, nil
+}
+
+// NewFilterFunc returns a new Filter of records matching the predicate.
+func NewFilterFunc(match func(record map[string]interface{}) bool) *Filter {
+	return &Filter{Match: match}
+}
+
+// ProcessData sends on the matching records.
+func (f *Filter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	matched := objects[:0]
+	for _, o := range objects {
+		if f.Match(o) {
+			matched = append(matched, o)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	if len(matched) == len(objects) {
+		outputChan <- d
+		return
+	}
+	dd, err := objectsJSON(d, matched)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Finish - see interface for documentation.
+func (f *Filter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (f *Filter) String() string {
+	if f.name != "" {
+		return "Filter(" + f.name + ")"
+	}
+	return "Filter"
+}
@@ -0,0 +1,34 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewFilter() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"status":"active","amount":10}
+{"id":2,"status":"closed","amount":20}
+{"id":3,"status":"active","amount":0}
+`))
+	filter, err := processors.NewFilter("status == 'active' && amount > 0")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, filter, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"amount":10,"id":1,"status":"active"}
+}
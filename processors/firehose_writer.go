@@ -0,0 +1,164 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/aws/aws-sdk-go/service/firehose/firehoseiface"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// The limits of a PutRecordBatch call.
+const (
+	firehoseMaxBatchRecords = 500
+	firehoseMaxBatchBytes   = 4 << 20
+	firehoseMaxRecordBytes  = 1000 << 10
+)
+
+// FirehoseWriter sends the records it receives to an Amazon Data Firehose
+// (Kinesis Data Firehose) delivery stream, each as its compacted JSON
+// followed by LineSeparator (a newline by default), so the files the
+// stream delivers are JSON Lines.
+//
+// Records are buffered, across payloads, into PutRecordBatch calls of up
+// to 500 records and 4 MiB, which are sent when full and in Finish.
+// Records that fail (such as those throttled) are sent again, as are calls
+// that fail with a retryable error, as configured by Retry: by default up
+// to 5 attempts, backing off from 1 second. Records larger than Firehose
+// allows (1000 KiB) are an error.
+type FirehoseWriter struct {
+	DeliveryStream string
+	LineSeparator  string
+	Retry          RetryPolicy // Retryable defaults to throttling and service unavailable errors
+
+	client firehoseiface.FirehoseAPI
+	batch  []*firehose.Record
+	size   int
+}
+
+// NewFirehoseWriter returns a new FirehoseWriter sending to
+// deliveryStream with client.
+func NewFirehoseWriter(client firehoseiface.FirehoseAPI, deliveryStream string) *FirehoseWriter {
+	retry := DefaultRetryPolicy
+	retry.MaxAttempts = 5
+	retry.Retryable = firehoseRetryable
+	return &FirehoseWriter{DeliveryStream: deliveryStream, LineSeparator: "\n", Retry: retry, client: client}
+}
+
+// ProcessData - see interface for documentation.
+func (w *FirehoseWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	w.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx buffers the payload's records, sending the batches that
+// are full. Requests are cancelled when ctx is done. See
+// ratchet.ContextDataProcessor.
+func (w *FirehoseWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(w.add(ctx, d), killChan)
+}
+
+func (w *FirehoseWriter) add(ctx context.Context, d data.JSON) error {
+	var objects []json.RawMessage
+	trimmed := bytes.TrimSpace(d)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := data.ParseJSON(trimmed, &objects); err != nil {
+			return util.DataInvalidError(err)
+		}
+	} else {
+		objects = []json.RawMessage{json.RawMessage(trimmed)}
+	}
+
+	for _, o := range objects {
+		var rec bytes.Buffer
+		if err := json.Compact(&rec, o); err != nil {
+			return util.DataInvalidError(err)
+		}
+		rec.WriteString(w.LineSeparator)
+		if rec.Len() > firehoseMaxRecordBytes {
+			return util.DataErrorf("FirehoseWriter: record of %d bytes is larger than the %d Firehose allows", rec.Len(), firehoseMaxRecordBytes)
+		}
+		if len(w.batch) == firehoseMaxBatchRecords || w.size+rec.Len() > firehoseMaxBatchBytes {
+			if err := w.flush(ctx); err != nil {
+				return err
+			}
+		}
+		w.batch = append(w.batch, &firehose.Record{Data: rec.Bytes()})
+		w.size += rec.Len()
+	}
+	return nil
+}
+
+// Finish sends the records still buffered.
+func (w *FirehoseWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(w.flush(context.Background()), killChan)
+}
+
+// flush sends the records buffered, retrying those that fail.
+func (w *FirehoseWriter) flush(ctx context.Context) error {
+	records := w.batch
+	if len(records) == 0 {
+		return nil
+	}
+	w.batch, w.size = nil, 0
+	retryable := w.Retry.Retryable
+	if retryable == nil {
+		retryable = firehoseRetryable
+	}
+	for attempt := 1; ; attempt++ {
+		out, err := w.client.PutRecordBatchWithContext(ctx, &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(w.DeliveryStream),
+			Records:            records,
+		})
+		if err != nil {
+			if !retryable(err) || attempt >= w.Retry.MaxAttempts {
+				return err
+			}
+			logger.Info("FirehoseWriter: attempt", attempt, "failed, retrying:", err)
+		} else {
+			if aws.Int64Value(out.FailedPutCount) == 0 {
+				logger.Debug("FirehoseWriter:", len(records), "records sent to", w.DeliveryStream)
+				return nil
+			}
+			var failed []*firehose.Record
+			var lastErr string
+			for i, res := range out.RequestResponses {
+				if res.ErrorCode != nil && i < len(records) {
+					failed = append(failed, records[i])
+					lastErr = aws.StringValue(res.ErrorCode) + ": " + aws.StringValue(res.ErrorMessage)
+				}
+			}
+			if attempt >= w.Retry.MaxAttempts {
+				return fmt.Errorf("FirehoseWriter: %d record(s) failed after %d attempts, last with %v", len(failed), attempt, lastErr)
+			}
+			logger.Info("FirehoseWriter:", len(failed), "of", len(records), "records failed, retrying:", lastErr)
+			records = failed
+		}
+		if err := sleepContext(ctx, w.Retry.Backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *FirehoseWriter) String() string {
+	return fmt.Sprintf("FirehoseWriter(%v)", w.DeliveryStream)
+}
+
+// firehoseRetryable returns true if err is from a PutRecordBatch call
+// that can be retried after a while.
+func firehoseRetryable(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case firehose.ErrCodeServiceUnavailableException, firehose.ErrCodeLimitExceededException, "ThrottlingException":
+			return true
+		}
+	}
+	return util.IsTransient(err)
+}
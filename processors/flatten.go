@@ -0,0 +1,196 @@
+package processors
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// FlattenArrays controls how a Flatten handles arrays.
+type FlattenArrays int
+
+const (
+	// FlattenArrayIndex flattens arrays like objects, with each element's
+	// index as its key, e.g. {"tags": ["a", "b"]} becomes
+	// {"tags_0": "a", "tags_1": "b"}.
+	FlattenArrayIndex FlattenArrays = iota
+	// FlattenArrayExplode sends a record for each element of an array,
+	// like a SQL lateral join, e.g. {"id": 1, "tags": ["a", "b"]} becomes
+	// {"id": 1, "tags": "a"} and {"id": 1, "tags": "b"}. Records with
+	// several arrays are exploded into every combination of their
+	// elements, and empty arrays become null.
+	FlattenArrayExplode
+	// FlattenArrayJSON keeps arrays as JSON strings, e.g.
+	// {"tags": ["a", "b"]} becomes {"tags": "[\"a\",\"b\"]"}.
+	FlattenArrayJSON
+)
+
+// Flatten converts nested objects in the records it receives into flat
+// records, joining the keys with Separator, e.g. {"user": {"name": "Ann"}}
+// becomes {"user_name": "Ann"}, so they can be written by SQL writers.
+// Arrays are handled as set by Arrays.
+//
+// Objects nested deeper than MaxDepth are kept as JSON strings. Incoming
+// data can be a single JSON object or an array of objects. The flattened
+// records are sent as an array, or as a single object if the payload was
+// an object and it wasn't exploded into several.
+type Flatten struct {
+	Separator string // Defaults to "_"
+	Arrays    FlattenArrays
+	MaxDepth  int // Defaults to 0, which flattens every level
+}
+
+// NewFlatten returns a new Flatten joining keys with "_", which flattens
+// arrays by index.
+func NewFlatten() *Flatten {
+	return &Flatten{Separator: "_"}
+}
+
+// ProcessData flattens each record.
+func (f *Flatten) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	var flattened []map[string]interface{}
+	for _, o := range objects {
+		records, err := f.Flatten(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		flattened = append(flattened, records...)
+	}
+	if len(flattened) == 0 {
+		return
+	}
+
+	var v interface{} = flattened
+	if len(flattened) == 1 && isObjectJSON(d) {
+		v = flattened[0]
+	}
+	dd, err := data.NewJSON(v)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Flatten returns the flattened record, or records with
+// FlattenArrayExplode.
+func (f *Flatten) Flatten(record map[string]interface{}) ([]map[string]interface{}, error) {
+	return f.flattenObject("", record, 0)
+}
+
+func (f *Flatten) key(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	sep := f.Separator
+	if sep == "" {
+		sep = "_"
+	}
+	return prefix + sep + key
+}
+
+func (f *Flatten) flattenObject(prefix string, object map[string]interface{}, depth int) ([]map[string]interface{}, error) {
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	// Sort the keys, so exploded records come out in the same order
+	// every time.
+	sort.Strings(keys)
+	records := []map[string]interface{}{{}}
+	for _, k := range keys {
+		values, err := f.flattenValue(f.key(prefix, k), object[k], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		records = flattenProduct(records, values)
+	}
+	return records, nil
+}
+
+func (f *Flatten) flattenValue(key string, v interface{}, depth int) ([]map[string]interface{}, error) {
+	deeper := f.MaxDepth <= 0 || depth < f.MaxDepth
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		if deeper {
+			return f.flattenObject(key, vv, depth)
+		}
+	case []interface{}:
+		switch {
+		case f.Arrays == FlattenArrayExplode:
+			if len(vv) == 0 {
+				return []map[string]interface{}{{key: nil}}, nil
+			}
+			var records []map[string]interface{}
+			for _, e := range vv {
+				values, err := f.flattenValue(key, e, depth)
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, values...)
+			}
+			return records, nil
+		case f.Arrays == FlattenArrayIndex && deeper:
+			records := []map[string]interface{}{{}}
+			for i, e := range vv {
+				values, err := f.flattenValue(f.key(key, strconv.Itoa(i)), e, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				records = flattenProduct(records, values)
+			}
+			return records, nil
+		}
+	default:
+		return []map[string]interface{}{{key: v}}, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, util.DataInvalidError(err)
+	}
+	return []map[string]interface{}{{key: string(b)}}, nil
+}
+
+// flattenProduct returns every combination of the records with the values
+// (which have different keys).
+func flattenProduct(records, values []map[string]interface{}) []map[string]interface{} {
+	if len(values) == 1 {
+		for _, r := range records {
+			for k, v := range values[0] {
+				r[k] = v
+			}
+		}
+		return records
+	}
+	product := make([]map[string]interface{}, 0, len(records)*len(values))
+	for _, r := range records {
+		for _, value := range values {
+			combined := make(map[string]interface{}, len(r)+len(value))
+			for k, v := range r {
+				combined[k] = v
+			}
+			for k, v := range value {
+				combined[k] = v
+			}
+			product = append(product, combined)
+		}
+	}
+	return product
+}
+
+// Finish - see interface for documentation.
+func (f *Flatten) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (f *Flatten) String() string {
+	return "Flatten"
+}
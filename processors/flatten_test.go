@@ -0,0 +1,30 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewFlatten() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"user":{"name":"Ann","address":{"city":"Berlin"}},"tags":["a","b"]}
+`))
+	flatten := processors.NewFlatten()
+	flatten.Arrays = processors.FlattenArrayExplode
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, flatten, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"id":1,"tags":"a","user_address_city":"Berlin","user_name":"Ann"}
+	// {"id":1,"tags":"b","user_address_city":"Berlin","user_name":"Ann"}
+}
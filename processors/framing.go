@@ -0,0 +1,140 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// FramingCodec splits a stream into payloads, and joins payloads into a
+// stream, for IoReader and IoWriter. This lets any Go stream (a net.Conn,
+// a bytes.Buffer, a compressed stream...) be read or written with the
+// framing its other end expects.
+type FramingCodec interface {
+	// NewDecoder returns a FrameDecoder reading payloads from r.
+	NewDecoder(r io.Reader) FrameDecoder
+	// Encode writes a payload to w.
+	Encode(w io.Writer, d data.JSON) error
+}
+
+// FrameDecoder reads payloads from a stream. Decode returns io.EOF when
+// there are no more payloads.
+type FrameDecoder interface {
+	Decode() (data.JSON, error)
+}
+
+// LinesCodec frames each payload as a line of text.
+type LinesCodec struct{}
+
+// NewDecoder - see FramingCodec.
+func (LinesCodec) NewDecoder(r io.Reader) FrameDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &linesDecoder{scanner: scanner}
+}
+
+// Encode - see FramingCodec.
+func (LinesCodec) Encode(w io.Writer, d data.JSON) error {
+	_, err := w.Write(append(bytes.TrimRight(d, "\r\n"), '\n'))
+	return err
+}
+
+type linesDecoder struct {
+	scanner *bufio.Scanner
+}
+
+func (l *linesDecoder) Decode() (data.JSON, error) {
+	if !l.scanner.Scan() {
+		if err := l.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return data.JSON(append([]byte(nil), l.scanner.Bytes()...)), nil
+}
+
+// JSONStreamCodec frames each payload as a JSON value. Values can be
+// separated by whitespace (such as newlines, as in NDJSON) or nothing at
+// all, and are written compacted, one per line.
+type JSONStreamCodec struct{}
+
+// NewDecoder - see FramingCodec.
+func (JSONStreamCodec) NewDecoder(r io.Reader) FrameDecoder {
+	return &jsonStreamDecoder{dec: json.NewDecoder(r)}
+}
+
+// Encode - see FramingCodec.
+func (JSONStreamCodec) Encode(w io.Writer, d data.JSON) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, d); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type jsonStreamDecoder struct {
+	dec *json.Decoder
+}
+
+func (j *jsonStreamDecoder) Decode() (data.JSON, error) {
+	var v json.RawMessage
+	if err := j.dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return data.JSON(v), nil
+}
+
+// LengthPrefixedCodec frames each payload with its length, as a 4 byte big
+// endian unsigned integer, as many binary protocols do.
+type LengthPrefixedCodec struct {
+	MaxLength uint32 // Defaults to 0, which allows any length
+}
+
+// NewDecoder - see FramingCodec.
+func (c LengthPrefixedCodec) NewDecoder(r io.Reader) FrameDecoder {
+	return &lengthPrefixedDecoder{r: bufio.NewReader(r), max: c.MaxLength}
+}
+
+// Encode - see FramingCodec.
+func (c LengthPrefixedCodec) Encode(w io.Writer, d data.JSON) error {
+	if c.MaxLength > 0 && uint64(len(d)) > uint64(c.MaxLength) {
+		return fmt.Errorf("LengthPrefixedCodec: payload of %d bytes is longer than %d", len(d), c.MaxLength)
+	}
+	b := make([]byte, 4, 4+len(d))
+	binary.BigEndian.PutUint32(b, uint32(len(d)))
+	_, err := w.Write(append(b, d...))
+	return err
+}
+
+type lengthPrefixedDecoder struct {
+	r   *bufio.Reader
+	max uint32
+}
+
+func (l *lengthPrefixedDecoder) Decode() (data.JSON, error) {
+	var n uint32
+	if err := binary.Read(l.r, binary.BigEndian, &n); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("LengthPrefixedCodec: truncated length")
+		}
+		return nil, err
+	}
+	if l.max > 0 && n > l.max {
+		return nil, fmt.Errorf("LengthPrefixedCodec: payload of %d bytes is longer than %d", n, l.max)
+	}
+	d := make(data.JSON, n)
+	if _, err := io.ReadFull(l.r, d); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return d, nil
+}
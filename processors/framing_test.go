@@ -0,0 +1,40 @@
+package processors_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleLengthPrefixedCodec() {
+	logger.LogLevel = logger.LevelSilent
+
+	// Write length prefixed payloads to a buffer...
+	var buf bytes.Buffer
+	reader := processors.NewIoReader(bytes.NewBufferString(`{"id":1} {"id":2}`))
+	reader.Codec = processors.JSONStreamCodec{}
+	writer := processors.NewIoWriter(&buf)
+	writer.Codec = processors.LengthPrefixedCodec{}
+	if err := <-ratchet.NewPipeline(reader, writer).Run(); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Printf("%q\n", buf.String())
+
+	// ...and read them back.
+	reader = processors.NewIoReader(&buf)
+	reader.Codec = processors.LengthPrefixedCodec{}
+	writer = processors.NewIoWriter(os.Stdout)
+	writer.Codec = processors.LinesCodec{}
+	if err := <-ratchet.NewPipeline(reader, writer).Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// "\x00\x00\x00\b{\"id\":1}\x00\x00\x00\b{\"id\":2}"
+	// {"id":1}
+	// {"id":2}
+}
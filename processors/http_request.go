@@ -1,6 +1,7 @@
 package processors
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -26,7 +27,13 @@ func NewHTTPRequest(method, url string, body io.Reader) (*HTTPRequest, error) {
 
 // ProcessData sends data to outputChan if the response body is not null
 func (r *HTTPRequest) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
-	resp, err := r.Client.Do(r.Request)
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the request is cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (r *HTTPRequest) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	resp, err := r.Client.Do(r.Request.WithContext(ctx))
 	util.KillPipelineIfErr(err, killChan)
 	if resp != nil && resp.Body != nil {
 		dd, err := ioutil.ReadAll(resp.Body)
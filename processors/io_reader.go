@@ -4,17 +4,31 @@ import (
 	"bufio"
 	"compress/gzip"
 	"io"
+	"os"
+	"sync/atomic"
 
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/util"
 )
 
 // IoReader wraps an io.Reader and reads it.
+//
+// IoReader reports how many bytes it has read as its progress (see
+// ratchet.ProgressSource). Set Size to the total number of bytes to be
+// read so completion can be estimated; it is detected automatically when
+// Reader is an *os.File. Note that for Gzipped content these are the
+// compressed bytes.
+//
+// Set Codec to split the stream into payloads with a FramingCodec (such as
+// JSONStreamCodec or LengthPrefixedCodec) instead of by line or buffer.
 type IoReader struct {
 	Reader     io.Reader
 	LineByLine bool // defaults to true
 	BufferSize int
 	Gzipped    bool
+	Size       int64
+	Codec      FramingCodec // Overrides LineByLine if set
+	bytesRead  int64
 }
 
 // NewIoReader returns a new IoReader wrapping the given io.Reader object.
@@ -24,6 +38,12 @@ func NewIoReader(reader io.Reader) *IoReader {
 
 // ProcessData overwrites the reader if the content is Gzipped, then defers to ForEachData
 func (r *IoReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if f, ok := r.Reader.(*os.File); ok && r.Size == 0 {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			r.Size = info.Size()
+		}
+	}
+	r.Reader = &countingReader{Reader: r.Reader, n: &r.bytesRead}
 	if r.Gzipped {
 		gzReader, err := gzip.NewReader(r.Reader)
 		util.KillPipelineIfErr(err, killChan)
@@ -41,7 +61,9 @@ func (r *IoReader) Finish(outputChan chan data.JSON, killChan chan error) {
 // ForEachData either reads by line or by buffered stream, sending the data
 // back to the anonymous func that ultimately shoves it onto the outputChan
 func (r *IoReader) ForEachData(killChan chan error, foo func(d data.JSON)) {
-	if r.LineByLine {
+	if r.Codec != nil {
+		r.decodeFrames(killChan, foo)
+	} else if r.LineByLine {
 		r.scanLines(killChan, foo)
 	} else {
 		r.bufferedRead(killChan, foo)
@@ -57,6 +79,20 @@ func (r *IoReader) scanLines(killChan chan error, forEach func(d data.JSON)) {
 	util.KillPipelineIfErr(err, killChan)
 }
 
+func (r *IoReader) decodeFrames(killChan chan error, forEach func(d data.JSON)) {
+	dec := r.Codec.NewDecoder(r.Reader)
+	for {
+		d, err := dec.Decode()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+			return
+		}
+		forEach(d)
+	}
+}
+
 func (r *IoReader) bufferedRead(killChan chan error, forEach func(d data.JSON)) {
 	reader := bufio.NewReader(r.Reader)
 	d := make([]byte, r.BufferSize)
@@ -72,6 +108,24 @@ func (r *IoReader) bufferedRead(killChan chan error, forEach func(d data.JSON))
 	}
 }
 
+// Progress returns the number of bytes read so far and Size.
+// See ratchet.ProgressSource.
+func (r *IoReader) Progress() (done, total int64) {
+	return atomic.LoadInt64(&r.bytesRead), r.Size
+}
+
+// countingReader counts the bytes read from the underlying Reader.
+type countingReader struct {
+	io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
 func (r *IoReader) String() string {
 	return "IoReader"
 }
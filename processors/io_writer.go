@@ -12,9 +12,13 @@ import (
 // IoWriter wraps any io.Writer object.
 // It can be used to write data out to a File, os.Stdout, or
 // any other task that can be supported via io.Writer.
+//
+// Set Codec to frame each payload with a FramingCodec (such as
+// LengthPrefixedCodec) instead of writing it as it is.
 type IoWriter struct {
 	Writer     io.Writer
 	AddNewline bool
+	Codec      FramingCodec // Overrides AddNewline if set
 }
 
 // NewIoWriter returns a new IoWriter wrapping the given io.Writer object
@@ -26,7 +30,10 @@ func NewIoWriter(writer io.Writer) *IoWriter {
 func (w *IoWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	var bytesWritten int
 	var err error
-	if w.AddNewline {
+	if w.Codec != nil {
+		err = w.Codec.Encode(w.Writer, d)
+		bytesWritten = len(d)
+	} else if w.AddNewline {
 		bytesWritten, err = fmt.Fprintln(w.Writer, string(d))
 	} else {
 		bytesWritten, err = w.Writer.Write(d)
@@ -0,0 +1,400 @@
+package processors
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// JoinType controls which records a Join emits.
+type JoinType int
+
+const (
+	// InnerJoin only emits left records that have a matching right record.
+	InnerJoin JoinType = iota
+	// LeftOuterJoin emits every left record, joined with its matching
+	// right records if it has any.
+	LeftOuterJoin
+)
+
+// joinPartitions is the number of files records are spilled to.
+const joinPartitions = 16
+
+// Join enriches records from a "left" input with records from a "right"
+// input, matching them on a key field (a hash join). Both inputs are
+// DataProcessors in the previous stage of a branching PipelineLayout that
+// output to the Join: Right is the right input, and anything else is left.
+//
+// The right records are all buffered before any left records are joined,
+// so left records received before the right input has finished are held
+// until it has. Each left record is emitted once for every matching right
+// record, as an object with the fields of both (left fields win when both
+// have the same field, unless RightPrefix is set). With LeftOuterJoin, left
+// records without a match are emitted as they are.
+//
+// Set MaxRightRecords to limit how many right records are held in memory.
+// Beyond that, both inputs are spilled to partitioned files in SpillDir
+// and joined one partition at a time when the Join is finished.
+type Join struct {
+	Right           ratchet.DataProcessor
+	LeftKey         string // Dotted path to the key in left records
+	RightKey        string // Dotted path to the key in right records
+	Type            JoinType
+	RightPrefix     string // Added to the names of the right record fields
+	MaxRightRecords int    // Defaults to 0, which never spills
+	SpillDir        string // Defaults to os.TempDir()
+
+	right       map[string][]map[string]interface{}
+	rightCount  int
+	rightDone   bool
+	pendingLeft []data.JSON
+	spill       *joinSpill
+}
+
+// joinEnvelope records which input a payload came from.
+type joinEnvelope struct {
+	Side string          `json:"join_side"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+const (
+	joinLeft      = "left"
+	joinRight     = "right"
+	joinRightDone = "right_done"
+)
+
+// NewJoin returns a new inner Join of records from the right DataProcessor
+// with the records from any other input, where leftKey equals rightKey.
+func NewJoin(right ratchet.DataProcessor, leftKey, rightKey string) *Join {
+	return &Join{Right: right, LeftKey: leftKey, RightKey: rightKey}
+}
+
+// TagSource records which input the data came from.
+// See ratchet.SourceTaggingDataProcessor.
+func (j *Join) TagSource(d data.JSON, source ratchet.DataProcessor) data.JSON {
+	side := joinLeft
+	if source == j.Right {
+		side = joinRight
+	}
+	tagged, err := data.NewJSON(joinEnvelope{Side: side, Data: json.RawMessage(d)})
+	if err != nil {
+		// Leave the data as it is, ProcessData will report it as invalid.
+		return d
+	}
+	return tagged
+}
+
+// SourceClosed marks the right input as finished, so the left records can
+// be joined. See ratchet.SourceClosingDataProcessor.
+func (j *Join) SourceClosed(source ratchet.DataProcessor) data.JSON {
+	if source != j.Right {
+		return nil
+	}
+	d, _ := data.NewJSON(joinEnvelope{Side: joinRightDone})
+	return d
+}
+
+// ProcessData buffers right records and joins left records.
+func (j *Join) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	var env joinEnvelope
+	if err := data.ParseJSONSilent(d, &env); err != nil || env.Side == "" {
+		util.KillPipelineIfErr(util.DataErrorf("Join: invalid data %v", string(d)), killChan)
+		return
+	}
+
+	var err error
+	switch env.Side {
+	case joinRight:
+		err = j.addRight(data.JSON(env.Data))
+	case joinRightDone:
+		err = j.finishRight(outputChan)
+	default:
+		if j.rightDone {
+			err = j.joinLeft(data.JSON(env.Data), outputChan)
+		} else {
+			j.pendingLeft = append(j.pendingLeft, data.JSON(env.Data))
+		}
+	}
+	util.KillPipelineIfErr(err, killChan)
+}
+
+// Finish joins any records that are still buffered.
+func (j *Join) Finish(outputChan chan data.JSON, killChan chan error) {
+	if !j.rightDone {
+		if err := j.finishRight(outputChan); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	if j.spill != nil {
+		err := j.spill.join(j, outputChan)
+		j.spill.remove()
+		j.spill = nil
+		util.KillPipelineIfErr(err, killChan)
+	}
+}
+
+func (j *Join) addRight(d data.JSON) error {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	if j.spill != nil {
+		return j.spill.write(j.spill.right, objects, j.RightKey)
+	}
+	if j.right == nil {
+		j.right = make(map[string][]map[string]interface{})
+	}
+	for _, o := range objects {
+		if key, ok := joinKey(o, j.RightKey); ok {
+			j.right[key] = append(j.right[key], o)
+			j.rightCount++
+		}
+	}
+	if j.MaxRightRecords > 0 && j.rightCount > j.MaxRightRecords {
+		return j.startSpill()
+	}
+	return nil
+}
+
+func (j *Join) startSpill() error {
+	logger.Info("Join: more than", j.MaxRightRecords, "right records, spilling to disk")
+	spill, err := newJoinSpill(j.SpillDir)
+	if err != nil {
+		return err
+	}
+	j.spill = spill
+	for _, records := range j.right {
+		if err := spill.write(spill.right, records, j.RightKey); err != nil {
+			return err
+		}
+	}
+	j.right = nil
+	return nil
+}
+
+func (j *Join) finishRight(outputChan chan data.JSON) error {
+	j.rightDone = true
+	pending := j.pendingLeft
+	j.pendingLeft = nil
+	for _, d := range pending {
+		if err := j.joinLeft(d, outputChan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *Join) joinLeft(d data.JSON, outputChan chan data.JSON) error {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	if j.spill != nil {
+		return j.spill.write(j.spill.left, objects, j.LeftKey)
+	}
+	return j.emit(j.joinRecords(objects, j.right), outputChan)
+}
+
+func (j *Join) joinRecords(left []map[string]interface{}, right map[string][]map[string]interface{}) []map[string]interface{} {
+	var joined []map[string]interface{}
+	for _, l := range left {
+		key, ok := joinKey(l, j.LeftKey)
+		matches := right[key]
+		if !ok || len(matches) == 0 {
+			if j.Type == LeftOuterJoin {
+				joined = append(joined, l)
+			}
+			continue
+		}
+		for _, r := range matches {
+			joined = append(joined, j.joinRecord(l, r))
+		}
+	}
+	return joined
+}
+
+func (j *Join) joinRecord(left, right map[string]interface{}) map[string]interface{} {
+	joined := make(map[string]interface{}, len(left)+len(right))
+	for k, v := range left {
+		joined[k] = v
+	}
+	for k, v := range right {
+		if _, ok := joined[j.RightPrefix+k]; !ok {
+			joined[j.RightPrefix+k] = v
+		}
+	}
+	return joined
+}
+
+func (j *Join) emit(records []map[string]interface{}, outputChan chan data.JSON) error {
+	if len(records) == 0 {
+		return nil
+	}
+	d, err := data.NewJSON(records)
+	if err != nil {
+		return err
+	}
+	outputChan <- d
+	return nil
+}
+
+func (j *Join) String() string {
+	return "Join"
+}
+
+// joinKey returns the key of the record as a string, or false if the
+// record has no (or a null) key. Keys are compared as JSON, so 1 and 1.0
+// match but 1 and "1" don't.
+func joinKey(record map[string]interface{}, path string) (string, bool) {
+	v, ok := util.LookupField(record, path)
+	if !ok || v == nil {
+		return "", false
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// joinSpill holds the records of a Join that has spilled to disk, in
+// JSON Lines files partitioned by key.
+type joinSpill struct {
+	dir         string
+	right, left []*joinSpillFile
+}
+
+type joinSpillFile struct {
+	path string
+	f    *os.File
+	w    *bufio.Writer
+}
+
+func newJoinSpill(dir string) (*joinSpill, error) {
+	dir, err := ioutil.TempDir(dir, "ratchet-join-")
+	if err != nil {
+		return nil, err
+	}
+	s := &joinSpill{dir: dir}
+	for i := 0; i < joinPartitions; i++ {
+		for _, side := range []string{joinRight, joinLeft} {
+			path := filepath.Join(dir, fmt.Sprintf("%s-%d.jsonl", side, i))
+			f, err := os.Create(path)
+			if err != nil {
+				s.remove()
+				return nil, err
+			}
+			file := &joinSpillFile{path: path, f: f, w: bufio.NewWriter(f)}
+			if side == joinRight {
+				s.right = append(s.right, file)
+			} else {
+				s.left = append(s.left, file)
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *joinSpill) write(files []*joinSpillFile, records []map[string]interface{}, keyPath string) error {
+	for _, r := range records {
+		// Records without a key all go to the first partition, where
+		// they won't match anything.
+		partition := 0
+		if key, ok := joinKey(r, keyPath); ok {
+			h := fnv.New32a()
+			h.Write([]byte(key))
+			partition = int(h.Sum32() % joinPartitions)
+		}
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		w := files[partition].w
+		w.Write(b)
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// join joins each partition in turn, only holding one partition of right
+// records in memory at a time.
+func (s *joinSpill) join(j *Join, outputChan chan data.JSON) error {
+	for i := 0; i < joinPartitions; i++ {
+		right := make(map[string][]map[string]interface{})
+		err := s.right[i].forEach(func(r map[string]interface{}) error {
+			if key, ok := joinKey(r, j.RightKey); ok {
+				right[key] = append(right[key], r)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var batch []map[string]interface{}
+		err = s.left[i].forEach(func(l map[string]interface{}) error {
+			batch = append(batch, l)
+			if len(batch) < 1000 {
+				return nil
+			}
+			err := j.emit(j.joinRecords(batch, right), outputChan)
+			batch = nil
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := j.emit(j.joinRecords(batch, right), outputChan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *joinSpillFile) forEach(fn func(record map[string]interface{}) error) error {
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f.f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var record map[string]interface{}
+			if err := json.Unmarshal(line, &record); err != nil {
+				return err
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *joinSpill) remove() {
+	for _, f := range append(s.right, s.left...) {
+		f.f.Close()
+	}
+	os.RemoveAll(s.dir)
+}
@@ -0,0 +1,50 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleJoin() {
+	logger.LogLevel = logger.LevelSilent
+
+	orders := processors.NewJSONLinesReader(strings.NewReader(`{"order":1,"customer_id":10}
+{"order":2,"customer_id":20}
+{"order":3,"customer_id":30}
+`))
+	customers := processors.NewJSONLinesReader(strings.NewReader(`{"id":10,"name":"Ann"}
+{"id":20,"name":"Bob"}
+`))
+	join := processors.NewJoin(customers, "customer_id", "id")
+	join.Type = processors.LeftOuterJoin
+	join.RightPrefix = "customer_"
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+
+	layout, _ := ratchet.NewPipelineLayout(
+		ratchet.NewPipelineStage(
+			ratchet.Do(orders).Outputs(join),
+			ratchet.Do(customers).Outputs(join),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(join).Outputs(stdout),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(stdout),
+		),
+	)
+	pipeline := ratchet.NewBranchingPipeline(layout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"customer_id":10,"customer_name":"Ann","order":1}
+	// {"customer_id":20,"customer_name":"Bob","order":2}
+	// {"customer_id":30,"order":3}
+}
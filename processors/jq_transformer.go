@@ -0,0 +1,117 @@
+package processors
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/itchyny/gojq"
+)
+
+// JQTransformer runs a jq program on each payload it receives, e.g.
+//
+//	processors.NewJQTransformer(`.results[] | {id, name: .user.name}`, nil)
+//
+// Each value the program outputs is sent on as its own payload (so a
+// program like ".[]" splits arrays), unless Collect is set, in which case
+// all the values for a payload are sent as a single array. null outputs
+// are dropped.
+//
+// Variables are available to the program as $name, and the environment
+// as $ENV. Programs are run with gojq (https://github.com/itchyny/gojq),
+// which supports almost all of jq.
+type JQTransformer struct {
+	Program          string
+	Collect          bool
+	ConcurrencyLevel int // See ConcurrentDataProcessor
+
+	code      *gojq.Code
+	variables []interface{}
+}
+
+// NewJQTransformer returns a new JQTransformer running the given program,
+// or an error if the program is invalid.
+func NewJQTransformer(program string, variables map[string]interface{}) (*JQTransformer, error) {
+	query, err := gojq.Parse(program)
+	if err != nil {
+		return nil, util.ConfigErrorf("jq program %q: %v", program, err)
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		values[i] = variables[name]
+		names[i] = "$" + name
+	}
+	code, err := gojq.Compile(query, gojq.WithVariables(names), gojq.WithEnvironLoader(os.Environ))
+	if err != nil {
+		return nil, util.ConfigErrorf("jq program %q: %v", program, err)
+	}
+	return &JQTransformer{Program: program, code: code, variables: values}, nil
+}
+
+// ProcessData runs the program on the payload.
+func (t *JQTransformer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	var input interface{}
+	if err := data.ParseJSONSilent(d, &input); err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+
+	var collected []interface{}
+	iter := t.code.Run(input, t.variables...)
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			if halt, ok := err.(*gojq.HaltError); ok && halt.Value() == nil {
+				break
+			}
+			util.KillPipelineIfErr(util.DataErrorf("JQTransformer: %v", err), killChan)
+			return
+		}
+		if v == nil {
+			continue
+		}
+		if t.Collect {
+			collected = append(collected, v)
+			continue
+		}
+		if !t.send(v, outputChan, killChan) {
+			return
+		}
+	}
+	if len(collected) > 0 {
+		t.send(collected, outputChan, killChan)
+	}
+}
+
+func (t *JQTransformer) send(v interface{}, outputChan chan data.JSON, killChan chan error) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return false
+	}
+	outputChan <- data.JSON(b)
+	return true
+}
+
+// Finish - see interface for documentation.
+func (t *JQTransformer) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (t *JQTransformer) String() string {
+	return "JQTransformer"
+}
+
+// Concurrency defers to ConcurrentDataProcessor
+func (t *JQTransformer) Concurrency() int {
+	return t.ConcurrencyLevel
+}
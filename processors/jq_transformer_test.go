@@ -0,0 +1,33 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewJQTransformer() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewIoReader(strings.NewReader(`{"results":[{"id":1,"user":{"name":"Ann"}},{"id":2,"user":{"name":"Bob"}}]}`))
+	jq, err := processors.NewJQTransformer(`.results[] | {id, name: .user.name, source: $source}`, map[string]interface{}{"source": "api"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	stdout := processors.NewIoWriter(os.Stdout)
+	stdout.AddNewline = true
+	pipeline := ratchet.NewPipeline(reader, jq, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"id":1,"name":"Ann","source":"api"}
+	// {"id":2,"name":"Bob","source":"api"}
+}
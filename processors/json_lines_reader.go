@@ -0,0 +1,90 @@
+package processors
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// JSONLinesReader reads newline delimited JSON (NDJSON / JSON Lines) from the
+// given io.Reader, where each line holds a single JSON object. The input may
+// also be a JSON array of objects, however large, or a mix of both. Objects
+// are streamed (see data.NewDecoder) and sent on to the next stage as JSON
+// arrays of up to BatchSize objects, so downstream processors receive the
+// same shape of data as from SQLReader. Numbers are sent on unchanged.
+//
+// Blank lines and nulls are skipped. Input that isn't valid JSON, or holds
+// values other than objects, will send an error to the killChan.
+type JSONLinesReader struct {
+	Reader    io.Reader
+	BatchSize int // Set to 0 to send all objects in a single payload. Defaults to 1000.
+	Gzipped   bool
+}
+
+// NewJSONLinesReader returns a new JSONLinesReader wrapping the given io.Reader object.
+func NewJSONLinesReader(reader io.Reader) *JSONLinesReader {
+	return &JSONLinesReader{Reader: reader, BatchSize: 1000}
+}
+
+// ProcessData reads the lines and sends them in batches to outputChan
+func (r *JSONLinesReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if r.Gzipped {
+		gzReader, err := gzip.NewReader(r.Reader)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		r.Reader = gzReader
+	}
+	r.ForEachBatch(killChan, func(d data.JSON) {
+		outputChan <- d
+	})
+}
+
+// Finish - see interface for documentation.
+func (r *JSONLinesReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+// ForEachBatch reads the objects, passing each batch of them as a JSON array
+// to the given func.
+func (r *JSONLinesReader) ForEachBatch(killChan chan error, forEach func(d data.JSON)) {
+	reader := &readErrReader{Reader: r.Reader}
+	dec := data.NewDecoder(reader)
+	dec.UseNumber()
+	err := data.ForEachBatch(dec, r.BatchSize, func(batch []map[string]interface{}) error {
+		d, err := data.NewJSON(batch)
+		if err != nil {
+			return err
+		}
+		forEach(d)
+		return nil
+	})
+	if serr, ok := err.(*json.SyntaxError); ok {
+		err = util.DataErrorf("JSONLinesReader: invalid JSON at byte %d: %v", serr.Offset, serr)
+	} else if err != nil && err != reader.err {
+		err = util.DataErrorf("JSONLinesReader: %v", err)
+	}
+	util.KillPipelineIfErr(err, killChan)
+}
+
+// readErrReader records the error its Reader returns, other than io.EOF, so
+// that it isn't mistaken for invalid data.
+type readErrReader struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *JSONLinesReader) String() string {
+	return "JSONLinesReader"
+}
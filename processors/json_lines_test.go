@@ -0,0 +1,106 @@
+package processors_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func ExampleNewJSONLinesReader() {
+	logger.LogLevel = logger.LevelSilent
+
+	lines := `{"id":1,"name":"a"}
+{"id":2,"name":"b"}
+
+{"id":3,"name":"c"}
+`
+	read := processors.NewJSONLinesReader(strings.NewReader(lines))
+	read.BatchSize = 2
+	write := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(read, write)
+
+	err := <-pipeline.Run()
+
+	if err != nil {
+		fmt.Println("An error occurred in the ratchet pipeline:", err.Error())
+	}
+
+	// Output:
+	// {"id":1,"name":"a"}
+	// {"id":2,"name":"b"}
+	// {"id":3,"name":"c"}
+}
+
+func TestJSONLinesReader(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name      string
+		input     io.Reader
+		batchSize int
+		want      []string
+		wantErr   bool
+		category  util.ErrorCategory
+	}{
+		{"lines", strings.NewReader("{\"id\":1}\n\n{\"id\":2}\n{\"id\":3}\n"), 2,
+			[]string{`[{"id":1},{"id":2}]`, `[{"id":3}]`}, false, 0},
+		{"array", strings.NewReader(`[{"id":1}, null, {"id":2}, {"id":3}]`), 2,
+			[]string{`[{"id":1},{"id":2}]`, `[{"id":3}]`}, false, 0},
+		{"lines and arrays", strings.NewReader("[{\"id\":1}]\n{\"id\":2}\n[{\"id\":3}]"), 0,
+			[]string{`[{"id":1},{"id":2},{"id":3}]`}, false, 0},
+		{"numbers", strings.NewReader(`{"id":9007199254740993,"amount":1.50}`), 10,
+			[]string{`[{"amount":1.50,"id":9007199254740993}]`}, false, 0},
+		{"empty", strings.NewReader(""), 10, nil, false, 0},
+		{"invalid JSON", strings.NewReader("{\"id\":1}\n{\"id\":}\n"), 1,
+			[]string{`[{"id":1}]`}, true, util.CategoryDataInvalid},
+		{"truncated", strings.NewReader(`[{"id":1},{"id"`), 10, nil, true, util.CategoryDataInvalid},
+		{"not an object", strings.NewReader(`{"id":1} "a"`), 10, nil, true, util.CategoryDataInvalid},
+		{"read error", io.MultiReader(strings.NewReader(`{"id":1}`), failingReader{errors.New("connection reset")}), 10,
+			nil, true, util.CategoryFatal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := processors.NewJSONLinesReader(test.input)
+			r.BatchSize = test.batchSize
+			killChan := make(chan error, 1)
+			var got []string
+			r.ForEachBatch(killChan, func(d data.JSON) {
+				got = append(got, string(d))
+			})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			var err error
+			select {
+			case err = <-killChan:
+			default:
+			}
+			if !test.wantErr {
+				if err != nil {
+					t.Errorf("got error %v", err)
+				}
+			} else if err == nil || util.ErrorCategoryOf(err) != test.category {
+				t.Errorf("got error %v, want a %v error", err, test.category)
+			}
+		})
+	}
+}
+
+// failingReader is a Reader that fails with err.
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
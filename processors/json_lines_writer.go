@@ -0,0 +1,66 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// JSONLinesWriter writes data as newline delimited JSON (NDJSON / JSON Lines)
+// to the given io.Writer. The data must be a valid JSON object or a slice of
+// valid JSON objects; each object is written compacted on its own line, and
+// the key order of the incoming data is preserved.
+type JSONLinesWriter struct {
+	Writer io.Writer
+}
+
+// NewJSONLinesWriter returns a new JSONLinesWriter wrapping the given io.Writer object
+func NewJSONLinesWriter(writer io.Writer) *JSONLinesWriter {
+	return &JSONLinesWriter{Writer: writer}
+}
+
+// ProcessData writes each received object as a line
+func (w *JSONLinesWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	var objects []json.RawMessage
+	trimmed := bytes.TrimSpace(d)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		err := data.ParseJSON(trimmed, &objects)
+		if err != nil {
+			util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+			return
+		}
+	} else {
+		objects = []json.RawMessage{json.RawMessage(trimmed)}
+	}
+
+	bw := bufio.NewWriter(w.Writer)
+	var line bytes.Buffer
+	for _, o := range objects {
+		line.Reset()
+		if err := json.Compact(&line, o); err != nil {
+			util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+			return
+		}
+		line.WriteByte('\n')
+		if _, err := bw.Write(line.Bytes()); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	err := bw.Flush()
+	util.KillPipelineIfErr(err, killChan)
+	logger.Debug("JSONLinesWriter:", len(objects), "lines written")
+}
+
+// Finish - see interface for documentation.
+func (w *JSONLinesWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (w *JSONLinesWriter) String() string {
+	return "JSONLinesWriter"
+}
@@ -0,0 +1,111 @@
+package processors
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// KeyGenerator adds a surrogate key to each record it receives, so writers
+// don't depend on the database to generate keys. Keys are either sequence
+// numbers, increasing by one from Start in the order records are received,
+// or random (version 4) UUIDs.
+//
+// Set PartitionBy to number the records of each partition separately, like
+// SQL's ROW_NUMBER() OVER (PARTITION BY ...). Incoming data can be a single
+// JSON object or an array of objects, and the records keep the same shape.
+type KeyGenerator struct {
+	Field       string // Dotted path to set the key at
+	UUID        bool
+	Start       int64    // Defaults to 1
+	PartitionBy []string // Dotted paths
+
+	next map[string]int64
+}
+
+// NewSequenceGenerator returns a new KeyGenerator numbering records from 1.
+func NewSequenceGenerator(field string) *KeyGenerator {
+	return &KeyGenerator{Field: field, Start: 1}
+}
+
+// NewUUIDGenerator returns a new KeyGenerator adding random UUIDs.
+func NewUUIDGenerator(field string) *KeyGenerator {
+	return &KeyGenerator{Field: field, UUID: true}
+}
+
+// ProcessData adds a key to each record.
+func (g *KeyGenerator) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+	for _, o := range objects {
+		if g.UUID {
+			util.SetField(o, g.Field, newUUID())
+			continue
+		}
+		partition, err := g.partition(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if g.next == nil {
+			g.next = make(map[string]int64)
+		}
+		n, ok := g.next[partition]
+		if !ok {
+			n = g.Start
+		}
+		util.SetField(o, g.Field, n)
+		g.next[partition] = n + 1
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+func (g *KeyGenerator) partition(record map[string]interface{}) (string, error) {
+	if len(g.PartitionBy) == 0 {
+		return "", nil
+	}
+	keys := make([]interface{}, len(g.PartitionBy))
+	for i, field := range g.PartitionBy {
+		keys[i], _ = util.LookupField(record, field)
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return "", util.DataInvalidError(err)
+	}
+	return string(b), nil
+}
+
+// Finish - see interface for documentation.
+func (g *KeyGenerator) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (g *KeyGenerator) String() string {
+	if len(g.PartitionBy) > 0 {
+		return "KeyGenerator(" + strings.Join(g.PartitionBy, ",") + ")"
+	}
+	return "KeyGenerator"
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,33 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewSequenceGenerator() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"customer":"ann","order":"a"}
+{"customer":"bob","order":"b"}
+{"customer":"ann","order":"c"}
+`))
+	keys := processors.NewSequenceGenerator("order_number")
+	keys.PartitionBy = []string{"customer"}
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, keys, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"customer":"ann","order":"a","order_number":1}
+	// {"customer":"bob","order":"b","order_number":1}
+	// {"customer":"ann","order":"c","order_number":2}
+}
@@ -0,0 +1,465 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// KinesisRecord is a record read from a Kinesis data stream, as sent by a
+// KinesisReader with Metadata set. Data holds the record's data if it's
+// JSON, and otherwise the data as a string.
+type KinesisRecord struct {
+	ShardID        string          `json:"shard_id"`
+	SequenceNumber string          `json:"sequence_number"`
+	PartitionKey   string          `json:"partition_key"`
+	ArrivalTime    time.Time       `json:"arrival_time"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// KinesisReader reads the records of an Amazon Kinesis data stream, from
+// every shard in parallel. Each batch of records read from a shard (of up
+// to BatchSize) is sent as an array of their data, so streams of JSON
+// objects can go straight to SQL or file writers. Data that isn't JSON is
+// sent as a string. With Metadata, each record is sent as a KinesisRecord
+// instead.
+//
+// Shards are discovered when the reader starts and every
+// DiscoveryInterval, so shards created by resharding are read too. A
+// shard created by splitting or merging shards that have been read is
+// read from its start, once they've been read to their end, so the
+// records of each partition key are read in order.
+//
+// Reading a shard starts after the sequence number saved to Checkpoints
+// if there is one, and otherwise at StartingPosition: "LATEST" (the
+// default) to read only new records, or "TRIM_HORIZON" to read all those
+// the stream retains. The sequence number of the last record read from
+// each shard is saved to Checkpoints when the Pipeline succeeds (see
+// ratchet.CommittingDataProcessor).
+//
+// With StopAtCurrent, the reader stops once it has read every shard up to
+// its latest record, so it can be run on a schedule (see ratchet.Schedule);
+// otherwise it runs until the Pipeline is cancelled.
+type KinesisReader struct {
+	Stream            string
+	BatchSize         int           // Defaults to 1000, at most 10000
+	StartingPosition  string        // "LATEST" (the default) or "TRIM_HORIZON"
+	PollInterval      time.Duration // How long to wait for new records in a shard, defaults to 1 second
+	DiscoveryInterval time.Duration // How often to look for new shards, defaults to 1 minute
+	Metadata          bool
+	StopAtCurrent     bool
+	Checkpoints       ratchet.CheckpointStore
+	CheckpointKey     string // Defaults to "kinesis:" + Stream
+
+	client    kinesisiface.KinesisAPI
+	positions map[string]string // Last sequence number read, by shard
+	mutex     sync.Mutex
+}
+
+// kinesisShardEnd is the position of shards that have been read to their
+// end, after being closed by resharding.
+const kinesisShardEnd = "SHARD_END"
+
+// kinesisBackoff is how long to wait before retrying requests that were
+// throttled.
+var kinesisBackoff = RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+// NewKinesisReader returns a new KinesisReader reading stream with client.
+func NewKinesisReader(client kinesisiface.KinesisAPI, stream string) *KinesisReader {
+	return &KinesisReader{Stream: stream, BatchSize: 1000, client: client}
+}
+
+// ProcessData - see interface for documentation.
+func (r *KinesisReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx reads the stream until the Pipeline is cancelled, or it
+// has caught up with StopAtCurrent. See ratchet.ContextDataProcessor.
+func (r *KinesisReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(r.read(ctx, outputChan), killChan)
+}
+
+// kinesisShardDone is sent by a shard's reader when it stops.
+type kinesisShardDone struct {
+	shardID string
+	err     error
+}
+
+func (r *KinesisReader) read(ctx context.Context, outputChan chan data.JSON) error {
+	switch r.StartingPosition {
+	case "", kinesis.ShardIteratorTypeLatest, kinesis.ShardIteratorTypeTrimHorizon:
+	default:
+		return util.ConfigErrorf("KinesisReader: unknown starting position %q", r.StartingPosition)
+	}
+	positions := map[string]string{}
+	if r.Checkpoints != nil {
+		if _, err := r.Checkpoints.Load(r.checkpointKey(), &positions); err != nil {
+			return err
+		}
+	}
+	r.mutex.Lock()
+	r.positions = positions
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	discoveryInterval := r.DiscoveryInterval
+	if discoveryInterval <= 0 {
+		discoveryInterval = time.Minute
+	}
+	ticker := time.NewTicker(discoveryInterval)
+	defer ticker.Stop()
+
+	done := make(chan kinesisShardDone)
+	running := map[string]bool{}
+	caughtUp := map[string]bool{}
+	// stop waits for the shards being read, which are stopped by cancel.
+	stop := func(err error) error {
+		cancel()
+		for len(running) > 0 {
+			sd := <-done
+			delete(running, sd.shardID)
+		}
+		return err
+	}
+	for {
+		shards, err := r.listShards(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The Pipeline reports the cancellation.
+				return stop(nil)
+			}
+			return stop(err)
+		}
+		for _, s := range r.readableShards(shards) {
+			id := aws.StringValue(s.shard.ShardId)
+			if running[id] || caughtUp[id] {
+				continue
+			}
+			running[id] = true
+			go func(s kinesisShard) {
+				done <- kinesisShardDone{shardID: aws.StringValue(s.shard.ShardId), err: r.readShard(ctx, s, outputChan)}
+			}(s)
+		}
+		if len(running) == 0 && r.StopAtCurrent {
+			logger.Info("KinesisReader: caught up with", r.Stream)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return stop(nil)
+		case sd := <-done:
+			delete(running, sd.shardID)
+			if sd.err != nil {
+				if ctx.Err() != nil {
+					return stop(nil)
+				}
+				return stop(sd.err)
+			}
+			if r.StopAtCurrent && r.position(sd.shardID) != kinesisShardEnd {
+				caughtUp[sd.shardID] = true
+			}
+			// Look for the shards that can be read now that this one has
+			// stopped.
+		case <-ticker.C:
+		}
+	}
+}
+
+// kinesisShard is a shard to read, and where to start.
+type kinesisShard struct {
+	shard        *kinesis.Shard
+	iteratorType string
+	sequence     string
+}
+
+// readableShards returns the shards that can be read, and where to start
+// reading them. Shards that have been read to their end aren't, and nor
+// are shards whose parents are still to be read to their end.
+func (r *KinesisReader) readableShards(shards []*kinesis.Shard) []kinesisShard {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	listed := make(map[string]bool, len(shards))
+	for _, s := range shards {
+		listed[aws.StringValue(s.ShardId)] = true
+	}
+	// Forget the shards that have expired.
+	for id, pos := range r.positions {
+		if !listed[id] && pos == kinesisShardEnd {
+			delete(r.positions, id)
+		}
+	}
+
+	var readable []kinesisShard
+	for _, s := range shards {
+		id := aws.StringValue(s.ShardId)
+		if pos, ok := r.positions[id]; ok {
+			if pos != kinesisShardEnd {
+				readable = append(readable, kinesisShard{shard: s, iteratorType: kinesis.ShardIteratorTypeAfterSequenceNumber, sequence: pos})
+			}
+			continue
+		}
+		var parents []string
+		for _, p := range []*string{s.ParentShardId, s.AdjacentParentShardId} {
+			if p == nil {
+				continue
+			}
+			// Parents that were never read, such as those closed before
+			// reading started at LATEST, don't hold their children back.
+			if _, read := r.positions[*p]; read || listed[*p] && r.StartingPosition == kinesis.ShardIteratorTypeTrimHorizon {
+				parents = append(parents, *p)
+			}
+		}
+		ready := true
+		for _, p := range parents {
+			if r.positions[p] != kinesisShardEnd && listed[p] {
+				ready = false
+			}
+		}
+		switch {
+		case !ready:
+		case len(parents) > 0 || r.StartingPosition == kinesis.ShardIteratorTypeTrimHorizon:
+			readable = append(readable, kinesisShard{shard: s, iteratorType: kinesis.ShardIteratorTypeTrimHorizon})
+		case s.SequenceNumberRange != nil && s.SequenceNumberRange.EndingSequenceNumber != nil:
+			// A closed shard has no records to come.
+		default:
+			readable = append(readable, kinesisShard{shard: s, iteratorType: kinesis.ShardIteratorTypeLatest})
+		}
+	}
+	return readable
+}
+
+func (r *KinesisReader) listShards(ctx context.Context) ([]*kinesis.Shard, error) {
+	var shards []*kinesis.Shard
+	input := &kinesis.ListShardsInput{StreamName: aws.String(r.Stream)}
+	for retry := 1; ; {
+		out, err := r.client.ListShardsWithContext(ctx, input)
+		if err != nil {
+			if !kinesisThrottled(err) {
+				return nil, err
+			}
+			if err := sleepContext(ctx, kinesisBackoff.Backoff(retry)); err != nil {
+				return nil, err
+			}
+			retry++
+			continue
+		}
+		shards = append(shards, out.Shards...)
+		if out.NextToken == nil {
+			break
+		}
+		input = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return aws.StringValue(shards[i].ShardId) < aws.StringValue(shards[j].ShardId)
+	})
+	return shards, nil
+}
+
+// readShard reads a shard until it's been read to its end, or until it's
+// caught up with StopAtCurrent.
+func (r *KinesisReader) readShard(ctx context.Context, s kinesisShard, outputChan chan data.JSON) error {
+	shardID := aws.StringValue(s.shard.ShardId)
+	logger.Info("KinesisReader: reading shard", shardID, "from", s.iteratorType, s.sequence)
+	iterator, err := r.shardIterator(ctx, shardID, s.iteratorType, s.sequence)
+	if err != nil {
+		return err
+	}
+	pollInterval := r.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	limit := r.BatchSize
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	retry := 1
+	for {
+		out, err := r.client.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{
+			ShardIterator: iterator,
+			Limit:         aws.Int64(int64(limit)),
+		})
+		if err != nil {
+			if kinesisThrottled(err) {
+				if err := sleepContext(ctx, kinesisBackoff.Backoff(retry)); err != nil {
+					return err
+				}
+				retry++
+				continue
+			}
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == kinesis.ErrCodeExpiredIteratorException {
+				// Carry on from the last record read.
+				iteratorType, sequence := s.iteratorType, r.position(shardID)
+				if sequence != "" {
+					iteratorType = kinesis.ShardIteratorTypeAfterSequenceNumber
+				}
+				if iterator, err = r.shardIterator(ctx, shardID, iteratorType, sequence); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		retry = 1
+
+		if len(out.Records) > 0 {
+			d, err := r.recordsJSON(shardID, out.Records)
+			if err != nil {
+				return err
+			}
+			select {
+			case outputChan <- d:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			r.setPosition(shardID, aws.StringValue(out.Records[len(out.Records)-1].SequenceNumber))
+		}
+		if out.NextShardIterator == nil {
+			logger.Info("KinesisReader: read shard", shardID, "to its end")
+			r.setPosition(shardID, kinesisShardEnd)
+			return nil
+		}
+		iterator = out.NextShardIterator
+		if len(out.Records) == 0 || aws.Int64Value(out.MillisBehindLatest) == 0 {
+			if r.StopAtCurrent && aws.Int64Value(out.MillisBehindLatest) == 0 {
+				return nil
+			}
+			if err := sleepContext(ctx, pollInterval); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *KinesisReader) shardIterator(ctx context.Context, shardID, iteratorType, sequence string) (*string, error) {
+	input := &kinesis.GetShardIteratorInput{
+		StreamName:        aws.String(r.Stream),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: aws.String(iteratorType),
+	}
+	if sequence != "" {
+		input.StartingSequenceNumber = aws.String(sequence)
+	}
+	for retry := 1; ; retry++ {
+		out, err := r.client.GetShardIteratorWithContext(ctx, input)
+		if err == nil {
+			return out.ShardIterator, nil
+		}
+		if !kinesisThrottled(err) {
+			return nil, err
+		}
+		if err := sleepContext(ctx, kinesisBackoff.Backoff(retry)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// recordsJSON returns records as the JSON array sent on.
+func (r *KinesisReader) recordsJSON(shardID string, records []*kinesis.Record) (data.JSON, error) {
+	values := make([]json.RawMessage, len(records))
+	for i, rec := range records {
+		v := json.RawMessage(rec.Data)
+		if !json.Valid(rec.Data) {
+			b, err := json.Marshal(string(rec.Data))
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+		if r.Metadata {
+			b, err := json.Marshal(KinesisRecord{
+				ShardID:        shardID,
+				SequenceNumber: aws.StringValue(rec.SequenceNumber),
+				PartitionKey:   aws.StringValue(rec.PartitionKey),
+				ArrivalTime:    aws.TimeValue(rec.ApproximateArrivalTimestamp),
+				Data:           v,
+			})
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+		values[i] = v
+	}
+	return data.NewJSON(values)
+}
+
+func (r *KinesisReader) position(shardID string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.positions[shardID]
+}
+
+func (r *KinesisReader) setPosition(shardID, sequence string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.positions[shardID] = sequence
+}
+
+func (r *KinesisReader) checkpointKey() string {
+	if r.CheckpointKey != "" {
+		return r.CheckpointKey
+	}
+	return "kinesis:" + r.Stream
+}
+
+// Commit saves the position in each shard read. See
+// ratchet.CommittingDataProcessor.
+func (r *KinesisReader) Commit() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.Checkpoints == nil || len(r.positions) == 0 {
+		return nil
+	}
+	logger.Info("KinesisReader: saving positions of", len(r.positions), "shard(s)")
+	return r.Checkpoints.Save(r.checkpointKey(), r.positions)
+}
+
+// Finish - see interface for documentation.
+func (r *KinesisReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *KinesisReader) String() string {
+	return fmt.Sprintf("KinesisReader(%v)", r.Stream)
+}
+
+// kinesisThrottled returns true if err is from a request that was
+// throttled, and can be retried after a while.
+func kinesisThrottled(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case kinesis.ErrCodeProvisionedThroughputExceededException, kinesis.ErrCodeLimitExceededException:
+		return true
+	}
+	return false
+}
+
+// sleepContext waits for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
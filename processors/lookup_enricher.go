@@ -0,0 +1,182 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// LookupSource fetches enrichment values for a LookupEnricher.
+type LookupSource interface {
+	// Lookup returns the values for each of the keys that were found.
+	Lookup(ctx context.Context, keys []string) (map[string]map[string]interface{}, error)
+}
+
+// LookupFunc is an adapter to use a function as a LookupSource.
+type LookupFunc func(ctx context.Context, keys []string) (map[string]map[string]interface{}, error)
+
+// Lookup calls f(ctx, keys).
+func (f LookupFunc) Lookup(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	return f(ctx, keys)
+}
+
+// LookupMissPolicy controls what a LookupEnricher does with records whose
+// key isn't found.
+type LookupMissPolicy int
+
+const (
+	// LookupKeep sends the record on with the Defaults.
+	LookupKeep LookupMissPolicy = iota
+	// LookupDrop drops the record.
+	LookupDrop
+	// LookupFail kills the pipeline with a data error.
+	LookupFail
+)
+
+// LookupEnricher adds values fetched by key from a LookupSource (such as a
+// SQLLookup, RedisLookup or HTTPLookup) to each record it receives, e.g. to
+// add a customer's details to orders by their customer_id. It replaces the
+// usual hand-rolled "join against a dimension table" code.
+//
+// The keys of each payload that aren't already cached are fetched with
+// a single Lookup (or one per BatchSize keys), and the results, including
+// misses, are kept in an LRU cache of up to CacheSize keys. The values are
+// added to the record with Prefix added to their names, without replacing
+// any of the record's own fields. Records without a key are treated as
+// misses.
+//
+// Incoming data can be a single JSON object or an array of objects, and the
+// records keep the same shape.
+type LookupEnricher struct {
+	Source    LookupSource
+	KeyField  string // Dotted path to the key
+	Prefix    string
+	OnMiss    LookupMissPolicy
+	Defaults  map[string]interface{} // Added to records that miss, with LookupKeep
+	CacheSize int                    // Defaults to 10000, set to 0 to disable caching
+	BatchSize int                    // Defaults to 500
+
+	cache *util.LRUCache
+}
+
+// NewLookupEnricher returns a new LookupEnricher looking up keyField in
+// the source.
+func NewLookupEnricher(source LookupSource, keyField string) *LookupEnricher {
+	return &LookupEnricher{Source: source, KeyField: keyField, CacheSize: 10000, BatchSize: 500}
+}
+
+// ProcessData enriches the records.
+func (e *LookupEnricher) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	e.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but lookups are cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (e *LookupEnricher) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	found, err := e.fetch(ctx, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+
+	enriched := objects[:0]
+	for _, o := range objects {
+		var values map[string]interface{}
+		if v, ok := util.LookupField(o, e.KeyField); ok && v != nil {
+			values = found[valueString(v)]
+		}
+		if values == nil {
+			switch e.OnMiss {
+			case LookupDrop:
+				continue
+			case LookupFail:
+				util.KillPipelineIfErr(util.DataErrorf("LookupEnricher: no match for %v in %v", e.KeyField, o), killChan)
+				return
+			}
+			values = e.Defaults
+		}
+		for k, v := range values {
+			if _, ok := o[e.Prefix+k]; !ok {
+				o[e.Prefix+k] = v
+			}
+		}
+		enriched = append(enriched, o)
+	}
+	if len(enriched) == 0 {
+		return
+	}
+	dd, err := objectsJSON(d, enriched)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// fetch returns the values for the keys of the records, from the cache or
+// the Source. Keys that weren't found have nil values.
+func (e *LookupEnricher) fetch(ctx context.Context, records []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	if e.cache == nil && e.CacheSize > 0 {
+		e.cache = util.NewLRUCache(e.CacheSize)
+	}
+	found := make(map[string]map[string]interface{})
+	var missing []string
+	for _, r := range records {
+		v, ok := util.LookupField(r, e.KeyField)
+		if !ok || v == nil {
+			continue
+		}
+		key := valueString(v)
+		if _, ok := found[key]; ok {
+			continue
+		}
+		if e.cache != nil {
+			if values, ok := e.cache.Get(key); ok {
+				found[key] = values.(map[string]interface{})
+				continue
+			}
+		}
+		found[key] = nil
+		missing = append(missing, key)
+	}
+
+	batchSize := e.BatchSize
+	if batchSize <= 0 {
+		batchSize = len(missing)
+	}
+	for len(missing) > 0 {
+		n := batchSize
+		if n > len(missing) {
+			n = len(missing)
+		}
+		logger.Debug("LookupEnricher: looking up", n, "key(s)")
+		results, err := e.Source.Lookup(ctx, missing[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range missing[:n] {
+			found[key] = results[key]
+			if e.cache != nil {
+				e.cache.Add(key, results[key])
+			}
+		}
+		missing = missing[n:]
+	}
+	return found, nil
+}
+
+// Finish - see interface for documentation.
+func (e *LookupEnricher) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (e *LookupEnricher) String() string {
+	return fmt.Sprintf("LookupEnricher(%v)", e.Source)
+}
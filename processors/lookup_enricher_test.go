@@ -0,0 +1,48 @@
+package processors_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewLookupEnricher() {
+	logger.LogLevel = logger.LevelSilent
+
+	customers := map[string]map[string]interface{}{
+		"1": {"name": "Ann", "country": "DE"},
+		"2": {"name": "Bob", "country": "FR"},
+	}
+	source := processors.LookupFunc(func(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+		fmt.Println("looking up", keys)
+		found := make(map[string]map[string]interface{})
+		for _, key := range keys {
+			if c, ok := customers[key]; ok {
+				found[key] = c
+			}
+		}
+		return found, nil
+	})
+
+	reader := processors.NewIoReader(strings.NewReader(`[{"order":10,"customer_id":1},{"order":11,"customer_id":2},{"order":12,"customer_id":1},{"order":13,"customer_id":3}]`))
+	enricher := processors.NewLookupEnricher(source, "customer_id")
+	enricher.Prefix = "customer_"
+	enricher.OnMiss = processors.LookupDrop
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, enricher, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// looking up [1 2 3]
+	// {"customer_country":"DE","customer_id":1,"customer_name":"Ann","order":10}
+	// {"customer_country":"FR","customer_id":2,"customer_name":"Bob","order":11}
+	// {"customer_country":"DE","customer_id":1,"customer_name":"Ann","order":12}
+}
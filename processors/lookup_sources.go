@@ -0,0 +1,208 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SQLLookup is a LookupSource that looks keys up in a SQL table, fetching
+// each batch of keys with a single SELECT ... WHERE KeyColumn IN (...).
+type SQLLookup struct {
+	DB        *sqlx.DB
+	Table     string
+	KeyColumn string
+	Columns   []string // Defaults to every column
+}
+
+// NewSQLLookup returns a new SQLLookup of keyColumn in table.
+func NewSQLLookup(db *sqlx.DB, table, keyColumn string, columns ...string) *SQLLookup {
+	return &SQLLookup{DB: db, Table: table, KeyColumn: keyColumn, Columns: columns}
+}
+
+// Lookup - see LookupSource.
+func (l *SQLLookup) Lookup(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	columns := "*"
+	if len(l.Columns) > 0 {
+		columns = l.KeyColumn + ", " + strings.Join(l.Columns, ", ")
+	}
+	query, args, err := sqlx.In(fmt.Sprintf("SELECT %v FROM %v WHERE %v IN (?)", columns, l.Table, l.KeyColumn), keys)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := l.DB.QueryxContext(ctx, l.DB.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make(map[string]map[string]interface{})
+	for rows.Next() {
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+		key := fmt.Sprint(row[l.KeyColumn])
+		if len(l.Columns) > 0 {
+			delete(row, l.KeyColumn)
+		}
+		results[key] = row
+	}
+	return results, rows.Err()
+}
+
+func (l *SQLLookup) String() string {
+	return "SQLLookup(" + l.Table + ")"
+}
+
+// RedisLookup is a LookupSource that looks keys up in Redis, fetching each
+// batch of keys in a single pipeline. The values are read from a hash at
+// KeyPrefix + key (HGETALL), or if JSON is set, from a string at that key
+// holding a JSON object (GET).
+type RedisLookup struct {
+	Client    redis.UniversalClient
+	KeyPrefix string
+	JSON      bool
+}
+
+// NewRedisLookup returns a new RedisLookup of hashes at keyPrefix + key.
+func NewRedisLookup(client redis.UniversalClient, keyPrefix string) *RedisLookup {
+	return &RedisLookup{Client: client, KeyPrefix: keyPrefix}
+}
+
+// Lookup - see LookupSource.
+func (l *RedisLookup) Lookup(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	pipe := l.Client.Pipeline()
+	cmds := make([]redis.Cmder, len(keys))
+	for i, key := range keys {
+		if l.JSON {
+			cmds[i] = pipe.Get(ctx, l.KeyPrefix+key)
+		} else {
+			cmds[i] = pipe.HGetAll(ctx, l.KeyPrefix+key)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, util.TransientError(err)
+	}
+
+	results := make(map[string]map[string]interface{})
+	for i, key := range keys {
+		switch cmd := cmds[i].(type) {
+		case *redis.StringCmd:
+			s, err := cmd.Result()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				return nil, util.TransientError(err)
+			}
+			var values map[string]interface{}
+			if err := json.Unmarshal([]byte(s), &values); err != nil {
+				return nil, util.DataErrorf("RedisLookup: %v isn't a JSON object: %v", l.KeyPrefix+key, err)
+			}
+			results[key] = values
+		case *redis.MapStringStringCmd:
+			m, err := cmd.Result()
+			if err != nil {
+				return nil, util.TransientError(err)
+			}
+			if len(m) == 0 {
+				continue
+			}
+			values := make(map[string]interface{}, len(m))
+			for k, v := range m {
+				values[k] = v
+			}
+			results[key] = values
+		}
+	}
+	return results, nil
+}
+
+func (l *RedisLookup) String() string {
+	return "RedisLookup(" + l.KeyPrefix + ")"
+}
+
+// HTTPLookup is a LookupSource that looks each key up with a GET request
+// to URL, with "{key}" replaced by the (escaped) key, e.g.
+// "https://api.example.com/customers/{key}". The response must be a JSON
+// object; keys with a 404 Not Found response are misses.
+type HTTPLookup struct {
+	URL    string
+	Client *http.Client
+	Header http.Header
+}
+
+// NewHTTPLookup returns a new HTTPLookup of the URL.
+func NewHTTPLookup(url string) *HTTPLookup {
+	return &HTTPLookup{URL: url, Client: http.DefaultClient, Header: http.Header{}}
+}
+
+// Lookup - see LookupSource.
+func (l *HTTPLookup) Lookup(ctx context.Context, keys []string) (map[string]map[string]interface{}, error) {
+	results := make(map[string]map[string]interface{})
+	for _, key := range keys {
+		values, err := l.lookup(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if values != nil {
+			results[key] = values
+		}
+	}
+	return results, nil
+}
+
+func (l *HTTPLookup) lookup(ctx context.Context, key string) (map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", strings.Replace(l.URL, "{key}", url.PathEscape(key), -1), nil)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	req = req.WithContext(ctx)
+	for k, v := range l.Header {
+		req.Header[k] = v
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, util.TransientError(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, util.TransientError(err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, util.TransientError(fmt.Errorf("HTTPLookup: %v returned %v", req.URL, resp.Status))
+	case resp.StatusCode >= 300:
+		return nil, util.DataErrorf("HTTPLookup: %v returned %v", req.URL, resp.Status)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, util.DataErrorf("HTTPLookup: %v didn't return a JSON object: %v", req.URL, err)
+	}
+	return values, nil
+}
+
+func (l *HTTPLookup) String() string {
+	return "HTTPLookup(" + l.URL + ")"
+}
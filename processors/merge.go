@@ -0,0 +1,96 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// Merge combines the data from several branches of a branching
+// PipelineLayout into a single stream, so they can converge before e.g. a
+// single writer. Every DataProcessor in the previous stage that outputs to
+// the Merge is one of its sources.
+//
+// Set TagField to add a field to each record naming the source it came
+// from. Sources are named with SetSourceName, or by their String() value
+// by default. Only JSON objects and arrays of objects can be tagged, other
+// data is passed on untagged.
+type Merge struct {
+	TagField    string
+	sourceNames map[ratchet.DataProcessor]string
+}
+
+// NewMerge returns a new Merge that doesn't tag records.
+func NewMerge() *Merge {
+	return &Merge{}
+}
+
+// NewTaggingMerge returns a new Merge that tags records with their source
+// in the given field.
+func NewTaggingMerge(tagField string) *Merge {
+	return &Merge{TagField: tagField}
+}
+
+// SetSourceName sets the name records from the given source are tagged
+// with. It must be called before the Pipeline is run.
+func (m *Merge) SetSourceName(source ratchet.DataProcessor, name string) *Merge {
+	if m.sourceNames == nil {
+		m.sourceNames = make(map[ratchet.DataProcessor]string)
+	}
+	m.sourceNames[source] = name
+	return m
+}
+
+func (m *Merge) sourceName(source ratchet.DataProcessor) string {
+	if name, ok := m.sourceNames[source]; ok {
+		return name
+	}
+	return fmt.Sprintf("%v", source)
+}
+
+// TagSource sets TagField on each record. See
+// ratchet.SourceTaggingDataProcessor.
+func (m *Merge) TagSource(d data.JSON, source ratchet.DataProcessor) data.JSON {
+	if m.TagField == "" {
+		return d
+	}
+	trimmed := bytes.TrimSpace(d)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return d
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		logger.Debug("Merge: unable to tag data from", source, "-", err)
+		return d
+	}
+	name := m.sourceName(source)
+	for _, o := range objects {
+		o[m.TagField] = name
+	}
+	var v interface{} = objects
+	if trimmed[0] == '{' {
+		v = objects[0]
+	}
+	tagged, err := data.NewJSON(v)
+	if err != nil {
+		logger.Debug("Merge: unable to tag data from", source, "-", err)
+		return d
+	}
+	return tagged
+}
+
+// ProcessData sends the data on to the next stage.
+func (m *Merge) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	outputChan <- d
+}
+
+// Finish - see interface for documentation.
+func (m *Merge) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (m *Merge) String() string {
+	return "Merge"
+}
@@ -0,0 +1,52 @@
+package processors_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewTaggingMerge() {
+	logger.LogLevel = logger.LevelSilent
+
+	us := processors.NewJSONLinesReader(strings.NewReader(`{"id":1}`))
+	eu := processors.NewJSONLinesReader(strings.NewReader(`{"id":2}`))
+	merge := processors.NewTaggingMerge("source").
+		SetSourceName(us, "us").
+		SetSourceName(eu, "eu")
+	output := ratchet.NewNamedOutput("merged", 10)
+
+	layout, _ := ratchet.NewPipelineLayout(
+		ratchet.NewPipelineStage(
+			ratchet.Do(us).Outputs(merge),
+			ratchet.Do(eu).Outputs(merge),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(merge).Outputs(output),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(output),
+		),
+	)
+	pipeline := ratchet.NewBranchingPipeline(layout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	// The branches run concurrently, so sort the results.
+	var merged []string
+	for d := range pipeline.Output("merged") {
+		merged = append(merged, string(d))
+	}
+	sort.Strings(merged)
+	fmt.Println(strings.Join(merged, "\n"))
+
+	// Output:
+	// [{"id":1,"source":"us"}]
+	// [{"id":2,"source":"eu"}]
+}
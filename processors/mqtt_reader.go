@@ -0,0 +1,271 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// MQTTMessage is a message received from an MQTT broker, as sent by an
+// MQTTReader with Metadata set. Payload holds the message's payload if
+// it's JSON, and otherwise the payload as a string.
+type MQTTMessage struct {
+	Topic      string          `json:"topic"`
+	QoS        byte            `json:"qos"`
+	Retained   bool            `json:"retained,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// MQTTReader subscribes to Topics (which may have wildcards) on an MQTT
+// broker, with the given QoS, and sends the messages it receives in
+// batches: as an array of their payloads once BatchSize messages have been
+// received, or FlushInterval after the first of them, so telemetry can go
+// straight to SQL or file writers without a transaction per message.
+// Payloads that aren't JSON are sent as strings. With Metadata, each
+// message is sent as an MQTTMessage instead.
+//
+// The client connects, and reconnects whenever its connection is lost,
+// subscribing to Topics again each time. With QoS 1 or 2, messages are
+// acknowledged once they've been sent on, so with a persistent session
+// (CleanSession unset in the client options, and a fixed client ID) those
+// received but not yet sent are delivered again after a restart.
+//
+// If IdleTimeout is set, the reader stops once no messages have been
+// received for that long; otherwise it runs until the Pipeline is
+// cancelled.
+type MQTTReader struct {
+	Topics        []string
+	QoS           byte          // 0, 1 or 2
+	BatchSize     int           // Defaults to 100
+	FlushInterval time.Duration // Defaults to 1 second
+	IdleTimeout   time.Duration
+	Metadata      bool
+
+	client   mqtt.Client
+	messages chan mqttReceived
+	errs     chan error
+	done     chan struct{} // Closed when read returns
+	mutex    sync.Mutex
+}
+
+// mqttReceived is a message, and when it was received.
+type mqttReceived struct {
+	mqtt.Message
+	at time.Time
+}
+
+// NewMQTTReader returns a new MQTTReader subscribing to topics with a
+// client created from options, which are set to reconnect automatically.
+func NewMQTTReader(options *mqtt.ClientOptions, topics ...string) *MQTTReader {
+	r := &MQTTReader{
+		Topics:    topics,
+		BatchSize: 100,
+		messages:  make(chan mqttReceived, 100),
+		errs:      make(chan error, 1),
+	}
+	options.SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetAutoAckDisabled(true).
+		SetOnConnectHandler(r.subscribe).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			logger.Info("MQTTReader: connection lost, reconnecting:", err)
+		})
+	r.client = mqtt.NewClient(options)
+	return r
+}
+
+// subscribe subscribes to Topics, when the client has connected.
+func (r *MQTTReader) subscribe(c mqtt.Client) {
+	if r.QoS > 2 {
+		r.fail(util.ConfigErrorf("MQTTReader: QoS must be 0, 1 or 2, not %d", r.QoS))
+		return
+	}
+	filters := make(map[string]byte, len(r.Topics))
+	for _, t := range r.Topics {
+		filters[t] = r.QoS
+	}
+	token := c.SubscribeMultiple(filters, r.receive)
+	token.Wait()
+	if err := token.Error(); err != nil {
+		r.fail(fmt.Errorf("MQTTReader: subscribing to %v: %v", strings.Join(r.Topics, ", "), err))
+		return
+	}
+	logger.Info("MQTTReader: subscribed to", strings.Join(r.Topics, ", "))
+}
+
+// receive queues a message for read. It blocks while the queue is full,
+// which holds back the client's other messages, in order.
+func (r *MQTTReader) receive(c mqtt.Client, m mqtt.Message) {
+	r.mutex.Lock()
+	done := r.done
+	r.mutex.Unlock()
+	select {
+	case r.messages <- mqttReceived{Message: m, at: time.Now()}:
+	case <-done:
+	}
+}
+
+func (r *MQTTReader) fail(err error) {
+	select {
+	case r.errs <- err:
+	default:
+	}
+}
+
+// ProcessData - see interface for documentation.
+func (r *MQTTReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx receives messages until the Pipeline is cancelled, or it
+// has been idle for IdleTimeout. See ratchet.ContextDataProcessor.
+func (r *MQTTReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(r.read(ctx, outputChan), killChan)
+}
+
+func (r *MQTTReader) read(ctx context.Context, outputChan chan data.JSON) error {
+	if len(r.Topics) == 0 {
+		return util.ConfigErrorf("MQTTReader: no topics")
+	}
+	done := make(chan struct{})
+	r.mutex.Lock()
+	r.done = done
+	r.mutex.Unlock()
+	defer close(done)
+	// Messages left from a previous read weren't acknowledged, so they're
+	// delivered again.
+	for len(r.messages) > 0 {
+		<-r.messages
+	}
+	select {
+	case <-r.errs:
+	default:
+	}
+
+	token := r.client.Connect()
+	select {
+	case <-token.Done():
+		if err := token.Error(); err != nil {
+			return err
+		}
+	case <-ctx.Done():
+		r.client.Disconnect(250)
+		return nil
+	}
+	defer r.client.Disconnect(250)
+
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	flushInterval := r.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if r.IdleTimeout > 0 {
+		idleTimer = time.NewTimer(r.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	for {
+		var batch []mqttReceived
+		select {
+		case m := <-r.messages:
+			batch = append(batch, m)
+		case err := <-r.errs:
+			return err
+		case <-idle:
+			logger.Info("MQTTReader: no messages for", r.IdleTimeout, "stopping")
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+
+		flush := time.NewTimer(flushInterval)
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case m := <-r.messages:
+				batch = append(batch, m)
+			case <-flush.C:
+				break collect
+			case <-ctx.Done():
+				flush.Stop()
+				// The batch isn't acknowledged, so it can be delivered again.
+				return nil
+			}
+		}
+		flush.Stop()
+
+		d, err := r.messagesJSON(batch)
+		if err != nil {
+			return err
+		}
+		select {
+		case outputChan <- d:
+		case <-ctx.Done():
+			return nil
+		}
+		for _, m := range batch {
+			m.Ack()
+		}
+		logger.Debug("MQTTReader:", len(batch), "messages sent")
+		if idleTimer != nil {
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(r.IdleTimeout)
+		}
+	}
+}
+
+// messagesJSON returns messages as the JSON array sent on.
+func (r *MQTTReader) messagesJSON(messages []mqttReceived) (data.JSON, error) {
+	values := make([]json.RawMessage, len(messages))
+	for i, m := range messages {
+		v := json.RawMessage(m.Payload())
+		if !json.Valid(v) {
+			b, err := json.Marshal(string(v))
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+		if r.Metadata {
+			b, err := json.Marshal(MQTTMessage{
+				Topic:      m.Topic(),
+				QoS:        m.Qos(),
+				Retained:   m.Retained(),
+				ReceivedAt: m.at,
+				Payload:    v,
+			})
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+		values[i] = v
+	}
+	return data.NewJSON(values)
+}
+
+// Finish - see interface for documentation.
+func (r *MQTTReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *MQTTReader) String() string {
+	return "MQTTReader"
+}
@@ -0,0 +1,93 @@
+package processors
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// MSSQLWriter writes data.JSON into a SQL Server table using bulk copy,
+// which is far faster than INSERT statements for loading large amounts
+// of data. If an error occurs while copying, the error will be sent to
+// the killChan.
+//
+// Note that the data.JSON must be a valid JSON object or a slice
+// of valid objects, where the keys are column names and the
+// the values are the SQL values to be inserted into those columns.
+// Every column must exist in the table.
+//
+// For use-cases where a MSSQLWriter instance needs to write to
+// multiple tables you can pass in SQLWriterData.
+//
+// The database must be opened with the "sqlserver" driver from
+// github.com/microsoft/go-mssqldb. See util.MSSQLBulkOptions for the
+// meaning of the options.
+type MSSQLWriter struct {
+	writeDB          *sqlx.DB
+	TableName        string
+	ConcurrencyLevel int // See ConcurrentDataProcessor
+	BatchSize        int
+	IdentityInsert   bool
+	TableLock        bool
+	CheckConstraints bool
+	FireTriggers     bool
+	KeepNulls        bool
+	// Timeout limits each bulk copy, so a hung database fails the
+	// Pipeline instead of blocking it. See util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries each batch that fails with a retryable error, such
+	// as a lost connection or a deadlock. See util.SQLRetry.
+	Retry util.SQLRetry
+}
+
+// NewMSSQLWriter returns a new MSSQLWriter
+func NewMSSQLWriter(db *sqlx.DB, tableName string) *MSSQLWriter {
+	return &MSSQLWriter{writeDB: db, TableName: tableName}
+}
+
+// ProcessData defers to util.MSSQLBulkInsertData
+func (s *MSSQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the bulk copies are
+// cancelled when ctx is done. See ratchet.ContextDataProcessor.
+func (s *MSSQLWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	logger.Info("MSSQLWriter: Writing data...")
+	err = util.MSSQLBulkInsertData(ctx, s.writeDB, d, util.MSSQLBulkOptions{
+		TableName:        tableName,
+		BatchSize:        s.BatchSize,
+		IdentityInsert:   s.IdentityInsert,
+		TableLock:        s.TableLock,
+		CheckConstraints: s.CheckConstraints,
+		FireTriggers:     s.FireTriggers,
+		KeepNulls:        s.KeepNulls,
+		Timeout:          s.Timeout,
+		Retry:            s.Retry,
+	})
+	util.KillPipelineIfErr(err, killChan)
+	logger.Info("MSSQLWriter: Write complete")
+}
+
+// Finish - see interface for documentation.
+func (s *MSSQLWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (s *MSSQLWriter) String() string {
+	return "MSSQLWriter"
+}
+
+// Concurrency defers to ConcurrentDataProcessor
+func (s *MSSQLWriter) Concurrency() int {
+	return s.ConcurrencyLevel
+}
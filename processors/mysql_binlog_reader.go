@@ -0,0 +1,310 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/go-mysql-org/go-mysql/canal"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// BinlogPosition is a position in a MySQL server's binary log.
+type BinlogPosition struct {
+	File string `json:"file"`
+	Pos  uint32 `json:"pos"`
+}
+
+// ChangeEvent is a single row change read from a database's change log,
+// such as an insert, update or delete in the MySQL binlog. Before holds
+// the row before an update or delete, and After the row after an insert
+// or update.
+type ChangeEvent struct {
+	Op        string                 `json:"op"` // "insert", "update", "delete" or "truncate"
+	Schema    string                 `json:"schema"`
+	Table     string                 `json:"table"`
+	Timestamp int64                  `json:"ts"` // Unix time of the change
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	Position  interface{}            `json:"position"` // Where the change was read from
+}
+
+// MySQLBinlogReader tails a MySQL (or MariaDB) server's binary log as a
+// replica, and sends the row changes it reads as ChangeEvents, for change
+// data capture pipelines. It uses go-mysql
+// (https://github.com/go-mysql-org/go-mysql), and needs binlog_format=ROW
+// and a user with the REPLICATION SLAVE and REPLICATION CLIENT privileges.
+//
+// Events are sent in arrays of up to BatchSize, at least once per
+// transaction. Tables limits the tables read, as regular expressions
+// matching "schema.table".
+//
+// Reading starts from the position saved to Checkpoints if there is one,
+// then from Start, and otherwise from the server's current position, so
+// only new changes are read. The position after the last complete
+// transaction read is saved to Checkpoints when the Pipeline succeeds
+// (see ratchet.CommittingDataProcessor). With StopAtCurrent, the reader
+// stops once it reaches the server's position when it started, so it can
+// be run on a schedule (see ratchet.Schedule) to replicate changes in
+// small batches; otherwise it runs until the Pipeline is cancelled.
+type MySQLBinlogReader struct {
+	Addr          string // host:port
+	User          string
+	Password      string
+	Flavor        string // "mysql" (the default) or "mariadb"
+	ServerID      uint32 // Must be unique among the server's replicas, defaults to a random ID
+	Tables        []string
+	ExcludeTables []string
+	BatchSize     int // Defaults to 1000
+	Start         *BinlogPosition
+	StopAtCurrent bool
+	Checkpoints   ratchet.CheckpointStore
+	CheckpointKey string // Defaults to "mysql_binlog:" + Addr
+
+	position *BinlogPosition
+}
+
+// NewMySQLBinlogReader returns a new MySQLBinlogReader for the server at
+// addr.
+func NewMySQLBinlogReader(addr, user, password string) *MySQLBinlogReader {
+	return &MySQLBinlogReader{Addr: addr, User: user, Password: password, BatchSize: 1000}
+}
+
+// ProcessData - see interface for documentation.
+func (r *MySQLBinlogReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx reads the binlog until the Pipeline is cancelled, or it
+// has caught up with StopAtCurrent. See ratchet.ContextDataProcessor.
+func (r *MySQLBinlogReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	util.KillPipelineIfErr(r.read(ctx, outputChan), killChan)
+}
+
+func (r *MySQLBinlogReader) read(ctx context.Context, outputChan chan data.JSON) error {
+	cfg := canal.NewDefaultConfig()
+	cfg.Addr, cfg.User, cfg.Password = r.Addr, r.User, r.Password
+	if r.Flavor != "" {
+		cfg.Flavor = r.Flavor
+	}
+	if r.ServerID != 0 {
+		cfg.ServerID = r.ServerID
+	}
+	cfg.IncludeTableRegex = r.Tables
+	cfg.ExcludeTableRegex = r.ExcludeTables
+	// Only read the binlog, without dumping the existing data first.
+	cfg.Dump.ExecutionPath = ""
+	cfg.Logger = slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+	c, err := canal.NewCanal(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	start, err := r.startPosition(c)
+	if err != nil {
+		return err
+	}
+	h := &binlogHandler{reader: r, ctx: ctx, outputChan: outputChan, file: start.Name, caughtUp: make(chan struct{})}
+	if r.StopAtCurrent {
+		current, err := c.GetMasterPos()
+		if err != nil {
+			return err
+		}
+		if start.Compare(current) >= 0 {
+			logger.Info("MySQLBinlogReader: no changes since", start)
+			return nil
+		}
+		h.stopAt = &current
+	}
+	c.SetEventHandler(h)
+
+	logger.Info("MySQLBinlogReader: reading from", start)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.RunFrom(start)
+	}()
+	select {
+	case <-ctx.Done():
+		// The Pipeline reports the cancellation.
+		c.Close()
+		<-done
+		return nil
+	case <-h.caughtUp:
+		c.Close()
+		<-done
+		return h.err
+	case err := <-done:
+		if h.err != nil {
+			return h.err
+		}
+		return err
+	}
+}
+
+func (r *MySQLBinlogReader) checkpointKey() string {
+	if r.CheckpointKey != "" {
+		return r.CheckpointKey
+	}
+	return "mysql_binlog:" + r.Addr
+}
+
+func (r *MySQLBinlogReader) startPosition(c *canal.Canal) (mysql.Position, error) {
+	if r.Checkpoints != nil {
+		var saved BinlogPosition
+		ok, err := r.Checkpoints.Load(r.checkpointKey(), &saved)
+		if err != nil {
+			return mysql.Position{}, err
+		}
+		if ok {
+			return mysql.Position{Name: saved.File, Pos: saved.Pos}, nil
+		}
+	}
+	if r.Start != nil {
+		return mysql.Position{Name: r.Start.File, Pos: r.Start.Pos}, nil
+	}
+	return c.GetMasterPos()
+}
+
+// Commit saves the position after the last complete transaction read.
+// See ratchet.CommittingDataProcessor.
+func (r *MySQLBinlogReader) Commit() error {
+	if r.Checkpoints == nil || r.position == nil {
+		return nil
+	}
+	logger.Info("MySQLBinlogReader: saving position", *r.position)
+	return r.Checkpoints.Save(r.checkpointKey(), r.position)
+}
+
+// Finish - see interface for documentation.
+func (r *MySQLBinlogReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *MySQLBinlogReader) String() string {
+	return fmt.Sprintf("MySQLBinlogReader(%v)", r.Addr)
+}
+
+// binlogHandler receives the binlog events from canal, batching the row
+// changes until the end of each transaction.
+type binlogHandler struct {
+	canal.DummyEventHandler
+	reader     *MySQLBinlogReader
+	ctx        context.Context
+	outputChan chan data.JSON
+	file       string
+	batch      []ChangeEvent
+	stopAt     *mysql.Position
+	caughtUp   chan struct{}
+	err        error
+}
+
+func (h *binlogHandler) OnRotate(header *replication.EventHeader, e *replication.RotateEvent) error {
+	h.file = string(e.NextLogName)
+	return nil
+}
+
+func (h *binlogHandler) OnRow(e *canal.RowsEvent) error {
+	columns := e.Table.Columns
+	row := func(values []interface{}) map[string]interface{} {
+		m := make(map[string]interface{}, len(values))
+		for i, v := range values {
+			if i < len(columns) {
+				m[columns[i].Name] = binlogValue(v)
+			}
+		}
+		return m
+	}
+	event := ChangeEvent{
+		Op:        e.Action,
+		Schema:    e.Table.Schema,
+		Table:     e.Table.Name,
+		Timestamp: int64(e.Header.Timestamp),
+		Position:  BinlogPosition{File: h.file, Pos: e.Header.LogPos},
+	}
+	switch e.Action {
+	case canal.UpdateAction:
+		// Updated rows come in pairs of before and after.
+		for i := 0; i+1 < len(e.Rows); i += 2 {
+			event.Before, event.After = row(e.Rows[i]), row(e.Rows[i+1])
+			h.batch = append(h.batch, event)
+		}
+	case canal.DeleteAction:
+		for _, values := range e.Rows {
+			event.Before = row(values)
+			h.batch = append(h.batch, event)
+		}
+	default:
+		for _, values := range e.Rows {
+			event.After = row(values)
+			h.batch = append(h.batch, event)
+		}
+	}
+	if batchSize := h.reader.BatchSize; batchSize > 0 && len(h.batch) >= batchSize {
+		return h.flush()
+	}
+	return nil
+}
+
+func (h *binlogHandler) OnXID(header *replication.EventHeader, nextPos mysql.Position) error {
+	if err := h.flush(); err != nil {
+		return err
+	}
+	h.reader.position = &BinlogPosition{File: nextPos.Name, Pos: nextPos.Pos}
+	return nil
+}
+
+func (h *binlogHandler) OnPosSynced(header *replication.EventHeader, pos mysql.Position, set mysql.GTIDSet, force bool) error {
+	if header == nil {
+		// Called when canal is closed.
+		return nil
+	}
+	h.file = pos.Name
+	if len(h.batch) == 0 {
+		h.reader.position = &BinlogPosition{File: pos.Name, Pos: pos.Pos}
+	}
+	if h.stopAt != nil && pos.Compare(*h.stopAt) >= 0 {
+		if err := h.flush(); err != nil {
+			return err
+		}
+		h.stopAt = nil
+		close(h.caughtUp)
+	}
+	return nil
+}
+
+func (h *binlogHandler) flush() error {
+	if len(h.batch) == 0 {
+		return nil
+	}
+	d, err := data.NewJSON(h.batch)
+	if err != nil {
+		h.err = err
+		return err
+	}
+	h.batch = nil
+	select {
+	case h.outputChan <- d:
+		return nil
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	}
+}
+
+func (h *binlogHandler) String() string {
+	return "binlogHandler"
+}
+
+// binlogValue converts a column value to one that marshals to JSON
+// sensibly: strings and blobs come from the binlog as []byte.
+func binlogValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
@@ -1,8 +1,12 @@
 package processors
 
 import (
+	"context"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 
+	"github.com/fefelovgroup/ratchet"
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
 	"github.com/fefelovgroup/ratchet/util"
@@ -18,6 +22,22 @@ import (
 //
 // For use-cases where a MySQLWriter instance needs to write to
 // multiple tables you can pass in SQLWriterData.
+//
+// Set LoadData to write each batch with LOAD DATA LOCAL INFILE instead of
+// INSERT, which is much faster for large loads. See
+// util.MySQLLoadDataContext for how it differs (OnDupKeyUpdate replaces
+// whole rows, and OnDupKeyFields isn't supported).
+//
+// Set IDField to the table's AUTO_INCREMENT column to send the records
+// written on with the IDs generated for them, so a later stage can load
+// child rows referring to them. Rows are then inserted one at a time, see
+// util.InsertReturningIDs.
+//
+// Set LoadStrategy to replace the tables' rows rather than add to them:
+// util.SQLLoadTruncate empties each table before writing to it, while
+// util.SQLLoadSwap writes to a staging table and swaps its rows into the
+// table when the MySQLWriter is finished, so consumers never see a partially
+// loaded table.
 type MySQLWriter struct {
 	writeDB          *sqlx.DB
 	TableName        string
@@ -25,6 +45,26 @@ type MySQLWriter struct {
 	OnDupKeyFields   []string
 	ConcurrencyLevel int // See ConcurrentDataProcessor
 	BatchSize        int
+	// BatchConcurrencyLevel sets how many batches (of BatchSize objects) from
+	// a single data payload are written in parallel. See util.ForEachBatch.
+	BatchConcurrencyLevel int
+	// Timeout limits each INSERT, so a hung database fails the Pipeline
+	// instead of blocking it. See util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries each batch that fails with a retryable error, such
+	// as a lost connection or a deadlock. See util.SQLRetry.
+	Retry util.SQLRetry
+	// LoadData writes batches with LOAD DATA LOCAL INFILE instead of
+	// INSERT. See util.MySQLLoadDataContext.
+	LoadData bool
+	// IDField is set in each record to the ID generated for its row, and
+	// the records are sent on. See util.InsertReturningIDs.
+	IDField string
+	// LoadStrategy decides what happens to the rows already in the
+	// tables written to: util.SQLLoadAppend (the default),
+	// util.SQLLoadTruncate or util.SQLLoadSwap. See util.PrepareSQLLoad.
+	LoadStrategy string
+	load         sqlLoad
 }
 
 // NewMySQLWriter returns a new MySQLWriter
@@ -34,6 +74,12 @@ func NewMySQLWriter(db *sqlx.DB, tableName string) *MySQLWriter {
 
 // ProcessData defers to util.MySQLInsertData
 func (s *MySQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the INSERTs are cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (s *MySQLWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	// handle panics a bit more gracefully
 	defer func() {
 		if err := recover(); err != nil {
@@ -41,26 +87,62 @@ func (s *MySQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killCh
 		}
 	}()
 
-	// First check for SQLWriterData
-	var wd SQLWriterData
-	err := data.ParseJSONSilent(d, &wd)
 	logger.Info("MySQLWriter: Writing data...")
-	if err == nil && wd.TableName != "" && wd.InsertData != nil {
-		logger.Debug("MySQLWriter: SQLWriterData scenario")
-		dd, err := data.NewJSON(wd.InsertData)
-		util.KillPipelineIfErr(err, killChan)
-		err = util.MySQLInsertData(s.writeDB, dd, wd.TableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
-		util.KillPipelineIfErr(err, killChan)
-	} else {
-		logger.Debug("MySQLWriter: normal data scenario")
-		err = util.MySQLInsertData(s.writeDB, d, s.TableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
-		util.KillPipelineIfErr(err, killChan)
-	}
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	util.KillPipelineIfErr(err, killChan)
+	err = s.insert(ctx, d, tableName, outputChan)
+	util.KillPipelineIfErr(err, killChan)
 	logger.Info("MySQLWriter: Write complete")
 }
 
-// Finish - see interface for documentation.
+func (s *MySQLWriter) insert(ctx context.Context, d data.JSON, tableName string, outputChan chan data.JSON) error {
+	exec := util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry}
+	tableName, err := s.load.table(ctx, s.writeDB, s.LoadStrategy, tableName, exec)
+	if err != nil {
+		return err
+	}
+	if s.IDField != "" {
+		if s.LoadData {
+			return util.ConfigErrorf("MySQLWriter: IDField isn't supported with LoadData")
+		}
+		return writeWithIDs(d, outputChan, func(objects []map[string]interface{}) error {
+			return util.InsertReturningIDs(ctx, s.writeDB, util.MySQL, objects, tableName, s.OnDupKeyUpdate, nil, s.OnDupKeyFields, s.IDField, s.BatchSize, s.BatchConcurrencyLevel, exec)
+		})
+	}
+	if s.LoadData {
+		if len(s.OnDupKeyFields) > 0 {
+			return util.ConfigErrorf("MySQLWriter: OnDupKeyFields isn't supported with LoadData")
+		}
+		return util.MySQLLoadDataContext(ctx, s.writeDB, d, tableName, s.OnDupKeyUpdate, s.BatchSize, s.BatchConcurrencyLevel, exec)
+	}
+	return util.MySQLInsertDataContext(ctx, s.writeDB, d, tableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize, s.BatchConcurrencyLevel, exec)
+}
+
+// DryRun returns the INSERT (or LOAD DATA) statements ProcessData would
+// execute. See ratchet.DryRunner.
+func (s *MySQLWriter) DryRun(d data.JSON) ([]ratchet.DryRunWrite, error) {
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if s.LoadData {
+		statements, err := util.MySQLLoadDataSQL(d, tableName, s.OnDupKeyUpdate, s.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		return []ratchet.DryRunWrite{{Target: tableName, Statements: statements}}, nil
+	}
+	statements, err := util.MySQLInsertSQL(d, tableName, s.OnDupKeyUpdate, s.OnDupKeyFields, s.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	return []ratchet.DryRunWrite{{Target: tableName, Statements: statements}}, nil
+}
+
+// Finish completes the load of the tables written to, see LoadStrategy.
 func (s *MySQLWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	err := s.load.finish(s.writeDB, s.LoadStrategy, util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry})
+	util.KillPipelineIfErr(err, killChan)
 }
 
 func (s *MySQLWriter) String() string {
@@ -0,0 +1,40 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// isObjectJSON returns whether d is a single JSON object (rather than an
+// array).
+func isObjectJSON(d data.JSON) bool {
+	trimmed := bytes.TrimSpace(d)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// objectsJSON returns the objects as JSON in the same shape as d, the
+// payload they were decoded from: a single object if d was an object, or
+// an array otherwise. objects must not be empty if d was an object.
+func objectsJSON(d data.JSON, objects []map[string]interface{}) (data.JSON, error) {
+	if isObjectJSON(d) {
+		return data.NewJSON(objects[0])
+	}
+	return data.NewJSON(objects)
+}
+
+// valueString returns a field's value as a string, e.g. to use it as a key:
+// strings as they are, numbers without exponents, and anything else as
+// JSON.
+func valueString(v interface{}) string {
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
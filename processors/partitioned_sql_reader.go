@@ -0,0 +1,283 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// PartitionedSQLReader is a SQLReader that splits its query into
+// Partitions parts and reads them concurrently, which can make extracting
+// a large table much faster. Rows from every partition are sent on as
+// they're read, so they aren't in any particular order.
+//
+// By default the query is split into ranges of PartitionColumn, which
+// can be a numeric or date/time column. The range between Lower and Upper
+// is divided evenly; if they aren't set, they're queried (as the MIN and
+// MAX of the column). The first and last partitions are open ended, and
+// the first also reads NULLs, so every row is read even if the bounds are
+// out of date. Set Modulo to split by PartitionColumn modulo Partitions
+// instead, for integer keys whose values are unevenly spread.
+//
+// Each partition's condition replaces {{partition}} in the query, so it
+// can be applied where it's most efficient, e.g.
+//
+//	SELECT * FROM orders o JOIN customers c ON ... WHERE {{partition}}
+//
+// Otherwise the query is wrapped as
+// SELECT * FROM (<query>) ratchet_partition WHERE <condition>.
+//
+// PartitionedSQLReader is composed of a SQLReader, so it supports all of
+// the same properties and usage options (such as dynamic querying, named
+// parameters and watermarks).
+type PartitionedSQLReader struct {
+	SQLReader
+	PartitionColumn string
+	Partitions      int
+	Modulo          bool
+	Lower, Upper    interface{}
+	// Parallelism limits how many partitions are read at once, and
+	// defaults to Partitions.
+	Parallelism int
+}
+
+// NewPartitionedSQLReader returns a new PartitionedSQLReader operating in
+// static mode, splitting the query into partitions by column.
+func NewPartitionedSQLReader(dbConn *sqlx.DB, sql, column string, partitions int) *PartitionedSQLReader {
+	return &PartitionedSQLReader{
+		SQLReader:       *NewSQLReader(dbConn, sql),
+		PartitionColumn: column,
+		Partitions:      partitions,
+	}
+}
+
+// NewDynamicPartitionedSQLReader returns a new PartitionedSQLReader
+// operating in dynamic mode.
+func NewDynamicPartitionedSQLReader(dbConn *sqlx.DB, sqlGenerator func(data.JSON) (string, error), column string, partitions int) *PartitionedSQLReader {
+	r := NewPartitionedSQLReader(dbConn, "", column, partitions)
+	r.sqlGenerator = sqlGenerator
+	return r
+}
+
+// ProcessData reads every partition of the query.
+func (r *PartitionedSQLReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the queries are
+// cancelled when ctx is done. See ratchet.ContextDataProcessor.
+func (r *PartitionedSQLReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if r.PartitionColumn == "" {
+		util.KillPipelineIfErr(util.ConfigErrorf("PartitionedSQLReader: PartitionColumn is required"), killChan)
+		return
+	}
+	sql, args, err := r.querySQL(d)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	conditions, err := r.conditions(ctx, sql, args)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+
+	// Stop reading the other partitions if one fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	onErr := func(err error) {
+		once.Do(func() {
+			cancel()
+			util.KillPipelineIfErr(err, killChan)
+		})
+	}
+
+	parallelism := r.Parallelism
+	if parallelism <= 0 {
+		parallelism = len(conditions)
+	}
+	throttle := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, condition := range conditions {
+		partitionSQL := partitionQuery(sql, condition)
+		wg.Add(1)
+		throttle <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-throttle }()
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Debug("PartitionedSQLReader: reading partition", i+1, "of", len(conditions))
+			r.forEachSQLData(ctx, partitionSQL, args, onErr, func(d data.JSON) {
+				select {
+				case outputChan <- d:
+				case <-ctx.Done():
+				}
+			})
+		}(i)
+	}
+	wg.Wait()
+}
+
+// conditions returns the WHERE condition of each partition.
+func (r *PartitionedSQLReader) conditions(ctx context.Context, sql string, args []interface{}) ([]string, error) {
+	col := r.PartitionColumn
+	n := r.Partitions
+	if n <= 1 {
+		return []string{"1=1"}, nil
+	}
+	if r.Modulo {
+		conditions := make([]string, n)
+		for i := range conditions {
+			// ABS, since the remainder of a negative value is negative.
+			conditions[i] = fmt.Sprintf("ABS(%v %% %d) = %d", col, n, i)
+		}
+		conditions[0] += fmt.Sprintf(" OR %v IS NULL", col)
+		return conditions, nil
+	}
+
+	lower, upper := r.Lower, r.Upper
+	if lower == nil || upper == nil {
+		var min, max interface{}
+		err := util.SQLExecOptions{Timeout: r.Timeout, Retry: r.Retry}.Run(ctx, r.readDB, func(ctx context.Context) error {
+			query := fmt.Sprintf("SELECT MIN(%v), MAX(%v) FROM (%v) ratchet_bounds", col, col, partitionQuery(sql, "1=1"))
+			return r.readDB.QueryRowxContext(ctx, query, args...).Scan(&min, &max)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if lower == nil {
+			lower = min
+		}
+		if upper == nil {
+			upper = max
+		}
+		if lower == nil || upper == nil {
+			// There are no rows (or only NULLs).
+			return []string{"1=1"}, nil
+		}
+	}
+	bounds, err := partitionBounds(lower, upper, n)
+	if err != nil {
+		return nil, util.ConfigErrorf("PartitionedSQLReader: %v", err)
+	}
+	if len(bounds) == 0 {
+		return []string{"1=1"}, nil
+	}
+
+	// bounds are the start of every partition but the first.
+	conditions := []string{fmt.Sprintf("%v < %v OR %v IS NULL", col, sqlLiteral(bounds[0]), col)}
+	for i := 1; i < len(bounds); i++ {
+		conditions = append(conditions, fmt.Sprintf("%v >= %v AND %v < %v", col, sqlLiteral(bounds[i-1]), col, sqlLiteral(bounds[i])))
+	}
+	conditions = append(conditions, fmt.Sprintf("%v >= %v", col, sqlLiteral(bounds[len(bounds)-1])))
+	return conditions, nil
+}
+
+// partitionQuery applies a partition's condition to sql.
+func partitionQuery(sql, condition string) string {
+	if strings.Contains(sql, "{{partition}}") {
+		return strings.Replace(sql, "{{partition}}", "("+condition+")", -1)
+	}
+	return fmt.Sprintf("SELECT * FROM (%v) ratchet_partition WHERE %v", sql, condition)
+}
+
+// partitionBounds divides the range from lower to upper into n, and
+// returns the n-1 values between the partitions. Ranges too small to
+// split return fewer.
+func partitionBounds(lower, upper interface{}, n int) ([]interface{}, error) {
+	lower, upper = partitionValue(lower), partitionValue(upper)
+	var bounds []interface{}
+	add := func(v interface{}) {
+		if len(bounds) == 0 || bounds[len(bounds)-1] != v {
+			bounds = append(bounds, v)
+		}
+	}
+	switch lo := lower.(type) {
+	case int64:
+		hi, ok := upper.(int64)
+		if !ok {
+			break
+		}
+		for i := 1; i < n; i++ {
+			if b := lo + int64(float64(hi-lo)*float64(i)/float64(n)); b > lo {
+				add(b)
+			}
+		}
+		return bounds, nil
+	case float64:
+		hi, ok := upper.(float64)
+		if !ok {
+			break
+		}
+		for i := 1; i < n; i++ {
+			if b := lo + (hi-lo)*float64(i)/float64(n); b > lo {
+				add(b)
+			}
+		}
+		return bounds, nil
+	case time.Time:
+		hi, ok := upper.(time.Time)
+		if !ok {
+			break
+		}
+		for i := 1; i < n; i++ {
+			if b := lo.Add(time.Duration(float64(hi.Sub(lo)) * float64(i) / float64(n))); b.After(lo) {
+				add(b)
+			}
+		}
+		return bounds, nil
+	}
+	return nil, fmt.Errorf("can't split the range from %v (%T) to %v (%T)", lower, lower, upper, upper)
+}
+
+// partitionTimeLayouts are the layouts that string bounds are parsed
+// with, as returned by MySQL without parseTime.
+var partitionTimeLayouts = []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano, "2006-01-02"}
+
+// partitionValue converts a bound to an int64, float64 or time.Time if it
+// can.
+func partitionValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case int:
+		return int64(vv)
+	case int32:
+		return int64(vv)
+	case uint32:
+		return int64(vv)
+	case uint64:
+		return int64(vv)
+	case float32:
+		return float64(vv)
+	case []byte:
+		return partitionValue(string(vv))
+	case string:
+		if i, err := strconv.ParseInt(vv, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(vv, 64); err == nil {
+			return f
+		}
+		for _, layout := range partitionTimeLayouts {
+			if t, err := time.Parse(layout, vv); err == nil {
+				return t
+			}
+		}
+	}
+	return v
+}
+
+func (r *PartitionedSQLReader) String() string {
+	return fmt.Sprintf("PartitionedSQLReader(%v, %d)", r.PartitionColumn, r.Partitions)
+}
@@ -0,0 +1,55 @@
+package processors
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// PGPDecryptor decrypts OpenPGP messages for inbound files. Each data payload
+// received is expected to be a complete encrypted message (for example the
+// output of a FileReader or S3Reader with LineByLine set to false), and the
+// decrypted contents are sent on to the next stage.
+type PGPDecryptor struct {
+	keyring    openpgp.EntityList
+	Passphrase []byte // Used to unlock passphrase protected private keys.
+}
+
+// NewPGPDecryptor returns a new PGPDecryptor using the private keys read from
+// privateKeys (armored or binary keyring).
+func NewPGPDecryptor(privateKeys io.Reader) (*PGPDecryptor, error) {
+	keyring, err := util.ReadPGPKeyRing(privateKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &PGPDecryptor{keyring: keyring}, nil
+}
+
+// ProcessData decrypts the message and sends the plaintext to outputChan
+func (p *PGPDecryptor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r, err := util.NewPGPDecryptReader(bytes.NewReader(d), p.keyring, p.Passphrase)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	dd, err := ioutil.ReadAll(r)
+	if err != nil {
+		// The message is truncated or fails its integrity check, so none
+		// of the plaintext can be trusted.
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Finish - see interface for documentation.
+func (p *PGPDecryptor) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (p *PGPDecryptor) String() string {
+	return "PGPDecryptor"
+}
@@ -0,0 +1,76 @@
+package processors
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// PGPEncryptor encrypts the data it receives using OpenPGP and sends the
+// resulting ciphertext on to the next stage. All data payloads received are
+// treated as one continuous plaintext stream, so the output of a single
+// PGPEncryptor forms a single encrypted message. Ciphertext is sent
+// downstream as it becomes available, and the final packets are sent during
+// Finish.
+//
+// A typical use is placing PGPEncryptor in front of a file writer such as
+// IoWriter, S3Writer or FtpWriter when the destination requires encrypted
+// files.
+type PGPEncryptor struct {
+	recipients openpgp.EntityList
+	Armor      bool // Set to true to ASCII armor the output.
+	buf        bytes.Buffer
+	writer     io.WriteCloser
+}
+
+// NewPGPEncryptor returns a new PGPEncryptor that will encrypt data for all
+// the public keys read from publicKeys (armored or binary keyring).
+func NewPGPEncryptor(publicKeys io.Reader) (*PGPEncryptor, error) {
+	keyring, err := util.ReadPGPKeyRing(publicKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &PGPEncryptor{recipients: keyring}, nil
+}
+
+// ProcessData encrypts the data and sends any available ciphertext to outputChan
+func (e *PGPEncryptor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if e.writer == nil {
+		w, err := util.NewPGPEncryptWriter(&e.buf, e.recipients, e.Armor)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		e.writer = w
+	}
+	_, err := e.writer.Write(d)
+	util.KillPipelineIfErr(err, killChan)
+	e.flush(outputChan)
+}
+
+// Finish closes the encrypted message and sends the remaining ciphertext to outputChan
+func (e *PGPEncryptor) Finish(outputChan chan data.JSON, killChan chan error) {
+	if e.writer == nil {
+		return
+	}
+	err := e.writer.Close()
+	util.KillPipelineIfErr(err, killChan)
+	e.flush(outputChan)
+}
+
+func (e *PGPEncryptor) flush(outputChan chan data.JSON) {
+	if e.buf.Len() == 0 {
+		return
+	}
+	d := make(data.JSON, e.buf.Len())
+	copy(d, e.buf.Bytes())
+	e.buf.Reset()
+	outputChan <- d
+}
+
+func (e *PGPEncryptor) String() string {
+	return "PGPEncryptor"
+}
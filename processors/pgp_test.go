@@ -0,0 +1,156 @@
+package processors_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// pgpKeys returns the public and private keyrings of a new key, with the
+// private key protected by passphrase if it's set.
+func pgpKeys(t *testing.T, passphrase []byte) (public, private []byte) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("ratchet", "test", "ratchet@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pub, priv bytes.Buffer
+	if err := entity.Serialize(&pub); err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(&priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	if passphrase != nil {
+		priv.Reset()
+		if err := entity.EncryptPrivateKeys(passphrase, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := entity.SerializePrivateWithoutSigning(&priv, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pub.Bytes(), priv.Bytes()
+}
+
+// encrypt sends payloads through a new PGPEncryptor, and returns the
+// message it produces.
+func encrypt(t *testing.T, public []byte, armor bool, payloads ...string) data.JSON {
+	t.Helper()
+	e, err := processors.NewPGPEncryptor(bytes.NewReader(public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Armor = armor
+	outputChan := make(chan data.JSON, 100)
+	killChan := make(chan error, 10)
+	for _, p := range payloads {
+		e.ProcessData(data.JSON(p), outputChan, killChan)
+	}
+	e.Finish(outputChan, killChan)
+	close(outputChan)
+	if err := firstErr(killChan); err != nil {
+		t.Fatal(err)
+	}
+	var message data.JSON
+	for d := range outputChan {
+		message = append(message, d...)
+	}
+	return message
+}
+
+// decrypt sends message through d, and returns what it sends on and the
+// error it sends on its killChan.
+func decrypt(d *processors.PGPDecryptor, message data.JSON) ([]string, error) {
+	outputChan := make(chan data.JSON, 1)
+	killChan := make(chan error, 2)
+	d.ProcessData(message, outputChan, killChan)
+	close(outputChan)
+	var out []string
+	for dd := range outputChan {
+		out = append(out, string(dd))
+	}
+	return out, firstErr(killChan)
+}
+
+func TestPGPRoundTrip(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	tests := []struct {
+		name       string
+		armor      bool
+		passphrase []byte
+	}{
+		{"binary", false, nil},
+		{"armored", true, nil},
+		{"passphrase", false, []byte("secret")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			public, private := pgpKeys(t, test.passphrase)
+			message := encrypt(t, public, test.armor, `{"id":1}`, "\n", `{"id":2}`)
+			if bytes.Contains(message, []byte(`"id"`)) {
+				t.Fatal("the message isn't encrypted")
+			}
+			if armored := bytes.HasPrefix(message, []byte("-----BEGIN PGP MESSAGE-----")); armored != test.armor {
+				t.Errorf("got armored = %v, want %v", armored, test.armor)
+			}
+
+			d, err := processors.NewPGPDecryptor(bytes.NewReader(private))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Passphrase = test.passphrase
+			out, err := decrypt(d, message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "{\"id\":1}\n{\"id\":2}"; len(out) != 1 || out[0] != want {
+				t.Errorf("got %q, want %q", out, want)
+			}
+		})
+	}
+
+	// A protected key can't be used without its passphrase.
+	public, private := pgpKeys(t, []byte("secret"))
+	d, err := processors.NewPGPDecryptor(bytes.NewReader(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := decrypt(d, encrypt(t, public, false, "hello")); err == nil || len(out) > 0 {
+		t.Errorf("got %q and error %v without the passphrase, want only an error", out, err)
+	}
+}
+
+func TestPGPDecryptorTampered(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	public, private := pgpKeys(t, nil)
+	d, err := processors.NewPGPDecryptor(bytes.NewReader(private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := bytes.Repeat([]byte("0123456789"), 100)
+	message := encrypt(t, public, false, string(plaintext))
+	for _, at := range []int{len(message) / 2, len(message) - 30, len(message) - 1} {
+		tampered := append(data.JSON{}, message...)
+		tampered[at] ^= 0x01
+		out, err := decrypt(d, tampered)
+		if len(out) > 0 {
+			t.Errorf("byte %d of %d changed: the plaintext was sent on", at, len(message))
+		}
+		if util.ErrorCategoryOf(err) != util.CategoryDataInvalid {
+			t.Errorf("byte %d of %d changed: got error %v, want invalid data", at, len(message), err)
+		}
+	}
+	// Truncated, e.g. by an interrupted upload.
+	if out, err := decrypt(d, message[:len(message)-10]); err == nil || len(out) > 0 {
+		t.Errorf("got %d payloads and error %v for a truncated message, want only an error", len(out), err)
+	}
+}
@@ -0,0 +1,499 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// PostgreSQLReplicationReader consumes a PostgreSQL logical replication
+// slot and sends the row changes it reads as ChangeEvents, for change data
+// capture pipelines. It uses pglogrepl (https://github.com/jackc/pglogrepl),
+// with either the built-in pgoutput plugin (reading the tables in
+// Publication) or wal2json. The server needs wal_level=logical, and the
+// user the REPLICATION attribute.
+//
+// The changes in each transaction are sent when it commits, in arrays of
+// up to BatchSize. The Position of each event is its LSN. With CreateSlot,
+// Slot is created if it doesn't exist yet.
+//
+// If Checkpoints is set, the LSN at the end of the last transaction read
+// is saved when the Pipeline succeeds (see ratchet.CommittingDataProcessor),
+// reading resumes from it, and it's confirmed to the server (so the slot
+// can release older WAL) on the next run. Otherwise the slot's own
+// position is used, and each transaction is confirmed once its events
+// have been sent on. With StopAtCurrent, the reader stops once it has
+// read up to the server's WAL position when it started, so it can be run
+// on a schedule (see ratchet.Schedule); otherwise it runs until the
+// Pipeline is cancelled.
+type PostgreSQLReplicationReader struct {
+	DSN            string // Connection string, see pgconn.ParseConfig
+	Slot           string
+	Plugin         string // "pgoutput" (the default) or "wal2json"
+	Publication    string // Required for pgoutput
+	CreateSlot     bool
+	BatchSize      int // Defaults to 1000
+	StopAtCurrent  bool
+	Checkpoints    ratchet.CheckpointStore
+	CheckpointKey  string        // Defaults to "postgresql_replication:" + Slot
+	StatusInterval time.Duration // How often to report to the server, defaults to 10s
+
+	lsn       pglogrepl.LSN // The end of the last transaction read
+	relations map[uint32]*pglogrepl.RelationMessage
+	typeMap   *pgtype.Map
+}
+
+// NewPostgreSQLReplicationReader returns a new PostgreSQLReplicationReader
+// reading the slot with pgoutput, for the tables in publication.
+func NewPostgreSQLReplicationReader(dsn, slot, publication string) *PostgreSQLReplicationReader {
+	return &PostgreSQLReplicationReader{DSN: dsn, Slot: slot, Publication: publication, BatchSize: 1000}
+}
+
+// ProcessData - see interface for documentation.
+func (r *PostgreSQLReplicationReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx reads the slot until the Pipeline is cancelled, or it has
+// caught up with StopAtCurrent. See ratchet.ContextDataProcessor.
+func (r *PostgreSQLReplicationReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	err := r.read(ctx, outputChan)
+	if ctx.Err() != nil {
+		// The Pipeline reports the cancellation.
+		return
+	}
+	util.KillPipelineIfErr(err, killChan)
+}
+
+func (r *PostgreSQLReplicationReader) plugin() string {
+	if r.Plugin == "" {
+		return "pgoutput"
+	}
+	return r.Plugin
+}
+
+func (r *PostgreSQLReplicationReader) checkpointKey() string {
+	if r.CheckpointKey != "" {
+		return r.CheckpointKey
+	}
+	return "postgresql_replication:" + r.Slot
+}
+
+func (r *PostgreSQLReplicationReader) connect(ctx context.Context) (*pgconn.PgConn, error) {
+	cfg, err := pgconn.ParseConfig(r.DSN)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	cfg.RuntimeParams["replication"] = "database"
+	return pgconn.ConnectConfig(ctx, cfg)
+}
+
+func (r *PostgreSQLReplicationReader) pluginArgs() ([]string, error) {
+	switch r.plugin() {
+	case "pgoutput":
+		if r.Publication == "" {
+			return nil, util.ConfigErrorf("PostgreSQLReplicationReader: Publication is required for pgoutput")
+		}
+		return []string{"proto_version '1'", fmt.Sprintf("publication_names '%s'", r.Publication)}, nil
+	case "wal2json":
+		return []string{`"format-version" '2'`, `"include-timestamp" '1'`}, nil
+	}
+	return nil, util.ConfigErrorf("PostgreSQLReplicationReader: unknown plugin %q", r.Plugin)
+}
+
+func (r *PostgreSQLReplicationReader) read(ctx context.Context, outputChan chan data.JSON) error {
+	args, err := r.pluginArgs()
+	if err != nil {
+		return err
+	}
+	conn, err := r.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	system, err := pglogrepl.IdentifySystem(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if r.CreateSlot {
+		_, err := pglogrepl.CreateReplicationSlot(ctx, conn, r.Slot, r.plugin(), pglogrepl.CreateReplicationSlotOptions{Mode: pglogrepl.LogicalReplication})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42710" {
+			// The slot already exists.
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Without a saved LSN, start from the slot's confirmed position.
+	var start pglogrepl.LSN
+	if r.Checkpoints != nil {
+		var saved string
+		ok, err := r.Checkpoints.Load(r.checkpointKey(), &saved)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if start, err = pglogrepl.ParseLSN(saved); err != nil {
+				return util.ConfigInvalidError(err)
+			}
+		}
+	}
+	if err := pglogrepl.StartReplication(ctx, conn, r.Slot, start, pglogrepl.StartReplicationOptions{Mode: pglogrepl.LogicalReplication, PluginArgs: args}); err != nil {
+		return err
+	}
+	logger.Info("PostgreSQLReplicationReader: reading slot", r.Slot, "from", start)
+
+	s := &replicationStream{reader: r, ctx: ctx, conn: conn, outputChan: outputChan, confirmed: start}
+	if r.StopAtCurrent {
+		s.stopAt = system.XLogPos
+	}
+	r.relations = make(map[uint32]*pglogrepl.RelationMessage)
+	r.typeMap = pgtype.NewMap()
+	return s.run()
+}
+
+// Commit saves the LSN at the end of the last transaction read. See
+// ratchet.CommittingDataProcessor.
+func (r *PostgreSQLReplicationReader) Commit() error {
+	if r.Checkpoints == nil || r.lsn == 0 {
+		return nil
+	}
+	logger.Info("PostgreSQLReplicationReader: saving LSN", r.lsn)
+	return r.Checkpoints.Save(r.checkpointKey(), r.lsn.String())
+}
+
+// Finish - see interface for documentation.
+func (r *PostgreSQLReplicationReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *PostgreSQLReplicationReader) String() string {
+	return fmt.Sprintf("PostgreSQLReplicationReader(%v)", r.Slot)
+}
+
+// replicationStream holds the state of a single read of a slot.
+type replicationStream struct {
+	reader     *PostgreSQLReplicationReader
+	ctx        context.Context
+	conn       *pgconn.PgConn
+	outputChan chan data.JSON
+	received   pglogrepl.LSN // The end of the WAL received
+	confirmed  pglogrepl.LSN // Reported to the server as flushed
+	stopAt     pglogrepl.LSN
+	inTx       bool
+	txTime     time.Time
+	batch      []ChangeEvent
+}
+
+func (s *replicationStream) run() error {
+	interval := s.reader.StatusInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	// Ask for a keepalive straight away, so StopAtCurrent can stop
+	// without waiting if there's nothing to read.
+	if err := s.sendStatus(s.stopAt != 0); err != nil {
+		return err
+	}
+	nextStatus := time.Now().Add(interval)
+	for {
+		if time.Now().After(nextStatus) {
+			if err := s.sendStatus(s.stopAt != 0); err != nil {
+				return err
+			}
+			nextStatus = time.Now().Add(interval)
+		}
+
+		ctx, cancel := context.WithDeadline(s.ctx, nextStatus)
+		msg, err := s.conn.ReceiveMessage(ctx)
+		cancel()
+		if err != nil {
+			if pgconn.Timeout(err) && s.ctx.Err() == nil {
+				continue
+			}
+			return err
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.CopyData:
+			done, err := s.handleCopyData(msg.Data)
+			if err != nil || done {
+				if err == nil {
+					err = s.sendStatus(false)
+				}
+				return err
+			}
+		}
+	}
+}
+
+// handleCopyData handles a replication protocol message, and returns true
+// when StopAtCurrent has caught up.
+func (s *replicationStream) handleCopyData(b []byte) (bool, error) {
+	if len(b) == 0 {
+		return false, nil
+	}
+	switch b[0] {
+	case pglogrepl.PrimaryKeepaliveMessageByteID:
+		keepalive, err := pglogrepl.ParsePrimaryKeepaliveMessage(b[1:])
+		if err != nil {
+			return false, err
+		}
+		if keepalive.ServerWALEnd > s.received {
+			s.received = keepalive.ServerWALEnd
+		}
+		if keepalive.ReplyRequested {
+			if err := s.sendStatus(false); err != nil {
+				return false, err
+			}
+		}
+		// Keepalives report how far the server has decoded, so any
+		// transactions before that have been sent.
+		return s.caughtUp(), nil
+	case pglogrepl.XLogDataByteID:
+		xld, err := pglogrepl.ParseXLogData(b[1:])
+		if err != nil {
+			return false, err
+		}
+		if end := xld.WALStart + pglogrepl.LSN(len(xld.WALData)); end > s.received {
+			s.received = end
+		}
+		var commitLSN pglogrepl.LSN
+		if s.reader.plugin() == "wal2json" {
+			commitLSN, err = s.handleWal2JSON(xld)
+		} else {
+			commitLSN, err = s.handlePgoutput(xld)
+		}
+		if err != nil || commitLSN == 0 {
+			return false, err
+		}
+		if err := s.commit(commitLSN); err != nil {
+			return false, err
+		}
+		return s.caughtUp(), nil
+	}
+	return false, nil
+}
+
+func (s *replicationStream) caughtUp() bool {
+	return s.stopAt != 0 && !s.inTx && s.received >= s.stopAt
+}
+
+// commit sends the transaction's events on, and records its end LSN.
+func (s *replicationStream) commit(lsn pglogrepl.LSN) error {
+	s.inTx = false
+	if err := s.flush(); err != nil {
+		return err
+	}
+	s.reader.lsn = lsn
+	if s.reader.Checkpoints == nil {
+		// Without Checkpoints the slot tracks the position.
+		s.confirmed = lsn
+	}
+	return nil
+}
+
+func (s *replicationStream) flush() error {
+	batch := s.batch
+	s.batch = nil
+	for len(batch) > 0 {
+		n := len(batch)
+		if size := s.reader.BatchSize; size > 0 && n > size {
+			n = size
+		}
+		d, err := data.NewJSON(batch[:n])
+		if err != nil {
+			return err
+		}
+		select {
+		case s.outputChan <- d:
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+		batch = batch[n:]
+	}
+	return nil
+}
+
+func (s *replicationStream) sendStatus(replyRequested bool) error {
+	return pglogrepl.SendStandbyStatusUpdate(s.ctx, s.conn, pglogrepl.StandbyStatusUpdate{
+		WALWritePosition: s.received,
+		WALFlushPosition: s.confirmed,
+		WALApplyPosition: s.confirmed,
+		ReplyRequested:   replyRequested,
+	})
+}
+
+// handlePgoutput handles a pgoutput message, returning the transaction's
+// end LSN if it's a commit.
+func (s *replicationStream) handlePgoutput(xld pglogrepl.XLogData) (pglogrepl.LSN, error) {
+	msg, err := pglogrepl.Parse(xld.WALData)
+	if err != nil {
+		return 0, err
+	}
+	r := s.reader
+	event := func(op string, relationID uint32) (ChangeEvent, *pglogrepl.RelationMessage, error) {
+		rel, ok := r.relations[relationID]
+		if !ok {
+			return ChangeEvent{}, nil, fmt.Errorf("PostgreSQLReplicationReader: unknown relation %d", relationID)
+		}
+		return ChangeEvent{
+			Op:        op,
+			Schema:    rel.Namespace,
+			Table:     rel.RelationName,
+			Timestamp: s.txTime.Unix(),
+			Position:  xld.WALStart.String(),
+		}, rel, nil
+	}
+
+	switch msg := msg.(type) {
+	case *pglogrepl.RelationMessage:
+		r.relations[msg.RelationID] = msg
+	case *pglogrepl.BeginMessage:
+		s.inTx = true
+		s.txTime = msg.CommitTime
+	case *pglogrepl.CommitMessage:
+		return msg.TransactionEndLSN, nil
+	case *pglogrepl.InsertMessage:
+		e, rel, err := event("insert", msg.RelationID)
+		if err != nil {
+			return 0, err
+		}
+		e.After = r.tuple(rel, msg.Tuple)
+		s.batch = append(s.batch, e)
+	case *pglogrepl.UpdateMessage:
+		e, rel, err := event("update", msg.RelationID)
+		if err != nil {
+			return 0, err
+		}
+		e.Before = r.tuple(rel, msg.OldTuple)
+		e.After = r.tuple(rel, msg.NewTuple)
+		s.batch = append(s.batch, e)
+	case *pglogrepl.DeleteMessage:
+		e, rel, err := event("delete", msg.RelationID)
+		if err != nil {
+			return 0, err
+		}
+		e.Before = r.tuple(rel, msg.OldTuple)
+		s.batch = append(s.batch, e)
+	case *pglogrepl.TruncateMessage:
+		for _, id := range msg.RelationIDs {
+			e, _, err := event("truncate", id)
+			if err != nil {
+				return 0, err
+			}
+			s.batch = append(s.batch, e)
+		}
+	}
+	return 0, nil
+}
+
+// tuple decodes the columns of a pgoutput tuple, which are sent as text.
+// Unchanged TOASTed values aren't sent, so they're left out.
+func (r *PostgreSQLReplicationReader) tuple(rel *pglogrepl.RelationMessage, t *pglogrepl.TupleData) map[string]interface{} {
+	if t == nil {
+		return nil
+	}
+	row := make(map[string]interface{}, len(t.Columns))
+	for i, col := range t.Columns {
+		if i >= len(rel.Columns) {
+			break
+		}
+		name := rel.Columns[i].Name
+		switch col.DataType {
+		case 'n':
+			row[name] = nil
+		case 't':
+			row[name] = r.decodeText(rel.Columns[i].DataType, col.Data)
+		}
+	}
+	return row
+}
+
+func (r *PostgreSQLReplicationReader) decodeText(oid uint32, b []byte) interface{} {
+	if dt, ok := r.typeMap.TypeForOID(oid); ok {
+		if v, err := dt.Codec.DecodeValue(r.typeMap, oid, pgtype.TextFormatCode, b); err == nil {
+			return v
+		}
+	}
+	return string(b)
+}
+
+// wal2jsonMessage is a format-version 2 wal2json message.
+type wal2jsonMessage struct {
+	Action    string           `json:"action"`
+	Timestamp string           `json:"timestamp"`
+	Schema    string           `json:"schema"`
+	Table     string           `json:"table"`
+	Columns   []wal2jsonColumn `json:"columns"`
+	Identity  []wal2jsonColumn `json:"identity"`
+}
+
+type wal2jsonColumn struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func wal2jsonRow(columns []wal2jsonColumn) map[string]interface{} {
+	if columns == nil {
+		return nil
+	}
+	row := make(map[string]interface{}, len(columns))
+	for _, c := range columns {
+		row[c.Name] = c.Value
+	}
+	return row
+}
+
+// handleWal2JSON handles a wal2json message, returning the transaction's
+// end LSN if it's a commit.
+func (s *replicationStream) handleWal2JSON(xld pglogrepl.XLogData) (pglogrepl.LSN, error) {
+	var msg wal2jsonMessage
+	if err := json.Unmarshal(xld.WALData, &msg); err != nil {
+		return 0, util.DataInvalidError(err)
+	}
+	e := ChangeEvent{
+		Schema:    msg.Schema,
+		Table:     msg.Table,
+		Timestamp: s.txTime.Unix(),
+		Position:  xld.WALStart.String(),
+	}
+	switch msg.Action {
+	case "B":
+		s.inTx = true
+		if t, err := time.Parse("2006-01-02 15:04:05.999999-07", msg.Timestamp); err == nil {
+			s.txTime = t
+		}
+		return 0, nil
+	case "C":
+		return xld.WALStart + pglogrepl.LSN(len(xld.WALData)), nil
+	case "I":
+		e.Op, e.After = "insert", wal2jsonRow(msg.Columns)
+	case "U":
+		e.Op, e.Before, e.After = "update", wal2jsonRow(msg.Identity), wal2jsonRow(msg.Columns)
+	case "D":
+		e.Op, e.Before = "delete", wal2jsonRow(msg.Identity)
+	case "T":
+		e.Op = "truncate"
+	default:
+		return 0, nil
+	}
+	s.batch = append(s.batch, e)
+	return 0, nil
+}
@@ -1,8 +1,12 @@
 package processors
 
 import (
+	"context"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 
+	"github.com/fefelovgroup/ratchet"
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
 	"github.com/fefelovgroup/ratchet/util"
@@ -22,6 +26,16 @@ import (
 // Note that if `OnDupKeyUpdate` is true (the default), you *must*
 // provide a value for `OnDupKeyIndex` (which is the PostgreSQL
 // conflict target).
+//
+// Set IDField to the table's generated key column (e.g. a serial id) to
+// send the records written on with the IDs generated for them, so a later
+// stage can load child rows referring to them. See util.InsertReturningIDs.
+//
+// Set LoadStrategy to replace the tables' rows rather than add to them:
+// util.SQLLoadTruncate empties each table before writing to it, while
+// util.SQLLoadSwap writes to a staging table and swaps its rows into the
+// table when the PostgreSQLWriter is finished, so consumers never see a partially
+// loaded table.
 type PostgreSQLWriter struct {
 	writeDB          *sqlx.DB
 	TableName        string
@@ -30,6 +44,23 @@ type PostgreSQLWriter struct {
 	OnDupKeyFields   []string
 	ConcurrencyLevel int // See ConcurrentDataProcessor
 	BatchSize        int
+	// BatchConcurrencyLevel sets how many batches (of BatchSize objects) from
+	// a single data payload are written in parallel. See util.ForEachBatch.
+	BatchConcurrencyLevel int
+	// Timeout limits each INSERT, so a hung database fails the Pipeline
+	// instead of blocking it. See util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries each batch that fails with a retryable error, such
+	// as a lost connection or a deadlock. See util.SQLRetry.
+	Retry util.SQLRetry
+	// IDField is set in each record to the ID generated for its row, and
+	// the records are sent on. See util.InsertReturningIDs.
+	IDField string
+	// LoadStrategy decides what happens to the rows already in the
+	// tables written to: util.SQLLoadAppend (the default),
+	// util.SQLLoadTruncate or util.SQLLoadSwap. See util.PrepareSQLLoad.
+	LoadStrategy string
+	load         sqlLoad
 }
 
 // NewPostgreSQLWriter returns a new PostgreSQLWriter
@@ -39,6 +70,12 @@ func NewPostgreSQLWriter(db *sqlx.DB, tableName string) *PostgreSQLWriter {
 
 // ProcessData defers to util.PostgreSQLInsertData
 func (s *PostgreSQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the INSERTs are cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (s *PostgreSQLWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	// handle panics a bit more gracefully
 	defer func() {
 		if err := recover(); err != nil {
@@ -46,26 +83,46 @@ func (s *PostgreSQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, k
 		}
 	}()
 
-	// First check for SQLWriterData
-	var wd SQLWriterData
-	err := data.ParseJSONSilent(d, &wd)
 	logger.Info("PostgreSQLWriter: Writing data...")
-	if err == nil && wd.TableName != "" && wd.InsertData != nil {
-		logger.Debug("PostgreSQLWriter: SQLWriterData scenario")
-		dd, err := data.NewJSON(wd.InsertData)
-		util.KillPipelineIfErr(err, killChan)
-		err = util.PostgreSQLInsertData(s.writeDB, dd, wd.TableName, s.OnDupKeyUpdate, s.OnDupKeyIndex, s.OnDupKeyFields, s.BatchSize)
-		util.KillPipelineIfErr(err, killChan)
-	} else {
-		logger.Debug("PostgreSQLWriter: normal data scenario")
-		err = util.PostgreSQLInsertData(s.writeDB, d, s.TableName, s.OnDupKeyUpdate, s.OnDupKeyIndex, s.OnDupKeyFields, s.BatchSize)
-		util.KillPipelineIfErr(err, killChan)
-	}
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	util.KillPipelineIfErr(err, killChan)
+	err = s.insert(ctx, d, tableName, outputChan)
+	util.KillPipelineIfErr(err, killChan)
 	logger.Info("PostgreSQLWriter: Write complete")
 }
 
-// Finish - see interface for documentation.
+func (s *PostgreSQLWriter) insert(ctx context.Context, d data.JSON, tableName string, outputChan chan data.JSON) error {
+	exec := util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry}
+	tableName, err := s.load.table(ctx, s.writeDB, s.LoadStrategy, tableName, exec)
+	if err != nil {
+		return err
+	}
+	if s.IDField != "" {
+		return writeWithIDs(d, outputChan, func(objects []map[string]interface{}) error {
+			return util.InsertReturningIDs(ctx, s.writeDB, util.PostgreSQL, objects, tableName, s.OnDupKeyUpdate, []string{s.OnDupKeyIndex}, s.OnDupKeyFields, s.IDField, s.BatchSize, s.BatchConcurrencyLevel, exec)
+		})
+	}
+	return util.PostgreSQLInsertDataContext(ctx, s.writeDB, d, tableName, s.OnDupKeyUpdate, s.OnDupKeyIndex, s.OnDupKeyFields, s.BatchSize, s.BatchConcurrencyLevel, exec)
+}
+
+// DryRun returns the INSERT statements ProcessData would execute.
+// See ratchet.DryRunner.
+func (s *PostgreSQLWriter) DryRun(d data.JSON) ([]ratchet.DryRunWrite, error) {
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := util.PostgreSQLInsertSQL(d, tableName, s.OnDupKeyUpdate, s.OnDupKeyIndex, s.OnDupKeyFields, s.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	return []ratchet.DryRunWrite{{Target: tableName, Statements: statements}}, nil
+}
+
+// Finish completes the load of the tables written to, see LoadStrategy.
 func (s *PostgreSQLWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	err := s.load.finish(s.writeDB, s.LoadStrategy, util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry})
+	util.KillPipelineIfErr(err, killChan)
 }
 
 func (s *PostgreSQLWriter) String() string {
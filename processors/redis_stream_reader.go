@@ -0,0 +1,310 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// RedisStreamEntry is an entry read from a Redis stream, as sent by a
+// RedisStreamReader with Metadata set.
+type RedisStreamEntry struct {
+	Stream string          `json:"stream"`
+	ID     string          `json:"id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// RedisStreamReader reads a Redis stream as a consumer of a consumer
+// group (with XREADGROUP), so the stream's entries are shared out between
+// the readers using the group, wherever they run. Each batch of up to
+// BatchSize entries is sent as an array of their fields, as objects, or
+// with PayloadField, of that field's value, which is sent as JSON if it
+// is, and otherwise as a string. With Metadata, each entry is sent as a
+// RedisStreamEntry instead.
+//
+// Entries are acknowledged (with XACK) only when the Pipeline succeeds
+// (see ratchet.CommittingDataProcessor), once they've been written, so
+// until then they're pending for the consumer. The reader starts by
+// reading its own pending entries, left by a run that failed, and with
+// ClaimMinIdle, it claims the entries pending for other consumers for
+// longer than that (with XAUTOCLAIM, which needs Redis 6.2), when it
+// starts and then whenever the stream has no new entries, so those of a
+// consumer that is gone are read too.
+//
+// With CreateGroup, the group is created if it doesn't exist yet (and the
+// stream too), to read the entries added after StartID: "$" (the default)
+// for only new entries, or "0" for all of them.
+//
+// With StopAtCurrent, the reader stops once the stream has no new
+// entries, so it can be run on a schedule (see ratchet.Schedule);
+// otherwise it runs until the Pipeline is cancelled.
+type RedisStreamReader struct {
+	Stream        string
+	Group         string
+	Consumer      string
+	PayloadField  string
+	BatchSize     int           // Defaults to 100
+	Block         time.Duration // How long to wait for new entries, defaults to 1 second
+	ClaimMinIdle  time.Duration
+	CreateGroup   bool
+	StartID       string
+	Metadata      bool
+	StopAtCurrent bool
+
+	client redis.UniversalClient
+	read   []string // The IDs of the entries sent, acknowledged by Commit
+	mutex  sync.Mutex
+}
+
+// redisAckBatchSize is how many entries are acknowledged by each XACK.
+const redisAckBatchSize = 1000
+
+// NewRedisStreamReader returns a new RedisStreamReader reading stream with
+// client, as consumer of group.
+func NewRedisStreamReader(client redis.UniversalClient, stream, group, consumer string) *RedisStreamReader {
+	return &RedisStreamReader{Stream: stream, Group: group, Consumer: consumer, BatchSize: 100, client: client}
+}
+
+// ProcessData - see interface for documentation.
+func (r *RedisStreamReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx reads the stream until the Pipeline is cancelled, or it
+// has no new entries with StopAtCurrent. See ratchet.ContextDataProcessor.
+func (r *RedisStreamReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	err := r.readStream(ctx, outputChan)
+	if ctx.Err() != nil {
+		// The Pipeline reports the cancellation.
+		return
+	}
+	util.KillPipelineIfErr(err, killChan)
+}
+
+func (r *RedisStreamReader) readStream(ctx context.Context, outputChan chan data.JSON) error {
+	if r.Stream == "" || r.Group == "" || r.Consumer == "" {
+		return util.ConfigErrorf("RedisStreamReader: a stream, group and consumer are required")
+	}
+	r.mutex.Lock()
+	r.read = nil
+	r.mutex.Unlock()
+	if r.CreateGroup {
+		if err := r.createGroup(ctx); err != nil {
+			return err
+		}
+	}
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	block := r.Block
+	if block <= 0 {
+		block = time.Second
+	}
+
+	// The entries pending for this consumer, from a run that failed.
+	for start := "0"; ; {
+		entries, err := r.readGroup(ctx, start, batchSize, -1)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		if err := r.send(ctx, entries, outputChan); err != nil {
+			return err
+		}
+		start = entries[len(entries)-1].ID
+	}
+
+	if err := r.claim(ctx, batchSize, outputChan); err != nil {
+		return err
+	}
+	for {
+		entries, err := r.readGroup(ctx, ">", batchSize, block)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			if err := r.send(ctx, entries, outputChan); err != nil {
+				return err
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := r.claim(ctx, batchSize, outputChan); err != nil {
+			return err
+		}
+		if r.StopAtCurrent {
+			logger.Info("RedisStreamReader: no new entries in", r.Stream, "stopping")
+			return nil
+		}
+	}
+}
+
+func (r *RedisStreamReader) createGroup(ctx context.Context) error {
+	start := r.StartID
+	if start == "" {
+		start = "$"
+	}
+	err := r.client.XGroupCreateMkStream(ctx, r.Stream, r.Group, start).Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// readGroup reads the entries after start (">" for new entries), waiting
+// up to block for them if it isn't negative.
+func (r *RedisStreamReader) readGroup(ctx context.Context, start string, count int, block time.Duration) ([]redis.XMessage, error) {
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    r.Group,
+		Consumer: r.Consumer,
+		Streams:  []string{r.Stream, start},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if err == redis.Nil || (err != nil && ctx.Err() != nil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []redis.XMessage
+	for _, s := range streams {
+		entries = append(entries, s.Messages...)
+	}
+	return entries, nil
+}
+
+// claim claims and sends the entries pending for other consumers for
+// longer than ClaimMinIdle.
+func (r *RedisStreamReader) claim(ctx context.Context, count int, outputChan chan data.JSON) error {
+	if r.ClaimMinIdle <= 0 {
+		return nil
+	}
+	for start := "0-0"; ; {
+		entries, next, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   r.Stream,
+			Group:    r.Group,
+			Consumer: r.Consumer,
+			MinIdle:  r.ClaimMinIdle,
+			Start:    start,
+			Count:    int64(count),
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			logger.Info("RedisStreamReader: claimed", len(entries), "pending entries of", r.Stream)
+			if err := r.send(ctx, entries, outputChan); err != nil {
+				return err
+			}
+		}
+		if next == "0-0" || next == "" {
+			return nil
+		}
+		start = next
+	}
+}
+
+// send sends entries on, and adds them to those to acknowledge. Entries
+// that have been deleted while pending (with no fields) are only
+// acknowledged.
+func (r *RedisStreamReader) send(ctx context.Context, entries []redis.XMessage, outputChan chan data.JSON) error {
+	ids := make([]string, 0, len(entries))
+	values := make([]json.RawMessage, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+		if e.Values == nil {
+			continue
+		}
+		v, err := r.entryJSON(e)
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+	if len(values) > 0 {
+		d, err := data.NewJSON(values)
+		if err != nil {
+			return err
+		}
+		select {
+		case outputChan <- d:
+		case <-ctx.Done():
+			return nil
+		}
+		logger.Debug("RedisStreamReader:", len(values), "entries sent")
+	}
+	r.mutex.Lock()
+	r.read = append(r.read, ids...)
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *RedisStreamReader) entryJSON(e redis.XMessage) (json.RawMessage, error) {
+	var v json.RawMessage
+	if r.PayloadField != "" {
+		payload, ok := e.Values[r.PayloadField]
+		if !ok {
+			return nil, util.DataErrorf("RedisStreamReader: entry %v of %v has no %v field", e.ID, r.Stream, r.PayloadField)
+		}
+		s := fmt.Sprint(payload)
+		if json.Valid([]byte(s)) {
+			v = json.RawMessage(s)
+		} else {
+			b, err := json.Marshal(s)
+			if err != nil {
+				return nil, err
+			}
+			v = b
+		}
+	} else {
+		b, err := json.Marshal(e.Values)
+		if err != nil {
+			return nil, err
+		}
+		v = b
+	}
+	if !r.Metadata {
+		return v, nil
+	}
+	return json.Marshal(RedisStreamEntry{Stream: r.Stream, ID: e.ID, Data: v})
+}
+
+// Commit acknowledges the entries that have been sent. See
+// ratchet.CommittingDataProcessor.
+func (r *RedisStreamReader) Commit() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for len(r.read) > 0 {
+		n := len(r.read)
+		if n > redisAckBatchSize {
+			n = redisAckBatchSize
+		}
+		if err := r.client.XAck(context.Background(), r.Stream, r.Group, r.read[:n]...).Err(); err != nil {
+			return err
+		}
+		r.read = r.read[n:]
+	}
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (r *RedisStreamReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *RedisStreamReader) String() string {
+	return fmt.Sprintf("RedisStreamReader(%v)", r.Stream)
+}
@@ -1,8 +1,10 @@
 package processors
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -45,6 +47,10 @@ type RedshiftWriter struct {
 	// Files uploaded to S3 will be zero-padded to this width.
 	// Defaults to 10.
 	FileNameWidth int
+
+	// Timeout limits the COPY, so a hung database fails the Pipeline
+	// instead of blocking it. See util.WithQueryTimeout.
+	Timeout time.Duration
 }
 
 // NewRedshiftProcessor returns a reference to a new Redshift Processor
@@ -72,7 +78,7 @@ func NewRedshiftWriter(db *sqlx.DB, tableName, awsID, awsSecret, awsRegion, buck
 // by r.BatchSize), it will write a file out to S3 and reset the local var
 func (r *RedshiftWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	objects, err := data.ObjectsFromJSON(d)
-	util.KillPipelineIfErr(err, killChan)
+	util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
 
 	for _, obj := range objects {
 		dd, err := data.NewJSON(obj)
@@ -126,7 +132,9 @@ func (r *RedshiftWriter) createManifest(killChan chan error) {
 }
 
 func (r *RedshiftWriter) copyToRedshift(killChan chan error) {
-	err := util.ExecuteSQLQuery(r.db, r.copyQuery())
+	err := util.WithQueryTimeout(context.Background(), r.Timeout, func(ctx context.Context) error {
+		return util.ExecuteSQLQueryContext(ctx, r.db, r.copyQuery())
+	})
 	util.KillPipelineIfErr(err, killChan)
 }
 
@@ -26,7 +26,7 @@ func NewRegexpMatcher(pattern string) *RegexpMatcher {
 // ProcessData sends the data it receives to the outputChan only if it matches the supplied regex
 func (r *RegexpMatcher) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	matches, err := regexp.Match(r.pattern, d)
-	util.KillPipelineIfErr(err, killChan)
+	util.KillPipelineIfErr(util.ConfigInvalidError(err), killChan)
 	if r.DebugLog {
 		logger.Debug("RegexpMatcher: checking if", string(d), "matches pattern", r.pattern, ". MATCH=", matches)
 	}
@@ -0,0 +1,156 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// RetryPolicy configures how a Retrier retries failed ProcessData calls.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Each following
+	// delay is multiplied by Multiplier, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes each delay by up to +/- this fraction of it
+	// (e.g. 0.2 for 20%), so that many workers don't retry in lockstep.
+	Jitter float64
+	// Retryable decides if an error is worth retrying. Defaults to
+	// util.IsTransient.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy makes 3 attempts, backing off from 1 second.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+	Retryable:      util.IsTransient,
+}
+
+// Backoff returns the delay before the given retry (starting at 1).
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// Retrier wraps a DataProcessor, retrying ProcessData when it fails with
+// a retryable error. Data sent on the outputChan by a failed attempt is
+// discarded, so the next stage only receives the output of the attempt
+// that succeeded. If all attempts fail, the last error is sent to the
+// killChan.
+//
+// Only ProcessData is retried; Finish is passed straight through.
+type Retrier struct {
+	Processor ratchet.DataProcessor
+	Policy    RetryPolicy
+}
+
+// WithRetry returns a Retrier wrapping p with the given policy. If p is a
+// ratchet.ConcurrentDataProcessor, a ConcurrentRetrier is returned instead,
+// so only processors that can be called concurrently are, even when the
+// concurrency of their stage is overridden.
+func WithRetry(p ratchet.DataProcessor, policy RetryPolicy) ratchet.DataProcessor {
+	r := &Retrier{Processor: p, Policy: policy}
+	if _, ok := p.(ratchet.ConcurrentDataProcessor); ok {
+		return &ConcurrentRetrier{Retrier: r}
+	}
+	return r
+}
+
+// ProcessData calls the wrapped ProcessData, retrying as needed.
+func (r *Retrier) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but passes ctx on to the
+// wrapped processor if it's a ratchet.ContextDataProcessor, and stops
+// retrying once ctx is done. See ratchet.ContextDataProcessor.
+func (r *Retrier) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	retryable := r.Policy.Retryable
+	if retryable == nil {
+		retryable = util.IsTransient
+	}
+
+	for attempt := 1; ; attempt++ {
+		output, err := r.attempt(ctx, d)
+		if err == nil {
+			for _, o := range output {
+				outputChan <- o
+			}
+			return
+		}
+		if attempt >= r.Policy.MaxAttempts || !retryable(err) || ctx.Err() != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		backoff := r.Policy.Backoff(attempt)
+		logger.Info(fmt.Sprintf("Retrier: attempt %d of %d for %v failed, retrying in %v - %v",
+			attempt, r.Policy.MaxAttempts, r.Processor, backoff, err))
+		if err := sleepContext(ctx, backoff); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+}
+
+// attempt runs a single ProcessData call, collecting its output.
+func (r *Retrier) attempt(ctx context.Context, d data.JSON) ([]data.JSON, error) {
+	results := make(chan data.JSON)
+	collected := make(chan []data.JSON)
+	go func() {
+		var output []data.JSON
+		for o := range results {
+			output = append(output, o)
+		}
+		collected <- output
+	}()
+	// Each attempt gets its own copy, in case the processor modifies it.
+	dc := make(data.JSON, len(d))
+	copy(dc, d)
+	err := processDataCtxErr(ctx, r.Processor, dc, results)
+	close(results)
+	return <-collected, err
+}
+
+// Finish - see interface for documentation.
+func (r *Retrier) Finish(outputChan chan data.JSON, killChan chan error) {
+	r.Processor.Finish(outputChan, killChan)
+}
+
+func (r *Retrier) String() string {
+	return fmt.Sprintf("Retrier(%v)", r.Processor)
+}
+
+// ConcurrentRetrier is a Retrier wrapping a ConcurrentDataProcessor, see
+// WithRetry.
+type ConcurrentRetrier struct {
+	*Retrier
+}
+
+// Concurrency defers to the wrapped processor.
+func (r *ConcurrentRetrier) Concurrency() int {
+	return r.Processor.(ratchet.ConcurrentDataProcessor).Concurrency()
+}
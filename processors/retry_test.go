@@ -0,0 +1,82 @@
+package processors_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+// payloads sends n payloads.
+type payloads int
+
+func (n payloads) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	for i := 0; i < int(n); i++ {
+		outputChan <- data.JSON(`{"n":1}`)
+	}
+}
+
+func (n payloads) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// callTracker records the most ProcessData calls it has seen at once.
+type callTracker struct {
+	running, max int
+	mutex        sync.Mutex
+}
+
+func (t *callTracker) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	t.mutex.Lock()
+	t.running++
+	if t.running > t.max {
+		t.max = t.running
+	}
+	t.mutex.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	t.mutex.Lock()
+	t.running--
+	t.mutex.Unlock()
+}
+
+func (t *callTracker) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// concurrentCallTracker is a callTracker that can be called concurrently.
+type concurrentCallTracker struct {
+	callTracker
+}
+
+func (t *concurrentCallTracker) Concurrency() int {
+	return 1
+}
+
+func TestWithRetryConcurrency(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	serial := &callTracker{}
+	concurrent := &concurrentCallTracker{}
+	tests := []struct {
+		name      string
+		processor ratchet.DataProcessor
+		tracker   *callTracker
+		max       int
+	}{
+		{"not concurrent", serial, serial, 1},
+		{"concurrent", concurrent, &concurrent.callTracker, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			retrier := processors.WithRetry(test.processor, processors.DefaultRetryPolicy)
+			p := ratchet.NewPipeline(payloads(20), retrier)
+			p.SetStageConcurrency(2, 4)
+			if err := <-p.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if test.tracker.max != test.max {
+				t.Errorf("got up to %d concurrent calls, want %d", test.tracker.max, test.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Router sends each record it receives to one of several branches in a
+// branching PipelineLayout, e.g. to split "valid" from "invalid" records,
+// or records by region. Each Route has a predicate, and a record goes to
+// the Output of the first Route it matches, or to Default if it matches
+// none (records are dropped if there's no Default).
+//
+// Incoming data can be a single JSON object or an array of objects. The
+// records sent to each branch keep the same shape: arrays are split into
+// one array per branch.
+//
+// The Router's Outputs in the layout must include every branch, which
+// Branches returns:
+//
+//	router := processors.NewRouter().
+//		When("valid", "email =~ '@'", validWriter).
+//		Otherwise("invalid", invalidWriter)
+//	ratchet.Do(router).Outputs(router.Branches()...)
+//
+// Router implements ratchet.RoutingDataProcessor, so each branch only
+// receives its own records. Since every payload ProcessData sends holds
+// records of a single Route, Route only needs to decode the first record
+// of a payload to find it again. Predicates must therefore only depend on
+// the record they're given.
+type Router struct {
+	Routes  []Route
+	Default *Route
+}
+
+// Route is a named branch of a Router.
+type Route struct {
+	Name   string
+	Match  func(record map[string]interface{}) bool
+	Output ratchet.DataProcessor
+}
+
+// NewRouter returns a new Router with no Routes.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// When adds a Route for records matching the condition (see
+// util.Condition). It panics if the condition is invalid, like
+// regexp.MustCompile; use WhenFunc with util.ParseCondition to handle the
+// error instead.
+func (r *Router) When(name, condition string, output ratchet.DataProcessor) *Router {
+	c, err := util.ParseCondition(condition)
+	if err != nil {
+		panic(err)
+	}
+	return r.WhenFunc(name, c.Match, output)
+}
+
+// WhenFunc adds a Route for records matching the given predicate.
+func (r *Router) WhenFunc(name string, match func(record map[string]interface{}) bool, output ratchet.DataProcessor) *Router {
+	r.Routes = append(r.Routes, Route{Name: name, Match: match, Output: output})
+	return r
+}
+
+// WhenFieldEquals adds a Route for records where the field (a dotted path)
+// equals one of the given values, e.g. WhenFieldEquals("eu", "region",
+// euWriter, "DE", "FR").
+func (r *Router) WhenFieldEquals(name, field string, output ratchet.DataProcessor, values ...interface{}) *Router {
+	// Compare the values as JSON, so they match the decoded records
+	// regardless of their Go types.
+	want := make([][]byte, len(values))
+	for i, v := range values {
+		want[i], _ = json.Marshal(v)
+	}
+	return r.WhenFunc(name, func(record map[string]interface{}) bool {
+		v, ok := util.LookupField(record, field)
+		if !ok {
+			return false
+		}
+		got, _ := json.Marshal(v)
+		for _, w := range want {
+			if bytes.Equal(got, w) {
+				return true
+			}
+		}
+		return false
+	}, output)
+}
+
+// Otherwise sets the Default Route for records that don't match any others.
+func (r *Router) Otherwise(name string, output ratchet.DataProcessor) *Router {
+	r.Default = &Route{Name: name, Output: output}
+	return r
+}
+
+// Branches returns the Output of every Route, to be used as the Router's
+// Outputs in a PipelineLayout.
+func (r *Router) Branches() []ratchet.DataProcessor {
+	var branches []ratchet.DataProcessor
+	add := func(p ratchet.DataProcessor) {
+		for _, b := range branches {
+			if b == p {
+				return
+			}
+		}
+		branches = append(branches, p)
+	}
+	for _, route := range r.Routes {
+		add(route.Output)
+	}
+	if r.Default != nil {
+		add(r.Default.Output)
+	}
+	return branches
+}
+
+// route returns the Route for the record, or nil if it should be dropped.
+func (r *Router) route(record map[string]interface{}) *Route {
+	for i := range r.Routes {
+		if r.Routes[i].Match(record) {
+			return &r.Routes[i]
+		}
+	}
+	return r.Default
+}
+
+// ProcessData splits the records by Route, sending the records for each
+// Route as a separate payload.
+func (r *Router) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	isArray := len(bytes.TrimSpace(d)) > 0 && bytes.TrimSpace(d)[0] == '['
+
+	// Group the records by Route, so each branch gets a single
+	// payload per payload received.
+	groups := make(map[*Route][]map[string]interface{})
+	var order []*Route
+	for _, o := range objects {
+		route := r.route(o)
+		if route == nil {
+			logger.Debug("Router: no route for record, dropping it")
+			continue
+		}
+		if _, ok := groups[route]; !ok {
+			order = append(order, route)
+		}
+		groups[route] = append(groups[route], o)
+	}
+
+	for _, route := range order {
+		var v interface{} = groups[route]
+		if !isArray {
+			v = groups[route][0]
+		}
+		dd, err := data.NewJSON(v)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		logger.Debug("Router: sending", len(groups[route]), "record(s) to", route.Name)
+		outputChan <- dd
+	}
+}
+
+// Route returns the Output for the records in d, which were grouped by
+// ProcessData so they all share the same Route: the Route of the first
+// record, which is the only one decoded. See ratchet.RoutingDataProcessor.
+func (r *Router) Route(d data.JSON) []ratchet.DataProcessor {
+	first, err := data.NewDecoder(bytes.NewReader(d)).Next()
+	if err != nil {
+		return nil
+	}
+	if route := r.route(first); route != nil {
+		return []ratchet.DataProcessor{route.Output}
+	}
+	return nil
+}
+
+// Finish - see interface for documentation.
+func (r *Router) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *Router) String() string {
+	return "Router"
+}
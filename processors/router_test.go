@@ -0,0 +1,102 @@
+package processors_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleRouter() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"amount":50}
+{"id":2,"amount":150}
+{"id":3,"amount":-5}
+`))
+	large := ratchet.NewNamedOutput("large", 10)
+	small := ratchet.NewNamedOutput("small", 10)
+	invalid := ratchet.NewNamedOutput("invalid", 10)
+	router := processors.NewRouter().
+		When("invalid", "amount < 0", invalid).
+		When("large", "amount >= 100", large).
+		Otherwise("small", small)
+
+	layout, _ := ratchet.NewPipelineLayout(
+		ratchet.NewPipelineStage(
+			ratchet.Do(reader).Outputs(router),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(router).Outputs(router.Branches()...),
+		),
+		ratchet.NewPipelineStage(
+			ratchet.Do(large),
+			ratchet.Do(small),
+			ratchet.Do(invalid),
+		),
+	)
+	pipeline := ratchet.NewBranchingPipeline(layout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, name := range []string{"large", "small", "invalid"} {
+		for d := range pipeline.Output(name) {
+			fmt.Println(name, string(d))
+		}
+	}
+
+	// Output:
+	// large [{"amount":150,"id":2}]
+	// small [{"amount":50,"id":1}]
+	// invalid [{"amount":-5,"id":3}]
+}
+
+func TestRouterPredicateCalls(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	calls := map[string]int{}
+	counted := func(name string, match func(record map[string]interface{}) bool) func(record map[string]interface{}) bool {
+		return func(record map[string]interface{}) bool {
+			calls[name]++
+			return match(record)
+		}
+	}
+	reader := processors.NewIoReader(strings.NewReader(`[{"amount":-5},{"amount":150},{"amount":50},{"amount":200}]`))
+	large := ratchet.NewNamedOutput("large", 10)
+	small := ratchet.NewNamedOutput("small", 10)
+	invalid := ratchet.NewNamedOutput("invalid", 10)
+	router := processors.NewRouter().
+		WhenFunc("invalid", counted("invalid", func(r map[string]interface{}) bool { return r["amount"].(float64) < 0 }), invalid).
+		WhenFunc("large", counted("large", func(r map[string]interface{}) bool { return r["amount"].(float64) >= 100 }), large).
+		Otherwise("small", small)
+	layout, _ := ratchet.NewPipelineLayout(
+		ratchet.NewPipelineStage(ratchet.Do(reader).Outputs(router)),
+		ratchet.NewPipelineStage(ratchet.Do(router).Outputs(router.Branches()...)),
+		ratchet.NewPipelineStage(ratchet.Do(large), ratchet.Do(small), ratchet.Do(invalid)),
+	)
+	pipeline := ratchet.NewBranchingPipeline(layout)
+	if err := <-pipeline.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every record is checked against "invalid", and the three that
+	// aren't invalid against "large", once each by ProcessData. Route
+	// checks the first record of each of the three payloads sent again.
+	if calls["invalid"] != 4+3 || calls["large"] != 3+2 {
+		t.Errorf("got predicate calls %v, want invalid: 7, large: 5", calls)
+	}
+	for name, want := range map[string]string{
+		"large":   `[{"amount":150},{"amount":200}]`,
+		"small":   `[{"amount":50}]`,
+		"invalid": `[{"amount":-5}]`,
+	} {
+		if got := string(<-pipeline.Output(name)); got != want {
+			t.Errorf("%v got %v, want %v", name, got, want)
+		}
+	}
+}
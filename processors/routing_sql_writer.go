@@ -0,0 +1,189 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// RoutingSQLWriter writes each record to a table chosen from the record
+// itself, so a single stream can be loaded into many tables without
+// wrapping records in SQLWriterData first. The table name is rendered from
+// a text/template, e.g.
+//
+//	processors.NewRoutingSQLWriter(db, processors.NewPostgreSQLWriter(db, ""), "events_{{.event_type}}")
+//
+// or read from TableField (a dotted path), if it's set. Records are grouped
+// by table, and each group is passed on to Writer (a MySQLWriter,
+// PostgreSQLWriter, SQLiteWriter or MSSQLWriter) as SQLWriterData, so all
+// of its options still apply. Table names must be plain identifiers,
+// optionally qualified with a schema, since they come from the data.
+//
+// If CreateTables is set, tables that don't exist are created (with CREATE
+// TABLE IF NOT EXISTS) before they're first written to, with a column for
+// each field of the records being written, and PrimaryKeys as their
+// primary key. Column types are inferred from the values of those first
+// records, see util.CreateTableSQL. Tables are created in the database
+// given to NewRoutingSQLWriter, which should be the one Writer writes to.
+type RoutingSQLWriter struct {
+	Writer        ratchet.DataProcessor
+	TableTemplate *template.Template
+	TableField    string
+	// DropTableField removes TableField from records before they're
+	// written, for when it isn't a column.
+	DropTableField bool
+	CreateTables   bool
+	PrimaryKeys    []string // The primary key of the tables created
+
+	db      *sqlx.DB
+	created map[string]bool
+	mutex   sync.Mutex
+}
+
+// NewRoutingSQLWriter returns a new RoutingSQLWriter writing records to
+// the tables named by rendering tableTemplate, or an error if the template
+// is invalid.
+func NewRoutingSQLWriter(db *sqlx.DB, writer ratchet.DataProcessor, tableTemplate string) (*RoutingSQLWriter, error) {
+	w := &RoutingSQLWriter{Writer: writer, db: db, created: map[string]bool{}}
+	if tableTemplate != "" {
+		t, err := template.New("table").Funcs(sprig.TxtFuncMap()).Parse(tableTemplate)
+		if err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+		w.TableTemplate = t
+	}
+	return w, nil
+}
+
+// ProcessData writes each record to its table.
+func (w *RoutingSQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	w.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the writes are cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (w *RoutingSQLWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+
+	// Group the records by table, keeping the tables in the order they
+	// were first seen.
+	var tables []string
+	groups := map[string][]map[string]interface{}{}
+	for _, o := range objects {
+		table, err := w.tableName(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if _, ok := groups[table]; !ok {
+			tables = append(tables, table)
+		}
+		groups[table] = append(groups[table], o)
+	}
+
+	for _, table := range tables {
+		if w.CreateTables {
+			if err := w.createTable(ctx, table, groups[table]); err != nil {
+				util.KillPipelineIfErr(err, killChan)
+				return
+			}
+		}
+		dd, err := data.NewJSON(SQLWriterData{TableName: table, InsertData: groups[table]})
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		logger.Debug("RoutingSQLWriter: writing", len(groups[table]), "records to", table)
+		if err := processDataCtxErr(ctx, w.Writer, dd, outputChan); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+}
+
+var routingTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// tableName returns the table to write o to.
+func (w *RoutingSQLWriter) tableName(o map[string]interface{}) (string, error) {
+	var table string
+	switch {
+	case w.TableField != "":
+		v, ok := util.LookupField(o, w.TableField)
+		if !ok || v == nil {
+			return "", util.DataErrorf("RoutingSQLWriter: record has no %v field", w.TableField)
+		}
+		table = valueString(v)
+		if w.DropTableField {
+			util.DeleteField(o, w.TableField)
+		}
+	case w.TableTemplate != nil:
+		var buf bytes.Buffer
+		if err := w.TableTemplate.Execute(&buf, o); err != nil {
+			return "", util.DataErrorf("RoutingSQLWriter: %v", err)
+		}
+		table = strings.TrimSpace(buf.String())
+	default:
+		return "", util.ConfigErrorf("RoutingSQLWriter: TableTemplate or TableField is required")
+	}
+	if !routingTableName.MatchString(table) {
+		return "", util.DataErrorf("RoutingSQLWriter: invalid table name %q", table)
+	}
+	return table, nil
+}
+
+// createTable creates table if it hasn't been already, with columns for
+// the fields in objects.
+func (w *RoutingSQLWriter) createTable(ctx context.Context, table string, objects []map[string]interface{}) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.created[table] {
+		return nil
+	}
+	dialect, err := util.DialectFor(w.db.DriverName())
+	if err != nil {
+		return err
+	}
+	createSQL, err := util.CreateTableSQL(objects, table, dialect, w.PrimaryKeys...)
+	if err != nil {
+		return err
+	}
+	logger.Info("RoutingSQLWriter:", createSQL)
+	if _, err := w.db.ExecContext(ctx, createSQL); err != nil {
+		return err
+	}
+	w.created[table] = true
+	return nil
+}
+
+// Finish passes through to Writer.
+func (w *RoutingSQLWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	w.Writer.Finish(outputChan, killChan)
+}
+
+func (w *RoutingSQLWriter) String() string {
+	return fmt.Sprintf("RoutingSQLWriter(%v)", w.Writer)
+}
+
+// Concurrency defers to Writer if it is a ConcurrentDataProcessor.
+func (w *RoutingSQLWriter) Concurrency() int {
+	if c, ok := w.Writer.(ratchet.ConcurrentDataProcessor); ok {
+		return c.Concurrency()
+	}
+	return 0
+}
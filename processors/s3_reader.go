@@ -3,6 +3,12 @@ package processors
 // http://docs.aws.amazon.com/sdk-for-go/api/service/s3/S3.html
 
 import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -17,6 +23,11 @@ import (
 // prefix in your bucket.
 // S3Reader embeds an IoReeader, so it will support the same configuration
 // options as IoReader.
+//
+// When reading a prefix, the objects can be narrowed down with KeySuffix,
+// KeyPattern and ModifiedSince, and DownloadConcurrency objects can be
+// downloaded and read in parallel. Note that with a DownloadConcurrency
+// greater than 1 the data from different objects may be interleaved.
 type S3Reader struct {
 	IoReader            // embeds IoReader
 	bucket              string
@@ -25,6 +36,13 @@ type S3Reader struct {
 	DeleteObjects       bool
 	processedObjectKeys []string
 	client              *s3.S3
+
+	KeySuffix           string    // Only read objects with keys ending in KeySuffix
+	KeyPattern          string    // Only read objects with keys matching this regular expression
+	ModifiedSince       time.Time // Only read objects modified after this watermark
+	DownloadConcurrency int       // Number of objects to read in parallel, defaults to 1
+	watermark           time.Time
+	mutex               sync.Mutex
 }
 
 // NewS3ObjectReader reads a single object from the given S3 bucket
@@ -53,22 +71,34 @@ func NewS3PrefixReader(awsID, awsSecret, awsRegion, bucket, prefix string) *S3Re
 //
 // It optionally deletes all processed objects once the contents have been sent to outputChan
 func (r *S3Reader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but S3 requests are cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (r *S3Reader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	if r.prefix != "" {
 		logger.Debug("S3Reader: process data for prefix", r.prefix)
-		objects, err := util.ListS3Objects(r.client, r.bucket, r.prefix)
-		logger.Debug("S3Reader: list =", objects)
-		util.KillPipelineIfErr(err, killChan)
-		for _, o := range objects {
-			obj, err := util.GetS3Object(r.client, r.bucket, o)
+		objects, err := util.ListS3ObjectDetailsWithContext(ctx, r.client, r.bucket, r.prefix)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		objects, err = r.filterObjects(objects)
+		if err != nil {
 			util.KillPipelineIfErr(err, killChan)
-			r.processObject(obj, outputChan, killChan)
-			r.processedObjectKeys = append(r.processedObjectKeys, o)
+			return
 		}
+		logger.Debug("S3Reader: list =", objects)
+		r.readObjects(ctx, objects, outputChan, killChan)
 	} else {
 		logger.Debug("S3Reader: process data for object", r.object)
-		obj, err := util.GetS3Object(r.client, r.bucket, r.object)
-		util.KillPipelineIfErr(err, killChan)
-		r.processObject(obj, outputChan, killChan)
+		obj, err := util.GetS3ObjectWithContext(ctx, r.client, r.bucket, r.object)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		r.processObject(&r.IoReader, obj, outputChan, killChan)
 		r.processedObjectKeys = append(r.processedObjectKeys, r.object)
 	}
 	if r.DeleteObjects {
@@ -81,10 +111,86 @@ func (r *S3Reader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan
 func (r *S3Reader) Finish(outputChan chan data.JSON, killChan chan error) {
 }
 
-func (r *S3Reader) processObject(obj *s3.GetObjectOutput, outputChan chan data.JSON, killChan chan error) {
+// Watermark returns the latest LastModified time of all objects read from
+// the prefix so far. It can be saved and used as ModifiedSince for the next
+// run to only read new objects.
+func (r *S3Reader) Watermark() time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.watermark
+}
+
+func (r *S3Reader) filterObjects(objects []*s3.Object) ([]*s3.Object, error) {
+	var pattern *regexp.Regexp
+	if r.KeyPattern != "" {
+		var err error
+		pattern, err = regexp.Compile(r.KeyPattern)
+		if err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+	}
+
+	filtered := []*s3.Object{}
+	for _, o := range objects {
+		key := aws.StringValue(o.Key)
+		if r.KeySuffix != "" && !strings.HasSuffix(key, r.KeySuffix) {
+			continue
+		}
+		if pattern != nil && !pattern.MatchString(key) {
+			continue
+		}
+		if !r.ModifiedSince.IsZero() && !aws.TimeValue(o.LastModified).After(r.ModifiedSince) {
+			continue
+		}
+		filtered = append(filtered, o)
+	}
+	return filtered, nil
+}
+
+func (r *S3Reader) readObjects(ctx context.Context, objects []*s3.Object, outputChan chan data.JSON, killChan chan error) {
+	concurrency := r.DownloadConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	throttle := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, o := range objects {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		throttle <- struct{}{}
+		go func(o *s3.Object) {
+			defer wg.Done()
+			defer func() { <-throttle }()
+
+			key := aws.StringValue(o.Key)
+			obj, err := util.GetS3ObjectWithContext(ctx, r.client, r.bucket, key)
+			if err != nil {
+				util.KillPipelineIfErr(err, killChan)
+				return
+			}
+			// Each object gets its own copy of the IoReader settings so
+			// objects can be read concurrently.
+			reader := r.IoReader
+			r.processObject(&reader, obj, outputChan, killChan)
+
+			r.mutex.Lock()
+			r.processedObjectKeys = append(r.processedObjectKeys, key)
+			if modified := aws.TimeValue(o.LastModified); modified.After(r.watermark) {
+				r.watermark = modified
+			}
+			r.mutex.Unlock()
+		}(o)
+	}
+	wg.Wait()
+}
+
+func (r *S3Reader) processObject(reader *IoReader, obj *s3.GetObjectOutput, outputChan chan data.JSON, killChan chan error) {
 	// Use IoReader for actual data handling
-	r.IoReader.Reader = obj.Body
-	r.IoReader.ProcessData(nil, outputChan, killChan)
+	reader.Reader = obj.Body
+	reader.ProcessData(nil, outputChan, killChan)
 	obj.Body.Close()
 }
 
@@ -0,0 +1,138 @@
+package processors
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SamplingMode controls how a Sampler picks records.
+type SamplingMode int
+
+const (
+	// SampleRate passes on each record with probability Rate.
+	SampleRate SamplingMode = iota
+	// SampleReservoir picks N records uniformly at random from all of
+	// the records received, and sends them when the Sampler is finished.
+	SampleReservoir
+	// SampleFirstN passes on the first N records and drops the rest.
+	SampleFirstN
+)
+
+// Sampler passes on a sample of the records it receives, e.g. for fast
+// data quality checks or previews over huge sources. Incoming data can be
+// a single JSON object or an array of objects. With SampleRate and
+// SampleFirstN, the sampled records from each payload are sent on straight
+// away, keeping the payload's shape; with SampleReservoir they are sent as
+// a single array when the Sampler is finished.
+//
+// Set Seed to make the random sampling repeatable.
+type Sampler struct {
+	Mode SamplingMode
+	Rate float64 // For SampleRate, between 0 and 1
+	N    int     // For SampleReservoir and SampleFirstN
+	Seed int64   // Defaults to 0, which seeds from the current time
+
+	rand      *rand.Rand
+	seen      int
+	reservoir []map[string]interface{}
+}
+
+// NewRateSampler returns a new Sampler passing on records with the given
+// probability.
+func NewRateSampler(rate float64) *Sampler {
+	return &Sampler{Mode: SampleRate, Rate: rate}
+}
+
+// NewReservoirSampler returns a new Sampler picking n random records.
+func NewReservoirSampler(n int) *Sampler {
+	return &Sampler{Mode: SampleReservoir, N: n}
+}
+
+// NewFirstNSampler returns a new Sampler passing on the first n records.
+func NewFirstNSampler(n int) *Sampler {
+	return &Sampler{Mode: SampleFirstN, N: n}
+}
+
+func (s *Sampler) random() *rand.Rand {
+	if s.rand == nil {
+		seed := s.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+	return s.rand
+}
+
+// ProcessData samples the records.
+func (s *Sampler) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if s.Mode == SampleFirstN && s.seen >= s.N {
+		// Skip parsing once the sample is complete.
+		return
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+
+	var sampled []map[string]interface{}
+	for _, o := range objects {
+		s.seen++
+		switch s.Mode {
+		case SampleRate:
+			if s.random().Float64() < s.Rate {
+				sampled = append(sampled, o)
+			}
+		case SampleFirstN:
+			if s.seen <= s.N {
+				sampled = append(sampled, o)
+			}
+		case SampleReservoir:
+			// Algorithm R: the i-th record replaces a random sampled
+			// record with probability N/i.
+			if len(s.reservoir) < s.N {
+				s.reservoir = append(s.reservoir, o)
+			} else if j := s.random().Intn(s.seen); j < s.N {
+				s.reservoir[j] = o
+			}
+		}
+	}
+	if len(sampled) == 0 {
+		return
+	}
+	dd, err := objectsJSON(d, sampled)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Finish sends the sample with SampleReservoir.
+func (s *Sampler) Finish(outputChan chan data.JSON, killChan chan error) {
+	if s.Mode != SampleReservoir || len(s.reservoir) == 0 {
+		return
+	}
+	d, err := data.NewJSON(s.reservoir)
+	s.reservoir = nil
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- d
+}
+
+func (s *Sampler) String() string {
+	switch s.Mode {
+	case SampleReservoir:
+		return fmt.Sprintf("Sampler(reservoir %d)", s.N)
+	case SampleFirstN:
+		return fmt.Sprintf("Sampler(first %d)", s.N)
+	}
+	return fmt.Sprintf("Sampler(rate %v)", s.Rate)
+}
@@ -0,0 +1,319 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SCD2Writer loads records into a Type 2 slowly changing dimension: rather
+// than updating a row when a record changes, the current row is expired
+// and a new version is inserted, so the dimension keeps its full history.
+//
+// Each record is matched to the current row with the same BusinessKeys.
+// If there's none, the record is inserted as the first version. If any of
+// the CompareColumns differ (every field of the record that isn't a
+// business key, by default), the current row is expired by setting its
+// ValidToColumn to the effective time (and CurrentColumn to false), and
+// the record is inserted with ValidFromColumn set to the effective time,
+// ValidToColumn NULL and CurrentColumn true. Unchanged records aren't
+// written.
+//
+// The effective time is when the payload is written, or the value of
+// EffectiveField in each record if it's set (the field itself isn't
+// written, unless it's ValidFromColumn). Current rows are those whose
+// CurrentColumn is true, or if CurrentColumn is empty, whose ValidToColumn
+// is NULL. Surrogate keys are left to the database, e.g. as an
+// auto-increment column.
+//
+// Each payload is written in a single transaction. The database's dialect
+// is chosen from its driver (see util.DialectFor).
+type SCD2Writer struct {
+	writeDB         *sqlx.DB
+	TableName       string
+	BusinessKeys    []string
+	CompareColumns  []string
+	ValidFromColumn string
+	ValidToColumn   string
+	CurrentColumn   string
+	EffectiveField  string
+	BatchSize       int // The number of keys looked up at a time
+	// Timeout limits each statement, see util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries the transaction of a payload that fails with a
+	// retryable error, such as a deadlock. See util.SQLRetry.
+	Retry util.SQLRetry
+}
+
+// NewSCD2Writer returns a new SCD2Writer for the dimension tableName,
+// with the columns valid_from, valid_to and is_current.
+func NewSCD2Writer(db *sqlx.DB, tableName string, businessKeys ...string) *SCD2Writer {
+	return &SCD2Writer{
+		writeDB:         db,
+		TableName:       tableName,
+		BusinessKeys:    businessKeys,
+		ValidFromColumn: "valid_from",
+		ValidToColumn:   "valid_to",
+		CurrentColumn:   "is_current",
+		BatchSize:       100,
+	}
+}
+
+// ProcessData writes new versions of the records that have changed.
+func (s *SCD2Writer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the transaction is rolled
+// back if ctx is done before it commits. See ratchet.ContextDataProcessor.
+func (s *SCD2Writer) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if len(s.BusinessKeys) == 0 {
+		util.KillPipelineIfErr(util.ConfigErrorf("SCD2Writer: BusinessKeys are required"), killChan)
+		return
+	}
+	dialect, err := util.DialectFor(s.writeDB.DriverName())
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	now := time.Now().UTC()
+	err = s.Retry.Do(ctx, s.writeDB, func(ctx context.Context) error {
+		return s.writeTx(ctx, dialect, objects, now)
+	})
+	util.KillPipelineIfErr(err, killChan)
+}
+
+func (s *SCD2Writer) writeTx(ctx context.Context, dialect util.Dialect, objects []map[string]interface{}, now time.Time) error {
+	tx, err := s.writeDB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := s.currentRows(ctx, tx, dialect, objects)
+	if err != nil {
+		return err
+	}
+
+	var inserted, expired int
+	for _, o := range objects {
+		key, err := s.key(o)
+		if err != nil {
+			return err
+		}
+		row, exists := current[key]
+		if exists && !s.changed(o, row) {
+			continue
+		}
+		effective := interface{}(now)
+		if s.EffectiveField != "" {
+			if effective = o[s.EffectiveField]; effective == nil {
+				return util.DataErrorf("SCD2Writer: record has no %v field", s.EffectiveField)
+			}
+		}
+		if exists {
+			if err := s.expire(ctx, tx, dialect, o, effective); err != nil {
+				return err
+			}
+			expired++
+		}
+
+		version := make(map[string]interface{}, len(o)+3)
+		for k, v := range o {
+			if k != s.EffectiveField {
+				version[k] = v
+			}
+		}
+		version[s.ValidFromColumn] = effective
+		version[s.ValidToColumn] = nil
+		if s.CurrentColumn != "" {
+			version[s.CurrentColumn] = true
+		}
+		insertSQL, vals := util.BuildInsertSQL(dialect, []map[string]interface{}{version}, s.TableName, false, nil, nil)
+		logger.Debug("SCD2Writer:", insertSQL)
+		if err := s.exec(ctx, tx, insertSQL, vals); err != nil {
+			return err
+		}
+		inserted++
+		// Later records with the same key are compared with this one.
+		current[key] = o
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("SCD2Writer: %d versions inserted, %d expired, %d unchanged", inserted, expired, len(objects)-inserted))
+	return nil
+}
+
+// currentRows returns the current rows for the keys of objects.
+func (s *SCD2Writer) currentRows(ctx context.Context, tx *sqlx.Tx, dialect util.Dialect, objects []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	current := map[string]map[string]interface{}{}
+	err := util.ForEachBatch(objects, s.BatchSize, 1, func(batch []map[string]interface{}) error {
+		// Format: SELECT * FROM tablename WHERE is_current=? AND
+		// ((key1=? AND key2=?) OR (key1=? AND key2=?))
+		var b strings.Builder
+		var vals []interface{}
+		fmt.Fprintf(&b, "SELECT * FROM %v WHERE %v AND (", s.TableName, s.currentCondition(dialect, &vals))
+		for i, o := range batch {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			where, err := s.keyCondition(dialect, o, &vals)
+			if err != nil {
+				return err
+			}
+			b.WriteString(where)
+		}
+		b.WriteByte(')')
+
+		return util.WithQueryTimeout(ctx, s.Timeout, func(ctx context.Context) error {
+			rows, err := tx.QueryxContext(ctx, b.String(), vals...)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				row := map[string]interface{}{}
+				if err := rows.MapScan(row); err != nil {
+					return err
+				}
+				for k, v := range row {
+					row[k] = scd2Value(v)
+				}
+				key, err := s.key(row)
+				if err != nil {
+					return err
+				}
+				current[key] = row
+			}
+			return rows.Err()
+		})
+	})
+	return current, err
+}
+
+// expire ends the validity of the current row with o's keys.
+func (s *SCD2Writer) expire(ctx context.Context, tx *sqlx.Tx, dialect util.Dialect, o map[string]interface{}, effective interface{}) error {
+	vals := []interface{}{effective}
+	set := fmt.Sprintf("%v=%v", s.ValidToColumn, dialect.Placeholder(1))
+	if s.CurrentColumn != "" {
+		vals = append(vals, false)
+		set += fmt.Sprintf(",%v=%v", s.CurrentColumn, dialect.Placeholder(2))
+	}
+	current := s.currentCondition(dialect, &vals)
+	where, err := s.keyCondition(dialect, o, &vals)
+	if err != nil {
+		return err
+	}
+	updateSQL := fmt.Sprintf("UPDATE %v SET %v WHERE %v AND %v", s.TableName, set, current, where)
+	logger.Debug("SCD2Writer:", updateSQL)
+	return s.exec(ctx, tx, updateSQL, vals)
+}
+
+func (s *SCD2Writer) exec(ctx context.Context, tx *sqlx.Tx, query string, vals []interface{}) error {
+	return util.WithQueryTimeout(ctx, s.Timeout, func(ctx context.Context) error {
+		_, err := tx.ExecContext(ctx, query, vals...)
+		return err
+	})
+}
+
+// currentCondition returns the condition matching current rows, adding
+// its values to vals.
+func (s *SCD2Writer) currentCondition(dialect util.Dialect, vals *[]interface{}) string {
+	if s.CurrentColumn == "" {
+		return s.ValidToColumn + " IS NULL"
+	}
+	*vals = append(*vals, true)
+	return fmt.Sprintf("%v=%v", s.CurrentColumn, dialect.Placeholder(len(*vals)))
+}
+
+// keyCondition returns the condition matching o's BusinessKeys, adding
+// their values to vals.
+func (s *SCD2Writer) keyCondition(dialect util.Dialect, o map[string]interface{}, vals *[]interface{}) (string, error) {
+	conds := make([]string, len(s.BusinessKeys))
+	for i, k := range s.BusinessKeys {
+		v, ok := o[k]
+		if !ok || v == nil {
+			return "", util.DataErrorf("Missing value for business key: %v", k)
+		}
+		*vals = append(*vals, v)
+		conds[i] = fmt.Sprintf("%v=%v", k, dialect.Placeholder(len(*vals)))
+	}
+	return "(" + strings.Join(conds, " AND ") + ")", nil
+}
+
+// key returns the BusinessKeys values of o as a string.
+func (s *SCD2Writer) key(o map[string]interface{}) (string, error) {
+	parts := make([]string, len(s.BusinessKeys))
+	for i, k := range s.BusinessKeys {
+		v, ok := o[k]
+		if !ok || v == nil {
+			return "", util.DataErrorf("Missing value for business key: %v", k)
+		}
+		parts[i] = syncValueString(v)
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// changed returns true if any of the CompareColumns of o differ from row.
+func (s *SCD2Writer) changed(o, row map[string]interface{}) bool {
+	cols := s.CompareColumns
+	if len(cols) == 0 {
+		isKey := map[string]bool{}
+		for _, k := range s.BusinessKeys {
+			isKey[k] = true
+		}
+		for col := range o {
+			if !isKey[col] && col != s.EffectiveField {
+				cols = append(cols, col)
+			}
+		}
+		sort.Strings(cols)
+	}
+	for _, col := range cols {
+		v, rv := o[col], row[col]
+		if (v == nil) != (rv == nil) || syncValueString(v) != syncValueString(rv) {
+			return true
+		}
+	}
+	return false
+}
+
+// scd2Value converts a value scanned from the database to the type it
+// would have been decoded from JSON as, so it can be compared with records.
+func scd2Value(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case []byte:
+		return string(vv)
+	case int64:
+		return float64(vv)
+	case int32:
+		return float64(vv)
+	case float32:
+		return float64(vv)
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// Finish - see interface for documentation.
+func (s *SCD2Writer) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (s *SCD2Writer) String() string {
+	return "SCD2Writer"
+}
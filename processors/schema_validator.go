@@ -0,0 +1,132 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// ValidationPolicy controls what SchemaValidator does with invalid records.
+type ValidationPolicy int
+
+const (
+	// ValidationKill kills the pipeline on the first invalid record.
+	ValidationKill ValidationPolicy = iota
+	// ValidationDrop logs and discards invalid records.
+	ValidationDrop
+	// ValidationRoute sends invalid records to SchemaValidator.ErrorOutput.
+	ValidationRoute
+)
+
+// SchemaValidator validates each record it receives against a JSON Schema
+// (see util.JSONSchema), passing valid records on to the next stage.
+// Incoming data can be a single JSON object or an array of objects; arrays
+// are validated record by record and the valid records are sent on as an
+// array.
+//
+// Invalid records are handled according to Policy. With ValidationRoute,
+// each invalid record is passed to ErrorOutput (e.g. a JSONLinesWriter or a
+// ratchet.NamedOutput) as an object of the form
+// {"record": <record>, "error": "<validation error>"}. The ErrorOutput is
+// finished when the SchemaValidator is finished, so it doesn't need to be
+// part of the pipeline layout.
+type SchemaValidator struct {
+	Schema      *util.JSONSchema
+	Policy      ValidationPolicy
+	ErrorOutput ratchet.DataProcessor
+}
+
+// NewSchemaValidator returns a new SchemaValidator for the given JSON Schema
+// document, using the ValidationKill policy.
+func NewSchemaValidator(schema []byte) (*SchemaValidator, error) {
+	s, err := util.ParseJSONSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaValidator{Schema: s, Policy: ValidationKill}, nil
+}
+
+// ProcessData validates the data and sends the valid records on.
+func (v *SchemaValidator) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	var records []json.RawMessage
+	isArray := json.Unmarshal(d, &records) == nil
+	if !isArray {
+		records = []json.RawMessage{json.RawMessage(d)}
+	}
+
+	valid := make([]json.RawMessage, 0, len(records))
+	for _, r := range records {
+		err := v.Schema.Validate(data.JSON(r))
+		if err == nil {
+			valid = append(valid, r)
+			continue
+		}
+		if !v.handleInvalid(r, err, outputChan, killChan) {
+			return
+		}
+	}
+
+	if len(valid) == 0 {
+		return
+	}
+	if !isArray {
+		outputChan <- d
+		return
+	}
+	if len(valid) == len(records) {
+		outputChan <- d
+		return
+	}
+	out, err := json.Marshal(valid)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- out
+}
+
+// handleInvalid applies the Policy to an invalid record, returning false
+// if processing should stop.
+func (v *SchemaValidator) handleInvalid(r json.RawMessage, err error, outputChan chan data.JSON, killChan chan error) bool {
+	return handleInvalidRecord(v, v.Policy, v.ErrorOutput, r, err, outputChan, killChan)
+}
+
+// handleInvalidRecord applies a ValidationPolicy to a record rejected by p,
+// returning false if processing should stop.
+func handleInvalidRecord(p ratchet.DataProcessor, policy ValidationPolicy, errorOutput ratchet.DataProcessor, record interface{}, err error, outputChan chan data.JSON, killChan chan error) bool {
+	switch policy {
+	case ValidationDrop:
+		logger.Info(fmt.Sprintf("%v:", p), "dropping invalid record -", err)
+		return true
+	case ValidationRoute:
+		if errorOutput == nil {
+			util.KillPipelineIfErr(util.ConfigErrorf("%v: ErrorOutput is required for ValidationRoute", p), killChan)
+			return false
+		}
+		rejected, merr := deadLetterJSON(record, err)
+		if merr != nil {
+			util.KillPipelineIfErr(merr, killChan)
+			return false
+		}
+		errorOutput.ProcessData(rejected, outputChan, killChan)
+		return true
+	default:
+		util.KillPipelineIfErr(err, killChan)
+		return false
+	}
+}
+
+// Finish - see interface for documentation.
+func (v *SchemaValidator) Finish(outputChan chan data.JSON, killChan chan error) {
+	if v.ErrorOutput != nil {
+		v.ErrorOutput.Finish(outputChan, killChan)
+	}
+}
+
+func (v *SchemaValidator) String() string {
+	return "SchemaValidator"
+}
@@ -0,0 +1,45 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewSchemaValidator() {
+	logger.LogLevel = logger.LevelSilent
+
+	lines := `{"id":1,"name":"a"}
+{"id":"2","name":"b"}
+{"name":"c"}
+`
+	read := processors.NewJSONLinesReader(strings.NewReader(lines))
+	validate, err := processors.NewSchemaValidator([]byte(`{
+		"type": "object",
+		"required": ["id", "name"],
+		"properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+	}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	validate.Policy = processors.ValidationRoute
+	validate.ErrorOutput = processors.NewJSONLinesWriter(os.Stdout)
+	write := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(read, validate, write)
+
+	err = <-pipeline.Run()
+
+	if err != nil {
+		fmt.Println("An error occurred in the ratchet pipeline:", err.Error())
+	}
+
+	// Output:
+	// {"error":"schema validation failed: $.id: expected integer, got string","record":{"id":"2","name":"b"}}
+	// {"error":"schema validation failed: $: missing required property \"id\"","record":{"name":"c"}}
+	// {"id":1,"name":"a"}
+}
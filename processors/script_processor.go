@@ -0,0 +1,136 @@
+package processors
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dop251/goja"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// ScriptProcessor transforms each record it receives with a JavaScript
+// function, so transforms can be written (and loaded from files referenced
+// in a pipeline config) without any Go. The script must define a function
+// named FunctionName, which is called with each record:
+//
+//	function transform(record) {
+//		record.total = record.price * record.quantity;
+//		return record;
+//	}
+//
+// The function can return the record (or a new object) to send it on, an
+// array of objects to send several, or null or undefined to drop it.
+// console.log writes to the ratchet logger. Scripts are run with goja
+// (https://github.com/dop251/goja), which supports ECMAScript 5.1 and much
+// of ES6.
+//
+// Incoming data can be a single JSON object or an array of objects. The
+// transformed records are sent as an array, or as a single object if the
+// payload was an object and the function returned a single object.
+type ScriptProcessor struct {
+	Name         string // The name of the script, for error messages
+	FunctionName string
+
+	vm *goja.Runtime
+	fn goja.Callable
+}
+
+// NewScriptProcessor returns a new ScriptProcessor running the script,
+// whose function is called "transform".
+func NewScriptProcessor(script string) (*ScriptProcessor, error) {
+	return newScriptProcessor("script", script, "transform")
+}
+
+// NewScriptProcessorFromFile returns a new ScriptProcessor running the
+// script in the file at path, whose function is called "transform".
+func NewScriptProcessorFromFile(path string) (*ScriptProcessor, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return newScriptProcessor(path, string(b), "transform")
+}
+
+func newScriptProcessor(name, script, functionName string) (*ScriptProcessor, error) {
+	p := &ScriptProcessor{Name: name, FunctionName: functionName, vm: goja.New()}
+	console := p.vm.NewObject()
+	console.Set("log", func(args ...interface{}) {
+		logger.Info(append([]interface{}{"ScriptProcessor:"}, args...)...)
+	})
+	p.vm.Set("console", console)
+	if _, err := p.vm.RunScript(name, script); err != nil {
+		return nil, util.ConfigErrorf("script %v: %v", name, err)
+	}
+	return p, nil
+}
+
+// SetFunction sets the function to call, after the script has run.
+func (p *ScriptProcessor) SetFunction(name string) error {
+	fn, ok := goja.AssertFunction(p.vm.Get(name))
+	if !ok {
+		return util.ConfigErrorf("script %v doesn't define a function %v", p.Name, name)
+	}
+	p.FunctionName = name
+	p.fn = fn
+	return nil
+}
+
+// ProcessData calls the function with each record.
+func (p *ScriptProcessor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if p.fn == nil {
+		if err := p.SetFunction(p.FunctionName); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+
+	var out []interface{}
+	single := len(objects) == 1
+	for _, o := range objects {
+		result, err := p.fn(goja.Undefined(), p.vm.ToValue(o))
+		if err != nil {
+			util.KillPipelineIfErr(util.DataErrorf("ScriptProcessor: %v: %v", p.Name, err), killChan)
+			return
+		}
+		switch v := result.Export().(type) {
+		case nil:
+		case []interface{}:
+			out = append(out, v...)
+			single = false
+		case map[string]interface{}:
+			out = append(out, v)
+		default:
+			util.KillPipelineIfErr(util.DataErrorf("ScriptProcessor: %v: %v returned %v, not an object", p.Name, p.FunctionName, v), killChan)
+			return
+		}
+	}
+	if len(out) == 0 {
+		return
+	}
+
+	var v interface{} = out
+	if single && len(out) == 1 && isObjectJSON(d) {
+		v = out[0]
+	}
+	dd, err := data.NewJSON(v)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Finish - see interface for documentation.
+func (p *ScriptProcessor) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (p *ScriptProcessor) String() string {
+	return fmt.Sprintf("ScriptProcessor(%v)", p.Name)
+}
@@ -0,0 +1,41 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewScriptProcessor() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"item":"pen","price":1.5,"quantity":4}
+{"item":"ink","price":3,"quantity":0}
+`))
+	script, err := processors.NewScriptProcessor(`
+		function transform(record) {
+			if (record.quantity === 0) {
+				return null;
+			}
+			record.total = record.price * record.quantity;
+			return record;
+		}
+	`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, script, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"item":"pen","price":1.5,"quantity":4,"total":6}
+}
@@ -0,0 +1,309 @@
+package processors
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SortKey is a field to sort records by.
+type SortKey struct {
+	Field      string // Dotted path to the field
+	Descending bool
+}
+
+// Sort orders all the records it receives by Keys, and sends them on in
+// order when it is finished. Records with equal keys keep the order they
+// were received in. Incoming data can be a single JSON object or an array
+// of objects, and the sorted records are sent as arrays of BatchSize.
+//
+// Up to MaxRecordsInMemory records are sorted in memory. Beyond that,
+// sorted runs are spilled to temporary files in TempDir and merged when
+// the Sort is finished, so datasets larger than memory can be sorted.
+//
+// Values are compared with util.CompareValues. Missing and null values
+// sort first, followed by booleans, numbers, strings and then any other
+// values (which compare as equal).
+type Sort struct {
+	Keys               []SortKey
+	MaxRecordsInMemory int    // Defaults to 100000
+	TempDir            string // Defaults to os.TempDir()
+	BatchSize          int    // Defaults to 1000
+
+	records []map[string]interface{}
+	dir     string
+	runs    []string
+}
+
+// NewSort returns a new Sort by the given fields. Prefix a field with "-"
+// to sort it in descending order, e.g. NewSort("country", "-amount").
+func NewSort(fields ...string) *Sort {
+	s := &Sort{MaxRecordsInMemory: 100000, BatchSize: 1000}
+	for _, f := range fields {
+		if strings.HasPrefix(f, "-") {
+			s.Keys = append(s.Keys, SortKey{Field: f[1:], Descending: true})
+		} else {
+			s.Keys = append(s.Keys, SortKey{Field: f})
+		}
+	}
+	return s
+}
+
+// ProcessData buffers the records, spilling them when there are too many.
+func (s *Sort) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	s.records = append(s.records, objects...)
+	if s.MaxRecordsInMemory > 0 && len(s.records) >= s.MaxRecordsInMemory {
+		util.KillPipelineIfErr(s.spill(), killChan)
+	}
+}
+
+// Finish sends the sorted records.
+func (s *Sort) Finish(outputChan chan data.JSON, killChan chan error) {
+	defer s.cleanup()
+	if len(s.runs) == 0 {
+		s.sortRecords()
+		records := s.records
+		s.records = nil
+		for len(records) > 0 {
+			n := s.batchSize()
+			if n > len(records) {
+				n = len(records)
+			}
+			if err := s.send(records[:n], outputChan); err != nil {
+				util.KillPipelineIfErr(err, killChan)
+				return
+			}
+			records = records[n:]
+		}
+		return
+	}
+	if len(s.records) > 0 {
+		if err := s.spill(); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	util.KillPipelineIfErr(s.merge(outputChan), killChan)
+}
+
+func (s *Sort) batchSize() int {
+	if s.BatchSize <= 0 {
+		return 1000
+	}
+	return s.BatchSize
+}
+
+func (s *Sort) send(records []map[string]interface{}, outputChan chan data.JSON) error {
+	d, err := data.NewJSON(records)
+	if err != nil {
+		return err
+	}
+	outputChan <- d
+	return nil
+}
+
+func (s *Sort) sortRecords() {
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.compare(s.records[i], s.records[j]) < 0
+	})
+}
+
+func (s *Sort) compare(a, b map[string]interface{}) int {
+	for _, k := range s.Keys {
+		av, _ := util.LookupField(a, k.Field)
+		bv, _ := util.LookupField(b, k.Field)
+		c := compareSortValues(av, bv)
+		if k.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func sortRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64, json.Number:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+func compareSortValues(a, b interface{}) int {
+	ra, rb := sortRank(a), sortRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	if ra == 1 {
+		switch {
+		case a == b:
+			return 0
+		case a == false:
+			return -1
+		}
+		return 1
+	}
+	c, _ := util.CompareValues(a, b)
+	return c
+}
+
+// spill writes the records to a new sorted run.
+func (s *Sort) spill() error {
+	if s.dir == "" {
+		dir, err := ioutil.TempDir(s.TempDir, "ratchet-sort-")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+	s.sortRecords()
+	path := filepath.Join(s.dir, "run-"+strconv.Itoa(len(s.runs))+".jsonl")
+	logger.Info("Sort: spilling", len(s.records), "records to", path)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range s.records {
+		b, err := json.Marshal(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, path)
+	s.records = nil
+	return nil
+}
+
+// merge does a k-way merge of the sorted runs.
+func (s *Sort) merge(outputChan chan data.JSON) error {
+	h := &sortRunHeap{sort: s}
+	for i, path := range s.runs {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		run := &sortRun{index: i, r: bufio.NewReader(f)}
+		if ok, err := run.next(); err != nil {
+			return err
+		} else if ok {
+			h.runs = append(h.runs, run)
+		}
+	}
+	heap.Init(h)
+
+	var batch []map[string]interface{}
+	for h.Len() > 0 {
+		run := h.runs[0]
+		batch = append(batch, run.record)
+		if len(batch) == s.batchSize() {
+			if err := s.send(batch, outputChan); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	if len(batch) > 0 {
+		return s.send(batch, outputChan)
+	}
+	return nil
+}
+
+func (s *Sort) cleanup() {
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+	s.dir = ""
+	s.runs = nil
+}
+
+func (s *Sort) String() string {
+	return "Sort"
+}
+
+type sortRun struct {
+	index  int
+	r      *bufio.Reader
+	record map[string]interface{}
+}
+
+func (r *sortRun) next() (bool, error) {
+	line, err := r.r.ReadBytes('\n')
+	if len(line) == 0 && err == io.EOF {
+		return false, nil
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	r.record = nil
+	if err := json.Unmarshal(line, &r.record); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sortRunHeap orders runs by their current record, then by run index so
+// the merge is stable.
+type sortRunHeap struct {
+	sort *Sort
+	runs []*sortRun
+}
+
+func (h *sortRunHeap) Len() int { return len(h.runs) }
+func (h *sortRunHeap) Less(i, j int) bool {
+	if c := h.sort.compare(h.runs[i].record, h.runs[j].record); c != 0 {
+		return c < 0
+	}
+	return h.runs[i].index < h.runs[j].index
+}
+func (h *sortRunHeap) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *sortRunHeap) Push(x interface{}) { h.runs = append(h.runs, x.(*sortRun)) }
+func (h *sortRunHeap) Pop() interface{} {
+	run := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return run
+}
@@ -0,0 +1,32 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewSort() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"country":"US","amount":5}
+{"country":"DE","amount":10}
+{"country":"US","amount":20}
+`))
+	sorter := processors.NewSort("country", "-amount")
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, sorter, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"amount":10,"country":"DE"}
+	// {"amount":20,"country":"US"}
+	// {"amount":5,"country":"US"}
+}
@@ -0,0 +1,83 @@
+package processors
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Splitter is the inverse of a Batcher: it sends each element of the JSON
+// arrays it receives on as its own payload. Payloads that aren't arrays are
+// sent on as they are.
+//
+// Set Path to split an array nested in the payload instead, e.g. "results"
+// for an API response like {"results": [...]}. Path is a dotted path, which
+// may also be written like a JSONPath, e.g. "$.results[*]". Payloads
+// without the path are dropped.
+type Splitter struct {
+	Path string
+
+	fields []string
+}
+
+// NewSplitter returns a new Splitter of the array at path, or of the whole
+// payload if path is "".
+func NewSplitter(path string) *Splitter {
+	return &Splitter{Path: path}
+}
+
+// ProcessData sends each element of the array on.
+func (s *Splitter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if s.fields == nil && s.Path != "" {
+		s.fields = splitterPath(s.Path)
+	}
+	v := json.RawMessage(d)
+	for _, field := range s.fields {
+		var object map[string]json.RawMessage
+		if err := data.ParseJSONSilent(data.JSON(v), &object); err != nil {
+			util.KillPipelineIfErr(util.DataErrorf("Splitter: %v isn't an object in %v", field, string(d)), killChan)
+			return
+		}
+		var ok bool
+		if v, ok = object[field]; !ok {
+			return
+		}
+	}
+
+	if trimmed := bytes.TrimSpace(v); len(trimmed) == 0 || trimmed[0] != '[' {
+		if !bytes.Equal(trimmed, []byte("null")) {
+			outputChan <- data.JSON(v)
+		}
+		return
+	}
+	var elements []json.RawMessage
+	if err := data.ParseJSONSilent(data.JSON(v), &elements); err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	for _, e := range elements {
+		outputChan <- data.JSON(e)
+	}
+}
+
+// splitterPath returns the fields of a dotted or JSONPath-like path.
+func splitterPath(path string) []string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.TrimSuffix(path, "[*]")
+	path = strings.Trim(path, ".")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, ".")
+}
+
+// Finish - see interface for documentation.
+func (s *Splitter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (s *Splitter) String() string {
+	return "Splitter"
+}
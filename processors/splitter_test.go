@@ -0,0 +1,29 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewSplitter() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewIoReader(strings.NewReader(`{"page":1,"results":[{"id":1},{"id":2}]}`))
+	splitter := processors.NewSplitter("$.results[*]")
+	stdout := processors.NewIoWriter(os.Stdout)
+	stdout.AddNewline = true
+	pipeline := ratchet.NewPipeline(reader, splitter, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"id":1}
+	// {"id":2}
+}
@@ -0,0 +1,175 @@
+package processors
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SQLExecProcessor runs SQL statements at a stage of a Pipeline, such as
+// calling a stored procedure or refreshing a materialized view, and sends
+// the data it receives on unchanged (unlike SQLExecutor, which swallows
+// it):
+//
+//	p, err := processors.NewSQLExecProcessor(db, "CALL refresh_customer(:id)")
+//	p.PerRecord, p.BindData = true, true
+//
+// The statements are run in order for each payload received, or for each
+// of its records with PerRecord. Set OnFinish to run them once instead,
+// when the processor is finished, i.e. after every stage before it has
+// finished writing, e.g. to call a post-load procedure.
+//
+// Statements are text/templates, with the same functions as
+// TemplateProcessor's (use sqlquote to quote values), rendered with the
+// record (or the payload, an object or an array of them), or nil with
+// OnFinish. They can also use named parameters, written as :name, which
+// are bound to values from Params, and with BindData from the record's
+// fields (or the payload's, when it's a JSON object), which take
+// precedence. Parameters are only bound if Params or BindData is set.
+// See util.BindNamedParams.
+//
+// Data is sent on after the statements it triggered have succeeded. Set
+// Discard to not send it on, so the SQLExecProcessor can be the final
+// stage of a Pipeline.
+type SQLExecProcessor struct {
+	db         *sqlx.DB
+	Statements []*template.Template
+	Params     map[string]interface{}
+	BindData   bool // Bind parameters to the received data's fields
+	PerRecord  bool // Run the statements for each record, rather than each payload
+	OnFinish   bool // Run the statements once when finished, rather than for the data received
+	Discard    bool // Don't send data on
+	// Timeout limits each statement, see util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries statements that fail with a retryable error (see
+	// util.SQLRetry), so only set it for idempotent statements.
+	Retry util.SQLRetry
+}
+
+// NewSQLExecProcessor returns a new SQLExecProcessor running the
+// statements, or an error if any of them isn't a valid template.
+func NewSQLExecProcessor(db *sqlx.DB, statements ...string) (*SQLExecProcessor, error) {
+	p := &SQLExecProcessor{db: db}
+	for _, st := range statements {
+		t, err := template.New("statement").
+			Funcs(sprig.TxtFuncMap()).
+			Funcs(template.FuncMap{"sqlquote": sqlQuote}).
+			Parse(st)
+		if err != nil {
+			return nil, util.ConfigInvalidError(err)
+		}
+		p.Statements = append(p.Statements, t)
+	}
+	return p, nil
+}
+
+// ProcessData runs the statements, unless OnFinish is set, and sends d on
+// unless Discard is set.
+func (p *SQLExecProcessor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	p.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the statements are
+// cancelled when ctx is done. See ratchet.ContextDataProcessor.
+func (p *SQLExecProcessor) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if !p.OnFinish {
+		if err := p.process(ctx, d); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	if !p.Discard {
+		outputChan <- d
+	}
+}
+
+func (p *SQLExecProcessor) process(ctx context.Context, d data.JSON) error {
+	if !p.PerRecord {
+		var payload interface{}
+		if err := data.ParseJSON(d, &payload); err != nil {
+			return util.DataInvalidError(err)
+		}
+		fields, _ := payload.(map[string]interface{})
+		return p.run(ctx, payload, fields)
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	for _, o := range objects {
+		if err := p.run(ctx, o, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run renders each statement with v and runs it, binding its parameters
+// to fields and Params.
+func (p *SQLExecProcessor) run(ctx context.Context, v interface{}, fields map[string]interface{}) error {
+	exec := util.SQLExecOptions{Timeout: p.Timeout, Retry: p.Retry}
+	for _, t := range p.Statements {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, v); err != nil {
+			return util.DataErrorf("SQLExecProcessor: %v", err)
+		}
+		query, args, err := p.bindParams(buf.String(), fields)
+		if err != nil {
+			return err
+		}
+		logger.Debug("SQLExecProcessor: Running -", query)
+		err = exec.Run(ctx, p.db, func(ctx context.Context) error {
+			_, err := p.db.ExecContext(ctx, query, args...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindParams replaces the named parameters in query with the database's
+// placeholders, if Params or BindData is set.
+func (p *SQLExecProcessor) bindParams(query string, fields map[string]interface{}) (string, []interface{}, error) {
+	if p.Params == nil && !p.BindData {
+		return query, nil, nil
+	}
+	if !p.BindData {
+		fields = nil
+	}
+	query, args, err := util.BindNamedParams(query, func(name string) (interface{}, bool) {
+		if v, ok := util.LookupField(fields, name); ok {
+			return v, true
+		}
+		return util.LookupField(p.Params, name)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return p.db.Rebind(query), args, nil
+}
+
+// Finish runs the statements if OnFinish is set.
+func (p *SQLExecProcessor) Finish(outputChan chan data.JSON, killChan chan error) {
+	if !p.OnFinish {
+		return
+	}
+	if err := p.run(context.Background(), nil, nil); err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	logger.Info("SQLExecProcessor: statements complete")
+}
+
+func (p *SQLExecProcessor) String() string {
+	return "SQLExecProcessor"
+}
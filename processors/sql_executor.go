@@ -1,8 +1,10 @@
 package processors
 
 import (
+	"context"
+	"time"
+
 	"github.com/jmoiron/sqlx"
-	"errors"
 
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
@@ -22,6 +24,14 @@ type SQLExecutor struct {
 	readDB       *sqlx.DB
 	query        string
 	sqlGenerator func(data.JSON) (string, error)
+	// Timeout limits each statement, so a hung database fails the
+	// Pipeline instead of blocking it. See util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries statements that fail with a retryable error, such as
+	// a lost connection or a deadlock (see util.SQLRetry). Statements
+	// that may have been applied before the connection was lost are run
+	// again, so only set it for idempotent statements.
+	Retry util.SQLRetry
 }
 
 // NewSQLExecutor returns a new SQLExecutor
@@ -36,6 +46,12 @@ func NewDynamicSQLExecutor(dbConn *sqlx.DB, sqlGenerator func(data.JSON) (string
 
 // ProcessData runs the SQL statements, deferring to util.ExecuteSQLQuery
 func (s *SQLExecutor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the statement is
+// cancelled when ctx is done. See ratchet.ContextDataProcessor.
+func (s *SQLExecutor) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	// handle panics a bit more gracefully
 	defer func() {
 		if err := recover(); err != nil {
@@ -51,12 +67,14 @@ func (s *SQLExecutor) ProcessData(d data.JSON, outputChan chan data.JSON, killCh
 	} else if s.query != "" {
 		sql = s.query
 	} else {
-		killChan <- errors.New("SQLExecutor: must have either static query or sqlGenerator func")
+		killChan <- util.ConfigErrorf("SQLExecutor: must have either static query or sqlGenerator func")
 	}
 
 	logger.Debug("SQLExecutor: Running - ", sql)
 	// See sql.go
-	err = util.ExecuteSQLQuery(s.readDB, sql)
+	err = util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry}.Run(ctx, s.readDB, func(ctx context.Context) error {
+		return util.ExecuteSQLQueryContext(ctx, s.readDB, sql)
+	})
 	util.KillPipelineIfErr(err, killChan)
 	logger.Info("SQLExecutor: Query complete")
 }
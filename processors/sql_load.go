@@ -0,0 +1,53 @@
+package processors
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// sqlLoad keeps track of the tables a SQL writer has prepared for its load
+// strategy, see util.PrepareSQLLoad.
+type sqlLoad struct {
+	tables map[string]string // The table written to, by target table
+	mutex  sync.Mutex
+}
+
+// table prepares tableName the first time it's written to, and returns
+// the table to write to.
+func (l *sqlLoad) table(ctx context.Context, db *sqlx.DB, strategy, tableName string, exec util.SQLExecOptions) (string, error) {
+	if strategy == "" || strategy == util.SQLLoadAppend {
+		return tableName, nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if t, ok := l.tables[tableName]; ok {
+		return t, nil
+	}
+	t, err := util.PrepareSQLLoad(ctx, db, strategy, tableName, exec)
+	if err != nil {
+		return "", err
+	}
+	if l.tables == nil {
+		l.tables = map[string]string{}
+	}
+	l.tables[tableName] = t
+	return t, nil
+}
+
+// finish completes the load of every table written to, and starts again
+// in case the writer is reused.
+func (l *sqlLoad) finish(db *sqlx.DB, strategy string, exec util.SQLExecOptions) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	defer func() { l.tables = nil }()
+	for tableName := range l.tables {
+		if err := util.FinishSQLLoad(context.Background(), db, strategy, tableName, exec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
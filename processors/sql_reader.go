@@ -1,9 +1,15 @@
 package processors
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
-	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/fefelovgroup/ratchet"
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
 	"github.com/fefelovgroup/ratchet/util"
@@ -19,17 +25,58 @@ import (
 // The dynamic SQL generation is implemented by passing in a "sqlGenerator"
 // function to NewDynamicSQLReader. This allows you to write whatever code is
 // needed to generate SQL based upon data flowing through the pipeline.
+//
+// Rows are streamed as they're read, and sent in batches of BatchSize, so
+// memory use doesn't depend on the size of the result. A BatchSize of 0
+// reads the whole result into a single batch. For databases that
+// materialize results for the client (such as Redshift), set FetchSize to
+// read through a server-side cursor, FetchSize rows at a time.
+//
+// Set CountRows to run a COUNT(*) of each query before reading it, so the
+// SQLReader can report its progress (see ratchet.ProgressSource).
+//
+// Set WatermarkColumn and Checkpoints for incremental extraction. The
+// largest value of the column that was read is saved to Checkpoints when
+// the Pipeline succeeds (see ratchet.CommittingDataProcessor), and
+// {{watermark}} in the query is replaced with the saved value (as a SQL
+// literal) on the next run, e.g.
+//
+//	SELECT * FROM orders WHERE updated_at > {{watermark}} ORDER BY updated_at
+//
+// InitialWatermark is used until a value has been saved. If no rows are
+// read, the saved watermark is left as it is.
+//
+// Queries can use named parameters, written as :name, so values don't
+// have to be formatted into the SQL:
+//
+//	SELECT * FROM orders WHERE customer_id = :customer_id AND status = :status
+//
+// Values come from Params, and with BindData from the fields of the data
+// received (when it's a JSON object), which take precedence. Parameters
+// are only bound if Params or BindData is set. See util.BindNamedParams.
 type SQLReader struct {
 	readDB            *sqlx.DB
 	query             string
 	sqlGenerator      func(data.JSON) (string, error)
 	BatchSize         int
+	FetchSize         int           // Read through a server-side cursor, see util.ForEachSQLQueryBatch
+	Timeout           time.Duration // Limits how long the database can take to respond, see util.ForEachSQLQueryBatch
+	Retry             util.SQLRetry // Retries queries that fail with retryable errors before any rows are sent
 	StructDestination interface{}
 	ConcurrencyLevel  int // See ConcurrentDataProcessor
-}
-
-type dataErr struct {
-	Error string
+	CountRows         bool
+	WatermarkColumn   string
+	WatermarkKey      string // Defaults to WatermarkColumn
+	InitialWatermark  interface{}
+	Checkpoints       ratchet.CheckpointStore
+	Params            map[string]interface{}
+	BindData          bool // Bind parameters to the received data's fields
+	rowsRead          int64
+	rowsTotal         int64
+	watermark         interface{}
+	watermarkLoaded   bool
+	maxWatermark      interface{}
+	watermarkMutex    sync.Mutex
 }
 
 // NewSQLReader returns a new SQLReader operating in static mode.
@@ -44,7 +91,13 @@ func NewDynamicSQLReader(dbConn *sqlx.DB, sqlGenerator func(data.JSON) (string,
 
 // ProcessData - see interface for documentation.
 func (s *SQLReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
-	s.ForEachQueryData(d, killChan, func(d data.JSON) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the query is cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (s *SQLReader) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ForEachQueryDataCtx(ctx, d, killChan, func(d data.JSON) {
 		outputChan <- d
 	})
 }
@@ -53,34 +106,212 @@ func (s *SQLReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan
 // running the query and retrieving the data in data.JSON format, and then
 // passing the results back witih the function call to forEach.
 func (s *SQLReader) ForEachQueryData(d data.JSON, killChan chan error, forEach func(d data.JSON)) {
-	sql := ""
-	var err error
-	if s.query == "" && s.sqlGenerator != nil {
-		sql, err = s.sqlGenerator(d)
+	s.ForEachQueryDataCtx(context.Background(), d, killChan, forEach)
+}
+
+// ForEachQueryDataCtx is the same as ForEachQueryData, but the query is
+// cancelled when ctx is done.
+func (s *SQLReader) ForEachQueryDataCtx(ctx context.Context, d data.JSON, killChan chan error, forEach func(d data.JSON)) {
+	s.forEachQueryData(ctx, d, func(err error) {
 		util.KillPipelineIfErr(err, killChan)
+	}, forEach)
+}
+
+// querySQL returns the static query, or generates one for dynamic mode,
+// along with the values of its parameters.
+func (s *SQLReader) querySQL(d data.JSON) (string, []interface{}, error) {
+	var sql string
+	if s.query == "" && s.sqlGenerator != nil {
+		var err error
+		if sql, err = s.sqlGenerator(d); err != nil {
+			return "", nil, err
+		}
 	} else if s.query != "" {
 		sql = s.query
 	} else {
-		killChan <- errors.New("SQLReader: must have either static query or sqlGenerator func")
+		return "", nil, util.ConfigErrorf("SQLReader: must have either static query or sqlGenerator func")
+	}
+	if s.WatermarkColumn != "" {
+		watermark, err := s.loadWatermark()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = strings.Replace(sql, "{{watermark}}", sqlLiteral(watermark), -1)
+	}
+	if s.Params == nil && !s.BindData {
+		return sql, nil, nil
+	}
+	return s.bindParams(sql, d)
+}
+
+// bindParams replaces the named parameters in sql with the database's
+// placeholders.
+func (s *SQLReader) bindParams(sql string, d data.JSON) (string, []interface{}, error) {
+	var fields map[string]interface{}
+	if s.BindData && isObjectJSON(d) {
+		if err := data.ParseJSON(d, &fields); err != nil {
+			return "", nil, util.DataInvalidError(err)
+		}
+	}
+	sql, args, err := util.BindNamedParams(sql, func(name string) (interface{}, bool) {
+		if v, ok := util.LookupField(fields, name); ok {
+			return v, true
+		}
+		return util.LookupField(s.Params, name)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return s.readDB.Rebind(sql), args, nil
+}
+
+func (s *SQLReader) watermarkKey() string {
+	if s.WatermarkKey != "" {
+		return s.WatermarkKey
+	}
+	return s.WatermarkColumn
+}
+
+// loadWatermark returns the saved watermark, loading it the first time.
+func (s *SQLReader) loadWatermark() (interface{}, error) {
+	s.watermarkMutex.Lock()
+	defer s.watermarkMutex.Unlock()
+	if s.watermarkLoaded {
+		return s.watermark, nil
+	}
+	if s.Checkpoints == nil {
+		return nil, util.ConfigErrorf("SQLReader: WatermarkColumn is set, but Checkpoints isn't")
+	}
+	var watermark interface{}
+	ok, err := s.Checkpoints.Load(s.watermarkKey(), &watermark)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if s.InitialWatermark == nil {
+			return nil, util.ConfigErrorf("SQLReader: no watermark has been saved for %v, and InitialWatermark isn't set", s.watermarkKey())
+		}
+		watermark = s.InitialWatermark
+	}
+	s.watermark, s.watermarkLoaded = watermark, true
+	return watermark, nil
+}
+
+// trackWatermark records the largest WatermarkColumn value in d.
+func (s *SQLReader) trackWatermark(d data.JSON) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return
+	}
+	s.watermarkMutex.Lock()
+	defer s.watermarkMutex.Unlock()
+	for _, o := range objects {
+		v, ok := o[s.WatermarkColumn]
+		if !ok || v == nil {
+			continue
+		}
+		if s.maxWatermark == nil {
+			s.maxWatermark = v
+		} else if c, ok := util.CompareValues(v, s.maxWatermark); ok && c > 0 {
+			s.maxWatermark = v
+		}
+	}
+}
+
+// Commit saves the largest WatermarkColumn value read, if any rows were
+// read. See ratchet.CommittingDataProcessor.
+func (s *SQLReader) Commit() error {
+	s.watermarkMutex.Lock()
+	defer s.watermarkMutex.Unlock()
+	if s.WatermarkColumn == "" || s.maxWatermark == nil {
+		return nil
+	}
+	if err := s.Checkpoints.Save(s.watermarkKey(), s.maxWatermark); err != nil {
+		return err
+	}
+	logger.Info("SQLReader: saved watermark", s.watermarkKey(), "=", s.maxWatermark)
+	// Start again from the new watermark if the SQLReader is reused.
+	s.watermark, s.maxWatermark = s.maxWatermark, nil
+	return nil
+}
+
+// sqlLiteral formats v as a SQL literal: numbers as they are, and anything
+// else as a quoted string.
+func sqlLiteral(v interface{}) string {
+	switch vv := v.(type) {
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(vv)
+	case int64:
+		return strconv.FormatInt(vv, 10)
+	case time.Time:
+		return sqlQuote(vv.Format("2006-01-02 15:04:05.999999999"))
+	}
+	return sqlQuote(v)
+}
+
+func (s *SQLReader) forEachQueryData(ctx context.Context, d data.JSON, onErr func(error), forEach func(d data.JSON)) {
+	sql, args, err := s.querySQL(d)
+	if err != nil {
+		onErr(err)
+		return
+	}
+	s.forEachSQLData(ctx, sql, args, onErr, forEach)
+}
+
+func (s *SQLReader) forEachSQLData(ctx context.Context, sql string, args []interface{}, onErr func(error), forEach func(d data.JSON)) {
+	if s.CountRows {
+		var total int64
+		err := util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry}.Run(ctx, s.readDB, func(ctx context.Context) error {
+			return s.readDB.QueryRowxContext(ctx, "SELECT COUNT(*) FROM ("+sql+") ratchet_count", args...).Scan(&total)
+		})
+		if err != nil {
+			onErr(err)
+			return
+		}
+		atomic.AddInt64(&s.rowsTotal, total)
 	}
 
 	logger.Debug("SQLReader: Running - ", sql)
 	// See sql.go
-	dataChan, err := util.GetDataFromSQLQuery(s.readDB, sql, s.BatchSize, s.StructDestination)
-	util.KillPipelineIfErr(err, killChan)
-
-	for d := range dataChan {
-		// First check if an error was returned back from the SQL processing
-		// helper, then if not call forEach with the received data.
-		var derr dataErr
-		if err := data.ParseJSONSilent(d, &derr); err == nil {
-			util.KillPipelineIfErr(errors.New(derr.Error), killChan)
-		} else {
+	sent := false
+	err := s.Retry.Do(ctx, s.readDB, func(ctx context.Context) error {
+		err := util.ForEachSQLQueryBatch(ctx, s.readDB, sql, args, s.FetchSize, s.BatchSize, s.Timeout, s.StructDestination, func(d data.JSON) error {
+			sent = true
+			if s.CountRows {
+				s.countRows(d)
+			}
+			if s.WatermarkColumn != "" {
+				s.trackWatermark(d)
+			}
 			forEach(d)
+			return nil
+		})
+		if err != nil && sent && s.Retry.MaxAttempts > 1 && util.IsRetryableSQLError(err) {
+			// Retrying would send the rows already read again.
+			return util.FatalError(err)
 		}
+		return err
+	})
+	if err != nil {
+		onErr(err)
+	}
+}
+
+func (s *SQLReader) countRows(d data.JSON) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err == nil {
+		atomic.AddInt64(&s.rowsRead, int64(len(objects)))
 	}
 }
 
+// Progress returns the number of rows read and the total number of rows
+// to read, if CountRows is set. See ratchet.ProgressSource.
+func (s *SQLReader) Progress() (done, total int64) {
+	return atomic.LoadInt64(&s.rowsRead), atomic.LoadInt64(&s.rowsTotal)
+}
+
 // Finish - see interface for documentation.
 func (s *SQLReader) Finish(outputChan chan data.JSON, killChan chan error) {
 }
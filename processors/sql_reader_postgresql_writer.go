@@ -1,6 +1,8 @@
 package processors
 
 import (
+	"context"
+
 	"github.com/jmoiron/sqlx"
 
 	"github.com/fefelovgroup/ratchet/data"
@@ -37,8 +39,14 @@ func NewDynamicSQLReaderPostgreSQLWriter(readConn *sqlx.DB, writeConn *sqlx.DB,
 
 // ProcessData uses SQLReader methods for processing data - this works via composition
 func (s *SQLReaderPostgreSQLWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
-	s.ForEachQueryData(d, killChan, func(d data.JSON) {
-		s.PostgreSQLWriter.ProcessData(d, outputChan, killChan)
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the query is cancelled
+// when ctx is done. See ratchet.ContextDataProcessor.
+func (s *SQLReaderPostgreSQLWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ForEachQueryDataCtx(ctx, d, killChan, func(d data.JSON) {
+		s.PostgreSQLWriter.ProcessDataCtx(ctx, d, outputChan, killChan)
 		outputChan <- d
 	})
 }
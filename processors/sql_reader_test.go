@@ -0,0 +1,138 @@
+package processors_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// received records the payloads it receives, and fails with err if it's
+// set.
+type received struct {
+	payloads []string
+	err      error
+}
+
+func (r *received) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	r.payloads = append(r.payloads, string(d))
+	if r.err != nil {
+		killChan <- r.err
+	}
+}
+
+func (r *received) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+// readOrders runs a Pipeline reading the orders updated since the
+// watermark saved in checkpoints into out, and returns its error.
+func readOrders(t *testing.T, db *sqlx.DB, checkpoints ratchet.CheckpointStore, out *received) error {
+	t.Helper()
+	reader := processors.NewSQLReader(db, "SELECT id, updated FROM orders WHERE updated > {{watermark}} ORDER BY updated")
+	reader.WatermarkColumn = "updated"
+	reader.InitialWatermark = 0
+	reader.Checkpoints = checkpoints
+	select {
+	case err := <-ratchet.NewPipeline(reader, out).Run():
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish")
+	}
+	return nil
+}
+
+func TestSQLReaderWatermark(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE orders (id INTEGER, updated INTEGER)",
+		"INSERT INTO orders VALUES (1, 10), (2, 30), (3, 20)")
+	checkpoints := ratchet.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	saved := func() interface{} {
+		var watermark interface{}
+		if _, err := checkpoints.Load("updated", &watermark); err != nil {
+			t.Fatal(err)
+		}
+		return watermark
+	}
+
+	// The first run reads everything after InitialWatermark, and saves
+	// the largest value read.
+	out := &received{}
+	if err := readOrders(t, db, checkpoints, out); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`[{"id":1,"updated":10},{"id":3,"updated":20},{"id":2,"updated":30}]`}; !reflect.DeepEqual(out.payloads, want) {
+		t.Errorf("got %v, want %v", out.payloads, want)
+	}
+	if got := saved(); got != 30.0 {
+		t.Errorf("got watermark %v, want 30", got)
+	}
+
+	// The next run only reads newer rows, but a failed run doesn't
+	// advance the watermark.
+	if _, err := db.Exec("INSERT INTO orders VALUES (4, 40)"); err != nil {
+		t.Fatal(err)
+	}
+	out = &received{err: errors.New("connection refused")}
+	if err := readOrders(t, db, checkpoints, out); err == nil {
+		t.Fatal("got no error from the failed run")
+	}
+	if want := []string{`[{"id":4,"updated":40}]`}; !reflect.DeepEqual(out.payloads, want) {
+		t.Errorf("got %v, want %v", out.payloads, want)
+	}
+	if got := saved(); got != 30.0 {
+		t.Errorf("got watermark %v after a failed run, want 30", got)
+	}
+
+	// So the row is read again by the next run.
+	out = &received{}
+	if err := readOrders(t, db, checkpoints, out); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`[{"id":4,"updated":40}]`}; !reflect.DeepEqual(out.payloads, want) {
+		t.Errorf("got %v, want %v", out.payloads, want)
+	}
+	if got := saved(); got != 40.0 {
+		t.Errorf("got watermark %v, want 40", got)
+	}
+
+	// A run reading no rows leaves the watermark as it is.
+	out = &received{}
+	if err := readOrders(t, db, checkpoints, out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.payloads) != 0 {
+		t.Errorf("got %v, want no rows", out.payloads)
+	}
+	if got := saved(); got != 40.0 {
+		t.Errorf("got watermark %v after reading no rows, want 40", got)
+	}
+}
+
+func TestSQLReaderWatermarkConfig(t *testing.T) {
+	db := openSQLite(t, "CREATE TABLE orders (id INTEGER, updated INTEGER)")
+	tests := []struct {
+		name        string
+		checkpoints ratchet.CheckpointStore
+		initial     interface{}
+	}{
+		{"no Checkpoints", nil, 0},
+		{"no InitialWatermark", ratchet.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json")), nil},
+	}
+	for _, test := range tests {
+		r := processors.NewSQLReader(db, "SELECT id, updated FROM orders WHERE updated > {{watermark}}")
+		r.WatermarkColumn = "updated"
+		r.Checkpoints = test.checkpoints
+		r.InitialWatermark = test.initial
+		killChan := make(chan error, 1)
+		r.ForEachQueryData(nil, killChan, func(d data.JSON) {})
+		if err := firstErr(killChan); util.ErrorCategoryOf(err) != util.CategoryConfigInvalid {
+			t.Errorf("%v: got %v, want a config error", test.name, err)
+		}
+	}
+}
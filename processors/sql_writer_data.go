@@ -1,5 +1,10 @@
 package processors
 
+import (
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
 // SQLWriterData is a custom data structure you can send into a MySQLWriter
 // stage or a PostreSQLWriter stage if you need to specify TableName on a
 // per-data payload basis. No extra configuration is needed to use
@@ -9,3 +14,37 @@ type SQLWriterData struct {
 	TableName  string      `json:"table_name"`
 	InsertData interface{} `json:"insert_data"`
 }
+
+// sqlWriterTarget returns the data to write and the table to write it to,
+// handling the SQLWriterData scenario.
+func sqlWriterTarget(d data.JSON, tableName string) (data.JSON, string, error) {
+	var wd SQLWriterData
+	err := data.ParseJSONSilent(d, &wd)
+	if err == nil && wd.TableName != "" && wd.InsertData != nil {
+		dd, err := data.NewJSON(wd.InsertData)
+		return dd, wd.TableName, err
+	}
+	return d, tableName, nil
+}
+
+// writeWithIDs writes the objects of d with write, which sets their
+// generated IDs, and then sends them on outputChan. This is how SQL writers
+// with an IDField pass records on, e.g. for child rows to refer to.
+func writeWithIDs(d data.JSON, outputChan chan data.JSON, write func(objects []map[string]interface{}) error) error {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	if err := write(objects); err != nil {
+		return err
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		return err
+	}
+	outputChan <- dd
+	return nil
+}
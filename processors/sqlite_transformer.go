@@ -0,0 +1,184 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SQLiteTransformer stages the records it receives in an in-memory SQLite
+// database and sends on the results of a query over them, so a pipeline
+// can use joins, aggregates and window functions without a database to
+// load into, e.g.
+//
+//	processors.NewSQLiteTransformer("sqlite", "orders",
+//		"SELECT country, count(*) AS orders, sum(total) AS total FROM orders GROUP BY country")
+//
+// Records are inserted into TableName, or for SQLWriterData, the table it
+// names, so records of several kinds can be joined. Tables are created from
+// the first records staged in them, and gain columns for new fields, with
+// types inferred as by util.CreateTableSQL. Objects and arrays are stored
+// as JSON text, to be read with SQLite's JSON functions, and booleans as 1
+// and 0.
+//
+// The query is run once every record has been staged, in Finish, and its
+// rows are sent on in batches of BatchSize (all at once if it's 0). If
+// PerPayload is set, it's run over each payload on its own instead. Either
+// way, the staged tables are dropped afterwards.
+//
+// The database is opened with driverName, which must be a registered
+// SQLite driver ("sqlite3" for github.com/mattn/go-sqlite3, or "sqlite" for
+// modernc.org/sqlite), and lives as long as the SQLiteTransformer: Close
+// releases it.
+type SQLiteTransformer struct {
+	TableName  string
+	Query      string
+	PerPayload bool
+	BatchSize  int
+
+	db     *sqlx.DB
+	tables map[string]bool
+}
+
+// NewSQLiteTransformer returns a new SQLiteTransformer staging records in
+// tableName, with an in-memory database opened with driverName.
+func NewSQLiteTransformer(driverName, tableName, query string) (*SQLiteTransformer, error) {
+	if dialect, err := util.DialectFor(driverName); err != nil || dialect != util.SQLite {
+		return nil, util.ConfigErrorf("SQLiteTransformer: %q isn't a SQLite driver", driverName)
+	}
+	if err := util.ValidateSQLTableName(tableName); err != nil {
+		return nil, err
+	}
+	if query == "" {
+		return nil, util.ConfigErrorf("SQLiteTransformer: query is required")
+	}
+	db, err := sqlx.Open(driverName, ":memory:")
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	// Each connection to :memory: is a database of its own.
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return &SQLiteTransformer{TableName: tableName, Query: query, db: db}, nil
+}
+
+// ProcessData stages the payload's records, and with PerPayload, sends on
+// the results of the query over them.
+func (t *SQLiteTransformer) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	d, tableName, err := sqlWriterTarget(d, t.TableName)
+	util.KillPipelineIfErr(err, killChan)
+	err = t.stage(d, tableName)
+	util.KillPipelineIfErr(err, killChan)
+	if t.PerPayload {
+		err = t.run(outputChan)
+		util.KillPipelineIfErr(err, killChan)
+	}
+}
+
+// Finish sends on the results of the query over every record staged,
+// unless PerPayload is set.
+func (t *SQLiteTransformer) Finish(outputChan chan data.JSON, killChan chan error) {
+	if !t.PerPayload {
+		err := t.run(outputChan)
+		util.KillPipelineIfErr(err, killChan)
+	}
+}
+
+func (t *SQLiteTransformer) stage(d data.JSON, tableName string) error {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return util.DataInvalidError(err)
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	objects, err = sqliteStagedObjects(objects)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if !t.tables[tableName] {
+		createSQL, err := util.CreateTableSQL(objects, tableName, util.SQLite)
+		if err != nil {
+			return err
+		}
+		if _, err := t.db.ExecContext(ctx, createSQL); err != nil {
+			return err
+		}
+		if t.tables == nil {
+			t.tables = map[string]bool{}
+		}
+		t.tables[tableName] = true
+	}
+	return util.SQLiteInsertObjectsContext(ctx, t.db, objects, util.SQLiteInsertOptions{
+		TableName:  tableName,
+		AddColumns: true,
+	})
+}
+
+// sqliteStagedObjects returns objects with their objects and arrays
+// encoded as JSON text, which is how SQLite stores them.
+func sqliteStagedObjects(objects []map[string]interface{}) ([]map[string]interface{}, error) {
+	staged := make([]map[string]interface{}, len(objects))
+	for i, o := range objects {
+		so := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			switch v.(type) {
+			case map[string]interface{}, []interface{}:
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, util.DataInvalidError(err)
+				}
+				v = string(b)
+			}
+			so[k] = v
+		}
+		staged[i] = so
+	}
+	return staged, nil
+}
+
+// run sends on the results of the query, and then drops the staged tables
+// to start again.
+func (t *SQLiteTransformer) run(outputChan chan data.JSON) error {
+	if len(t.tables) == 0 {
+		return nil
+	}
+	logger.Info("SQLiteTransformer: running query over", len(t.tables), "table(s)")
+	err := util.ForEachSQLQueryBatch(context.Background(), t.db, t.Query, nil, 0, t.BatchSize, 0, nil, func(d data.JSON) error {
+		outputChan <- d
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tables := make([]string, 0, len(t.tables))
+	for table := range t.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		if _, err := t.db.Exec("DROP TABLE " + table); err != nil {
+			return err
+		}
+	}
+	t.tables = nil
+	return nil
+}
+
+// Close closes the in-memory database.
+func (t *SQLiteTransformer) Close() error {
+	return t.db.Close()
+}
+
+func (t *SQLiteTransformer) String() string {
+	return "SQLiteTransformer"
+}
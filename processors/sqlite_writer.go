@@ -1,7 +1,13 @@
 package processors
 
 import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/fefelovgroup/ratchet"
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
 	"github.com/fefelovgroup/ratchet/util"
@@ -17,6 +23,63 @@ import (
 //
 // For use-cases where a SQLiteWriter instance needs to write to
 // multiple tables you can pass in SQLWriterData.
+//
+// Each data payload is written within a single transaction. Set
+// UseSavepoints so that a failing batch is rolled back on its own and
+// handed to OnBatchError (e.g. to dead-letter it) while the rest of the
+// payload still commits.
+//
+// Set DeadLetter to handle bad records individually instead of halting
+// the pipeline: when a batch fails, its records are retried one at a time
+// and those that still fail are sent to the DeadLetter DataProcessor (e.g.
+// a JSONLinesWriter, another SQLiteWriter or a ratchet.NamedOutput) as
+// {"record": <record>, "error": "<error>"}, while good records are
+// written as normal.
+//
+// Records are INSERTed by default. Set Mode to util.SQLOpUpdate or
+// util.SQLOpDelete to update or delete the rows matching their
+// PrimaryKeys instead, or OpField to read each record's operation from
+// that field (e.g. {"op": "delete", "id": 1}), to apply a stream of
+// changes. See util.SQLiteInsertOptions.
+//
+// Set IDField to the table's INTEGER PRIMARY KEY to send the records
+// inserted on with the rowids generated for them, so a later stage can
+// load child rows referring to them. Rows are then inserted one at a
+// time, see util.SQLiteInsertOptions.
+//
+// The target may also be a view with INSTEAD OF triggers. Views are
+// detected automatically, and since the driver can't report meaningful
+// results for them, a successful INSERT is treated as success.
+//
+// Set LoadStrategy to replace the tables' rows rather than add to them:
+// util.SQLLoadTruncate empties each table before writing to it, while
+// util.SQLLoadSwap writes to a staging table and swaps its rows into the
+// table when the SQLiteWriter is finished, so consumers never see a partially
+// loaded table.
+//
+// Set AddColumns to add a column to the table for each new field found in
+// the records before writing them, so an evolving upstream schema doesn't
+// break the load. See util.SQLiteAddColumns.
+//
+// Table and column names are validated before they're written into
+// statements. Set AllowedColumns to also fail records with fields that
+// aren't listed, or IncludeColumns or ExcludeColumns to drop the fields
+// the table has no columns for instead.
+//
+// The SQLiteWriter counts the rows it inserts, updates, leaves unchanged
+// and deletes, and reports them in the Pipeline's stats (see
+// ratchet.CounterSource) and logs them when it's finished. Upserts look
+// up the existing rows of each batch to tell them apart, see
+// util.SQLiteInsertOptions.Counts.
+//
+// Set Maintenance to run ANALYZE, REINDEX, VACUUM or other statements on
+// the tables written to once the load is complete, when the SQLiteWriter
+// is finished. See util.SQLiteMaintain.
+//
+// Set Attach to attach other database files, by schema name, and write to
+// their tables as schema.table, e.g. with a TableName or SQLWriterData
+// per tenant. The SQLiteWriter's database is then limited to a single
+// connection, see util.SQLiteAttach.
 type SQLiteWriter struct {
 	writeDB          *sqlx.DB
 	TableName        string
@@ -25,6 +88,60 @@ type SQLiteWriter struct {
 	PreservedFields  []string
 	ConcurrencyLevel int // See ConcurrentDataProcessor
 	BatchSize        int
+	// AdaptiveBatchSize, if set, adjusts the size of the batches written
+	// to how long they take and whether they fail, instead of using
+	// BatchSize. See util.AdaptiveBatchSize.
+	AdaptiveBatchSize *util.AdaptiveBatchSize
+	// Set to true to never check INSERT results, see util.SQLiteInsertOptions.
+	SkipResultCheck bool
+	UseSavepoints   bool
+	// OnBatchError receives the failed batch when UseSavepoints is set.
+	// Return nil to continue writing, or an error to halt the pipeline.
+	// If not set, a failed batch halts the pipeline.
+	OnBatchError func(batch data.JSON, err error) error
+	// DeadLetter receives records that fail to be written. Anything it
+	// sends on is sent on by the SQLiteWriter, and it is finished when the
+	// SQLiteWriter is finished.
+	DeadLetter      ratchet.DataProcessor
+	deadLetterMutex sync.Mutex
+	views           map[string]bool
+	viewsMutex      sync.Mutex
+	// Timeout limits each INSERT, so a hung database fails the Pipeline
+	// instead of blocking it. See util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries each payload (which is written in a single transaction) that fails with a retryable error, such
+	// as a lost connection or a deadlock. See util.SQLRetry.
+	Retry util.SQLRetry
+	// Mode and OpField choose the operation applied to each record, see
+	// util.SQLiteInsertOptions.
+	Mode    string
+	OpField string
+	// IDField is set in each record to the rowid generated for it, and the
+	// records are sent on. Records handled by DeadLetter or OnBatchError
+	// are sent on too, without an ID. See util.SQLiteInsertOptions.
+	IDField string
+	// LoadStrategy decides what happens to the rows already in the
+	// tables written to: util.SQLLoadAppend (the default),
+	// util.SQLLoadTruncate or util.SQLLoadSwap. See util.PrepareSQLLoad.
+	LoadStrategy string
+	load         sqlLoad
+	// AddColumns adds missing columns to the tables written to. It can't
+	// be used with util.SQLLoadSwap.
+	AddColumns bool
+	// AllowedColumns are the only fields records may have, if set. See
+	// util.SQLiteInsertOptions.
+	AllowedColumns []string
+	// IncludeColumns are the only fields written, if set, and
+	// ExcludeColumns are never written. See util.SQLiteInsertOptions.
+	IncludeColumns []string
+	ExcludeColumns []string
+	counts         util.SQLWriteCounts
+	// Maintenance is run on the tables written to when finished.
+	Maintenance util.SQLiteMaintenance
+	tables      map[string]bool
+	tablesMutex sync.Mutex
+	// Attach are the database files attached, by schema name.
+	Attach map[string]string
 }
 
 // NewSQLiteWriter returns a new SQLiteWriter
@@ -34,6 +151,12 @@ func NewSQLiteWriter(db *sqlx.DB, tableName string) *SQLiteWriter {
 
 // ProcessData defers to util.SQLiteInsertData
 func (s *SQLiteWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the transaction is rolled
+// back if ctx is done before it commits. See ratchet.ContextDataProcessor.
+func (s *SQLiteWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
 	// handle panics a bit more gracefully
 	defer func() {
 		if err := recover(); err != nil {
@@ -41,26 +164,179 @@ func (s *SQLiteWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killC
 		}
 	}()
 
-	// First check for SQLWriterData
-	var wd SQLWriterData
-	err := data.ParseJSON(d, &wd)
 	logger.Info("SQLiteWriter: Writing data...")
-	if err == nil && wd.TableName != "" && wd.InsertData != nil {
-		logger.Debug("SQLiteWriter: SQLWriterData scenario")
-		dd, err := data.NewJSON(wd.InsertData)
-		util.KillPipelineIfErr(err, killChan)
-		err = util.SQLiteInsertData(s.writeDB, dd, wd.TableName, s.OnDupKeyUpdate, s.PrimaryKeys, s.PreservedFields, s.BatchSize)
-		util.KillPipelineIfErr(err, killChan)
-	} else {
-		logger.Debug("SQLiteWriter: normal data scenario")
-		err = util.SQLiteInsertData(s.writeDB, d, s.TableName, s.OnDupKeyUpdate, s.PrimaryKeys, s.PreservedFields, s.BatchSize)
-		util.KillPipelineIfErr(err, killChan)
-	}
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	util.KillPipelineIfErr(err, killChan)
+	err = s.insert(ctx, d, tableName, outputChan)
+	util.KillPipelineIfErr(err, killChan)
 	logger.Info("SQLiteWriter: Write complete")
 }
 
-// Finish - see interface for documentation.
+func (s *SQLiteWriter) insert(ctx context.Context, d data.JSON, tableName string, outputChan chan data.JSON) error {
+	if s.AddColumns && s.LoadStrategy == util.SQLLoadSwap {
+		return util.ConfigErrorf("SQLiteWriter: AddColumns can't be used with the swap load strategy")
+	}
+	if len(s.Attach) > 0 {
+		if err := util.SQLiteAttach(ctx, s.writeDB, s.Attach); err != nil {
+			return err
+		}
+	}
+	if !s.Maintenance.IsZero() {
+		s.tablesMutex.Lock()
+		if s.tables == nil {
+			s.tables = map[string]bool{}
+		}
+		s.tables[tableName] = true
+		s.tablesMutex.Unlock()
+	}
+	tableName, err := s.load.table(ctx, s.writeDB, s.LoadStrategy, tableName, util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry})
+	if err != nil {
+		return err
+	}
+	opts := util.SQLiteInsertOptions{
+		TableName:         tableName,
+		OnDupKeyUpdate:    s.OnDupKeyUpdate,
+		PrimaryKeys:       s.PrimaryKeys,
+		PreservedFields:   s.PreservedFields,
+		BatchSize:         s.BatchSize,
+		AdaptiveBatchSize: s.AdaptiveBatchSize,
+		SkipResultCheck:   s.SkipResultCheck,
+		UseSavepoints:     s.UseSavepoints,
+		Timeout:           s.Timeout,
+		Retry:             s.Retry,
+		Mode:              s.Mode,
+		OpField:           s.OpField,
+		IDField:           s.IDField,
+		AddColumns:        s.AddColumns,
+		AllowedColumns:    s.AllowedColumns,
+		IncludeColumns:    s.IncludeColumns,
+		ExcludeColumns:    s.ExcludeColumns,
+		Counts:            &s.counts,
+	}
+	if s.OnBatchError != nil {
+		opts.OnBatchError = func(batch []map[string]interface{}, err error) error {
+			d, jerr := data.NewJSON(batch)
+			if jerr != nil {
+				return jerr
+			}
+			return s.OnBatchError(d, err)
+		}
+	}
+	if s.DeadLetter != nil {
+		opts.OnRecordError = func(record map[string]interface{}, err error) error {
+			logger.Info("SQLiteWriter: sending record to dead letter -", err)
+			d, jerr := deadLetterJSON(record, err)
+			if jerr != nil {
+				return jerr
+			}
+			s.deadLetterMutex.Lock()
+			defer s.deadLetterMutex.Unlock()
+			return processDataErr(s.DeadLetter, d, outputChan)
+		}
+	}
+	if !opts.SkipResultCheck {
+		isView, err := s.isView(tableName)
+		if err != nil {
+			return err
+		}
+		opts.SkipResultCheck = isView
+	}
+	if s.IDField != "" {
+		return writeWithIDs(d, outputChan, func(objects []map[string]interface{}) error {
+			return util.SQLiteInsertObjectsContext(ctx, s.writeDB, objects, opts)
+		})
+	}
+	return util.SQLiteInsertDataWithOptionsContext(ctx, s.writeDB, d, opts)
+}
+
+// DryRun returns the INSERT (or UPDATE and DELETE) statements ProcessData
+// would execute. See ratchet.DryRunner.
+func (s *SQLiteWriter) DryRun(d data.JSON) ([]ratchet.DryRunWrite, error) {
+	d, tableName, err := sqlWriterTarget(d, s.TableName)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := util.SQLiteInsertSQL(d, util.SQLiteInsertOptions{
+		TableName:       tableName,
+		OnDupKeyUpdate:  s.OnDupKeyUpdate,
+		PrimaryKeys:     s.PrimaryKeys,
+		PreservedFields: s.PreservedFields,
+		BatchSize:       s.BatchSize,
+		Mode:            s.Mode,
+		OpField:         s.OpField,
+		AllowedColumns:  s.AllowedColumns,
+		IncludeColumns:  s.IncludeColumns,
+		ExcludeColumns:  s.ExcludeColumns,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []ratchet.DryRunWrite{{Target: tableName, Statements: statements}}, nil
+}
+
+// isView caches the result of util.SQLiteIsView for each table written to.
+func (s *SQLiteWriter) isView(tableName string) (bool, error) {
+	s.viewsMutex.Lock()
+	defer s.viewsMutex.Unlock()
+	if isView, ok := s.views[tableName]; ok {
+		return isView, nil
+	}
+	isView, err := util.SQLiteIsView(s.writeDB, tableName)
+	if err != nil {
+		return false, err
+	}
+	if s.views == nil {
+		s.views = make(map[string]bool)
+	}
+	s.views[tableName] = isView
+	return isView, nil
+}
+
+// Finish completes the load of the tables written to (see LoadStrategy),
+// runs their Maintenance, logs the rows written and finishes the
+// DeadLetter.
 func (s *SQLiteWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	if len(s.Attach) > 0 {
+		err := util.SQLiteAttach(context.Background(), s.writeDB, s.Attach)
+		util.KillPipelineIfErr(err, killChan)
+	}
+	err := s.load.finish(s.writeDB, s.LoadStrategy, util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry})
+	util.KillPipelineIfErr(err, killChan)
+	err = s.maintain()
+	util.KillPipelineIfErr(err, killChan)
+	logger.Info("SQLiteWriter: rows", s.counts.Load())
+	if s.DeadLetter != nil {
+		s.DeadLetter.Finish(outputChan, killChan)
+	}
+}
+
+// maintain runs Maintenance on the tables written to (rather than views),
+// and starts again in case the SQLiteWriter is reused.
+func (s *SQLiteWriter) maintain() error {
+	s.tablesMutex.Lock()
+	defer s.tablesMutex.Unlock()
+	defer func() { s.tables = nil }()
+	var tables []string
+	for t := range s.tables {
+		isView, err := s.isView(t)
+		if err != nil {
+			return err
+		}
+		if !isView {
+			tables = append(tables, t)
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	sort.Strings(tables)
+	return util.SQLiteMaintain(context.Background(), s.writeDB, tables, s.Maintenance)
+}
+
+// Counters returns the number of rows inserted, updated, left unchanged
+// and deleted so far. See ratchet.CounterSource.
+func (s *SQLiteWriter) Counters() map[string]int64 {
+	return s.counts.Load().Map()
 }
 
 func (s *SQLiteWriter) String() string {
@@ -0,0 +1,466 @@
+package processors_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// openSQLite opens an in-memory database with a users table, and runs the
+// given statements on it.
+func openSQLite(t *testing.T, statements ...string) *sqlx.DB {
+	t.Helper()
+	logger.LogLevel = logger.LevelSilent
+
+	db, err := sqlx.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each connection has its own in-memory database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	statements = append([]string{"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, visits INTEGER)"}, statements...)
+	for _, st := range statements {
+		if _, err := db.Exec(st); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// process calls w.ProcessData with each payload, and returns what it sends
+// on and the first error it sends on its killChan.
+func process(w *processors.SQLiteWriter, payloads ...string) ([]string, error) {
+	outputChan := make(chan data.JSON, len(payloads))
+	killChan := make(chan error, 2*len(payloads))
+	for _, p := range payloads {
+		w.ProcessData(data.JSON(p), outputChan, killChan)
+	}
+	close(outputChan)
+	var out []string
+	for d := range outputChan {
+		out = append(out, string(d))
+	}
+	return out, firstErr(killChan)
+}
+
+// finish calls w.Finish, and returns the first error it sends on its
+// killChan.
+func finish(w *processors.SQLiteWriter) error {
+	killChan := make(chan error, 4)
+	w.Finish(make(chan data.JSON, 1), killChan)
+	return firstErr(killChan)
+}
+
+func firstErr(killChan chan error) error {
+	select {
+	case err := <-killChan:
+		return err
+	default:
+		return nil
+	}
+}
+
+// users returns the rows of table as "id:name:visits", ordered by id.
+func users(t *testing.T, db *sqlx.DB, table string) string {
+	t.Helper()
+	var rows string
+	err := db.Get(&rows, "SELECT ifnull(group_concat(row, ' '), '') FROM "+
+		"(SELECT id || ':' || name || ':' || ifnull(visits, '') AS row FROM "+table+" ORDER BY id)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestSQLiteWriterLoadStrategies(t *testing.T) {
+	seed := "INSERT INTO users VALUES (1, 'a', 5), (2, 'b', 3)"
+	records := `[{"id":2,"name":"B"},{"id":3,"name":"c"}]`
+	tests := []struct {
+		name     string
+		strategy string
+		upsert   bool
+		want     string
+	}{
+		{"insert", util.SQLLoadAppend, false, "1:a:5 2:b:3"},
+		{"upsert", util.SQLLoadAppend, true, "1:a:5 2:B: 3:c:"},
+		{"truncate", util.SQLLoadTruncate, false, "2:B: 3:c:"},
+		{"swap", util.SQLLoadSwap, false, "2:B: 3:c:"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openSQLite(t, seed)
+			w := processors.NewSQLiteWriter(db, "users")
+			w.OnDupKeyUpdate = test.upsert
+			w.LoadStrategy = test.strategy
+			_, err := process(w, records)
+			if test.name == "insert" {
+				// The existing row with id 2 fails the INSERT.
+				if err == nil {
+					t.Error("got no error inserting an existing row")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if test.strategy == util.SQLLoadSwap {
+				if got := users(t, db, "users"); got != "1:a:5 2:b:3" {
+					t.Errorf("got %q before swapping, want the rows the table had", got)
+				}
+			}
+			if err := finish(w); err != nil {
+				t.Fatal(err)
+			}
+			if got := users(t, db, "users"); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteWriterPreservedFields(t *testing.T) {
+	db := openSQLite(t, "INSERT INTO users VALUES (1, 'a', 5)")
+	w := processors.NewSQLiteWriter(db, "users")
+	w.PrimaryKeys = []string{"id"}
+	w.PreservedFields = []string{"visits"}
+	if _, err := process(w, `[{"id":1,"name":"A","visits":0},{"id":2,"name":"b","visits":0}]`); err != nil {
+		t.Fatal(err)
+	}
+	// New rows get the column's default rather than the record's value.
+	if got, want := users(t, db, "users"), "1:A:5 2:b:"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// Each batch of 2 records is written in its own savepoint, and the batch
+// with the NULL name is rolled back.
+const batches = `[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":3,"name":null},{"id":4,"name":"d"},{"id":5,"name":"e"}]`
+
+func TestSQLiteWriterSavepoints(t *testing.T) {
+	db := openSQLite(t)
+	w := processors.NewSQLiteWriter(db, "users")
+	w.BatchSize = 2
+	w.UseSavepoints = true
+	var failed []string
+	w.OnBatchError = func(batch data.JSON, err error) error {
+		failed = append(failed, string(batch))
+		return nil
+	}
+	if _, err := process(w, batches); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := users(t, db, "users"), "1:a: 2:b: 5:e:"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	want := []string{`[{"id":3,"name":null},{"id":4,"name":"d"}]`}
+	if !reflect.DeepEqual(failed, want) {
+		t.Errorf("got failed batches %v, want %v", failed, want)
+	}
+
+	// Without OnBatchError, a failed batch rolls back the payload.
+	db = openSQLite(t)
+	w = processors.NewSQLiteWriter(db, "users")
+	w.BatchSize = 2
+	w.UseSavepoints = true
+	if _, err := process(w, batches); err == nil {
+		t.Error("got no error without OnBatchError")
+	}
+	if got := users(t, db, "users"); got != "" {
+		t.Errorf("got %q, want no rows", got)
+	}
+}
+
+// deadLetters records the payloads it's sent.
+type deadLetters struct {
+	payloads []string
+	finished bool
+}
+
+func (l *deadLetters) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	l.payloads = append(l.payloads, string(d))
+}
+
+func (l *deadLetters) Finish(outputChan chan data.JSON, killChan chan error) {
+	l.finished = true
+}
+
+func TestSQLiteWriterDeadLetter(t *testing.T) {
+	db := openSQLite(t)
+	w := processors.NewSQLiteWriter(db, "users")
+	w.BatchSize = 2
+	dead := &deadLetters{}
+	w.DeadLetter = dead
+	if _, err := process(w, batches); err != nil {
+		t.Fatal(err)
+	}
+	if err := finish(w); err != nil {
+		t.Fatal(err)
+	}
+	// Only the bad record is dead-lettered, the rest of its batch is written.
+	if got, want := users(t, db, "users"), "1:a: 2:b: 4:d: 5:e:"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(dead.payloads) != 1 || !strings.HasPrefix(dead.payloads[0], `{"error":"`) ||
+		!strings.HasSuffix(dead.payloads[0], `"record":{"id":3,"name":null}}`) {
+		t.Errorf("got dead letters %v, want the record with id 3 and its error", dead.payloads)
+	}
+	if !dead.finished {
+		t.Error("the DeadLetter wasn't finished")
+	}
+}
+
+func TestSQLiteWriterForwardingDeadLetter(t *testing.T) {
+	db := openSQLite(t)
+	w := processors.NewSQLiteWriter(db, "users")
+	w.DeadLetter = processors.NewPassthrough()
+	done := make(chan struct{})
+	var out []string
+	var err error
+	go func() {
+		out, err = process(w, batches)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the DeadLetter couldn't send on the record")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || !strings.HasSuffix(out[0], `"record":{"id":3,"name":null}}`) {
+		t.Errorf("got %v, want the dead letter of the record with id 3", out)
+	}
+}
+
+func TestSQLiteWriterOps(t *testing.T) {
+	seed := "INSERT INTO users VALUES (1, 'a', 5), (2, 'b', 3)"
+	tests := []struct {
+		name    string
+		mode    string
+		opField string
+		records string
+		want    string
+		counts  util.SQLWriteCounts
+	}{
+		{"update", util.SQLOpUpdate, "", `[{"id":1,"name":"A"},{"id":3,"name":"c"}]`, "1:A:5 2:b:3", util.SQLWriteCounts{Updated: 1}},
+		{"delete", util.SQLOpDelete, "", `[{"id":1},{"id":3}]`, "2:b:3", util.SQLWriteCounts{Deleted: 1}},
+		{"op field", "", "op", `[{"op":"c","id":3,"name":"c"},{"op":"u","id":1,"name":"A"},{"op":"delete","id":2}]`,
+			"1:A:5 3:c:", util.SQLWriteCounts{Inserted: 1, Updated: 1, Deleted: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openSQLite(t, seed)
+			w := processors.NewSQLiteWriter(db, "users")
+			w.OnDupKeyUpdate = false
+			w.PrimaryKeys = []string{"id"}
+			w.Mode = test.mode
+			w.OpField = test.opField
+			if _, err := process(w, test.records); err != nil {
+				t.Fatal(err)
+			}
+			if got := users(t, db, "users"); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if got := w.Counters(); !reflect.DeepEqual(got, test.counts.Map()) {
+				t.Errorf("got counts %v, want %v", got, test.counts.Map())
+			}
+		})
+	}
+
+	w := processors.NewSQLiteWriter(openSQLite(t), "users")
+	w.Mode = util.SQLOpDelete
+	if _, err := process(w, `{"id":1}`); err == nil {
+		t.Error("got no error deleting without PrimaryKeys")
+	}
+}
+
+func TestSQLiteWriterIDs(t *testing.T) {
+	db := openSQLite(t, "INSERT INTO users VALUES (7, 'a', NULL)")
+	w := processors.NewSQLiteWriter(db, "users")
+	w.IDField = "id"
+	out, err := process(w, `[{"name":"b"},{"name":"c"}]`, `{"id":20,"name":"d"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`[{"id":8,"name":"b"},{"id":9,"name":"c"}]`, `{"id":20,"name":"d"}`}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+	if got, want := users(t, db, "users"), "7:a: 8:b: 9:c: 20:d:"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSQLiteWriterCounts(t *testing.T) {
+	db := openSQLite(t, "INSERT INTO users VALUES (1, 'a', 5), (2, 'b', 3)")
+	w := processors.NewSQLiteWriter(db, "users")
+	w.PrimaryKeys = []string{"id"}
+	w.PreservedFields = []string{"visits"}
+	// Row 1 is unchanged (its visits are preserved), row 2 updated and row
+	// 3 inserted.
+	if _, err := process(w, `[{"id":1,"name":"a","visits":0},{"id":2,"name":"B"},{"id":3,"name":"c"}]`); err != nil {
+		t.Fatal(err)
+	}
+	want := util.SQLWriteCounts{Inserted: 1, Updated: 1, Unchanged: 1}.Map()
+	if got := w.Counters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got counts %v, want %v", got, want)
+	}
+
+	// A rolled back batch isn't counted.
+	db = openSQLite(t)
+	w = processors.NewSQLiteWriter(db, "users")
+	w.BatchSize = 2
+	w.UseSavepoints = true
+	w.OnBatchError = func(batch data.JSON, err error) error { return nil }
+	if _, err := process(w, batches); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Counters()["inserted"]; got != 3 {
+		t.Errorf("got %d rows inserted, want 3", got)
+	}
+}
+
+func TestSQLiteWriterColumns(t *testing.T) {
+	record := `{"id":1,"name":"a","email":"a@example.com"}`
+	tests := []struct {
+		name   string
+		setup  func(w *processors.SQLiteWriter)
+		query  string
+		want   string
+		failed bool
+	}{
+		{"unknown column", func(w *processors.SQLiteWriter) {}, "", "", true},
+		{"allowed", func(w *processors.SQLiteWriter) { w.AllowedColumns = []string{"id", "name"} }, "", "", true},
+		{"include", func(w *processors.SQLiteWriter) { w.IncludeColumns = []string{"id", "name"} }, "SELECT name FROM users", "a", false},
+		{"exclude", func(w *processors.SQLiteWriter) { w.ExcludeColumns = []string{"email"} }, "SELECT name FROM users", "a", false},
+		{"add columns", func(w *processors.SQLiteWriter) { w.AddColumns = true }, "SELECT email FROM users", "a@example.com", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := openSQLite(t)
+			w := processors.NewSQLiteWriter(db, "users")
+			test.setup(w)
+			_, err := process(w, record)
+			if test.failed {
+				if err == nil {
+					t.Error("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			if err := db.Get(&got, test.query); err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	w := processors.NewSQLiteWriter(openSQLite(t), "users")
+	w.AddColumns = true
+	w.LoadStrategy = util.SQLLoadSwap
+	if _, err := process(w, record); util.ErrorCategoryOf(err) != util.CategoryConfigInvalid {
+		t.Errorf("got %v, want a config error using AddColumns with swap", err)
+	}
+	w = processors.NewSQLiteWriter(openSQLite(t), "users")
+	if _, err := process(w, `{"id":1,"name; DROP TABLE users":"a"}`); err == nil {
+		t.Error("got no error for an invalid column name")
+	}
+}
+
+func TestSQLiteWriterMaintenance(t *testing.T) {
+	db := openSQLite(t, "CREATE INDEX users_name ON users (name)")
+	w := processors.NewSQLiteWriter(db, "users")
+	w.Maintenance = util.SQLiteMaintenance{
+		Statements: []string{"CREATE TABLE user_count AS SELECT count(*) AS n FROM users"},
+		Reindex:    true,
+		Analyze:    true,
+		Vacuum:     true,
+	}
+	if _, err := process(w, `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.Get(&n, "SELECT count(*) FROM sqlite_master WHERE name = 'user_count'"); err != nil || n != 0 {
+		t.Fatalf("maintenance ran before the SQLiteWriter was finished (%v)", err)
+	}
+	if err := finish(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&n, "SELECT n FROM user_count"); err != nil || n != 2 {
+		t.Errorf("got user_count %d (%v), want 2", n, err)
+	}
+	if err := db.Get(&n, "SELECT count(*) FROM sqlite_stat1 WHERE tbl = 'users'"); err != nil || n == 0 {
+		t.Errorf("users wasn't analyzed (%v)", err)
+	}
+}
+
+func TestSQLiteWriterAttach(t *testing.T) {
+	db := openSQLite(t)
+	attach := map[string]string{"archive": filepath.Join(t.TempDir(), "archive.db")}
+	if err := util.SQLiteAttach(context.Background(), db, attach); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE archive.users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, visits INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := processors.NewSQLiteWriter(db, "users")
+	w.Attach = attach
+	w.LoadStrategy = util.SQLLoadSwap
+	_, err := process(w, `{"id":1,"name":"a"}`,
+		`{"table_name":"archive.users","insert_data":[{"id":2,"name":"b"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := finish(w); err != nil {
+		t.Fatal(err)
+	}
+	if got := users(t, db, "main.users"); got != "1:a:" {
+		t.Errorf("got %q in main.users, want 1:a:", got)
+	}
+	if got := users(t, db, "archive.users"); got != "2:b:" {
+		t.Errorf("got %q in archive.users, want 2:b:", got)
+	}
+}
+
+func TestSQLiteWriterAdaptiveBatchSize(t *testing.T) {
+	db := openSQLite(t)
+	w := processors.NewSQLiteWriter(db, "users")
+	w.AdaptiveBatchSize = util.NewAdaptiveBatchSize(4, 1, 8, time.Second)
+	w.UseSavepoints = true
+	// Every record fails, so each batch is handed to OnBatchError.
+	var sizes []int
+	w.OnBatchError = func(batch data.JSON, err error) error {
+		objects, _ := data.ObjectsFromJSON(batch)
+		sizes = append(sizes, len(objects))
+		return nil
+	}
+	records := make([]string, 20)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"id":%d,"name":null}`, i+1)
+	}
+	if _, err := process(w, "["+strings.Join(records, ",")+"]"); err != nil {
+		t.Fatal(err)
+	}
+	// The batches handled grow, rather than being BatchSize.
+	if want := []int{4, 6, 8, 2}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("got batches of %v, want %v", sizes, want)
+	}
+}
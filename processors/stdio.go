@@ -0,0 +1,190 @@
+package processors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// StdioFraming controls how StdinReader and StdoutWriter split data.
+type StdioFraming int
+
+const (
+	// FrameNDJSON reads and writes newline delimited JSON, one object per
+	// line. StdinReader sends the objects as arrays of up to BatchSize.
+	FrameNDJSON StdioFraming = iota
+	// FrameLines reads and writes each payload as a line of text, which
+	// doesn't have to be JSON.
+	FrameLines
+	// FrameWhole reads all of stdin as a single payload, and writes
+	// payloads as they are.
+	FrameWhole
+)
+
+// StdinReader reads data from stdin, so pipelines can be composed with
+// Unix pipes and used in shell-based job runners, e.g.
+// `zcat orders.json.gz | my-pipeline | jq .`.
+//
+// With FrameNDJSON, the objects read so far are sent as soon as stdin has
+// no more data ready, without waiting for a full batch, so a slow or
+// interactive producer (such as tail -f) doesn't hold records back.
+type StdinReader struct {
+	Framing   StdioFraming
+	BatchSize int       // Defaults to 1000
+	Stdin     io.Reader // Defaults to os.Stdin
+}
+
+// NewStdinReader returns a new StdinReader of newline delimited JSON.
+func NewStdinReader() *StdinReader {
+	return &StdinReader{Framing: FrameNDJSON, BatchSize: 1000}
+}
+
+// ProcessData reads stdin, sending the data to outputChan.
+func (r *StdinReader) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	in := r.Stdin
+	if in == nil {
+		in = os.Stdin
+	}
+	switch r.Framing {
+	case FrameWhole:
+		b, err := ioutil.ReadAll(in)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			outputChan <- data.JSON(b)
+		}
+		return
+	case FrameLines:
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			outputChan <- data.JSON(append([]byte(nil), scanner.Bytes()...))
+		}
+		util.KillPipelineIfErr(scanner.Err(), killChan)
+		return
+	}
+
+	reader := bufio.NewReader(in)
+	var batch []json.RawMessage
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		dd, err := data.NewJSON(batch)
+		batch = nil
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		outputChan <- dd
+	}
+	lineNum := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		lineNum++
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if !json.Valid(line) {
+				util.KillPipelineIfErr(util.DataErrorf("StdinReader: invalid JSON on line %d", lineNum), killChan)
+				return
+			}
+			batch = append(batch, json.RawMessage(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if (r.BatchSize > 0 && len(batch) >= r.BatchSize) || reader.Buffered() == 0 {
+			flush()
+		}
+	}
+	flush()
+}
+
+// Finish - see interface for documentation.
+func (r *StdinReader) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (r *StdinReader) String() string {
+	return "StdinReader"
+}
+
+// StdoutWriter writes data to stdout, see StdinReader. With FrameNDJSON,
+// each object is written on its own line, as by JSONLinesWriter.
+//
+// If stdout is a pipe that's closed early (e.g. by head), Go programs exit
+// with SIGPIPE, like other Unix tools. If SIGPIPE is handled instead (see
+// os/signal), the rest of the data is discarded rather than killing the
+// pipeline.
+type StdoutWriter struct {
+	Framing StdioFraming
+	Stdout  io.Writer // Defaults to os.Stdout
+
+	closed bool
+}
+
+// NewStdoutWriter returns a new StdoutWriter of newline delimited JSON.
+func NewStdoutWriter() *StdoutWriter {
+	return &StdoutWriter{Framing: FrameNDJSON}
+}
+
+// ProcessData writes the data to stdout.
+func (w *StdoutWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if w.closed {
+		return
+	}
+	out := w.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	var err error
+	switch w.Framing {
+	case FrameNDJSON:
+		err = processDataErr(NewJSONLinesWriter(out), d, outputChan)
+	case FrameLines:
+		_, err = out.Write(append(bytes.TrimRight(d, "\r\n"), '\n'))
+	default:
+		_, err = out.Write(d)
+	}
+	if isBrokenPipe(err) {
+		logger.Info("StdoutWriter: stdout was closed, discarding the rest of the data")
+		w.closed = true
+		return
+	}
+	util.KillPipelineIfErr(err, killChan)
+}
+
+// isBrokenPipe returns whether err is from writing to a closed pipe.
+func isBrokenPipe(err error) bool {
+	for err != nil {
+		if err == syscall.EPIPE {
+			return true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
+
+// Finish - see interface for documentation.
+func (w *StdoutWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (w *StdoutWriter) String() string {
+	return "StdoutWriter"
+}
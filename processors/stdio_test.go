@@ -0,0 +1,30 @@
+package processors_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewStdinReader() {
+	logger.LogLevel = logger.LevelSilent
+
+	stdin := processors.NewStdinReader()
+	// Stdin defaults to os.Stdin.
+	stdin.Stdin = strings.NewReader(`{"id":1}
+{"id":2}
+`)
+	filter, _ := processors.NewFilter("id > 1")
+	stdout := processors.NewStdoutWriter()
+	pipeline := ratchet.NewPipeline(stdin, filter, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"id":2}
+}
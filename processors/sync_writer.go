@@ -0,0 +1,246 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// SyncWriter mirrors a complete snapshot of source data into a table, so
+// reference tables can be kept identical to their source without the
+// downtime of truncating and reloading them. It expects to receive every
+// source record (across any number of payloads) during a Pipeline run:
+//
+//   - records whose PrimaryKeys aren't in the table are inserted,
+//   - records that differ from the table's row are upserted, and
+//     unchanged ones aren't written at all,
+//   - when the SyncWriter is finished, rows of the table whose keys
+//     weren't received are deleted.
+//
+// Only the columns present in the records are compared and written. The
+// table's current rows are read (into memory) when the first payload is
+// received, so SyncWriter is meant for tables of a manageable size.
+//
+// If no records are received at all, nothing is deleted unless
+// AllowEmptySource is set, since an empty snapshot is more likely to be a
+// failed extract than an empty source. Nothing is deleted if writing any
+// of the records failed either.
+//
+// The database's dialect is chosen from its driver (see util.DialectFor):
+// MySQL, PostgreSQL and SQLite are supported.
+type SyncWriter struct {
+	writeDB          *sqlx.DB
+	TableName        string
+	PrimaryKeys      []string
+	BatchSize        int
+	AllowEmptySource bool
+	// Timeout limits each statement, see util.WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries each statement that fails with a retryable error,
+	// such as a lost connection or a deadlock. See util.SQLRetry.
+	Retry util.SQLRetry
+
+	target   map[string]map[string]interface{} // The table's rows, by key
+	seen     map[string]bool
+	received int
+	failed   bool
+	mutex    sync.Mutex
+}
+
+// NewSyncWriter returns a new SyncWriter mirroring records into tableName,
+// matching them to its rows by primaryKeys.
+func NewSyncWriter(db *sqlx.DB, tableName string, primaryKeys ...string) *SyncWriter {
+	return &SyncWriter{writeDB: db, TableName: tableName, PrimaryKeys: primaryKeys, BatchSize: 100}
+}
+
+// ProcessData upserts the new and changed records received.
+func (s *SyncWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	s.ProcessDataCtx(context.Background(), d, outputChan, killChan)
+}
+
+// ProcessDataCtx is the same as ProcessData, but the statements are
+// cancelled when ctx is done. See ratchet.ContextDataProcessor.
+func (s *SyncWriter) ProcessDataCtx(ctx context.Context, d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if err := s.sync(ctx, objects); err != nil {
+		s.mutex.Lock()
+		s.failed = true
+		s.mutex.Unlock()
+		util.KillPipelineIfErr(err, killChan)
+	}
+}
+
+func (s *SyncWriter) sync(ctx context.Context, objects []map[string]interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.PrimaryKeys) == 0 {
+		return util.ConfigErrorf("SyncWriter: PrimaryKeys are required")
+	}
+	dialect, err := util.DialectFor(s.writeDB.DriverName())
+	if err != nil {
+		return err
+	}
+	if s.target == nil {
+		if err := s.loadTarget(ctx); err != nil {
+			return err
+		}
+	}
+
+	var changed []map[string]interface{}
+	for _, o := range objects {
+		key, err := s.key(o)
+		if err != nil {
+			return err
+		}
+		if s.seen[key] {
+			return util.DataErrorf("SyncWriter: duplicate key %v", strings.Replace(key, "\x00", ", ", -1))
+		}
+		s.seen[key] = true
+		s.received++
+		if row, ok := s.target[key]; !ok || syncChanged(o, row) {
+			changed = append(changed, o)
+		}
+	}
+	logger.Info("SyncWriter: writing", len(changed), "of", len(objects), "records to", s.TableName)
+
+	exec := util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry}
+	return util.ForEachBatch(changed, s.BatchSize, 1, func(batch []map[string]interface{}) error {
+		upsertSQL, vals := util.BuildInsertSQL(dialect, batch, s.TableName, true, s.PrimaryKeys, nil)
+		logger.Debug("SyncWriter:", upsertSQL)
+		return exec.Run(ctx, s.writeDB, func(ctx context.Context) error {
+			_, err := s.writeDB.ExecContext(ctx, upsertSQL, vals...)
+			return err
+		})
+	})
+}
+
+// loadTarget reads the table's current rows.
+func (s *SyncWriter) loadTarget(ctx context.Context) error {
+	s.target = map[string]map[string]interface{}{}
+	s.seen = map[string]bool{}
+	query := fmt.Sprintf("SELECT * FROM %v", s.TableName)
+	err := s.Retry.Do(ctx, s.writeDB, func(ctx context.Context) error {
+		return util.ForEachSQLQueryBatch(ctx, s.writeDB, query, nil, 0, 1000, s.Timeout, nil, func(d data.JSON) error {
+			rows, err := data.ObjectsFromJSON(d)
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				key, err := s.key(row)
+				if err != nil {
+					return err
+				}
+				s.target[key] = row
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		s.target = nil
+		return err
+	}
+	logger.Info("SyncWriter: read", len(s.target), "rows from", s.TableName)
+	return nil
+}
+
+// key returns the PrimaryKeys values of o as a string.
+func (s *SyncWriter) key(o map[string]interface{}) (string, error) {
+	parts := make([]string, len(s.PrimaryKeys))
+	for i, k := range s.PrimaryKeys {
+		v, ok := o[k]
+		if !ok || v == nil {
+			return "", util.DataErrorf("Missing value for primary key: %v", k)
+		}
+		parts[i] = syncValueString(v)
+	}
+	return strings.Join(parts, "\x00"), nil
+}
+
+// syncChanged returns true if any of the fields of o differ from row.
+func syncChanged(o, row map[string]interface{}) bool {
+	for col, v := range o {
+		rv, ok := row[col]
+		if !ok || (v == nil) != (rv == nil) || syncValueString(v) != syncValueString(rv) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncValueString returns v as a string to compare, with booleans as
+// numbers since that's how most databases store them.
+func syncValueString(v interface{}) string {
+	switch vv := v.(type) {
+	case bool:
+		if vv {
+			return "1"
+		}
+		return "0"
+	}
+	return valueString(v)
+}
+
+// Finish deletes the rows of the table that weren't received.
+func (s *SyncWriter) Finish(outputChan chan data.JSON, killChan chan error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Start again if the SyncWriter is reused.
+	defer func() {
+		s.target, s.seen, s.received, s.failed = nil, nil, 0, false
+	}()
+	if s.failed {
+		return
+	}
+	if s.received == 0 && !s.AllowEmptySource {
+		logger.Info("SyncWriter: no records received, not deleting from", s.TableName)
+		return
+	}
+	dialect, err := util.DialectFor(s.writeDB.DriverName())
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	if s.target == nil {
+		if err := s.loadTarget(context.Background()); err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+
+	var deleted []map[string]interface{}
+	for key, row := range s.target {
+		if !s.seen[key] {
+			deleted = append(deleted, row)
+		}
+	}
+	logger.Info("SyncWriter: deleting", len(deleted), "rows from", s.TableName)
+
+	exec := util.SQLExecOptions{Timeout: s.Timeout, Retry: s.Retry}
+	err = util.ForEachBatch(deleted, s.BatchSize, 1, func(batch []map[string]interface{}) error {
+		deleteSQL, vals, err := util.BuildDeleteSQL(dialect, batch, s.TableName, s.PrimaryKeys)
+		if err != nil {
+			return err
+		}
+		return exec.Run(context.Background(), s.writeDB, func(ctx context.Context) error {
+			_, err := s.writeDB.ExecContext(ctx, deleteSQL, vals...)
+			return err
+		})
+	})
+	util.KillPipelineIfErr(err, killChan)
+}
+
+func (s *SyncWriter) String() string {
+	return "SyncWriter"
+}
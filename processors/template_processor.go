@@ -0,0 +1,93 @@
+package processors
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// TemplateProcessor renders each record it receives through a
+// text/template, to bridge structured data to text-based destinations
+// such as SQL statements, HTTP bodies or lines in a file:
+//
+//	processors.NewTemplateProcessor(
+//		`UPDATE users SET name = {{ .name | sqlquote }} WHERE id = {{ .id }}`, nil)
+//
+// The sprig functions (https://masterminds.github.io/sprig/) are available,
+// along with sqlquote, which quotes a value as a SQL string literal, and
+// any extra funcs given to NewTemplateProcessor. Incoming data can be a
+// single JSON object or an array of objects.
+//
+// By default, the rendered text for each record is sent on as its own
+// payload as it is, which is not JSON: it is meant for processors such as
+// IoWriter, or a dynamic SQLExecutor. Set Field to add the text to each
+// record as that field instead, keeping the payload's shape.
+type TemplateProcessor struct {
+	Template *template.Template
+	Field    string // Dotted path to store the text at, or "" to send it as it is
+}
+
+// NewTemplateProcessor returns a new TemplateProcessor rendering the
+// template text, or an error if the template is invalid.
+func NewTemplateProcessor(text string, funcs template.FuncMap) (*TemplateProcessor, error) {
+	t, err := template.New("template").
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(template.FuncMap{"sqlquote": sqlQuote}).
+		Funcs(funcs).
+		Parse(text)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return &TemplateProcessor{Template: t}, nil
+}
+
+// ProcessData renders each record.
+func (p *TemplateProcessor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	for _, o := range objects {
+		var buf bytes.Buffer
+		if err := p.Template.Execute(&buf, o); err != nil {
+			util.KillPipelineIfErr(util.DataErrorf("TemplateProcessor: %v", err), killChan)
+			return
+		}
+		if p.Field == "" {
+			outputChan <- data.JSON(buf.Bytes())
+			continue
+		}
+		util.SetField(o, p.Field, buf.String())
+	}
+	if p.Field == "" || len(objects) == 0 {
+		return
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// sqlQuote quotes v as a SQL string literal, or returns NULL for nil.
+func sqlQuote(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	return "'" + strings.Replace(fmt.Sprint(v), "'", "''", -1) + "'"
+}
+
+// Finish - see interface for documentation.
+func (p *TemplateProcessor) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (p *TemplateProcessor) String() string {
+	return "TemplateProcessor"
+}
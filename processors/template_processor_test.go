@@ -0,0 +1,33 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewTemplateProcessor() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewIoReader(strings.NewReader(`[{"id":1,"name":"ann"},{"id":2,"name":"o'brien"}]`))
+	tmpl, err := processors.NewTemplateProcessor(`UPDATE users SET name = {{ .name | title | sqlquote }} WHERE id = {{ .id }};`, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	stdout := processors.NewIoWriter(os.Stdout)
+	stdout.AddNewline = true
+	pipeline := ratchet.NewPipeline(reader, tmpl, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// UPDATE users SET name = 'Ann' WHERE id = 1;
+	// UPDATE users SET name = 'O''Brien' WHERE id = 2;
+}
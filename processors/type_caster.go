@@ -0,0 +1,235 @@
+package processors
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// CastType is the type a TypeCaster converts a field to.
+type CastType string
+
+// The types a TypeCaster can convert fields to.
+const (
+	CastString CastType = "string"
+	CastInt    CastType = "int"
+	CastFloat  CastType = "float"
+	CastBool   CastType = "bool"
+	CastTime   CastType = "time"
+)
+
+// CastErrorPolicy controls what a TypeCaster does with a value that can't
+// be converted.
+type CastErrorPolicy string
+
+// The policies for values that can't be converted.
+const (
+	// CastFail kills the pipeline with a data error.
+	CastFail CastErrorPolicy = "fail"
+	// CastNull sets the field to null.
+	CastNull CastErrorPolicy = "null"
+	// CastKeep leaves the value as it is.
+	CastKeep CastErrorPolicy = "keep"
+	// CastDrop drops the record.
+	CastDrop CastErrorPolicy = "drop"
+)
+
+// FieldCast converts one field of a record.
+type FieldCast struct {
+	Field        string // Dotted path to the field
+	Type         CastType
+	Layout       string          // For CastTime, see time.Parse. Defaults to time.RFC3339Nano
+	OutputLayout string          // For CastTime, see time.Format. Defaults to time.RFC3339Nano
+	OnError      CastErrorPolicy // Defaults to CastFail
+}
+
+// TypeCaster converts fields of the records it receives to the types a
+// destination expects, so mismatches are caught (or handled) up front
+// rather than deep inside a SQL writer. Incoming data can be a single JSON
+// object or an array of objects, and the records keep the same shape.
+//
+// Strings are trimmed before they're converted to numbers, bools or times.
+// Numbers can be converted to bools (non-zero is true) and ints (if they
+// have no fractional part), and bools to numbers (1 or 0). Times are
+// parsed from strings in the Layout, or from numeric Unix timestamps in
+// seconds, and are formatted as strings in the OutputLayout in UTC.
+// Missing and null fields are left as they are.
+type TypeCaster struct {
+	Casts []FieldCast
+}
+
+// NewTypeCaster returns a new TypeCaster applying the given casts.
+func NewTypeCaster(casts ...FieldCast) *TypeCaster {
+	return &TypeCaster{Casts: casts}
+}
+
+// ProcessData converts the fields of each record.
+func (c *TypeCaster) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	cast := objects[:0]
+	for _, o := range objects {
+		keep, err := c.Cast(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		if keep {
+			cast = append(cast, o)
+		}
+	}
+	if len(cast) == 0 {
+		return
+	}
+	dd, err := objectsJSON(d, cast)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Cast converts the fields of a single record in place. It returns false
+// if the record should be dropped, and an error for values that can't be
+// converted with CastFail.
+func (c *TypeCaster) Cast(record map[string]interface{}) (bool, error) {
+	for _, fc := range c.Casts {
+		v, ok := util.LookupField(record, fc.Field)
+		if !ok || v == nil {
+			continue
+		}
+		converted, err := castValue(v, fc)
+		if err == nil {
+			util.SetField(record, fc.Field, converted)
+			continue
+		}
+		switch fc.OnError {
+		case CastNull:
+			util.SetField(record, fc.Field, nil)
+		case CastKeep:
+		case CastDrop:
+			logger.Debug("TypeCaster: dropping record -", err)
+			return false, nil
+		default:
+			return false, util.DataErrorf("TypeCaster: %v: %v", fc.Field, err)
+		}
+	}
+	return true, nil
+}
+
+func castValue(v interface{}, fc FieldCast) (interface{}, error) {
+	if s, ok := v.(string); ok && fc.Type != CastString {
+		v = strings.TrimSpace(s)
+	}
+	switch fc.Type {
+	case CastString:
+		switch vv := v.(type) {
+		case string:
+			return vv, nil
+		case float64:
+			return strconv.FormatFloat(vv, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(vv), nil
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	case CastInt:
+		switch vv := v.(type) {
+		case string:
+			if i, err := strconv.ParseInt(vv, 10, 64); err == nil {
+				return i, nil
+			}
+			f, err := strconv.ParseFloat(vv, 64)
+			if err != nil {
+				return nil, fmt.Errorf("can't convert %q to int", vv)
+			}
+			return floatToInt(f)
+		case float64:
+			return floatToInt(vv)
+		case bool:
+			if vv {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case CastFloat:
+		switch vv := v.(type) {
+		case string:
+			f, err := strconv.ParseFloat(vv, 64)
+			if err != nil {
+				return nil, fmt.Errorf("can't convert %q to float", vv)
+			}
+			return f, nil
+		case float64:
+			return vv, nil
+		case bool:
+			if vv {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		}
+	case CastBool:
+		switch vv := v.(type) {
+		case string:
+			b, err := strconv.ParseBool(vv)
+			if err != nil {
+				return nil, fmt.Errorf("can't convert %q to bool", vv)
+			}
+			return b, nil
+		case float64:
+			return vv != 0, nil
+		case bool:
+			return vv, nil
+		}
+	case CastTime:
+		var t time.Time
+		switch vv := v.(type) {
+		case string:
+			layout := fc.Layout
+			if layout == "" {
+				layout = time.RFC3339Nano
+			}
+			var err error
+			if t, err = time.Parse(layout, vv); err != nil {
+				return nil, err
+			}
+		case float64:
+			t = time.Unix(0, int64(vv*float64(time.Second)))
+		default:
+			return nil, fmt.Errorf("can't convert %v to time", v)
+		}
+		layout := fc.OutputLayout
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		return t.UTC().Format(layout), nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", fc.Type)
+	}
+	return nil, fmt.Errorf("can't convert %v to %v", v, fc.Type)
+}
+
+func floatToInt(f float64) (interface{}, error) {
+	if f != math.Trunc(f) || math.IsInf(f, 0) || math.Abs(f) > 1<<63 {
+		return nil, fmt.Errorf("can't convert %v to int", f)
+	}
+	return int64(f), nil
+}
+
+// Finish - see interface for documentation.
+func (c *TypeCaster) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (c *TypeCaster) String() string {
+	return "TypeCaster"
+}
@@ -0,0 +1,35 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewTypeCaster() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":" 42 ","amount":"9.5","active":"true","created":"17/10/2026","zip":10115}
+{"id":"n/a","amount":"1","active":"false","created":"18/10/2026","zip":20095}
+`))
+	caster := processors.NewTypeCaster(
+		processors.FieldCast{Field: "id", Type: processors.CastInt, OnError: processors.CastDrop},
+		processors.FieldCast{Field: "amount", Type: processors.CastFloat},
+		processors.FieldCast{Field: "active", Type: processors.CastBool},
+		processors.FieldCast{Field: "created", Type: processors.CastTime, Layout: "02/01/2006", OutputLayout: "2006-01-02"},
+		processors.FieldCast{Field: "zip", Type: processors.CastString},
+	)
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, caster, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"active":true,"amount":9.5,"created":"2026-10-17","id":42,"zip":"10115"}
+}
@@ -0,0 +1,167 @@
+package processors
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Unflatten is the inverse of Flatten: it builds nested objects from the
+// flat keys of the records it receives, splitting the keys on Separator,
+// e.g. {"user_name": "Ann", "user_address_city": "Berlin"} becomes
+// {"user": {"name": "Ann", "address": {"city": "Berlin"}}}. This gives
+// records from SQL readers the shape document stores and JSON APIs expect.
+//
+// Set Prefixes to only nest keys starting with one of them (and the
+// Separator), so other keys that contain the Separator are left alone.
+// With Arrays set, nested objects whose keys are 0, 1, 2... become arrays.
+// Keys that would clash with another key's value (such as "user" and
+// "user_name") are left flat.
+//
+// Incoming data can be a single JSON object or an array of objects, and the
+// records keep the same shape.
+type Unflatten struct {
+	Separator string // Defaults to "_"
+	Prefixes  []string
+	Arrays    bool
+}
+
+// NewUnflatten returns a new Unflatten splitting keys on "_".
+func NewUnflatten() *Unflatten {
+	return &Unflatten{Separator: "_"}
+}
+
+// ProcessData nests the keys of each record.
+func (u *Unflatten) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+	if len(objects) == 0 {
+		return
+	}
+	for i, o := range objects {
+		objects[i] = u.Unflatten(o)
+	}
+	dd, err := objectsJSON(d, objects)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// Unflatten returns the nested record.
+func (u *Unflatten) Unflatten(record map[string]interface{}) map[string]interface{} {
+	sep := u.Separator
+	if sep == "" {
+		sep = "_"
+	}
+	keys := make([]string, 0, len(record))
+	for k := range record {
+		keys = append(keys, k)
+	}
+	// Set shorter keys first, so clashes are resolved the same way every
+	// time.
+	sort.Strings(keys)
+
+	nested := make(map[string]interface{}, len(record))
+	var flat []string
+	for _, k := range keys {
+		if !u.nests(k, sep) {
+			if _, ok := nested[k]; ok {
+				flat = append(flat, k)
+				continue
+			}
+			nested[k] = record[k]
+			continue
+		}
+		if !unflattenSet(nested, strings.Split(k, sep), record[k]) {
+			flat = append(flat, k)
+		}
+	}
+	for _, k := range flat {
+		nested[k] = record[k]
+	}
+	if u.Arrays {
+		for k, v := range nested {
+			nested[k] = unflattenArrays(v)
+		}
+	}
+	return nested
+}
+
+func (u *Unflatten) nests(key, sep string) bool {
+	if !strings.Contains(key, sep) {
+		return false
+	}
+	if len(u.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range u.Prefixes {
+		if strings.HasPrefix(key, p+sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// unflattenSet sets the value at the path of keys, returning false if it
+// clashes with a value that's already set.
+func unflattenSet(m map[string]interface{}, path []string, v interface{}) bool {
+	for _, key := range path[:len(path)-1] {
+		existing, ok := m[key]
+		if !ok {
+			next := make(map[string]interface{})
+			m[key] = next
+			m = next
+			continue
+		}
+		next, ok := existing.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		m = next
+	}
+	last := path[len(path)-1]
+	if _, ok := m[last]; ok {
+		return false
+	}
+	m[last] = v
+	return true
+}
+
+// unflattenArrays converts nested objects with keys 0..n-1 to arrays.
+func unflattenArrays(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	for k, vv := range m {
+		m[k] = unflattenArrays(vv)
+	}
+	array := make([]interface{}, len(m))
+	for k, vv := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(m) || strconv.Itoa(i) != k {
+			return m
+		}
+		array[i] = vv
+	}
+	if len(array) == 0 {
+		return m
+	}
+	return array
+}
+
+// Finish - see interface for documentation.
+func (u *Unflatten) Finish(outputChan chan data.JSON, killChan chan error) {
+}
+
+func (u *Unflatten) String() string {
+	return "Unflatten"
+}
@@ -0,0 +1,30 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewUnflatten() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"id":1,"created_at":"2026-10-17","user_name":"Ann","user_address_city":"Berlin","user_tags_0":"a","user_tags_1":"b"}
+`))
+	unflatten := processors.NewUnflatten()
+	unflatten.Prefixes = []string{"user"}
+	unflatten.Arrays = true
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, unflatten, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"created_at":"2026-10-17","id":1,"user":{"address":{"city":"Berlin"},"name":"Ann","tags":["a","b"]}}
+}
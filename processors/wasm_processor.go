@@ -0,0 +1,236 @@
+package processors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// wasmMemoryLimitPages limits WASM modules to 256MB of memory (64KB
+// pages).
+const wasmMemoryLimitPages = 4096
+
+// WASMProcessor transforms each record it receives with a WebAssembly
+// module, so transforms can be written in any language that compiles to
+// WASM and distributed as .wasm files. Modules run with wazero
+// (https://wazero.io) in a sandbox: they have no access to the
+// filesystem, network or environment, and their memory is limited.
+//
+// Modules implement a simple ABI, exchanging records as JSON through
+// their memory:
+//
+//	alloc(size i32) i32          allocates size bytes for the input
+//	transform(ptr i32, len i32) i64
+//
+// The transform function (named FunctionName) is called with each record
+// written to memory allocated by alloc, and returns the location of its
+// result packed as ptr<<32 | len. The result can be the record (or a new
+// object) to send it on, an array of objects to send several, or null or
+// a zero length to drop it. If the module exports dealloc(ptr i32,
+// len i32), it's called to free each result once it has been read.
+//
+// Modules can import two functions from the "ratchet" module, both taking
+// a (ptr i32, len i32) string: log writes to the ratchet logger, and fail
+// fails the record being transformed with an error. WASI is available
+// for modules built for it, and the module's _initialize function is
+// called (if it has one), so modules should be built as reactors or
+// libraries (e.g. -buildmode=c-shared) rather than commands.
+//
+// Incoming data can be a single JSON object or an array of objects. The
+// transformed records are sent as an array, or as a single object if the
+// payload was an object and the function returned a single object.
+type WASMProcessor struct {
+	Name         string // The name of the module, for error messages
+	FunctionName string
+	Timeout      time.Duration // Limits each call to the module, if set
+
+	runtime wazero.Runtime
+	module  api.Module
+	failure string
+}
+
+// NewWASMProcessor returns a new WASMProcessor running the WASM module,
+// whose function is called "transform".
+func NewWASMProcessor(wasm []byte) (*WASMProcessor, error) {
+	return newWASMProcessor("module", wasm)
+}
+
+// NewWASMProcessorFromFile returns a new WASMProcessor running the WASM
+// module in the file at path, whose function is called "transform".
+func NewWASMProcessorFromFile(path string) (*WASMProcessor, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ConfigInvalidError(err)
+	}
+	return newWASMProcessor(path, b)
+}
+
+func newWASMProcessor(name string, wasm []byte) (*WASMProcessor, error) {
+	p := &WASMProcessor{Name: name, FunctionName: "transform"}
+	ctx := context.Background()
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(wasmMemoryLimitPages).
+		WithCloseOnContextDone(true))
+	if err := p.instantiate(ctx, wasm); err != nil {
+		p.runtime.Close(ctx)
+		return nil, util.ConfigErrorf("WASM module %v: %v", name, err)
+	}
+	return p, nil
+}
+
+func (p *WASMProcessor) instantiate(ctx context.Context, wasm []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		return err
+	}
+	_, err := p.runtime.NewHostModuleBuilder("ratchet").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		if b, ok := m.Memory().Read(ptr, size); ok {
+			logger.Info("WASMProcessor:", string(b))
+		}
+	}).Export("log").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		p.failure = "failed"
+		if b, ok := m.Memory().Read(ptr, size); ok {
+			p.failure = string(b)
+		}
+	}).Export("fail").
+		Instantiate(ctx)
+	if err != nil {
+		return err
+	}
+	compiled, err := p.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return err
+	}
+	p.module, err = p.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithStartFunctions("_initialize").
+		WithStderr(os.Stderr))
+	if err != nil {
+		return err
+	}
+	if p.module.ExportedFunction("alloc") == nil {
+		return fmt.Errorf("module doesn't export alloc")
+	}
+	if p.module.Memory() == nil {
+		return fmt.Errorf("module doesn't export its memory")
+	}
+	return nil
+}
+
+// ProcessData calls the function with each record.
+func (p *WASMProcessor) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if p.module.ExportedFunction(p.FunctionName) == nil {
+		util.KillPipelineIfErr(util.ConfigErrorf("WASM module %v doesn't export a function %v", p.Name, p.FunctionName), killChan)
+		return
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+
+	var out []interface{}
+	single := len(objects) == 1
+	for _, o := range objects {
+		result, err := p.transform(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		switch v := result.(type) {
+		case nil:
+		case []interface{}:
+			out = append(out, v...)
+			single = false
+		case map[string]interface{}:
+			out = append(out, v)
+		default:
+			util.KillPipelineIfErr(util.DataErrorf("WASMProcessor: %v: %v returned %v, not an object", p.Name, p.FunctionName, v), killChan)
+			return
+		}
+	}
+	if len(out) == 0 {
+		return
+	}
+
+	var v interface{} = out
+	if single && len(out) == 1 && isObjectJSON(d) {
+		v = out[0]
+	}
+	dd, err := data.NewJSON(v)
+	if err != nil {
+		util.KillPipelineIfErr(err, killChan)
+		return
+	}
+	outputChan <- dd
+}
+
+// transform calls the function with a single record, and returns its
+// decoded result.
+func (p *WASMProcessor) transform(record map[string]interface{}) (interface{}, error) {
+	in, err := json.Marshal(record)
+	if err != nil {
+		return nil, util.DataInvalidError(err)
+	}
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	res, err := p.module.ExportedFunction("alloc").Call(ctx, uint64(len(in)))
+	if err != nil {
+		return nil, fmt.Errorf("WASMProcessor: %v: alloc: %v", p.Name, err)
+	}
+	ptr := uint32(res[0])
+	if !p.module.Memory().Write(ptr, in) {
+		return nil, fmt.Errorf("WASMProcessor: %v: alloc returned %d bytes out of range", p.Name, len(in))
+	}
+
+	p.failure = ""
+	res, err = p.module.ExportedFunction(p.FunctionName).Call(ctx, uint64(ptr), uint64(len(in)))
+	if err != nil {
+		return nil, fmt.Errorf("WASMProcessor: %v: %v: %v", p.Name, p.FunctionName, err)
+	}
+	if p.failure != "" {
+		return nil, util.DataErrorf("WASMProcessor: %v: %v", p.Name, p.failure)
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	b, ok := p.module.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("WASMProcessor: %v: %v returned %d bytes out of range", p.Name, p.FunctionName, outLen)
+	}
+	var result interface{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, util.DataErrorf("WASMProcessor: %v: %v returned invalid JSON: %v", p.Name, p.FunctionName, err)
+	}
+	if dealloc := p.module.ExportedFunction("dealloc"); dealloc != nil {
+		if _, err := dealloc.Call(ctx, uint64(outPtr), uint64(outLen)); err != nil {
+			return nil, fmt.Errorf("WASMProcessor: %v: dealloc: %v", p.Name, err)
+		}
+	}
+	return result, nil
+}
+
+// Finish closes the module.
+func (p *WASMProcessor) Finish(outputChan chan data.JSON, killChan chan error) {
+	p.runtime.Close(context.Background())
+}
+
+func (p *WASMProcessor) String() string {
+	return fmt.Sprintf("WASMProcessor(%v)", p.Name)
+}
@@ -0,0 +1,64 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+// echoWASM is a minimal module whose transform returns each record as it
+// is, with a bump allocator:
+//
+//	(module
+//	  (memory (export "memory") 1)
+//	  (global $heap (mut i32) (i32.const 1024))
+//	  (func (export "alloc") (param $size i32) (result i32)
+//	    global.get $heap
+//	    global.get $heap
+//	    local.get $size
+//	    i32.add
+//	    global.set $heap)
+//	  (func (export "transform") (param $ptr i32) (param $len i32) (result i64)
+//	    local.get $ptr
+//	    i64.extend_i32_u
+//	    i64.const 32
+//	    i64.shl
+//	    local.get $len
+//	    i64.extend_i32_u
+//	    i64.or))
+var echoWASM = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, 0x03, 0x03, 0x02, 0x00, 0x01, 0x05, 0x03, 0x01, 0x00, 0x01,
+	0x06, 0x07, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b, 0x07, 0x1e, 0x03, 0x06, 0x6d, 0x65, 0x6d,
+	0x6f, 0x72, 0x79, 0x02, 0x00, 0x05, 0x61, 0x6c, 0x6c, 0x6f, 0x63, 0x00, 0x00, 0x09, 0x74, 0x72,
+	0x61, 0x6e, 0x73, 0x66, 0x6f, 0x72, 0x6d, 0x00, 0x01, 0x0a, 0x1a, 0x02, 0x0b, 0x00, 0x23, 0x00,
+	0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b, 0x0c, 0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86,
+	0x20, 0x01, 0xad, 0x84, 0x0b,
+}
+
+func ExampleNewWASMProcessor() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"item":"pen","quantity":4}
+{"item":"ink","quantity":0}
+`))
+	transform, err := processors.NewWASMProcessor(echoWASM)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, transform, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"item":"pen","quantity":4}
+	// {"item":"ink","quantity":0}
+}
@@ -0,0 +1,282 @@
+package processors
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+// Window collects records into time windows and sends each window's
+// records downstream when the window closes, e.g. for per-minute rollups
+// from a streaming source. Windows are tumbling (back to back) by default;
+// set Slide to a shorter duration than Size for sliding (overlapping)
+// windows, where a record is in every window that covers its time.
+//
+// Records are assigned to windows by the time in TimeField (event time),
+// or by when they are received if TimeField isn't set (processing time).
+// Event times can be strings in TimeFormat (RFC 3339 by default) or
+// numeric Unix timestamps in seconds (or milliseconds, for large values).
+// With event time, a window closes once a record at least Lateness past
+// its end is received; records for windows that have already closed are
+// dropped. With processing time, windows close on the clock. Any open
+// windows are closed when the Window is finished.
+//
+// If Aggregations are set, each window is aggregated (see Aggregator)
+// and the rows are sent; otherwise the window's records are sent as they
+// are. Either way, WindowStartField and WindowEndField are added to each
+// object, formatted as RFC 3339.
+type Window struct {
+	Size             time.Duration
+	Slide            time.Duration // Defaults to Size (tumbling windows)
+	TimeField        string        // Dotted path to the event time, or "" for processing time
+	TimeFormat       string        // See time.Parse, defaults to time.RFC3339Nano
+	Lateness         time.Duration // How long to wait for late records with event time
+	GroupBy          []string
+	Aggregations     []Aggregation
+	WindowStartField string // Defaults to "window_start"
+	WindowEndField   string // Defaults to "window_end"
+
+	windows   map[time.Time]*windowState
+	watermark time.Time
+	dropped   int
+	now       func() time.Time
+	mutex     sync.Mutex
+	ticker    *time.Ticker
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type windowState struct {
+	records    []map[string]interface{}
+	aggregator *Aggregator
+}
+
+// NewTumblingWindow returns a new Window of back to back windows of the
+// given size. Set TimeField to use event time.
+func NewTumblingWindow(size time.Duration) *Window {
+	return &Window{Size: size}
+}
+
+// NewSlidingWindow returns a new Window of windows of the given size,
+// starting every slide.
+func NewSlidingWindow(size, slide time.Duration) *Window {
+	return &Window{Size: size, Slide: slide}
+}
+
+func (w *Window) slide() time.Duration {
+	if w.Slide <= 0 || w.Slide > w.Size {
+		return w.Size
+	}
+	return w.Slide
+}
+
+// ProcessData adds the records to their windows, and sends any windows
+// that have closed.
+func (w *Window) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if w.Size <= 0 {
+		util.KillPipelineIfErr(util.ConfigErrorf("Window: Size must be set"), killChan)
+		return
+	}
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		util.KillPipelineIfErr(util.DataInvalidError(err), killChan)
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.TimeField == "" && w.ticker == nil {
+		w.startClock(outputChan, killChan)
+	}
+	for _, o := range objects {
+		t, err := w.recordTime(o)
+		if err != nil {
+			util.KillPipelineIfErr(err, killChan)
+			return
+		}
+		w.add(o, t)
+		if w.TimeField != "" && t.Add(-w.Lateness).After(w.watermark) {
+			w.watermark = t.Add(-w.Lateness)
+		}
+	}
+	if w.TimeField == "" {
+		w.watermark = w.clock()
+	}
+	util.KillPipelineIfErr(w.closeWindows(false, outputChan), killChan)
+}
+
+// Finish stops the clock (with processing time) and sends all the open
+// windows.
+func (w *Window) Finish(outputChan chan data.JSON, killChan chan error) {
+	if w.ticker != nil {
+		close(w.stop)
+		<-w.done
+		w.ticker = nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.dropped > 0 {
+		logger.Info("Window: dropped", w.dropped, "late record(s)")
+	}
+	util.KillPipelineIfErr(w.closeWindows(true, outputChan), killChan)
+}
+
+// startClock closes windows as time passes with processing time, even if
+// no data is received.
+func (w *Window) startClock(outputChan chan data.JSON, killChan chan error) {
+	interval := time.Second
+	if s := w.slide(); s < interval {
+		interval = s
+	}
+	w.ticker = time.NewTicker(interval)
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go func(ticker *time.Ticker) {
+		defer close(w.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.mutex.Lock()
+				w.watermark = w.clock()
+				err := w.closeWindows(false, outputChan)
+				w.mutex.Unlock()
+				util.KillPipelineIfErr(err, killChan)
+			case <-w.stop:
+				return
+			}
+		}
+	}(w.ticker)
+}
+
+func (w *Window) clock() time.Time {
+	if w.now != nil {
+		return w.now()
+	}
+	return time.Now()
+}
+
+func (w *Window) recordTime(record map[string]interface{}) (time.Time, error) {
+	if w.TimeField == "" {
+		return w.clock(), nil
+	}
+	v, _ := util.LookupField(record, w.TimeField)
+	switch t := v.(type) {
+	case string:
+		format := w.TimeFormat
+		if format == "" {
+			format = time.RFC3339Nano
+		}
+		parsed, err := time.Parse(format, t)
+		if err != nil {
+			return time.Time{}, util.DataInvalidError(err)
+		}
+		return parsed, nil
+	case float64:
+		if t > 1e12 {
+			return time.Unix(0, int64(t)*int64(time.Millisecond)), nil
+		}
+		return time.Unix(0, int64(t*float64(time.Second))), nil
+	}
+	return time.Time{}, util.DataErrorf("Window: record has no time in %v: %v", w.TimeField, record)
+}
+
+// add adds the record to every window covering t that hasn't closed.
+func (w *Window) add(record map[string]interface{}, t time.Time) {
+	slide := w.slide()
+	last := t.Truncate(slide)
+	added := false
+	for start := last; start.Add(w.Size).After(t); start = start.Add(-slide) {
+		if !start.Add(w.Size).After(w.watermark) && !w.watermark.IsZero() {
+			continue
+		}
+		ws, ok := w.windows[start]
+		if !ok {
+			ws = &windowState{}
+			if len(w.Aggregations) > 0 {
+				ws.aggregator = NewAggregator(w.GroupBy, w.Aggregations...)
+			}
+			if w.windows == nil {
+				w.windows = make(map[time.Time]*windowState)
+			}
+			w.windows[start] = ws
+		}
+		if ws.aggregator != nil {
+			ws.aggregator.Add(record)
+		} else {
+			ws.records = append(ws.records, record)
+		}
+		added = true
+	}
+	if !added {
+		w.dropped++
+	}
+}
+
+// closeWindows sends the windows that end before the watermark (or all of
+// them), in order.
+func (w *Window) closeWindows(all bool, outputChan chan data.JSON) error {
+	var starts []time.Time
+	for start := range w.windows {
+		if all || !start.Add(w.Size).After(w.watermark) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	for _, start := range starts {
+		ws := w.windows[start]
+		delete(w.windows, start)
+		rows := ws.records
+		if ws.aggregator != nil {
+			rows = ws.aggregator.Rows()
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		if err := w.send(start, rows, outputChan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Window) send(start time.Time, rows []map[string]interface{}, outputChan chan data.JSON) error {
+	startField, endField := w.WindowStartField, w.WindowEndField
+	if startField == "" {
+		startField = "window_start"
+	}
+	if endField == "" {
+		endField = "window_end"
+	}
+	out := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		// Copy the rows, since records can be in several sliding windows.
+		o := make(map[string]interface{}, len(row)+2)
+		for k, v := range row {
+			o[k] = v
+		}
+		o[startField] = start.UTC().Format(time.RFC3339Nano)
+		o[endField] = start.Add(w.Size).UTC().Format(time.RFC3339Nano)
+		out[i] = o
+	}
+	d, err := data.NewJSON(out)
+	if err != nil {
+		return err
+	}
+	logger.Debug("Window: sending", len(out), "row(s) for window starting", start)
+	outputChan <- d
+	return nil
+}
+
+func (w *Window) String() string {
+	if w.slide() != w.Size {
+		return fmt.Sprintf("Window(%v every %v)", w.Size, w.slide())
+	}
+	return fmt.Sprintf("Window(%v)", w.Size)
+}
@@ -0,0 +1,35 @@
+package processors_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExampleNewTumblingWindow() {
+	logger.LogLevel = logger.LevelSilent
+
+	reader := processors.NewJSONLinesReader(strings.NewReader(`{"time":"2017-01-01T10:00:05Z","page":"/"}
+{"time":"2017-01-01T10:00:30Z","page":"/about"}
+{"time":"2017-01-01T10:01:10Z","page":"/"}
+`))
+	reader.BatchSize = 1
+	window := processors.NewTumblingWindow(time.Minute)
+	window.TimeField = "time"
+	window.Aggregations = []processors.Aggregation{processors.Count("views")}
+	stdout := processors.NewJSONLinesWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(reader, window, stdout)
+
+	if err := <-pipeline.Run(); err != nil {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// {"views":2,"window_end":"2017-01-01T10:01:00Z","window_start":"2017-01-01T10:00:00Z"}
+	// {"views":1,"window_end":"2017-01-01T10:02:00Z","window_start":"2017-01-01T10:01:00Z"}
+}
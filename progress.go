@@ -0,0 +1,152 @@
+package ratchet
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ProgressSource can be implemented by DataProcessors (typically readers)
+// that know how much work they have to do in total, such as the size of a
+// file or the number of rows a query will return. It's used to estimate
+// completion in ProgressEvents. done and total can be in any unit, and
+// total should be 0 if it isn't known (yet).
+type ProgressSource interface {
+	Progress() (done, total int64)
+}
+
+// ProgressEvent reports the progress of a running Pipeline.
+// See Pipeline.OnProgress.
+type ProgressEvent struct {
+	Pipeline string
+	Elapsed  time.Duration
+	Finished bool // True for the final event, sent when the Pipeline finishes
+	Stages   []StageProgress
+	// Fraction is the estimated fraction of work completed, from 0 to 1,
+	// based on the ProgressSources in the Pipeline. It is -1 if there are
+	// no ProgressSources reporting a total.
+	Fraction float64
+	// EstimatedRemaining is the estimated time to completion, based on
+	// Fraction and Elapsed, or 0 if unknown.
+	EstimatedRemaining time.Duration
+}
+
+// StageProgress reports the progress of a single DataProcessor.
+type StageProgress struct {
+	ProcessorInfo
+	// Records is the number of records in the data this DataProcessor has
+	// finished processing (see BatchInfo.Records).
+	Records          int
+	PayloadsReceived int
+	PayloadsSent     int
+	// Done and Total are reported by DataProcessors that implement
+	// ProgressSource, and are otherwise 0.
+	Done  int64
+	Total int64
+}
+
+// OnProgress registers fn to be called every ProgressInterval while the
+// Pipeline runs, and once more when it finishes. It must be called before
+// Run. This is intended for rendering progress bars and the like.
+func (p *Pipeline) OnProgress(fn func(ProgressEvent)) {
+	p.AddObserver(&progressObserver{fn: fn, records: make(map[ProcessorInfo]int)})
+}
+
+type progressObserver struct {
+	NopObserver
+	fn      func(ProgressEvent)
+	records map[ProcessorInfo]int
+	stop    chan struct{}
+	mutex   sync.Mutex
+	// reportMutex makes sure events are delivered one at a time and the
+	// final event is delivered last.
+	reportMutex sync.Mutex
+	finished    bool
+}
+
+func (o *progressObserver) PipelineStarted(ctx context.Context, p *Pipeline) {
+	interval := p.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	o.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.report(p, false)
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (o *progressObserver) PipelineFinished(p *Pipeline, err error) {
+	close(o.stop)
+	o.report(p, true)
+}
+
+func (o *progressObserver) BatchProcessed(p *Pipeline, batch BatchInfo) {
+	o.mutex.Lock()
+	o.records[batch.ProcessorInfo] += batch.Records
+	o.mutex.Unlock()
+}
+
+func (o *progressObserver) report(p *Pipeline, finished bool) {
+	o.reportMutex.Lock()
+	defer o.reportMutex.Unlock()
+	if o.finished {
+		return
+	}
+	o.finished = finished
+	o.fn(o.event(p, finished))
+}
+
+func (o *progressObserver) event(p *Pipeline, finished bool) ProgressEvent {
+	e := ProgressEvent{Pipeline: p.Name, Finished: finished, Fraction: -1}
+	if p.timer != nil {
+		e.Elapsed = p.timer.Duration()
+	}
+
+	var fractions float64
+	var sources int
+	o.mutex.Lock()
+	for n, stage := range p.layout.stages {
+		for i, dp := range stage.processors {
+			info := processorInfo(n, i, dp)
+			stats := dp.stats()
+			sp := StageProgress{
+				ProcessorInfo:    info,
+				Records:          o.records[info],
+				PayloadsReceived: stats.PayloadsReceived,
+				PayloadsSent:     stats.PayloadsSent,
+			}
+			if src, ok := dp.DataProcessor.(ProgressSource); ok {
+				sp.Done, sp.Total = src.Progress()
+				if sp.Total > 0 {
+					f := float64(sp.Done) / float64(sp.Total)
+					if f > 1 {
+						f = 1
+					}
+					fractions += f
+					sources++
+				}
+			}
+			e.Stages = append(e.Stages, sp)
+		}
+	}
+	o.mutex.Unlock()
+
+	if finished {
+		e.Fraction = 1
+	} else if sources > 0 {
+		e.Fraction = fractions / float64(sources)
+		if e.Fraction > 0 {
+			e.EstimatedRemaining = time.Duration(float64(e.Elapsed) * (1 - e.Fraction) / e.Fraction)
+		}
+	}
+	return e
+}
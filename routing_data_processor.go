@@ -0,0 +1,43 @@
+package ratchet
+
+import "github.com/fefelovgroup/ratchet/data"
+
+// RoutingDataProcessor is an optional interface for DataProcessors in a
+// branching PipelineLayout. Normally everything a DataProcessor sends is
+// copied to all of its Outputs; a RoutingDataProcessor's Route method is
+// called for each payload it sends instead, and the payload is only passed
+// to the Outputs it returns. See processors.Router.
+type RoutingDataProcessor interface {
+	DataProcessor
+	Route(d data.JSON) []DataProcessor
+}
+
+func containsProcessor(processors []DataProcessor, p DataProcessor) bool {
+	for _, dp := range processors {
+		if dp == p {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceTaggingDataProcessor is an optional interface for DataProcessors
+// that receive data from several DataProcessors in the previous stage of a
+// branching PipelineLayout. TagSource is called for each payload before it
+// is passed to ProcessData, with the DataProcessor that sent it, and can
+// return modified data (e.g. recording where it came from). It's called
+// concurrently for the different sources. See processors.Merge.
+type SourceTaggingDataProcessor interface {
+	DataProcessor
+	TagSource(d data.JSON, source DataProcessor) data.JSON
+}
+
+// SourceClosingDataProcessor is an optional interface for DataProcessors
+// that receive data from several DataProcessors in the previous stage, to
+// be notified when one of them has finished sending data. If SourceClosed
+// returns data, it's passed to ProcessData after everything the source
+// sent. See processors.Join.
+type SourceClosingDataProcessor interface {
+	DataProcessor
+	SourceClosed(source DataProcessor) data.JSON
+}
@@ -0,0 +1,176 @@
+package ratchet
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// RunStatus is the state of a Run.
+type RunStatus string
+
+// The states of a Run. A Run that is still RunRunning when it isn't running
+// anymore was interrupted, e.g. by the process being killed.
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+)
+
+// Run records a single run of a Pipeline, see RunStore. Attempts counts the
+// times it was run, including re-runs with Pipeline.Rerun.
+type Run struct {
+	ID       string    `json:"id"`
+	Pipeline string    `json:"pipeline"`
+	Status   RunStatus `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// RunStore keeps a record of a Pipeline's runs, so that a run that failed
+// can be re-run with Pipeline.Rerun.
+type RunStore interface {
+	// SaveRun saves run, replacing any previous record of it.
+	SaveRun(run Run) error
+	// LoadRun returns the run with the given ID, and false if there is no
+	// record of it.
+	LoadRun(id string) (Run, bool, error)
+}
+
+// CheckpointRunStore is a RunStore keeping runs in a CheckpointStore, under
+// keys prefixed with "run/".
+type CheckpointRunStore struct {
+	Store CheckpointStore
+}
+
+// NewCheckpointRunStore returns a new CheckpointRunStore using store.
+func NewCheckpointRunStore(store CheckpointStore) *CheckpointRunStore {
+	return &CheckpointRunStore{Store: store}
+}
+
+// SaveRun - see RunStore.
+func (s *CheckpointRunStore) SaveRun(run Run) error {
+	return s.Store.Save("run/"+run.ID, run)
+}
+
+// LoadRun - see RunStore.
+func (s *CheckpointRunStore) LoadRun(id string) (Run, bool, error) {
+	var run Run
+	ok, err := s.Store.Load("run/"+id, &run)
+	return run, ok, err
+}
+
+// RunID returns the ID of the Pipeline's current (or last) run, which is
+// empty until it's run. It's the same for every attempt of a run, see
+// Rerun.
+func (p *Pipeline) RunID() string {
+	return p.run.ID
+}
+
+// Rerun runs the Pipeline again for the run with the given ID, which must
+// have failed (or been interrupted), according to RunStore. The new attempt
+// keeps the run's ID, which ContextDataProcessors get from
+// RunIDFromContext, so writers using it as an idempotency key (e.g. to
+// replace what an earlier attempt loaded) don't load records twice.
+//
+// Only what the failed attempt didn't complete is processed again:
+// CommittingDataProcessors only save their position (such as a reader's
+// offsets or the files it has read, see CheckpointStore) when a run
+// succeeds, so they resume from where the last successful run left off.
+// Records that a DeadLetter output quarantined aren't part of a failed run,
+// and have to be replayed from wherever it stored them.
+func (p *Pipeline) Rerun(runID string) (killChan chan error, err error) {
+	if err := p.prepareRerun(runID); err != nil {
+		return nil, err
+	}
+	return p.Run(), nil
+}
+
+// RerunContext is the same as Rerun, but the Pipeline is cancelled when ctx
+// is done, see RunContext.
+func (p *Pipeline) RerunContext(ctx context.Context, runID string) (killChan chan error, err error) {
+	if err := p.prepareRerun(runID); err != nil {
+		return nil, err
+	}
+	return p.RunContext(ctx), nil
+}
+
+// prepareRerun checks that the run with the given ID can be re-run, and
+// makes it the run that's started next.
+func (p *Pipeline) prepareRerun(runID string) error {
+	if p.RunStore == nil {
+		return fmt.Errorf("%v: Rerun needs a RunStore", p.Name)
+	}
+	run, ok, err := p.RunStore.LoadRun(runID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !ok:
+		return fmt.Errorf("%v: no record of run %v", p.Name, runID)
+	case run.Pipeline != p.Name:
+		return fmt.Errorf("%v: run %v is a run of %v", p.Name, runID, run.Pipeline)
+	case run.Status == RunSucceeded:
+		return fmt.Errorf("%v: run %v succeeded, there's nothing to re-run", p.Name, runID)
+	}
+	p.rerun = &run
+	return nil
+}
+
+// startRun starts recording a new run, or a new attempt of the run being
+// re-run.
+func (p *Pipeline) startRun() {
+	run := Run{ID: newRunID(), Pipeline: p.Name}
+	if p.rerun != nil {
+		run = *p.rerun
+		p.rerun = nil
+	}
+	run.Attempts++
+	run.Status = RunRunning
+	run.Error = ""
+	run.Started = time.Now()
+	run.Finished = time.Time{}
+	p.run = run
+	p.saveRun()
+}
+
+// finishRun records the result of the current run.
+func (p *Pipeline) finishRun(err error) {
+	p.run.Status = RunSucceeded
+	if err != nil {
+		p.run.Status = RunFailed
+		p.run.Error = err.Error()
+	}
+	p.run.Finished = time.Now()
+	p.saveRun()
+}
+
+func (p *Pipeline) saveRun() {
+	if p.RunStore == nil {
+		return
+	}
+	if err := p.RunStore.SaveRun(p.run); err != nil {
+		logger.Error(p.Name, ": error saving run", p.run.ID, ":", err)
+	}
+}
+
+type runIDKey struct{}
+
+// RunIDFromContext returns the ID of the run of the Pipeline, see
+// Pipeline.RunID, from the context given to ContextDataProcessors. It's
+// empty if ctx doesn't come from a Pipeline.
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405"), b)
+}
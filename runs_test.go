@@ -0,0 +1,77 @@
+package ratchet_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+// flakyWriter fails the first time it's run, e.g. like a warehouse that's
+// briefly unavailable.
+type flakyWriter struct {
+	failed bool
+}
+
+func (w *flakyWriter) ProcessData(d data.JSON, outputChan chan data.JSON, killChan chan error) {
+	if !w.failed {
+		w.failed = true
+		killChan <- errors.New("connection refused")
+		return
+	}
+	fmt.Println(string(d))
+}
+
+func (w *flakyWriter) Finish(outputChan chan data.JSON, killChan chan error) {}
+
+func (w *flakyWriter) String() string {
+	return "flakyWriter"
+}
+
+func ExamplePipeline_Rerun() {
+	logger.LogLevel = logger.LevelSilent
+
+	dir, _ := ioutil.TempDir("", "ratchet")
+	defer os.RemoveAll(dir)
+	runs := ratchet.NewCheckpointRunStore(ratchet.NewFileCheckpointStore(filepath.Join(dir, "checkpoints.json")))
+
+	hello := processors.NewIoReader(strings.NewReader("Hello world!"))
+	pipeline := ratchet.NewPipeline(hello, &flakyWriter{})
+	pipeline.LegacyErrors = true
+	pipeline.RunStore = runs
+
+	fmt.Println(<-pipeline.Run())
+	runID := pipeline.RunID()
+	run, _, _ := runs.LoadRun(runID)
+	fmt.Println(run.Status, run.Error)
+
+	hello = processors.NewIoReader(strings.NewReader("Hello world!"))
+	pipeline = ratchet.NewPipeline(hello, &flakyWriter{failed: true})
+	pipeline.RunStore = runs
+	killChan, err := pipeline.Rerun(runID)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(<-killChan)
+	run, _, _ = runs.LoadRun(runID)
+	fmt.Println(pipeline.RunID() == runID, run.Status, run.Attempts)
+
+	_, err = pipeline.Rerun(runID)
+	fmt.Println(err != nil)
+
+	// Output:
+	// connection refused
+	// failed connection refused
+	// Hello world!
+	// <nil>
+	// true succeeded 2
+	// true
+}
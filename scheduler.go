@@ -0,0 +1,197 @@
+package ratchet
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+	"github.com/robfig/cron/v3"
+)
+
+// OverlapPolicy controls what a ScheduledPipeline does when a run is due
+// while an earlier run is still going.
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the run.
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue starts the run as soon as the earlier run finishes.
+	// Only one run is queued, so further runs are skipped until it starts.
+	OverlapQueue
+	// OverlapConcurrent starts the run anyway.
+	OverlapConcurrent
+)
+
+// ScheduledRun describes a single run of a ScheduledPipeline.
+type ScheduledRun struct {
+	Number    int       // Starting at 1, skipped runs aren't numbered
+	Scheduled time.Time // When the run was due
+	Start     time.Time
+	Duration  time.Duration
+	Skipped   bool   // The run was skipped because of the OverlapPolicy
+	RunID     string // The Pipeline's RunID, e.g. to re-run it if it failed
+	Err       error
+	Stats     *PipelineStats
+}
+
+func (r ScheduledRun) String() string {
+	switch {
+	case r.Skipped:
+		return fmt.Sprintf("Run due at %v - SKIPPED", r.Scheduled.Format(time.RFC3339))
+	case r.Err != nil:
+		return fmt.Sprintf("Run %d due at %v - %v - FAILED: %v", r.Number, r.Scheduled.Format(time.RFC3339), r.Duration, r.Err)
+	}
+	return fmt.Sprintf("Run %d due at %v - %v - OK", r.Number, r.Scheduled.Format(time.RFC3339), r.Duration)
+}
+
+// ScheduledPipeline runs a Pipeline on a cron schedule, so recurring jobs
+// don't need an external cron calling a custom main. NewPipeline is
+// called for every run, since a Pipeline can only be run once.
+//
+//	scheduled, err := ratchet.Schedule("*/15 * * * *", newPipeline)
+//	if err != nil {
+//		return err
+//	}
+//	scheduled.Overlap = ratchet.OverlapQueue
+//	err = scheduled.Run(ctx)
+//
+// Specs are standard 5 field cron expressions, descriptors such as
+// @hourly or "@every 10m", and can be prefixed with CRON_TZ=<zone> (see
+// github.com/robfig/cron). Each run is started up to Jitter after it's
+// due, to spread the load of many pipelines scheduled at the same time.
+// Every run is logged, and reported to OnRun if it's set.
+type ScheduledPipeline struct {
+	Spec        string
+	NewPipeline func() (*Pipeline, error)
+	Overlap     OverlapPolicy
+	Jitter      time.Duration
+	Location    *time.Location // Defaults to time.Local, unless Spec sets CRON_TZ
+	// OnRun is called after each run, and for each skipped run.
+	OnRun func(run ScheduledRun)
+
+	schedule cron.Schedule
+	running  int
+	queued   *time.Time
+	runs     int
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// Schedule returns a ScheduledPipeline running the Pipelines returned by
+// newPipeline on the cron spec. The spec is checked immediately, but
+// nothing runs until Run is called.
+func Schedule(spec string, newPipeline func() (*Pipeline, error)) (*ScheduledPipeline, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, util.ConfigErrorf("invalid schedule %q: %v", spec, err)
+	}
+	return &ScheduledPipeline{Spec: spec, NewPipeline: newPipeline, schedule: schedule}, nil
+}
+
+// Next returns when the next run is due after t.
+func (s *ScheduledPipeline) Next(t time.Time) time.Time {
+	if s.Location != nil {
+		t = t.In(s.Location)
+	}
+	return s.schedule.Next(t)
+}
+
+// Run runs the Pipeline on the schedule until ctx is done. Running
+// Pipelines are run with ctx, so they are cancelled too, and Run waits
+// for them to finish before returning ctx.Err(). Failed runs are logged
+// and reported to OnRun, but don't stop the schedule.
+func (s *ScheduledPipeline) Run(ctx context.Context) error {
+	logger.Status("Schedule:", s.Spec, "- next run at", s.Next(time.Now()))
+	for {
+		now := time.Now()
+		next := s.Next(now)
+		delay := next.Sub(now)
+		if s.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(s.Jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.wg.Wait()
+			return ctx.Err()
+		case <-timer.C:
+			s.trigger(ctx, next)
+		}
+	}
+}
+
+// trigger starts, queues or skips a run that's due.
+func (s *ScheduledPipeline) trigger(ctx context.Context, scheduled time.Time) {
+	s.mutex.Lock()
+	if s.running > 0 && s.Overlap != OverlapConcurrent {
+		if s.Overlap == OverlapQueue && s.queued == nil {
+			s.queued = &scheduled
+			s.mutex.Unlock()
+			logger.Info("Schedule:", s.Spec, "- previous run is still going, queueing run due at", scheduled)
+			return
+		}
+		s.mutex.Unlock()
+		logger.Status("Schedule:", s.Spec, "- previous run is still going, skipping run due at", scheduled)
+		s.report(ScheduledRun{Scheduled: scheduled, Skipped: true})
+		return
+	}
+	s.running++
+	s.mutex.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.run(ctx, scheduled)
+			s.mutex.Lock()
+			if s.queued == nil || ctx.Err() != nil {
+				s.queued = nil
+				s.running--
+				s.mutex.Unlock()
+				return
+			}
+			scheduled = *s.queued
+			s.queued = nil
+			s.mutex.Unlock()
+		}
+	}()
+}
+
+func (s *ScheduledPipeline) run(ctx context.Context, scheduled time.Time) {
+	s.mutex.Lock()
+	s.runs++
+	run := ScheduledRun{Number: s.runs, Scheduled: scheduled, Start: time.Now()}
+	s.mutex.Unlock()
+
+	var p *Pipeline
+	p, run.Err = s.NewPipeline()
+	if run.Err == nil {
+		logger.Status("Schedule:", s.Spec, "- starting run", run.Number, "of", p.Name)
+		run.Err = <-p.RunContext(ctx)
+		run.RunID = p.RunID()
+		run.Stats = p.StatsReport()
+	}
+	run.Duration = time.Since(run.Start)
+
+	if run.Err != nil {
+		logger.Error("Schedule:", s.Spec, "- run", run.Number, "failed -", run.Err)
+	} else {
+		logger.Status("Schedule:", s.Spec, "- run", run.Number, "finished in", run.Duration)
+	}
+	s.report(run)
+}
+
+func (s *ScheduledPipeline) report(run ScheduledRun) {
+	if s.OnRun != nil {
+		s.OnRun(run)
+	}
+}
+
+func (s *ScheduledPipeline) String() string {
+	return "ScheduledPipeline(" + s.Spec + ")"
+}
@@ -0,0 +1,150 @@
+package ratchet_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func TestScheduledPipelineNext(t *testing.T) {
+	newYork := time.FixedZone("EST", -5*60*60)
+	tests := []struct {
+		spec     string
+		location *time.Location
+		after    time.Time
+		want     time.Time
+	}{
+		{"0 9 * * *", time.UTC, time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.UTC, time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)},
+		// 9:00 in New York is 14:00 UTC, so it's still due the same day.
+		{"0 9 * * *", newYork, time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 14, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", newYork, time.Date(2026, 1, 1, 12, 7, 0, 0, time.UTC), time.Date(2026, 1, 1, 12, 15, 0, 0, time.UTC)},
+		{"@hourly", time.UTC, time.Date(2026, 1, 1, 12, 7, 0, 0, time.UTC), time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		s, err := ratchet.Schedule(test.spec, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Location = test.location
+		if got := s.Next(test.after); !got.Equal(test.want) {
+			t.Errorf("%v in %v after %v: got %v, want %v", test.spec, test.location, test.after, got, test.want)
+		}
+	}
+
+	if _, err := ratchet.Schedule("* * *", nil); err == nil {
+		t.Error("got no error for an invalid spec")
+	}
+}
+
+func TestScheduledPipelineRun(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	started := make(chan struct{})
+	s, err := ratchet.Schedule("@every 1s", func() (*ratchet.Pipeline, error) {
+		close(started)
+		// Runs until it's cancelled.
+		return ratchet.NewPipeline(waitForCancel{}, processors.NewIoWriter(ioutil.Discard)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Jitter = 200 * time.Millisecond
+	var runs []ratchet.ScheduledRun
+	var mutex sync.Mutex
+	s.OnRun = func(run ratchet.ScheduledRun) {
+		mutex.Lock()
+		runs = append(runs, run)
+		mutex.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run started")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Run returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return once cancelled")
+	}
+
+	// Run waits for the running Pipeline, which is cancelled too.
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runs))
+	}
+	run := runs[0]
+	if !errors.Is(run.Err, context.Canceled) {
+		t.Errorf("got run error %v, want context.Canceled", run.Err)
+	}
+	if delay := run.Start.Sub(run.Scheduled); delay < 0 || delay > s.Jitter+100*time.Millisecond {
+		t.Errorf("run started %v after it was due, want up to the %v jitter", delay, s.Jitter)
+	}
+}
+
+func TestScheduledPipelineRerun(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	runs := ratchet.NewCheckpointRunStore(ratchet.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json")))
+	newPipeline := func(err error) *ratchet.Pipeline {
+		p := ratchet.NewPipeline(sender{`{}`}, failer{err})
+		p.Name = "nightly"
+		p.RunStore = runs
+		return p
+	}
+	s, err := ratchet.Schedule("@every 1s", func() (*ratchet.Pipeline, error) {
+		return newPipeline(errors.New("connection refused")), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := make(chan ratchet.ScheduledRun, 10)
+	s.OnRun = func(run ratchet.ScheduledRun) {
+		failed <- run
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	var run ratchet.ScheduledRun
+	select {
+	case run = <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run finished")
+	}
+	cancel()
+	<-done
+
+	if run.Err == nil || run.RunID == "" {
+		t.Fatalf("got run %+v, want a failed run with its RunID", run)
+	}
+	// The scheduled run is a run of the Pipeline, so it can be re-run.
+	killChan, err := newPipeline(nil).Rerun(run.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-killChan:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Pipeline didn't finish")
+	}
+}
@@ -0,0 +1,208 @@
+package ratchet
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StallError is sent on the killChan when a DataProcessor makes no
+// progress for longer than its stage's timeout (see
+// Pipeline.StageTimeout). Like other errors, it's wrapped in a
+// PipelineError naming the stage and DataProcessor that stalled.
+type StallError struct {
+	Timeout time.Duration
+	Call    string // "ProcessData" or "Finish"
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("stalled: no progress in %v for %v", e.Call, e.Timeout)
+}
+
+// DeadlineError is sent on the killChan by a Pipeline run with
+// RunWithTimeout that doesn't finish in time. errors.Is(err,
+// context.DeadlineExceeded) is true for it.
+type DeadlineError struct {
+	Pipeline string
+	Timeout  time.Duration
+	// Running lists the DataProcessors that hadn't finished yet.
+	Running []ProcessorInfo
+}
+
+func (e *DeadlineError) Error() string {
+	running := make([]string, len(e.Running))
+	for i, info := range e.Running {
+		running[i] = fmt.Sprintf("stage %d %v", info.Stage, info.Processor)
+	}
+	return fmt.Sprintf("%v - didn't finish within %v, still running: %v", e.Pipeline, e.Timeout, strings.Join(running, ", "))
+}
+
+// Unwrap returns context.DeadlineExceeded.
+func (e *DeadlineError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// RunWithTimeout is the same as Run, but the Pipeline is cancelled if it
+// hasn't finished within timeout, as by RunContext, and a *DeadlineError
+// listing the DataProcessors still running is sent to the killChan. It
+// puts a bound on jobs that must not hang, such as nightly loads; see also
+// StageTimeout, which stops a Pipeline as soon as a stage stalls.
+func (p *Pipeline) RunWithTimeout(timeout time.Duration) (killChan chan error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	p.timeout = timeout
+	killChan = make(chan error, 1)
+	go func() {
+		defer cancel()
+		killChan <- <-p.runContext(ctx, true)
+	}()
+	return killChan
+}
+
+// deadlineError returns the error sent when a run with RunWithTimeout
+// reaches its deadline.
+func (p *Pipeline) deadlineError() error {
+	e := &DeadlineError{Pipeline: p.Name, Timeout: p.timeout}
+	for n, stage := range p.layout.stages {
+		for i, dp := range stage.processors {
+			if !dp.activity.isFinished() {
+				e.Running = append(e.Running, processorInfo(n, i, dp))
+			}
+		}
+	}
+	return e
+}
+
+// activity tracks a dataProcessor's progress, for StageTimeout. Progress
+// is a ProcessData or Finish call starting or returning, or data being
+// sent on. Time spent waiting for the next stage to take data isn't
+// counted, since that stage is the one that's stalled.
+type activity struct {
+	calls    int    // ProcessData or Finish calls in progress
+	call     string // The name of the latest call
+	blocked  int    // Sends waiting for the next stage
+	last     time.Time
+	finished bool
+	mutex    sync.Mutex
+}
+
+func (a *activity) start(call string) {
+	a.mutex.Lock()
+	a.calls++
+	a.call = call
+	a.last = time.Now()
+	a.mutex.Unlock()
+}
+
+func (a *activity) end() {
+	a.mutex.Lock()
+	a.calls--
+	a.last = time.Now()
+	a.mutex.Unlock()
+}
+
+func (a *activity) progressed() {
+	a.mutex.Lock()
+	a.last = time.Now()
+	a.mutex.Unlock()
+}
+
+// block records that a send is waiting for the next stage, until the
+// returned function is called.
+func (a *activity) block() func() {
+	a.mutex.Lock()
+	a.blocked++
+	a.mutex.Unlock()
+	return func() {
+		a.mutex.Lock()
+		a.blocked--
+		a.last = time.Now()
+		a.mutex.Unlock()
+	}
+}
+
+func (a *activity) finish() {
+	a.mutex.Lock()
+	a.finished = true
+	a.mutex.Unlock()
+}
+
+func (a *activity) isFinished() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.finished
+}
+
+// stalled returns the call that has made no progress for timeout, if any.
+func (a *activity) stalled(timeout time.Duration, now time.Time) (string, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.calls == 0 || a.blocked > 0 || now.Sub(a.last) <= timeout {
+		return "", false
+	}
+	return a.call, true
+}
+
+// stageTimeout returns the timeout of the stage at the given index.
+func (p *Pipeline) stageTimeout(n int) time.Duration {
+	if stage := p.layout.stages[n]; stage.hasTimeout {
+		return stage.timeout
+	}
+	return p.StageTimeout
+}
+
+// watchStalls starts checking for stalled DataProcessors, if any stage has
+// a timeout. The first to stall has a StallError sent for it, and the
+// Pipeline is cancelled. The returned function stops checking.
+func (p *Pipeline) watchStalls(cancel context.CancelFunc) (stop func()) {
+	var interval time.Duration
+	for n := range p.layout.stages {
+		if t := p.stageTimeout(n); t > 0 && (interval == 0 || t/4 < interval) {
+			interval = t / 4
+		}
+	}
+	if interval == 0 {
+		return func() {}
+	}
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for n, stage := range p.layout.stages {
+					timeout := p.stageTimeout(n)
+					if timeout <= 0 {
+						continue
+					}
+					for _, dp := range stage.processors {
+						call, stalled := dp.activity.stalled(timeout, now)
+						if !stalled {
+							continue
+						}
+						cancel()
+						select {
+						case dp.errors.killChan <- &StallError{Timeout: timeout, Call: call}:
+						case <-done:
+						}
+						return
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
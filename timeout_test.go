@@ -0,0 +1,39 @@
+package ratchet_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fefelovgroup/ratchet"
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/processors"
+)
+
+func ExamplePipeline_StageTimeout() {
+	logger.LogLevel = logger.LevelSilent
+
+	hello := processors.NewIoReader(strings.NewReader("Hello world!"))
+	// A transform that hangs, e.g. on a lock or a remote call without a
+	// timeout.
+	hang := processors.NewFuncTransformer(func(d data.JSON) data.JSON {
+		time.Sleep(time.Second)
+		return d
+	})
+	stdout := processors.NewIoWriter(os.Stdout)
+	pipeline := ratchet.NewPipeline(hello, hang, stdout)
+	pipeline.StageTimeout = 100 * time.Millisecond
+
+	err := <-pipeline.Run()
+
+	var stall *ratchet.StallError
+	if errors.As(err, &stall) {
+		fmt.Println(err)
+	}
+
+	// Output:
+	// Pipeline - stage 2 FuncTransformer: stalled: no progress in ProcessData for 100ms
+}
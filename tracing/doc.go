@@ -0,0 +1,3 @@
+// Package tracing instruments ratchet Pipelines with OpenTelemetry traces,
+// so slow stages can be identified in existing APM setups.
+package tracing
@@ -0,0 +1,196 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/fefelovgroup/ratchet"
+
+// OTelObserver is a ratchet.Observer that records OpenTelemetry spans:
+// one span per Pipeline run, a child span for each DataProcessor in each
+// stage, and a child span of that for every batch (ProcessData call).
+// Spans carry record and byte counts, and errors sent by a DataProcessor
+// mark its stage span and the pipeline span as failed.
+//
+//	observer := tracing.NewOTelObserver(tracerProvider)
+//	pipeline.AddObserver(observer)
+//	err := <-pipeline.RunContext(ctx)
+//
+// The pipeline span is a child of any span in the context passed to
+// Pipeline.RunContext. One OTelObserver can be added to many Pipelines.
+type OTelObserver struct {
+	tracer trace.Tracer
+	runs   map[*ratchet.Pipeline]*tracedRun
+	mutex  sync.Mutex
+}
+
+type tracedRun struct {
+	ctx    context.Context
+	span   trace.Span
+	stages map[ratchet.ProcessorInfo]*tracedStage
+}
+
+type tracedStage struct {
+	ctx     context.Context
+	span    trace.Span
+	batches int
+	records int
+	bytes   int
+	errors  int
+}
+
+// NewOTelObserver returns a new OTelObserver using the given
+// TracerProvider, or the global TracerProvider if tp is nil.
+func NewOTelObserver(tp trace.TracerProvider) *OTelObserver {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &OTelObserver{
+		tracer: tp.Tracer(instrumentationName),
+		runs:   make(map[*ratchet.Pipeline]*tracedRun),
+	}
+}
+
+// NewOTLPTracerProvider returns a TracerProvider that batches spans and
+// exports them via OTLP over HTTP. By default spans are sent to
+// localhost:4318; use opts or the standard OTEL_EXPORTER_OTLP_* environment
+// variables to configure the exporter. Call Shutdown on the returned
+// TracerProvider before exiting to flush any remaining spans.
+func NewOTLPTracerProvider(ctx context.Context, opts ...otlptracehttp.Option) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter)), nil
+}
+
+// PipelineStarted starts the pipeline span.
+func (o *OTelObserver) PipelineStarted(ctx context.Context, p *ratchet.Pipeline) {
+	ctx, span := o.tracer.Start(ctx, "ratchet.pipeline "+p.Name,
+		trace.WithAttributes(attribute.String("ratchet.pipeline", p.Name)))
+	o.mutex.Lock()
+	o.runs[p] = &tracedRun{ctx: ctx, span: span, stages: make(map[ratchet.ProcessorInfo]*tracedStage)}
+	o.mutex.Unlock()
+}
+
+// PipelineFinished ends the pipeline span, along with any stage spans
+// that are still open (which happens if the Pipeline was killed).
+func (o *OTelObserver) PipelineFinished(p *ratchet.Pipeline, err error) {
+	o.mutex.Lock()
+	run, ok := o.runs[p]
+	delete(o.runs, p)
+	o.mutex.Unlock()
+	if !ok {
+		return
+	}
+	for _, stage := range run.stages {
+		o.endStage(stage)
+	}
+	if err != nil {
+		run.span.RecordError(err)
+		run.span.SetStatus(codes.Error, err.Error())
+	}
+	run.span.End()
+}
+
+// StageStarted starts a span for the DataProcessor.
+func (o *OTelObserver) StageStarted(p *ratchet.Pipeline, info ratchet.ProcessorInfo) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	run, ok := o.runs[p]
+	if !ok {
+		return
+	}
+	ctx, span := o.tracer.Start(run.ctx, fmt.Sprintf("ratchet.stage %d %v", info.Stage, info.Processor),
+		trace.WithAttributes(processorAttributes(p, info)...))
+	run.stages[info] = &tracedStage{ctx: ctx, span: span}
+}
+
+// StageFinished ends the DataProcessor's span.
+func (o *OTelObserver) StageFinished(p *ratchet.Pipeline, info ratchet.ProcessorInfo) {
+	o.mutex.Lock()
+	stage := o.stage(p, info)
+	if stage != nil {
+		delete(o.runs[p].stages, info)
+	}
+	o.mutex.Unlock()
+	if stage != nil {
+		o.endStage(stage)
+	}
+}
+
+// BatchProcessed records a span for the ProcessData call.
+func (o *OTelObserver) BatchProcessed(p *ratchet.Pipeline, batch ratchet.BatchInfo) {
+	o.mutex.Lock()
+	stage := o.stage(p, batch.ProcessorInfo)
+	if stage != nil {
+		stage.batches++
+		stage.records += batch.Records
+		stage.bytes += batch.Bytes
+	}
+	o.mutex.Unlock()
+	if stage == nil {
+		return
+	}
+	attrs := append(processorAttributes(p, batch.ProcessorInfo),
+		attribute.Int("ratchet.records", batch.Records),
+		attribute.Int("ratchet.bytes", batch.Bytes))
+	_, span := o.tracer.Start(stage.ctx, "ratchet.batch "+batch.Processor,
+		trace.WithTimestamp(batch.Start), trace.WithAttributes(attrs...))
+	span.End(trace.WithTimestamp(batch.Start.Add(batch.Duration)))
+}
+
+// ErrorSent records the error on the DataProcessor's span.
+func (o *OTelObserver) ErrorSent(p *ratchet.Pipeline, info ratchet.ProcessorInfo, err error) {
+	o.mutex.Lock()
+	stage := o.stage(p, info)
+	if stage != nil {
+		stage.errors++
+	}
+	o.mutex.Unlock()
+	if stage == nil {
+		return
+	}
+	stage.span.RecordError(err)
+	stage.span.SetStatus(codes.Error, err.Error())
+}
+
+// stage must be called with the mutex held.
+func (o *OTelObserver) stage(p *ratchet.Pipeline, info ratchet.ProcessorInfo) *tracedStage {
+	run, ok := o.runs[p]
+	if !ok {
+		return nil
+	}
+	return run.stages[info]
+}
+
+func (o *OTelObserver) endStage(stage *tracedStage) {
+	o.mutex.Lock()
+	attrs := []attribute.KeyValue{
+		attribute.Int("ratchet.batches", stage.batches),
+		attribute.Int("ratchet.records", stage.records),
+		attribute.Int("ratchet.bytes", stage.bytes),
+		attribute.Int("ratchet.errors", stage.errors),
+	}
+	o.mutex.Unlock()
+	stage.span.SetAttributes(attrs...)
+	stage.span.End()
+}
+
+func processorAttributes(p *ratchet.Pipeline, info ratchet.ProcessorInfo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("ratchet.pipeline", p.Name),
+		attribute.Int("ratchet.stage", info.Stage),
+		attribute.String("ratchet.processor", info.Processor),
+	}
+}
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// AdaptiveBatchSize adjusts the size of the batches a writer sends as it
+// goes, instead of relying on a single static BatchSize guess: a batch that
+// takes longer than TargetLatency shrinks the size in proportion, one that
+// fails halves it (unless the error is a ConfigInvalid one, which no batch
+// size fixes), and a full batch taking less than half of TargetLatency grows
+// it by a quarter. The size stays between Min and Max, and starts at
+// Initial.
+//
+// It's safe for concurrent use, so concurrent ProcessData calls share what
+// they observe.
+type AdaptiveBatchSize struct {
+	Initial       int           // Defaults to Min
+	Min           int           // Defaults to 1
+	Max           int           // Defaults to 10000
+	TargetLatency time.Duration // Defaults to 1 second
+
+	size  int
+	mutex sync.Mutex
+}
+
+// NewAdaptiveBatchSize returns a new AdaptiveBatchSize starting at initial,
+// and aiming for batches that take targetLatency.
+func NewAdaptiveBatchSize(initial, min, max int, targetLatency time.Duration) *AdaptiveBatchSize {
+	return &AdaptiveBatchSize{Initial: initial, Min: min, Max: max, TargetLatency: targetLatency}
+}
+
+// Size returns the size of the next batch.
+func (a *AdaptiveBatchSize) Size() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.current()
+}
+
+func (a *AdaptiveBatchSize) current() int {
+	if a.size == 0 {
+		a.size = a.clamp(a.Initial)
+	}
+	return a.size
+}
+
+func (a *AdaptiveBatchSize) clamp(size int) int {
+	min, max := a.Min, a.Max
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = 10000
+	}
+	if max < min {
+		max = min
+	}
+	if size < min {
+		return min
+	}
+	if size > max {
+		return max
+	}
+	return size
+}
+
+// Observe adjusts the size after a batch of n items took latency to write,
+// and failed with err if it isn't nil.
+func (a *AdaptiveBatchSize) Observe(n int, latency time.Duration, err error) {
+	target := a.TargetLatency
+	if target <= 0 {
+		target = time.Second
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	size := a.current()
+	next := size
+	switch {
+	case err != nil:
+		if ErrorCategoryOf(err) == CategoryConfigInvalid {
+			return
+		}
+		next = n / 2
+	case latency > target:
+		next = int(float64(n) * float64(target) / float64(latency))
+	case latency < target/2 && n >= size:
+		next = size + size/4 + 1
+	}
+	next = a.clamp(next)
+	if next != size {
+		logger.Debug("AdaptiveBatchSize: batch of", n, "took", latency, "error:", err, "- batch size", size, "->", next)
+		a.size = next
+	}
+}
+
+// ForEachAdaptiveBatch is like ForEachBatch with a single worker, but the
+// size of each batch is chosen by a, which observes how long fn takes for
+// it and whether it fails.
+func ForEachAdaptiveBatch(objects []map[string]interface{}, a *AdaptiveBatchSize, fn func(batch []map[string]interface{}) error) error {
+	for len(objects) > 0 {
+		n := a.Size()
+		if n > len(objects) {
+			n = len(objects)
+		}
+		start := time.Now()
+		err := fn(objects[:n])
+		a.Observe(n, time.Since(start), err)
+		if err != nil {
+			return err
+		}
+		objects = objects[n:]
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package util_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/logger"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func TestAdaptiveBatchSizeObserve(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	failed := errors.New("deadlock")
+	tests := []struct {
+		name    string
+		a       *util.AdaptiveBatchSize
+		n       int
+		latency time.Duration
+		err     error
+		want    int
+	}{
+		{"grows after a fast batch", &util.AdaptiveBatchSize{Initial: 100, TargetLatency: time.Second}, 100, 100 * time.Millisecond, nil, 126},
+		{"keeps a partial batch's size", &util.AdaptiveBatchSize{Initial: 100, TargetLatency: time.Second}, 50, 100 * time.Millisecond, nil, 100},
+		{"keeps a batch near the target", &util.AdaptiveBatchSize{Initial: 100, TargetLatency: time.Second}, 100, 800 * time.Millisecond, nil, 100},
+		{"shrinks after a slow batch", &util.AdaptiveBatchSize{Initial: 100, TargetLatency: time.Second}, 100, 4 * time.Second, nil, 25},
+		{"halves after a failed batch", &util.AdaptiveBatchSize{Initial: 100, TargetLatency: time.Second}, 100, 100 * time.Millisecond, failed, 50},
+		{"ignores config errors", &util.AdaptiveBatchSize{Initial: 100, TargetLatency: time.Second}, 100, 100 * time.Millisecond, util.ConfigErrorf("no such table"), 100},
+		{"targets 1 second by default", &util.AdaptiveBatchSize{Initial: 100}, 100, 2 * time.Second, nil, 50},
+		{"stops at Max", &util.AdaptiveBatchSize{Initial: 100, Max: 110, TargetLatency: time.Second}, 100, 100 * time.Millisecond, nil, 110},
+		{"stops at Min", &util.AdaptiveBatchSize{Initial: 100, Min: 40, TargetLatency: time.Second}, 100, 10 * time.Second, nil, 40},
+		{"stops failures at Min", &util.AdaptiveBatchSize{Initial: 10, Min: 8, TargetLatency: time.Second}, 10, 100 * time.Millisecond, failed, 8},
+		{"stops at 1 by default", &util.AdaptiveBatchSize{Initial: 2, TargetLatency: time.Second}, 2, 100 * time.Second, nil, 1},
+		{"stops at 10000 by default", &util.AdaptiveBatchSize{Initial: 9000, TargetLatency: time.Second}, 9000, 100 * time.Millisecond, nil, 10000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.a.Observe(test.n, test.latency, test.err)
+			if got := test.a.Size(); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveBatchSizeInitial(t *testing.T) {
+	tests := []struct {
+		initial, min, max int
+		want              int
+	}{
+		{50, 10, 100, 50},
+		{0, 10, 100, 10},
+		{5, 10, 100, 10},
+		{500, 10, 100, 100},
+		{0, 0, 0, 1},
+		{50000, 0, 0, 10000},
+		// Max is raised to Min.
+		{50, 60, 40, 60},
+	}
+	for _, test := range tests {
+		a := util.NewAdaptiveBatchSize(test.initial, test.min, test.max, time.Second)
+		if got := a.Size(); got != test.want {
+			t.Errorf("initial %d, min %d, max %d: got %d, want %d", test.initial, test.min, test.max, got, test.want)
+		}
+	}
+}
+
+func TestForEachAdaptiveBatch(t *testing.T) {
+	logger.LogLevel = logger.LevelSilent
+
+	objects := make([]map[string]interface{}, 30)
+	a := util.NewAdaptiveBatchSize(4, 1, 8, time.Second)
+	var sizes []int
+	err := util.ForEachAdaptiveBatch(objects, a, func(batch []map[string]interface{}) error {
+		sizes = append(sizes, len(batch))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each fast batch grows the next one, up to Max.
+	if want := []int{4, 6, 8, 8, 4}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("got batches of %v, want %v", sizes, want)
+	}
+
+	// A failed batch stops the loop, and halves the size.
+	sizes = nil
+	err = util.ForEachAdaptiveBatch(objects, a, func(batch []map[string]interface{}) error {
+		sizes = append(sizes, len(batch))
+		return errors.New("deadlock")
+	})
+	if err == nil || !reflect.DeepEqual(sizes, []int{8}) || a.Size() != 4 {
+		t.Errorf("got %v after batches of %v and size %d, want an error after a batch of 8 and size 4", err, sizes, a.Size())
+	}
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// BatchErrors is returned by ForEachBatch when one or more batches failed
+// while being processed concurrently. Errors are ordered by batch.
+type BatchErrors []error
+
+func (e BatchErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d batch(es) failed: %v", len(e), strings.Join(msgs, "; "))
+}
+
+// ErrorCategory returns the category shared by all the batch errors,
+// or CategoryFatal if they differ.
+func (e BatchErrors) ErrorCategory() ErrorCategory {
+	if len(e) == 0 {
+		return CategoryFatal
+	}
+	c := ErrorCategoryOf(e[0])
+	for _, err := range e[1:] {
+		if ErrorCategoryOf(err) != c {
+			return CategoryFatal
+		}
+	}
+	return c
+}
+
+// ForEachBatch splits objects into batches of batchSize (a batchSize <= 0
+// means a single batch) and calls fn for each of them.
+//
+// If workers is 1 or less the batches are processed in order and the first
+// error is returned immediately. Otherwise up to workers batches are processed
+// concurrently, every batch is attempted, and any failures are combined into
+// a BatchErrors.
+func ForEachBatch(objects []map[string]interface{}, batchSize int, workers int, fn func(batch []map[string]interface{}) error) error {
+	batches := splitBatches(objects, batchSize)
+
+	if workers <= 1 || len(batches) <= 1 {
+		for _, b := range batches {
+			if err := fn(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(batches))
+	throttle := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, b := range batches {
+		wg.Add(1)
+		throttle <- struct{}{}
+		go func(i int, b []map[string]interface{}) {
+			defer wg.Done()
+			errs[i] = fn(b)
+			<-throttle
+		}(i, b)
+	}
+	wg.Wait()
+
+	var batchErrs BatchErrors
+	for i, err := range errs {
+		if err != nil {
+			batchErrs = append(batchErrs, NewCategorizedError(ErrorCategoryOf(err), fmt.Errorf("batch %d: %v", i+1, err)))
+		}
+	}
+	if len(batchErrs) > 0 {
+		return batchErrs
+	}
+	return nil
+}
+
+func splitBatches(objects []map[string]interface{}, batchSize int) [][]map[string]interface{} {
+	if batchSize <= 0 {
+		return [][]map[string]interface{}{objects}
+	}
+	batches := [][]map[string]interface{}{}
+	for i := 0; i < len(objects); i += batchSize {
+		maxIndex := i + batchSize
+		if maxIndex > len(objects) {
+			maxIndex = len(objects)
+		}
+		batches = append(batches, objects[i:maxIndex])
+	}
+	return batches
+}
@@ -0,0 +1,407 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a parsed boolean expression that can be evaluated against
+// JSON records, e.g.
+//
+//	region == "eu" && (amount > 100 || status != 'paid')
+//
+// Operands are field names, which can be dotted paths into nested objects
+// (customer.address.country), or literals: quoted strings, numbers, true,
+// false and null. The supported operators are ==, !=, <, <=, >, >=,
+// =~ (matches a regular expression), &&, || and !. A field on its own is
+// true if it is present and not null, false, 0 or "".
+//
+// Values are compared the way they were decoded from JSON: numbers are
+// compared numerically, strings lexically, and values of different types
+// are never equal (and never less or greater than each other).
+type Condition struct {
+	expr string
+	root conditionNode
+}
+
+// ParseCondition parses the given expression. See Condition.
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, ConfigErrorf("condition %q: %v", expr, err)
+	}
+	p := &conditionParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, ConfigErrorf("condition %q: %v", expr, err)
+	}
+	return &Condition{expr: expr, root: root}, nil
+}
+
+// Match evaluates the Condition against the record.
+func (c *Condition) Match(record map[string]interface{}) bool {
+	return truthy(c.root.eval(record))
+}
+
+func (c *Condition) String() string {
+	return c.expr
+}
+
+type conditionTokenKind int
+
+const (
+	tokenField conditionTokenKind = iota
+	tokenLiteral
+	tokenOp
+)
+
+type conditionToken struct {
+	kind  conditionTokenKind
+	text  string
+	value interface{} // for literals
+}
+
+var conditionOps = []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")"}
+
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(rs) && rs[j] != r; j++ {
+				if rs[j] == '\\' && j+1 < len(rs) {
+					j++
+				}
+				b.WriteRune(rs[j])
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, conditionToken{tokenLiteral, string(rs[i : j+1]), b.String()})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i + 1
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || strings.ContainsRune(".eE+-", rs[j])) {
+				j++
+			}
+			f, err := strconv.ParseFloat(string(rs[i:j]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", string(rs[i:j]))
+			}
+			tokens = append(tokens, conditionToken{tokenLiteral, string(rs[i:j]), f})
+			i = j
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || strings.ContainsRune("_$.", rs[j])) {
+				j++
+			}
+			text := string(rs[i:j])
+			switch text {
+			case "true":
+				tokens = append(tokens, conditionToken{tokenLiteral, text, true})
+			case "false":
+				tokens = append(tokens, conditionToken{tokenLiteral, text, false})
+			case "null":
+				tokens = append(tokens, conditionToken{tokenLiteral, text, nil})
+			default:
+				tokens = append(tokens, conditionToken{tokenField, text, nil})
+			}
+			i = j
+		default:
+			op := ""
+			for _, o := range conditionOps {
+				if strings.HasPrefix(string(rs[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", string(r))
+			}
+			tokens = append(tokens, conditionToken{tokenOp, op, nil})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) peekOp(ops ...string) string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenOp {
+		return ""
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("||") != "" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("&&") != "" {
+		p.pos++
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseComparison() (conditionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peekOp("==", "!=", "<", "<=", ">", ">=", "=~")
+	if op == "" {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" {
+		lit, ok := right.(literalNode)
+		s, isString := lit.value.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("=~ must be followed by a quoted regular expression")
+		}
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+		return matchNode{left, re}, nil
+	}
+	return compareNode{op, left, right}, nil
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch {
+	case t.kind == tokenField:
+		return fieldNode(t.text), nil
+	case t.kind == tokenLiteral:
+		return literalNode{t.value}, nil
+	case t.text == "!":
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case t.text == "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOp(")") == "" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+type conditionNode interface {
+	eval(record map[string]interface{}) interface{}
+}
+
+type fieldNode string
+
+func (n fieldNode) eval(record map[string]interface{}) interface{} {
+	v, _ := LookupField(record, string(n))
+	return v
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(record map[string]interface{}) interface{} {
+	return n.value
+}
+
+type notNode struct {
+	n conditionNode
+}
+
+func (n notNode) eval(record map[string]interface{}) interface{} {
+	return !truthy(n.n.eval(record))
+}
+
+type andNode struct {
+	left, right conditionNode
+}
+
+func (n andNode) eval(record map[string]interface{}) interface{} {
+	return truthy(n.left.eval(record)) && truthy(n.right.eval(record))
+}
+
+type orNode struct {
+	left, right conditionNode
+}
+
+func (n orNode) eval(record map[string]interface{}) interface{} {
+	return truthy(n.left.eval(record)) || truthy(n.right.eval(record))
+}
+
+type matchNode struct {
+	n  conditionNode
+	re *regexp.Regexp
+}
+
+func (n matchNode) eval(record map[string]interface{}) interface{} {
+	s, ok := n.n.eval(record).(string)
+	return ok && n.re.MatchString(s)
+}
+
+type compareNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n compareNode) eval(record map[string]interface{}) interface{} {
+	l, r := n.left.eval(record), n.right.eval(record)
+	switch n.op {
+	case "==":
+		return conditionEqual(l, r)
+	case "!=":
+		return !conditionEqual(l, r)
+	}
+	c, ok := conditionCompare(l, r)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func conditionFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func conditionEqual(l, r interface{}) bool {
+	if lf, ok := conditionFloat(l); ok {
+		rf, ok := conditionFloat(r)
+		return ok && lf == rf
+	}
+	switch lv := l.(type) {
+	case nil:
+		return r == nil
+	case string:
+		rv, ok := r.(string)
+		return ok && lv == rv
+	case bool:
+		rv, ok := r.(bool)
+		return ok && lv == rv
+	}
+	return false
+}
+
+// CompareValues compares two values decoded from JSON the same way as a
+// Condition does, returning -1, 0 or 1, and false if they can't be
+// compared (they aren't both numbers or both strings).
+func CompareValues(a, b interface{}) (int, bool) {
+	return conditionCompare(a, b)
+}
+
+func conditionCompare(l, r interface{}) (int, bool) {
+	if lf, ok := conditionFloat(l); ok {
+		rf, ok := conditionFloat(r)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case lf < rf:
+			return -1, true
+		case lf > rf:
+			return 1, true
+		}
+		return 0, true
+	}
+	ls, ok := l.(string)
+	rs, ok2 := r.(string)
+	if !ok || !ok2 {
+		return 0, false
+	}
+	return strings.Compare(ls, rs), true
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	}
+	if f, ok := conditionFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
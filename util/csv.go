@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"sort"
 
 	"github.com/fefelovgroup/ratchet/data"
@@ -24,61 +25,90 @@ func CSVString(v interface{}) string {
 // single struct for reuse in multiple processors
 type CSVParameters struct {
 	Writer        *CSVWriter
-	WriteHeader   bool
+	WriteHeader   bool // Set to false to suppress the header row
 	HeaderWritten bool
-	Header        []string
+	Header        []string // Explicit column order, defaults to the sorted keys of the first object
 	SendUpstream  bool
 	QuoteEscape   string
 	Comma         rune
+	Quoting       CSVQuoting // See CSVQuoting, overrides the Writer's quoting when set
+	NullValue     string     // Written for nil values and missing keys, defaults to ""
 }
 
 // CSVProcess writes the contents to the file and optionally sends the written bytes
-// upstream on outputChan
+// upstream on outputChan. Objects are decoded and written one at a time (see
+// data.NewDecoder), so a large payload isn't held in memory twice.
 func CSVProcess(params *CSVParameters, d data.JSON, outputChan chan data.JSON, killChan chan error) {
-	objects, err := data.ObjectsFromJSON(d)
-	KillPipelineIfErr(err, killChan)
+	if params.Comma != 0 {
+		params.Writer.Comma = params.Comma
+	}
+	if params.QuoteEscape != "" {
+		params.Writer.QuoteEscape = params.QuoteEscape
+	}
+	if params.Quoting != CSVQuoteDefault {
+		params.Writer.Quoting = params.Quoting
+	}
+
+	var b bytes.Buffer
+	if params.SendUpstream {
+		params.Writer.SetWriter(bufio.NewWriter(&b))
+	}
 
+	it := data.NewDecoder(bytes.NewReader(d))
+	for {
+		object, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			KillPipelineIfErr(DataInvalidError(err), killChan)
+			return
+		}
+		if err := csvWriteObject(params, object); err != nil {
+			KillPipelineIfErr(err, killChan)
+			return
+		}
+	}
+	err := params.Writer.WriteAll(nil)
+	if err != nil {
+		KillPipelineIfErr(err, killChan)
+		return
+	}
+
+	if params.SendUpstream && b.Len() > 0 {
+		outputChan <- []byte(b.String())
+	}
+}
+
+// csvWriteObject writes object as a row, after the header row if it's the
+// first one.
+func csvWriteObject(params *CSVParameters, object map[string]interface{}) error {
 	if params.Header == nil {
-		for k := range objects[0] {
+		for k := range object {
 			params.Header = append(params.Header, k)
 		}
 		sort.Strings(params.Header)
 	}
 
-	rows := [][]string{}
-
 	if params.WriteHeader && !params.HeaderWritten {
 		headerRow := []string{}
 		for _, k := range params.Header {
 			headerRow = append(headerRow, CSVString(k))
 		}
-		rows = append(rows, headerRow)
+		if err := params.Writer.Write(headerRow); err != nil {
+			return err
+		}
 		params.HeaderWritten = true
 	}
 
-	for _, object := range objects {
-		row := []string{}
-		for i := range params.Header {
-			v := object[params.Header[i]]
+	row := []string{}
+	for i := range params.Header {
+		v, ok := object[params.Header[i]]
+		if !ok || v == nil {
+			row = append(row, params.NullValue)
+		} else {
 			row = append(row, CSVString(v))
 		}
-		rows = append(rows, row)
-	}
-
-	if params.Comma != 0 {
-		params.Writer.Comma = params.Comma
-	}
-
-	if params.SendUpstream {
-		var b bytes.Buffer
-		params.Writer.SetWriter(bufio.NewWriter(&b))
-
-		err = params.Writer.WriteAll(rows)
-		KillPipelineIfErr(err, killChan)
-
-		outputChan <- []byte(b.String())
-	} else {
-		err = params.Writer.WriteAll(rows)
-		KillPipelineIfErr(err, killChan)
 	}
+	return params.Writer.Write(row)
 }
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewCSVEscapeReader wraps r so that quotes escaped with the given escape
+// character (e.g. \" as written by CSVWriter's default QuoteEscape) are
+// rewritten to the doubled quotes ("") expected by encoding/csv. If escape
+// is empty or already a quote, r is returned unchanged.
+func NewCSVEscapeReader(r io.Reader, escape string) io.Reader {
+	esc, size := utf8.DecodeRuneInString(escape)
+	if escape == "" || size != len(escape) || esc == '"' {
+		return r
+	}
+	return &csvEscapeReader{r: bufio.NewReader(r), escape: esc}
+}
+
+type csvEscapeReader struct {
+	r      *bufio.Reader
+	escape rune
+	buf    bytes.Buffer
+}
+
+func (e *csvEscapeReader) Read(p []byte) (int, error) {
+	for e.buf.Len() < len(p) {
+		c, _, err := e.r.ReadRune()
+		if err != nil {
+			if e.buf.Len() > 0 {
+				break
+			}
+			return 0, err
+		}
+		if c == e.escape {
+			next, _, err := e.r.ReadRune()
+			if err == nil && next == '"' {
+				e.buf.WriteString(`""`)
+				continue
+			}
+			e.buf.WriteRune(c)
+			if err == nil {
+				e.r.UnreadRune()
+			}
+			continue
+		}
+		e.buf.WriteRune(c)
+	}
+	return e.buf.Read(p)
+}
+
+// InferCSVValue is a type coercion hook that can be used with CSVReader. It
+// converts empty values to nil, and values that look like integers, finite
+// floats or booleans ("true" or "false", in any case) to their respective
+// types. Anything else, including "NaN", "Inf", "1" or "t" as booleans, is
+// left as a string.
+func InferCSVValue(column, value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return f, nil
+	}
+	switch {
+	case strings.EqualFold(value, "true"):
+		return true, nil
+	case strings.EqualFold(value, "false"):
+		return false, nil
+	}
+	return value, nil
+}
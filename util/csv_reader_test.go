@@ -0,0 +1,48 @@
+package util_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func TestInferCSVValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  interface{}
+	}{
+		{"", nil},
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"9.5", 9.5},
+		{"1e3", 1000.0},
+		// Too large for an int64.
+		{"9223372036854775808", 9223372036854775808.0},
+		{"true", true},
+		{"FALSE", false},
+		{"True", true},
+		// Numbers and abbreviations aren't booleans.
+		{"1", int64(1)},
+		{"0", int64(0)},
+		{"t", "t"},
+		{"F", "F"},
+		// Non-finite floats can't be written as JSON.
+		{"NaN", "NaN"},
+		{"Inf", "Inf"},
+		{"-Infinity", "-Infinity"},
+		{"1e400", "1e400"},
+		{"abc", "abc"},
+		{" 42", " 42"},
+	}
+	for _, test := range tests {
+		got, err := util.InferCSVValue("column", test.value)
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %#v, want %#v", test.value, got, test.want)
+		}
+	}
+}
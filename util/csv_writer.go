@@ -4,18 +4,37 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
+// CSVQuoting is a policy for which fields CSVWriter encloses in quotes.
+type CSVQuoting int
+
+const (
+	// CSVQuoteDefault quotes every field if AlwaysEncapsulate is set,
+	// otherwise it behaves like CSVQuoteMinimal.
+	CSVQuoteDefault CSVQuoting = iota
+	// CSVQuoteAll quotes every field.
+	CSVQuoteAll
+	// CSVQuoteMinimal only quotes fields that contain special characters.
+	CSVQuoteMinimal
+	// CSVQuoteNonNumeric quotes every non-empty field that doesn't parse as a number.
+	CSVQuoteNonNumeric
+	// CSVQuoteNone never quotes fields. Quote characters are still escaped.
+	CSVQuoteNone
+)
+
 // CSVWriter reimplements the standard library csv.Writer adding AlwaysEncapsulate and QuoteEscape
 type CSVWriter struct {
 	Comma             rune
 	UseCRLF           bool
 	w                 *bufio.Writer
-	AlwaysEncapsulate bool   // If the content should be encapsulated independent of its type
-	QuoteEscape       string // String to use to escape a quote character
+	AlwaysEncapsulate bool       // If the content should be encapsulated independent of its type
+	QuoteEscape       string     // String to use to escape a quote character
+	Quoting           CSVQuoting // Overrides AlwaysEncapsulate when not CSVQuoteDefault
 }
 
 // NewCSVWriter instantiates a new instance of CSVWriter
@@ -44,6 +63,9 @@ func (w *CSVWriter) Write(record []string) (err error) {
 		}
 
 		if !w.fieldNeedsQuotes(field) {
+			if w.Quoting == CSVQuoteNone {
+				field = strings.Replace(field, `"`, w.QuoteEscape+`"`, -1)
+			}
 			if _, err = w.w.WriteString(field); err != nil {
 				return
 			}
@@ -125,8 +147,22 @@ func (w *CSVWriter) WriteAll(records [][]string) (err error) {
 // of Microsoft Excel and Google Drive.
 // For Postgres, quote the data terminating string `\.`.
 func (w *CSVWriter) fieldNeedsQuotes(field string) bool {
-	if w.AlwaysEncapsulate {
+	switch w.Quoting {
+	case CSVQuoteAll:
 		return true
+	case CSVQuoteNone:
+		return false
+	case CSVQuoteNonNumeric:
+		if field == "" {
+			return false
+		}
+		if _, err := strconv.ParseFloat(field, 64); err != nil {
+			return true
+		}
+	case CSVQuoteDefault:
+		if w.AlwaysEncapsulate {
+			return true
+		}
 	}
 	if field == "" {
 		return false
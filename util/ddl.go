@@ -0,0 +1,119 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// CreateTableSQL builds a CREATE TABLE IF NOT EXISTS statement for
+// tableName, with a column for each field found in any of the objects (in
+// sorted order), to create a table for them or scaffold its schema. Each
+// column's type is inferred from its values as by InferSchema:
+//
+//   - booleans are BOOLEAN,
+//   - numbers are BIGINT if they're all integers, otherwise DOUBLE PRECISION,
+//   - strings are DATE if they're all dates, TIMESTAMP if they're all dates
+//     or timestamps, otherwise TEXT,
+//   - objects or arrays are JSON (JSONB with PostgreSQL),
+//   - columns with values of several other types, or only NULLs, are TEXT.
+//
+// The types are adjusted to the dialect, e.g. MySQL's DATETIME(6),
+// PostgreSQL's TIMESTAMPTZ and SQLite's INTEGER and REAL. primaryKeys, if
+// any, are declared as the table's PRIMARY KEY (and NOT NULL), and must be
+// fields of the objects. With MySQL, text primary keys are VARCHAR(255),
+// since TEXT columns can't be keys. Names are used as they are, as in
+// BuildInsertSQL.
+func CreateTableSQL(objects []map[string]interface{}, tableName string, dialect Dialect, primaryKeys ...string) (string, error) {
+	if err := validateSQLNames(tableName, objects); err != nil {
+		return "", err
+	}
+	schema, err := objectsSchema(objects)
+	if err != nil {
+		return "", err
+	}
+	cols := schema.Columns()
+	if len(cols) == 0 {
+		return "", DataErrorf("no fields to create %v with", tableName)
+	}
+	isKey := map[string]bool{}
+	for _, k := range primaryKeys {
+		if _, ok := schema.Column(k); !ok {
+			return "", ConfigErrorf("primary key %v isn't a field of the records", k)
+		}
+		isKey[k] = true
+	}
+
+	defs := make([]string, 0, len(cols)+1)
+	for _, col := range cols {
+		def := col.Name + " " + columnType(dialect, col.Type, isKey[col.Name])
+		if isKey[col.Name] {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+	if len(primaryKeys) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%v)", strings.Join(primaryKeys, ", ")))
+	}
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (%v)", tableName, strings.Join(defs, ", ")), nil
+}
+
+// objectsSchema returns the Schema of objects, see InferSchema.
+func objectsSchema(objects []map[string]interface{}) (*Schema, error) {
+	d, err := data.NewJSON(objects)
+	if err != nil {
+		return nil, DataInvalidError(err)
+	}
+	return InferSchema(d)
+}
+
+// columnType returns dialect's type for a column of type t.
+func columnType(dialect Dialect, t SchemaType, isKey bool) string {
+	switch dialect {
+	case MySQL:
+		switch t {
+		case SchemaFloat:
+			return "DOUBLE"
+		case SchemaTimestamp:
+			return "DATETIME(6)"
+		case SchemaNull, SchemaString:
+			if isKey {
+				return "VARCHAR(255)"
+			}
+		}
+	case SQLite:
+		switch t {
+		case SchemaInteger:
+			return "INTEGER"
+		case SchemaFloat:
+			return "REAL"
+		case SchemaTimestamp:
+			return "DATETIME"
+		case SchemaObject, SchemaArray:
+			return "TEXT"
+		}
+	case PostgreSQL:
+		switch t {
+		case SchemaTimestamp:
+			return "TIMESTAMPTZ"
+		case SchemaObject, SchemaArray:
+			return "JSONB"
+		}
+	}
+	switch t {
+	case SchemaBoolean:
+		return "BOOLEAN"
+	case SchemaInteger:
+		return "BIGINT"
+	case SchemaFloat:
+		return "DOUBLE PRECISION"
+	case SchemaDate:
+		return "DATE"
+	case SchemaTimestamp:
+		return "TIMESTAMP"
+	case SchemaObject, SchemaArray:
+		return "JSON"
+	}
+	return "TEXT"
+}
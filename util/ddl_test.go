@@ -0,0 +1,52 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func TestCreateTableSQL(t *testing.T) {
+	at := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		objects     []map[string]interface{}
+		dialect     util.Dialect
+		primaryKeys []string
+		want        string
+	}{
+		{"types", []map[string]interface{}{
+			{"id": 1.0, "amount": 9.5, "active": true, "day": "2026-10-17", "at": at, "tags": []interface{}{"a"}, "note": nil},
+			{"id": int64(2), "amount": 10.0, "active": false, "day": "2026-10-18", "at": "2026-10-17 09:30:00", "tags": []interface{}{}, "note": nil},
+		}, util.PostgreSQL, nil,
+			"CREATE TABLE IF NOT EXISTS t (active BOOLEAN, amount DOUBLE PRECISION, at TIMESTAMPTZ, day DATE, id BIGINT, note TEXT, tags JSONB)"},
+		{"widened", []map[string]interface{}{
+			{"day": "2026-10-17", "mixed": 1.0, "sparse": "a"},
+			{"day": "2026-10-17T09:30:00Z", "mixed": "one"},
+		}, util.SQLite, nil,
+			"CREATE TABLE IF NOT EXISTS t (day DATETIME, mixed TEXT, sparse TEXT)"},
+		{"primary keys", []map[string]interface{}{
+			{"code": "a", "n": 1.0, "value": 0.5},
+		}, util.MySQL, []string{"code", "n"},
+			"CREATE TABLE IF NOT EXISTS t (code VARCHAR(255) NOT NULL, n BIGINT NOT NULL, value DOUBLE, PRIMARY KEY (code, n))"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := util.CreateTableSQL(test.objects, "t", test.dialect, test.primaryKeys...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if _, err := util.CreateTableSQL([]map[string]interface{}{{"id": 1}}, "t", util.SQLite, "code"); util.ErrorCategoryOf(err) != util.CategoryConfigInvalid {
+		t.Errorf("got error %v for a missing primary key, want a config error", err)
+	}
+	if _, err := util.CreateTableSQL(nil, "t", util.SQLite); util.ErrorCategoryOf(err) != util.CategoryDataInvalid {
+		t.Errorf("got error %v without fields, want a data error", err)
+	}
+}
@@ -0,0 +1,166 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect describes how a database's SQL differs from the others, so the
+// same code can build statements for any of them. See BuildInsertSQL.
+type Dialect interface {
+	// Name returns the dialect's name, e.g. "postgresql".
+	Name() string
+	// Placeholder returns the placeholder for the nth value bound to a
+	// statement, starting at 1. Queries written with named parameters
+	// (:name) can be converted to placeholders with BindNamedParams.
+	Placeholder(n int) string
+	// QuoteIdentifier quotes a table or column name, so it can be a
+	// reserved word or contain any character. Qualified names, such as
+	// schema.table, are quoted part by part.
+	QuoteIdentifier(name string) string
+	// Upsert returns the verb starting an INSERT that updates existing
+	// rows instead of failing, and the clause to follow its VALUES. Rows
+	// conflict on keys (which not every database needs), and updateCols
+	// are updated.
+	Upsert(keys, updateCols []string) (verb, clause string)
+}
+
+// The supported dialects.
+var (
+	MySQL      Dialect = mysqlDialect{}
+	PostgreSQL Dialect = postgreSQLDialect{}
+	SQLite     Dialect = sqliteDialect{}
+)
+
+// DialectFor returns the Dialect for a database/sql driver name, as
+// returned by sqlx.DB.DriverName.
+func DialectFor(driverName string) (Dialect, error) {
+	switch driverName {
+	case "mysql":
+		return MySQL, nil
+	case "postgres", "pgx", "pgx/v5", "redshift":
+		return PostgreSQL, nil
+	case "sqlite3", "sqlite":
+		return SQLite, nil
+	}
+	return nil, ConfigErrorf("no SQL dialect for driver %q", driverName)
+}
+
+// BuildInsertSQL builds a single INSERT of every object into tableName,
+// returning the statement and the values to bind to it. The columns are
+// the keys found in any of the objects, in sorted order, and missing
+// values are inserted as NULL. Column names are used as they are, since
+// quoting makes them case sensitive in some databases, so check names that
+// come from the data with ValidateSQLTableName and ValidateSQLColumns.
+//
+// If upsert is true, rows that conflict with existing ones (on keys, see
+// Dialect.Upsert) update them instead, setting updateCols, or every
+// column if updateCols is empty.
+func BuildInsertSQL(dialect Dialect, objects []map[string]interface{}, tableName string, upsert bool, keys, updateCols []string) (string, []interface{}) {
+	cols := sortedColumns(objects)
+
+	verb, clause := "INSERT", ""
+	if upsert {
+		if len(updateCols) == 0 {
+			updateCols = cols
+		}
+		verb, clause = dialect.Upsert(keys, updateCols)
+	}
+
+	// Format: INSERT INTO tablename(col1,col2) VALUES(?,?),(?,?)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v INTO %v(%v) VALUES", verb, tableName, strings.Join(cols, ","))
+	vals := make([]interface{}, 0, len(objects)*len(cols))
+	for i, obj := range objects {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('(')
+		for j, col := range cols {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(dialect.Placeholder(len(vals) + 1))
+			vals = append(vals, obj[col])
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString(clause)
+	return b.String(), vals
+}
+
+func quoteIdentifier(name string, quote string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.Replace(part, quote, quote+quote, -1) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, "`")
+}
+
+// Upsert uses ON DUPLICATE KEY UPDATE, which conflicts on any unique key.
+func (d mysqlDialect) Upsert(keys, updateCols []string) (string, string) {
+	// format: ON DUPLICATE KEY UPDATE a=VALUES(a), b=VALUES(b), c=VALUES(c)
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = fmt.Sprintf("%v=VALUES(%v)", d.QuoteIdentifier(c), d.QuoteIdentifier(c))
+	}
+	return "INSERT", " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+type postgreSQLDialect struct{}
+
+func (postgreSQLDialect) Name() string {
+	return "postgresql"
+}
+
+func (postgreSQLDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgreSQLDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`)
+}
+
+// Upsert uses ON CONFLICT, with keys as the conflict target: see
+// https://www.postgresql.org/docs/9.5/static/sql-insert.html
+func (postgreSQLDialect) Upsert(keys, updateCols []string) (string, string) {
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = fmt.Sprintf("%v=EXCLUDED.%v", c, c)
+	}
+	return "INSERT", fmt.Sprintf(" ON CONFLICT (%v) DO UPDATE SET %v", strings.Join(keys, ","), strings.Join(sets, ","))
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return quoteIdentifier(name, `"`)
+}
+
+// Upsert uses INSERT OR REPLACE, which replaces whole rows conflicting on
+// any unique key, so updateCols aren't used.
+func (sqliteDialect) Upsert(keys, updateCols []string) (string, string) {
+	return "INSERT OR REPLACE", ""
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// DiskQueue is a simple durable FIFO queue of data payloads stored in a
+// single file. Payloads are kept in the file until they are successfully
+// replayed, so the queue survives process restarts.
+type DiskQueue struct {
+	Path  string
+	count int
+	mutex sync.Mutex
+}
+
+// NewDiskQueue opens (or creates) the queue stored at path.
+func NewDiskQueue(path string) (*DiskQueue, error) {
+	q := &DiskQueue{Path: path}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	err := q.scan(func(d data.JSON) error {
+		q.count++
+		return nil
+	})
+	return q, err
+}
+
+// Len returns the number of payloads in the queue.
+func (q *DiskQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.count
+}
+
+// Push appends a payload to the end of the queue.
+func (q *DiskQueue) Push(d data.JSON) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	f, err := os.OpenFile(q.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	line := base64.StdEncoding.EncodeToString(d) + "\n"
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	q.count++
+	return f.Close()
+}
+
+// Replay calls fn with each payload, in order, removing it from the queue
+// when fn succeeds. Replay stops at the first error returned by fn, leaving
+// that payload and all later ones in the queue, and returns the error.
+func (q *DiskQueue) Replay(fn func(d data.JSON) error) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var remaining []data.JSON
+	var replayErr error
+	err := q.scan(func(d data.JSON) error {
+		if replayErr == nil {
+			if replayErr = fn(d); replayErr == nil {
+				return nil
+			}
+		}
+		remaining = append(remaining, d)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := q.rewrite(remaining); err != nil {
+		return err
+	}
+	return replayErr
+}
+
+func (q *DiskQueue) scan(fn func(d data.JSON) error) error {
+	f, err := os.Open(q.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 1 && err == nil {
+			d, derr := base64.StdEncoding.DecodeString(line[:len(line)-1])
+			if derr != nil {
+				return derr
+			}
+			if ferr := fn(d); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func (q *DiskQueue) rewrite(payloads []data.JSON) error {
+	q.count = len(payloads)
+	if len(payloads) == 0 {
+		err := os.Remove(q.Path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(q.Path), filepath.Base(q.Path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, d := range payloads {
+		w.WriteString(base64.StdEncoding.EncodeToString(d) + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), q.Path)
+}
@@ -0,0 +1,135 @@
+package util
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net"
+)
+
+// ErrorCategory classifies errors sent to the killChan so that wrapping
+// code (retries, error routing, alerting, etc.) can decide how to react
+// without having to match on error messages.
+type ErrorCategory int
+
+const (
+	// CategoryFatal errors can't be recovered from. This is the category
+	// of any error that hasn't been given one explicitly.
+	CategoryFatal ErrorCategory = iota
+	// CategoryTransient errors, such as network timeouts or dropped
+	// database connections, may succeed if the operation is retried.
+	CategoryTransient
+	// CategoryDataInvalid errors are caused by the data being processed,
+	// for example malformed JSON or a missing required value. Other data
+	// may still be processed successfully.
+	CategoryDataInvalid
+	// CategoryConfigInvalid errors are caused by the way a processor or
+	// pipeline was set up, and will fail again until it is changed.
+	CategoryConfigInvalid
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryTransient:
+		return "Transient"
+	case CategoryDataInvalid:
+		return "DataInvalid"
+	case CategoryConfigInvalid:
+		return "ConfigInvalid"
+	default:
+		return "Fatal"
+	}
+}
+
+// CategorizedError attaches an ErrorCategory to an error.
+type CategorizedError struct {
+	Category ErrorCategory
+	Err      error
+}
+
+func (e *CategorizedError) Error() string {
+	return e.Err.Error()
+}
+
+// ErrorCategory returns the attached category.
+func (e *CategorizedError) ErrorCategory() ErrorCategory {
+	return e.Category
+}
+
+// Unwrap returns the underlying error.
+func (e *CategorizedError) Unwrap() error {
+	return e.Err
+}
+
+// NewCategorizedError returns err with the given category attached, or nil if err is nil.
+func NewCategorizedError(category ErrorCategory, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CategorizedError{Category: category, Err: err}
+}
+
+// TransientError marks err as CategoryTransient. It returns nil if err is nil.
+func TransientError(err error) error {
+	return NewCategorizedError(CategoryTransient, err)
+}
+
+// DataInvalidError marks err as CategoryDataInvalid. It returns nil if err is nil.
+func DataInvalidError(err error) error {
+	return NewCategorizedError(CategoryDataInvalid, err)
+}
+
+// ConfigInvalidError marks err as CategoryConfigInvalid. It returns nil if err is nil.
+func ConfigInvalidError(err error) error {
+	return NewCategorizedError(CategoryConfigInvalid, err)
+}
+
+// FatalError marks err as CategoryFatal. It returns nil if err is nil.
+func FatalError(err error) error {
+	return NewCategorizedError(CategoryFatal, err)
+}
+
+// ConfigErrorf is shorthand for ConfigInvalidError(fmt.Errorf(...)).
+func ConfigErrorf(format string, a ...interface{}) error {
+	return ConfigInvalidError(fmt.Errorf(format, a...))
+}
+
+// DataErrorf is shorthand for DataInvalidError(fmt.Errorf(...)).
+func DataErrorf(format string, a ...interface{}) error {
+	return DataInvalidError(fmt.Errorf(format, a...))
+}
+
+// ErrorCategoryOf returns the category attached to err (or any error it
+// wraps). Any error type can report its own category by implementing an
+// ErrorCategory() ErrorCategory method, as CategorizedError does.
+// Errors without a category are inspected: network errors and
+// bad database connections are considered CategoryTransient, anything
+// else is CategoryFatal.
+func ErrorCategoryOf(err error) ErrorCategory {
+	for e := err; e != nil; {
+		if ce, ok := e.(interface {
+			ErrorCategory() ErrorCategory
+		}); ok {
+			return ce.ErrorCategory()
+		}
+		u, ok := e.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		e = u.Unwrap()
+	}
+
+	if err == driver.ErrBadConn {
+		return CategoryTransient
+	}
+	if _, ok := err.(net.Error); ok {
+		return CategoryTransient
+	}
+	return CategoryFatal
+}
+
+// IsTransient returns true if err is in CategoryTransient.
+func IsTransient(err error) bool {
+	return ErrorCategoryOf(err) == CategoryTransient
+}
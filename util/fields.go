@@ -0,0 +1,55 @@
+package util
+
+import "strings"
+
+// LookupField returns the value at the given dotted path in the record,
+// and whether it was found.
+func LookupField(record map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = record
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// SetField sets the value at the given dotted path in the record, creating
+// (or replacing non-object values with) nested objects as needed.
+func SetField(record map[string]interface{}, path string, v interface{}) {
+	keys := strings.Split(path, ".")
+	m := record
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			m[key] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = v
+}
+
+// DeleteField removes the value at the given dotted path from the record,
+// and returns whether it was found.
+func DeleteField(record map[string]interface{}, path string) bool {
+	keys := strings.Split(path, ".")
+	m := record
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		m = next
+	}
+	last := keys[len(keys)-1]
+	if _, ok := m[last]; !ok {
+		return false
+	}
+	delete(m, last)
+	return true
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ValidateSQLTableName returns an error unless tableName is a valid table
+// name, see ValidSQLIdentifier. It may be qualified, e.g. schema.table.
+//
+// The statements built to write records use their fields as column names,
+// and table names that may come from the data, as they are, so they're
+// validated first: a malformed or malicious key can't inject SQL.
+func ValidateSQLTableName(tableName string) error {
+	if !validSQLName(tableName, true) {
+		return ConfigErrorf("invalid SQL table name %q", tableName)
+	}
+	return nil
+}
+
+// ValidateSQLColumns returns an error unless every field of objects is a
+// valid column name (see ValidSQLIdentifier) and, if allowed isn't empty,
+// one of allowed, so records can't write to columns they shouldn't.
+func ValidateSQLColumns(objects []map[string]interface{}, allowed []string) error {
+	var isAllowed map[string]bool
+	if len(allowed) > 0 {
+		isAllowed = make(map[string]bool, len(allowed))
+		for _, col := range allowed {
+			isAllowed[col] = true
+		}
+	}
+	checked := map[string]bool{}
+	for _, o := range objects {
+		for col := range o {
+			if checked[col] {
+				continue
+			}
+			if !ValidSQLIdentifier(col) {
+				return DataErrorf("invalid SQL column name %q", col)
+			}
+			if isAllowed != nil && !isAllowed[col] {
+				return DataErrorf("column %q isn't allowed", col)
+			}
+			checked[col] = true
+		}
+	}
+	return nil
+}
+
+// ValidSQLIdentifier reports whether name can be used as a column name
+// in a statement as it is. It must either be a plain identifier, made of
+// letters, digits, _ and $ and not starting with a digit or $, or be
+// quoted with double quotes, backticks or brackets, with any quote in it
+// doubled (brackets can't contain ]).
+func ValidSQLIdentifier(name string) bool {
+	return validSQLName(name, false)
+}
+
+// validSQLName reports whether name is a valid identifier, or if
+// qualified, a sequence of them separated by dots.
+func validSQLName(name string, qualified bool) bool {
+	for {
+		n := sqlIdentifierLen(name)
+		if n == 0 {
+			return false
+		}
+		if n == len(name) {
+			return true
+		}
+		if !qualified || name[n] != '.' {
+			return false
+		}
+		name = name[n+1:]
+	}
+}
+
+// sqlIdentifierLen returns the length of the identifier at the start of s,
+// or 0 if there isn't a valid one.
+func sqlIdentifierLen(s string) int {
+	if s == "" {
+		return 0
+	}
+	switch s[0] {
+	case '"', '`':
+		q := s[0]
+		for i := 1; i < len(s); i++ {
+			if s[i] != q {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == q {
+				i++
+				continue
+			}
+			if i == 1 {
+				return 0
+			}
+			return i + 1
+		}
+		return 0
+	case '[':
+		i := strings.IndexByte(s, ']')
+		if i <= 1 {
+			return 0
+		}
+		return i + 1
+	}
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case (unicode.IsDigit(r) || r == '$') && i > 0:
+		case r == '.' && i > 0:
+			return i
+		default:
+			return 0
+		}
+	}
+	return len(s)
+}
+
+// validateSQLNames validates tableName and the fields of objects, as
+// used in the statements built to write them.
+func validateSQLNames(tableName string, objects []map[string]interface{}) error {
+	if err := ValidateSQLTableName(tableName); err != nil {
+		return err
+	}
+	return ValidateSQLColumns(objects, nil)
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// InsertReturningIDs inserts objects into tableName like BuildInsertSQL's
+// statements do, and sets each object's idField to the key the database
+// generated for its row, so records can be passed on with their new IDs
+// (e.g. for child rows to refer to). Objects that already have a value
+// for idField keep it.
+//
+// With PostgreSQL, each batch is a single INSERT ... RETURNING idField.
+// Other databases don't return generated keys from multi-row INSERTs, so
+// rows are inserted one at a time (in a transaction per batch) and their
+// LastInsertId is used. With MySQL, upserted rows that already existed
+// report their idField through LAST_INSERT_ID(idField).
+//
+// Batches are written by workers as in ForEachBatch, each run as
+// configured by exec, and its objects are only updated once it has
+// succeeded.
+func InsertReturningIDs(ctx context.Context, db *sqlx.DB, dialect Dialect, objects []map[string]interface{}, tableName string, upsert bool, keys, updateCols []string, idField string, batchSize, workers int, exec SQLExecOptions) error {
+	if err := validateSQLNames(tableName, objects); err != nil {
+		return err
+	}
+	return ForEachBatch(objects, batchSize, workers, func(batch []map[string]interface{}) error {
+		var ids []interface{}
+		err := exec.Run(ctx, db, func(ctx context.Context) error {
+			var err error
+			if dialect == PostgreSQL {
+				ids, err = insertReturning(ctx, db, dialect, batch, tableName, upsert, keys, updateCols, idField)
+			} else {
+				ids, err = insertLastInsertIDs(ctx, db, dialect, batch, tableName, upsert, keys, updateCols, idField)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for i, o := range batch {
+			if o[idField] == nil {
+				o[idField] = ids[i]
+			}
+		}
+		return nil
+	})
+}
+
+func insertReturning(ctx context.Context, db *sqlx.DB, dialect Dialect, objects []map[string]interface{}, tableName string, upsert bool, keys, updateCols []string, idField string) ([]interface{}, error) {
+	insertSQL, vals := BuildInsertSQL(dialect, objects, tableName, upsert, keys, updateCols)
+	insertSQL += " RETURNING " + idField
+	logger.Debug("InsertReturningIDs:", insertSQL)
+
+	rows, err := db.QueryxContext(ctx, insertSQL, vals...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]interface{}, 0, len(objects))
+	for rows.Next() {
+		var id interface{}
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if b, ok := id.([]byte); ok {
+			id = string(b)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) != len(objects) {
+		return nil, fmt.Errorf("InsertReturningIDs: %d IDs returned for %d rows", len(ids), len(objects))
+	}
+	return ids, nil
+}
+
+func insertLastInsertIDs(ctx context.Context, db *sqlx.DB, dialect Dialect, objects []map[string]interface{}, tableName string, upsert bool, keys, updateCols []string, idField string) ([]interface{}, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := make([]interface{}, len(objects))
+	for i, o := range objects {
+		insertSQL, vals := BuildInsertSQL(dialect, []map[string]interface{}{o}, tableName, upsert, keys, updateCols)
+		if upsert && dialect == MySQL {
+			insertSQL += fmt.Sprintf(",%v=LAST_INSERT_ID(%v)", idField, idField)
+		}
+		res, err := tx.ExecContext(ctx, insertSQL, vals...)
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	logger.Info("InsertReturningIDs: inserted len(objects) =", len(objects))
+	return ids, tx.Commit()
+}
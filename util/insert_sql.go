@@ -0,0 +1,114 @@
+package util
+
+import (
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// MySQLInsertSQL returns the INSERT statements that MySQLInsertData would
+// execute for the given Data object (one per batch), without executing
+// them. This is useful for dry runs.
+func MySQLInsertSQL(d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int) ([]string, error) {
+	return insertSQLBatches(d, batchSize, func(batch []map[string]interface{}) (string, error) {
+		insertSQL, _, err := buildMySQLInsertSQL(batch, tableName, onDupKeyUpdate, onDupKeyFields)
+		return insertSQL, err
+	})
+}
+
+// MySQLLoadDataSQL returns the LOAD DATA statements that
+// MySQLLoadDataContext would execute for the given Data object (one per
+// batch), without executing them. The CSV data isn't included.
+func MySQLLoadDataSQL(d data.JSON, tableName string, replace bool, batchSize int) ([]string, error) {
+	return insertSQLBatches(d, batchSize, func(batch []map[string]interface{}) (string, error) {
+		if err := validateSQLNames(tableName, batch); err != nil {
+			return "", err
+		}
+		return buildMySQLLoadDataSQL("Reader::ratchet", tableName, replace, sortedColumns(batch)), nil
+	})
+}
+
+// PostgreSQLInsertSQL returns the INSERT statements that
+// PostgreSQLInsertData would execute for the given Data object (one per
+// batch), without executing them.
+func PostgreSQLInsertSQL(d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int) ([]string, error) {
+	return insertSQLBatches(d, batchSize, func(batch []map[string]interface{}) (string, error) {
+		insertSQL, _, err := buildPostgreSQLInsertSQL(batch, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
+		return insertSQL, err
+	})
+}
+
+// SQLiteInsertSQL returns the INSERT statements that
+// SQLiteInsertDataWithOptions would execute for the given Data object (one
+// per batch), without executing them.
+func SQLiteInsertSQL(d data.JSON, opts SQLiteInsertOptions) ([]string, error) {
+	if len(opts.PreservedFields) > 0 && len(opts.PrimaryKeys) == 0 {
+		return nil, ConfigErrorf("primaryKeys required if preservedFields specified")
+	}
+	if opts.OpField == "" && (opts.Mode == "" || opts.Mode == SQLOpInsert) {
+		return insertSQLBatches(d, opts.BatchSize, func(batch []map[string]interface{}) (string, error) {
+			batch, err := opts.columns(batch)
+			if err != nil {
+				return "", err
+			}
+			insertSQL, _, err := buildSQLiteInsertSQL(batch, opts.TableName, opts.OnDupKeyUpdate, opts.PrimaryKeys, opts.PreservedFields)
+			return insertSQL, err
+		})
+	}
+
+	// Updates and deletes can take several statements per batch.
+	var statements []string
+	_, err := insertSQLBatches(d, opts.BatchSize, func(batch []map[string]interface{}) (string, error) {
+		batch, err := opts.columns(batch)
+		if err != nil {
+			return "", err
+		}
+		runs, err := SplitSQLOps(batch, opts.OpField, opts.Mode)
+		if err != nil {
+			return "", err
+		}
+		for _, run := range runs {
+			if run.Op == SQLOpInsert {
+				insertSQL, _, err := buildSQLiteInsertSQL(run.Objects, opts.TableName, opts.OnDupKeyUpdate, opts.PrimaryKeys, opts.PreservedFields)
+				if err != nil {
+					return "", err
+				}
+				statements = append(statements, insertSQL)
+				continue
+			}
+			changes, err := buildSQLiteChangeSQL(run, opts)
+			if err != nil {
+				return "", err
+			}
+			for _, st := range changes {
+				statements = append(statements, st.sql)
+			}
+		}
+		return "", nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if statements == nil {
+		statements = []string{}
+	}
+	return statements, nil
+}
+
+func insertSQLBatches(d data.JSON, batchSize int, build func(batch []map[string]interface{}) (string, error)) ([]string, error) {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return nil, DataInvalidError(err)
+	}
+	statements := []string{}
+	if len(objects) == 0 {
+		return statements, nil
+	}
+	err = ForEachBatch(objects, batchSize, 1, func(batch []map[string]interface{}) error {
+		insertSQL, err := build(batch)
+		if err != nil {
+			return err
+		}
+		statements = append(statements, insertSQL)
+		return nil
+	})
+	return statements, err
+}
@@ -0,0 +1,352 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// JSONSchema is a parsed JSON Schema document. It supports the commonly
+// used validation keywords from the draft-04 through draft-07 specs:
+// type, enum, const, required, properties, additionalProperties, items,
+// minItems, maxItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// minLength, maxLength, pattern, allOf, anyOf, oneOf and not.
+// Other keywords (including $ref and format) are ignored.
+type JSONSchema struct {
+	Type                 jsonSchemaTypes        `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Const                *interface{}           `json:"const"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*JSONSchema `json:"properties"`
+	AdditionalProperties *jsonSchemaOrBool      `json:"additionalProperties"`
+	Items                *JSONSchema            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	ExclusiveMinimum     *jsonSchemaBound       `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *jsonSchemaBound       `json:"exclusiveMaximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	Pattern              string                 `json:"pattern"`
+	AllOf                []*JSONSchema          `json:"allOf"`
+	AnyOf                []*JSONSchema          `json:"anyOf"`
+	OneOf                []*JSONSchema          `json:"oneOf"`
+	Not                  *JSONSchema            `json:"not"`
+
+	pattern *regexp.Regexp
+}
+
+// ParseJSONSchema parses a JSON Schema document.
+func ParseJSONSchema(schema []byte) (*JSONSchema, error) {
+	var s JSONSchema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, ConfigInvalidError(err)
+	}
+	if err := s.compile(); err != nil {
+		return nil, ConfigInvalidError(err)
+	}
+	return &s, nil
+}
+
+// ValidationError lists the ways a value failed to match a JSONSchema.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "schema validation failed: " + strings.Join(e, "; ")
+}
+
+// ErrorCategory returns CategoryDataInvalid.
+func (e ValidationError) ErrorCategory() ErrorCategory {
+	return CategoryDataInvalid
+}
+
+// Validate checks a single JSON value against the schema, returning a
+// ValidationError if it doesn't match.
+func (s *JSONSchema) Validate(d data.JSON) error {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(d))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return DataInvalidError(err)
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue checks an already decoded value against the schema.
+// Numbers may be either float64 or json.Number.
+func (s *JSONSchema) ValidateValue(v interface{}) error {
+	var errs ValidationError
+	s.validate("$", v, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *JSONSchema) compile() error {
+	if s.Pattern != "" {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = p
+	}
+	children := append([]*JSONSchema{s.Items, s.Not}, s.AllOf...)
+	children = append(children, s.AnyOf...)
+	children = append(children, s.OneOf...)
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	if s.AdditionalProperties != nil {
+		children = append(children, s.AdditionalProperties.Schema)
+	}
+	for _, c := range children {
+		if c == nil {
+			continue
+		}
+		if err := c.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *JSONSchema) validate(path string, v interface{}, errs *ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(v) {
+		fail("expected %v, got %v", strings.Join(s.Type, " or "), jsonSchemaTypeOf(v))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if jsonSchemaEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if s.Const != nil && !jsonSchemaEqual(*s.Const, v) {
+		fail("value does not match const")
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, r := range s.Required {
+			if _, ok := t[r]; !ok {
+				fail("missing required property %q", r)
+			}
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.Properties[k]; ok {
+				p.validate(path+"."+k, t[k], errs)
+			} else if ap := s.AdditionalProperties; ap != nil {
+				if ap.Schema != nil {
+					ap.Schema.validate(path+"."+k, t[k], errs)
+				} else if !ap.Allowed {
+					fail("unexpected property %q", k)
+				}
+			}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(t) < *s.MinItems {
+			fail("expected at least %d items, got %d", *s.MinItems, len(t))
+		}
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			fail("expected at most %d items, got %d", *s.MaxItems, len(t))
+		}
+		if s.Items != nil {
+			for i, item := range t {
+				s.Items.validate(fmt.Sprintf("%v[%d]", path, i), item, errs)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(t)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("expected length >= %d, got %d", *s.MinLength, n)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("expected length <= %d, got %d", *s.MaxLength, n)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			fail("%q does not match pattern %q", t, s.Pattern)
+		}
+	case json.Number, float64:
+		f, _ := jsonSchemaFloat(t)
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("%v is less than minimum %v", f, *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("%v is greater than maximum %v", f, *s.Maximum)
+		}
+		if b := s.ExclusiveMinimum; b != nil {
+			min := b.Value
+			if b.IsBool {
+				min = s.Minimum
+			}
+			if min != nil && f <= *min {
+				fail("%v is not greater than %v", f, *min)
+			}
+		}
+		if b := s.ExclusiveMaximum; b != nil {
+			max := b.Value
+			if b.IsBool {
+				max = s.Maximum
+			}
+			if max != nil && f >= *max {
+				fail("%v is not less than %v", f, *max)
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		sub.validate(path, v, errs)
+	}
+	if len(s.AnyOf) > 0 && jsonSchemaMatches(s.AnyOf, v) == 0 {
+		fail("value does not match any schema in anyOf")
+	}
+	if len(s.OneOf) > 0 {
+		if n := jsonSchemaMatches(s.OneOf, v); n != 1 {
+			fail("value matches %d schemas in oneOf, expected exactly 1", n)
+		}
+	}
+	if s.Not != nil && s.Not.ValidateValue(v) == nil {
+		fail("value must not match schema in not")
+	}
+}
+
+func jsonSchemaMatches(schemas []*JSONSchema, v interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		if s.ValidateValue(v) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// jsonSchemaTypes accepts "type" as either a single string or a list.
+type jsonSchemaTypes []string
+
+func (t *jsonSchemaTypes) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = []string{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+func (t jsonSchemaTypes) matches(v interface{}) bool {
+	actual := jsonSchemaTypeOf(v)
+	for _, typ := range t {
+		if typ == actual || (typ == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonSchemaTypeOf(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case json.Number, float64:
+		if f, ok := jsonSchemaFloat(t); ok && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonSchemaFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func jsonSchemaEqual(a, b interface{}) bool {
+	fa, aok := jsonSchemaFloat(a)
+	fb, bok := jsonSchemaFloat(b)
+	if aok || bok {
+		return aok && bok && fa == fb
+	}
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+// jsonSchemaOrBool accepts additionalProperties as either a boolean or
+// a schema.
+type jsonSchemaOrBool struct {
+	Allowed bool
+	Schema  *JSONSchema
+}
+
+func (s *jsonSchemaOrBool) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &s.Allowed); err == nil {
+		return nil
+	}
+	s.Allowed = true
+	return json.Unmarshal(b, &s.Schema)
+}
+
+// jsonSchemaBound accepts exclusiveMinimum/exclusiveMaximum as either a
+// draft-04 boolean modifier or a draft-06+ number.
+type jsonSchemaBound struct {
+	IsBool bool
+	Value  *float64
+}
+
+func (e *jsonSchemaBound) UnmarshalJSON(b []byte) error {
+	var flag bool
+	if err := json.Unmarshal(b, &flag); err == nil {
+		e.IsBool = flag
+		return nil
+	}
+	return json.Unmarshal(b, &e.Value)
+}
@@ -0,0 +1,171 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// The load strategies of SQL writers, which decide what happens to the
+// rows already in the tables they write to. See PrepareSQLLoad.
+const (
+	// SQLLoadAppend (or an empty strategy) writes records alongside the
+	// existing rows.
+	SQLLoadAppend = "append"
+	// SQLLoadTruncate empties the table before the first batch is written.
+	SQLLoadTruncate = "truncate"
+	// SQLLoadSwap writes records to a staging table, which replaces the
+	// table's rows once the writer is finished, so consumers never see a
+	// partially loaded table.
+	SQLLoadSwap = "swap"
+)
+
+// SQLStagingTable returns the name of the staging table used to load
+// tableName with SQLLoadSwap.
+func SQLStagingTable(tableName string) string {
+	return tableName + "_ratchet_staging"
+}
+
+// PrepareSQLLoad prepares tableName to be loaded with strategy, and
+// returns the table to write to. It's meant to be called once per table
+// before its first batch is written:
+//
+//   - SQLLoadTruncate empties the table, with TRUNCATE TABLE (or DELETE
+//     with SQLite).
+//   - SQLLoadSwap (re)creates the staging table (see SQLStagingTable)
+//     empty, with the same columns and keys as the table (and indexes,
+//     except with SQLite), and returns its name. See FinishSQLLoad.
+//
+// Each statement is run as configured by exec.
+func PrepareSQLLoad(ctx context.Context, db *sqlx.DB, strategy, tableName string, exec SQLExecOptions) (string, error) {
+	dialect, err := DialectFor(db.DriverName())
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateSQLTableName(tableName); err != nil {
+		return "", err
+	}
+	var statements []string
+	switch strategy {
+	case "", SQLLoadAppend:
+		return tableName, nil
+	case SQLLoadTruncate:
+		if dialect == SQLite {
+			statements = []string{"DELETE FROM " + tableName}
+		} else {
+			statements = []string{"TRUNCATE TABLE " + tableName}
+		}
+	case SQLLoadSwap:
+		staging := SQLStagingTable(tableName)
+		statements = []string{"DROP TABLE IF EXISTS " + staging}
+		switch dialect {
+		case MySQL:
+			statements = append(statements, fmt.Sprintf("CREATE TABLE %v LIKE %v", staging, tableName))
+		case PostgreSQL:
+			statements = append(statements, fmt.Sprintf("CREATE TABLE %v (LIKE %v INCLUDING ALL)", staging, tableName))
+		default:
+			if !strings.Contains(tableName, ".") {
+				// Otherwise another attached database's staging table
+				// could be dropped.
+				statements[0] = "DROP TABLE IF EXISTS main." + staging
+			}
+			createSQL, err := sqliteStagingTableSQL(ctx, db, tableName)
+			if err != nil {
+				return "", err
+			}
+			statements = append(statements, createSQL)
+		}
+	default:
+		return "", ConfigErrorf("unknown load strategy %q", strategy)
+	}
+
+	for _, st := range statements {
+		logger.Info("PrepareSQLLoad:", st)
+		err := exec.Run(ctx, db, func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, st)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if strategy == SQLLoadSwap {
+		return SQLStagingTable(tableName), nil
+	}
+	return tableName, nil
+}
+
+// sqliteStagingTableSQL returns the CREATE TABLE for tableName's staging
+// table, from tableName's own definition so it has the same constraints.
+func sqliteStagingTableSQL(ctx context.Context, db *sqlx.DB, tableName string) (string, error) {
+	master := "sqlite_master"
+	name := tableName
+	if i := strings.LastIndex(tableName, "."); i >= 0 {
+		master = tableName[:i] + ".sqlite_master"
+		name = tableName[i+1:]
+	}
+	var createSQL string
+	err := db.GetContext(ctx, &createSQL,
+		fmt.Sprintf("SELECT sql FROM %v WHERE type = 'table' AND name = ?", master), name)
+	if err != nil {
+		return "", fmt.Errorf("PrepareSQLLoad: unable to read the definition of %v: %v", tableName, err)
+	}
+	// Format: CREATE TABLE tablename (col1 ...), keeping everything from
+	// the column definitions on.
+	i := strings.Index(createSQL, "(")
+	if i < 0 {
+		return "", fmt.Errorf("PrepareSQLLoad: unexpected definition of %v: %v", tableName, createSQL)
+	}
+	return fmt.Sprintf("CREATE TABLE %v %v", SQLStagingTable(tableName), createSQL[i:]), nil
+}
+
+// FinishSQLLoad completes loading tableName with strategy, after every
+// batch has been written. With SQLLoadSwap, the table's rows are replaced
+// by those of the staging table in a single transaction, and the staging
+// table is dropped. Rows are copied rather than tables renamed, so the
+// table's grants, triggers and the views and foreign keys referring to it
+// are kept. Other strategies need nothing done.
+//
+// The transaction is run as configured by exec.
+func FinishSQLLoad(ctx context.Context, db *sqlx.DB, strategy, tableName string, exec SQLExecOptions) error {
+	if strategy != SQLLoadSwap {
+		return nil
+	}
+	dialect, err := DialectFor(db.DriverName())
+	if err != nil {
+		return err
+	}
+	staging := SQLStagingTable(tableName)
+	// TRUNCATE is transactional in PostgreSQL, but commits implicitly in
+	// MySQL.
+	empty := "DELETE FROM " + tableName
+	if dialect == PostgreSQL {
+		empty = "TRUNCATE TABLE " + tableName
+	}
+	statements := []string{empty, fmt.Sprintf("INSERT INTO %v SELECT * FROM %v", tableName, staging)}
+
+	err = exec.Run(ctx, db, func(ctx context.Context) error {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, st := range statements {
+			logger.Info("FinishSQLLoad:", st)
+			if _, err := tx.ExecContext(ctx, st); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("FinishSQLLoad: swapped", staging, "into", tableName)
+	_, err = db.ExecContext(ctx, "DROP TABLE "+staging)
+	return err
+}
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUCache is an in-memory cache holding up to Size entries, evicting the
+// least recently used entry when it's full. It is safe for concurrent use.
+type LRUCache struct {
+	Size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+// NewLRUCache returns a new LRUCache holding up to size entries.
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{Size: size}
+}
+
+// Get returns the value for the key, and whether it was found.
+func (c *LRUCache) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// Add sets the value for the key, evicting the least recently used entry
+// if the cache is full.
+func (c *LRUCache) Add(key string, value interface{}) {
+	if c.Size <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	for c.order.Len() > c.Size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len returns the number of entries in the cache.
+func (c *LRUCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,159 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	mssql "github.com/microsoft/go-mssqldb"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// MSSQLBulkOptions holds the settings used by MSSQLBulkInsertData.
+type MSSQLBulkOptions struct {
+	TableName string
+	// BatchSize is the number of rows sent in each bulk copy, each of
+	// which is committed in its own transaction. 0 sends all the rows of
+	// a data payload at once.
+	BatchSize int
+	// IdentityInsert writes the values given for the table's identity
+	// column instead of having the server generate them, by turning on
+	// IDENTITY_INSERT for the table while copying.
+	IdentityInsert bool
+	// TableLock takes a table lock for the duration of each bulk copy
+	// (TABLOCK), which is much faster, and allows minimal logging, but
+	// blocks other writers.
+	TableLock bool
+	// CheckConstraints, FireTriggers and KeepNulls are the bulk copy
+	// options of the same names. Constraints and triggers are ignored by
+	// default, and NULLs are replaced with column defaults unless
+	// KeepNulls is set.
+	CheckConstraints bool
+	FireTriggers     bool
+	KeepNulls        bool
+	// Timeout limits each bulk copy, see WithQueryTimeout.
+	Timeout time.Duration
+	// Retry retries each bulk copy that fails with a retryable error.
+	// Since a failed copy is rolled back, no rows are written twice.
+	Retry SQLRetry
+}
+
+// MSSQLBulkInsertData writes the given Data object to a SQL Server table
+// using bulk copy (the TDS bulk load protocol used by bcp), which is many
+// times faster than INSERT statements for large loads.
+//
+// Note that the Data must be a valid JSON object (or an array of valid
+// objects), where the keys are column names and the values are the SQL
+// values to be inserted into those columns. Objects and arrays are
+// written as JSON strings.
+func MSSQLBulkInsertData(ctx context.Context, db *sqlx.DB, d data.JSON, opts MSSQLBulkOptions) error {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return DataInvalidError(err)
+	}
+
+	exec := SQLExecOptions{Timeout: opts.Timeout, Retry: opts.Retry}
+	return ForEachBatch(objects, opts.BatchSize, 1, func(batch []map[string]interface{}) error {
+		return exec.Run(ctx, db, func(ctx context.Context) error {
+			return mssqlBulkInsertObjects(ctx, db, batch, opts)
+		})
+	})
+}
+
+func mssqlBulkInsertObjects(ctx context.Context, db *sqlx.DB, objects []map[string]interface{}, opts MSSQLBulkOptions) (err error) {
+	cols := sortedColumns(objects)
+	logger.Info("MSSQLBulkInsertData: copying len(objects) =", len(objects), "into", opts.TableName)
+
+	// The transaction keeps the bulk copy and SET IDENTITY_INSERT, which
+	// only applies to its own session, on the same connection.
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if opts.IdentityInsert {
+		if _, err = tx.ExecContext(ctx, "SET IDENTITY_INSERT "+mssqlQuoteIdentifier(opts.TableName)+" ON"); err != nil {
+			return err
+		}
+	}
+
+	stmt, err := tx.PrepareContext(ctx, mssql.CopyIn(opts.TableName, mssql.BulkOptions{
+		CheckConstraints: opts.CheckConstraints,
+		FireTriggers:     opts.FireTriggers,
+		KeepNulls:        opts.KeepNulls,
+		Tablock:          opts.TableLock,
+	}, cols...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	vals := make([]interface{}, len(cols))
+	for _, obj := range objects {
+		for i, col := range cols {
+			if vals[i], err = mssqlBulkValue(obj[col]); err != nil {
+				return DataErrorf("MSSQLBulkInsertData: column %v: %v", col, err)
+			}
+		}
+		if _, err = stmt.ExecContext(ctx, vals...); err != nil {
+			return err
+		}
+	}
+	// Executing with no values sends the rows buffered so far.
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if opts.IdentityInsert {
+		if _, err = tx.ExecContext(ctx, "SET IDENTITY_INSERT "+mssqlQuoteIdentifier(opts.TableName)+" OFF"); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	rowCnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("MSSQLBulkInsertData: rows copied = %d", rowCnt))
+	return nil
+}
+
+// mssqlBulkValue converts v for bulk copy, which only accepts scalar
+// values.
+func mssqlBulkValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return v, nil
+}
+
+// mssqlQuoteIdentifier quotes a (possibly qualified) table name with
+// brackets, leaving parts that are already bracketed alone.
+func mssqlQuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "[") {
+			parts[i] = "[" + strings.Replace(part, "]", "]]", -1) + "]"
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -1,9 +1,17 @@
 package util
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"github.com/jmoiron/sqlx"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
 
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
@@ -17,43 +25,51 @@ import (
 // where the keys are column names and the
 // the values are SQL values to be inserted into those columns.
 func MySQLInsertData(db *sqlx.DB, d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int) error {
+	return MySQLInsertDataConcurrently(db, d, tableName, onDupKeyUpdate, onDupKeyFields, batchSize, 1)
+}
+
+// MySQLInsertDataConcurrently is the same as MySQLInsertData, but will run
+// up to workers batches from the given Data object at the same time.
+// See ForEachBatch for how errors are reported.
+func MySQLInsertDataConcurrently(db *sqlx.DB, d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int, workers int) error {
+	return MySQLInsertDataContext(context.Background(), db, d, tableName, onDupKeyUpdate, onDupKeyFields, batchSize, workers, SQLExecOptions{})
+}
+
+// MySQLInsertDataContext is the same as MySQLInsertDataConcurrently, but
+// the INSERTs are cancelled when ctx is done, and each batch is run as
+// configured by exec (with a timeout, and retried if it fails with a
+// retryable error).
+func MySQLInsertDataContext(ctx context.Context, db *sqlx.DB, d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyFields []string, batchSize int, workers int, exec SQLExecOptions) error {
 	objects, err := data.ObjectsFromJSON(d)
 	if err != nil {
-		return err
-	}
-
-	if batchSize > 0 {
-		for i := 0; i < len(objects); i += batchSize {
-			maxIndex := i + batchSize
-			if maxIndex > len(objects) {
-				maxIndex = len(objects)
-			}
-			err = mysqlInsertObjects(db, objects[i:maxIndex], tableName, onDupKeyUpdate, onDupKeyFields)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return DataInvalidError(err)
 	}
 
-	return mysqlInsertObjects(db, objects, tableName, onDupKeyUpdate, onDupKeyFields)
+	return ForEachBatch(objects, batchSize, workers, func(batch []map[string]interface{}) error {
+		return exec.Run(ctx, db, func(ctx context.Context) error {
+			return mysqlInsertObjects(ctx, db, batch, tableName, onDupKeyUpdate, onDupKeyFields)
+		})
+	})
 }
 
-func mysqlInsertObjects(db *sqlx.DB, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyFields []string) error {
+func mysqlInsertObjects(ctx context.Context, db *sqlx.DB, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyFields []string) error {
 	logger.Info("MySQLInsertData: building INSERT for len(objects) =", len(objects))
-	insertSQL, vals := buildMySQLInsertSQL(objects, tableName, onDupKeyUpdate, onDupKeyFields)
+	insertSQL, vals, err := buildMySQLInsertSQL(objects, tableName, onDupKeyUpdate, onDupKeyFields)
+	if err != nil {
+		return err
+	}
 
 	logger.Debug("MySQLInsertData:", insertSQL)
 	logger.Debug("MySQLInsertData: values", vals)
 
-	stmt, err := db.Prepare(insertSQL)
+	stmt, err := db.PrepareContext(ctx, insertSQL)
 	if err != nil {
 		logger.Debug("MySQLInsertData: error preparing SQL")
 		return err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(vals...)
+	res, err := stmt.ExecContext(ctx, vals...)
 	if err != nil {
 		return err
 	}
@@ -70,56 +86,132 @@ func mysqlInsertObjects(db *sqlx.DB, objects []map[string]interface{}, tableName
 	return nil
 }
 
-func buildMySQLInsertSQL(objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyFields []string) (insertSQL string, vals []interface{}) {
-	cols := sortedColumns(objects)
+func buildMySQLInsertSQL(objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyFields []string) (insertSQL string, vals []interface{}, err error) {
+	if err := validateSQLNames(tableName, objects); err != nil {
+		return "", nil, err
+	}
+	insertSQL, vals = BuildInsertSQL(MySQL, objects, tableName, onDupKeyUpdate, nil, onDupKeyFields)
+	return insertSQL, vals, nil
+}
 
-	// Format: INSERT INTO tablename(col1,col2) VALUES(?,?),(?,?)
-	insertSQL = fmt.Sprintf("INSERT INTO %v(%v) VALUES", tableName, strings.Join(cols, ","))
+// MySQLLoadDataContext is the same as MySQLInsertDataContext, but each
+// batch is written as CSV with LOAD DATA LOCAL INFILE, which is typically
+// an order of magnitude faster than INSERT for large loads. The CSV is
+// streamed from memory, so no files are written, but the server must
+// allow local_infile.
+//
+// Note that MySQL treats LOAD DATA LOCAL as LOAD DATA IGNORE: rows with
+// duplicate keys are skipped, and invalid values are converted with a
+// warning rather than failing. If replace is true, rows with duplicate
+// keys replace the existing ones instead (deleting and inserting them, so
+// columns not written are reset).
+func MySQLLoadDataContext(ctx context.Context, db *sqlx.DB, d data.JSON, tableName string, replace bool, batchSize int, workers int, exec SQLExecOptions) error {
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return DataInvalidError(err)
+	}
 
-	// builds the (?,?) part
-	qs := "("
-	for i := 0; i < len(cols); i++ {
-		if i > 0 {
-			qs += ","
+	return ForEachBatch(objects, batchSize, workers, func(batch []map[string]interface{}) error {
+		if err := validateSQLNames(tableName, batch); err != nil {
+			return err
 		}
-		qs += "?"
-	}
-	qs += ")"
-	// append as many (?,?) parts as there are objects to insert
-	for i := 0; i < len(objects); i++ {
-		if i > 0 {
-			insertSQL += ","
+		cols := sortedColumns(batch)
+		csv, err := mysqlLoadDataCSV(batch, cols)
+		if err != nil {
+			return err
 		}
-		insertSQL += qs
-	}
+		// The reader is registered under a name unique to this batch, and
+		// returns a new reader over the CSV each time, for retries.
+		name := fmt.Sprintf("ratchet_%d", atomic.AddUint64(&mysqlLoadDataID, 1))
+		mysql.RegisterReaderHandler(name, func() io.Reader {
+			return bytes.NewReader(csv)
+		})
+		defer mysql.DeregisterReaderHandler(name)
+
+		loadSQL := buildMySQLLoadDataSQL("Reader::"+name, tableName, replace, cols)
+		logger.Info("MySQLLoadData: loading len(objects) =", len(batch))
+		logger.Debug("MySQLLoadData:", loadSQL)
+		return exec.Run(ctx, db, func(ctx context.Context) error {
+			res, err := db.ExecContext(ctx, loadSQL)
+			if err != nil {
+				return err
+			}
+			rowCnt, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			logger.Info(fmt.Sprintf("MySQLLoadData: rows affected = %d", rowCnt))
+			return nil
+		})
+	})
+}
 
-	if onDupKeyUpdate {
-		// format: ON DUPLICATE KEY UPDATE a=VALUES(a), b=VALUES(b), c=VALUES(c)
-		insertSQL += " ON DUPLICATE KEY UPDATE "
+var mysqlLoadDataID uint64
 
-		// If this wasn't explicitly set, we want to update all columns
-		if len(onDupKeyFields) == 0 {
-			onDupKeyFields = cols
-		}
+func buildMySQLLoadDataSQL(file string, tableName string, replace bool, cols []string) string {
+	verb := ""
+	if replace {
+		verb = " REPLACE"
+	}
+	return fmt.Sprintf(`LOAD DATA LOCAL INFILE '%v'%v INTO TABLE %v CHARACTER SET utf8mb4 `+
+		`FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\n' (%v)`,
+		file, verb, tableName, strings.Join(cols, ","))
+}
 
-		for i, c := range onDupKeyFields {
+// mysqlLoadDataCSV writes objects as CSV in the format expected by
+// buildMySQLLoadDataSQL: strings are quoted and backslash escaped, and
+// NULLs are written as \N.
+func mysqlLoadDataCSV(objects []map[string]interface{}, cols []string) ([]byte, error) {
+	var b bytes.Buffer
+	for _, obj := range objects {
+		for i, col := range cols {
 			if i > 0 {
-				insertSQL += ","
+				b.WriteByte(',')
+			}
+			switch v := obj[col].(type) {
+			case nil:
+				b.WriteString(`\N`)
+			case bool:
+				if v {
+					b.WriteByte('1')
+				} else {
+					b.WriteByte('0')
+				}
+			case float64:
+				b.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+			case string:
+				mysqlLoadDataQuote(&b, v)
+			case map[string]interface{}, []interface{}:
+				j, err := json.Marshal(v)
+				if err != nil {
+					return nil, DataErrorf("MySQLLoadData: column %v: %v", col, err)
+				}
+				mysqlLoadDataQuote(&b, string(j))
+			default:
+				mysqlLoadDataQuote(&b, fmt.Sprint(v))
 			}
-			insertSQL += "`" + c + "`=VALUES(`" + c + "`)"
 		}
+		b.WriteByte('\n')
 	}
+	return b.Bytes(), nil
+}
 
-	vals = []interface{}{}
-	for _, obj := range objects {
-		for _, col := range cols {
-			if val, ok := obj[col]; ok {
-				vals = append(vals, val)
-			} else {
-				vals = append(vals, nil)
-			}
+func mysqlLoadDataQuote(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0:
+			b.WriteString(`\0`)
+		default:
+			b.WriteByte(c)
 		}
 	}
-
-	return
+	b.WriteByte('"')
 }
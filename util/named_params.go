@@ -0,0 +1,109 @@
+package util
+
+import (
+	"strings"
+)
+
+// BindNamedParams replaces the named parameters in query, written as
+// :name, with ? placeholders, and returns the query along with the values
+// to bind to them, in order (use sqlx.DB.Rebind to convert the
+// placeholders for the database). Values are looked up with lookup, and a
+// missing value is a data error. Names can contain letters, digits,
+// underscores and dots, so nested fields can be referred to as
+// :customer.id. A parameter can be used more than once.
+//
+// A value that's a slice ([]interface{}, as decoded from JSON arrays) is
+// expanded to a list of placeholders, one per element, for IN clauses:
+//
+//	SELECT * FROM orders WHERE status IN (:statuses)
+//
+// Colons in quoted strings, quoted identifiers and comments are left
+// alone, as are PostgreSQL :: casts, so queries don't need escaping.
+func BindNamedParams(query string, lookup func(name string) (interface{}, bool)) (string, []interface{}, error) {
+	var (
+		b    strings.Builder
+		args []interface{}
+	)
+	b.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := quotedEnd(query, i, c)
+			b.WriteString(query[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			b.WriteString(query[i : i+end])
+			i += end
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			b.WriteString("::")
+			i += 2
+		case c == ':' && i+1 < len(query) && isParamStart(query[i+1]):
+			end := i + 1
+			for end < len(query) && isParamChar(query[end]) {
+				end++
+			}
+			// A trailing dot ends the sentence, not the name.
+			for query[end-1] == '.' {
+				end--
+			}
+			name := query[i+1 : end]
+			v, ok := lookup(name)
+			if !ok {
+				return "", nil, DataErrorf("no value for query parameter :%v", name)
+			}
+			if list, ok := v.([]interface{}); ok {
+				if len(list) == 0 {
+					return "", nil, DataErrorf("query parameter :%v is an empty list", name)
+				}
+				b.WriteString(strings.TrimSuffix(strings.Repeat("?,", len(list)), ","))
+				args = append(args, list...)
+			} else {
+				b.WriteByte('?')
+				args = append(args, v)
+			}
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), args, nil
+}
+
+// quotedEnd returns the index after the quoted string or identifier
+// starting at start, where doubled quotes are escapes.
+func quotedEnd(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+func isParamStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isParamChar(c byte) bool {
+	return isParamStart(c) || c == '.' || c >= '0' && c <= '9'
+}
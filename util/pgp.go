@@ -0,0 +1,97 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// ReadPGPKeyRing parses a keyring from the given io.Reader. Both ASCII armored
+// and binary keyrings are supported.
+func ReadPGPKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if block, err := armor.Decode(bytes.NewReader(b)); err == nil {
+		return openpgp.ReadKeyRing(block.Body)
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(b))
+}
+
+// NewPGPEncryptWriter wraps the given io.Writer so that everything written to
+// the returned io.WriteCloser is encrypted for the given recipients. If armored
+// is true the ciphertext is ASCII armored. Close must be called to flush the
+// final encrypted packets; it does not close w.
+func NewPGPEncryptWriter(w io.Writer, recipients openpgp.EntityList, armored bool) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, ConfigErrorf("NewPGPEncryptWriter: at least one recipient key is required")
+	}
+	if !armored {
+		return openpgp.Encrypt(w, recipients, nil, nil, nil)
+	}
+	aw, err := armor.Encode(w, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+	pw, err := openpgp.Encrypt(aw, recipients, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &pgpArmoredWriter{pw, aw}, nil
+}
+
+type pgpArmoredWriter struct {
+	io.WriteCloser
+	armor io.WriteCloser
+}
+
+func (w *pgpArmoredWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.armor.Close()
+}
+
+// NewPGPDecryptReader returns an io.Reader yielding the plaintext of the
+// encrypted message read from r. ASCII armored messages are detected
+// automatically. If the private keys in keyring are protected, passphrase is
+// used to decrypt them.
+func NewPGPDecryptReader(r io.Reader, keyring openpgp.EntityList, passphrase []byte) (io.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader = bytes.NewReader(b)
+	if block, err := armor.Decode(bytes.NewReader(b)); err == nil {
+		body = block.Body
+	}
+
+	prompted := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if prompted || len(passphrase) == 0 {
+			return nil, ConfigErrorf("NewPGPDecryptReader: unable to decrypt private key")
+		}
+		prompted = true
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				if err := k.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	md, err := openpgp.ReadMessage(body, keyring, prompt, nil)
+	if err != nil {
+		if _, ok := err.(*CategorizedError); ok {
+			return nil, err
+		}
+		return nil, DataInvalidError(err)
+	}
+	return md.UnverifiedBody, nil
+}
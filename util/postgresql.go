@@ -1,9 +1,9 @@
 package util
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
 	"fmt"
-	"strings"
 
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
@@ -20,43 +20,51 @@ import (
 // If onDupKeyUpdate is true, you must set an onDupKeyIndex. This translates
 // to the conflict_target as specified in https://www.postgresql.org/docs/9.5/static/sql-insert.html
 func PostgreSQLInsertData(db *sqlx.DB, d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int) error {
+	return PostgreSQLInsertDataConcurrently(db, d, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields, batchSize, 1)
+}
+
+// PostgreSQLInsertDataConcurrently is the same as PostgreSQLInsertData, but
+// will run up to workers batches from the given Data object at the same time.
+// See ForEachBatch for how errors are reported.
+func PostgreSQLInsertDataConcurrently(db *sqlx.DB, d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int, workers int) error {
+	return PostgreSQLInsertDataContext(context.Background(), db, d, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields, batchSize, workers, SQLExecOptions{})
+}
+
+// PostgreSQLInsertDataContext is the same as PostgreSQLInsertDataConcurrently, but
+// the INSERTs are cancelled when ctx is done, and each batch is run as
+// configured by exec (with a timeout, and retried if it fails with a
+// retryable error).
+func PostgreSQLInsertDataContext(ctx context.Context, db *sqlx.DB, d data.JSON, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string, batchSize int, workers int, exec SQLExecOptions) error {
 	objects, err := data.ObjectsFromJSON(d)
 	if err != nil {
-		return err
-	}
-
-	if batchSize > 0 {
-		for i := 0; i < len(objects); i += batchSize {
-			maxIndex := i + batchSize
-			if maxIndex > len(objects) {
-				maxIndex = len(objects)
-			}
-			err = postgresInsertObjects(db, objects[i:maxIndex], tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return DataInvalidError(err)
 	}
 
-	return postgresInsertObjects(db, objects, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
+	return ForEachBatch(objects, batchSize, workers, func(batch []map[string]interface{}) error {
+		return exec.Run(ctx, db, func(ctx context.Context) error {
+			return postgresInsertObjects(ctx, db, batch, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
+		})
+	})
 }
 
-func postgresInsertObjects(db *sqlx.DB, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string) error {
+func postgresInsertObjects(ctx context.Context, db *sqlx.DB, objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string) error {
 	logger.Info("PostgreSQLInsertData: building INSERT for len(objects) =", len(objects))
-	insertSQL, vals := buildPostgreSQLInsertSQL(objects, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
+	insertSQL, vals, err := buildPostgreSQLInsertSQL(objects, tableName, onDupKeyUpdate, onDupKeyIndex, onDupKeyFields)
+	if err != nil {
+		return err
+	}
 
 	logger.Debug("PostgreSQLInsertData:", insertSQL)
 	logger.Debug("PostgreSQLInsertData: values", vals)
 
-	stmt, err := db.Prepare(insertSQL)
+	stmt, err := db.PrepareContext(ctx, insertSQL)
 	if err != nil {
 		logger.Debug("PostgreSQLInsertData: error preparing SQL")
 		return err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(vals...)
+	res, err := stmt.ExecContext(ctx, vals...)
 	if err != nil {
 		return err
 	}
@@ -69,59 +77,10 @@ func postgresInsertObjects(db *sqlx.DB, objects []map[string]interface{}, tableN
 	return nil
 }
 
-func buildPostgreSQLInsertSQL(objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string) (insertSQL string, vals []interface{}) {
-	cols := sortedColumns(objects)
-
-	// Format: INSERT INTO tablename(col1,col2) VALUES(?,?),(?,?)
-	insertSQL = fmt.Sprintf("INSERT INTO %v(%v) VALUES", tableName, strings.Join(cols, ","))
-
-	for i := 0; i < len(objects); i++ {
-		row := "("
-
-		if i > 0 {
-			insertSQL += ", "
-		}
-
-		for j := 0; j < len(cols); j++ {
-			if j > 0 {
-				row += ","
-			}
-
-			placeholder := fmt.Sprintf("$%v", i*len(cols)+j+1)
-			row += placeholder
-		}
-
-		row += ")"
-		insertSQL += row
+func buildPostgreSQLInsertSQL(objects []map[string]interface{}, tableName string, onDupKeyUpdate bool, onDupKeyIndex string, onDupKeyFields []string) (insertSQL string, vals []interface{}, err error) {
+	if err := validateSQLNames(tableName, objects); err != nil {
+		return "", nil, err
 	}
-
-	if onDupKeyUpdate {
-		// format: ON CONFLICT (index) DO UPDATE SET a=EXCLUDED.a, b=EXCLUDED.b
-		insertSQL += fmt.Sprintf(" ON CONFLICT (%v) DO UPDATE SET ", onDupKeyIndex)
-
-		// If this wasn't explicitly set, we want to update all columns
-		if len(onDupKeyFields) == 0 {
-			onDupKeyFields = cols
-		}
-
-		for i, c := range onDupKeyFields {
-			if i > 0 {
-				insertSQL += ","
-			}
-			insertSQL += fmt.Sprintf("%v=EXCLUDED.%v", c, c)
-		}
-	}
-
-	vals = []interface{}{}
-	for _, obj := range objects {
-		for _, col := range cols {
-			if val, ok := obj[col]; ok {
-				vals = append(vals, val)
-			} else {
-				vals = append(vals, nil)
-			}
-		}
-	}
-
-	return
+	insertSQL, vals = BuildInsertSQL(PostgreSQL, objects, tableName, onDupKeyUpdate, []string{onDupKeyIndex}, onDupKeyFields)
+	return insertSQL, vals, nil
 }
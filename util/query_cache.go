@@ -0,0 +1,192 @@
+package util
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// QueryCache is a simple disk-backed cache for query results. Each entry
+// holds the series of data payloads a query produced, stored one per line
+// in a file within Dir.
+//
+// Entries older than TTL are ignored (a TTL of 0 means entries never
+// expire). If MaxBytes is greater than 0, the oldest entries are removed
+// whenever the total size of the cache grows beyond it.
+type QueryCache struct {
+	Dir      string
+	TTL      time.Duration
+	MaxBytes int64
+	mutex    sync.Mutex
+}
+
+const queryCacheExt = ".cache"
+
+// QueryCacheKey builds a cache key from the given parts, such as the
+// query and its parameters.
+func QueryCacheKey(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		io.WriteString(h, p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ForEach calls fn with each cached payload for the given key, returning
+// false if there is no valid entry for the key.
+func (c *QueryCache) ForEach(key string, fn func(d data.JSON)) (bool, error) {
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if c.TTL > 0 && time.Since(info.ModTime()) > c.TTL {
+		logger.Debug("QueryCache: expired entry", key)
+		return false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 1 {
+			fn(data.JSON(line[:len(line)-1]))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// NewEntry starts writing a new entry for the given key. The entry is only
+// visible to ForEach once Commit is called.
+func (c *QueryCache) NewEntry(key string) (*QueryCacheEntry, error) {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(c.Dir, "tmp-")
+	if err != nil {
+		return nil, err
+	}
+	return &QueryCacheEntry{cache: c, key: key, file: f, writer: bufio.NewWriter(f)}, nil
+}
+
+func (c *QueryCache) path(key string) string {
+	return filepath.Join(c.Dir, key+queryCacheExt)
+}
+
+// enforceLimit removes the oldest entries until the cache fits in MaxBytes.
+func (c *QueryCache) enforceLimit() error {
+	if c.MaxBytes <= 0 {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+	entries := []os.FileInfo{}
+	var total int64
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), queryCacheExt) {
+			entries = append(entries, f)
+			total += f.Size()
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, f := range entries {
+		if total <= c.MaxBytes {
+			break
+		}
+		logger.Debug("QueryCache: evicting", f.Name())
+		if err := os.Remove(filepath.Join(c.Dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.Size()
+	}
+	return nil
+}
+
+// QueryCacheEntry is a cache entry that is being written.
+type QueryCacheEntry struct {
+	cache  *QueryCache
+	key    string
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	failed bool
+}
+
+// Write adds a payload to the entry. Payloads must not contain newlines,
+// which is always the case for compact JSON. If the entry grows larger than
+// the cache's MaxBytes it is abandoned, and Commit won't store it.
+func (e *QueryCacheEntry) Write(d data.JSON) error {
+	if e.failed {
+		return nil
+	}
+	e.size += int64(len(d) + 1)
+	if e.cache.MaxBytes > 0 && e.size > e.cache.MaxBytes {
+		logger.Debug("QueryCache: entry too large to cache", e.key)
+		e.failed = true
+		return nil
+	}
+	if _, err := e.writer.Write(d); err != nil {
+		e.failed = true
+		return err
+	}
+	return e.writer.WriteByte('\n')
+}
+
+// Commit stores the entry in the cache, replacing any previous entry for
+// the same key.
+func (e *QueryCacheEntry) Commit() error {
+	if e.failed {
+		e.Abort()
+		return nil
+	}
+	if err := e.writer.Flush(); err != nil {
+		e.Abort()
+		return err
+	}
+	if err := e.file.Close(); err != nil {
+		os.Remove(e.file.Name())
+		return err
+	}
+	if err := os.Rename(e.file.Name(), e.cache.path(e.key)); err != nil {
+		os.Remove(e.file.Name())
+		return err
+	}
+	return e.cache.enforceLimit()
+}
+
+// Abort discards the entry.
+func (e *QueryCacheEntry) Abort() {
+	e.file.Close()
+	os.Remove(e.file.Name())
+}
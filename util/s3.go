@@ -16,7 +16,28 @@ import (
 // ListS3Objects returns all object keys matching the given prefix. Note that
 // delimiter is set to "/". See http://docs.aws.amazon.com/AmazonS3/latest/dev/ListingKeysHierarchy.html
 func ListS3Objects(client *s3.S3, bucket, keyPrefix string) ([]string, error) {
-	logger.Debug("ListS3Objects: ", bucket, "-", keyPrefix)
+	objects, err := ListS3ObjectDetails(client, bucket, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(objects))
+	for i, o := range objects {
+		keys[i] = *o.Key
+	}
+	return keys, nil
+}
+
+// ListS3ObjectDetails is the same as ListS3Objects, but returns the full
+// object details (such as Size and LastModified) rather than just the keys.
+func ListS3ObjectDetails(client *s3.S3, bucket, keyPrefix string) ([]*s3.Object, error) {
+	return ListS3ObjectDetailsWithContext(aws.BackgroundContext(), client, bucket, keyPrefix)
+}
+
+// ListS3ObjectDetailsWithContext is the same as ListS3ObjectDetails, but
+// the listing is cancelled when ctx is done.
+func ListS3ObjectDetailsWithContext(ctx aws.Context, client *s3.S3, bucket, keyPrefix string) ([]*s3.Object, error) {
+	logger.Debug("ListS3ObjectDetails: ", bucket, "-", keyPrefix)
 	params := &s3.ListObjectsInput{
 		Bucket:    aws.String(bucket), // Required
 		Delimiter: aws.String("/"),
@@ -26,12 +47,10 @@ func ListS3Objects(client *s3.S3, bucket, keyPrefix string) ([]string, error) {
 		Prefix:  aws.String(keyPrefix),
 	}
 
-	objects := []string{}
-	err := client.ListObjectsPages(params, func(page *s3.ListObjectsOutput, lastPage bool) bool {
-		for _, o := range page.Contents {
-			objects = append(objects, *o.Key)
-		}
-		return lastPage
+	objects := []*s3.Object{}
+	err := client.ListObjectsPagesWithContext(ctx, params, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		objects = append(objects, page.Contents...)
+		return true
 	})
 	if err != nil {
 		return nil, err
@@ -42,6 +61,12 @@ func ListS3Objects(client *s3.S3, bucket, keyPrefix string) ([]string, error) {
 
 // GetS3Object returns the object output for the given object key
 func GetS3Object(client *s3.S3, bucket, objKey string) (*s3.GetObjectOutput, error) {
+	return GetS3ObjectWithContext(aws.BackgroundContext(), client, bucket, objKey)
+}
+
+// GetS3ObjectWithContext is the same as GetS3Object, but the request
+// (including reading the object's Body) is cancelled when ctx is done.
+func GetS3ObjectWithContext(ctx aws.Context, client *s3.S3, bucket, objKey string) (*s3.GetObjectOutput, error) {
 	logger.Debug("GetS3Object: ", bucket, "-", objKey)
 	params := &s3.GetObjectInput{
 		Bucket: aws.String(bucket), // Required
@@ -64,7 +89,7 @@ func GetS3Object(client *s3.S3, bucket, objKey string) (*s3.GetObjectOutput, err
 		// VersionId:                  aws.String("ObjectVersionId"),
 	}
 
-	return client.GetObject(params)
+	return client.GetObjectWithContext(ctx, params)
 }
 
 // DeleteS3Objects deletes the objects specified by the given object keys
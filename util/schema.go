@@ -0,0 +1,207 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fefelovgroup/ratchet/data"
+)
+
+// SchemaType is the type of a column inferred by InferSchema.
+type SchemaType string
+
+// The column types InferSchema can detect. SchemaNull is only used for
+// columns that have had nothing but null values so far.
+const (
+	SchemaNull      SchemaType = "null"
+	SchemaBoolean   SchemaType = "boolean"
+	SchemaInteger   SchemaType = "integer"
+	SchemaFloat     SchemaType = "float"
+	SchemaDate      SchemaType = "date"
+	SchemaTimestamp SchemaType = "timestamp"
+	SchemaString    SchemaType = "string"
+	SchemaObject    SchemaType = "object"
+	SchemaArray     SchemaType = "array"
+)
+
+// SchemaColumn describes a single column of a Schema.
+type SchemaColumn struct {
+	Name     string
+	Type     SchemaType
+	Nullable bool // True if any object had a null value or was missing the column.
+}
+
+// Schema is a column to type mapping inferred from data. A Schema can be
+// built up from several data payloads (e.g. the first few batches sent
+// by a SQLReader) by calling Add for each of them. If MaxRows is set,
+// objects beyond that many are ignored.
+type Schema struct {
+	MaxRows int
+	Rows    int
+	columns map[string]*SchemaColumn
+}
+
+// NewSchema returns an empty Schema.
+func NewSchema() *Schema {
+	return &Schema{columns: make(map[string]*SchemaColumn)}
+}
+
+// InferSchema returns the Schema of the given data, which must be a JSON
+// object or an array of objects.
+func InferSchema(d data.JSON) (*Schema, error) {
+	s := NewSchema()
+	return s, s.Add(d)
+}
+
+// Add samples the objects in the given data, widening column types as
+// needed: integers and floats combine to float, dates and timestamps to
+// timestamp, null combines with any type, and any other mix of types becomes
+// string.
+func (s *Schema) Add(d data.JSON) error {
+	if s.MaxRows > 0 && s.Rows >= s.MaxRows {
+		return nil
+	}
+	objects, err := schemaObjects(d)
+	if err != nil {
+		return DataInvalidError(err)
+	}
+	for _, o := range objects {
+		if s.MaxRows > 0 && s.Rows >= s.MaxRows {
+			break
+		}
+		for name, v := range o {
+			c, ok := s.columns[name]
+			if !ok {
+				// Objects seen before didn't have this column.
+				c = &SchemaColumn{Name: name, Type: SchemaNull, Nullable: s.Rows > 0}
+				s.columns[name] = c
+			}
+			t := schemaTypeOf(v)
+			if t == SchemaNull {
+				c.Nullable = true
+				continue
+			}
+			c.Type = widenSchemaType(c.Type, t)
+		}
+		s.Rows++
+		for _, c := range s.columns {
+			if _, ok := o[c.Name]; !ok {
+				c.Nullable = true
+			}
+		}
+	}
+	return nil
+}
+
+// Columns returns the columns of the Schema sorted by name.
+func (s *Schema) Columns() []SchemaColumn {
+	cols := make([]SchemaColumn, 0, len(s.columns))
+	for _, c := range s.columns {
+		cols = append(cols, *c)
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].Name < cols[j].Name
+	})
+	return cols
+}
+
+// Column returns the column with the given name.
+func (s *Schema) Column(name string) (SchemaColumn, bool) {
+	c, ok := s.columns[name]
+	if !ok {
+		return SchemaColumn{}, false
+	}
+	return *c, true
+}
+
+func (s *Schema) String() string {
+	cols := []string{}
+	for _, c := range s.Columns() {
+		nullable := ""
+		if c.Nullable {
+			nullable = " NULL"
+		}
+		cols = append(cols, fmt.Sprintf("%v %v%v", c.Name, c.Type, nullable))
+	}
+	return strings.Join(cols, ", ")
+}
+
+// Strings in this format are considered dates, and in any of the others
+// timestamps.
+const schemaDateLayout = "2006-01-02"
+
+var schemaTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+}
+
+func schemaObjects(d data.JSON) ([]map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(d))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{vv}, nil
+	case []interface{}:
+		objects := make([]map[string]interface{}, len(vv))
+		for i := range vv {
+			o, ok := vv[i].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("InferSchema: unsupported data type: %T", vv[i])
+			}
+			objects[i] = o
+		}
+		return objects, nil
+	}
+	return nil, fmt.Errorf("InferSchema: unsupported data type: %T", v)
+}
+
+func schemaTypeOf(v interface{}) SchemaType {
+	switch vv := v.(type) {
+	case nil:
+		return SchemaNull
+	case bool:
+		return SchemaBoolean
+	case json.Number:
+		if _, err := vv.Int64(); err == nil {
+			return SchemaInteger
+		}
+		return SchemaFloat
+	case string:
+		if _, err := time.Parse(schemaDateLayout, vv); err == nil {
+			return SchemaDate
+		}
+		for _, layout := range schemaTimestampLayouts {
+			if _, err := time.Parse(layout, vv); err == nil {
+				return SchemaTimestamp
+			}
+		}
+		return SchemaString
+	case map[string]interface{}:
+		return SchemaObject
+	case []interface{}:
+		return SchemaArray
+	}
+	return SchemaString
+}
+
+func widenSchemaType(current, t SchemaType) SchemaType {
+	switch {
+	case current == SchemaNull || current == t:
+		return t
+	case (current == SchemaInteger && t == SchemaFloat) || (current == SchemaFloat && t == SchemaInteger):
+		return SchemaFloat
+	case (current == SchemaDate && t == SchemaTimestamp) || (current == SchemaTimestamp && t == SchemaDate):
+		return SchemaTimestamp
+	}
+	return SchemaString
+}
@@ -0,0 +1,76 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/fefelovgroup/ratchet/data"
+	"github.com/fefelovgroup/ratchet/util"
+)
+
+func TestInferSchema(t *testing.T) {
+	tests := []struct {
+		name string
+		d    string
+		want string
+	}{
+		{"types", `{"a":true,"b":1,"c":1.5,"d":"2026-10-17","e":"2026-10-17T09:30:00Z","f":"2026-10-17 09:30:00","g":"x","h":{},"i":[]}`,
+			"a boolean, b integer, c float, d date, e timestamp, f timestamp, g string, h object, i array"},
+		{"integers and floats", `[{"n":1},{"n":2.5},{"n":3}]`, "n float"},
+		{"floats and integers", `[{"n":2.5},{"n":1}]`, "n float"},
+		{"big integer", `{"n":9223372036854775808}`, "n float"},
+		{"dates and timestamps", `[{"d":"2026-10-17"},{"d":"2026-10-17T09:30:00Z"}]`, "d timestamp"},
+		{"mixed", `[{"m":1},{"m":"one"}]`, "m string"},
+		{"null value", `[{"a":1},{"a":null}]`, "a integer NULL"},
+		{"only nulls", `[{"a":null},{"a":null}]`, "a null NULL"},
+		{"missing from a later object", `[{"a":1,"b":2},{"a":3}]`, "a integer, b integer NULL"},
+		{"missing from an earlier object", `[{"a":1},{"a":2,"b":3}]`, "a integer, b integer NULL"},
+		{"null payload", `null`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := util.InferSchema(data.JSON(test.d))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	for _, d := range []string{`[{"a":1},`, `[1,2]`, `"a"`} {
+		if _, err := util.InferSchema(data.JSON(d)); util.ErrorCategoryOf(err) != util.CategoryDataInvalid {
+			t.Errorf("%v: got error %v, want invalid data", d, err)
+		}
+	}
+}
+
+func TestSchemaAdd(t *testing.T) {
+	s := util.NewSchema()
+	s.MaxRows = 4
+	batches := []string{
+		`[{"id":1,"amount":10},{"id":2,"amount":20}]`,
+		// A column that the first batch didn't have is nullable.
+		`[{"id":3,"amount":30.5,"note":"x"}]`,
+		// Only the first object is sampled, the rest are beyond MaxRows.
+		`[{"id":4,"amount":40,"note":"y"},{"id":"five","amount":null,"note":"z","extra":true}]`,
+		`[{"id":6,"late":true}]`,
+	}
+	for _, b := range batches {
+		if err := s.Add(data.JSON(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Rows != 4 {
+		t.Errorf("got %d rows, want 4", s.Rows)
+	}
+	if got, want := s.String(), "amount float, id integer, note string NULL"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if c, ok := s.Column("amount"); !ok || c.Type != util.SchemaFloat || c.Nullable {
+		t.Errorf("got amount %+v, %v, want a float column that isn't nullable", c, ok)
+	}
+	if _, ok := s.Column("late"); ok {
+		t.Error("got a column from beyond MaxRows")
+	}
+}
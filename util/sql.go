@@ -1,10 +1,14 @@
 package util
 
 import (
+	"context"
+	"database/sql"
 	"github.com/jmoiron/sqlx"
 	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 	"github.com/fefelovgroup/ratchet/data"
 )
 
@@ -16,120 +20,254 @@ import (
 // is retrieved from the query. If this happens, the object returned will be a JSON
 // object in the form of {"Error": "description"}.
 func GetDataFromSQLQuery(db *sqlx.DB, query string, batchSize int, structDest interface{}) (chan data.JSON, error) {
-	stmt, err := db.Preparex(query)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Queryx()
-	if err != nil {
-		return nil, err
-	}
+	return GetDataFromSQLQueryContext(context.Background(), db, query, batchSize, structDest)
+}
 
-	columns, err := rows.Columns()
+// GetDataFromSQLQueryContext is the same as GetDataFromSQLQuery, but the
+// query is cancelled when ctx is done.
+func GetDataFromSQLQueryContext(ctx context.Context, db *sqlx.DB, query string, batchSize int, structDest interface{}) (chan data.JSON, error) {
+	rows, err := db.QueryxContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
 	dataChan := make(chan data.JSON)
-
-	if structDest != nil {
-		go scanRowsUsingStruct(rows, columns, structDest, batchSize, dataChan)
-	} else {
-		go scanDataGeneric(rows, columns, batchSize, dataChan)
-	}
-
+	go func() {
+		b := &rowBatcher{size: batchSize, flush: func(tableData []map[string]interface{}) error {
+			sendTableData(tableData, dataChan)
+			return nil
+		}}
+		_, err := scanRows(rows, structDest, b)
+		if err == nil {
+			err = b.close()
+		}
+		if err != nil {
+			sendErr(err, dataChan)
+		}
+		close(dataChan) // signal completion to caller
+	}()
 	return dataChan, nil
 }
 
-func scanRowsUsingStruct(rows *sqlx.Rows, columns []string, structDest interface{}, batchSize int, dataChan chan data.JSON) {
-	defer rows.Close()
-
-	tableData := []map[string]interface{}{}
+// ForEachSQLQueryBatch runs query, with args bound to its placeholders,
+// and calls forEach with each batch of up to batchSize rows (as a
+// data.JSON array of objects) as soon as it has been read, so results of
+// any size can be processed in bounded memory.
+// A batchSize of 0 sends every row in a single batch. Rows are decoded as
+// by GetDataFromSQLQuery.
+//
+// Most drivers stream rows from the server as they're read, but some
+// databases (notably Redshift) materialize the whole result for the
+// client first. If fetchSize is greater than 0, the query is read through
+// a server-side cursor instead, fetching fetchSize rows at a time in a
+// read-only transaction. Cursors are only supported by PostgreSQL and
+// Redshift.
+//
+// If timeout is greater than 0, it limits how long the database can take
+// to respond: to run the query, and to return each row after that. Time
+// spent in forEach doesn't count, so long reads only time out if the
+// database stops responding.
+//
+// Reading stops at the first error, from the query or from forEach, which
+// is returned.
+func ForEachSQLQueryBatch(ctx context.Context, db *sqlx.DB, query string, args []interface{}, fetchSize, batchSize int, timeout time.Duration, structDest interface{}, forEach func(d data.JSON) error) error {
+	ctx, w, cancel := newQueryWatchdog(ctx, timeout)
+	defer cancel()
+	err := forEachSQLQueryBatch(ctx, w, db, query, args, fetchSize, batchSize, structDest, forEach)
+	return w.err(err)
+}
 
-	for rows.Next() {
-		err := rows.StructScan(&structDest)
+func forEachSQLQueryBatch(ctx context.Context, w *queryWatchdog, db *sqlx.DB, query string, args []interface{}, fetchSize, batchSize int, structDest interface{}, forEach func(d data.JSON) error) error {
+	b := &rowBatcher{size: batchSize, watchdog: w, flush: func(tableData []map[string]interface{}) error {
+		d, err := data.NewJSON(tableData)
 		if err != nil {
-			sendErr(err, dataChan)
+			return err
 		}
-
-		d, err := data.NewJSON(structDest)
+		return forEach(d)
+	}}
+	if fetchSize <= 0 {
+		rows, err := db.QueryxContext(ctx, query, args...)
 		if err != nil {
-			sendErr(err, dataChan)
+			return err
+		}
+		if _, err := scanRows(rows, structDest, b); err != nil {
+			return err
 		}
+		return b.close()
+	}
 
-		entry := make(map[string]interface{})
-		err = data.ParseJSON(d, &entry)
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	// Nothing is written, so the transaction is just rolled back.
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DECLARE ratchet_cursor CURSOR FOR "+query, args...); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM ratchet_cursor", fetchSize)
+	for {
+		w.reset()
+		rows, err := tx.QueryxContext(ctx, fetch)
 		if err != nil {
-			sendErr(err, dataChan)
+			return err
 		}
+		// Rows are batched across fetches, so batches are full whatever
+		// the fetch size.
+		n, err := scanRows(rows, structDest, b)
+		if err != nil {
+			return err
+		}
+		if n < fetchSize {
+			return b.close()
+		}
+	}
+}
 
-		tableData = append(tableData, entry)
+// WithQueryTimeout calls fn with ctx limited to timeout, if it's greater
+// than 0, for running a single statement. If fn fails because the timeout
+// expired, the error says so, and is transient (see TransientError).
+func WithQueryTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(qctx)
+	if err != nil && qctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return queryTimeoutError(timeout, err)
+	}
+	return err
+}
 
-		if batchSize > 0 && len(tableData) >= batchSize {
-			sendTableData(tableData, dataChan)
-			tableData = []map[string]interface{}{}
-		}
+func queryTimeoutError(timeout time.Duration, err error) error {
+	return TransientError(fmt.Errorf("query timed out after %v: %w", timeout, err))
+}
+
+// queryWatchdog cancels a query if the database doesn't respond within
+// timeout of it being reset. It's stopped while rows that have been read
+// are being processed.
+type queryWatchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32
+}
+
+// newQueryWatchdog returns a watchdog, which has been started, and ctx
+// for the query. It does nothing if timeout is 0.
+func newQueryWatchdog(ctx context.Context, timeout time.Duration) (context.Context, *queryWatchdog, context.CancelFunc) {
+	w := &queryWatchdog{timeout: timeout}
+	if timeout <= 0 {
+		return ctx, w, func() {}
 	}
-	if rows.Err() != nil {
-		sendErr(rows.Err(), dataChan)
+	ctx, cancel := context.WithCancel(ctx)
+	w.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&w.expired, 1)
+		cancel()
+	})
+	return ctx, w, func() {
+		w.stop()
+		cancel()
 	}
+}
 
-	// Flush remaining tableData
-	if len(tableData) > 0 {
-		sendTableData(tableData, dataChan)
+func (w *queryWatchdog) reset() {
+	if w != nil && w.timer != nil {
+		w.timer.Reset(w.timeout)
 	}
+}
 
-	close(dataChan) // signal completion to caller
+func (w *queryWatchdog) stop() {
+	if w != nil && w.timer != nil {
+		w.timer.Stop()
+	}
 }
 
-func scanDataGeneric(rows *sqlx.Rows, columns []string, batchSize int, dataChan chan data.JSON) {
-	defer rows.Close()
+// err reports err as a timeout if the watchdog cancelled the query.
+func (w *queryWatchdog) err(err error) error {
+	if err != nil && atomic.LoadInt32(&w.expired) != 0 {
+		return queryTimeoutError(w.timeout, err)
+	}
+	return err
+}
+
+// rowBatcher collects rows, calling flush with each batch of size rows
+// (or with every row on close, if size is 0).
+type rowBatcher struct {
+	size     int
+	rows     []map[string]interface{}
+	flush    func(tableData []map[string]interface{}) error
+	watchdog *queryWatchdog // Reset for each row, and stopped while flushing
+}
+
+func (b *rowBatcher) add(row map[string]interface{}) error {
+	b.watchdog.reset()
+	b.rows = append(b.rows, row)
+	if b.size > 0 && len(b.rows) >= b.size {
+		return b.close()
+	}
+	return nil
+}
+
+// close flushes the remaining rows.
+func (b *rowBatcher) close() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	tableData := b.rows
+	b.rows = nil
+	b.watchdog.stop()
+	defer b.watchdog.reset()
+	return b.flush(tableData)
+}
 
-	tableData := []map[string]interface{}{}
+// scanRows reads rows into b, decoding them into structDest if it's set,
+// closes rows, and returns the number of rows read.
+func scanRows(rows *sqlx.Rows, structDest interface{}, b *rowBatcher) (int, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
 	values := make([]interface{}, len(columns))
 	valuePtrs := make([]interface{}, len(columns))
 	for i := 0; i < len(columns); i++ {
 		valuePtrs[i] = &values[i]
 	}
 
+	n := 0
 	for rows.Next() {
-		err := rows.Scan(valuePtrs...)
-		if err != nil {
-			sendErr(err, dataChan)
-		}
-
-		entry := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			// logger.Debug("Value Type for", col, " -> ", reflect.TypeOf(val))
-			switch vv := val.(type) {
-			case []byte:
-				v = string(vv)
-			default:
-				v = vv
+		entry := make(map[string]interface{}, len(columns))
+		if structDest != nil {
+			if err := rows.StructScan(structDest); err != nil {
+				return n, err
+			}
+			d, err := data.NewJSON(structDest)
+			if err != nil {
+				return n, err
+			}
+			if err := data.ParseJSON(d, &entry); err != nil {
+				return n, err
+			}
+		} else {
+			if err := rows.Scan(valuePtrs...); err != nil {
+				return n, err
+			}
+			for i, col := range columns {
+				switch vv := values[i].(type) {
+				case []byte:
+					entry[col] = string(vv)
+				default:
+					entry[col] = vv
+				}
 			}
-			entry[col] = v
 		}
-		tableData = append(tableData, entry)
-
-		if batchSize > 0 && len(tableData) >= batchSize {
-			sendTableData(tableData, dataChan)
-			tableData = []map[string]interface{}{}
+		n++
+		if err := b.add(entry); err != nil {
+			return n, err
 		}
 	}
-	if rows.Err() != nil {
-		sendErr(rows.Err(), dataChan)
-	}
-
-	// Flush remaining tableData
-	if len(tableData) > 0 {
-		sendTableData(tableData, dataChan)
-	}
-
-	close(dataChan) // signal completion to caller
+	return n, rows.Err()
 }
 
 // http://play.golang.org/p/2wHfO6YS3_
@@ -166,7 +304,13 @@ func sendErr(err error, dataChan chan data.JSON) {
 
 // ExecuteSQLQuery allows you to execute arbitrary SQL statements
 func ExecuteSQLQuery(db *sqlx.DB, query string) error {
-	_, err := db.Exec(query)
+	return ExecuteSQLQueryContext(context.Background(), db, query)
+}
+
+// ExecuteSQLQueryContext is the same as ExecuteSQLQuery, but the statement
+// is cancelled when ctx is done.
+func ExecuteSQLQueryContext(ctx context.Context, db *sqlx.DB, query string) error {
+	_, err := db.ExecContext(ctx, query)
 	return err
 }
 
@@ -0,0 +1,183 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The operations a SQL writer can apply to a record, see SQLiteInsertOptions.Mode.
+const (
+	SQLOpInsert = "insert"
+	SQLOpUpdate = "update"
+	SQLOpDelete = "delete"
+)
+
+// SQLOp returns the operation to apply to record: the value of its opField,
+// if opField isn't empty, otherwise mode (which defaults to SQLOpInsert).
+// Besides the operations themselves, the op codes used by change data
+// capture tools are understood: c, r and i (and create, read and
+// snapshot) are inserts, u is an update, and d a delete.
+func SQLOp(record map[string]interface{}, opField, mode string) (string, error) {
+	op := mode
+	if opField != "" {
+		v, ok := record[opField]
+		if !ok || v == nil {
+			return "", DataErrorf("record has no %v field", opField)
+		}
+		op = fmt.Sprint(v)
+	}
+	switch strings.ToLower(op) {
+	case "", SQLOpInsert, "i", "c", "create", "r", "read", "snapshot":
+		return SQLOpInsert, nil
+	case SQLOpUpdate, "u":
+		return SQLOpUpdate, nil
+	case SQLOpDelete, "d":
+		return SQLOpDelete, nil
+	}
+	if opField != "" {
+		return "", DataErrorf("unknown operation %q in %v field", op, opField)
+	}
+	return "", ConfigErrorf("unknown operation %q", op)
+}
+
+// SQLOpRun is a run of consecutive records with the same operation.
+type SQLOpRun struct {
+	Op      string
+	Objects []map[string]interface{}
+}
+
+// SplitSQLOps splits objects into runs of consecutive records with the same
+// operation (see SQLOp), keeping them in order so changes from a CDC stream
+// are applied in the order they happened. opField is removed from the
+// records returned, which are copies if it's set.
+func SplitSQLOps(objects []map[string]interface{}, opField, mode string) ([]SQLOpRun, error) {
+	var runs []SQLOpRun
+	for _, o := range objects {
+		op, err := SQLOp(o, opField, mode)
+		if err != nil {
+			return nil, err
+		}
+		if opField != "" {
+			c := make(map[string]interface{}, len(o))
+			for k, v := range o {
+				if k != opField {
+					c[k] = v
+				}
+			}
+			o = c
+		}
+		if len(runs) == 0 || runs[len(runs)-1].Op != op {
+			runs = append(runs, SQLOpRun{Op: op})
+		}
+		runs[len(runs)-1].Objects = append(runs[len(runs)-1].Objects, o)
+	}
+	return runs, nil
+}
+
+// BuildUpdateSQL builds an UPDATE of tableName setting every field of
+// object that isn't one of keys, for the row whose keys match object's,
+// returning the statement and the values to bind to it. The statement is
+// empty if there's nothing to set.
+func BuildUpdateSQL(dialect Dialect, object map[string]interface{}, tableName string, keys []string) (string, []interface{}, error) {
+	if len(keys) == 0 {
+		return "", nil, ConfigErrorf("key fields are required to UPDATE %v", tableName)
+	}
+	if err := validateSQLNames(tableName, []map[string]interface{}{object}); err != nil {
+		return "", nil, err
+	}
+	isKey := map[string]bool{}
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	var cols []string
+	for col := range object {
+		if !isKey[col] {
+			cols = append(cols, col)
+		}
+	}
+	if len(cols) == 0 {
+		return "", nil, nil
+	}
+	sort.Strings(cols)
+
+	// Format: UPDATE tablename SET col1=?,col2=? WHERE key1=? AND key2=?
+	var b strings.Builder
+	vals := make([]interface{}, 0, len(cols)+len(keys))
+	fmt.Fprintf(&b, "UPDATE %v SET ", tableName)
+	for i, col := range cols {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		vals = append(vals, object[col])
+		fmt.Fprintf(&b, "%v=%v", col, dialect.Placeholder(len(vals)))
+	}
+	b.WriteString(" WHERE ")
+	for i, k := range keys {
+		v, ok := object[k]
+		if !ok {
+			return "", nil, DataErrorf("Missing value for primary key: %v", k)
+		}
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		vals = append(vals, v)
+		fmt.Fprintf(&b, "%v=%v", k, dialect.Placeholder(len(vals)))
+	}
+	return b.String(), vals, nil
+}
+
+// BuildDeleteSQL builds a single DELETE of the rows of tableName whose
+// keys match those of any of the objects, returning the statement and the
+// values to bind to it. Fields other than keys are ignored.
+func BuildDeleteSQL(dialect Dialect, objects []map[string]interface{}, tableName string, keys []string) (string, []interface{}, error) {
+	if len(keys) == 0 {
+		return "", nil, ConfigErrorf("key fields are required to DELETE from %v", tableName)
+	}
+	if err := ValidateSQLTableName(tableName); err != nil {
+		return "", nil, err
+	}
+
+	// Format: DELETE FROM tablename WHERE key1 IN (?,?), or with several
+	// keys, WHERE (key1=? AND key2=?) OR (key1=? AND key2=?)
+	var b strings.Builder
+	vals := make([]interface{}, 0, len(objects)*len(keys))
+	fmt.Fprintf(&b, "DELETE FROM %v WHERE ", tableName)
+	if len(keys) == 1 {
+		fmt.Fprintf(&b, "%v IN (", keys[0])
+	}
+	for i, obj := range objects {
+		if i > 0 {
+			if len(keys) == 1 {
+				b.WriteByte(',')
+			} else {
+				b.WriteString(" OR ")
+			}
+		}
+		if len(keys) > 1 {
+			b.WriteByte('(')
+		}
+		for j, k := range keys {
+			v, ok := obj[k]
+			if !ok {
+				return "", nil, DataErrorf("Missing value for primary key: %v", k)
+			}
+			vals = append(vals, v)
+			if len(keys) == 1 {
+				b.WriteString(dialect.Placeholder(len(vals)))
+				continue
+			}
+			if j > 0 {
+				b.WriteString(" AND ")
+			}
+			fmt.Fprintf(&b, "%v=%v", k, dialect.Placeholder(len(vals)))
+		}
+		if len(keys) > 1 {
+			b.WriteByte(')')
+		}
+	}
+	if len(keys) == 1 {
+		b.WriteByte(')')
+	}
+	return b.String(), vals, nil
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// SQLRetry configures retrying SQL statements that fail with retryable
+// errors (see IsRetryableSQLError), so a dropped connection or a deadlock
+// doesn't fail a whole Pipeline.
+type SQLRetry struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// 0 or 1 means statements aren't retried.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for each
+	// following one up to MaxBackoff. Defaults to a second.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// SQLExecOptions controls how each statement is run by the functions
+// taking it.
+type SQLExecOptions struct {
+	// Timeout limits each attempt at a statement, see WithQueryTimeout.
+	Timeout time.Duration
+	Retry   SQLRetry
+}
+
+// Run calls fn to run a statement on db, with ctx limited to o.Timeout,
+// retrying it as configured by o.Retry. Before retrying after a lost
+// connection, db is pinged so the pool reconnects (and the retry waits
+// for the database to come back).
+func (o SQLExecOptions) Run(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) error {
+	return o.Retry.Do(ctx, db, func(ctx context.Context) error {
+		return WithQueryTimeout(ctx, o.Timeout, fn)
+	})
+}
+
+// Do calls fn, retrying it as configured. db is used to reconnect after
+// a lost connection, and can be nil.
+func (r SQLRetry) Do(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) error {
+	backoff := r.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= r.MaxAttempts || !IsRetryableSQLError(err) || ctx.Err() != nil {
+			return err
+		}
+		logger.Info("SQL: attempt", attempt, "of", r.MaxAttempts, "failed, retrying in", backoff, "-", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		if db != nil && isConnectionError(err) {
+			if perr := db.PingContext(ctx); perr != nil {
+				logger.Info("SQL: unable to reconnect -", perr)
+			}
+		}
+		if backoff *= 2; r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+			backoff = r.MaxBackoff
+		}
+	}
+}
+
+// IsRetryableSQLError returns true if err is worth retrying: a lost
+// database connection, a deadlock, a serialization failure, a lock wait
+// timeout, a busy SQLite database, or any other transient error (see
+// IsTransient). Errors marked with a category other than
+// CategoryTransient aren't retried.
+func IsRetryableSQLError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// Errors that have been given a category explicitly keep it.
+	var categorized interface{ ErrorCategory() ErrorCategory }
+	if errors.As(err, &categorized) {
+		return categorized.ErrorCategory() == CategoryTransient
+	}
+	if IsTransient(err) || isConnectionError(err) {
+		return true
+	}
+
+	// PostgreSQL (lib/pq and pgx) errors report their SQLSTATE.
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		switch code := state.SQLState(); {
+		case code == "40001", code == "40P01": // serialization_failure, deadlock_detected
+			return true
+		case code == "55P03": // lock_not_available
+			return true
+		case code == "57P01", code == "57P03": // admin_shutdown, cannot_connect_now
+			return true
+		case strings.HasPrefix(code, "08"): // connection_exception
+			return true
+		}
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1205, 1213: // ER_LOCK_WAIT_TIMEOUT, ER_LOCK_DEADLOCK
+			return true
+		}
+		return false
+	}
+
+	// SQLite errors (from modernc.org/sqlite) report their result code.
+	var code interface{ Code() int }
+	if errors.As(err, &code) {
+		switch code.Code() & 0xff {
+		case 5, 6: // SQLITE_BUSY, SQLITE_LOCKED
+			return true
+		}
+	}
+	return false
+}
+
+// isConnectionError returns true if err means the connection to the
+// database was lost.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.As(err, &netErr)
+}
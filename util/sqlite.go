@@ -1,13 +1,14 @@
 package util
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/fefelovgroup/ratchet/data"
 	"github.com/fefelovgroup/ratchet/logger"
-	"errors"
 	"sort"
 )
 
@@ -26,56 +27,580 @@ import (
 func SQLiteInsertData(db *sqlx.DB, d data.JSON, tableName string,
 onDupKeyUpdate bool, primaryKeys[]string, preservedFields []string,
 batchSize int) error {
+	return SQLiteInsertDataWithOptions(db, d, SQLiteInsertOptions{
+		TableName:       tableName,
+		OnDupKeyUpdate:  onDupKeyUpdate,
+		PrimaryKeys:     primaryKeys,
+		PreservedFields: preservedFields,
+		BatchSize:       batchSize,
+	})
+}
+
+// SQLiteInsertOptions holds the settings used by SQLiteInsertDataWithOptions.
+// See SQLiteInsertData for a description of the INSERT related fields.
+type SQLiteInsertOptions struct {
+	TableName       string
+	OnDupKeyUpdate  bool
+	PrimaryKeys     []string
+	PreservedFields []string
+	BatchSize       int
+
+	// AdaptiveBatchSize, if set, chooses the size of each batch instead of
+	// BatchSize, adjusting it to how long batches take and whether they
+	// fail. The size is still reduced for a failure that rolls back the
+	// transaction, so a Retry writes smaller batches.
+	AdaptiveBatchSize *AdaptiveBatchSize
+
+	// SkipResultCheck treats a successful Exec as success without asking
+	// the driver for LastInsertId and RowsAffected. This is needed when
+	// writing through a view with INSTEAD OF triggers, where those
+	// results are meaningless. See SQLiteIsView.
+	SkipResultCheck bool
+
+	// UseSavepoints wraps each batch in a SAVEPOINT. When a batch fails
+	// it is rolled back to its savepoint and passed to OnBatchError. If
+	// OnBatchError returns nil, the remaining batches are still written
+	// and the transaction (including all successful batches) commits.
+	UseSavepoints bool
+	OnBatchError  func(batch []map[string]interface{}, err error) error
+
+	// OnRecordError enables per-record error handling (and implies
+	// UseSavepoints). When a batch fails, each of its records is retried
+	// in its own SAVEPOINT and those that still fail are passed to
+	// OnRecordError. Transient errors (see IsTransient) are not passed on,
+	// since they say nothing about the record itself. If OnRecordError
+	// returns nil, writing continues.
+	OnRecordError func(record map[string]interface{}, err error) error
+
+	// Timeout limits each INSERT, if it's greater than 0. See
+	// WithQueryTimeout.
+	Timeout time.Duration
+
+	// Retry retries the whole transaction if it fails with a retryable
+	// error, such as SQLITE_BUSY (see IsRetryableSQLError). Records
+	// already passed to OnBatchError or OnRecordError may be passed again.
+	Retry SQLRetry
+
+	// Mode is the operation applied to records: SQLOpInsert (the
+	// default), SQLOpUpdate, which updates the fields of the row with
+	// the record's PrimaryKeys, or SQLOpDelete, which deletes it. If
+	// OpField is set, each record's operation is read from that field
+	// instead (see SQLOp), and the field isn't written, so a stream of
+	// changes can be applied. PrimaryKeys are required to update or
+	// delete.
+	Mode    string
+	OpField string
+
+	// IDField, if set, is set in each inserted object to the rowid
+	// generated for its row (its INTEGER PRIMARY KEY) once the
+	// transaction commits, so the records can be passed on with their new
+	// IDs. Rows are then inserted one at a time. Objects that already have
+	// a value for IDField keep it. IDField can't be used with OpField or
+	// SkipResultCheck.
+	IDField string
+	ids     *sqliteIDs
+
+	// AddColumns adds a column to the table for each field of the
+	// records it doesn't have yet before writing them, so new upstream
+	// fields don't fail the load. See SQLiteAddColumns.
+	AddColumns bool
+
+	// AllowedColumns, if set, are the only fields records may have
+	// (besides OpField): a record with any other field fails the write.
+	// Table and column names are always validated, see
+	// ValidateSQLTableName.
+	AllowedColumns []string
+
+	// IncludeColumns, if set, are the only fields of records that are
+	// written, and ExcludeColumns are fields that aren't: the others are
+	// dropped (from copies of the records), so a table can ignore
+	// upstream fields it has no columns for. OpField is always kept.
+	// AllowedColumns are checked after fields have been dropped.
+	IncludeColumns []string
+	ExcludeColumns []string
+
+	// Counts, if set, has the rows written added to it once the
+	// transaction commits. To tell the rows an upsert (OnDupKeyUpdate)
+	// inserts from those it updates or leaves unchanged, the existing
+	// rows with the PrimaryKeys of each batch are looked up first, which
+	// costs a query per batch. Without PrimaryKeys, they're all counted
+	// as inserted. PreservedFields aren't compared.
+	Counts *SQLWriteCounts
+	counts *SQLWriteCounts
+}
+
+// SQLiteInsertDataWithOptions is the same as SQLiteInsertData, but
+// is configured with SQLiteInsertOptions.
+// All batches are written within a single transaction.
+func SQLiteInsertDataWithOptions(db *sqlx.DB, d data.JSON,
+opts SQLiteInsertOptions) error {
+	return SQLiteInsertDataWithOptionsContext(context.Background(), db, d, opts)
+}
+
+// SQLiteInsertDataWithOptionsContext is the same as
+// SQLiteInsertDataWithOptions, but the transaction is rolled back if ctx
+// is done before it commits.
+func SQLiteInsertDataWithOptionsContext(ctx context.Context, db *sqlx.DB,
+d data.JSON, opts SQLiteInsertOptions) error {
+
+	objects, err := data.ObjectsFromJSON(d)
+	if err != nil {
+		return DataInvalidError(err)
+	}
+	return SQLiteInsertObjectsContext(ctx, db, objects, opts)
+}
 
-	if len(preservedFields) > 0 {
-		if len(primaryKeys) == 0 {
-			return errors.New(
+// SQLiteInsertObjectsContext is the same as
+// SQLiteInsertDataWithOptionsContext, but takes the objects to write
+// rather than a Data object, so their generated IDs can be read back
+// (see SQLiteInsertOptions.IDField).
+func SQLiteInsertObjectsContext(ctx context.Context, db *sqlx.DB,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
+
+	if len(opts.PreservedFields) > 0 {
+		if len(opts.PrimaryKeys) == 0 {
+			return ConfigErrorf(
 				"primaryKeys required if preservedFields specified")
 		}
 	}
+	if opts.OpField != "" || (opts.Mode != "" && opts.Mode != SQLOpInsert) {
+		if _, err := SQLOp(nil, "", opts.Mode); err != nil {
+			return err
+		}
+		if len(opts.PrimaryKeys) == 0 {
+			return ConfigErrorf(
+				"primaryKeys required to update or delete")
+		}
+	}
+	if opts.IDField != "" && (opts.OpField != "" || opts.SkipResultCheck) {
+		return ConfigErrorf(
+			"IDField can't be used with OpField or SkipResultCheck")
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	rows, err := opts.columns(objects)
+	if err != nil {
+		return err
+	}
+	if opts.AddColumns {
+		var skip []string
+		if opts.OpField != "" {
+			skip = append(skip, opts.OpField)
+		}
+		if _, err := SQLiteAddColumns(ctx, db, opts.TableName, rows, skip...); err != nil {
+			return err
+		}
+	}
+	err = opts.Retry.Do(ctx, db, func(ctx context.Context) error {
+		return sqliteInsertTx(ctx, db, rows, opts)
+	})
+	if err != nil || opts.IDField == "" {
+		return err
+	}
+	// Pass the IDs generated for copies back to the records.
+	for i, obj := range objects {
+		if obj[opts.IDField] == nil {
+			if id, ok := rows[i][opts.IDField]; ok && id != nil {
+				obj[opts.IDField] = id
+			}
+		}
+	}
+	return nil
+}
 
-	objects, err := data.ObjectsFromJSON(d)
+// columns returns the objects with only the fields to write, see
+// IncludeColumns and ExcludeColumns, checked against AllowedColumns.
+func (opts SQLiteInsertOptions) columns(objects []map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(opts.IncludeColumns) > 0 || len(opts.ExcludeColumns) > 0 {
+		keep := func(col string) bool { return true }
+		if len(opts.IncludeColumns) > 0 {
+			included := stringSet(opts.IncludeColumns)
+			keep = func(col string) bool { return included[col] }
+		}
+		excluded := stringSet(opts.ExcludeColumns)
+		rows := make([]map[string]interface{}, len(objects))
+		for i, obj := range objects {
+			rows[i] = make(map[string]interface{}, len(obj))
+			for col, v := range obj {
+				if col == opts.OpField || (keep(col) && !excluded[col]) {
+					rows[i][col] = v
+				}
+			}
+		}
+		objects = rows
+	}
+	if len(opts.AllowedColumns) == 0 {
+		return objects, nil
+	}
+	allowed := opts.AllowedColumns
+	if opts.OpField != "" {
+		allowed = append(allowed[:len(allowed):len(allowed)], opts.OpField)
+	}
+	return objects, ValidateSQLColumns(objects, allowed)
+}
+
+func stringSet(strs []string) map[string]bool {
+	set := make(map[string]bool, len(strs))
+	for _, s := range strs {
+		set[s] = true
+	}
+	return set
+}
+
+func sqliteInsertTx(ctx context.Context, db *sqlx.DB,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
+	if opts.IDField != "" {
+		opts.ids = &sqliteIDs{}
+	}
+	if opts.Counts != nil {
+		opts.counts = &SQLWriteCounts{}
+	}
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	tx:=db.MustBegin()
-	if batchSize > 0 {
-		for i := 0; i < len(objects); i += batchSize {
-			maxIndex := i + batchSize
-			if maxIndex > len(objects) {
-				maxIndex = len(objects)
+	writeBatch := func(batch []map[string]interface{}) error {
+		if opts.UseSavepoints || opts.OnRecordError != nil {
+			return sqliteInsertObjectsWithSavepoint(ctx, tx, batch, opts)
+		}
+		return sqliteWriteBatch(ctx, tx, batch, opts)
+	}
+	if opts.AdaptiveBatchSize != nil {
+		err = ForEachAdaptiveBatch(objects, opts.AdaptiveBatchSize, writeBatch)
+	} else {
+		err = ForEachBatch(objects, opts.BatchSize, 1, writeBatch)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	opts.ids.assign(opts.IDField)
+	if opts.Counts != nil {
+		opts.Counts.Add(*opts.counts)
+	}
+	return nil
+}
+
+// sqliteIDs holds the rowids generated for inserted objects until the
+// transaction commits.
+type sqliteIDs struct {
+	objects []map[string]interface{}
+	ids     []int64
+}
+
+// rollback forgets the IDs generated since there were n of them, when
+// their rows are rolled back to a savepoint.
+func (g *sqliteIDs) rollback(n int) {
+	if g != nil {
+		g.objects, g.ids = g.objects[:n], g.ids[:n]
+	}
+}
+
+func (g *sqliteIDs) len() int {
+	if g == nil {
+		return 0
+	}
+	return len(g.ids)
+}
+
+func (g *sqliteIDs) assign(idField string) {
+	if g == nil {
+		return
+	}
+	for i, obj := range g.objects {
+		if obj[idField] == nil {
+			obj[idField] = g.ids[i]
+		}
+	}
+}
+
+// snapshot returns the rows counted so far in the transaction, to
+// rollback to if the rows written next are rolled back to a savepoint.
+func (c *SQLWriteCounts) snapshot() SQLWriteCounts {
+	if c == nil {
+		return SQLWriteCounts{}
+	}
+	return *c
+}
+
+func (c *SQLWriteCounts) rollback(to SQLWriteCounts) {
+	if c != nil {
+		*c = to
+	}
+}
+
+func sqliteInsertObjectsWithSavepoint(ctx context.Context, tx *sqlx.Tx,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
+
+	n, counts := opts.ids.len(), opts.counts.snapshot()
+	err, txErr := sqliteTryWithSavepoint(tx, func() error {
+		return sqliteWriteBatch(ctx, tx, objects, opts)
+	})
+	if txErr != nil || err == nil {
+		return txErr
+	}
+	opts.ids.rollback(n)
+	opts.counts.rollback(counts)
+
+	if opts.OnRecordError != nil && !IsTransient(err) {
+		for _, obj := range objects {
+			if err := sqliteInsertRecordWithSavepoint(ctx, tx, obj, opts); err != nil {
+				return err
 			}
-			err = sqliteInsertObjects(tx, objects[i:maxIndex], tableName,
-				onDupKeyUpdate, primaryKeys, preservedFields)
+		}
+		return nil
+	}
+	if opts.OnBatchError != nil {
+		return opts.OnBatchError(objects, err)
+	}
+	return err
+}
+
+func sqliteInsertRecordWithSavepoint(ctx context.Context, tx *sqlx.Tx,
+obj map[string]interface{}, opts SQLiteInsertOptions) error {
+
+	n, counts := opts.ids.len(), opts.counts.snapshot()
+	err, txErr := sqliteTryWithSavepoint(tx, func() error {
+		return sqliteWriteBatch(ctx, tx, []map[string]interface{}{obj}, opts)
+	})
+	if txErr != nil || err == nil {
+		return txErr
+	}
+	opts.ids.rollback(n)
+	opts.counts.rollback(counts)
+	if IsTransient(err) {
+		return err
+	}
+	return opts.OnRecordError(obj, err)
+}
+
+// sqliteTryWithSavepoint runs fn within a SAVEPOINT, rolling back to it
+// if fn fails. fn's error is returned as err, while txErr is any error
+// managing the savepoint itself.
+func sqliteTryWithSavepoint(tx *sqlx.Tx, fn func() error) (err, txErr error) {
+	if _, txErr = tx.Exec("SAVEPOINT ratchet_batch"); txErr != nil {
+		return
+	}
+	if err = fn(); err == nil {
+		_, txErr = tx.Exec("RELEASE ratchet_batch")
+		return
+	}
+
+	logger.Info("SQLiteInsertData: rolling back to savepoint -", err)
+	if _, txErr = tx.Exec("ROLLBACK TO ratchet_batch"); txErr != nil {
+		return
+	}
+	_, txErr = tx.Exec("RELEASE ratchet_batch")
+	return
+}
+
+// SQLiteIsView returns true if tableName refers to a view rather than a
+// table. tableName may be qualified with the name of an attached database.
+func SQLiteIsView(db *sqlx.DB, tableName string) (bool, error) {
+	if err := ValidateSQLTableName(tableName); err != nil {
+		return false, err
+	}
+	master := "sqlite_master"
+	name := tableName
+	if i := strings.LastIndex(tableName, "."); i >= 0 {
+		master = tableName[:i] + ".sqlite_master"
+		name = tableName[i+1:]
+	}
+	var count int
+	err := db.Get(&count,
+		fmt.Sprintf("SELECT count(*) FROM %v WHERE type = 'view' AND name = ?",
+			master), name)
+	return count > 0, err
+}
+
+// sqliteWriteBatch applies the operation of each of the objects (see
+// SQLiteInsertOptions.Mode), each statement limited to opts.Timeout.
+func sqliteWriteBatch(ctx context.Context, tx *sqlx.Tx,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
+	if opts.OpField == "" && (opts.Mode == "" || opts.Mode == SQLOpInsert) {
+		return sqliteInsertBatch(ctx, tx, objects, opts)
+	}
+	runs, err := SplitSQLOps(objects, opts.OpField, opts.Mode)
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.Op == SQLOpInsert {
+			err = sqliteInsertBatch(ctx, tx, run.Objects, opts)
+		} else {
+			err = WithQueryTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+				return sqliteChangeObjects(ctx, tx, run, opts)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteChangeObjects updates or deletes the rows of run's objects.
+func sqliteChangeObjects(ctx context.Context, tx *sqlx.Tx, run SQLOpRun,
+opts SQLiteInsertOptions) error {
+	statements, err := buildSQLiteChangeSQL(run, opts)
+	if err != nil {
+		return err
+	}
+	var rowCnt int64
+	for _, st := range statements {
+		logger.Debug("SQLiteInsertData:", st.sql)
+		logger.Debug("SQLiteInsertData: values", st.vals)
+		res, err := tx.ExecContext(ctx, st.sql, st.vals...)
+		if err != nil {
+			return err
+		}
+		if !opts.SkipResultCheck {
+			n, err := res.RowsAffected()
 			if err != nil {
-				tx.Rollback()
 				return err
 			}
+			rowCnt += n
+		}
+	}
+	logger.Info(fmt.Sprintf("SQLiteInsertData: %v len(objects) = %d, rows affected = %d",
+		run.Op, len(run.Objects), rowCnt))
+	if opts.counts != nil {
+		if run.Op == SQLOpDelete {
+			opts.counts.Deleted += rowCnt
+		} else {
+			opts.counts.Updated += rowCnt
 		}
-		tx.Commit()
+	}
+	return nil
+}
+
+type sqliteStatement struct {
+	sql  string
+	vals []interface{}
+}
+
+// buildSQLiteChangeSQL builds the statements to update (one per object) or
+// delete (all at once) the rows of run's objects.
+func buildSQLiteChangeSQL(run SQLOpRun, opts SQLiteInsertOptions) ([]sqliteStatement, error) {
+	if run.Op == SQLOpDelete {
+		deleteSQL, vals, err := BuildDeleteSQL(SQLite, run.Objects,
+			opts.TableName, opts.PrimaryKeys)
+		if err != nil {
+			return nil, err
+		}
+		return []sqliteStatement{{deleteSQL, vals}}, nil
+	}
+	var statements []sqliteStatement
+	for _, obj := range run.Objects {
+		updateSQL, vals, err := BuildUpdateSQL(SQLite, obj, opts.TableName,
+			opts.PrimaryKeys)
+		if err != nil {
+			return nil, err
+		}
+		if updateSQL != "" {
+			statements = append(statements, sqliteStatement{updateSQL, vals})
+		}
+	}
+	return statements, nil
+}
+
+// sqliteInsertBatch runs sqliteInsertObjects, limited to opts.Timeout,
+// and counts the rows written in opts.counts.
+func sqliteInsertBatch(ctx context.Context, tx *sqlx.Tx,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
+	return WithQueryTimeout(ctx, opts.Timeout, func(ctx context.Context) error {
+		if opts.counts == nil {
+			return sqliteInsertObjects(ctx, tx, objects, opts)
+		}
+		var existing, unchanged int64
+		if opts.OnDupKeyUpdate && len(opts.PrimaryKeys) > 0 {
+			var err error
+			existing, unchanged, err = sqliteCountExisting(ctx, tx, objects, opts)
+			if err != nil {
+				return err
+			}
+		}
+		if err := sqliteInsertObjects(ctx, tx, objects, opts); err != nil {
+			return err
+		}
+		opts.counts.Inserted += int64(len(objects)) - existing
+		opts.counts.Updated += existing - unchanged
+		opts.counts.Unchanged += unchanged
 		return nil
+	})
+}
+
+// sqliteCountExisting returns how many of the objects have the same
+// PrimaryKeys as an existing row, and how many of those have the same
+// values too, i.e. will be updated and left unchanged by an upsert.
+func sqliteCountExisting(ctx context.Context, tx *sqlx.Tx,
+objects []map[string]interface{}, opts SQLiteInsertOptions) (existing, unchanged int64, err error) {
+
+	if err := validateSQLNames(opts.TableName, objects); err != nil {
+		return 0, 0, err
+	}
+	cols := sortedColumns(objects)
+	isCol := stringSet(cols)
+	for _, k := range opts.PrimaryKeys {
+		if !isCol[k] {
+			// No key, so every row is new (e.g. a generated rowid).
+			return 0, 0, nil
+		}
+	}
+	isKey := stringSet(opts.PrimaryKeys)
+	preserved := stringSet(opts.PreservedFields)
+	joins := make([]string, 0, len(opts.PrimaryKeys))
+	same := []string{"1"}
+	for _, col := range cols {
+		switch {
+		case isKey[col]:
+			joins = append(joins, fmt.Sprintf("t.%v = v.%v", col, col))
+		case !preserved[col]:
+			same = append(same, fmt.Sprintf("t.%v IS v.%v", col, col))
+		}
 	}
-	tx.Commit()
-	return sqliteInsertObjects(tx, objects, tableName, onDupKeyUpdate,
-		primaryKeys, preservedFields)
 
+	// Format: WITH v(col1,col2) AS (VALUES (?,?),(?,?))
+	// SELECT count(*), count(CASE WHEN t.col2 IS v.col2 THEN 1 END)
+	// FROM tablename AS t JOIN v ON t.col1 = v.col1
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(cols)), ",") + ")"
+	rows := strings.TrimSuffix(strings.Repeat(row+",", len(objects)), ",")
+	countSQL := fmt.Sprintf(
+		"WITH v(%v) AS (VALUES %v) SELECT count(*), count(CASE WHEN %v THEN 1 END) FROM %v AS t JOIN v ON %v",
+		strings.Join(cols, ","), rows, strings.Join(same, " AND "),
+		opts.TableName, strings.Join(joins, " AND "))
+	vals := make([]interface{}, 0, len(objects)*len(cols))
+	for _, obj := range objects {
+		for _, col := range cols {
+			vals = append(vals, obj[col])
+		}
+	}
+	logger.Debug("SQLiteInsertData:", countSQL)
+	err = tx.QueryRowxContext(ctx, countSQL, vals...).Scan(&existing, &unchanged)
+	return existing, unchanged, err
 }
 
-func sqliteInsertObjects(tx *sqlx.Tx, objects []map[string]interface{},
-tableName string, onDupKeyUpdate bool, primaryKeys[]string,
-preservedFields []string) error {
+func sqliteInsertObjects(ctx context.Context, tx *sqlx.Tx,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
 
+	if opts.ids != nil {
+		return sqliteInsertObjectsWithIDs(ctx, tx, objects, opts)
+	}
 	logger.Info(
 		"SQLiteInsertData: building INSERT for len(objects) =", len(objects))
-	insertSQL, vals, err := buildSQLiteInsertSQL(objects, tableName, onDupKeyUpdate,
-		primaryKeys, preservedFields)
+	insertSQL, vals, err := buildSQLiteInsertSQL(objects, opts.TableName,
+		opts.OnDupKeyUpdate, opts.PrimaryKeys, opts.PreservedFields)
 	if err != nil {
 		return err
 	}
 
 	logger.Debug("SQLiteInsertData:", insertSQL)
 	logger.Debug("SQLiteInsertData: values", vals)
-	stmt, err := tx.Preparex(insertSQL)
+	stmt, err := tx.PreparexContext(ctx, insertSQL)
 
 	if err != nil {
 		logger.Debug("SQLiteInsertData: error preparing SQL")
@@ -83,10 +608,14 @@ preservedFields []string) error {
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(vals...)
+	res, err := stmt.ExecContext(ctx, vals...)
 	if err != nil {
 		return err
 	}
+	if opts.SkipResultCheck {
+		logger.Info("SQLiteInsertData: insert executed, skipping result check")
+		return nil
+	}
 	lastID, err := res.LastInsertId()
 	if err != nil {
 		return err
@@ -103,10 +632,42 @@ preservedFields []string) error {
 	return nil
 }
 
+// sqliteInsertObjectsWithIDs inserts objects one at a time, adding the
+// rowid generated for each to opts.ids.
+func sqliteInsertObjectsWithIDs(ctx context.Context, tx *sqlx.Tx,
+objects []map[string]interface{}, opts SQLiteInsertOptions) error {
+
+	ids := make([]int64, len(objects))
+	for i, obj := range objects {
+		insertSQL, vals, err := buildSQLiteInsertSQL(
+			[]map[string]interface{}{obj}, opts.TableName,
+			opts.OnDupKeyUpdate, opts.PrimaryKeys, opts.PreservedFields)
+		if err != nil {
+			return err
+		}
+		logger.Debug("SQLiteInsertData:", insertSQL)
+		res, err := tx.ExecContext(ctx, insertSQL, vals...)
+		if err != nil {
+			return err
+		}
+		if ids[i], err = res.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	logger.Info(
+		"SQLiteInsertData: inserted len(objects) =", len(objects))
+	opts.ids.objects = append(opts.ids.objects, objects...)
+	opts.ids.ids = append(opts.ids.ids, ids...)
+	return nil
+}
+
 func buildSQLiteInsertSQL(objects []map[string]interface{}, tableName string,
 onDupKeyUpdate bool, primaryKeys[]string, preservedFields []string) (
 insertSQL string, vals []interface{}, err error) {
 
+	if err := validateSQLNames(tableName, objects); err != nil {
+		return "", nil, err
+	}
 	cols := sortedColumns(objects)
 
 	// preservedFieldMap must be listed in cols,
@@ -133,17 +694,16 @@ insertSQL string, vals []interface{}, err error) {
 	// Select statements are used to determine
 	// the current values of preservedFields columns
 	// as explained here http://stackoverflow.com/a/4330694/639133
+	verb := "INSERT"
 	if (onDupKeyUpdate) {
-		insertSQL = fmt.Sprintf("INSERT OR REPLACE INTO %v(%v) VALUES",
-			tableName, strings.Join(cols, ","))
-	} else {
-		// Do not update existing fields, just insert.
-		// "ON CONFLICT" as specified by the create table statement
-		// will determine the behaviour for duplicate keys
-		// https://sqlite.org/lang_conflict.html
-		insertSQL = fmt.Sprintf("INSERT INTO %v(%v) VALUES", tableName,
-			strings.Join(cols, ","))
+		verb, _ = SQLite.Upsert(primaryKeys, cols)
 	}
+	// Otherwise do not update existing fields, just insert.
+	// "ON CONFLICT" as specified by the create table statement
+	// will determine the behaviour for duplicate keys
+	// https://sqlite.org/lang_conflict.html
+	insertSQL = fmt.Sprintf("%v INTO %v(%v) VALUES", verb, tableName,
+		strings.Join(cols, ","))
 
 	// Selected statements used to lookup existing values may require
 	// some values to be bound to multiple placeholders.
@@ -192,8 +752,7 @@ insertSQL string, vals []interface{}, err error) {
 				vals = append(vals, val)
 			} else {
 				if primaryKeyMap[col] {
-					err = errors.New(
-						fmt.Sprintf("Missing value for primary key: %v", col))
+					err = DataErrorf("Missing value for primary key: %v", col)
 					return
 				}
 				vals = append(vals, nil)
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// SQLiteAttach attaches database files to db, by schema name, so their
+// tables can be written to as schema.table, e.g. to shard a load into a
+// file per tenant or per month. Files that don't exist yet are created.
+//
+// Databases are attached to a connection rather than to the pool, so db
+// is limited to a single connection, which is kept open. Databases that
+// aren't attached to it are attached each time SQLiteAttach is called, so
+// it's cheap to call before each write, in case the connection has been
+// replaced. Since that connection is held for the whole of a transaction,
+// nothing else can use db while one is open.
+func SQLiteAttach(ctx context.Context, db *sqlx.DB, files map[string]string) error {
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	attached, err := sqliteAttached(ctx, db)
+	if err != nil {
+		return err
+	}
+	schemas := make([]string, 0, len(files))
+	for schema := range files {
+		if !ValidSQLIdentifier(schema) {
+			return ConfigErrorf("invalid SQLite schema name %q", schema)
+		}
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+	for _, schema := range schemas {
+		if attached[strings.ToLower(schema)] {
+			continue
+		}
+		attachSQL := fmt.Sprintf("ATTACH DATABASE %v AS %v", sqlQuoteString(files[schema]), schema)
+		logger.Info("SQLiteAttach:", attachSQL)
+		if _, err := db.ExecContext(ctx, attachSQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteAttached returns the (lowercased) names of the databases attached
+// to db's connection.
+func sqliteAttached(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	rows, err := db.QueryxContext(ctx, "PRAGMA database_list")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attached := map[string]bool{}
+	for rows.Next() {
+		var seq int
+		var name, file string
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return nil, err
+		}
+		attached[strings.ToLower(name)] = true
+	}
+	return attached, rows.Err()
+}
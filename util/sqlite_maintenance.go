@@ -0,0 +1,76 @@
+package util
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// SQLiteMaintenance is the maintenance run by SQLiteMaintain after tables
+// have been loaded, so queries on them don't slow down after large
+// ingests.
+type SQLiteMaintenance struct {
+	// Statements are run first, in order, e.g. to refresh a summary table.
+	Statements []string
+	// Reindex rebuilds the tables' indexes, with REINDEX.
+	Reindex bool
+	// Analyze updates the statistics the query planner uses for the
+	// tables, with ANALYZE.
+	Analyze bool
+	// Vacuum rebuilds the databases the tables are in, with VACUUM, to
+	// reclaim the space of deleted rows and defragment them. It takes as
+	// much free disk space as the database, and fails if another
+	// connection is using it.
+	Vacuum bool
+}
+
+// IsZero returns true if there's no maintenance to run.
+func (m SQLiteMaintenance) IsZero() bool {
+	return len(m.Statements) == 0 && !m.Reindex && !m.Analyze && !m.Vacuum
+}
+
+// SQLiteMaintain runs m on tables, which may be qualified with the name
+// of an attached database (each database is vacuumed once).
+func SQLiteMaintain(ctx context.Context, db *sqlx.DB, tables []string, m SQLiteMaintenance) error {
+	statements := append([]string{}, m.Statements...)
+	schemas := map[string]bool{}
+	for _, t := range tables {
+		if err := ValidateSQLTableName(t); err != nil {
+			return err
+		}
+		if m.Reindex {
+			statements = append(statements, "REINDEX "+t)
+		}
+		if m.Analyze {
+			statements = append(statements, "ANALYZE "+t)
+		}
+		schema := "main"
+		if i := strings.LastIndex(t, "."); i >= 0 {
+			schema = t[:i]
+		}
+		schemas[schema] = true
+	}
+	if m.Vacuum {
+		// Last, since it rewrites the whole database.
+		names := make([]string, 0, len(schemas))
+		for schema := range schemas {
+			names = append(names, schema)
+		}
+		sort.Strings(names)
+		for _, schema := range names {
+			statements = append(statements, "VACUUM "+schema)
+		}
+	}
+
+	for _, st := range statements {
+		logger.Info("SQLiteMaintain:", st)
+		if _, err := db.ExecContext(ctx, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
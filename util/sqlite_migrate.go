@@ -0,0 +1,98 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fefelovgroup/ratchet/logger"
+)
+
+// SQLiteAddColumns adds a column to tableName for each field of objects
+// that it doesn't have yet, so records with new fields can still be
+// loaded when an upstream schema evolves. The table's columns are read
+// with PRAGMA table_info, and each new column is added with ALTER TABLE
+// ADD COLUMN, with its type inferred from the values as in CreateTableSQL.
+// Column names are compared case-insensitively, as SQLite does. Fields
+// named in skip (e.g. an op field that isn't written) are ignored.
+//
+// It returns the columns added, in sorted order. A column that another
+// writer adds in the meantime isn't an error.
+func SQLiteAddColumns(ctx context.Context, db *sqlx.DB, tableName string, objects []map[string]interface{}, skip ...string) ([]string, error) {
+	if err := validateSQLNames(tableName, objects); err != nil {
+		return nil, err
+	}
+	existing, err := sqliteColumns(ctx, db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range skip {
+		existing[strings.ToLower(s)] = true
+	}
+
+	schema, err := objectsSchema(objects)
+	if err != nil {
+		return nil, err
+	}
+	var added []SchemaColumn
+	for _, col := range schema.Columns() {
+		if !existing[strings.ToLower(col.Name)] {
+			added = append(added, col)
+		}
+	}
+
+	names := make([]string, 0, len(added))
+	for _, col := range added {
+		alterSQL := fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v %v", tableName, col.Name, columnType(SQLite, col.Type, false))
+		logger.Info("SQLiteAddColumns:", alterSQL)
+		if _, err := db.ExecContext(ctx, alterSQL); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return nil, err
+		}
+		names = append(names, col.Name)
+	}
+	return names, nil
+}
+
+// sqliteColumns returns the (lowercased) names of tableName's columns.
+func sqliteColumns(ctx context.Context, db *sqlx.DB, tableName string) (map[string]bool, error) {
+	// Format: PRAGMA schema.table_info(tablename)
+	pragma := "table_info"
+	name := tableName
+	if i := strings.LastIndex(tableName, "."); i >= 0 {
+		pragma = tableName[:i] + ".table_info"
+		name = tableName[i+1:]
+	}
+	rows, err := db.QueryxContext(ctx, fmt.Sprintf("PRAGMA %v(%v)", pragma, sqlQuoteString(name)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols := map[string]bool{}
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		col, ok := row["name"].(string)
+		if b, isBytes := row["name"].([]byte); isBytes {
+			col, ok = string(b), true
+		}
+		if ok {
+			cols[strings.ToLower(col)] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, ConfigErrorf("no such table: %v", tableName)
+	}
+	return cols, nil
+}
+
+// sqlQuoteString quotes s as a SQL string literal.
+func sqlQuoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -2,13 +2,16 @@ package util
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
-// Timer is a basic mechanism for measuring execution time.
+// Timer is a basic mechanism for measuring execution time. It's safe for
+// concurrent use, so a running Timer can be read while it's stopped.
 type Timer struct {
 	startTime time.Time
 	endTime   time.Time
+	mutex     sync.Mutex
 }
 
 // StartTimer returns a new Timer that's already "started".
@@ -18,20 +21,25 @@ func StartTimer() (t *Timer) {
 
 // Stop sets the end time for the Timer and returns itself.
 func (t *Timer) Stop() *Timer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 	t.endTime = time.Now()
 	return t
 }
 
 // Stopped returns true if Stop() has been called on the timer.
 func (t *Timer) Stopped() bool {
-	zeroTime := time.Time{}
-	return zeroTime != t.endTime
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return !t.endTime.IsZero()
 }
 
 // Duration returns either the total executino duration (if Timer stopped)
 // or the duration until time.Now() if timer is still running.
 func (t *Timer) Duration() time.Duration {
-	if t.Stopped() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.endTime.IsZero() {
 		return t.endTime.Sub(t.startTime)
 	}
 	return time.Now().Sub(t.startTime)
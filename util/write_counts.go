@@ -0,0 +1,50 @@
+package util
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SQLWriteCounts counts the rows a SQL writer has inserted, updated,
+// left unchanged (upserted with the values they already had) and
+// deleted, e.g. to verify a load. See SQLiteInsertOptions.Counts.
+type SQLWriteCounts struct {
+	Inserted  int64
+	Updated   int64
+	Unchanged int64
+	Deleted   int64
+}
+
+// Add adds other's counts to c. It's safe to call concurrently, but the
+// counts should be read with Load while others may be adding to them.
+func (c *SQLWriteCounts) Add(other SQLWriteCounts) {
+	atomic.AddInt64(&c.Inserted, other.Inserted)
+	atomic.AddInt64(&c.Updated, other.Updated)
+	atomic.AddInt64(&c.Unchanged, other.Unchanged)
+	atomic.AddInt64(&c.Deleted, other.Deleted)
+}
+
+// Load returns a copy of c's counts.
+func (c *SQLWriteCounts) Load() SQLWriteCounts {
+	return SQLWriteCounts{
+		Inserted:  atomic.LoadInt64(&c.Inserted),
+		Updated:   atomic.LoadInt64(&c.Updated),
+		Unchanged: atomic.LoadInt64(&c.Unchanged),
+		Deleted:   atomic.LoadInt64(&c.Deleted),
+	}
+}
+
+// Map returns the counts by name, e.g. for ratchet.CounterSource.
+func (c SQLWriteCounts) Map() map[string]int64 {
+	return map[string]int64{
+		"inserted":  c.Inserted,
+		"updated":   c.Updated,
+		"unchanged": c.Unchanged,
+		"deleted":   c.Deleted,
+	}
+}
+
+func (c SQLWriteCounts) String() string {
+	return fmt.Sprintf("inserted = %d, updated = %d, unchanged = %d, deleted = %d",
+		c.Inserted, c.Updated, c.Unchanged, c.Deleted)
+}